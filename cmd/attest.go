@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+)
+
+const (
+	localBuilderID = "https://github.com/waveywaves/tekton-slsa-demo/attest@v1"
+	localBuildType = "https://github.com/waveywaves/tekton-slsa-demo/local-build@v1"
+)
+
+// keyValueFlag collects repeated key=value flags.
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f keyValueFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	f[k] = v
+	return nil
+}
+
+// signerFlags are the signing options shared by subcommands that produce
+// envelopes, selecting one of the signing backends.
+type signerFlags struct {
+	prefix    string
+	keyPath   string
+	kms       string
+	keyless   bool
+	fulcioURL string
+	idToken   string
+	svidDir   string
+}
+
+// register adds the flags to fs, their names prefixed by prefix where
+// they would clash with a subcommand's own flags.
+func (f *signerFlags) register(fs *flag.FlagSet, prefix string) {
+	f.prefix = prefix
+	fs.StringVar(&f.keyPath, prefix+"key", "", "PEM private key to sign with")
+	fs.StringVar(&f.kms, prefix+"kms", "", "KMS key to sign with, such as hashivault://release (Vault at $VAULT_ADDR with $VAULT_TOKEN)")
+	fs.BoolVar(&f.keyless, prefix+"keyless", false, "sign with a short-lived Fulcio certificate")
+	fs.StringVar(&f.fulcioURL, prefix+"fulcio-url", signing.DefaultFulcioURL, "Fulcio URL for keyless signing")
+	fs.StringVar(&f.idToken, prefix+"identity-token", os.Getenv("SIGSTORE_ID_TOKEN"), "OIDC token for keyless signing")
+	fs.StringVar(&f.svidDir, prefix+"svid-dir", "", "sign with the X.509 SVID the SPIFFE helper keeps in this directory")
+}
+
+// names lists the flags that each select a backend.
+func (f *signerFlags) names() string {
+	return fmt.Sprintf("--%[1]skey, --%[1]skms, --%[1]skeyless or --%[1]ssvid-dir", f.prefix)
+}
+
+// backend opens the backend the flags select, or returns nil when they
+// select none.
+func (f *signerFlags) backend(ctx context.Context) (signing.Backend, error) {
+	opts := signing.Options{
+		Key:           f.keyPath,
+		LoadKey:       loadSigningKey,
+		KMS:           f.kms,
+		FulcioURL:     f.fulcioURL,
+		IdentityToken: f.idToken,
+		SVIDDir:       f.svidDir,
+	}
+	selected := 0
+	for backend, set := range map[string]bool{
+		signing.BackendKey:     f.keyPath != "",
+		signing.BackendKMS:     f.kms != "",
+		signing.BackendKeyless: f.keyless,
+		signing.BackendSPIFFE:  f.svidDir != "",
+	} {
+		if set {
+			opts.Backend = backend
+			selected++
+		}
+	}
+	if selected > 1 {
+		return nil, cli.ConfigError(fmt.Errorf("%s are mutually exclusive", f.names()))
+	}
+	b, err := signing.Open(ctx, opts)
+	if err != nil && opts.Backend == signing.BackendKey {
+		return nil, cli.ConfigError(err)
+	}
+	return b, err
+}
+
+// signers returns the configured signer, if any, and for certificate
+// backends the PEM certificate chain that must accompany its signatures.
+func (f *signerFlags) signers(ctx context.Context) ([]dsse.Signer, []byte, error) {
+	b, err := f.backend(ctx)
+	if err != nil || b == nil {
+		return nil, nil, err
+	}
+	return []dsse.Signer{b}, b.ChainPEM(), nil
+}
+
+// runAttest generates a SLSA v1 provenance statement for a file or image
+// and writes it as a DSSE envelope, signed if a signing backend is
+// selected.
+func runAttest(args []string) error {
+	fs := flag.NewFlagSet("attest", flag.ContinueOnError)
+	out := fs.String("out", "", "write the envelope to this file instead of stdout")
+	output := cli.OutputFlag(fs, cli.FormatJSON)
+	builderID := fs.String("builder-id", localBuilderID, "builder.id recorded in the provenance")
+	buildType := fs.String("build-type", localBuildType, "buildDefinition.buildType recorded in the provenance")
+	sourceURI := fs.String("source-uri", "", "source repository URI, e.g. git+https://github.com/org/repo")
+	sourceDigest := fs.String("source-digest", "", "source commit SHA recorded for --source-uri")
+	invocationID := fs.String("invocation-id", "", "runDetails.metadata.invocationId")
+	var sf signerFlags
+	sf.register(fs, "")
+	certOut := fs.String("cert-out", "", "where to write the certificate chain of keyless or SPIFFE signing (default <out>.crt)")
+	params := keyValueFlag{}
+	fs.Var(params, "param", "external parameter key=value (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo attest [flags] <file|image>")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return cli.ConfigError(errors.New("exactly one artifact is required"))
+	}
+	ctx := context.Background()
+	subject, err := artifactSubject(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	prov := attestation.Provenance{
+		BuildDefinition: attestation.BuildDefinition{
+			BuildType:          *buildType,
+			ExternalParameters: map[string]any{},
+		},
+		RunDetails: attestation.RunDetails{
+			Builder: attestation.Builder{
+				ID:      *builderID,
+				Version: map[string]string{"tekton-slsa-demo": getEnvOrDefault("APP_VERSION", "1.0.0")},
+			},
+			Metadata: &attestation.BuildMetadata{
+				InvocationID: *invocationID,
+				StartedOn:    &now,
+				FinishedOn:   &now,
+			},
+		},
+	}
+	for k, v := range params {
+		prov.BuildDefinition.ExternalParameters[k] = v
+	}
+	if *sourceURI != "" {
+		prov.BuildDefinition.ExternalParameters["source"] = *sourceURI
+		dep := attestation.ResourceDescriptor{URI: *sourceURI}
+		if *sourceDigest != "" {
+			dep.Digest = map[string]string{"sha1": *sourceDigest}
+		}
+		prov.BuildDefinition.ResolvedDependencies = append(prov.BuildDefinition.ResolvedDependencies, dep)
+	}
+
+	stmt, err := attestation.NewStatement(attestation.PredicateSLSAProvenanceV1, prov, subject)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(stmt)
+	if err != nil {
+		return err
+	}
+
+	signers, chainPEM, err := sf.signers(ctx)
+	if err != nil {
+		return err
+	}
+	env, err := dsse.Sign(attestation.PayloadType, payload, signers...)
+	if err != nil {
+		return err
+	}
+	// The envelope always goes to --out; with --output table, stdout gets a
+	// summary of it instead.
+	summary := func(w io.Writer) error {
+		printInspectReports(w, []inspectReport{inspectEnvelope(inspectInput{source: fs.Arg(0), envelope: env})})
+		return nil
+	}
+	if *out != "" {
+		format := *output
+		if format == cli.FormatTable {
+			format = cli.FormatJSON
+		}
+		if err := cli.WriteFile(*out, format, env, nil); err != nil {
+			return err
+		}
+		if *output == cli.FormatTable {
+			if err := summary(os.Stdout); err != nil {
+				return err
+			}
+		}
+	} else if err := cli.Write(os.Stdout, *output, env, summary); err != nil {
+		return err
+	}
+	if chainPEM != nil {
+		path := *certOut
+		if path == "" && *out != "" {
+			path = *out + ".crt"
+		}
+		if path == "" {
+			return cli.ConfigError(errors.New("--cert-out is required for keyless or SPIFFE signing to stdout"))
+		}
+		if err := os.WriteFile(path, chainPEM, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// artifactSubject digests a local file, or resolves an image reference to
+// its manifest digest when arg is not an existing path.
+func artifactSubject(ctx context.Context, arg string) (attestation.Subject, error) {
+	if f, err := os.Open(arg); err == nil {
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return attestation.Subject{}, err
+		}
+		return attestation.Subject{
+			Name:   filepath.Base(arg),
+			Digest: map[string]string{"sha256": hex.EncodeToString(h.Sum(nil))},
+		}, nil
+	}
+
+	ref, err := oci.ParseReference(arg)
+	if err != nil {
+		return attestation.Subject{}, fmt.Errorf("%q is neither a file nor an image reference: %w", arg, err)
+	}
+	digest, err := oci.NewClient().Resolve(ctx, ref)
+	if err != nil {
+		return attestation.Subject{}, fmt.Errorf("resolving %s: %w", ref, err)
+	}
+	alg, hexDigest, _ := strings.Cut(digest, ":")
+	return attestation.Subject{
+		Name:   ref.Name(),
+		Digest: map[string]string{alg: hexDigest},
+	}, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+)
+
+func TestRunAttest(t *testing.T) {
+	dir := t.TempDir()
+	artifact := filepath.Join(dir, "app.bin")
+	if err := os.WriteFile(artifact, []byte("binary contents"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "cosign.key")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "app.intoto.json")
+	err = runAttest([]string{
+		"--key", keyPath,
+		"--out", out,
+		"--source-uri", "git+https://github.com/waveywaves/tekton-slsa-demo",
+		"--source-digest", "0123abcd",
+		"--param", "target=linux/amd64",
+		artifact,
+	})
+	if err != nil {
+		t.Fatalf("runAttest() error: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := dsse.Parse(data)
+	if err != nil {
+		t.Fatalf("output is not a DSSE envelope: %v", err)
+	}
+	verifier, err := signing.NewVerifier(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Verify(verifier); err != nil {
+		t.Errorf("envelope signature did not verify: %v", err)
+	}
+
+	payload, _ := env.DecodePayload()
+	stmt, err := attestation.ParseStatement(payload)
+	if err != nil {
+		t.Fatalf("payload is not a statement: %v", err)
+	}
+	if stmt.PredicateType != attestation.PredicateSLSAProvenanceV1 {
+		t.Errorf("predicateType = %q, want %q", stmt.PredicateType, attestation.PredicateSLSAProvenanceV1)
+	}
+	sum := sha256.Sum256([]byte("binary contents"))
+	if got := stmt.Subject[0].Digest["sha256"]; got != hex.EncodeToString(sum[:]) {
+		t.Errorf("subject digest = %q, want %x", got, sum)
+	}
+}
+
+func TestRunAttestRequiresArtifact(t *testing.T) {
+	if err := runAttest(nil); err == nil {
+		t.Error("runAttest() without an artifact succeeded")
+	}
+}
+
+func BenchmarkArtifactSubject(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "app.bin")
+	const size = 16 << 20
+	if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(size)
+	for i := 0; i < b.N; i++ {
+		if _, err := artifactSubject(context.Background(), path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/rekor"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/strutil"
+	"github.com/waveywaves/tekton-slsa-demo/internal/trust"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// runBundle dispatches the bundle create and verify subcommands.
+func runBundle(args []string) error {
+	usage := cli.ConfigError(errors.New("usage: tekton-slsa-demo bundle create|verify [flags]"))
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "create":
+		return runBundleCreate(args[1:])
+	case "verify":
+		return runBundleVerify(args[1:])
+	default:
+		return usage
+	}
+}
+
+// evidenceFlags selects where bundle create and export fetch proofs and
+// trust material from.
+type evidenceFlags struct {
+	keyPath     string
+	trustedRoot string
+	rekorURL    string
+	fulcioURL   string
+	noTlog      bool
+	// registryTimeout and rekorTimeout bound each registry and Rekor call.
+	registryTimeout time.Duration
+	rekorTimeout    time.Duration
+}
+
+func (f *evidenceFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.keyPath, "key", "", "public key to include for key-based signatures")
+	fs.StringVar(&f.trustedRoot, "trusted-root", "", "Sigstore trusted_root.json to include instead of fetching trust material")
+	fs.StringVar(&f.rekorURL, "rekor-url", rekor.DefaultURL, "Rekor instance to fetch inclusion proofs and the log key from")
+	fs.StringVar(&f.fulcioURL, "fulcio-url", signing.DefaultFulcioURL, "Fulcio instance to fetch the CA chain from")
+	fs.BoolVar(&f.noTlog, "no-tlog", false, "do not contact Rekor for inclusion proofs")
+	fs.DurationVar(&f.registryTimeout, "registry-timeout", oci.DefaultTimeout, "how long each registry call may take; 0 disables the limit")
+	fs.DurationVar(&f.rekorTimeout, "rekor-timeout", rekor.DefaultTimeout, "how long each Rekor call may take; 0 disables the limit")
+}
+
+// collectBundle gathers an image's signatures, attestations and Rekor
+// proofs together with the trust root needed to check them.
+func (f *evidenceFlags) collectBundle(ctx context.Context, ref oci.Reference) (*verify.Bundle, error) {
+	var rc verify.RekorClient
+	if !f.noTlog {
+		c := rekor.NewClient(f.rekorURL)
+		c.Timeout = f.rekorTimeout
+		rc = c
+	}
+	registry := oci.NewClient()
+	registry.Timeout = f.registryTimeout
+	ev, err := verify.Collect(ctx, registry, rc, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &trust.Root{}
+	if f.trustedRoot != "" {
+		data, err := os.ReadFile(f.trustedRoot)
+		if err != nil {
+			return nil, cli.ConfigError(err)
+		}
+		if root, err = trust.ParseSigstoreTrustedRoot(data); err != nil {
+			return nil, cli.ConfigError(err)
+		}
+	} else {
+		// Only fetch the trust material the evidence actually needs.
+		hasTlog, hasCert := evidenceNeeds(ev)
+		fetchRekor, fetchFulcio := "", ""
+		if hasTlog && !f.noTlog {
+			fetchRekor = f.rekorURL
+		}
+		if hasCert {
+			fetchFulcio = f.fulcioURL
+		}
+		if root, err = trust.Fetch(ctx, nil, fetchRekor, fetchFulcio); err != nil {
+			return nil, err
+		}
+	}
+	if f.keyPath != "" {
+		key, err := signing.LoadPublicKey(f.keyPath)
+		if err != nil {
+			return nil, cli.ConfigError(fmt.Errorf("loading key: %w", err))
+		}
+		if err := root.AddPublicKey(key); err != nil {
+			return nil, err
+		}
+	}
+	return verify.NewBundle(ev, root, time.Now()), nil
+}
+
+// runBundleCreate writes an image's evidence and trust root to a bundle
+// file for offline verification.
+func runBundleCreate(args []string) error {
+	fs := flag.NewFlagSet("bundle create", flag.ContinueOnError)
+	out := fs.String("out", "", "bundle file to write (required)")
+	var ef evidenceFlags
+	ef.register(fs)
+	output := cli.OutputFlag(fs, cli.FormatTable)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo bundle create [flags] <image>")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *out == "" {
+		fs.Usage()
+		return cli.ConfigError(errors.New("an image and --out are required"))
+	}
+	ref, err := oci.ParseReference(fs.Arg(0))
+	if err != nil {
+		return cli.ConfigError(err)
+	}
+
+	b, err := ef.collectBundle(context.Background(), ref)
+	if err != nil {
+		return err
+	}
+	if err := b.Write(*out); err != nil {
+		return err
+	}
+	ev := b.Evidence
+	summary := bundleSummary{
+		Image:        ref.Name(),
+		Digest:       ev.Digest,
+		Signatures:   len(ev.Signatures),
+		Attestations: len(ev.Attestations),
+		Path:         *out,
+	}
+	return cli.Write(os.Stdout, *output, summary, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "Wrote bundle for %s@%s with %d signature(s) and %d attestation(s) to %s\n",
+			summary.Image, summary.Digest, summary.Signatures, summary.Attestations, summary.Path)
+		return err
+	})
+}
+
+// bundleSummary is the structured output of bundle create.
+type bundleSummary struct {
+	Image        string `json:"image"`
+	Digest       string `json:"digest"`
+	Signatures   int    `json:"signatures"`
+	Attestations int    `json:"attestations"`
+	Path         string `json:"path"`
+}
+
+func evidenceNeeds(ev *verify.Evidence) (tlog, cert bool) {
+	for _, s := range ev.Signatures {
+		tlog = tlog || s.Tlog != nil
+		cert = cert || s.Certificate != ""
+	}
+	for _, a := range ev.Attestations {
+		tlog = tlog || a.Tlog != nil
+		cert = cert || a.Certificate != ""
+	}
+	return tlog, cert
+}
+
+// runBundleVerify verifies a bundle entirely offline, against a key or a
+// trusted root given on the command line: the bundle's own trusted root
+// only has to match it.
+func runBundleVerify(args []string) error {
+	fs := flag.NewFlagSet("bundle verify", flag.ContinueOnError)
+	keyPath := fs.String("key", "", "public key to trust")
+	trustedRoot := fs.String("trusted-root", "", "Sigstore trusted_root.json with the Fulcio and Rekor roots to trust")
+	identity := fs.String("certificate-identity", "", "regular expression keyless signer identities must match")
+	issuer := fs.String("certificate-oidc-issuer", "", "OIDC issuer keyless certificates must carry")
+	requireTlog := fs.Bool("require-tlog", false, "reject signatures without a verified Rekor entry")
+	output := cli.OutputFlag(fs, cli.FormatTable, cli.FormatSARIF)
+	asJSON := fs.Bool("json", false, "shorthand for --output json")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo bundle verify [flags] <bundle>")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return cli.ConfigError(errors.New("exactly one bundle is required"))
+	}
+	if *asJSON {
+		*output = cli.FormatJSON
+	}
+	if *keyPath == "" && *trustedRoot == "" {
+		return cli.ConfigError(errors.New("--key or --trusted-root is required: the bundle's own trusted root is not trusted"))
+	}
+	if *trustedRoot != "" && (*identity == "" || *issuer == "") {
+		return cli.ConfigError(errors.New("--trusted-root needs --certificate-identity and --certificate-oidc-issuer"))
+	}
+	b, err := verify.ReadBundle(fs.Arg(0))
+	if err != nil {
+		return cli.ConfigError(err)
+	}
+
+	root := &trust.Root{}
+	if *trustedRoot != "" {
+		data, err := os.ReadFile(*trustedRoot)
+		if err != nil {
+			return cli.ConfigError(err)
+		}
+		if root, err = trust.ParseSigstoreTrustedRoot(data); err != nil {
+			return cli.ConfigError(err)
+		}
+	}
+	if *keyPath != "" {
+		key, err := signing.LoadPublicKey(*keyPath)
+		if err != nil {
+			return cli.ConfigError(fmt.Errorf("loading key: %w", err))
+		}
+		if err := root.AddPublicKey(key); err != nil {
+			return err
+		}
+	}
+	res, err := b.Verify(verify.Options{
+		Root:        root,
+		Identity:    *identity,
+		Issuer:      *issuer,
+		RequireTlog: *requireTlog,
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeVerifyResult(os.Stdout, *output, res)
+}
+
+// writeVerifyResult renders a verification result and turns a failed
+// verification into the matching exit code.
+func writeVerifyResult(w io.Writer, f cli.Format, res *verify.Result) error {
+	var err error
+	if f == cli.FormatSARIF {
+		err = res.SARIF("tekton-slsa-demo", getEnvOrDefault("APP_VERSION", "1.0.0")).Write(w)
+	} else {
+		err = cli.Write(w, f, res, func(w io.Writer) error {
+			printVerifyResult(w, res)
+			return nil
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if !res.Verified {
+		return cli.VerificationError(failure.New(res.Code, "verification failed"))
+	}
+	return nil
+}
+
+func printVerifyResult(w io.Writer, res *verify.Result) {
+	fmt.Fprintf(w, "Image:  %s\nDigest: %s\n\n", res.Image, res.Digest)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tPREDICATE\tSIGNER\tLOG INDEX\tRESULT")
+	for _, c := range res.Checks {
+		logIndex := "-"
+		if c.LogIndex != nil {
+			logIndex = fmt.Sprint(*c.LogIndex)
+		}
+		result := "verified"
+		switch {
+		case c.Verified:
+		case c.Code != "":
+			result = "FAILED [" + string(c.Code) + "]: " + c.Error
+		default:
+			result = "FAILED: " + c.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", c.Kind, strutil.Default(c.PredicateType, "-"), strutil.Default(c.Signer, "-"), logIndex, result)
+	}
+	tw.Flush()
+	for _, c := range res.Checks {
+		if len(c.Annotations) > 0 {
+			fmt.Fprintf(w, "\nAnnotations of the signature by %s: %s\n", strutil.Default(c.Signer, "an unknown signer"), verify.FormatAnnotations(c.Annotations))
+		}
+	}
+	for _, c := range res.Checks {
+		if len(c.SchemaViolations) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\nSchema violations in %s:\n", attestation.PredicateName(c.PredicateType))
+		for _, v := range c.SchemaViolations {
+			fmt.Fprintf(w, "  - %s\n", v)
+		}
+	}
+	for _, c := range res.Checks {
+		if len(c.UnpinnedMaterials) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\nUnpinned materials in %s:\n", attestation.PredicateName(c.PredicateType))
+		for _, m := range c.UnpinnedMaterials {
+			fmt.Fprintf(w, "  - %s\n", m)
+		}
+	}
+	if res.Verified {
+		fmt.Fprintln(w, "\nVerification: PASSED")
+	} else {
+		fmt.Fprintf(w, "\nVerification: FAILED%s\n", codeSuffix(res.Code))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+)
+
+func TestRunBundleVerifyNeedsLocalTrust(t *testing.T) {
+	dir := t.TempDir()
+	// The bundle's trusted root holds the key that signed it, as a forged
+	// bundle's would.
+	b := exportFixture(t)
+	path := filepath.Join(dir, "app.bundle.json")
+	if err := b.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := b.TrustedRoot.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signerKey := writePublicKey(t, dir, "signer.pub", keys[0])
+	_, otherPub := signedProvenance(t)
+	otherKey := writePublicKey(t, dir, "other.pub", otherPub)
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"local key", []string{"--key", signerKey, path}, cli.ExitOK},
+		{"no local trust", []string{path}, cli.ExitConfig},
+		{"another key", []string{"--key", otherKey, path}, cli.ExitVerification},
+		{"trusted root without identity", []string{"--trusted-root", filepath.Join(dir, "trusted_root.json"), path}, cli.ExitConfig},
+	}
+	for _, tt := range tests {
+		if got := cli.ExitCode(runBundleVerify(tt.args)); got != tt.want {
+			t.Errorf("%s: exit code %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// writePublicKey writes key as a PEM public key file in dir.
+func writePublicKey(t *testing.T, dir, name string, key crypto.PublicKey) string {
+	t.Helper()
+	pem, err := signing.MarshalPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/strutil"
+)
+
+// subcommands lists the verbs of the subcommands that take one.
+var subcommands = map[string][]string{
+	"bundle":     {"create", "verify"},
+	"completion": {"bash", "fish", "zsh"},
+	"config":     {"init"},
+	"keys":       {"generate", "import", "list"},
+	"policy":     {"test"},
+}
+
+// summaries describes the subcommands in fish completions.
+var summaries = map[string]string{
+	"attest":     "Generate SLSA provenance for a file or image",
+	"bundle":     "Create or verify an offline verification bundle",
+	"completion": "Print a shell completion script",
+	"config":     "Manage the configuration file",
+	"diff":       "Compare the provenance of two builds",
+	"export":     "Export an image's supply-chain evidence for auditors",
+	"inspect":    "Decode and verify DSSE attestations",
+	"keys":       "Manage signing key pairs",
+	"policy":     "Test policies against attestation fixtures",
+	"sbom":       "Generate an SBOM for a binary or image",
+	"scan":       "Look up vulnerabilities in OSV",
+	"serve":      "Run the HTTP server",
+	"verify":     "Verify the signatures and attestations on an image",
+}
+
+// completion is registered at init time because it reads commands itself.
+func init() {
+	commands["completion"] = runCompletion
+}
+
+// runCompletion prints a completion script for bash, zsh or fish.
+func runCompletion(args []string) error {
+	usage := cli.ConfigError(errors.New("usage: tekton-slsa-demo completion bash|zsh|fish"))
+	if len(args) != 1 {
+		return usage
+	}
+	var write func(io.Writer, []completionEntry)
+	switch args[0] {
+	case "bash":
+		write = bashCompletion
+	case "zsh":
+		write = zshCompletion
+	case "fish":
+		write = fishCompletion
+	case "-h", "-help", "--help":
+		fmt.Fprintln(os.Stderr, "Usage: tekton-slsa-demo completion bash|zsh|fish")
+		return flag.ErrHelp
+	default:
+		return usage
+	}
+	write(os.Stdout, completionEntries())
+	return nil
+}
+
+// completionEntry is a subcommand, or a subcommand and verb, with its
+// flags.
+type completionEntry struct {
+	command string
+	verb    string
+	flags   []*flag.Flag
+}
+
+func (e completionEntry) key() string {
+	if e.verb == "" {
+		return e.command
+	}
+	return e.command + " " + e.verb
+}
+
+func (e completionEntry) flagNames(prefix string) string {
+	names := make([]string, len(e.flags))
+	for i, f := range e.flags {
+		names[i] = prefix + f.Name
+	}
+	return strings.Join(names, " ")
+}
+
+// completionEntries collects the flags of every subcommand by running each
+// one up to its flag parsing.
+func completionEntries() []completionEntry {
+	var entries []completionEntry
+	for _, name := range commandNames() {
+		run := commands[name]
+		verbs := subcommands[name]
+		if len(verbs) == 0 {
+			verbs = []string{""}
+		}
+		for _, verb := range verbs {
+			e := completionEntry{command: name, verb: verb}
+			// completion has no flags, and running it would print a script.
+			if name == "completion" {
+				entries = append(entries, e)
+				continue
+			}
+			args := []string{}
+			if verb != "" {
+				args = append(args, verb)
+			}
+			if fs := cli.Flags(func() error { return run(args) }); fs != nil {
+				fs.VisitAll(func(f *flag.Flag) { e.flags = append(e.flags, f) })
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func bashCompletion(w io.Writer, entries []completionEntry) {
+	fmt.Fprintf(w, `# bash completion for tekton-slsa-demo
+# Load with: source <(tekton-slsa-demo completion bash)
+_tekton_slsa_demo() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    local cmd=${COMP_WORDS[1]} key flags
+    if [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "%s" -- "$cur"))
+        return
+    fi
+    key=$cmd
+    case $cmd in
+`, strings.Join(commandNames(), " "))
+	for _, name := range commandNames() {
+		verbs, ok := subcommands[name]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, `    %s)
+        if [[ $COMP_CWORD -eq 2 ]]; then
+            COMPREPLY=($(compgen -W "%s" -- "$cur"))
+            return
+        fi
+        key="$cmd ${COMP_WORDS[2]}"
+        ;;
+`, name, strings.Join(verbs, " "))
+	}
+	fmt.Fprint(w, "    esac\n    case $key in\n")
+	for _, e := range entries {
+		if len(e.flags) > 0 {
+			fmt.Fprintf(w, "    %q) flags=%q ;;\n", e.key(), e.flagNames("--"))
+		}
+	}
+	fmt.Fprint(w, `    esac
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+    fi
+}
+complete -o default -F _tekton_slsa_demo tekton-slsa-demo
+`)
+}
+
+func zshCompletion(w io.Writer, entries []completionEntry) {
+	fmt.Fprintf(w, `#compdef tekton-slsa-demo
+# zsh completion for tekton-slsa-demo
+# Load with: source <(tekton-slsa-demo completion zsh)
+_tekton_slsa_demo() {
+    local key
+    local -a flags
+    if (( CURRENT == 2 )); then
+        compadd -- %s
+        return
+    fi
+    key=$words[2]
+    case $key in
+`, strings.Join(commandNames(), " "))
+	for _, name := range commandNames() {
+		verbs, ok := subcommands[name]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, `    %s)
+        if (( CURRENT == 3 )); then
+            compadd -- %s
+            return
+        fi
+        key="$words[2] $words[3]"
+        ;;
+`, name, strings.Join(verbs, " "))
+	}
+	fmt.Fprint(w, "    esac\n    case $key in\n")
+	for _, e := range entries {
+		if len(e.flags) > 0 {
+			fmt.Fprintf(w, "    %q) flags=(%s) ;;\n", e.key(), e.flagNames("--"))
+		}
+	}
+	fmt.Fprint(w, `    esac
+    if [[ $PREFIX == -* ]]; then
+        compadd -a flags
+    else
+        _files
+    fi
+}
+compdef _tekton_slsa_demo tekton-slsa-demo
+`)
+}
+
+func fishCompletion(w io.Writer, entries []completionEntry) {
+	fmt.Fprintln(w, "# fish completion for tekton-slsa-demo")
+	fmt.Fprintln(w, "# Load with: tekton-slsa-demo completion fish | source")
+	for _, name := range commandNames() {
+		fmt.Fprintf(w, "complete -c tekton-slsa-demo -f -n __fish_use_subcommand -a %s -d %s\n", name, fishQuote(summaries[name]))
+	}
+	for _, name := range commandNames() {
+		verbs, ok := subcommands[name]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "complete -c tekton-slsa-demo -f -n %s -a %s\n",
+			fishQuote(fmt.Sprintf("__fish_seen_subcommand_from %s; and not __fish_seen_subcommand_from %s", name, strings.Join(verbs, " "))),
+			fishQuote(strings.Join(verbs, " ")))
+	}
+	for _, e := range entries {
+		cond := "__fish_seen_subcommand_from " + e.command
+		if e.verb != "" {
+			cond += "; and __fish_seen_subcommand_from " + e.verb
+		}
+		for _, f := range e.flags {
+			opt := "-l"
+			if len(f.Name) == 1 {
+				opt = "-s"
+			}
+			fmt.Fprintf(w, "complete -c tekton-slsa-demo -n %s %s %s -d %s\n", fishQuote(cond), opt, f.Name, fishQuote(strutil.FirstLine(f.Usage)))
+		}
+	}
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompletionScripts(t *testing.T) {
+	entries := completionEntries()
+	flags := map[string]string{}
+	for _, e := range entries {
+		flags[e.key()] = e.flagNames("--")
+	}
+	for key, flag := range map[string]string{
+		"scan":          "--fail-on",
+		"bundle verify": "--certificate-identity",
+		"keys generate": "--output-key-prefix",
+		"config init":   "--force",
+		"serve":         "--dev",
+	} {
+		if !strings.Contains(flags[key], flag) {
+			t.Errorf("flags for %q = %q, want %s", key, flags[key], flag)
+		}
+	}
+
+	for shell, write := range map[string]func(*strings.Builder){
+		"bash": func(b *strings.Builder) { bashCompletion(b, entries) },
+		"zsh":  func(b *strings.Builder) { zshCompletion(b, entries) },
+		"fish": func(b *strings.Builder) { fishCompletion(b, entries) },
+	} {
+		var b strings.Builder
+		write(&b)
+		for _, want := range []string{"serve", "generate", "fail-on"} {
+			if !strings.Contains(b.String(), want) {
+				t.Errorf("%s completion does not mention %q", shell, want)
+			}
+		}
+	}
+}
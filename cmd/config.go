@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/config"
+)
+
+// runConfig dispatches the config subcommands.
+func runConfig(args []string) error {
+	usage := cli.ConfigError(errors.New("usage: tekton-slsa-demo config init [flags]"))
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "init":
+		return runConfigInit(args[1:])
+	default:
+		return usage
+	}
+}
+
+// runConfigInit writes a commented starter config file.
+func runConfigInit(args []string) error {
+	fs := flag.NewFlagSet("config init", flag.ContinueOnError)
+	out := fs.String("out", config.DefaultFile, "file to write, or - for stdout")
+	force := fs.Bool("force", false, "overwrite an existing file")
+	output := cli.OutputFlag(fs, cli.FormatTable)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo config init [flags]")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return cli.ConfigError(errors.New("unexpected arguments"))
+	}
+	if *out == "-" {
+		_, err := os.Stdout.Write(config.Starter())
+		return err
+	}
+	if _, err := os.Stat(*out); err == nil && !*force {
+		return cli.ConfigError(fmt.Errorf("%s already exists (use --force to overwrite)", *out))
+	}
+	if err := os.WriteFile(*out, config.Starter(), 0o644); err != nil {
+		return err
+	}
+	result := struct {
+		Path string `json:"path"`
+	}{*out}
+	return cli.Write(os.Stdout, *output, result, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "Wrote starter configuration to %s\nStart the server with: tekton-slsa-demo serve --config %s\n", *out, *out)
+		return err
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cosign"
+	"github.com/waveywaves/tekton-slsa-demo/internal/jsondiff"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+)
+
+// provenanceDoc is a provenance statement with its predicate normalised to
+// SLSA v1, so v0.2 and v1 provenance can be compared field by field.
+type provenanceDoc struct {
+	Type          string                  `json:"_type"`
+	Subject       []attestation.Subject   `json:"subject"`
+	PredicateType string                  `json:"predicateType"`
+	Predicate     *attestation.Provenance `json:"predicate"`
+}
+
+// diffResult is the JSON output of the diff subcommand.
+type diffResult struct {
+	A       string            `json:"a"`
+	B       string            `json:"b"`
+	Equal   bool              `json:"equal"`
+	Changes []jsondiff.Change `json:"changes"`
+}
+
+// runDiff compares the provenance of two attestation files or images.
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	output := cli.OutputFlag(fs, cli.FormatTable)
+	asJSON := fs.Bool("json", false, "shorthand for --output json")
+	contextLines := fs.Int("context", 3, "lines of context in the unified diff")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo diff [flags] <file|image> <file|image>")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return cli.ConfigError(errors.New("exactly two attestations or images are required"))
+	}
+	if *asJSON {
+		*output = cli.FormatJSON
+	}
+
+	ctx := context.Background()
+	a, err := loadProvenance(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := loadProvenance(ctx, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	an, err := jsondiff.Normalize(a)
+	if err != nil {
+		return err
+	}
+	bn, err := jsondiff.Normalize(b)
+	if err != nil {
+		return err
+	}
+
+	// Structured formats report field-level changes; the table format is
+	// a unified diff of the normalised documents.
+	if *output != cli.FormatTable {
+		changes := jsondiff.Compare(an, bn)
+		return cli.Write(os.Stdout, *output, diffResult{
+			A:       fs.Arg(0),
+			B:       fs.Arg(1),
+			Equal:   len(changes) == 0,
+			Changes: append([]jsondiff.Change{}, changes...),
+		}, nil)
+	}
+
+	al, err := jsondiff.Lines(an)
+	if err != nil {
+		return err
+	}
+	bl, err := jsondiff.Lines(bn)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(os.Stdout, jsondiff.Unified(fs.Arg(0), fs.Arg(1), al, bl, *contextLines))
+	return nil
+}
+
+// loadProvenance reads SLSA provenance from an attestation file or from the
+// attestations attached to an image. When several provenance statements
+// are present the last one is used, matching the order Chains appends them.
+func loadProvenance(ctx context.Context, arg string) (*provenanceDoc, error) {
+	var stmts []*attestation.Statement
+	if data, err := os.ReadFile(arg); err == nil {
+		envs, err := attestation.DecodeEnvelopes(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", arg, err)
+		}
+		for _, env := range envs {
+			payload, err := env.DecodePayload()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", arg, err)
+			}
+			var st attestation.Statement
+			if err := json.Unmarshal(payload, &st); err != nil {
+				return nil, fmt.Errorf("%s: %w", arg, err)
+			}
+			stmts = append(stmts, &st)
+		}
+	} else {
+		ref, err := oci.ParseReference(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither a file nor an image reference: %w", arg, err)
+		}
+		client := oci.NewClient()
+		digest, err := client.Resolve(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", ref, err)
+		}
+		atts, err := cosign.Attestations(ctx, client, ref.WithDigest(digest))
+		if err != nil {
+			return nil, err
+		}
+		for _, att := range atts {
+			payload, err := att.Envelope.DecodePayload()
+			if err != nil {
+				return nil, err
+			}
+			var st attestation.Statement
+			if err := json.Unmarshal(payload, &st); err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, &st)
+		}
+	}
+
+	for i := len(stmts) - 1; i >= 0; i-- {
+		st := stmts[i]
+		if !attestation.IsProvenance(st.PredicateType) {
+			continue
+		}
+		prov, err := attestation.NormalizeProvenance(st)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", arg, err)
+		}
+		return &provenanceDoc{
+			Type:          st.Type,
+			Subject:       st.Subject,
+			PredicateType: st.PredicateType,
+			Predicate:     prov,
+		}, nil
+	}
+	return nil, fmt.Errorf("%s: no SLSA provenance found", arg)
+}
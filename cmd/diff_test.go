@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/jsondiff"
+)
+
+func TestLoadProvenanceNormalizesV02(t *testing.T) {
+	dir := t.TempDir()
+	v02 := filepath.Join(dir, "v02.json")
+	os.WriteFile(v02, []byte(`{
+		"_type": "https://in-toto.io/Statement/v0.1",
+		"predicateType": "https://slsa.dev/provenance/v0.2",
+		"subject": [{"name": "app", "digest": {"sha256": "abc"}}],
+		"predicate": {"builder": {"id": "https://tekton.dev/chains/v2"}, "buildType": "tekton.dev/v1beta1/TaskRun"}
+	}`), 0o644)
+
+	v1 := filepath.Join(dir, "v1.json")
+	os.WriteFile(v1, []byte(`{
+		"_type": "https://in-toto.io/Statement/v1",
+		"predicateType": "https://slsa.dev/provenance/v1",
+		"subject": [{"name": "app", "digest": {"sha256": "def"}}],
+		"predicate": {
+			"buildDefinition": {"buildType": "tekton.dev/v1beta1/TaskRun", "externalParameters": {}},
+			"runDetails": {"builder": {"id": "https://tekton.dev/chains/v2"}}
+		}
+	}`), 0o644)
+
+	a, err := loadProvenance(context.Background(), v02)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := loadProvenance(context.Background(), v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	an, _ := jsondiff.Normalize(a)
+	bn, _ := jsondiff.Normalize(b)
+
+	paths := map[string]bool{}
+	for _, c := range jsondiff.Compare(an, bn) {
+		paths[c.Path] = true
+	}
+	for _, p := range []string{"_type", "predicateType", "subject[0].digest.sha256"} {
+		if !paths[p] {
+			t.Errorf("expected a change at %s, got %v", p, paths)
+		}
+	}
+	if paths["predicate.runDetails.builder.id"] || paths["predicate.buildDefinition.buildType"] {
+		t.Errorf("normalised predicates should match, got changes %v", paths)
+	}
+}
+
+func TestLoadProvenanceRequiresProvenance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sbom.json")
+	stmt, _ := json.Marshal(map[string]any{
+		"_type":         "https://in-toto.io/Statement/v1",
+		"predicateType": "https://spdx.dev/Document",
+		"subject":       []any{map[string]any{"name": "app", "digest": map[string]string{"sha256": "abc"}}},
+		"predicate":     map[string]any{},
+	})
+	os.WriteFile(path, stmt, 0o644)
+	if _, err := loadProvenance(context.Background(), path); err == nil {
+		t.Error("loadProvenance() accepted a file without provenance")
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// runExport gathers everything attached to an image into a directory or
+// tarball that can be handed to auditors. Alongside the individual files it
+// writes bundle.json, which bundle verify checks offline, and manifest.json,
+// which lists the digest of every file in the export. With a signing
+// backend selected, manifest.intoto.json attests to every file as well.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("out", "", "directory, or .tar/.tar.gz/.tgz file, to write (required)")
+	force := fs.Bool("force", false, "write into an existing directory or overwrite an existing tarball")
+	var ef evidenceFlags
+	ef.register(fs)
+	var sf signerFlags
+	sf.register(fs, "sign-")
+	output := cli.OutputFlag(fs, cli.FormatTable)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo export [flags] <image>")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *out == "" {
+		fs.Usage()
+		return cli.ConfigError(errors.New("an image and --out are required"))
+	}
+	ref, err := oci.ParseReference(fs.Arg(0))
+	if err != nil {
+		return cli.ConfigError(err)
+	}
+	if _, err := os.Stat(*out); err == nil && !*force {
+		return cli.ConfigError(fmt.Errorf("%s already exists (use --force to overwrite)", *out))
+	}
+
+	ctx := context.Background()
+	signer, err := sf.backend(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := ef.collectBundle(ctx, ref)
+	if err != nil {
+		return err
+	}
+	ew, err := newExportWriter(*out)
+	if err != nil {
+		return cli.ConfigError(err)
+	}
+	m, err := writeExport(ew, b, signer)
+	if cerr := ew.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", *out, err)
+	}
+	if signer != nil {
+		fmt.Fprintf(os.Stderr, "Signed manifest.intoto.json with the %s signer, key %s\n", signer.Name(), signer.KeyID())
+	}
+	return cli.Write(os.Stdout, *output, m, func(w io.Writer) error {
+		return printExportManifest(w, m, *out)
+	})
+}
+
+// exportManifest is written last to manifest.json and describes the export.
+type exportManifest struct {
+	Image        string       `json:"image"`
+	Digest       string       `json:"digest"`
+	CreatedAt    time.Time    `json:"createdAt"`
+	Signatures   int          `json:"signatures"`
+	Attestations int          `json:"attestations"`
+	Files        []exportFile `json:"files"`
+}
+
+type exportFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+// writeExport lays out a bundle's evidence as individual files:
+//
+//	signatures/signature-N.json
+//	attestations/<kind>-N.intoto.json
+//	certificates/<name>.pem
+//	rekor/<name>.json
+//	bundle.json
+//	manifest.json
+//	manifest.intoto.json, when signer is not nil
+func writeExport(ew exportWriter, b *verify.Bundle, signer signing.Backend) (*exportManifest, error) {
+	ev := b.Evidence
+	m := &exportManifest{
+		Image:        ev.Image,
+		Digest:       ev.Digest,
+		CreatedAt:    b.CreatedAt,
+		Signatures:   len(ev.Signatures),
+		Attestations: len(ev.Attestations),
+		Files:        []exportFile{},
+	}
+	add := func(path string, data []byte) error {
+		sum := sha256.Sum256(data)
+		m.Files = append(m.Files, exportFile{Path: path, SHA256: hex.EncodeToString(sum[:]), Size: len(data)})
+		return ew.add(path, data)
+	}
+	addJSON := func(path string, v any) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		return add(path, append(data, '\n'))
+	}
+	// proofs writes the certificate chain and Rekor proof accompanying one
+	// signature or attestation.
+	proofs := func(name, cert, chain string, tlog *verify.TlogProof) error {
+		if cert != "" {
+			if err := add("certificates/"+name+".pem", []byte(cert+chain)); err != nil {
+				return err
+			}
+		}
+		if tlog != nil {
+			return addJSON("rekor/"+name+".json", tlog)
+		}
+		return nil
+	}
+
+	for i, s := range ev.Signatures {
+		name := fmt.Sprintf("signature-%d", i+1)
+		if err := addJSON("signatures/"+name+".json", s); err != nil {
+			return nil, err
+		}
+		if err := proofs(name, s.Certificate, s.Chain, s.Tlog); err != nil {
+			return nil, err
+		}
+	}
+	for i, a := range ev.Attestations {
+		name := fmt.Sprintf("%s-%d", evidenceKind(a.Envelope), i+1)
+		if err := addJSON("attestations/"+name+".intoto.json", a.Envelope); err != nil {
+			return nil, err
+		}
+		if err := proofs(name, a.Certificate, a.Chain, a.Tlog); err != nil {
+			return nil, err
+		}
+	}
+	if err := addJSON("bundle.json", b); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, '\n')
+	if err := ew.add("manifest.json", data); err != nil {
+		return nil, err
+	}
+	if signer != nil {
+		env, err := signManifest(signer, m, data)
+		if err != nil {
+			return nil, err
+		}
+		envJSON, err := json.MarshalIndent(env, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := ew.add("manifest.intoto.json", append(envJSON, '\n')); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// exportPredicateType is the predicate type of signed export manifests.
+const exportPredicateType = "https://github.com/waveywaves/tekton-slsa-demo/export/v1"
+
+// signManifest signs an in-toto statement whose subjects are every file of
+// an export, manifest.json included, and whose predicate is the manifest.
+func signManifest(signer signing.Backend, m *exportManifest, manifest []byte) (*dsse.Envelope, error) {
+	sum := sha256.Sum256(manifest)
+	subjects := []attestation.Subject{{Name: "manifest.json", Digest: map[string]string{"sha256": hex.EncodeToString(sum[:])}}}
+	for _, f := range m.Files {
+		subjects = append(subjects, attestation.Subject{Name: f.Path, Digest: map[string]string{"sha256": f.SHA256}})
+	}
+	stmt, err := attestation.NewStatement(exportPredicateType, m, subjects...)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(stmt)
+	if err != nil {
+		return nil, err
+	}
+	return signing.Sign(signer, attestation.PayloadType, payload)
+}
+
+// evidenceKind names an attestation's file after what it attests to.
+func evidenceKind(env *dsse.Envelope) string {
+	payload, err := env.DecodePayload()
+	if err != nil {
+		return "attestation"
+	}
+	stmt, err := attestation.ParseStatement(payload)
+	if err != nil {
+		return "attestation"
+	}
+	switch {
+	case attestation.IsProvenance(stmt.PredicateType):
+		return "provenance"
+	case stmt.PredicateType == attestation.PredicateSPDX:
+		return "sbom-spdx"
+	case stmt.PredicateType == attestation.PredicateCycloneDX:
+		return "sbom-cyclonedx"
+	case stmt.PredicateType == attestation.PredicateVulnerability:
+		return "vulnerability"
+	case stmt.PredicateType == attestation.PredicateVSA:
+		return "vsa"
+	}
+	return "attestation"
+}
+
+func printExportManifest(w io.Writer, m *exportManifest, out string) error {
+	fmt.Fprintf(w, "Exported %s@%s to %s\n\n", m.Image, m.Digest, out)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tSIZE\tSHA256")
+	for _, f := range m.Files {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", f.Path, f.Size, f.SHA256)
+	}
+	return tw.Flush()
+}
+
+// exportWriter receives the files of an export.
+type exportWriter interface {
+	add(path string, data []byte) error
+	Close() error
+}
+
+// newExportWriter writes to a tarball if out ends in .tar, .tar.gz or
+// .tgz, and to a directory otherwise.
+func newExportWriter(out string) (exportWriter, error) {
+	compress := strings.HasSuffix(out, ".tar.gz") || strings.HasSuffix(out, ".tgz")
+	if !compress && !strings.HasSuffix(out, ".tar") {
+		if err := os.MkdirAll(out, 0o755); err != nil {
+			return nil, err
+		}
+		return dirExport(out), nil
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return nil, err
+	}
+	tw := &tarExport{f: f, now: time.Now()}
+	if compress {
+		tw.gz = gzip.NewWriter(f)
+		tw.tw = tar.NewWriter(tw.gz)
+	} else {
+		tw.tw = tar.NewWriter(f)
+	}
+	return tw, nil
+}
+
+type dirExport string
+
+func (d dirExport) add(path string, data []byte) error {
+	full := filepath.Join(string(d), filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(full, data, 0o644)
+}
+
+func (d dirExport) Close() error { return nil }
+
+type tarExport struct {
+	f   *os.File
+	gz  *gzip.Writer
+	tw  *tar.Writer
+	now time.Time
+}
+
+func (t *tarExport) add(path string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    path,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: t.now,
+	}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := t.tw.Write(data)
+	return err
+}
+
+func (t *tarExport) Close() error {
+	err := t.tw.Close()
+	if t.gz != nil {
+		err = errors.Join(err, t.gz.Close())
+	}
+	return errors.Join(err, t.f.Close())
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/trust"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+func exportFixture(t *testing.T) *verify.Bundle {
+	t.Helper()
+	env, pub := signedProvenance(t)
+	root := &trust.Root{}
+	if err := root.AddPublicKey(pub); err != nil {
+		t.Fatal(err)
+	}
+	ev := &verify.Evidence{
+		Image:        "ghcr.io/org/app:v1",
+		Digest:       "sha256:deadbeef",
+		Attestations: []verify.Attestation{{Envelope: env}},
+	}
+	return verify.NewBundle(ev, root, time.Unix(1700000000, 0).UTC())
+}
+
+func TestWriteExportDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "evidence")
+	ew, err := newExportWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture := exportFixture(t)
+	m, err := writeExport(ew, fixture, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ew.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"attestations/provenance-1.intoto.json", "bundle.json"}
+	if len(m.Files) != len(want) {
+		t.Fatalf("manifest lists %d files, want %d: %+v", len(m.Files), len(want), m.Files)
+	}
+	for i, f := range m.Files {
+		if f.Path != want[i] {
+			t.Errorf("file %d = %s, want %s", i, f.Path, want[i])
+		}
+		data, err := os.ReadFile(filepath.Join(dir, f.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != f.SHA256 || len(data) != f.Size {
+			t.Errorf("%s does not match its manifest entry", f.Path)
+		}
+	}
+
+	var got exportManifest
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Digest != "sha256:deadbeef" || got.Attestations != 1 {
+		t.Errorf("manifest.json = %+v", got)
+	}
+
+	b, err := verify.ReadBundle(filepath.Join(dir, "bundle.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := b.Verify(verify.Options{Root: &fixture.TrustedRoot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Verified {
+		t.Errorf("exported bundle did not verify: %+v", res.Checks)
+	}
+}
+
+func TestWriteExportTarball(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "evidence.tar.gz")
+	ew, err := newExportWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writeExport(ew, exportFixture(t), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ew.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	want := []string{"attestations/provenance-1.intoto.json", "bundle.json", "manifest.json"}
+	if len(names) != len(want) {
+		t.Fatalf("tarball contains %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("entry %d = %s, want %s", i, names[i], want[i])
+		}
+	}
+}
+
+func TestWriteExportSigned(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := signing.NewSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "evidence")
+	ew, err := newExportWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := writeExport(ew, exportFixture(t), signing.KeyBackend(signer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.intoto.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := dsse.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := signing.NewVerifier(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Verify(v); err != nil {
+		t.Fatalf("the manifest signature does not verify: %v", err)
+	}
+	payload, _ := env.DecodePayload()
+	stmt, err := attestation.ParseStatement(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmt.PredicateType != exportPredicateType || len(stmt.Subject) != len(m.Files)+1 || stmt.Subject[0].Name != "manifest.json" {
+		t.Fatalf("statement = %+v", stmt)
+	}
+	manifest, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(manifest)
+	if stmt.Subject[0].Digest["sha256"] != hex.EncodeToString(sum[:]) {
+		t.Error("the statement does not attest to manifest.json as written")
+	}
+	for i, f := range m.Files {
+		if s := stmt.Subject[i+1]; s.Name != f.Path || s.Digest["sha256"] != f.SHA256 {
+			t.Errorf("subject %d = %+v, want %s", i+1, s, f.Path)
+		}
+	}
+}
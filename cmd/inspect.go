@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cosign"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+)
+
+// inspectReport summarises one envelope for display.
+type inspectReport struct {
+	Source        string                `json:"source"`
+	PayloadType   string                `json:"payloadType"`
+	KeyIDs        []string              `json:"keyIds"`
+	StatementType string                `json:"statementType,omitempty"`
+	PredicateType string                `json:"predicateType,omitempty"`
+	PredicateName string                `json:"predicateName,omitempty"`
+	Subjects      []attestation.Subject `json:"subjects,omitempty"`
+	BuilderID     string                `json:"builderId,omitempty"`
+	BuildType     string                `json:"buildType,omitempty"`
+	SourceURI     string                `json:"sourceUri,omitempty"`
+	SourceDigest  map[string]string     `json:"sourceDigest,omitempty"`
+	Valid         bool                  `json:"valid"`
+	Problems      []string              `json:"problems,omitempty"`
+	Verified      *bool                 `json:"verified,omitempty"`
+	VerifiedBy    string                `json:"verifiedBy,omitempty"`
+	VerifyError   string                `json:"verifyError,omitempty"`
+
+	payload []byte
+}
+
+// inspectInput is an envelope plus the certificate it was published with,
+// if any.
+type inspectInput struct {
+	source   string
+	envelope *dsse.Envelope
+	certPEM  string
+}
+
+// runInspect decodes the DSSE envelopes in a file or attached to an image
+// and prints a summary of each.
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	output := cli.OutputFlag(fs, cli.FormatTable)
+	asJSON := fs.Bool("json", false, "shorthand for --output json")
+	payloadOnly := fs.Bool("payload-only", false, "print only the decoded payloads")
+	verify := fs.Bool("verify", false, "verify envelope signatures")
+	keyPath := fs.String("key", "", "public key for --verify")
+	certPath := fs.String("cert", "", "certificate (chain) for --verify of keyless envelopes read from a file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo inspect [flags] <file|image>")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return cli.ConfigError(errors.New("exactly one file or image is required"))
+	}
+	if *asJSON {
+		*output = cli.FormatJSON
+	}
+
+	inputs, err := loadInspectInputs(context.Background(), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("no attestations found in %s", fs.Arg(0))
+	}
+
+	var keys []crypto.PublicKey
+	if *keyPath != "" {
+		key, err := signing.LoadPublicKey(*keyPath)
+		if err != nil {
+			return cli.ConfigError(fmt.Errorf("loading key: %w", err))
+		}
+		keys = append(keys, key)
+	}
+	var certPEM string
+	if *certPath != "" {
+		data, err := os.ReadFile(*certPath)
+		if err != nil {
+			return cli.ConfigError(err)
+		}
+		certPEM = string(data)
+	}
+
+	reports := make([]inspectReport, 0, len(inputs))
+	failed := false
+	for _, in := range inputs {
+		if in.certPEM == "" {
+			in.certPEM = certPEM
+		}
+		r := inspectEnvelope(in)
+		if *verify {
+			verifyInspected(&r, in, keys)
+			failed = failed || !*r.Verified
+		}
+		failed = failed || !r.Valid
+		reports = append(reports, r)
+	}
+
+	if *payloadOnly {
+		for _, r := range reports {
+			var buf bytes.Buffer
+			if err := json.Indent(&buf, r.payload, "", "  "); err != nil {
+				buf.Reset()
+				buf.Write(r.payload)
+			}
+			fmt.Println(buf.String())
+		}
+	} else {
+		err := cli.Write(os.Stdout, *output, reports, func(w io.Writer) error {
+			printInspectReports(w, reports)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if failed {
+		return cli.VerificationError(errors.New("one or more attestations failed inspection"))
+	}
+	return nil
+}
+
+func loadInspectInputs(ctx context.Context, arg string) ([]inspectInput, error) {
+	if data, err := os.ReadFile(arg); err == nil {
+		envs, err := attestation.DecodeEnvelopes(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", arg, err)
+		}
+		inputs := make([]inspectInput, len(envs))
+		for i, env := range envs {
+			inputs[i] = inspectInput{source: fmt.Sprintf("%s#%d", arg, i+1), envelope: env}
+		}
+		return inputs, nil
+	}
+
+	ref, err := oci.ParseReference(arg)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a file nor an image reference: %w", arg, err)
+	}
+	client := oci.NewClient()
+	digest, err := client.Resolve(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", ref, err)
+	}
+	atts, err := cosign.Attestations(ctx, client, ref.WithDigest(digest))
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]inspectInput, len(atts))
+	for i, att := range atts {
+		inputs[i] = inspectInput{
+			source:   fmt.Sprintf("%s@%s#%d", ref.Name(), digest, i+1),
+			envelope: att.Envelope,
+			certPEM:  att.Certificate + att.Chain,
+		}
+	}
+	return inputs, nil
+}
+
+func inspectEnvelope(in inspectInput) inspectReport {
+	env := in.envelope
+	r := inspectReport{
+		Source:      in.source,
+		PayloadType: env.PayloadType,
+		KeyIDs:      make([]string, 0, len(env.Signatures)),
+		Valid:       true,
+	}
+	for _, s := range env.Signatures {
+		r.KeyIDs = append(r.KeyIDs, s.KeyID)
+	}
+	problem := func(err error) {
+		r.Valid = false
+		r.Problems = append(r.Problems, err.Error())
+	}
+	if err := env.Validate(); err != nil {
+		problem(err)
+		return r
+	}
+	r.payload, _ = env.DecodePayload()
+	if env.PayloadType != attestation.PayloadType {
+		return r
+	}
+
+	var stmt attestation.Statement
+	if err := json.Unmarshal(r.payload, &stmt); err != nil {
+		problem(fmt.Errorf("decoding statement: %w", err))
+		return r
+	}
+	r.StatementType = stmt.Type
+	r.PredicateType = stmt.PredicateType
+	r.PredicateName = attestation.PredicateName(stmt.PredicateType)
+	r.Subjects = stmt.Subject
+	if err := stmt.Validate(); err != nil {
+		problem(err)
+	}
+	if attestation.IsProvenance(stmt.PredicateType) {
+		prov, err := attestation.NormalizeProvenance(&stmt)
+		if err != nil {
+			problem(err)
+			return r
+		}
+		if err := prov.Validate(); err != nil {
+			problem(err)
+		}
+		r.BuilderID = prov.RunDetails.Builder.ID
+		r.BuildType = prov.BuildDefinition.BuildType
+		if src, ok := prov.Source(); ok {
+			r.SourceURI = src.URI
+			r.SourceDigest = src.Digest
+		}
+	}
+	return r
+}
+
+// verifyInspected checks the envelope against the given keys, falling back
+// to the public key of the certificate the envelope was published with.
+// The certificate chain itself is not validated here.
+func verifyInspected(r *inspectReport, in inspectInput, keys []crypto.PublicKey) {
+	candidates := append([]crypto.PublicKey(nil), keys...)
+	if in.certPEM != "" {
+		if certs, err := signing.ParseCertificates([]byte(in.certPEM)); err == nil {
+			candidates = append(candidates, certs[0].PublicKey)
+		}
+	}
+	ok := false
+	r.Verified = &ok
+	if len(candidates) == 0 {
+		r.VerifyError = "no key or certificate to verify with"
+		return
+	}
+	verifiers := make([]dsse.Verifier, 0, len(candidates))
+	for _, k := range candidates {
+		v, err := signing.NewVerifier(k)
+		if err != nil {
+			r.VerifyError = err.Error()
+			return
+		}
+		verifiers = append(verifiers, v)
+	}
+	keyID, err := in.envelope.Verify(verifiers...)
+	if err != nil {
+		r.VerifyError = err.Error()
+		return
+	}
+	ok = true
+	r.VerifiedBy = keyID
+}
+
+func printInspectReports(w io.Writer, reports []inspectReport) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, r := range reports {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "Envelope:\t%s\n", r.Source)
+		fmt.Fprintf(tw, "  Payload type:\t%s\n", r.PayloadType)
+		fmt.Fprintf(tw, "  Signatures:\t%d\n", len(r.KeyIDs))
+		if r.PredicateType != "" {
+			fmt.Fprintf(tw, "  Statement:\t%s\n", r.StatementType)
+			fmt.Fprintf(tw, "  Predicate:\t%s (%s)\n", r.PredicateName, r.PredicateType)
+		}
+		for _, s := range r.Subjects {
+			fmt.Fprintf(tw, "  Subject:\t%s %s\n", s.Name, formatDigests(s.Digest))
+		}
+		if r.BuilderID != "" {
+			fmt.Fprintf(tw, "  Builder:\t%s\n", r.BuilderID)
+			fmt.Fprintf(tw, "  Build type:\t%s\n", r.BuildType)
+		}
+		if r.SourceURI != "" {
+			fmt.Fprintf(tw, "  Source:\t%s %s\n", r.SourceURI, formatDigests(r.SourceDigest))
+		}
+		if r.Valid {
+			fmt.Fprintf(tw, "  Structure:\tvalid\n")
+		} else {
+			fmt.Fprintf(tw, "  Structure:\tINVALID: %s\n", strings.Join(r.Problems, "; "))
+		}
+		switch {
+		case r.Verified == nil:
+		case *r.Verified:
+			fmt.Fprintf(tw, "  Signature:\tverified (key %s)\n", r.VerifiedBy)
+		default:
+			fmt.Fprintf(tw, "  Signature:\tNOT VERIFIED: %s\n", r.VerifyError)
+		}
+	}
+	tw.Flush()
+}
+
+// formatDigests renders a digest set as "alg:hex" pairs in a stable order.
+func formatDigests(digests map[string]string) string {
+	pairs := make([]string, 0, len(digests))
+	for alg, v := range digests {
+		pairs = append(pairs, alg+":"+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
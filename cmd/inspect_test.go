@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/golden"
+)
+
+func signedProvenance(t *testing.T) (*dsse.Envelope, crypto.PublicKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := attestation.NewStatement(attestation.PredicateSLSAProvenanceV1, attestation.Provenance{
+		BuildDefinition: attestation.BuildDefinition{
+			BuildType: localBuildType,
+			ResolvedDependencies: []attestation.ResourceDescriptor{
+				{URI: "git+https://github.com/waveywaves/tekton-slsa-demo", Digest: map[string]string{"sha1": "abc"}},
+			},
+		},
+		RunDetails: attestation.RunDetails{Builder: attestation.Builder{ID: localBuilderID}},
+	}, attestation.Subject{Name: "app", Digest: map[string]string{"sha256": "deadbeef"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(stmt)
+	signer, err := signing.NewSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := dsse.Sign(attestation.PayloadType, payload, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env, key.Public()
+}
+
+func TestInspectEnvelope(t *testing.T) {
+	env, pub := signedProvenance(t)
+	in := inspectInput{source: "test", envelope: env}
+
+	r := inspectEnvelope(in)
+	if !r.Valid {
+		t.Fatalf("report invalid: %v", r.Problems)
+	}
+	if r.PredicateName != "SLSA Provenance v1" {
+		t.Errorf("PredicateName = %q", r.PredicateName)
+	}
+	if r.BuilderID != localBuilderID {
+		t.Errorf("BuilderID = %q, want %q", r.BuilderID, localBuilderID)
+	}
+	if r.SourceURI != "git+https://github.com/waveywaves/tekton-slsa-demo" {
+		t.Errorf("SourceURI = %q", r.SourceURI)
+	}
+
+	verifyInspected(&r, in, []crypto.PublicKey{pub})
+	if r.Verified == nil || !*r.Verified {
+		t.Errorf("signature not verified: %s", r.VerifyError)
+	}
+
+	_, otherPub := signedProvenance(t)
+	r = inspectEnvelope(in)
+	verifyInspected(&r, in, []crypto.PublicKey{otherPub})
+	if r.Verified == nil || *r.Verified {
+		t.Error("signature from another key verified")
+	}
+}
+
+func TestInspectEnvelopeInvalidStatement(t *testing.T) {
+	env, err := dsse.Sign(attestation.PayloadType, []byte(`{"_type":"https://in-toto.io/Statement/v1","predicateType":"x"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := inspectEnvelope(inspectInput{envelope: env})
+	if r.Valid {
+		t.Error("statement without subjects reported valid")
+	}
+}
+
+func TestRunInspectExitCodes(t *testing.T) {
+	env, pub := signedProvenance(t)
+	_, otherPub := signedProvenance(t)
+	dir := t.TempDir()
+	envPath := filepath.Join(dir, "app.intoto.json")
+	data, _ := json.Marshal(env)
+	if err := os.WriteFile(envPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeKey := func(name string, key crypto.PublicKey) string {
+		pem, err := signing.MarshalPublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	goodKey := writeKey("good.pub", pub)
+	badKey := writeKey("bad.pub", otherPub)
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"verified", []string{"--output", "yaml", "--verify", "--key", goodKey, envPath}, cli.ExitOK},
+		{"wrong key", []string{"--verify", "--key", badKey, envPath}, cli.ExitVerification},
+		{"missing key file", []string{"--verify", "--key", filepath.Join(dir, "none.pub"), envPath}, cli.ExitConfig},
+		{"unknown output", []string{"--output", "xml", envPath}, cli.ExitConfig},
+		{"no argument", nil, cli.ExitConfig},
+	}
+	for _, tt := range tests {
+		if got := cli.ExitCode(runInspect(tt.args)); got != tt.want {
+			t.Errorf("%s: exit code %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInspectGolden(t *testing.T) {
+	paths, err := filepath.Glob("../internal/attestation/testdata/chains/*.json")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no Chains envelopes: %v", err)
+	}
+	var reports []inspectReport
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env, err := dsse.Parse(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reports = append(reports, inspectEnvelope(inspectInput{source: filepath.Base(path), envelope: env}))
+	}
+
+	for _, f := range []cli.Format{cli.FormatTable, cli.FormatJSON} {
+		var buf bytes.Buffer
+		err := cli.Write(&buf, f, reports, func(w io.Writer) error {
+			printInspectReports(w, reports)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden.Assert(t, "inspect-chains."+string(f), buf.Bytes())
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/fsutil"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/strutil"
+)
+
+// runKeys dispatches the key management subcommands.
+func runKeys(args []string) error {
+	usage := cli.ConfigError(errors.New("usage: tekton-slsa-demo keys generate|import|list [flags]"))
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "generate":
+		return runKeysGenerate(args[1:])
+	case "import":
+		return runKeysImport(args[1:])
+	case "list":
+		return runKeysList(args[1:])
+	default:
+		return usage
+	}
+}
+
+// keyInfo describes a key file.
+type keyInfo struct {
+	Path        string `json:"path"`
+	Kind        string `json:"kind"`
+	Algorithm   string `json:"algorithm,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// Key kinds reported by keys list.
+const (
+	keyKindPublic           = "public"
+	keyKindPrivate          = "private"
+	keyKindEncryptedPrivate = "encrypted-private"
+)
+
+// keyPair is the output of keys generate and keys import.
+type keyPair struct {
+	PrivateKey  string `json:"privateKey"`
+	PublicKey   string `json:"publicKey"`
+	Algorithm   string `json:"algorithm"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// runKeysGenerate creates a cosign-compatible key pair: an encrypted
+// <prefix>.key and a <prefix>.pub.
+func runKeysGenerate(args []string) error {
+	fs := flag.NewFlagSet("keys generate", flag.ContinueOnError)
+	prefix := fs.String("output-key-prefix", "cosign", "write <prefix>.key and <prefix>.pub")
+	algorithm := fs.String("algorithm", "ecdsa-p256", "key algorithm: ecdsa-p256, ecdsa-p384 or ed25519")
+	force := fs.Bool("force", false, "overwrite existing key files")
+	output := cli.OutputFlag(fs, cli.FormatTable)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo keys generate [flags]")
+		fmt.Fprintln(fs.Output(), "The private key is encrypted with $COSIGN_PASSWORD, or a password read from the terminal.")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return cli.ConfigError(errors.New("unexpected arguments"))
+	}
+	key, err := generateKey(*algorithm)
+	if err != nil {
+		return cli.ConfigError(err)
+	}
+	pair, err := writeKeyPair(key, *prefix, *force)
+	if err != nil {
+		return err
+	}
+	return printKeyPair(*output, pair)
+}
+
+// runKeysImport converts an existing PEM private key into a cosign key pair.
+func runKeysImport(args []string) error {
+	fs := flag.NewFlagSet("keys import", flag.ContinueOnError)
+	keyPath := fs.String("key", "", "PEM private key (PKCS#8, SEC 1 or PKCS#1) to import (required)")
+	prefix := fs.String("output-key-prefix", "import-cosign", "write <prefix>.key and <prefix>.pub")
+	force := fs.Bool("force", false, "overwrite existing key files")
+	output := cli.OutputFlag(fs, cli.FormatTable)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo keys import --key <pem> [flags]")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if *keyPath == "" || fs.NArg() != 0 {
+		fs.Usage()
+		return cli.ConfigError(errors.New("--key is required"))
+	}
+	key, err := signing.LoadPrivateKey(*keyPath)
+	if err != nil {
+		return cli.ConfigError(fmt.Errorf("loading key: %w", err))
+	}
+	pair, err := writeKeyPair(key, *prefix, *force)
+	if err != nil {
+		return err
+	}
+	return printKeyPair(*output, pair)
+}
+
+// runKeysList describes the key files in a directory.
+func runKeysList(args []string) error {
+	fs := flag.NewFlagSet("keys list", flag.ContinueOnError)
+	output := cli.OutputFlag(fs, cli.FormatTable)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo keys list [flags] [dir]")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+	keys, err := listKeys(dir)
+	if err != nil {
+		return cli.ConfigError(err)
+	}
+	return cli.Write(os.Stdout, *output, keys, func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PATH\tKIND\tALGORITHM\tFINGERPRINT")
+		for _, k := range keys {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", k.Path, k.Kind, strutil.Default(k.Algorithm, "-"), strutil.Default(k.Fingerprint, "-"))
+		}
+		return tw.Flush()
+	})
+}
+
+func generateKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case "ecdsa-p256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ecdsa-p384":
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unsupported key algorithm %q", algorithm)
+}
+
+func writeKeyPair(key crypto.Signer, prefix string, force bool) (*keyPair, error) {
+	privPath, pubPath := prefix+".key", prefix+".pub"
+	if !force {
+		for _, p := range []string{privPath, pubPath} {
+			if _, err := os.Stat(p); err == nil {
+				return nil, cli.ConfigError(fmt.Errorf("%s already exists (use --force to overwrite)", p))
+			}
+		}
+	}
+	password, err := readPassword(true)
+	if err != nil {
+		return nil, cli.ConfigError(err)
+	}
+	priv, err := signing.EncryptPrivateKey(key, password)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := signing.MarshalPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := signing.Fingerprint(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	// The private key replaces any existing file rather than being written
+	// into it, so an overwritten key does not keep a laxer mode than 0600.
+	if err := fsutil.WriteFileAtomic(privPath, priv); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(pubPath, pub, 0o644); err != nil {
+		return nil, err
+	}
+	return &keyPair{
+		PrivateKey:  privPath,
+		PublicKey:   pubPath,
+		Algorithm:   keyAlgorithm(key.Public()),
+		Fingerprint: fingerprint,
+	}, nil
+}
+
+func printKeyPair(output cli.Format, pair *keyPair) error {
+	return cli.Write(os.Stdout, output, pair, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "Private key written to %s\nPublic key written to %s\nAlgorithm:   %s\nFingerprint: %s\n",
+			pair.PrivateKey, pair.PublicKey, pair.Algorithm, pair.Fingerprint)
+		return err
+	})
+}
+
+// listKeys describes the .key, .pub and .pem files in dir. Encrypted private
+// keys are described by the public key next to them, when there is one.
+func listKeys(dir string) ([]keyInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	keys := []keyInfo{}
+	pubs := make(map[string]keyInfo)
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".key" && ext != ".pub" && ext != ".pem") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		info := keyInfo{Path: path}
+		var pub crypto.PublicKey
+		switch {
+		case signing.IsEncryptedKey(data):
+			info.Kind = keyKindEncryptedPrivate
+		default:
+			if key, err := signing.ParsePrivateKey(data); err == nil {
+				info.Kind, pub = keyKindPrivate, key.Public()
+			} else if key, err := signing.ParsePublicKey(data); err == nil {
+				info.Kind, pub = keyKindPublic, key
+			} else {
+				continue
+			}
+		}
+		if pub != nil {
+			info.Algorithm = keyAlgorithm(pub)
+			info.Fingerprint, _ = signing.Fingerprint(pub)
+		}
+		if info.Kind == keyKindPublic {
+			pubs[strings.TrimSuffix(path, ext)] = info
+		}
+		keys = append(keys, info)
+	}
+	for i, k := range keys {
+		if k.Kind == keyKindEncryptedPrivate {
+			if pub, ok := pubs[strings.TrimSuffix(k.Path, filepath.Ext(k.Path))]; ok {
+				keys[i].Algorithm, keys[i].Fingerprint = pub.Algorithm, pub.Fingerprint
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Path < keys[j].Path })
+	return keys, nil
+}
+
+func keyAlgorithm(pub crypto.PublicKey) string {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return "ecdsa-" + strings.ToLower(strings.ReplaceAll(k.Curve.Params().Name, "-", ""))
+	case ed25519.PublicKey:
+		return "ed25519"
+	case *rsa.PublicKey:
+		return fmt.Sprintf("rsa-%d", k.N.BitLen())
+	}
+	return fmt.Sprintf("%T", pub)
+}
+
+// loadSigningKey reads a private key, decrypting cosign encrypted keys with
+// the password from readPassword.
+func loadSigningKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !signing.IsEncryptedKey(data) {
+		return signing.ParsePrivateKey(data)
+	}
+	password, err := readPassword(false)
+	if err != nil {
+		return nil, err
+	}
+	return signing.DecryptPrivateKey(data, password)
+}
+
+// readPassword returns $COSIGN_PASSWORD if it is set, as cosign does, and
+// otherwise prompts on the terminal, twice when confirming a new password.
+func readPassword(confirm bool) ([]byte, error) {
+	if pw, ok := os.LookupEnv("COSIGN_PASSWORD"); ok {
+		return []byte(pw), nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, errors.New("no terminal to read the key password from; set COSIGN_PASSWORD")
+	}
+	fmt.Fprint(os.Stderr, "Enter password for private key: ")
+	pw, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Enter password for private key again: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(pw, again) {
+			return nil, errors.New("passwords do not match")
+		}
+	}
+	return pw, nil
+}
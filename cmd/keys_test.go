@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeysGenerateAndList(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("COSIGN_PASSWORD", "demo")
+	prefix := filepath.Join(dir, "cosign")
+	if err := runKeysGenerate([]string{"--output", "json", "--output-key-prefix", prefix}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runKeysGenerate([]string{"--output-key-prefix", prefix}); err == nil {
+		t.Error("generate overwrote an existing key pair without --force")
+	}
+	info, err := os.Stat(prefix + ".key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("private key mode = %v, want 0600", info.Mode().Perm())
+	}
+	// Overwriting a world-readable key leaves it readable by its owner only.
+	if err := os.Chmod(prefix+".key", 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runKeysGenerate([]string{"--output", "json", "--output-key-prefix", prefix, "--force"}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err = os.Stat(prefix + ".key"); err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("overwritten private key mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	keys, err := listKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("listed %d keys, want 2", len(keys))
+	}
+	priv, pub := keys[0], keys[1]
+	if priv.Kind != keyKindEncryptedPrivate || pub.Kind != keyKindPublic {
+		t.Errorf("kinds = %s, %s", priv.Kind, pub.Kind)
+	}
+	if priv.Fingerprint == "" || priv.Fingerprint != pub.Fingerprint || pub.Algorithm != "ecdsa-p256" {
+		t.Errorf("private %+v and public %+v should share fingerprint and algorithm", priv, pub)
+	}
+
+	// The encrypted key signs attestations like a plain PEM key.
+	if _, err := loadSigningKey(prefix + ".key"); err != nil {
+		t.Errorf("loadSigningKey: %v", err)
+	}
+	t.Setenv("COSIGN_PASSWORD", "wrong")
+	if _, err := loadSigningKey(prefix + ".key"); err == nil {
+		t.Error("loadSigningKey succeeded with the wrong password")
+	}
+}
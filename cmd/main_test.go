@@ -1,103 +1,10 @@
 package main
 
 import (
-	"encoding/json"
-	"net/http"
-	"net/http/httptest"
 	"os"
 	"testing"
 )
 
-func TestHealthHandler(t *testing.T) {
-	req, err := http.NewRequest("GET", "/health", nil)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(healthHandler)
-	handler.ServeHTTP(rr, req)
-
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
-	}
-
-	var response HealthResponse
-	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
-		t.Errorf("Could not parse JSON response: %v", err)
-	}
-
-	if response.Status != "healthy" {
-		t.Errorf("Expected status 'healthy', got '%s'", response.Status)
-	}
-
-	if response.Component != "tekton-slsa-demo" {
-		t.Errorf("Expected component 'tekton-slsa-demo', got '%s'", response.Component)
-	}
-}
-
-func TestInfoHandler(t *testing.T) {
-	// Set environment variable for testing
-	os.Setenv("APP_VERSION", "1.2.3")
-	defer os.Unsetenv("APP_VERSION")
-
-	req, err := http.NewRequest("GET", "/info", nil)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(infoHandler)
-	handler.ServeHTTP(rr, req)
-
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
-	}
-
-	var response InfoResponse
-	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
-		t.Errorf("Could not parse JSON response: %v", err)
-	}
-
-	if response.Name != "Tekton SLSA Demo Application" {
-		t.Errorf("Expected name 'Tekton SLSA Demo Application', got '%s'", response.Name)
-	}
-
-	if response.Version != "1.2.3" {
-		t.Errorf("Expected version '1.2.3', got '%s'", response.Version)
-	}
-}
-
-func TestRootHandler(t *testing.T) {
-	req, err := http.NewRequest("GET", "/", nil)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(rootHandler)
-	handler.ServeHTTP(rr, req)
-
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
-	}
-
-	contentType := rr.Header().Get("Content-Type")
-	if contentType != "text/html" {
-		t.Errorf("Expected Content-Type 'text/html', got '%s'", contentType)
-	}
-
-	// Check if response contains expected content
-	body := rr.Body.String()
-	if !contains(body, "Tekton SLSA Demo Application") {
-		t.Error("Expected response to contain 'Tekton SLSA Demo Application'")
-	}
-
-	if !contains(body, "/health") {
-		t.Error("Expected response to contain '/health' endpoint")
-	}
-}
-
 func TestGetEnvOrDefault(t *testing.T) {
 	// Test with environment variable set
 	os.Setenv("TEST_VAR", "test_value")
@@ -113,20 +20,3 @@ func TestGetEnvOrDefault(t *testing.T) {
 		t.Errorf("Expected 'default_value', got '%s'", result)
 	}
 }
-
-// Helper function to check if a string contains a substring
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(substr) == 0 || 
-		(len(s) > len(substr) && (s[:len(substr)] == substr || 
-		 s[len(s)-len(substr):] == substr || 
-		 containsSubstring(s, substr))))
-}
-
-func containsSubstring(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
-		}
-	}
-	return false
-}
\ No newline at end of file
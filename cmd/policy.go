@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/policy"
+)
+
+// runPolicy dispatches the policy subcommands.
+func runPolicy(args []string) error {
+	usage := cli.ConfigError(errors.New("usage: tekton-slsa-demo policy test [flags] <policy> <fixtures>"))
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "test":
+		return runPolicyTest(args[1:])
+	default:
+		return usage
+	}
+}
+
+// policyCase is the expected and actual decision for one fixture.
+type policyCase struct {
+	Name       string   `json:"name"`
+	Expected   string   `json:"expected"`
+	Actual     string   `json:"actual"`
+	Passed     bool     `json:"passed"`
+	Violations []string `json:"violations,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+// runPolicyTest evaluates a policy against fixtures laid out as
+//
+//	<fixtures>/allow/<case>   attestations the policy must allow
+//	<fixtures>/deny/<case>    attestations the policy must deny
+//
+// where each case is an attestation file, or a directory of them for
+// artifacts with several attestations.
+func runPolicyTest(args []string) error {
+	fs := flag.NewFlagSet("policy test", flag.ContinueOnError)
+	output := cli.OutputFlag(fs, cli.FormatTable)
+	verbose := fs.Bool("v", false, "print the violations of every case, not only failing ones")
+	at := fs.String("at", "", "evaluate as of this date (2006-01-02) or RFC 3339 time, for rules with effective dates (default now)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo policy test [flags] <policy> <fixtures>")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return cli.ConfigError(errors.New("a policy file and a fixtures directory are required"))
+	}
+	now := time.Now()
+	if *at != "" {
+		t, err := policy.ParseTime(*at)
+		if err != nil {
+			return cli.ConfigError(fmt.Errorf("--at: %w", err))
+		}
+		now = t
+	}
+	p, err := policy.Load(fs.Arg(0))
+	if err != nil {
+		return cli.ConfigError(err)
+	}
+	cases, err := runPolicyCases(p, fs.Arg(1), now)
+	if err != nil {
+		return cli.ConfigError(err)
+	}
+
+	err = cli.Write(os.Stdout, *output, cases, func(w io.Writer) error {
+		return printPolicyCases(w, cases, *verbose)
+	})
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, c := range cases {
+		if !c.Passed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return cli.PolicyError(fmt.Errorf("%d of %d case(s) failed", failed, len(cases)))
+	}
+	return nil
+}
+
+func runPolicyCases(p *policy.Policy, dir string, now time.Time) ([]policyCase, error) {
+	cases := []policyCase{}
+	for _, expected := range []string{"allow", "deny"} {
+		entries, err := os.ReadDir(filepath.Join(dir, expected))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			path := filepath.Join(dir, expected, e.Name())
+			stmts, err := loadFixture(path)
+			if err != nil {
+				return nil, err
+			}
+			d, err := p.EvaluateAt(stmts, now)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			actual := "deny"
+			if d.Allow {
+				actual = "allow"
+			}
+			cases = append(cases, policyCase{
+				Name:       expected + "/" + e.Name(),
+				Expected:   expected,
+				Actual:     actual,
+				Passed:     actual == expected,
+				Violations: d.Violations(),
+				Warnings:   d.Warnings(),
+			})
+		}
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no fixtures under %s/allow or %s/deny", dir, dir)
+	}
+	return cases, nil
+}
+
+// loadFixture reads the statements in an attestation file, or in every file
+// of a directory.
+func loadFixture(path string) ([]*attestation.Statement, error) {
+	files := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = files[:0]
+		for _, e := range entries {
+			if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+		sort.Strings(files)
+	}
+
+	var stmts []*attestation.Statement
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		envs, err := attestation.DecodeEnvelopes(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		for _, env := range envs {
+			payload, err := env.DecodePayload()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f, err)
+			}
+			var st attestation.Statement
+			if err := json.Unmarshal(payload, &st); err != nil {
+				return nil, fmt.Errorf("%s: %w", f, err)
+			}
+			stmts = append(stmts, &st)
+		}
+	}
+	return stmts, nil
+}
+
+func printPolicyCases(w io.Writer, cases []policyCase, verbose bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CASE\tEXPECTED\tACTUAL\tRESULT")
+	passed := 0
+	for _, c := range cases {
+		result := "FAIL"
+		if c.Passed {
+			result = "ok"
+			passed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Name, c.Expected, c.Actual, result)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, c := range cases {
+		if len(c.Violations)+len(c.Warnings) == 0 || (c.Passed && !verbose) {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s:\n", c.Name)
+		for _, v := range c.Violations {
+			fmt.Fprintf(w, "  - %s\n", v)
+		}
+		for _, v := range c.Warnings {
+			fmt.Fprintf(w, "  - warning: %s\n", v)
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%d/%d cases passed\n", passed, len(cases))
+	return err
+}
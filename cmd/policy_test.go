@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/policy"
+)
+
+func TestRunPolicyCases(t *testing.T) {
+	env, _ := signedProvenance(t)
+	data, _ := json.Marshal(env)
+	dir := t.TempDir()
+	write := func(path string, data []byte) {
+		t.Helper()
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("fixtures/allow/local.intoto.json", data)
+	write("fixtures/deny/sbom-only/sbom.json", []byte(`{"_type": "https://in-toto.io/Statement/v1",
+		"subject": [{"name": "app", "digest": {"sha256": "abc"}}],
+		"predicateType": "https://spdx.dev/Document", "predicate": {}}`))
+	write("policy.yaml", []byte(`
+name: local-builds
+rules:
+  - name: local-builder
+    predicateType: https://slsa.dev/provenance/v1
+    conditions:
+      - path: predicate.runDetails.builder.id
+        equals: `+localBuilderID+`
+`))
+
+	p, err := policy.Load(filepath.Join(dir, "policy.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases, err := runPolicyCases(p, filepath.Join(dir, "fixtures"), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 2 {
+		t.Fatalf("got %d cases, want 2", len(cases))
+	}
+	for _, c := range cases {
+		if !c.Passed {
+			t.Errorf("case %s: expected %s, got %s (%v)", c.Name, c.Expected, c.Actual, c.Violations)
+		}
+	}
+
+	// A fixture the policy decides differently than expected fails the run.
+	write("fixtures/deny/local-too.intoto.json", data)
+	err = runPolicyTest([]string{"--output", "json", filepath.Join(dir, "policy.yaml"), filepath.Join(dir, "fixtures")})
+	if got := cli.ExitCode(err); got != cli.ExitPolicy {
+		t.Errorf("exit code %d, want %d (%v)", got, cli.ExitPolicy, err)
+	}
+}
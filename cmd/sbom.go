@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cosign"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dtrack"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/sbom"
+	"github.com/waveywaves/tekton-slsa-demo/internal/strutil"
+)
+
+// runSBOM generates an SBOM for a Go binary or an image, the offline
+// counterpart of the server's /sbom endpoint, and can attach it to the
+// image as a signed attestation.
+func runSBOM(args []string) error {
+	fs := flag.NewFlagSet("sbom", flag.ContinueOnError)
+	format := fs.String("format", "spdx", "SBOM format: spdx or cyclonedx")
+	out := fs.String("out", "", "write the SBOM to this file instead of stdout")
+	output := cli.OutputFlag(fs, cli.FormatJSON)
+	platform := fs.String("platform", "linux/amd64", "platform to catalogue for multi-arch images")
+	attach := fs.Bool("attach", false, "attach the SBOM to the image as a signed attestation")
+	var sf signerFlags
+	sf.register(fs, "")
+	var df dtrackFlags
+	df.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo sbom [flags] <binary|image>")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return cli.ConfigError(errors.New("exactly one binary or image is required"))
+	}
+	f, err := sbom.ParseFormat(*format)
+	if err != nil {
+		return cli.ConfigError(err)
+	}
+
+	ctx := context.Background()
+	target := fs.Arg(0)
+	client := oci.NewClient()
+	var doc *sbom.Document
+	var imageRef oci.Reference
+	if _, err := os.Stat(target); err == nil {
+		if *attach {
+			return cli.ConfigError(errors.New("--attach requires an image reference"))
+		}
+		if doc, err = binarySBOM(target); err != nil {
+			return err
+		}
+	} else {
+		ref, err := oci.ParseReference(target)
+		if err != nil {
+			return cli.ConfigError(fmt.Errorf("%q is neither a file nor an image reference: %w", target, err))
+		}
+		if doc, err = sbom.FromImage(ctx, client, ref, *platform); err != nil {
+			return err
+		}
+		imageRef = ref.WithDigest(doc.Digest)
+	}
+	doc.Tool = "tekton-slsa-demo-" + getEnvOrDefault("APP_VERSION", "1.0.0")
+
+	data, err := doc.Encode(f)
+	if err != nil {
+		return err
+	}
+	// json writes the encoded document as is; yaml re-encodes it and
+	// table lists the components.
+	if *output == cli.FormatJSON {
+		err = writeOutput(*out, append(data, '\n'))
+	} else {
+		err = cli.WriteFile(*out, *output, json.RawMessage(data), func(w io.Writer) error {
+			return printComponents(w, doc)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if *attach {
+		if err := attachSBOM(ctx, client, imageRef, f, data, &sf); err != nil {
+			return err
+		}
+	}
+	if df.url != "" {
+		return df.publish(ctx, doc, imageRef)
+	}
+	return nil
+}
+
+// dtrackFlags are the options for publishing an SBOM to Dependency-Track.
+type dtrackFlags struct {
+	url, apiKey, project, version, tags string
+}
+
+func (f *dtrackFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.url, "dtrack-url", "", "publish the SBOM to the Dependency-Track server at this URL")
+	fs.StringVar(&f.apiKey, "dtrack-api-key", os.Getenv("DTRACK_API_KEY"), "Dependency-Track API key")
+	fs.StringVar(&f.project, "dtrack-project", "", "Dependency-Track project, created if missing (default: the image repository or binary name)")
+	fs.StringVar(&f.version, "dtrack-version", "", "Dependency-Track project version (default: the image tag, or the digest)")
+	fs.StringVar(&f.tags, "dtrack-tags", "", "comma-separated tags for the Dependency-Track project")
+}
+
+// publish uploads doc, as CycloneDX, to a version of a Dependency-Track
+// project, creating the project version if it does not exist. ref is the
+// image doc describes, or the zero Reference for a binary.
+func (f *dtrackFlags) publish(ctx context.Context, doc *sbom.Document, ref oci.Reference) error {
+	if f.apiKey == "" {
+		return cli.ConfigError(errors.New("--dtrack-url requires --dtrack-api-key or $DTRACK_API_KEY"))
+	}
+	project, version := f.project, f.version
+	if project == "" {
+		project = doc.Name
+		if ref.Repository != "" {
+			project = ref.Name()
+		}
+	}
+	if version == "" {
+		version = strutil.Default(ref.Tag, doc.Digest)
+	}
+	var tags []string
+	for _, t := range strings.Split(f.tags, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	bom, err := doc.Encode(sbom.FormatCycloneDX)
+	if err != nil {
+		return err
+	}
+	client := dtrack.NewClient(f.url, f.apiKey)
+	if _, err := client.UploadBOM(ctx, dtrack.Upload{Project: project, Version: version, Tags: tags, AutoCreate: true, BOM: bom}); err != nil {
+		return fmt.Errorf("publishing SBOM: %w", err)
+	}
+	p, err := client.LookupProject(ctx, project, version)
+	if err != nil {
+		return fmt.Errorf("publishing SBOM: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Published SBOM to Dependency-Track project %s version %s: %s\n", project, version, client.ProjectURL(p))
+	return nil
+}
+
+func binarySBOM(path string) (*sbom.Document, error) {
+	doc, err := sbom.FromBinary(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	doc.Name = filepath.Base(path)
+	doc.Digest = "sha256:" + hex.EncodeToString(h.Sum(nil))
+	return doc, nil
+}
+
+// attachSBOM wraps the SBOM in an in-toto statement about the image, signs
+// it and appends it to the image's attestations.
+func attachSBOM(ctx context.Context, client *oci.Client, ref oci.Reference, f sbom.Format, data []byte, sf *signerFlags) error {
+	signers, chainPEM, err := sf.signers(ctx)
+	if err != nil {
+		return err
+	}
+	if len(signers) == 0 {
+		return cli.ConfigError(fmt.Errorf("--attach requires %s", sf.names()))
+	}
+
+	predicateType := sbom.PredicateTypeSPDX
+	if f == sbom.FormatCycloneDX {
+		predicateType = sbom.PredicateTypeCycloneDX
+	}
+	alg, hexDigest, _ := strings.Cut(ref.Digest, ":")
+	stmt, err := attestation.NewStatement(predicateType, json.RawMessage(data),
+		attestation.Subject{Name: ref.Name(), Digest: map[string]string{alg: hexDigest}})
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(stmt)
+	if err != nil {
+		return err
+	}
+	env, err := dsse.Sign(attestation.PayloadType, payload, signers...)
+	if err != nil {
+		return err
+	}
+	envJSON, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	annotations := map[string]string{}
+	if chainPEM != nil {
+		certs := strings.SplitAfterN(string(chainPEM), "-----END CERTIFICATE-----\n", 2)
+		annotations[cosign.AnnotationCertificate] = certs[0]
+		if len(certs) > 1 {
+			annotations[cosign.AnnotationChain] = certs[1]
+		}
+	}
+	if err := cosign.Attach(ctx, client, ref, envJSON, predicateType, annotations); err != nil {
+		return fmt.Errorf("attaching SBOM to %s: %w", ref, err)
+	}
+	fmt.Fprintf(os.Stderr, "Attached %s SBOM attestation to %s\n", f, ref)
+	return nil
+}
+
+func printComponents(w io.Writer, doc *sbom.Document) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tNAME\tVERSION\tLOCATION")
+	for _, c := range doc.Components {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Type, c.Name, strutil.Default(c.Version, "-"), strutil.Default(c.Location, "-"))
+	}
+	return tw.Flush()
+}
+
+// writeOutput writes data to path, or stdout if path is empty.
+func writeOutput(path string, data []byte) error {
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/osv"
+	"github.com/waveywaves/tekton-slsa-demo/internal/sbom"
+	"github.com/waveywaves/tekton-slsa-demo/internal/strutil"
+)
+
+// runScan catalogues a binary or image and looks its components up in OSV.
+// A finding at or above the --fail-on severity is a policy failure, so CI
+// can tell a vulnerable artifact from a scan that could not run.
+func runScan(args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	output := cli.OutputFlag(fs, cli.FormatTable, cli.FormatSARIF)
+	out := fs.String("out", "", "write the report to this file instead of stdout")
+	failOn := fs.String("fail-on", "high", "exit 1 if a finding is at least this severe: low, medium, high, critical or none")
+	platform := fs.String("platform", "linux/amd64", "platform to scan for multi-arch images")
+	osvURL := fs.String("osv-url", osv.DefaultURL, "OSV API URL")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo scan [flags] <binary|image>")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return cli.ConfigError(errors.New("exactly one binary or image is required"))
+	}
+	threshold, err := parseFailOn(*failOn)
+	if err != nil {
+		return cli.ConfigError(err)
+	}
+
+	ctx := context.Background()
+	doc, err := scanTarget(ctx, fs.Arg(0), *platform)
+	if err != nil {
+		return err
+	}
+	client := osv.NewClient()
+	client.URL = *osvURL
+	report, err := osv.Scan(ctx, client, doc)
+	if err != nil {
+		return err
+	}
+
+	if *output == cli.FormatSARIF {
+		var buf bytes.Buffer
+		if err := report.SARIF("tekton-slsa-demo", getEnvOrDefault("APP_VERSION", "1.0.0")).Write(&buf); err != nil {
+			return err
+		}
+		err = writeOutput(*out, buf.Bytes())
+	} else {
+		err = cli.WriteFile(*out, *output, report, func(w io.Writer) error { return printScanReport(w, report) })
+	}
+	if err != nil {
+		return err
+	}
+	if threshold != osv.LevelUnknown {
+		if n := report.AtLeast(threshold); n > 0 {
+			return cli.PolicyError(failure.New(failure.PolicyDenied, "%d finding(s) at or above %s", n, threshold))
+		}
+	}
+	return nil
+}
+
+// parseFailOn accepts a severity level or "none" to never fail; the zero
+// level stands for "none".
+func parseFailOn(s string) (osv.Level, error) {
+	if strings.EqualFold(s, "none") {
+		return osv.LevelUnknown, nil
+	}
+	l, ok := osv.ParseLevel(s)
+	if !ok || l == osv.LevelUnknown {
+		return 0, fmt.Errorf("unknown severity %q for --fail-on", s)
+	}
+	return l, nil
+}
+
+func scanTarget(ctx context.Context, target, platform string) (*sbom.Document, error) {
+	if _, err := os.Stat(target); err == nil {
+		return binarySBOM(target)
+	}
+	ref, err := oci.ParseReference(target)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a file nor an image reference: %w", target, err)
+	}
+	return sbom.FromImage(ctx, oci.NewClient(), ref, platform)
+}
+
+func printScanReport(w io.Writer, report *osv.Report) error {
+	fmt.Fprintf(w, "%s: %d components scanned, %d skipped, %d findings\n",
+		report.Target, report.Scanned, report.Skipped, len(report.Findings))
+	if len(report.Findings) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SEVERITY\tID\tPACKAGE\tVERSION\tFIXED IN\tSUMMARY")
+	for _, f := range report.Findings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			f.Severity, f.ID, f.Package, f.Version, strutil.Default(f.FixedIn, "-"), strutil.Default(f.Summary, "-"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/clock"
+	"github.com/waveywaves/tekton-slsa-demo/internal/config"
+	"github.com/waveywaves/tekton-slsa-demo/internal/denylist"
+	"github.com/waveywaves/tekton-slsa-demo/internal/env"
+	"github.com/waveywaves/tekton-slsa-demo/internal/fault"
+	"github.com/waveywaves/tekton-slsa-demo/internal/httpclient"
+	"github.com/waveywaves/tekton-slsa-demo/internal/memlimit"
+	"github.com/waveywaves/tekton-slsa-demo/internal/metrics"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oidc"
+	"github.com/waveywaves/tekton-slsa-demo/internal/osv"
+	"github.com/waveywaves/tekton-slsa-demo/internal/rekor"
+	"github.com/waveywaves/tekton-slsa-demo/internal/replay"
+	"github.com/waveywaves/tekton-slsa-demo/internal/scan"
+	"github.com/waveywaves/tekton-slsa-demo/internal/server"
+	"github.com/waveywaves/tekton-slsa-demo/internal/shard"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/tofu"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// runServe starts the HTTP server. It is also what runs when the binary is
+// started without a subcommand.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	defaults := config.Default(env.OS{})
+	configPath := fs.String("config", os.Getenv(config.EnvPath), "YAML config file; flags override it (see config init)")
+	addr := fs.String("addr", defaults.Server.Addr, "listen address")
+	dev := fs.Bool("dev", false, "development mode: serve assets from --web-dir, log requests, disable API auth and seed sample data")
+	webDir := fs.String("web-dir", defaults.Server.WebDir, "directory holding templates/ and static/ in development mode")
+	apiToken := fs.String("api-token", "", "bearer token required to ingest attestations and use the admin API (default $API_TOKEN)")
+	maxInFlight := fs.Int("max-in-flight", defaults.Server.MaxInFlight, "requests handled at once before new ones queue; 0 disables load shedding")
+	maxQueueWait := fs.Duration("max-queue-wait", defaults.Server.MaxQueueWait, "how long a queued request waits before it is rejected with 503")
+	requestTimeout := fs.Duration("request-timeout", defaults.Server.Timeouts.Request, "how long handling a request may take before its verification is abandoned with 504; 0 disables the limit")
+	registryTimeout := fs.Duration("registry-timeout", defaults.Server.Timeouts.Registry, "how long each registry call may take; 0 disables the limit")
+	rekorTimeout := fs.Duration("rekor-timeout", defaults.Server.Timeouts.Rekor, "how long each Rekor call may take; 0 disables the limit")
+	tofuPins := fs.String("tofu", defaults.Server.TOFUPins, "trust on first use: pin the first signer identity verified for each repository in this file and alert on different identities")
+	denylistPath := fs.String("denylist", defaults.Server.Denylist, "file keeping the digests and signer identities managed at /api/v1/admin/denylist; empty keeps them in memory")
+	replayState := fs.String("replay-state", defaults.Server.ReplayState, "file keeping the logged provenance of each repository's builds, to flag stale and replayed provenance; empty keeps it in memory")
+	selfImage := fs.String("self-image", defaults.Server.SelfImage, "image the server runs from; verify it periodically and export freshness gauges for alerting")
+	selfVerifyInterval := fs.Duration("self-verify-interval", defaults.Server.SelfVerifyInterval, "how often to verify --self-image")
+	selfIdentity := fs.String("self-identity", defaults.Server.SelfIdentity, "regular expression the certificate identity signing --self-image must match")
+	selfIssuer := fs.String("self-issuer", defaults.Server.SelfIssuer, "OIDC issuer of the certificate signing --self-image")
+	webhookSecret := fs.String("webhook-secret", "", "secret registries authenticate push notifications to /webhooks/registry with (default $WEBHOOK_SECRET)")
+	watchInterval := fs.Duration("watch-interval", defaults.Server.WatchInterval, "how often to poll the images on the config file's watch list")
+	faultInjection := fs.Bool("fault-injection", defaults.Server.FaultInjection, "enable /api/v1/admin/faults, which delays Rekor calls, fails registry fetches and corrupts cache entries on purpose for resilience demos")
+	scanner := fs.String("scanner", defaults.Server.Scanner, "scan images on demand at /api/v1/scan/{digest} with trivy or osv; empty disables scanning")
+	trivyServer := fs.String("trivy-server", defaults.Server.TrivyServer, "Trivy server URL that --scanner trivy runs trivy as a client of")
+	signerBackend := fs.String("signer", defaults.Server.Signer.Backend, "backend that signs VSAs and scan results stored as attestations: "+strings.Join(signing.Backends, ", ")+"; empty disables signing")
+	signerKey := fs.String("signer-key", defaults.Server.Signer.Key, "private key of the key signer")
+	signerKMS := fs.String("signer-kms", defaults.Server.Signer.KMS, "key of the kms signer, such as hashivault://release")
+	signerFulcioURL := fs.String("signer-fulcio-url", defaults.Server.Signer.FulcioURL, "Fulcio instance of the keyless signer, which signs for the OIDC token in $SIGSTORE_ID_TOKEN")
+	signerSVIDDir := fs.String("signer-svid-dir", defaults.Server.Signer.SVIDDir, "directory where the SPIFFE helper keeps the spiffe signer's X.509 SVID")
+	scanSigningKey := fs.String("scan-signing-key", defaults.Server.ScanSigningKey, "private key that signs scan results stored as vulnerability attestations; shorthand for --signer key --signer-key")
+	artifactSources := fs.String("artifact-sources", strings.Join(defaults.Server.ArtifactSources, ","), "comma-separated URL prefixes /artifacts/{digest} downloads attested artifacts from; empty disables artifact downloads")
+	artifactKeys := fs.String("artifact-keys", strings.Join(defaults.Server.ArtifactKeys, ","), "comma-separated public keys attestations must be signed with for /artifacts/{digest} to download the artifacts they name")
+	oidcIssuer := fs.String("oidc-issuer", defaults.Server.OIDC.Issuer, "OpenID Connect provider administrators sign in to /admin with; empty disables the admin dashboard")
+	oidcClientID := fs.String("oidc-client-id", defaults.Server.OIDC.ClientID, "client ID registered with --oidc-issuer")
+	oidcClientSecret := fs.String("oidc-client-secret", "", "client secret registered with --oidc-issuer, if any (default $OIDC_CLIENT_SECRET)")
+	oidcRedirectURL := fs.String("oidc-redirect-url", defaults.Server.OIDC.RedirectURL, "the server's /auth/callback URL, as registered with --oidc-issuer")
+	admins := fs.String("admins", strings.Join(defaults.Server.Admins, ","), "comma-separated email addresses or OIDC subjects who may sign in to /admin")
+	sessionTTL := fs.Duration("session-ttl", defaults.Server.SessionTTL, "how long an admin dashboard session lasts")
+	shardDir := fs.String("shard-dir", defaults.Server.ShardDir, "directory shared by the server's replicas for leases that split the watch list's verifications between them by digest")
+	replicaID := fs.String("replica-id", defaults.Server.ReplicaID, "name of this replica in --shard-dir (default the host name)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo serve [flags]")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+
+	// Precedence: explicit flags, then $API_TOKEN, $WEBHOOK_SECRET and
+	// $OIDC_CLIENT_SECRET for the secrets, then the config file, then
+	// built-in defaults.
+	conf := defaults
+	if *configPath != "" {
+		var err error
+		if conf, err = config.Load(*configPath, defaults); err != nil {
+			return cli.ConfigError(err)
+		}
+	}
+	if token := os.Getenv("API_TOKEN"); token != "" {
+		conf.Server.APIToken = token
+	}
+	if secret := os.Getenv("WEBHOOK_SECRET"); secret != "" {
+		conf.Server.WebhookSecret = secret
+	}
+	if secret := os.Getenv("OIDC_CLIENT_SECRET"); secret != "" {
+		conf.Server.OIDC.ClientSecret = secret
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			conf.Server.Addr = *addr
+		case "dev":
+			conf.Server.Dev = *dev
+		case "web-dir":
+			conf.Server.WebDir = *webDir
+		case "api-token":
+			conf.Server.APIToken = *apiToken
+		case "max-in-flight":
+			conf.Server.MaxInFlight = *maxInFlight
+		case "max-queue-wait":
+			conf.Server.MaxQueueWait = *maxQueueWait
+		case "request-timeout":
+			conf.Server.Timeouts.Request = *requestTimeout
+		case "registry-timeout":
+			conf.Server.Timeouts.Registry = *registryTimeout
+		case "rekor-timeout":
+			conf.Server.Timeouts.Rekor = *rekorTimeout
+		case "tofu":
+			conf.Server.TOFUPins = *tofuPins
+		case "denylist":
+			conf.Server.Denylist = *denylistPath
+		case "replay-state":
+			conf.Server.ReplayState = *replayState
+		case "self-image":
+			conf.Server.SelfImage = *selfImage
+		case "self-verify-interval":
+			conf.Server.SelfVerifyInterval = *selfVerifyInterval
+		case "self-identity":
+			conf.Server.SelfIdentity = *selfIdentity
+		case "self-issuer":
+			conf.Server.SelfIssuer = *selfIssuer
+		case "webhook-secret":
+			conf.Server.WebhookSecret = *webhookSecret
+		case "watch-interval":
+			conf.Server.WatchInterval = *watchInterval
+		case "fault-injection":
+			conf.Server.FaultInjection = *faultInjection
+		case "scanner":
+			conf.Server.Scanner = *scanner
+		case "trivy-server":
+			conf.Server.TrivyServer = *trivyServer
+		case "signer":
+			conf.Server.Signer.Backend = *signerBackend
+		case "signer-key":
+			conf.Server.Signer.Key = *signerKey
+		case "signer-kms":
+			conf.Server.Signer.KMS = *signerKMS
+		case "signer-fulcio-url":
+			conf.Server.Signer.FulcioURL = *signerFulcioURL
+		case "signer-svid-dir":
+			conf.Server.Signer.SVIDDir = *signerSVIDDir
+		case "scan-signing-key":
+			conf.Server.ScanSigningKey = *scanSigningKey
+		case "artifact-sources":
+			conf.Server.ArtifactSources = splitList(*artifactSources)
+		case "artifact-keys":
+			conf.Server.ArtifactKeys = splitList(*artifactKeys)
+		case "oidc-issuer":
+			conf.Server.OIDC.Issuer = *oidcIssuer
+		case "oidc-client-id":
+			conf.Server.OIDC.ClientID = *oidcClientID
+		case "oidc-client-secret":
+			conf.Server.OIDC.ClientSecret = *oidcClientSecret
+		case "oidc-redirect-url":
+			conf.Server.OIDC.RedirectURL = *oidcRedirectURL
+		case "admins":
+			conf.Server.Admins = splitList(*admins)
+		case "session-ttl":
+			conf.Server.SessionTTL = *sessionTTL
+		case "shard-dir":
+			conf.Server.ShardDir = *shardDir
+		case "replica-id":
+			conf.Server.ReplicaID = *replicaID
+		}
+	})
+	cfg := server.Config{
+		Dev:                conf.Server.Dev,
+		WebDir:             conf.Server.WebDir,
+		APIToken:           conf.Server.APIToken,
+		MaxInFlight:        conf.Server.MaxInFlight,
+		MaxQueueWait:       conf.Server.MaxQueueWait,
+		RequestTimeout:     conf.Server.Timeouts.Request,
+		SelfImage:          conf.Server.SelfImage,
+		SelfVerifyInterval: conf.Server.SelfVerifyInterval,
+		SelfIdentity:       conf.Server.SelfIdentity,
+		SelfIssuer:         conf.Server.SelfIssuer,
+		WatchInterval:      conf.Server.WatchInterval,
+		WebhookSecret:      conf.Server.WebhookSecret,
+		ArtifactSources:    conf.Server.ArtifactSources,
+		Admins:             conf.Server.Admins,
+		SessionTTL:         conf.Server.SessionTTL,
+		Fingerprint:        conf.Fingerprint(),
+	}
+	for _, w := range conf.Server.Watch {
+		cfg.Watch = append(cfg.Watch, server.WatchTarget(w))
+	}
+	for _, w := range conf.Server.WebhookRepositories {
+		cfg.WebhookRepositories = append(cfg.WebhookRepositories, server.WebhookRepository(w))
+	}
+	reg := metrics.NewRegistry()
+	httpclient.Instrument(reg)
+	rekor.Instrument(reg)
+	evidence := defaultEvidence
+	evidence.registryTimeout = conf.Server.Timeouts.Registry
+	evidence.rekorTimeout = conf.Server.Timeouts.Rekor
+	registry := oci.NewClient()
+	registry.Timeout = conf.Server.Timeouts.Registry
+	deps := server.Deps{
+		Store:    store.New(),
+		Clock:    clock.System{},
+		Env:      env.OS{},
+		Metrics:  reg,
+		Registry: registry,
+		Verify: func(ctx context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+			return verifyImage(ctx, ref, evidence, opts)
+		},
+		Collect: evidence.collectBundle,
+	}
+	if conf.Server.FaultInjection {
+		deps.Faults = fault.New()
+		httpclient.InjectFaults(deps.Faults)
+		log.Printf("Fault injection enabled: set faults at /api/v1/admin/faults")
+	}
+	switch conf.Server.Scanner {
+	case "":
+	case "trivy":
+		deps.Scanner = &scan.Trivy{Server: conf.Server.TrivyServer}
+	case "osv":
+		deps.Scanner = &scan.OSV{Registry: registry, Client: osv.NewClient(), Platform: "linux/amd64"}
+	default:
+		return cli.ConfigError(fmt.Errorf("--scanner: unknown scanner %q: want trivy or osv", conf.Server.Scanner))
+	}
+	sc := conf.Server.Signer
+	if sc.Backend == "" && conf.Server.ScanSigningKey != "" {
+		sc.Backend, sc.Key = signing.BackendKey, conf.Server.ScanSigningKey
+	}
+	signer, err := signing.Open(context.Background(), signing.Options{
+		Backend:       sc.Backend,
+		Key:           sc.Key,
+		LoadKey:       loadSigningKey,
+		KMS:           sc.KMS,
+		FulcioURL:     sc.FulcioURL,
+		IdentityToken: os.Getenv("SIGSTORE_ID_TOKEN"),
+		SVIDDir:       sc.SVIDDir,
+	})
+	if err != nil {
+		return cli.ConfigError(fmt.Errorf("--signer %s: %w", sc.Backend, err))
+	}
+	if signer != nil {
+		deps.Signer = signer
+		log.Printf("Signing VSAs and scan attestations with the %s signer, key %s", signer.Name(), signer.KeyID())
+	}
+	if deps.Scanner != nil {
+		log.Printf("Scanning images on demand with %s", conf.Server.Scanner)
+	}
+	for _, src := range conf.Server.ArtifactSources {
+		if u, err := url.Parse(src); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return cli.ConfigError(fmt.Errorf("artifact source %q is not an HTTP URL", src))
+		}
+	}
+	for _, path := range conf.Server.ArtifactKeys {
+		key, err := signing.LoadPublicKey(path)
+		if err != nil {
+			return cli.ConfigError(fmt.Errorf("artifact key %s: %w", path, err))
+		}
+		v, err := signing.NewVerifier(key)
+		if err != nil {
+			return cli.ConfigError(fmt.Errorf("artifact key %s: %w", path, err))
+		}
+		deps.ArtifactKeys = append(deps.ArtifactKeys, v)
+	}
+	if len(conf.Server.ArtifactSources) > 0 && len(deps.ArtifactKeys) == 0 {
+		return cli.ConfigError(errors.New("--artifact-sources requires --artifact-keys to verify the attestations naming artifacts"))
+	}
+	if len(conf.Server.ArtifactSources) > 0 {
+		log.Printf("Serving attested artifacts from %s", strings.Join(conf.Server.ArtifactSources, ", "))
+	}
+	if o := conf.Server.OIDC; o.Issuer != "" {
+		if o.ClientID == "" || o.RedirectURL == "" || len(conf.Server.Admins) == 0 {
+			return cli.ConfigError(errors.New("--oidc-issuer requires --oidc-client-id, --oidc-redirect-url and --admins"))
+		}
+		deps.OIDC = oidc.NewClient(o.Issuer, o.ClientID, o.ClientSecret, o.RedirectURL)
+		log.Printf("Admin dashboard enabled for %s, signing in with %s", strings.Join(conf.Server.Admins, ", "), o.Issuer)
+	}
+	if conf.Server.ShardDir != "" {
+		sharder, err := joinShard(conf.Server.ShardDir, conf.Server.ReplicaID)
+		if err != nil {
+			return cli.ConfigError(fmt.Errorf("--shard-dir: %w", err))
+		}
+		go sharder.Run(context.Background(), log.Printf)
+		deps.Shard = sharder
+		log.Printf("Sharding the watch list as %s with %d live replicas in %s", sharder.ID(), len(sharder.Members()), conf.Server.ShardDir)
+	}
+	if conf.Server.TOFUPins != "" {
+		pins, err := tofu.Open(conf.Server.TOFUPins)
+		if err != nil {
+			return cli.ConfigError(fmt.Errorf("--tofu: %w", err))
+		}
+		deps.Pins = pins
+		log.Printf("Trust on first use: signer identities pinned in %s", conf.Server.TOFUPins)
+	}
+	if conf.Server.Denylist != "" {
+		list, err := denylist.Open(conf.Server.Denylist)
+		if err != nil {
+			return cli.ConfigError(fmt.Errorf("--denylist: %w", err))
+		}
+		deps.Denylist = list
+		log.Printf("Denylist: %d entries in %s", len(list.Entries()), conf.Server.Denylist)
+	}
+	if conf.Server.ReplayState != "" {
+		tracker, err := replay.Open(conf.Server.ReplayState)
+		if err != nil {
+			return cli.ConfigError(fmt.Errorf("--replay-state: %w", err))
+		}
+		deps.Replay = tracker
+	}
+	if cfg.Dev {
+		if _, err := os.Stat(cfg.WebDir); err != nil {
+			return cli.ConfigError(fmt.Errorf("--web-dir: %w", err))
+		}
+		n, err := server.SeedSampleData(deps.Store, deps.Clock.Now())
+		if err != nil {
+			return fmt.Errorf("seeding sample data: %w", err)
+		}
+		log.Printf("Development mode: serving assets from %s, API auth disabled, %d sample attestations loaded", cfg.WebDir, n)
+	}
+
+	if limit := memlimit.ApplyCgroup(); limit > 0 {
+		log.Printf("Memory limit %d MiB; caches are sized from it", limit>>20)
+	}
+
+	summary, err := json.Marshal(newStartupSummary(conf, *configPath, evidence, deps.Shard))
+	if err != nil {
+		return err
+	}
+	log.Printf("Configuration %s: %s", cfg.Fingerprint, summary)
+
+	listen := conf.Server.Addr
+	base := "http://localhost" + listen
+	if !strings.HasPrefix(listen, ":") {
+		base = "http://" + listen
+	}
+	log.Printf("Starting Tekton SLSA Demo server on %s", listen)
+	log.Printf("Health endpoint: %s/health", base)
+	log.Printf("Info endpoint: %s/info", base)
+	log.Printf("Config fingerprint endpoint: %s/config/fingerprint", base)
+	log.Printf("Status endpoint: %s/status.json", base)
+	log.Printf("Metrics endpoint: %s/metrics", base)
+	log.Printf("SBOM endpoint: %s/sbom", base)
+	log.Printf("Attestations endpoint: %s/api/v1/attestations", base)
+	srv := &http.Server{
+		Addr:    listen,
+		Handler: server.NewServer(cfg, deps),
+		// Clients trickling their headers or body cannot hold a connection
+		// open past the request timeout. Responses are not bounded here:
+		// handlers stream exports and artifacts for as long as they need.
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       conf.Server.Timeouts.Request,
+		IdleTimeout:       idleTimeout,
+	}
+	return srv.ListenAndServe()
+}
+
+// readHeaderTimeout and idleTimeout bound how long a connection may sit
+// before sending a request's headers, and between requests.
+const (
+	readHeaderTimeout = 10 * time.Second
+	idleTimeout       = 2 * time.Minute
+)
+
+// startupSummary is the effective configuration logged as one JSON line at
+// startup: where images and artifacts come from, what they must satisfy and
+// what verification is anchored to. Secrets are left out.
+type startupSummary struct {
+	ConfigFile string `json:"configFile,omitempty"`
+	Sources    struct {
+		Watch           []string `json:"watch"`
+		RegistryWebhook bool     `json:"registryWebhook"`
+		ArtifactSources []string `json:"artifactSources"`
+		Scanner         string   `json:"scanner,omitempty"`
+	} `json:"sources"`
+	Policies struct {
+		Watch       []watchPolicy `json:"watch"`
+		Webhook     []watchPolicy `json:"webhook"`
+		Self        *watchPolicy  `json:"self,omitempty"`
+		TOFUPins    string        `json:"tofuPins,omitempty"`
+		Denylist    string        `json:"denylist,omitempty"`
+		ReplayState string        `json:"replayState,omitempty"`
+		Admins      []string      `json:"admins"`
+	} `json:"policies"`
+	// Shard is how the watch list is split with other replicas, if it is.
+	Shard      *shardSummary `json:"shard,omitempty"`
+	TrustRoots struct {
+		Rekor        string   `json:"rekor"`
+		Fulcio       string   `json:"fulcio"`
+		ArtifactKeys []string `json:"artifactKeys"`
+	} `json:"trustRoots"`
+}
+
+// shardSummary is this replica among those sharing a lease directory.
+type shardSummary struct {
+	Dir      string   `json:"dir"`
+	Replica  string   `json:"replica"`
+	Replicas []string `json:"replicas"`
+}
+
+// watchPolicy is what new digests of a watched image, or images pushed to
+// a webhook repository, must satisfy.
+type watchPolicy struct {
+	Image       string            `json:"image"`
+	Identity    string            `json:"identity,omitempty"`
+	Issuer      string            `json:"issuer,omitempty"`
+	RequireTlog bool              `json:"requireTlog"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+func newStartupSummary(conf *config.Config, path string, ef evidenceFlags, sharder *shard.Sharder) startupSummary {
+	var sum startupSummary
+	sum.ConfigFile = path
+	sum.Sources.Watch = []string{}
+	sum.Sources.RegistryWebhook = conf.Server.Dev || conf.Server.WebhookSecret != ""
+	sum.Sources.ArtifactSources = append([]string{}, conf.Server.ArtifactSources...)
+	sum.Sources.Scanner = conf.Server.Scanner
+	sum.Policies.Watch = []watchPolicy{}
+	for _, w := range conf.Server.Watch {
+		image := w.Image
+		if w.Tags != "" {
+			image += ":" + w.Tags
+		}
+		sum.Sources.Watch = append(sum.Sources.Watch, image)
+		sum.Policies.Watch = append(sum.Policies.Watch, watchPolicy{
+			Image: image, Identity: w.Identity, Issuer: w.Issuer, RequireTlog: w.RequireTlog, Annotations: w.Annotations,
+		})
+	}
+	sum.Policies.Webhook = []watchPolicy{}
+	for _, w := range conf.Server.WebhookRepositories {
+		sum.Policies.Webhook = append(sum.Policies.Webhook, watchPolicy{
+			Image: w.Repository, Identity: w.Identity, Issuer: w.Issuer, RequireTlog: w.RequireTlog, Annotations: w.Annotations,
+		})
+	}
+	if conf.Server.SelfImage != "" {
+		sum.Policies.Self = &watchPolicy{Image: conf.Server.SelfImage, Identity: conf.Server.SelfIdentity, Issuer: conf.Server.SelfIssuer}
+	}
+	sum.Policies.TOFUPins = conf.Server.TOFUPins
+	sum.Policies.Denylist = conf.Server.Denylist
+	sum.Policies.ReplayState = conf.Server.ReplayState
+	sum.Policies.Admins = append([]string{}, conf.Server.Admins...)
+	if sharder != nil {
+		sum.Shard = &shardSummary{Dir: conf.Server.ShardDir, Replica: sharder.ID(), Replicas: sharder.Members()}
+	}
+	sum.TrustRoots.Rekor = ef.rekorURL
+	sum.TrustRoots.Fulcio = ef.fulcioURL
+	sum.TrustRoots.ArtifactKeys = append([]string{}, conf.Server.ArtifactKeys...)
+	return sum
+}
+
+// joinShard takes a lease in dir as replica id, the host name when empty.
+func joinShard(dir, id string) (*shard.Sharder, error) {
+	if id == "" {
+		var err error
+		if id, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+	return shard.New(dir, id, shard.DefaultTTL, clock.System{})
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
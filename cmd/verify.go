@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cluster"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/rekor"
+	"github.com/waveywaves/tekton-slsa-demo/internal/shard"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/tofu"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// runVerify verifies the signatures and attestations attached to images
+// online, the counterpart of bundle verify. Several images, or every
+// platform of a multi-platform image, are verified concurrently. With
+// --namespace or --all-namespaces it verifies the images running in a
+// cluster instead, skipping digests a --state file records as done. With
+// --tofu it pins the first signer identity of each repository and fails
+// with a policy error when another identity signs.
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	var ef evidenceFlags
+	ef.register(fs)
+	identity := fs.String("certificate-identity", "", "regular expression keyless signer identities must match")
+	issuer := fs.String("certificate-oidc-issuer", "", "OIDC issuer keyless certificates must carry")
+	requireTlog := fs.Bool("require-tlog", false, "reject signatures without a verified Rekor entry")
+	annotations := keyValueFlag{}
+	fs.Var(annotations, "annotation", "annotation key=value image signatures must carry, as with cosign sign -a (repeatable)")
+	allPlatforms := fs.Bool("all-platforms", false, "also verify every platform image of a multi-platform index")
+	parallel := fs.Int("parallel", verify.DefaultWorkers, "number of images to verify at once")
+	output := cli.OutputFlag(fs, cli.FormatTable, cli.FormatSARIF)
+	out := fs.String("out", "", "write the result to this file instead of stdout")
+	namespace := fs.String("namespace", "", "verify the images running in this Kubernetes namespace instead of named images")
+	allNamespaces := fs.Bool("all-namespaces", false, "verify the images running in every namespace")
+	kubeContext := fs.String("kube-context", "", "kubeconfig context to scan (default the current context)")
+	kubeTimeout := fs.Duration("kube-timeout", cluster.DefaultTimeout, "how long listing the cluster's pods may take; 0 disables the limit")
+	statePath := fs.String("state", "", "file recording the digests already verified; later scans only verify new or changed images")
+	watch := fs.Bool("watch", false, "after scanning, keep watching pods and verify images as they appear")
+	shardDir := fs.String("shard-dir", "", "directory shared by replicas of a cluster scan for leases that split its images between them by digest")
+	replicaID := fs.String("replica-id", "", "name of this replica in --shard-dir (default the host name)")
+	tofuPath := fs.String("tofu", "", "trust on first use: pin the first signer identity verified for each repository in this file and fail when a different identity signs")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tekton-slsa-demo verify [flags] <image>...")
+		fmt.Fprintln(fs.Output(), "       tekton-slsa-demo verify [flags] --namespace <ns> | --all-namespaces")
+		fs.PrintDefaults()
+	}
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	inCluster := *namespace != "" || *allNamespaces
+	switch {
+	case inCluster && fs.NArg() > 0:
+		return cli.ConfigError(errors.New("images cannot be named together with --namespace or --all-namespaces"))
+	case !inCluster && (*watch || *statePath != "" || *shardDir != ""):
+		return cli.ConfigError(errors.New("--watch, --state and --shard-dir need --namespace or --all-namespaces"))
+	case *watch && *out != "":
+		return cli.ConfigError(errors.New("--watch writes to stdout and cannot be combined with --out"))
+	case !inCluster && fs.NArg() == 0:
+		fs.Usage()
+		return cli.ConfigError(errors.New("at least one image is required"))
+	}
+	if *parallel < 1 {
+		return cli.ConfigError(fmt.Errorf("--parallel must be at least 1, got %d", *parallel))
+	}
+	var refs []oci.Reference
+	for _, arg := range fs.Args() {
+		ref, err := oci.ParseReference(arg)
+		if err != nil {
+			return cli.ConfigError(err)
+		}
+		refs = append(refs, ref)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var scan *clusterScan
+	if inCluster {
+		ns := *namespace
+		if *allNamespaces {
+			ns = ""
+		}
+		var err error
+		if scan, err = newClusterScan(clusterSource(*kubeContext, ns, *kubeTimeout), *statePath); err != nil {
+			return err
+		}
+		if *shardDir != "" {
+			if scan.shard, err = joinShard(*shardDir, *replicaID); err != nil {
+				return cli.ConfigError(fmt.Errorf("--shard-dir: %w", err))
+			}
+			defer scan.shard.Release()
+			go scan.shard.Run(ctx, func(format string, args ...any) { fmt.Fprintf(os.Stderr, format+"\n", args...) })
+		}
+		if refs, err = scan.pending(ctx); err != nil {
+			return err
+		}
+	}
+	if *allPlatforms {
+		var err error
+		if refs, err = expandPlatforms(ctx, refs); err != nil {
+			return err
+		}
+	}
+	var pins *tofu.Pins
+	if *tofuPath != "" {
+		var err error
+		if pins, err = tofu.Open(*tofuPath); err != nil {
+			return cli.ConfigError(err)
+		}
+	}
+	opts := verify.Options{
+		Identity:    *identity,
+		Issuer:      *issuer,
+		RequireTlog: *requireTlog,
+		Annotations: annotations,
+	}
+	var tofuErr error
+	verifyAll := func(refs []oci.Reference) ([]*verify.Result, error) {
+		results, err := verify.All(ctx, refs, *parallel, func(ctx context.Context, ref oci.Reference) (*verify.Result, error) {
+			return verifyImage(ctx, ref, ef, opts)
+		})
+		if scan != nil {
+			if serr := scan.record(refs, results); serr != nil {
+				err = errors.Join(err, serr)
+			}
+		}
+		if pins != nil {
+			if terr := checkPins(pins, results); terr != nil {
+				tofuErr = errors.Join(tofuErr, terr)
+			}
+		}
+		return results, err
+	}
+	if *watch {
+		return scan.watch(ctx, refs, verifyAll, func(res *verify.Result) error {
+			return writeVerifyResult(os.Stdout, *output, res)
+		})
+	}
+
+	results, verr := verifyAll(refs)
+	completed := results[:0]
+	for _, res := range results {
+		if res != nil {
+			completed = append(completed, res)
+		}
+	}
+	if len(completed) == 0 {
+		return verr
+	}
+
+	// A single named image keeps the output of a single result.
+	write := func(w io.Writer) error { return writeVerifyResults(w, *output, completed) }
+	if len(refs) == 1 && !inCluster {
+		write = func(w io.Writer) error { return writeVerifyResult(w, *output, completed[0]) }
+	}
+	var err error
+	if *out == "" {
+		err = write(os.Stdout)
+	} else {
+		f, ferr := os.Create(*out)
+		if ferr != nil {
+			return ferr
+		}
+		err = write(f)
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	// Images that could not be checked at all outrank failed checks, and
+	// those outrank identities that differ from their pin.
+	if verr != nil {
+		return verr
+	}
+	if err != nil {
+		return err
+	}
+	return tofuErr
+}
+
+// checkPins compares completed results with the trust-on-first-use pins,
+// reporting new pins and every mismatch on stderr. It returns a policy
+// error when an image is signed by an identity other than the one pinned
+// for its repository.
+func checkPins(pins *tofu.Pins, results []*verify.Result) error {
+	var errs []error
+	mismatched := 0
+	for _, res := range results {
+		if res == nil {
+			continue
+		}
+		r, err := pins.Check(res, time.Now())
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if r == nil {
+			continue
+		}
+		if r.NewPin {
+			fmt.Fprintf(os.Stderr, "TOFU: pinned %s to %s\n", r.Repository, r.Pin.Identity)
+		}
+		if alert := r.Alert(); alert != "" {
+			fmt.Fprintln(os.Stderr, alert)
+			mismatched++
+		}
+	}
+	if mismatched > 0 {
+		errs = append(errs, cli.PolicyError(failure.New(failure.IdentityRejected, "%d images are signed by an identity other than the one pinned for their repository", mismatched)))
+	}
+	return errors.Join(errs...)
+}
+
+// expandPlatforms replaces each reference with its verification subjects,
+// see verify.Subjects. It is a variable so tests can expand without a
+// registry.
+var expandPlatforms = func(ctx context.Context, refs []oci.Reference) ([]oci.Reference, error) {
+	client := oci.NewClient()
+	var out []oci.Reference
+	for _, ref := range refs {
+		subjects, err := verify.Subjects(ctx, client, ref)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, subjects...)
+	}
+	return out, nil
+}
+
+// clusterSource returns where a cluster scan finds its pods. It is a
+// variable so tests can scan without a cluster.
+var clusterSource = func(kubeContext, namespace string, timeout time.Duration) cluster.Source {
+	return &cluster.Kubectl{Context: kubeContext, Namespace: namespace, Timeout: timeout}
+}
+
+// clusterScan verifies the images running in a cluster, consulting and
+// updating a state file so only new or changed digests are verified.
+type clusterScan struct {
+	src       cluster.Source
+	tracker   *cluster.Tracker
+	statePath string
+	// shard, when set, leaves the digests other replicas own to them.
+	shard *shard.Sharder
+}
+
+func newClusterScan(src cluster.Source, statePath string) (*clusterScan, error) {
+	tracker := cluster.NewTracker()
+	if statePath != "" {
+		var err error
+		if tracker, err = cluster.LoadTracker(statePath); err != nil {
+			return nil, cli.ConfigError(err)
+		}
+	}
+	return &clusterScan{src: src, tracker: tracker, statePath: statePath}, nil
+}
+
+// pending lists the pods and returns the images not verified yet.
+func (s *clusterScan) pending(ctx context.Context) ([]oci.Reference, error) {
+	pods, err := s.src.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all := cluster.Images(pods)
+	pending := s.tracker.Pending(all)
+	if s.shard == nil {
+		fmt.Fprintf(os.Stderr, "%d pods run %d images; %d already verified, %d to verify\n",
+			len(pods), len(all), len(all)-len(pending), len(pending))
+		return pending, nil
+	}
+	owned := s.owned(pending)
+	fmt.Fprintf(os.Stderr, "%d pods run %d images; %d already verified, %d to verify, %d of them by %s of %d replicas\n",
+		len(pods), len(all), len(all)-len(pending), len(pending), len(owned), s.shard.ID(), len(s.shard.Members()))
+	return owned, nil
+}
+
+// owned returns the refs whose digests this replica owns.
+func (s *clusterScan) owned(refs []oci.Reference) []oci.Reference {
+	if s.shard == nil {
+		return refs
+	}
+	var owned []oci.Reference
+	for _, ref := range refs {
+		if s.shard.Owns(ref.Digest) {
+			owned = append(owned, ref)
+		}
+	}
+	return owned
+}
+
+// record stores the completed results and saves the state file. Images
+// that could not be checked are left out so the next scan retries them.
+func (s *clusterScan) record(refs []oci.Reference, results []*verify.Result) error {
+	now := time.Now()
+	for i, res := range results {
+		if res != nil {
+			s.tracker.Record(refs[i], res, now)
+		}
+	}
+	if s.statePath == "" {
+		return nil
+	}
+	return s.tracker.Save(s.statePath)
+}
+
+// watch verifies refs, then the new images of every pod that changes,
+// writing each result as it completes, until ctx is done. Failures are
+// reported and the watch goes on.
+func (s *clusterScan) watch(ctx context.Context, refs []oci.Reference, verifyAll func([]oci.Reference) ([]*verify.Result, error), write func(*verify.Result) error) error {
+	check := func(refs []oci.Reference) {
+		if len(refs) == 0 {
+			return
+		}
+		results, err := verifyAll(refs)
+		for _, res := range results {
+			if res != nil {
+				if werr := write(res); werr != nil && !errors.As(werr, new(*cli.Error)) {
+					fmt.Fprintln(os.Stderr, werr)
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	check(refs)
+	err := s.src.Watch(ctx, func(pod cluster.Pod) {
+		if !pod.Deleted {
+			check(s.owned(s.tracker.Pending(pod.Images)))
+		}
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// writeVerifyResults renders the results of verifying several images: in
+// sequence as tables, as a list in JSON and YAML, and as one SARIF log with
+// a run per image.
+func writeVerifyResults(w io.Writer, f cli.Format, results []*verify.Result) error {
+	var err error
+	if f == cli.FormatSARIF {
+		version := getEnvOrDefault("APP_VERSION", "1.0.0")
+		log := results[0].SARIF("tekton-slsa-demo", version)
+		for _, res := range results[1:] {
+			log.Runs = append(log.Runs, res.SARIF("tekton-slsa-demo", version).Runs...)
+		}
+		err = log.Write(w)
+	} else {
+		err = cli.Write(w, f, results, func(w io.Writer) error {
+			for i, res := range results {
+				if i > 0 {
+					fmt.Fprintln(w)
+				}
+				printVerifyResult(w, res)
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		return err
+	}
+	failed := 0
+	var code failure.Code
+	for _, res := range results {
+		if !res.Verified {
+			if failed == 0 {
+				code = res.Code
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		return cli.VerificationError(failure.New(code, "verification failed for %d of %d images", failed, len(results)))
+	}
+	return nil
+}
+
+// defaultEvidence is the public Sigstore instance, used by the verify API.
+var defaultEvidence = evidenceFlags{
+	rekorURL:        rekor.DefaultURL,
+	fulcioURL:       signing.DefaultFulcioURL,
+	registryTimeout: oci.DefaultTimeout,
+	rekorTimeout:    rekor.DefaultTimeout,
+}
+
+// verifyImage collects an image's evidence and verifies it against the
+// trust root collected with it, which comes from the configured Rekor and
+// Fulcio, --trusted-root and --key rather than from the registry. It is a
+// variable so tests can verify without a registry.
+var verifyImage = func(ctx context.Context, ref oci.Reference, ef evidenceFlags, opts verify.Options) (*verify.Result, error) {
+	b, err := ef.collectBundle(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	opts.Root = &b.TrustedRoot
+	return verify.Verify(&b.Evidence, opts)
+}
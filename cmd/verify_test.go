@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cli"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cluster"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/shard"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/golden"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+func TestWriteVerifyResultGolden(t *testing.T) {
+	t.Setenv("APP_VERSION", "1.0.0")
+	logIndex := int64(41782)
+	signedAt := time.Date(2024, 3, 12, 9, 44, 2, 0, time.UTC)
+	res := &verify.Result{
+		Image:  "registry.local/tekton-slsa-demo/app:v1",
+		Digest: "sha256:4d5e1a1c3b2f0e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d0c9b8a7f6e5d",
+		Checks: []verify.Check{
+			{
+				Kind:        verify.KindSignature,
+				Signer:      "https://github.com/waveywaves/tekton-slsa-demo/.github/workflows/release.yaml@refs/heads/main",
+				Issuer:      "https://token.actions.githubusercontent.com",
+				LogIndex:    &logIndex,
+				SignedAt:    &signedAt,
+				Verified:    true,
+				Annotations: map[string]string{"env": "prod", "team": "security"},
+			},
+			{
+				Kind:          verify.KindAttestation,
+				PredicateType: attestation.PredicateSLSAProvenanceV02,
+				Signer:        "SHA256:hvH3zXyvGxFqB4QWBn2l9aBHkAYqVJrBgyH2dTAkS9w",
+				Verified:      true,
+			},
+			{
+				Kind:          verify.KindAttestation,
+				PredicateType: attestation.PredicateSPDX,
+				Error:         "no statement subject matches sha256:4d5e1a1c3b2f0e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d0c9b8a7f6e5d",
+				Code:          failure.SignatureMismatch,
+			},
+		},
+		Verified: true,
+	}
+
+	for _, f := range []cli.Format{cli.FormatTable, cli.FormatJSON, cli.FormatYAML, cli.FormatSARIF} {
+		var buf bytes.Buffer
+		if err := writeVerifyResult(&buf, f, res); err != nil {
+			t.Fatal(err)
+		}
+		golden.Assert(t, "verify-result."+string(f), buf.Bytes())
+	}
+}
+
+func TestRunVerifyConcurrently(t *testing.T) {
+	origVerify, origExpand := verifyImage, expandPlatforms
+	defer func() { verifyImage, expandPlatforms = origVerify, origExpand }()
+	verifyImage = func(_ context.Context, ref oci.Reference, _ evidenceFlags, _ verify.Options) (*verify.Result, error) {
+		switch ref.Repository {
+		case "down":
+			return nil, errors.New("registry unavailable")
+		case "unsigned":
+			return &verify.Result{Image: ref.String(), Checks: []verify.Check{}}, nil
+		}
+		return &verify.Result{Image: ref.String(), Checks: []verify.Check{}, Verified: true}, nil
+	}
+	expandPlatforms = func(_ context.Context, refs []oci.Reference) ([]oci.Reference, error) {
+		return append(refs, refs[0].WithDigest("sha256:arm64")), nil
+	}
+
+	run := func(args ...string) ([]verify.Result, error) {
+		t.Helper()
+		out := filepath.Join(t.TempDir(), "results.json")
+		err := runVerify(append([]string{"--output", "json", "--out", out, "--parallel", "2"}, args...))
+		data, rerr := os.ReadFile(out)
+		if rerr != nil {
+			return nil, err
+		}
+		var results []verify.Result
+		if jerr := json.Unmarshal(data, &results); jerr != nil {
+			t.Fatalf("decoding %s: %v", data, jerr)
+		}
+		return results, err
+	}
+
+	results, err := run("--all-platforms", "registry.local/app:v1")
+	if err != nil || len(results) != 2 || results[1].Image != "registry.local/app:v1@sha256:arm64" {
+		t.Errorf("--all-platforms: %+v, %v", results, err)
+	}
+
+	results, err = run("registry.local/app:v1", "registry.local/unsigned:v1")
+	if cli.ExitCode(err) != cli.ExitVerification || len(results) != 2 || results[1].Verified {
+		t.Errorf("one unsigned image: %+v, %v", results, err)
+	}
+
+	results, err = run("registry.local/app:v1", "registry.local/down:v1")
+	if len(results) != 1 || err == nil || !strings.Contains(err.Error(), "registry.local/down:v1: registry unavailable") {
+		t.Errorf("one unreachable image: %+v, %v", results, err)
+	}
+
+	if err := runVerify([]string{"--parallel", "0", "registry.local/app:v1"}); cli.ExitCode(err) != cli.ExitConfig {
+		t.Errorf("--parallel 0: %v, want a configuration error", err)
+	}
+}
+
+func TestRunVerifyTrustOnFirstUse(t *testing.T) {
+	orig := verifyImage
+	defer func() { verifyImage = orig }()
+	verifyImage = func(_ context.Context, ref oci.Reference, _ evidenceFlags, _ verify.Options) (*verify.Result, error) {
+		signer := "release@example.com"
+		if ref.Tag == "v2" {
+			signer = "mallory@example.com"
+		}
+		return &verify.Result{Image: ref.String(), Digest: "sha256:" + ref.Tag, Verified: true,
+			Checks: []verify.Check{{Kind: verify.KindSignature, Signer: signer, Verified: true}}}, nil
+	}
+	pins := filepath.Join(t.TempDir(), "pins.json")
+	run := func(image string) error {
+		return runVerify([]string{"--output", "json", "--out", filepath.Join(t.TempDir(), "out.json"), "--tofu", pins, image})
+	}
+
+	if err := run("registry.local/app:v1"); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := run("registry.local/app:v1"); err != nil {
+		t.Errorf("pinned signer: %v", err)
+	}
+	if err := run("registry.local/app:v2"); cli.ExitCode(err) != cli.ExitPolicy {
+		t.Errorf("different signer: %v, want a policy error", err)
+	}
+	if err := run("registry.local/other:v2"); err != nil {
+		t.Errorf("another repository: %v", err)
+	}
+}
+
+// fakeCluster is a cluster.Source with a fixed pod list and a scripted
+// watch.
+type fakeCluster struct {
+	pods   []cluster.Pod
+	events []cluster.Pod
+}
+
+func (c *fakeCluster) List(context.Context) ([]cluster.Pod, error) { return c.pods, nil }
+
+func (c *fakeCluster) Watch(_ context.Context, fn func(cluster.Pod)) error {
+	for _, p := range c.events {
+		fn(p)
+	}
+	return nil
+}
+
+func TestRunVerifyClusterIncrementally(t *testing.T) {
+	origVerify, origSource := verifyImage, clusterSource
+	defer func() { verifyImage, clusterSource = origVerify, origSource }()
+	var verified []string
+	verifyImage = func(_ context.Context, ref oci.Reference, _ evidenceFlags, _ verify.Options) (*verify.Result, error) {
+		verified = append(verified, ref.String())
+		return &verify.Result{Image: ref.String(), Checks: []verify.Check{}, Verified: true}, nil
+	}
+	pin := func(name, hex string) oci.Reference {
+		ref, err := oci.ParseReference(name + "@sha256:" + strings.Repeat(hex, 64))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ref
+	}
+	app, db, app2 := pin("ghcr.io/org/app", "a"), pin("ghcr.io/org/db", "b"), pin("ghcr.io/org/app", "c")
+	src := &fakeCluster{pods: []cluster.Pod{
+		{Namespace: "demo", Name: "app-1", Images: []oci.Reference{app}},
+		{Namespace: "demo", Name: "app-2", Images: []oci.Reference{app, db}},
+	}}
+	var gotNamespace string
+	clusterSource = func(_, ns string, _ time.Duration) cluster.Source {
+		gotNamespace = ns
+		return src
+	}
+	state := filepath.Join(t.TempDir(), "state.json")
+	out := filepath.Join(t.TempDir(), "results.json")
+	args := []string{"--namespace", "demo", "--state", state, "--output", "json", "--parallel", "1"}
+
+	if err := runVerify(append(args, "--out", out)); err != nil {
+		t.Fatal(err)
+	}
+	if gotNamespace != "demo" || len(verified) != 2 {
+		t.Fatalf("first scan of %q verified %v, want both images once", gotNamespace, verified)
+	}
+
+	// A rescan with the same digests verifies nothing; a rolled-out digest
+	// is the only one verified.
+	verified = nil
+	if err := runVerify(append(args, "--out", out)); err != nil || len(verified) != 0 {
+		t.Errorf("unchanged rescan verified %v, %v", verified, err)
+	}
+	src.pods[0].Images = []oci.Reference{app2}
+	if err := runVerify(append(args, "--out", out)); err != nil || !reflect.DeepEqual(verified, []string{app2.String()}) {
+		t.Errorf("rescan after a rollout verified %v, %v", verified, err)
+	}
+
+	// Watching verifies the new images of changed pods only.
+	verified = nil
+	app3 := pin("ghcr.io/org/app", "d")
+	src.events = []cluster.Pod{
+		{Namespace: "demo", Name: "app-1", Images: []oci.Reference{app2}},
+		{Namespace: "demo", Name: "app-3", Images: []oci.Reference{app3}},
+		{Namespace: "demo", Name: "app-4", Images: []oci.Reference{pin("ghcr.io/org/gone", "e")}, Deleted: true},
+	}
+	if err := runVerify(append(args, "--watch")); err != nil || !reflect.DeepEqual(verified, []string{app3.String()}) {
+		t.Errorf("watch verified %v, %v", verified, err)
+	}
+
+	for _, bad := range [][]string{
+		{"--namespace", "demo", "ghcr.io/org/app:v1"},
+		{"--state", state, "ghcr.io/org/app:v1"},
+		{"--namespace", "demo", "--watch", "--out", out},
+	} {
+		if err := runVerify(bad); cli.ExitCode(err) != cli.ExitConfig {
+			t.Errorf("runVerify(%q) = %v, want a configuration error", bad, err)
+		}
+	}
+}
+
+func TestRunVerifyClusterSharded(t *testing.T) {
+	origVerify, origSource := verifyImage, clusterSource
+	defer func() { verifyImage, clusterSource = origVerify, origSource }()
+	verified := map[string]int{}
+	verifyImage = func(_ context.Context, ref oci.Reference, _ evidenceFlags, _ verify.Options) (*verify.Result, error) {
+		verified[ref.Digest]++
+		return &verify.Result{Image: ref.String(), Checks: []verify.Check{}, Verified: true}, nil
+	}
+	var pod cluster.Pod
+	for _, hex := range "01234567" {
+		ref, err := oci.ParseReference("ghcr.io/org/app@sha256:" + strings.Repeat(string(hex), 64))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pod.Images = append(pod.Images, ref)
+	}
+	clusterSource = func(_, _ string, _ time.Duration) cluster.Source { return &fakeCluster{pods: []cluster.Pod{pod}} }
+
+	dir := t.TempDir()
+	for _, replica := range []string{"replica-0", "replica-1"} {
+		// Each replica holds a lease while the other scans.
+		other := "replica-1"
+		if replica == other {
+			other = "replica-0"
+		}
+		if _, err := shard.New(dir, other, 0, nil); err != nil {
+			t.Fatal(err)
+		}
+		args := []string{"--all-namespaces", "--shard-dir", dir, "--replica-id", replica, "--output", "json", "--out", filepath.Join(t.TempDir(), "results.json")}
+		if err := runVerify(args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(verified) != len(pod.Images) {
+		t.Errorf("verified %d of %d images", len(verified), len(pod.Images))
+	}
+	for d, n := range verified {
+		if n != 1 {
+			t.Errorf("%s verified %d times", d, n)
+		}
+	}
+}
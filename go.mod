@@ -1,3 +1,11 @@
 module github.com/waveywaves/tekton-slsa-demo
 
 go 1.21
+
+require (
+	golang.org/x/crypto v0.17.0
+	golang.org/x/term v0.15.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.15.0 // indirect
@@ -0,0 +1,124 @@
+package attestation
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/strictyaml"
+)
+
+// DecodeEnvelopes accepts a single envelope, a JSON array of envelopes, or
+// a stream of concatenated envelopes as written by `cosign download
+// attestation`. A bare in-toto statement is wrapped in an unsigned envelope
+// so it can be inspected the same way. Input that is not JSON is decoded as
+// YAML, see decodeYAML.
+func DecodeEnvelopes(data []byte) ([]*dsse.Envelope, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] != '[' && trimmed[0] != '{' {
+		return decodeYAML(trimmed)
+	}
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var raws []json.RawMessage
+		if err := json.Unmarshal(trimmed, &raws); err != nil {
+			return nil, err
+		}
+		var envs []*dsse.Envelope
+		for _, raw := range raws {
+			env, err := decodeEnvelope(raw)
+			if err != nil {
+				return nil, err
+			}
+			envs = append(envs, env)
+		}
+		return envs, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	var envs []*dsse.Envelope
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		env, err := decodeEnvelope(raw)
+		if err != nil {
+			return nil, err
+		}
+		envs = append(envs, env)
+	}
+	return envs, nil
+}
+
+func decodeEnvelope(raw []byte) (*dsse.Envelope, error) {
+	var probe struct {
+		Type        string `json:"_type"`
+		PayloadType string `json:"payloadType"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, err
+	}
+	if probe.PayloadType == "" && probe.Type != "" {
+		return dsse.Sign(PayloadType, raw)
+	}
+	return dsse.Parse(raw)
+}
+
+// decodeYAML decodes YAML envelopes or statements, one per document of a
+// stream or listed in a single document. Unknown fields and mistyped values
+// are rejected with their position.
+func decodeYAML(data []byte) ([]*dsse.Envelope, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var envs []*dsse.Envelope
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		nodes := []*yaml.Node{doc.Content[0]}
+		if doc.Content[0].Kind == yaml.SequenceNode {
+			nodes = doc.Content[0].Content
+		}
+		for _, n := range nodes {
+			var v any = &dsse.Envelope{}
+			if isStatement(n) {
+				v = &Statement{}
+			}
+			raw, err := strictyaml.ToJSON(n, v)
+			if err != nil {
+				return nil, err
+			}
+			env, err := decodeEnvelope(raw)
+			if err != nil {
+				return nil, err
+			}
+			envs = append(envs, env)
+		}
+	}
+	return envs, nil
+}
+
+// isStatement reports whether the YAML mapping n is a bare statement
+// rather than an envelope, as decodeEnvelope decides for JSON.
+func isStatement(n *yaml.Node) bool {
+	var hasType bool
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		switch n.Content[i].Value {
+		case "payloadType":
+			return false
+		case "_type":
+			hasType = true
+		}
+	}
+	return hasType
+}
@@ -0,0 +1,114 @@
+package attestation
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+)
+
+func TestDecodeEnvelopes(t *testing.T) {
+	stmt, err := NewStatement(PredicateSLSAProvenanceV1, Provenance{}, Subject{Name: "app", Digest: map[string]string{"sha256": "deadbeef"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(stmt)
+	env, err := dsse.Sign(PayloadType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	one, _ := json.Marshal(env)
+	stream := append(append(append([]byte{}, one...), '\n'), one...)
+	array := []byte("[" + string(one) + "," + string(one) + "]")
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"single", one, 1},
+		{"stream", stream, 2},
+		{"array", array, 2},
+		{"bare statement", payload, 1},
+		{"yaml envelope", []byte("payloadType: " + env.PayloadType + "\npayload: " + env.Payload + "\nsignatures: []\n"), 1},
+		{"yaml stream", []byte(yamlStatement + "---\n" + yamlStatement), 2},
+		{"yaml list", []byte("- " + strings.ReplaceAll(strings.TrimSpace(yamlStatement), "\n", "\n  ")), 1},
+	}
+	for _, tt := range tests {
+		envs, err := DecodeEnvelopes(tt.data)
+		if err != nil {
+			t.Errorf("%s: DecodeEnvelopes() error: %v", tt.name, err)
+			continue
+		}
+		if len(envs) != tt.want {
+			t.Errorf("%s: got %d envelopes, want %d", tt.name, len(envs), tt.want)
+		}
+	}
+}
+
+const yamlStatement = `_type: https://in-toto.io/Statement/v1
+subject:
+  - name: app
+    digest:
+      sha256: 0123456789
+predicateType: https://slsa.dev/provenance/v1
+predicate:
+  buildDefinition: {buildType: tekton}
+`
+
+func TestDecodeYAMLStatement(t *testing.T) {
+	envs, err := DecodeEnvelopes([]byte(yamlStatement))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := envs[0].DecodePayload()
+	stmt, err := ParseStatement(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The digest stays the hex string it was written as.
+	if stmt.Subject[0].Digest["sha256"] != "0123456789" {
+		t.Errorf("subject = %+v", stmt.Subject)
+	}
+
+	bad := strings.Replace(yamlStatement, "    digest:", "    digests:", 1)
+	if _, err := DecodeEnvelopes([]byte(bad)); err == nil || err.Error() != `line 4, column 5: subject[0]: unknown field "digests" in Subject` {
+		t.Errorf("DecodeEnvelopes(unknown field) = %v", err)
+	}
+}
+
+func FuzzDecodeEnvelopes(f *testing.F) {
+	paths, _ := filepath.Glob("testdata/chains/*.json")
+	var all [][]byte
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+		all = append(all, data)
+	}
+	f.Add(bytes.Join(all, []byte("\n")))
+	f.Add([]byte("[" + string(bytes.Join(all, []byte(","))) + "]"))
+	f.Add([]byte(yamlStatement))
+	f.Add([]byte(`{"_type":"https://in-toto.io/Statement/v1","subject":[],"predicateType":"x","predicate":{}}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		envs, err := DecodeEnvelopes(data)
+		if err != nil {
+			return
+		}
+		for i, env := range envs {
+			if env == nil {
+				t.Fatalf("envelope %d is nil", i)
+			}
+			if err := env.Validate(); err != nil {
+				t.Fatalf("envelope %d is invalid: %v", i, err)
+			}
+		}
+	})
+}
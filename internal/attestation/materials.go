@@ -0,0 +1,89 @@
+package attestation
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// UnpinnedMaterial is a resolved dependency of a build that is not pinned
+// by digest, so what the build consumed cannot be told from the
+// provenance: a hermeticity gap.
+type UnpinnedMaterial struct {
+	URI    string `json:"uri,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (m UnpinnedMaterial) String() string {
+	name := m.URI
+	if name == "" {
+		name = m.Name
+	}
+	return name + ": " + m.Reason
+}
+
+// fullDigest matches a digest value long enough to pin content: a git
+// commit's 40 hex characters or more.
+var fullDigest = regexp.MustCompile(`^[0-9a-fA-F]{40,}$`)
+
+// uriDigest matches a digest written into a URI, as in
+// oci://ghcr.io/org/app@sha256:<hex>.
+var uriDigest = regexp.MustCompile(`@[a-z0-9_]+:[0-9a-fA-F]{40,}$`)
+
+// UnpinnedMaterials returns the resolved dependencies (v0.2 materials)
+// that are not pinned by a full digest, either in their digest set or in
+// their URI, with why: no digest at all, a floating branch or tag, or a
+// digest too short to identify content.
+func (p *Provenance) UnpinnedMaterials() []UnpinnedMaterial {
+	var unpinned []UnpinnedMaterial
+	for _, dep := range p.BuildDefinition.ResolvedDependencies {
+		if reason := unpinnedReason(dep); reason != "" {
+			unpinned = append(unpinned, UnpinnedMaterial{URI: dep.URI, Name: dep.Name, Reason: reason})
+		}
+	}
+	return unpinned
+}
+
+func unpinnedReason(dep ResourceDescriptor) string {
+	algs := make([]string, 0, len(dep.Digest))
+	for alg, v := range dep.Digest {
+		if fullDigest.MatchString(v) {
+			return ""
+		}
+		algs = append(algs, alg)
+	}
+	if uriDigest.MatchString(dep.URI) {
+		return ""
+	}
+	if len(algs) > 0 {
+		sort.Strings(algs)
+		return fmt.Sprintf("%s digest is not a full hex digest", strings.Join(algs, ", "))
+	}
+	return "no digest" + floatingRef(dep.URI)
+}
+
+// floatingRef describes the moving reference a URI names, if any: a git
+// branch, tag or other ref after "@", or an image tag.
+func floatingRef(uri string) string {
+	if i := strings.LastIndex(uri, "@"); i >= 0 {
+		switch ref := uri[i+1:]; {
+		case strings.HasPrefix(ref, "refs/heads/"):
+			return "; it names the branch " + strings.TrimPrefix(ref, "refs/heads/")
+		case strings.HasPrefix(ref, "refs/tags/"):
+			return "; it names the tag " + strings.TrimPrefix(ref, "refs/tags/")
+		case ref != "" && !strings.Contains(ref, "/"):
+			return "; it names the ref " + ref
+		}
+	}
+	// An image reference such as oci://ghcr.io/org/app:v1.
+	rest := uri
+	if _, after, ok := strings.Cut(uri, "://"); ok {
+		rest = after
+	}
+	if i := strings.LastIndex(rest, ":"); i > 0 && !strings.Contains(rest[i:], "/") && strings.Contains(rest[:i], "/") {
+		return "; it names the tag " + rest[i+1:]
+	}
+	return ""
+}
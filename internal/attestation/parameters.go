@@ -0,0 +1,62 @@
+package attestation
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Parameter is one leaf of a build's parameters: its dotted path, with [n]
+// indexes into lists, and its value as text.
+type Parameter struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (p Parameter) String() string {
+	return p.Name + " = " + p.Value
+}
+
+// FlattenParameters lists the leaves of params in name order, each named
+// by its path under prefix, such as externalParameters.args[0]. Strings
+// are given as they are and other values as JSON.
+func FlattenParameters(prefix string, params map[string]any) []Parameter {
+	var out []Parameter
+	flatten(prefix, params, &out)
+	return out
+}
+
+func flatten(name string, v any, out *[]Parameter) {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if name != "" {
+				child = name + "." + k
+			}
+			flatten(child, v[k], out)
+		}
+	case []any:
+		for i, e := range v {
+			flatten(fmt.Sprintf("%s[%d]", name, i), e, out)
+		}
+	case string:
+		*out = append(*out, Parameter{Name: name, Value: v})
+	default:
+		b, _ := json.Marshal(v)
+		*out = append(*out, Parameter{Name: name, Value: string(b)})
+	}
+}
+
+// Parameters lists the leaves of the build's external and then internal
+// parameters, named from externalParameters and internalParameters.
+func (p *Provenance) Parameters() []Parameter {
+	return append(
+		FlattenParameters("externalParameters", p.BuildDefinition.ExternalParameters),
+		FlattenParameters("internalParameters", p.BuildDefinition.InternalParameters)...)
+}
@@ -0,0 +1,182 @@
+package attestation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	PredicateSLSAProvenanceV02 = "https://slsa.dev/provenance/v0.2"
+	PredicateSLSAProvenanceV1  = "https://slsa.dev/provenance/v1"
+)
+
+// Provenance is the SLSA v1 provenance predicate.
+type Provenance struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+// BuildDefinition describes the inputs of a build.
+type BuildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   map[string]any       `json:"externalParameters"`
+	InternalParameters   map[string]any       `json:"internalParameters,omitempty"`
+	ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+// RunDetails describes the builder and the particular invocation.
+type RunDetails struct {
+	Builder    Builder              `json:"builder"`
+	Metadata   *BuildMetadata       `json:"metadata,omitempty"`
+	Byproducts []ResourceDescriptor `json:"byproducts,omitempty"`
+}
+
+// Builder identifies the trusted build platform.
+type Builder struct {
+	ID                  string               `json:"id"`
+	Version             map[string]string    `json:"version,omitempty"`
+	BuilderDependencies []ResourceDescriptor `json:"builderDependencies,omitempty"`
+}
+
+// BuildMetadata carries invocation identifiers and timestamps.
+type BuildMetadata struct {
+	InvocationID string     `json:"invocationId,omitempty"`
+	StartedOn    *time.Time `json:"startedOn,omitempty"`
+	FinishedOn   *time.Time `json:"finishedOn,omitempty"`
+}
+
+// ResourceDescriptor references an artifact by URI and/or digest.
+type ResourceDescriptor struct {
+	URI              string            `json:"uri,omitempty"`
+	Digest           map[string]string `json:"digest,omitempty"`
+	Name             string            `json:"name,omitempty"`
+	DownloadLocation string            `json:"downloadLocation,omitempty"`
+	MediaType        string            `json:"mediaType,omitempty"`
+	Annotations      map[string]any    `json:"annotations,omitempty"`
+}
+
+// ProvenanceV02 is the SLSA v0.2 provenance predicate, still produced by
+// Chains when configured with the in-toto or slsa/v1 formats.
+type ProvenanceV02 struct {
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+	BuildType   string        `json:"buildType"`
+	Invocation  InvocationV02 `json:"invocation"`
+	BuildConfig any           `json:"buildConfig,omitempty"`
+	Metadata    *MetadataV02  `json:"metadata,omitempty"`
+	Materials   []MaterialV02 `json:"materials,omitempty"`
+}
+
+// InvocationV02 describes how a v0.2 build was started.
+type InvocationV02 struct {
+	ConfigSource struct {
+		URI        string            `json:"uri,omitempty"`
+		Digest     map[string]string `json:"digest,omitempty"`
+		EntryPoint string            `json:"entryPoint,omitempty"`
+	} `json:"configSource"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+	Environment map[string]any `json:"environment,omitempty"`
+}
+
+// MetadataV02 holds v0.2 build timestamps and completeness claims.
+type MetadataV02 struct {
+	BuildInvocationID string     `json:"buildInvocationID,omitempty"`
+	BuildStartedOn    *time.Time `json:"buildStartedOn,omitempty"`
+	BuildFinishedOn   *time.Time `json:"buildFinishedOn,omitempty"`
+	Reproducible      bool       `json:"reproducible,omitempty"`
+}
+
+// MaterialV02 is an input artifact of a v0.2 build.
+type MaterialV02 struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// NormalizeProvenance decodes the statement's predicate as SLSA provenance
+// and returns it in v1 shape, converting v0.2 predicates field by field.
+func NormalizeProvenance(s *Statement) (*Provenance, error) {
+	switch s.PredicateType {
+	case PredicateSLSAProvenanceV1:
+		var p Provenance
+		if err := json.Unmarshal(s.Predicate, &p); err != nil {
+			return nil, fmt.Errorf("decoding SLSA v1 provenance: %w", err)
+		}
+		return &p, nil
+	case PredicateSLSAProvenanceV02:
+		var old ProvenanceV02
+		if err := json.Unmarshal(s.Predicate, &old); err != nil {
+			return nil, fmt.Errorf("decoding SLSA v0.2 provenance: %w", err)
+		}
+		return old.toV1(), nil
+	default:
+		return nil, fmt.Errorf("predicate type %q is not SLSA provenance", s.PredicateType)
+	}
+}
+
+func (old *ProvenanceV02) toV1() *Provenance {
+	p := &Provenance{
+		BuildDefinition: BuildDefinition{
+			BuildType:          old.BuildType,
+			ExternalParameters: map[string]any{},
+		},
+		RunDetails: RunDetails{Builder: Builder{ID: old.Builder.ID}},
+	}
+	for k, v := range old.Invocation.Parameters {
+		p.BuildDefinition.ExternalParameters[k] = v
+	}
+	if cs := old.Invocation.ConfigSource; cs.URI != "" {
+		p.BuildDefinition.ExternalParameters["configSource"] = map[string]any{
+			"uri": cs.URI, "digest": cs.Digest, "entryPoint": cs.EntryPoint,
+		}
+	}
+	if old.Invocation.Environment != nil || old.BuildConfig != nil {
+		p.BuildDefinition.InternalParameters = map[string]any{}
+		if old.Invocation.Environment != nil {
+			p.BuildDefinition.InternalParameters["environment"] = old.Invocation.Environment
+		}
+		if old.BuildConfig != nil {
+			p.BuildDefinition.InternalParameters["buildConfig"] = old.BuildConfig
+		}
+	}
+	for _, m := range old.Materials {
+		p.BuildDefinition.ResolvedDependencies = append(p.BuildDefinition.ResolvedDependencies,
+			ResourceDescriptor{URI: m.URI, Digest: m.Digest})
+	}
+	if md := old.Metadata; md != nil {
+		p.RunDetails.Metadata = &BuildMetadata{
+			InvocationID: md.BuildInvocationID,
+			StartedOn:    md.BuildStartedOn,
+			FinishedOn:   md.BuildFinishedOn,
+		}
+	}
+	return p
+}
+
+// Validate reports missing fields that SLSA v1 marks as required.
+func (p *Provenance) Validate() error {
+	if p.BuildDefinition.BuildType == "" {
+		return errors.New("provenance: missing buildDefinition.buildType")
+	}
+	if p.RunDetails.Builder.ID == "" {
+		return errors.New("provenance: missing runDetails.builder.id")
+	}
+	return nil
+}
+
+// Source returns the first resolved dependency that looks like a source
+// repository, which is how both Chains and the attest subcommand record it.
+func (p *Provenance) Source() (ResourceDescriptor, bool) {
+	for _, dep := range p.BuildDefinition.ResolvedDependencies {
+		if strings.HasPrefix(dep.URI, "git+") {
+			return dep, true
+		}
+	}
+	if len(p.BuildDefinition.ResolvedDependencies) > 0 {
+		return p.BuildDefinition.ResolvedDependencies[0], true
+	}
+	return ResourceDescriptor{}, false
+}
@@ -0,0 +1,157 @@
+package attestation
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+)
+
+func TestNormalizeProvenanceV02(t *testing.T) {
+	stmt, err := ParseStatement([]byte(`{
+		"_type": "https://in-toto.io/Statement/v0.1",
+		"predicateType": "https://slsa.dev/provenance/v0.2",
+		"subject": [{"name": "registry.local/app", "digest": {"sha256": "abc"}}],
+		"predicate": {
+			"builder": {"id": "https://tekton.dev/chains/v2"},
+			"buildType": "tekton.dev/v1beta1/TaskRun",
+			"invocation": {
+				"configSource": {"uri": "git+https://github.com/org/repo", "digest": {"sha1": "123"}},
+				"parameters": {"IMAGE": "registry.local/app"}
+			},
+			"metadata": {"buildInvocationID": "run-1"},
+			"materials": [{"uri": "git+https://github.com/org/repo", "digest": {"sha1": "123"}}]
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NormalizeProvenance(stmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Validate(); err != nil {
+		t.Errorf("Validate() error: %v", err)
+	}
+	if p.RunDetails.Builder.ID != "https://tekton.dev/chains/v2" {
+		t.Errorf("builder id = %q", p.RunDetails.Builder.ID)
+	}
+	if p.BuildDefinition.ExternalParameters["IMAGE"] != "registry.local/app" {
+		t.Errorf("parameters not carried over: %v", p.BuildDefinition.ExternalParameters)
+	}
+	if p.RunDetails.Metadata == nil || p.RunDetails.Metadata.InvocationID != "run-1" {
+		t.Errorf("metadata not carried over: %+v", p.RunDetails.Metadata)
+	}
+	src, ok := p.Source()
+	if !ok || src.Digest["sha1"] != "123" {
+		t.Errorf("Source() = %+v, %v", src, ok)
+	}
+}
+
+func TestNormalizeProvenanceRejectsOtherPredicates(t *testing.T) {
+	stmt := &Statement{PredicateType: PredicateSPDX, Predicate: []byte(`{}`)}
+	if _, err := NormalizeProvenance(stmt); err == nil {
+		t.Error("NormalizeProvenance() accepted an SPDX predicate")
+	}
+}
+
+// chainsPayloads returns the statements from the Chains envelopes in
+// testdata/chains.
+func chainsPayloads(f *testing.F) [][]byte {
+	paths, err := filepath.Glob("testdata/chains/*.json")
+	if err != nil || len(paths) == 0 {
+		f.Fatalf("no Chains seeds: %v", err)
+	}
+	var out [][]byte
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		env, err := dsse.Parse(data)
+		if err != nil {
+			f.Fatalf("%s: %v", path, err)
+		}
+		payload, _ := env.DecodePayload()
+		out = append(out, payload)
+	}
+	return out
+}
+
+func FuzzNormalizeProvenance(f *testing.F) {
+	for _, payload := range chainsPayloads(f) {
+		f.Add(payload)
+	}
+	f.Add([]byte(`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","subject":[{"name":"a","digest":{"sha256":"0"}}],"predicate":null}`))
+	f.Add([]byte(`{"_type":"https://in-toto.io/Statement/v1","predicateType":"https://slsa.dev/provenance/v1","subject":[{"name":"a","digest":{"sha256":"0"}}],"predicate":[]}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		stmt, err := ParseStatement(data)
+		if err != nil {
+			return
+		}
+		p, err := NormalizeProvenance(stmt)
+		if err != nil {
+			return
+		}
+		p.Validate()
+		p.Source()
+		if _, err := json.Marshal(p); err != nil {
+			t.Fatalf("normalized provenance does not encode: %v", err)
+		}
+	})
+}
+
+func TestUnpinnedMaterials(t *testing.T) {
+	commit := strings.Repeat("a", 40)
+	p := &Provenance{BuildDefinition: BuildDefinition{ResolvedDependencies: []ResourceDescriptor{
+		{URI: "git+https://github.com/org/app@refs/heads/main", Digest: map[string]string{"sha1": commit}},
+		{URI: "oci://ghcr.io/org/base@sha256:" + strings.Repeat("b", 64)},
+		{URI: "git+https://github.com/org/lib@refs/heads/main"},
+		{URI: "git+https://github.com/org/tool@refs/tags/v1.2.0"},
+		{URI: "oci://ghcr.io/org/builder:latest"},
+		{URI: "https://example.com/tool.tar.gz", Digest: map[string]string{"sha256": "abc123"}},
+		{Name: "params"},
+	}}}
+	var got []string
+	for _, m := range p.UnpinnedMaterials() {
+		got = append(got, m.String())
+	}
+	want := []string{
+		"git+https://github.com/org/lib@refs/heads/main: no digest; it names the branch main",
+		"git+https://github.com/org/tool@refs/tags/v1.2.0: no digest; it names the tag v1.2.0",
+		"oci://ghcr.io/org/builder:latest: no digest; it names the tag latest",
+		"https://example.com/tool.tar.gz: sha256 digest is not a full hex digest",
+		"params: no digest",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("UnpinnedMaterials() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParameters(t *testing.T) {
+	p := &Provenance{BuildDefinition: BuildDefinition{
+		ExternalParameters: map[string]any{
+			"runSpec": map[string]any{"params": []any{map[string]any{"name": "tls-verify", "value": false}}},
+			"args":    []any{"--insecure", "build"},
+		},
+		InternalParameters: map[string]any{"tekton-pipelines-feature-flags": map[string]any{"EnableAPIFields": "beta"}},
+	}}
+	var got []string
+	for _, param := range p.Parameters() {
+		got = append(got, param.String())
+	}
+	want := []string{
+		"externalParameters.args[0] = --insecure",
+		"externalParameters.args[1] = build",
+		"externalParameters.runSpec.params[0].name = tls-verify",
+		"externalParameters.runSpec.params[0].value = false",
+		"internalParameters.tekton-pipelines-feature-flags.EnableAPIFields = beta",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Parameters() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
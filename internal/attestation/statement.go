@@ -0,0 +1,116 @@
+// Package attestation defines the in-toto statement and SLSA provenance
+// types produced by Tekton Chains and by the attest subcommand.
+package attestation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	// PayloadType is the DSSE payload type for in-toto statements.
+	PayloadType = "application/vnd.in-toto+json"
+
+	StatementTypeV01 = "https://in-toto.io/Statement/v0.1"
+	StatementTypeV1  = "https://in-toto.io/Statement/v1"
+)
+
+// Statement is an in-toto attestation statement. The predicate is kept raw
+// so callers can decode it according to PredicateType.
+type Statement struct {
+	Type          string          `json:"_type"`
+	Subject       []Subject       `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// Subject identifies an artifact by name and one or more digests.
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// NewStatement builds a v1 statement about subjects with the given predicate.
+func NewStatement(predicateType string, predicate any, subjects ...Subject) (*Statement, error) {
+	raw, err := json.Marshal(predicate)
+	if err != nil {
+		return nil, fmt.Errorf("encoding predicate: %w", err)
+	}
+	return &Statement{
+		Type:          StatementTypeV1,
+		Subject:       subjects,
+		PredicateType: predicateType,
+		Predicate:     raw,
+	}, nil
+}
+
+// ParseStatement decodes an in-toto statement and checks its required fields.
+func ParseStatement(data []byte) (*Statement, error) {
+	var st Statement
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("decoding statement: %w", err)
+	}
+	if err := st.Validate(); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// Validate reports structural problems with the statement.
+func (s *Statement) Validate() error {
+	switch s.Type {
+	case StatementTypeV01, StatementTypeV1:
+	case "":
+		return errors.New("statement: missing _type")
+	default:
+		return fmt.Errorf("statement: unsupported _type %q", s.Type)
+	}
+	if len(s.Subject) == 0 {
+		return errors.New("statement: no subjects")
+	}
+	for i, sub := range s.Subject {
+		if len(sub.Digest) == 0 {
+			return fmt.Errorf("statement: subject %d has no digest", i)
+		}
+	}
+	if s.PredicateType == "" {
+		return errors.New("statement: missing predicateType")
+	}
+	return nil
+}
+
+// Well-known predicate types besides SLSA provenance.
+const (
+	PredicateSPDX           = "https://spdx.dev/Document"
+	PredicateCycloneDX      = "https://cyclonedx.org/bom"
+	PredicateVulnerability  = "https://cosign.sigstore.dev/attestation/vuln/v1"
+	PredicateVSA            = "https://slsa.dev/verification_summary/v1"
+	PredicateCosignCustom   = "https://cosign.sigstore.dev/attestation/v1"
+	PredicateInTotoLinkV0_3 = "https://in-toto.io/Link/v0.3"
+)
+
+var predicateNames = map[string]string{
+	PredicateSLSAProvenanceV02: "SLSA Provenance v0.2",
+	PredicateSLSAProvenanceV1:  "SLSA Provenance v1",
+	PredicateSPDX:              "SPDX SBOM",
+	PredicateCycloneDX:         "CycloneDX SBOM",
+	PredicateVulnerability:     "Cosign Vulnerability Scan",
+	PredicateVSA:               "SLSA Verification Summary",
+	PredicateCosignCustom:      "Cosign Custom Predicate",
+	PredicateInTotoLinkV0_3:    "in-toto Link",
+}
+
+// PredicateName returns a human-readable name for a predicate type, or
+// "Unknown" if it is not one the demo recognises.
+func PredicateName(predicateType string) string {
+	if name, ok := predicateNames[predicateType]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// IsProvenance reports whether the predicate type is SLSA provenance.
+func IsProvenance(predicateType string) bool {
+	return predicateType == PredicateSLSAProvenanceV1 || predicateType == PredicateSLSAProvenanceV02
+}
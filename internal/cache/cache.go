@@ -0,0 +1,130 @@
+// Package cache provides an LRU cache bounded by the memory its entries
+// take rather than by their count.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/clock"
+)
+
+// Cache is a least-recently-used cache holding at most MaxBytes worth of
+// values, as measured by its size function. It is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	// TTL, when not zero, expires entries that long after they were added.
+	TTL   time.Duration
+	Clock clock.Clock
+	// Pressure, when set, is consulted on every Add; while it reports true
+	// the cache evicts down to half its budget so the memory can be
+	// reclaimed before the process hits its limit.
+	Pressure func() bool
+
+	maxBytes int64
+	size     func(K, V) int64
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[K]*list.Element
+	bytes int64
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	size    int64
+	expires time.Time
+}
+
+// New returns a cache holding at most maxBytes, measuring each entry with
+// size.
+func New[K comparable, V any](maxBytes int64, size func(K, V) int64) *Cache[K, V] {
+	return &Cache[K, V]{
+		Clock:    clock.System{},
+		maxBytes: maxBytes,
+		size:     size,
+		ll:       list.New(),
+		items:    map[K]*list.Element{},
+	}
+}
+
+// Get returns the value cached for key and marks it recently used.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	e := el.Value.(*entry[K, V])
+	if !e.expires.IsZero() && !c.Clock.Now().Before(e.expires) {
+		c.remove(el)
+		return zero, false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+// Add caches value for key, evicting the least recently used entries to
+// stay within budget. Values larger than the whole budget are not cached.
+func (c *Cache[K, V]) Add(key K, value V) {
+	n := c.size(key, value)
+	pressure := c.Pressure != nil && c.Pressure()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	budget := c.maxBytes
+	if pressure {
+		budget /= 2
+	}
+	if n > budget {
+		return
+	}
+	e := &entry[K, V]{key: key, value: value, size: n}
+	if c.TTL > 0 {
+		e.expires = c.Clock.Now().Add(c.TTL)
+	}
+	c.items[key] = c.ll.PushFront(e)
+	c.bytes += n
+	for c.bytes > budget {
+		c.remove(c.ll.Back())
+	}
+}
+
+// Remove drops the value cached for key, if any.
+func (c *Cache[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Len returns the number of cached entries.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Bytes returns the total size of the cached entries.
+func (c *Cache[K, V]) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+// MaxBytes returns the cache's budget.
+func (c *Cache[K, V]) MaxBytes() int64 {
+	return c.maxBytes
+}
+
+func (c *Cache[K, V]) remove(el *list.Element) {
+	e := c.ll.Remove(el).(*entry[K, V])
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/clock"
+)
+
+func byLength(k string, v string) int64 { return int64(len(k) + len(v)) }
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, string](10, byLength)
+	c.Add("a", "1111")
+	c.Add("b", "2222")
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a was not cached")
+	}
+	c.Add("c", "3333")
+	if _, ok := c.Get("b"); ok {
+		t.Error("b survived although it was least recently used")
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, ok := c.Get(k); !ok {
+			t.Errorf("%s was evicted", k)
+		}
+	}
+	if c.Bytes() != 10 || c.Len() != 2 {
+		t.Errorf("cache holds %d entries and %d bytes, want 2 and 10", c.Len(), c.Bytes())
+	}
+}
+
+func TestReplaceAndOversized(t *testing.T) {
+	c := New[string, string](10, byLength)
+	c.Add("a", "1")
+	c.Add("a", "22")
+	if v, _ := c.Get("a"); v != "22" || c.Bytes() != 3 {
+		t.Errorf("after replacing: %q and %d bytes, want \"22\" and 3", v, c.Bytes())
+	}
+	c.Add("big", "0123456789")
+	if _, ok := c.Get("big"); ok {
+		t.Error("a value larger than the budget was cached")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("an oversized value evicted the rest of the cache")
+	}
+	c.Remove("a")
+	c.Remove("missing")
+	if _, ok := c.Get("a"); ok || c.Bytes() != 0 {
+		t.Errorf("after removing: %d bytes cached", c.Bytes())
+	}
+}
+
+func TestTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.Fixed(now)
+	c := New[string, string](100, byLength)
+	c.TTL = time.Minute
+	c.Clock = clk
+	c.Add("a", "1")
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("fresh entry missing")
+	}
+	c.Clock = clock.Fixed(now.Add(time.Minute))
+	if _, ok := c.Get("a"); ok {
+		t.Error("expired entry returned")
+	}
+	if c.Len() != 0 || c.Bytes() != 0 {
+		t.Errorf("expired entry still accounted: %d entries, %d bytes", c.Len(), c.Bytes())
+	}
+}
+
+func TestPressureHalvesBudget(t *testing.T) {
+	c := New[string, string](20, byLength)
+	for _, k := range []string{"a", "b", "c", "d"} {
+		c.Add(k, "1234")
+	}
+	pressure := true
+	c.Pressure = func() bool { return pressure }
+	c.Add("e", "1234")
+	if c.Bytes() > 10 {
+		t.Errorf("under pressure the cache holds %d bytes, want at most 10", c.Bytes())
+	}
+	if _, ok := c.Get("e"); !ok {
+		t.Error("the newest entry was evicted")
+	}
+	pressure = false
+	for _, k := range []string{"f", "g"} {
+		c.Add(k, "1234")
+	}
+	if c.Bytes() != 20 {
+		t.Errorf("after pressure eased the cache holds %d bytes, want 20", c.Bytes())
+	}
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestYAML(t *testing.T) {
+	v := struct {
+		Name      string          `json:"name"`
+		Flag      string          `json:"flag"`
+		Count     int             `json:"count"`
+		Predicate json.RawMessage `json:"predicate"`
+	}{
+		Name:      "app",
+		Flag:      "true",
+		Count:     2,
+		Predicate: json.RawMessage(`{"z":1,"a":[true,"1.0"]}`),
+	}
+	got, err := YAML(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `name: app
+flag: "true"
+count: 2
+predicate:
+    z: 1
+    a:
+        - true
+        - "1.0"
+`
+	if string(got) != want {
+		t.Errorf("YAML =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestOutputFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	out := OutputFlag(fs, FormatTable, FormatSARIF)
+	if err := fs.Parse([]string{"--output", "SARIF"}); err != nil {
+		t.Fatal(err)
+	}
+	if *out != FormatSARIF {
+		t.Errorf("output = %q, want sarif", *out)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	OutputFlag(fs, FormatTable)
+	err := Parse(fs, []string{"--output", "sarif"})
+	if err == nil || ExitCode(err) != ExitConfig {
+		t.Errorf("Parse(--output sarif) = %v (exit %d), want a config error", err, ExitCode(err))
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, ExitOK},
+		{flag.ErrHelp, ExitOK},
+		{PolicyError(errors.New("high findings")), ExitPolicy},
+		{fmt.Errorf("wrapped: %w", ConfigError(errors.New("no key"))), ExitConfig},
+		{VerificationError(errors.New("bad signature")), ExitVerification},
+		{errors.New("registry unreachable"), ExitVerification},
+	}
+	for _, tt := range tests {
+		if got := ExitCode(tt.err); got != tt.want {
+			t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	var b strings.Builder
+	err := Write(&b, FormatTable, nil, func(w io.Writer) error {
+		_, err := io.WriteString(w, "table\n")
+		return err
+	})
+	if err != nil || b.String() != "table\n" {
+		t.Errorf("Write(table) = %q, %v", b.String(), err)
+	}
+	if err := Write(&b, FormatSARIF, nil, nil); err == nil {
+		t.Error("Write(sarif) succeeded without a SARIF encoder")
+	}
+}
@@ -0,0 +1,25 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+)
+
+// describing is set while Flags runs a subcommand.
+var describing struct {
+	active bool
+	fs     *flag.FlagSet
+}
+
+var errDescribed = errors.New("cli: flags described")
+
+// Flags runs a subcommand only up to its call to Parse and returns the flag
+// set it defined, or nil if it never called Parse. Shell completion uses it
+// to list each subcommand's flags without duplicating their definitions.
+// It is not safe for concurrent use.
+func Flags(run func() error) *flag.FlagSet {
+	describing.active, describing.fs = true, nil
+	defer func() { describing.active = false }()
+	run()
+	return describing.fs
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+)
+
+// Exit codes returned by every subcommand.
+const (
+	// ExitOK means the command completed and every check passed.
+	ExitOK = 0
+	// ExitPolicy means the artifact was evaluated and failed a policy,
+	// e.g. a vulnerability at or above the --fail-on severity.
+	ExitPolicy = 1
+	// ExitVerification means a signature, attestation or proof did not
+	// verify, or the command could not complete the check at all.
+	ExitVerification = 2
+	// ExitConfig means the command was invoked incorrectly: bad flags,
+	// missing arguments or unreadable keys and configuration.
+	ExitConfig = 3
+)
+
+// Error attaches an exit code to an error.
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// PolicyError marks err as a policy failure.
+func PolicyError(err error) error { return &Error{Code: ExitPolicy, Err: err} }
+
+// VerificationError marks err as a verification failure.
+func VerificationError(err error) error { return &Error{Code: ExitVerification, Err: err} }
+
+// ConfigError marks err as a usage or configuration error.
+func ConfigError(err error) error { return &Error{Code: ExitConfig, Err: err} }
+
+// ExitCode maps err to the process exit code. Errors without a code are
+// failures to complete the check and map to ExitVerification.
+func ExitCode(err error) int {
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ExitVerification
+}
+
+// Parse parses args into fs, reporting bad flags as configuration errors.
+func Parse(fs *flag.FlagSet, args []string) error {
+	if describing.active {
+		describing.fs = fs
+		return errDescribed
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return ConfigError(err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// Package cli holds the output formats and exit codes shared by the
+// tekton-slsa-demo subcommands, so scripts can rely on them uniformly.
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format selects how a subcommand renders its result.
+type Format string
+
+const (
+	FormatTable Format = "table"
+	FormatJSON  Format = "json"
+	FormatYAML  Format = "yaml"
+	// FormatSARIF is only offered by subcommands that report findings.
+	FormatSARIF Format = "sarif"
+)
+
+// formatFlag is a flag.Value restricted to a set of formats.
+type formatFlag struct {
+	value   *Format
+	allowed []Format
+}
+
+func (f formatFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return string(*f.value)
+}
+
+func (f formatFlag) Set(s string) error {
+	for _, a := range f.allowed {
+		if strings.EqualFold(s, string(a)) {
+			*f.value = a
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format %q (want %s)", s, f.names())
+}
+
+func (f formatFlag) names() string {
+	names := make([]string, len(f.allowed))
+	for i, a := range f.allowed {
+		names[i] = string(a)
+	}
+	return strings.Join(names, ", ")
+}
+
+// OutputFlag registers --output on fs. Every subcommand accepts table, json
+// and yaml; extra lists any additional formats it supports.
+func OutputFlag(fs *flag.FlagSet, def Format, extra ...Format) *Format {
+	v := def
+	f := formatFlag{value: &v, allowed: append([]Format{FormatTable, FormatJSON, FormatYAML}, extra...)}
+	fs.Var(f, "output", "output format: "+f.names())
+	return &v
+}
+
+// Write renders v to w in format f. Structured formats encode v directly;
+// table calls the subcommand's human-readable printer.
+func Write(w io.Writer, f Format, v any, table func(io.Writer) error) error {
+	switch f {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case FormatYAML:
+		data, err := YAML(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case FormatTable:
+		if table != nil {
+			return table(w)
+		}
+		return Write(w, FormatJSON, v, nil)
+	}
+	return fmt.Errorf("output format %s is not supported here", f)
+}
+
+// WriteFile is Write to path, or to stdout when path is empty.
+func WriteFile(path string, f Format, v any, table func(io.Writer) error) error {
+	if path == "" {
+		return Write(os.Stdout, f, v, table)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Write(file, f, v, table); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// YAML encodes v as YAML using its JSON field names and order. Going
+// through JSON keeps a single set of struct tags and preserves the field
+// order of json.RawMessage documents such as predicates.
+func YAML(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	blockStyle(&node)
+	return yaml.Marshal(&node)
+}
+
+// blockStyle clears the flow and quoting styles JSON input parses with, so
+// the encoder emits conventional block YAML and quotes only where needed.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
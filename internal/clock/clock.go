@@ -0,0 +1,25 @@
+// Package clock abstracts the current time so that code which records or
+// compares timestamps can be tested with a fixed clock.
+package clock
+
+import "time"
+
+// Clock tells the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the wall clock.
+type System struct{}
+
+func (System) Now() time.Time { return time.Now() }
+
+// Func adapts a function to a Clock.
+type Func func() time.Time
+
+func (f Func) Now() time.Time { return f() }
+
+// Fixed returns a clock that is stopped at t.
+func Fixed(t time.Time) Clock {
+	return Func(func() time.Time { return t })
+}
@@ -0,0 +1,224 @@
+// Package cluster finds the images running in a Kubernetes cluster and
+// remembers which digests have already been verified, so a rescan only
+// verifies images that are new or have changed since the last one.
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+)
+
+// Pod is a pod and the images its containers run, pinned by digest.
+type Pod struct {
+	Namespace string
+	Name      string
+	Images    []oci.Reference
+	// Deleted is set for pods reported gone by a watch.
+	Deleted bool
+}
+
+// Source lists the pods in a cluster and reports changes to them.
+type Source interface {
+	List(ctx context.Context) ([]Pod, error)
+	// Watch calls fn for every pod added, changed or deleted until ctx is
+	// done or the watch fails.
+	Watch(ctx context.Context, fn func(Pod)) error
+}
+
+// DefaultTimeout is the suggested Kubectl.Timeout.
+const DefaultTimeout = 30 * time.Second
+
+// Kubectl is a Source that runs kubectl, so it uses the same kubeconfig,
+// contexts and credentials as the user's shell.
+type Kubectl struct {
+	// Path is the kubectl binary; empty finds kubectl on $PATH.
+	Path string
+	// Context selects a kubeconfig context; empty uses the current one.
+	Context string
+	// Namespace limits the scan to one namespace; empty scans them all.
+	Namespace string
+	// Timeout bounds List; kubectl is killed when it passes. Zero leaves
+	// List bounded only by the caller's context. Watch runs until its
+	// context ends regardless.
+	Timeout time.Duration
+}
+
+func (k *Kubectl) command(ctx context.Context, args ...string) *exec.Cmd {
+	path := k.Path
+	if path == "" {
+		path = "kubectl"
+	}
+	if k.Context != "" {
+		args = append([]string{"--context", k.Context}, args...)
+	}
+	if k.Namespace != "" {
+		args = append(args, "--namespace", k.Namespace)
+	} else {
+		args = append(args, "--all-namespaces")
+	}
+	return exec.CommandContext(ctx, path, args...)
+}
+
+// List returns the pods in the namespace.
+func (k *Kubectl) List(ctx context.Context) ([]Pod, error) {
+	if k.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, k.Timeout)
+		defer cancel()
+	}
+	cmd := k.command(ctx, "get", "pods", "--output", "json")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("kubectl get pods: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return DecodePodList(out)
+}
+
+// Watch streams pod changes from kubectl get --watch.
+func (k *Kubectl) Watch(ctx context.Context, fn func(Pod)) error {
+	cmd := k.command(ctx, "get", "pods", "--output", "json", "--watch-only", "--output-watch-events")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	derr := DecodeWatch(stdout, fn)
+	werr := cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if werr != nil {
+		return fmt.Errorf("kubectl get pods --watch: %w: %s", werr, strings.TrimSpace(stderr.String()))
+	}
+	return derr
+}
+
+// podJSON is the part of a Kubernetes Pod object the scan needs.
+type podJSON struct {
+	Metadata struct {
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+	} `json:"metadata"`
+	Status struct {
+		InitContainerStatuses []containerStatus `json:"initContainerStatuses"`
+		ContainerStatuses     []containerStatus `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+type containerStatus struct {
+	Image   string `json:"image"`
+	ImageID string `json:"imageID"`
+}
+
+// DecodePodList decodes the output of kubectl get pods -o json.
+func DecodePodList(data []byte) ([]Pod, error) {
+	var list struct {
+		Items []podJSON `json:"items"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("decoding pod list: %w", err)
+	}
+	pods := make([]Pod, len(list.Items))
+	for i, p := range list.Items {
+		pods[i] = p.pod()
+	}
+	return pods, nil
+}
+
+// DecodeWatch decodes the stream of events kubectl get --watch
+// --output-watch-events writes, calling fn for each pod.
+func DecodeWatch(r io.Reader, fn func(Pod)) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var event struct {
+			Type   string  `json:"type"`
+			Object podJSON `json:"object"`
+		}
+		if err := dec.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("decoding pod watch event: %w", err)
+		}
+		pod := event.Object.pod()
+		pod.Deleted = event.Type == "DELETED"
+		fn(pod)
+	}
+}
+
+func (p podJSON) pod() Pod {
+	pod := Pod{Namespace: p.Metadata.Namespace, Name: p.Metadata.Name}
+	seen := map[string]bool{}
+	for _, cs := range append(p.Status.InitContainerStatuses, p.Status.ContainerStatuses...) {
+		ref, ok := imageRef(cs)
+		if !ok || seen[ref.String()] {
+			continue
+		}
+		seen[ref.String()] = true
+		pod.Images = append(pod.Images, ref)
+	}
+	return pod
+}
+
+// imageRef returns the digest a container runs. The runtime reports it in
+// imageID, either as a full reference, possibly behind a docker-pullable://
+// scheme, or as a bare digest to be combined with the image name. Containers
+// that have not pulled their image yet have no imageID and are skipped.
+func imageRef(cs containerStatus) (oci.Reference, bool) {
+	id := cs.ImageID
+	if _, rest, ok := strings.Cut(id, "://"); ok {
+		id = rest
+	}
+	if id == "" {
+		return oci.Reference{}, false
+	}
+	if !strings.Contains(id, "@") {
+		name, err := oci.ParseReference(cs.Image)
+		if err != nil || !strings.Contains(id, ":") {
+			return oci.Reference{}, false
+		}
+		return oci.Reference{Registry: name.Registry, Repository: name.Repository, Digest: id}, true
+	}
+	ref, err := oci.ParseReference(id)
+	if err != nil {
+		return oci.Reference{}, false
+	}
+	ref.Tag = ""
+	return ref, true
+}
+
+// Images returns the distinct images run by pods, sorted.
+func Images(pods []Pod) []oci.Reference {
+	seen := map[string]oci.Reference{}
+	for _, p := range pods {
+		if p.Deleted {
+			continue
+		}
+		for _, ref := range p.Images {
+			seen[ref.String()] = ref
+		}
+	}
+	refs := make([]oci.Reference, 0, len(seen))
+	for _, ref := range seen {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+	return refs
+}
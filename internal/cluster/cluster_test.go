@@ -0,0 +1,117 @@
+package cluster
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+var (
+	digestA = "sha256:" + strings.Repeat("a", 64)
+	digestB = "sha256:" + strings.Repeat("b", 64)
+	digestC = "sha256:" + strings.Repeat("c", 64)
+)
+
+func refStrings(refs []oci.Reference) []string {
+	var out []string
+	for _, r := range refs {
+		out = append(out, r.String())
+	}
+	return out
+}
+
+func TestDecodePodList(t *testing.T) {
+	data, err := os.ReadFile("testdata/pods.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pods, err := DecodePodList(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 4 || pods[0].Namespace != "demo" || pods[0].Name != "app-7d9f8-x2k4p" {
+		t.Fatalf("pods: %+v", pods)
+	}
+	if got, want := refStrings(pods[0].Images), []string{
+		"ghcr.io/org/migrate@" + digestA,
+		"ghcr.io/org/app@" + digestB,
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("images of the first pod: %v, want %v", got, want)
+	}
+	if len(pods[3].Images) != 0 {
+		t.Errorf("a container that has not pulled its image contributed %v", pods[3].Images)
+	}
+
+	if got, want := refStrings(Images(pods)), []string{
+		"ghcr.io/org/app@" + digestB,
+		"ghcr.io/org/migrate@" + digestA,
+		"localhost:5001/tekton-slsa-demo@" + digestC,
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Images: %v, want %v", got, want)
+	}
+}
+
+func TestDecodeWatch(t *testing.T) {
+	f, err := os.Open("testdata/watch.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var events []string
+	err = DecodeWatch(f, func(p Pod) {
+		event := p.Name
+		if p.Deleted {
+			event += " deleted"
+		}
+		for _, ref := range p.Images {
+			event += " " + ref.String()
+		}
+		events = append(events, event)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"app-1 ghcr.io/org/app@" + digestB,
+		"app-1 ghcr.io/org/app@" + digestA,
+		"app-1 deleted",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events:\n%s\nwant:\n%s", strings.Join(events, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestTrackerPendingAndPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	tr, err := LoadTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := oci.ParseReference("ghcr.io/org/app@" + digestA)
+	b, _ := oci.ParseReference("ghcr.io/org/app@" + digestB)
+	if got := tr.Pending([]oci.Reference{a, b}); len(got) != 2 {
+		t.Fatalf("fresh tracker: %d pending, want 2", len(got))
+	}
+
+	at := time.Date(2024, 3, 12, 9, 0, 0, 0, time.UTC)
+	tr.Record(a, &verify.Result{Verified: true}, at)
+	if err := tr.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	tr, err = LoadTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refStrings(tr.Pending([]oci.Reference{a, b})); !reflect.DeepEqual(got, []string{b.String()}) {
+		t.Errorf("after reload: pending %v, want only %s", got, b)
+	}
+	if e, ok := tr.Lookup(a); !ok || !e.Verified || !e.VerifiedAt.Equal(at) {
+		t.Errorf("Lookup = %+v, %v", e, ok)
+	}
+}
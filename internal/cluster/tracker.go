@@ -0,0 +1,92 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/fsutil"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// Tracker remembers the outcome of verifying each digest. A digest's
+// signatures and attestations are fixed once pushed, so a recorded result
+// holds until the state is discarded; only images that could not be
+// checked at all are retried.
+type Tracker struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+// Entry is the recorded outcome for one image digest.
+type Entry struct {
+	Verified   bool      `json:"verified"`
+	VerifiedAt time.Time `json:"verifiedAt"`
+}
+
+// NewTracker returns a tracker that has seen nothing.
+func NewTracker() *Tracker {
+	return &Tracker{entries: map[string]Entry{}}
+}
+
+// LoadTracker reads the state file at path. A missing file is an empty
+// state, as on the first scan.
+func LoadTracker(path string) (*Tracker, error) {
+	t := NewTracker()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &t.entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Save writes the state to path, replacing it atomically so an interrupted
+// scan never leaves a truncated file.
+func (t *Tracker) Save(path string) error {
+	t.mu.Lock()
+	data, err := json.MarshalIndent(t.entries, "", "  ")
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(path, append(data, '\n'))
+}
+
+// Pending returns the images in refs that have no recorded outcome.
+func (t *Tracker) Pending(refs []oci.Reference) []oci.Reference {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var pending []oci.Reference
+	for _, ref := range refs {
+		if _, ok := t.entries[ref.String()]; !ok {
+			pending = append(pending, ref)
+		}
+	}
+	return pending
+}
+
+// Record stores the outcome of verifying ref.
+func (t *Tracker) Record(ref oci.Reference, res *verify.Result, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[ref.String()] = Entry{Verified: res.Verified, VerifiedAt: at.UTC()}
+}
+
+// Lookup returns the recorded outcome for ref.
+func (t *Tracker) Lookup(ref oci.Reference) (Entry, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.entries[ref.String()]
+	return e, ok
+}
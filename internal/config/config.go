@@ -0,0 +1,273 @@
+// Package config loads the server's YAML configuration file.
+package config
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/env"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/rekor"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/strictyaml"
+)
+
+// EnvPath names the environment variable holding the default config path.
+const EnvPath = "TEKTON_SLSA_DEMO_CONFIG"
+
+// DefaultFile is the file name config init writes by default.
+const DefaultFile = "tekton-slsa-demo.yaml"
+
+// Config is the server configuration. Command-line flags override it.
+type Config struct {
+	Server Server `yaml:"server"`
+}
+
+// Server configures the HTTP server.
+type Server struct {
+	// Addr is the listen address.
+	Addr string `yaml:"addr"`
+	// Dev enables development mode.
+	Dev bool `yaml:"dev"`
+	// WebDir is where development mode reads templates and static assets.
+	WebDir string `yaml:"webDir"`
+	// APIToken is the bearer token required to ingest attestations and to
+	// use the admin endpoints.
+	// Prefer the API_TOKEN environment variable over storing it here.
+	APIToken string `yaml:"apiToken"`
+	// MaxInFlight bounds the requests handled at once; zero disables load
+	// shedding.
+	MaxInFlight int `yaml:"maxInFlight"`
+	// MaxQueueWait is how long a request waits for a slot before it is
+	// rejected with 503.
+	MaxQueueWait time.Duration `yaml:"maxQueueWait"`
+	// Timeouts bound how long requests and the calls they make to
+	// registries and Rekor may take.
+	Timeouts Timeouts `yaml:"timeouts"`
+	// TOFUPins is the file where trust on first use pins the first signer
+	// identity verified for each repository; empty disables it.
+	TOFUPins string `yaml:"tofuPins"`
+	// Denylist is the file keeping the denied digests and signer
+	// identities; empty keeps them in memory only.
+	Denylist string `yaml:"denylist"`
+	// ReplayState is the file keeping the logged provenance of each
+	// repository's builds, which flags stale and replayed provenance;
+	// empty keeps it in memory only.
+	ReplayState string `yaml:"replayState"`
+	// SelfImage is the image the server runs from, verified every
+	// SelfVerifyInterval for the freshness gauges; empty disables it. It
+	// must be signed by SelfIdentity as issued by SelfIssuer, without
+	// which it is reported unverified.
+	SelfImage          string        `yaml:"selfImage"`
+	SelfVerifyInterval time.Duration `yaml:"selfVerifyInterval"`
+	SelfIdentity       string        `yaml:"selfIdentity"`
+	SelfIssuer         string        `yaml:"selfIssuer"`
+	// Watch lists images polled every WatchInterval for new digests, each
+	// verified once.
+	Watch         []WatchTarget `yaml:"watch"`
+	WatchInterval time.Duration `yaml:"watchInterval"`
+	// WebhookSecret authenticates registry push notifications.
+	// Prefer the WEBHOOK_SECRET environment variable over storing it here.
+	WebhookSecret string `yaml:"webhookSecret"`
+	// WebhookRepositories are the repositories whose pushes are verified,
+	// each with the identity and issuer its images must be signed by.
+	WebhookRepositories []WebhookRepository `yaml:"webhookRepositories"`
+	// FaultInjection enables /api/v1/admin/faults, which injects faults
+	// for resilience demos.
+	FaultInjection bool `yaml:"faultInjection"`
+	// Scanner scans images for vulnerabilities on demand at
+	// /api/v1/scan/{digest}: "trivy" runs the trivy binary, as a client of
+	// TrivyServer when it is set, and "osv" the embedded OSV scanner. Empty
+	// disables scanning.
+	Scanner     string `yaml:"scanner"`
+	TrivyServer string `yaml:"trivyServer"`
+	// Signer is what VSAs and the scan results stored as vulnerability
+	// attestations are signed with. ScanSigningKey is older shorthand for
+	// its key backend, used when no backend is set.
+	Signer         Signer `yaml:"signer"`
+	ScanSigningKey string `yaml:"scanSigningKey"`
+	// ArtifactSources are the URL prefixes /artifacts/{digest} downloads
+	// attested artifacts from, and ArtifactKeys the public keys whose
+	// attestations name artifacts it may download; either empty disables
+	// artifact downloads.
+	ArtifactSources []string `yaml:"artifactSources"`
+	ArtifactKeys    []string `yaml:"artifactKeys"`
+	// OIDC is the provider administrators sign in to the admin dashboard
+	// with; Admins are who may, by email address or OIDC subject, for
+	// sessions of SessionTTL. No issuer disables the dashboard.
+	OIDC       OIDC          `yaml:"oidc"`
+	Admins     []string      `yaml:"admins"`
+	SessionTTL time.Duration `yaml:"sessionTTL"`
+	// ShardDir is a directory shared by the replicas of the server, where
+	// each keeps a lease to split the watch list's verifications with the
+	// others by digest; empty verifies every digest. ReplicaID names this
+	// replica, the host name when empty.
+	ShardDir  string `yaml:"shardDir"`
+	ReplicaID string `yaml:"replicaID"`
+}
+
+// Timeouts are deadlines; zero disables one.
+type Timeouts struct {
+	// Request bounds handling a request, including the verifications it
+	// starts, which are abandoned when it passes. Downloads are exempt.
+	Request time.Duration `yaml:"request"`
+	// Registry and Rekor bound each call to a registry or to Rekor.
+	Registry time.Duration `yaml:"registry"`
+	Rekor    time.Duration `yaml:"rekor"`
+}
+
+// Signer selects and configures a signing backend.
+type Signer struct {
+	// Backend is key, kms, keyless or spiffe; empty disables signing.
+	Backend string `yaml:"backend"`
+	// Key is the private key file of the key backend.
+	Key string `yaml:"key"`
+	// KMS is the key of the kms backend, such as hashivault://release.
+	KMS string `yaml:"kms"`
+	// FulcioURL is the certificate authority of the keyless backend, which
+	// takes its OIDC token from $SIGSTORE_ID_TOKEN.
+	FulcioURL string `yaml:"fulcioURL"`
+	// SVIDDir is where the SPIFFE helper writes the spiffe backend's SVID.
+	SVIDDir string `yaml:"svidDir"`
+}
+
+// OIDC is an OpenID Connect client registration.
+type OIDC struct {
+	Issuer   string `yaml:"issuer"`
+	ClientID string `yaml:"clientID"`
+	// ClientSecret is empty for public clients, which rely on PKCE alone.
+	// Prefer the OIDC_CLIENT_SECRET environment variable over storing it
+	// here.
+	ClientSecret string `yaml:"clientSecret"`
+	// RedirectURL is the server's /auth/callback URL as browsers reach it.
+	RedirectURL string `yaml:"redirectURL"`
+}
+
+// WebhookRepository is a repository registry push notifications are
+// verified for.
+type WebhookRepository struct {
+	Repository string `yaml:"repository"`
+	// Identity and Issuer are required; RequireTlog and the signature
+	// Annotations are what pushed digests must satisfy too.
+	Identity    string            `yaml:"identity"`
+	Issuer      string            `yaml:"issuer"`
+	RequireTlog bool              `yaml:"requireTlog"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// WatchTarget is an image on the watch list.
+type WatchTarget struct {
+	// Image is the tag to watch, or the repository when Tags is set.
+	Image string `yaml:"image"`
+	// Tags is a pattern such as "v*" selecting the repository's tags.
+	Tags string `yaml:"tags"`
+	// Identity, Issuer, RequireTlog and the signature Annotations are what
+	// new digests must satisfy.
+	Identity    string            `yaml:"identity"`
+	Issuer      string            `yaml:"issuer"`
+	RequireTlog bool              `yaml:"requireTlog"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// Default returns the built-in configuration. The PORT environment
+// variable sets the default listen port.
+func Default(e env.Env) *Config {
+	addr := ":8080"
+	if port := e.Getenv("PORT"); port != "" {
+		addr = ":" + port
+	}
+	return &Config{
+		Server: Server{
+			Addr:               addr,
+			WebDir:             "internal/server/web",
+			MaxInFlight:        64,
+			MaxQueueWait:       time.Second,
+			SelfVerifyInterval: 5 * time.Minute,
+			Watch:              []WatchTarget{},
+			WatchInterval:      5 * time.Minute,
+			ArtifactSources:    []string{},
+			ArtifactKeys:       []string{},
+			Admins:             []string{},
+			SessionTTL:         8 * time.Hour,
+			Signer:             Signer{FulcioURL: signing.DefaultFulcioURL},
+			Timeouts: Timeouts{
+				Request:  time.Minute,
+				Registry: oci.DefaultTimeout,
+				Rekor:    rekor.DefaultTimeout,
+			},
+			WebhookRepositories: []WebhookRepository{},
+		},
+	}
+}
+
+// Load reads the YAML or JSON config file at path over a copy of defaults.
+// Unknown keys and mistyped values are rejected with their position so
+// typos do not silently fall back to defaults.
+func Load(path string, defaults *Config) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := *defaults
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		return &cfg, nil
+	}
+	if err := strictyaml.Check(&doc, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := doc.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// redacted replaces secrets that are set in Redacted.
+const redacted = "<redacted>"
+
+// Redacted returns a copy of c with its secrets replaced by a marker, so it
+// can be logged. Unset secrets stay empty.
+func (c *Config) Redacted() *Config {
+	r := *c
+	for _, secret := range []*string{&r.Server.APIToken, &r.Server.WebhookSecret, &r.Server.OIDC.ClientSecret} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	return &r
+}
+
+// Fingerprint hashes the configuration into "sha256:<hex>". Replicas
+// configured alike share a fingerprint whatever the order of the keys in
+// their config files, whether options came from flags or their replica
+// IDs. Secrets only count as set or unset, so that the fingerprint can be
+// published.
+func (c *Config) Fingerprint() string {
+	r := c.Redacted()
+	r.Server.ReplicaID = ""
+	// Maps are marshalled with sorted keys, so the encoding is canonical.
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		panic(fmt.Sprintf("config: marshalling %T: %v", c, err))
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+//go:embed starter.yaml
+var starter []byte
+
+// Starter returns a commented config file listing every option with its
+// default value.
+func Starter() []byte {
+	return append([]byte(nil), starter...)
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/env"
+)
+
+func writeConfig(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestStarterMatchesDefaults(t *testing.T) {
+	defaults := Default(env.Map{})
+	cfg, err := Load(writeConfig(t, Starter()), defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, defaults) {
+		t.Errorf("starter config = %+v, want the defaults %+v", cfg, defaults)
+	}
+	if got := Default(env.Map{"PORT": "9090"}).Server.Addr; got != ":9090" {
+		t.Errorf("default addr with PORT=9090 is %q", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := Load(writeConfig(t, []byte("server:\n  addr: 127.0.0.1:9000\n  dev: true\n")), Default(env.Map{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != "127.0.0.1:9000" || !cfg.Server.Dev || cfg.Server.WebDir != "internal/server/web" {
+		t.Errorf("Load = %+v", cfg.Server)
+	}
+	if _, err := Load(writeConfig(t, []byte("server:\n  adr: :9000\n")), Default(env.Map{})); err == nil || !strings.Contains(err.Error(), `line 2, column 3: server: unknown field "adr"`) {
+		t.Errorf("Load(unknown key) = %v", err)
+	}
+	if _, err := Load(writeConfig(t, []byte("server:\n  watch:\n    - image: app\n      requireTlog: sometimes\n")), Default(env.Map{})); err == nil || !strings.Contains(err.Error(), "line 4, column 20: server.watch[0].requireTlog: expected a boolean") {
+		t.Errorf("Load(mistyped value) = %v", err)
+	}
+	cfg, err = Load(writeConfig(t, []byte(`{"server": {"addr": ":9001", "watchInterval": "1m"}}`)), Default(env.Map{}))
+	if err != nil || cfg.Server.Addr != ":9001" || cfg.Server.WatchInterval != time.Minute {
+		t.Errorf("Load(JSON) = %+v, %v", cfg, err)
+	}
+	if _, err := Load(writeConfig(t, nil), Default(env.Map{})); err != nil {
+		t.Errorf("Load(empty file) = %v", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	defaults := Default(env.Map{})
+	fp := defaults.Fingerprint()
+	if !strings.HasPrefix(fp, "sha256:") || len(fp) != len("sha256:")+64 {
+		t.Fatalf("Fingerprint = %q", fp)
+	}
+	// Flags and config files setting the same options agree, whatever the
+	// order of the keys.
+	a, err := Load(writeConfig(t, []byte("server:\n  addr: :9000\n  admins: [alice@example.com]\n")), defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := *defaults
+	b.Server.Admins = []string{"alice@example.com"}
+	b.Server.Addr = ":9000"
+	b.Server.ReplicaID = "replica-1"
+	if a.Fingerprint() != b.Fingerprint() || a.Fingerprint() == fp {
+		t.Errorf("fingerprints %s and %s, defaults %s", a.Fingerprint(), b.Fingerprint(), fp)
+	}
+
+	// Secrets count as set or unset, and are not changed in place.
+	b.Server.APIToken = "s3cret"
+	withToken := b.Fingerprint()
+	b.Server.APIToken = "other"
+	if b.Fingerprint() != withToken || withToken == a.Fingerprint() {
+		t.Error("Fingerprint depends on the API token's value, or not on whether it is set")
+	}
+	if r := b.Redacted(); r.Server.APIToken != "<redacted>" || r.Server.WebhookSecret != "" || b.Server.APIToken != "other" {
+		t.Errorf("Redacted = %+v", r.Server)
+	}
+}
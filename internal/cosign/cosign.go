@@ -0,0 +1,208 @@
+// Package cosign reads the signatures and attestations cosign and Tekton
+// Chains attach to images using cosign's tag-based OCI layout.
+package cosign
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+)
+
+// Annotation keys cosign sets on signature and attestation layers.
+const (
+	AnnotationSignature     = "dev.cosignproject.cosign/signature"
+	AnnotationCertificate   = "dev.sigstore.cosign/certificate"
+	AnnotationChain         = "dev.sigstore.cosign/chain"
+	AnnotationBundle        = "dev.sigstore.cosign/bundle"
+	AnnotationPredicateType = "predicateType"
+
+	MediaTypeDSSE          = "application/vnd.dsse.envelope.v1+json"
+	MediaTypeSimpleSigning = "application/vnd.dev.cosign.simplesigning.v1+json"
+)
+
+// maxLayerSize bounds signature and attestation layer reads.
+const maxLayerSize = 16 << 20
+
+// Attestation is one attestation layer attached to an image.
+type Attestation struct {
+	Envelope *dsse.Envelope
+	Raw      []byte
+	// Certificate and Chain hold PEM certificates for keyless signatures.
+	Certificate string
+	Chain       string
+	// Bundle is the Rekor bundle annotation, if any.
+	Bundle        string
+	PredicateType string
+}
+
+// Tag returns the tag cosign uses for artifacts of kind ("sig", "att",
+// "sbom") attached to digest.
+func Tag(digest, kind string) string {
+	return strings.Replace(digest, ":", "-", 1) + "." + kind
+}
+
+// Attestations fetches every attestation attached to the image at ref,
+// which must already be pinned by digest. An image with no attestations
+// returns an empty slice and no error.
+func Attestations(ctx context.Context, c oci.RegistryClient, ref oci.Reference) ([]Attestation, error) {
+	if ref.Digest == "" {
+		return nil, errors.New("cosign: reference must be pinned by digest")
+	}
+	attRef := ref.WithTag(Tag(ref.Digest, "att"))
+	m, _, _, err := c.GetManifest(ctx, attRef)
+	if errors.Is(err, oci.ErrNotFound) {
+		return []Attestation{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	atts := make([]Attestation, 0, len(m.Layers))
+	for _, layer := range m.Layers {
+		if layer.MediaType != MediaTypeDSSE {
+			continue
+		}
+		raw, err := c.GetBlob(ctx, attRef, layer.Digest, maxLayerSize)
+		if err != nil {
+			return nil, err
+		}
+		env, err := dsse.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("cosign: layer %s: %w", layer.Digest, err)
+		}
+		atts = append(atts, Attestation{
+			Envelope:      env,
+			Raw:           raw,
+			Certificate:   layer.Annotations[AnnotationCertificate],
+			Chain:         layer.Annotations[AnnotationChain],
+			Bundle:        layer.Annotations[AnnotationBundle],
+			PredicateType: layer.Annotations[AnnotationPredicateType],
+		})
+	}
+	return atts, nil
+}
+
+// Attach appends envelope as an attestation layer on the image at ref,
+// which must be pinned by digest, preserving any attestations already
+// attached. Extra annotations, such as a keyless certificate, are recorded
+// on the new layer.
+func Attach(ctx context.Context, c *oci.Client, ref oci.Reference, envelope []byte, predicateType string, annotations map[string]string) error {
+	if ref.Digest == "" {
+		return errors.New("cosign: reference must be pinned by digest")
+	}
+	attRef := ref.WithTag(Tag(ref.Digest, "att"))
+
+	var layers []oci.Descriptor
+	existing, _, _, err := c.GetManifest(ctx, attRef)
+	switch {
+	case err == nil:
+		layers = existing.Layers
+	case !errors.Is(err, oci.ErrNotFound):
+		return err
+	}
+
+	layer, err := c.PutBlob(ctx, attRef, MediaTypeDSSE, envelope)
+	if err != nil {
+		return fmt.Errorf("uploading attestation: %w", err)
+	}
+	layer.Annotations = map[string]string{AnnotationPredicateType: predicateType}
+	for k, v := range annotations {
+		layer.Annotations[k] = v
+	}
+	layers = append(layers, layer)
+
+	config, err := json.Marshal(imageConfig(layers))
+	if err != nil {
+		return err
+	}
+	configDesc, err := c.PutBlob(ctx, attRef, "application/vnd.oci.image.config.v1+json", config)
+	if err != nil {
+		return fmt.Errorf("uploading config: %w", err)
+	}
+
+	_, err = c.PutManifest(ctx, attRef, &oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeOCIManifest,
+		Config:        &configDesc,
+		Layers:        layers,
+	})
+	return err
+}
+
+// imageConfig is the minimal config cosign writes for its artifact images.
+func imageConfig(layers []oci.Descriptor) map[string]any {
+	diffIDs := make([]string, len(layers))
+	for i, l := range layers {
+		diffIDs[i] = l.Digest
+	}
+	return map[string]any{
+		"architecture": "",
+		"os":           "",
+		"config":       map[string]any{},
+		"rootfs":       map[string]any{"type": "layers", "diff_ids": diffIDs},
+	}
+}
+
+// Signature is one cosign image signature: a simple signing payload and a
+// detached signature over it.
+type Signature struct {
+	Payload     []byte
+	Signature   string
+	Certificate string
+	Chain       string
+	Bundle      string
+}
+
+// SimpleSigning is the payload cosign signs for image signatures.
+type SimpleSigning struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]any `json:"optional"`
+}
+
+// Signatures fetches every signature attached to the image at ref, which
+// must already be pinned by digest.
+func Signatures(ctx context.Context, c oci.RegistryClient, ref oci.Reference) ([]Signature, error) {
+	if ref.Digest == "" {
+		return nil, errors.New("cosign: reference must be pinned by digest")
+	}
+	sigRef := ref.WithTag(Tag(ref.Digest, "sig"))
+	m, _, _, err := c.GetManifest(ctx, sigRef)
+	if errors.Is(err, oci.ErrNotFound) {
+		return []Signature{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sigs := make([]Signature, 0, len(m.Layers))
+	for _, layer := range m.Layers {
+		if layer.MediaType != MediaTypeSimpleSigning {
+			continue
+		}
+		payload, err := c.GetBlob(ctx, sigRef, layer.Digest, maxLayerSize)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, Signature{
+			Payload:     payload,
+			Signature:   layer.Annotations[AnnotationSignature],
+			Certificate: layer.Annotations[AnnotationCertificate],
+			Chain:       layer.Annotations[AnnotationChain],
+			Bundle:      layer.Annotations[AnnotationBundle],
+		})
+	}
+	return sigs, nil
+}
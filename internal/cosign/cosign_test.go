@@ -0,0 +1,108 @@
+package cosign
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+)
+
+// memRegistry is a minimal in-memory OCI registry for one repository.
+type memRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+}
+
+func (m *memRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/v2/app")
+	switch {
+	case strings.HasPrefix(path, "/blobs/uploads/") && r.Method == http.MethodPost:
+		w.Header().Set("Location", "/v2/app/blobs/uploads/1")
+		w.WriteHeader(http.StatusAccepted)
+	case strings.HasPrefix(path, "/blobs/uploads/") && r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		m.blobs[r.URL.Query().Get("digest")] = data
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(path, "/blobs/"):
+		data, ok := m.blobs[strings.TrimPrefix(path, "/blobs/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	case strings.HasPrefix(path, "/manifests/") && r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		m.manifests[strings.TrimPrefix(path, "/manifests/")] = data
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(path, "/manifests/"):
+		data, ok := m.manifests[strings.TrimPrefix(path, "/manifests/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		sum := sha256.Sum256(data)
+		w.Header().Set("Content-Type", oci.MediaTypeOCIManifest)
+		w.Header().Set("Docker-Content-Digest", "sha256:"+hex.EncodeToString(sum[:]))
+		w.Write(data)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestAttachAndFetch(t *testing.T) {
+	reg := &memRegistry{blobs: map[string][]byte{}, manifests: map[string][]byte{}}
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+
+	ref, err := oci.ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/app@sha256:1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &oci.Client{HTTP: srv.Client(), Insecure: true}
+	ctx := context.Background()
+
+	atts, err := Attestations(ctx, client, ref)
+	if err != nil || len(atts) != 0 {
+		t.Fatalf("Attestations() on a bare image = %v, %v", atts, err)
+	}
+
+	for _, payload := range []string{"first", "second"} {
+		env, _ := dsse.Sign("text/plain", []byte(payload))
+		data, _ := json.Marshal(env)
+		if err := Attach(ctx, client, ref, data, "https://example.com/"+payload, nil); err != nil {
+			t.Fatalf("Attach(%s) error: %v", payload, err)
+		}
+	}
+
+	atts, err = Attestations(ctx, client, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(atts) != 2 {
+		t.Fatalf("got %d attestations, want 2", len(atts))
+	}
+	if atts[1].PredicateType != "https://example.com/second" {
+		t.Errorf("second predicateType = %q", atts[1].PredicateType)
+	}
+	if p, _ := atts[0].Envelope.DecodePayload(); string(p) != "first" {
+		t.Errorf("first payload = %q", p)
+	}
+}
+
+func TestTag(t *testing.T) {
+	if got := Tag("sha256:abcd", "att"); got != "sha256-abcd.att" {
+		t.Errorf("Tag() = %q", got)
+	}
+}
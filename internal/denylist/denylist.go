@@ -0,0 +1,217 @@
+// Package denylist quarantines image digests and signer identities. An
+// image on the list, or signed by an identity on it, fails verification
+// whatever its signatures say, until an administrator removes the entry.
+package denylist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/digest"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/fsutil"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// Kinds of Entry.
+const (
+	KindDigest   = "digest"
+	KindIdentity = "identity"
+)
+
+// Entry is a denied digest or signer identity.
+type Entry struct {
+	ID string `json:"id"`
+	// Kind is KindDigest or KindIdentity.
+	Kind string `json:"kind"`
+	// Value is an image digest in canonical "alg:hex" form, or a signer
+	// identity as verification reports it: a certificate's subject
+	// alternative name.
+	Value   string    `json:"value"`
+	Reason  string    `json:"reason,omitempty"`
+	AddedAt time.Time `json:"addedAt"`
+}
+
+// Errors returned by List.
+var (
+	ErrUnknownEntry = errors.New("denylist entry not found")
+	ErrInvalidEntry = errors.New("invalid denylist entry")
+)
+
+// List is the denylist, safe for concurrent use. A list opened from a file
+// saves every change back to it.
+type List struct {
+	path string
+
+	mu      sync.Mutex
+	entries []Entry
+	nextID  int
+}
+
+// New returns an empty list kept in memory only.
+func New() *List {
+	return &List{nextID: 1}
+}
+
+// Open reads the denylist file at path. A missing file is an empty list.
+func Open(path string) (*List, error) {
+	l := New()
+	l.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &l.entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, e := range l.entries {
+		if n, err := strconv.Atoi(e.ID); err == nil && n >= l.nextID {
+			l.nextID = n + 1
+		}
+	}
+	return l, nil
+}
+
+// Add denies e.Value, returning the stored entry. Digests are stored in
+// canonical form. Adding a value already on the list returns the existing
+// entry.
+func (l *List) Add(e Entry, now time.Time) (Entry, error) {
+	e.Value = strings.TrimSpace(e.Value)
+	switch {
+	case e.Kind != KindDigest && e.Kind != KindIdentity:
+		return Entry{}, fmt.Errorf("%w: kind must be %q or %q", ErrInvalidEntry, KindDigest, KindIdentity)
+	case e.Value == "":
+		return Entry{}, fmt.Errorf("%w: value is required", ErrInvalidEntry)
+	case e.Kind == KindDigest:
+		if _, _, err := digest.Parse(e.Value); err != nil {
+			return Entry{}, fmt.Errorf("%w: %v", ErrInvalidEntry, err)
+		}
+		e.Value = digest.Canonical(e.Value)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, existing := range l.entries {
+		if existing.Kind == e.Kind && existing.Value == e.Value {
+			return existing, nil
+		}
+	}
+	e.ID = strconv.Itoa(l.nextID)
+	e.AddedAt = now.UTC()
+	l.nextID++
+	l.entries = append(l.entries, e)
+	return e, l.save()
+}
+
+// Remove deletes the entry with the given ID.
+func (l *List) Remove(id string) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, e := range l.entries {
+		if e.ID == id {
+			l.entries = append(l.entries[:i], l.entries[i+1:]...)
+			return e, l.save()
+		}
+	}
+	return Entry{}, ErrUnknownEntry
+}
+
+// Entries returns the list in the order entries were added.
+func (l *List) Entries() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Entry{}, l.entries...)
+}
+
+// Apply fails res when its digest, compared in canonical form, or the
+// signer of any of its checks is denied. It returns res unchanged when
+// nothing matches, or else a copy with Verified false and every denied
+// check failed with the reason, along with the matching entries. A denied
+// digest fails the copy with POLICY_DENIED, a denied signer with
+// IDENTITY_REJECTED.
+func (l *List) Apply(res *verify.Result) (*verify.Result, []Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var matched []Entry
+	var digestDenied *Entry
+	signers := map[string]*Entry{}
+	d := digest.Canonical(res.Digest)
+	for i, e := range l.entries {
+		switch {
+		case e.Kind == KindDigest && digest.Canonical(e.Value) == d:
+			digestDenied = &l.entries[i]
+			matched = append(matched, e)
+		case e.Kind == KindIdentity:
+			for _, c := range res.Checks {
+				if c.Signer == e.Value && signers[e.Value] == nil {
+					signers[e.Value] = &l.entries[i]
+					matched = append(matched, e)
+				}
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return res, nil
+	}
+
+	denied := *res
+	denied.Verified = false
+	denied.Checks = make([]verify.Check, len(res.Checks))
+	for i, c := range res.Checks {
+		e := digestDenied
+		if e == nil {
+			e = signers[c.Signer]
+		}
+		if e != nil {
+			c.Verified = false
+			c.Error = e.describe()
+			c.Code = e.code()
+		}
+		denied.Checks[i] = c
+	}
+	denied.Code = failure.IdentityRejected
+	if digestDenied != nil {
+		denied.Code = failure.PolicyDenied
+	}
+	return &denied, matched
+}
+
+// describe says why an entry fails verification.
+func (e *Entry) describe() string {
+	s := fmt.Sprintf("%s %s is on the denylist", e.Kind, e.Value)
+	if e.Reason != "" {
+		s += ": " + e.Reason
+	}
+	return s
+}
+
+// code classifies the failures an entry causes.
+func (e *Entry) code() failure.Code {
+	if e.Kind == KindDigest {
+		return failure.PolicyDenied
+	}
+	return failure.IdentityRejected
+}
+
+// save writes the list to its file, replacing it atomically. l.mu must be
+// held.
+func (l *List) save() error {
+	if l.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(l.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(l.path, append(data, '\n'))
+}
@@ -0,0 +1,89 @@
+package denylist
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+var (
+	badDigest  = "sha256:" + strings.Repeat("ba", 32)
+	goodDigest = "sha256:" + strings.Repeat("60", 32)
+)
+
+func TestList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denylist.json")
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Digests are stored in canonical form.
+	digest, err := l.Add(Entry{Kind: KindDigest, Value: strings.ToUpper(badDigest), Reason: "CVE-2024-3094"}, now)
+	if err != nil || digest.Value != badDigest {
+		t.Fatalf("Add(digest) = %+v, %v", digest, err)
+	}
+	if again, _ := l.Add(Entry{Kind: KindDigest, Value: badDigest}, now); again.ID != digest.ID || again.Reason != "CVE-2024-3094" {
+		t.Errorf("adding a denied digest again = %+v, want the existing entry", again)
+	}
+	invalid := []Entry{
+		{Kind: "tag", Value: "v1"},
+		{Kind: KindIdentity},
+		{Kind: KindDigest, Value: "bad"},
+		{Kind: KindDigest, Value: "sha256:bad"},
+		{Kind: KindDigest, Value: "sha256:" + strings.Repeat("zz", 32)},
+	}
+	for _, e := range invalid {
+		if _, err := l.Add(e, now); !errors.Is(err, ErrInvalidEntry) {
+			t.Errorf("Add(%+v) = %v", e, err)
+		}
+	}
+
+	// The list survives a restart, and IDs are not reused.
+	if l, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	mallory, err := l.Add(Entry{Kind: KindIdentity, Value: "mallory@example.com"}, now)
+	if err != nil || mallory.ID != "2" {
+		t.Fatalf("Add(identity) = %+v, %v", mallory, err)
+	}
+	if entries := l.Entries(); len(entries) != 2 || entries[0].Value != badDigest {
+		t.Errorf("Entries() = %+v", entries)
+	}
+
+	good := verify.Check{Kind: verify.KindSignature, Signer: "release@example.com", Verified: true}
+	bad := verify.Check{Kind: verify.KindAttestation, Signer: "mallory@example.com", Verified: true}
+	clean := &verify.Result{Digest: goodDigest, Checks: []verify.Check{good}, Verified: true}
+	if res, matched := l.Apply(clean); res != clean || matched != nil {
+		t.Errorf("Apply(clean) = %+v, %+v", res, matched)
+	}
+
+	signed := &verify.Result{Digest: goodDigest, Checks: []verify.Check{good, bad}, Verified: true}
+	res, matched := l.Apply(signed)
+	if res.Verified || !res.Checks[0].Verified || res.Checks[1].Verified || len(matched) != 1 || matched[0].ID != mallory.ID || res.Code != failure.IdentityRejected {
+		t.Errorf("Apply(signed by a denied identity) = %+v, %+v", res, matched)
+	}
+	if !signed.Verified || !signed.Checks[1].Verified {
+		t.Error("Apply modified its argument")
+	}
+
+	res, _ = l.Apply(&verify.Result{Digest: "SHA256:" + strings.ToUpper(strings.TrimPrefix(badDigest, "sha256:")), Checks: []verify.Check{good}, Verified: true})
+	if res.Verified || res.Checks[0].Verified || !strings.Contains(res.Checks[0].Error, "CVE-2024-3094") || res.Code != failure.PolicyDenied || res.Checks[0].Code != failure.PolicyDenied {
+		t.Errorf("Apply(denied digest) = %+v", res)
+	}
+
+	if _, err := l.Remove(digest.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Remove(digest.ID); !errors.Is(err, ErrUnknownEntry) {
+		t.Errorf("removing twice: %v", err)
+	}
+	if l, _ = Open(path); len(l.Entries()) != 1 {
+		t.Errorf("after removal the file holds %+v", l.Entries())
+	}
+}
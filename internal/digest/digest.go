@@ -0,0 +1,157 @@
+// Package digest computes and compares digests in the algorithms in-toto
+// subjects and OCI references use, so that callers do not assume sha256.
+// Algorithm names follow the in-toto digest set: "sha256", "sha512",
+// "sha3_256" and so on. Names are case-insensitive and accept "-" for "_",
+// so "SHA3-256" is sha3_256.
+package digest
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Common are the algorithms the digest calculator reports, those subjects
+// use most.
+var Common = []string{"sha256", "sha512", "sha3_256", "sha3_512"}
+
+// algorithms maps each supported algorithm to its hash constructor.
+var algorithms = map[string]func() hash.Hash{
+	"sha224":     sha256.New224,
+	"sha256":     sha256.New,
+	"sha384":     sha512.New384,
+	"sha512":     sha512.New,
+	"sha512_224": sha512.New512_224,
+	"sha512_256": sha512.New512_256,
+	"sha3_224":   sha3.New224,
+	"sha3_256":   sha3.New256,
+	"sha3_384":   sha3.New384,
+	"sha3_512":   sha3.New512,
+}
+
+// ErrMismatch is returned when content does not match its digest.
+var ErrMismatch = errors.New("digest mismatch")
+
+// Normalize returns the canonical name of an algorithm.
+func Normalize(alg string) string {
+	return strings.ReplaceAll(strings.ToLower(alg), "-", "_")
+}
+
+// Supported reports whether alg can be computed.
+func Supported(alg string) bool {
+	_, ok := algorithms[Normalize(alg)]
+	return ok
+}
+
+// Algorithms returns the supported algorithms, sorted.
+func Algorithms() []string {
+	algs := make([]string, 0, len(algorithms))
+	for alg := range algorithms {
+		algs = append(algs, alg)
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+// New returns a hash computing alg.
+func New(alg string) (hash.Hash, error) {
+	newHash, ok := algorithms[Normalize(alg)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported digest algorithm %q", alg)
+	}
+	return newHash(), nil
+}
+
+// Parse splits a digest in "alg:hex" form into its canonical algorithm
+// and lower-case hex value, checking the value's length for supported
+// algorithms.
+func Parse(d string) (alg, value string, err error) {
+	alg, value, ok := strings.Cut(d, ":")
+	if !ok || alg == "" || value == "" {
+		return "", "", fmt.Errorf("digest %q is not in alg:hex form", d)
+	}
+	alg, value = Normalize(alg), strings.ToLower(value)
+	if _, err := hex.DecodeString(value); err != nil {
+		return "", "", fmt.Errorf("digest %q is not hex", d)
+	}
+	if newHash, ok := algorithms[alg]; ok && len(value) != 2*newHash().Size() {
+		return "", "", fmt.Errorf("digest %q has the wrong length for %s", d, alg)
+	}
+	return alg, value, nil
+}
+
+// Canonical returns d with its algorithm normalized and its value in lower
+// case, or d unchanged when it is not in alg:hex form.
+func Canonical(d string) string {
+	alg, value, ok := strings.Cut(d, ":")
+	if !ok {
+		return d
+	}
+	return Normalize(alg) + ":" + strings.ToLower(value)
+}
+
+// Compute reads r to the end and returns its digest in each of algs, keyed
+// by canonical name, and its size.
+func Compute(r io.Reader, algs ...string) (map[string]string, int64, error) {
+	hashes := make(map[string]hash.Hash, len(algs))
+	writers := make([]io.Writer, 0, len(algs))
+	for _, alg := range algs {
+		h, err := New(alg)
+		if err != nil {
+			return nil, 0, err
+		}
+		hashes[Normalize(alg)] = h
+		writers = append(writers, h)
+	}
+	n, err := io.Copy(io.MultiWriter(writers...), r)
+	if err != nil {
+		return nil, n, err
+	}
+	sums := make(map[string]string, len(hashes))
+	for alg, h := range hashes {
+		sums[alg] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums, n, nil
+}
+
+// Verify checks that data has digest d ("alg:hex"). It wraps ErrMismatch
+// when it does not.
+func Verify(d string, data []byte) error {
+	alg, value, err := Parse(d)
+	if err != nil {
+		return err
+	}
+	h, err := New(alg)
+	if err != nil {
+		return err
+	}
+	h.Write(data)
+	if got := hex.EncodeToString(h.Sum(nil)); got != value {
+		return fmt.Errorf("%w: content is %s:%s, not %s", ErrMismatch, alg, got, d)
+	}
+	return nil
+}
+
+// InSet reports whether the digest set of an in-toto subject carries d
+// ("alg:hex"), comparing algorithm names and values case-insensitively.
+func InSet(set map[string]string, d string) bool {
+	alg, value, ok := strings.Cut(d, ":")
+	if !ok {
+		return false
+	}
+	alg = Normalize(alg)
+	for k, v := range set {
+		if Normalize(k) == alg && strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
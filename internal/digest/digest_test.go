@@ -0,0 +1,60 @@
+package digest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Digests of "abc" from FIPS 180-4 and FIPS 202.
+const (
+	abcSHA256   = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	abcSHA512   = "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"
+	abcSHA3_256 = "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532"
+)
+
+func TestCompute(t *testing.T) {
+	sums, n, err := Compute(strings.NewReader("abc"), "sha256", "SHA512", "sha3-256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || sums["sha256"] != abcSHA256 || sums["sha512"] != abcSHA512 || sums["sha3_256"] != abcSHA3_256 {
+		t.Errorf("Compute() = %v, %d", sums, n)
+	}
+	if _, _, err := Compute(strings.NewReader("abc"), "md5"); err == nil {
+		t.Error("computed an unsupported algorithm")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	for _, d := range []string{"sha256:" + abcSHA256, "sha512:" + strings.ToUpper(abcSHA512), "sha3-256:" + abcSHA3_256} {
+		if err := Verify(d, []byte("abc")); err != nil {
+			t.Errorf("Verify(%s): %v", d, err)
+		}
+	}
+	if err := Verify("sha256:"+abcSHA256, []byte("abd")); !errors.Is(err, ErrMismatch) {
+		t.Errorf("different content: %v", err)
+	}
+	for _, d := range []string{"sha256", "sha256:xyz", "sha512:" + abcSHA256, "blake3:" + abcSHA256} {
+		if err := Verify(d, []byte("abc")); err == nil || errors.Is(err, ErrMismatch) {
+			t.Errorf("Verify(%s) = %v, want an invalid digest", d, err)
+		}
+	}
+}
+
+func TestInSet(t *testing.T) {
+	set := map[string]string{"SHA3_256": strings.ToUpper(abcSHA3_256), "sha512": abcSHA512}
+	for d, want := range map[string]bool{
+		"sha3-256:" + abcSHA3_256: true,
+		"sha512:" + abcSHA512:     true,
+		"sha256:" + abcSHA256:     false,
+		abcSHA512:                 false,
+	} {
+		if got := InSet(set, d); got != want {
+			t.Errorf("InSet(%s) = %v, want %v", d, got, want)
+		}
+	}
+	if got := Canonical("SHA3-256:ABC"); got != "sha3_256:abc" {
+		t.Errorf("Canonical() = %s", got)
+	}
+}
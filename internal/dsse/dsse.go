@@ -0,0 +1,165 @@
+// Package dsse implements the Dead Simple Signing Envelope used by in-toto
+// attestations and Tekton Chains.
+package dsse
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Envelope is a DSSE envelope as written by Chains and cosign.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+// Signature is a single signature over the envelope's PAE encoding.
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+	// Cert is the PEM signing certificate, which keyless signers may
+	// record alongside the signature.
+	Cert string `json:"cert,omitempty"`
+}
+
+// Signer produces raw signatures over the PAE encoding.
+type Signer interface {
+	KeyID() string
+	Sign(data []byte) ([]byte, error)
+}
+
+// Verifier checks raw signatures over the PAE encoding.
+type Verifier interface {
+	KeyID() string
+	Verify(data, sig []byte) error
+}
+
+// ErrNoSignatures is returned when verifying an envelope that carries no
+// signatures at all.
+var ErrNoSignatures = errors.New("dsse: envelope has no signatures")
+
+// PAE returns the pre-authentication encoding of payloadType and payload.
+func PAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// Sign wraps payload in an envelope signed by each of signers. With no
+// signers the envelope is returned unsigned.
+func Sign(payloadType string, payload []byte, signers ...Signer) (*Envelope, error) {
+	env := &Envelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []Signature{},
+	}
+	pae := PAE(payloadType, payload)
+	for _, s := range signers {
+		sig, err := s.Sign(pae)
+		if err != nil {
+			return nil, fmt.Errorf("dsse: signing: %w", err)
+		}
+		env.Signatures = append(env.Signatures, Signature{
+			KeyID: s.KeyID(),
+			Sig:   base64.StdEncoding.EncodeToString(sig),
+		})
+	}
+	return env, nil
+}
+
+// Parse decodes a JSON envelope and checks that it is structurally valid.
+func Parse(data []byte) (*Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("dsse: decoding envelope: %w", err)
+	}
+	if err := env.Validate(); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+// Validate reports structural problems with the envelope.
+func (e *Envelope) Validate() error {
+	if e.PayloadType == "" {
+		return errors.New("dsse: missing payloadType")
+	}
+	if e.Payload == "" {
+		return errors.New("dsse: missing payload")
+	}
+	if _, err := e.DecodePayload(); err != nil {
+		return err
+	}
+	for i, s := range e.Signatures {
+		if _, err := decodeBase64(s.Sig); err != nil {
+			return fmt.Errorf("dsse: signature %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// DecodePayload returns the raw payload bytes.
+func (e *Envelope) DecodePayload() ([]byte, error) {
+	b, err := decodeBase64(e.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("dsse: payload: %w", err)
+	}
+	return b, nil
+}
+
+// Verify checks that at least one signature on the envelope is valid for
+// one of verifiers, returning the key ID of the first accepted verifier.
+// Verifiers with a key ID only check signatures carrying the same key ID or
+// none at all.
+func (e *Envelope) Verify(verifiers ...Verifier) (string, error) {
+	if len(e.Signatures) == 0 {
+		return "", ErrNoSignatures
+	}
+	payload, err := e.DecodePayload()
+	if err != nil {
+		return "", err
+	}
+	pae := PAE(e.PayloadType, payload)
+	var errs []error
+	for _, s := range e.Signatures {
+		sig, err := decodeBase64(s.Sig)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, v := range verifiers {
+			if s.KeyID != "" && v.KeyID() != "" && s.KeyID != v.KeyID() {
+				continue
+			}
+			if err := v.Verify(pae, sig); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			return v.KeyID(), nil
+		}
+	}
+	if len(errs) == 0 {
+		return "", errors.New("dsse: no verifier matched the envelope's key IDs")
+	}
+	return "", fmt.Errorf("dsse: no valid signature: %w", errors.Join(errs...))
+}
+
+// Decode returns the raw signature bytes.
+func (s Signature) Decode() ([]byte, error) {
+	return decodeBase64(s.Sig)
+}
+
+// decodeBase64 accepts both standard and URL-safe encodings, padded or not,
+// since producers disagree on which one DSSE requires.
+func decodeBase64(s string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding,
+		base64.URLEncoding, base64.RawURLEncoding,
+	} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, errors.New("invalid base64")
+}
@@ -0,0 +1,170 @@
+package dsse
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type edKey struct {
+	priv ed25519.PrivateKey
+	id   string
+}
+
+func (k edKey) KeyID() string                    { return k.id }
+func (k edKey) Sign(data []byte) ([]byte, error) { return ed25519.Sign(k.priv, data), nil }
+func (k edKey) Verify(data, sig []byte) error {
+	if !ed25519.Verify(k.priv.Public().(ed25519.PublicKey), data, sig) {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
+func newKey(t testing.TB, id string) edKey {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return edKey{priv: priv, id: id}
+}
+
+func TestPAE(t *testing.T) {
+	got := string(PAE("http://example.com/HelloWorld", []byte("hello world")))
+	want := "DSSEv1 29 http://example.com/HelloWorld 11 hello world"
+	if got != want {
+		t.Errorf("PAE() = %q, want %q", got, want)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	key := newKey(t, "k1")
+	env, err := Sign("application/vnd.in-toto+json", []byte(`{"a":1}`), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := env.Verify(key)
+	if err != nil {
+		t.Fatalf("Verify() error: %v", err)
+	}
+	if id != "k1" {
+		t.Errorf("Verify() key ID = %q, want k1", id)
+	}
+
+	if _, err := env.Verify(newKey(t, "")); err == nil {
+		t.Error("Verify() with the wrong key succeeded")
+	}
+
+	env.PayloadType = "text/plain"
+	if _, err := env.Verify(key); err == nil {
+		t.Error("Verify() succeeded after the payload type was tampered with")
+	}
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	env, err := Sign("text/plain", []byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Verify(newKey(t, "k")); !errors.Is(err, ErrNoSignatures) {
+		t.Errorf("Verify() error = %v, want ErrNoSignatures", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse([]byte(`{"payloadType":"text/plain","payload":"aGk=","signatures":[]}`)); err != nil {
+		t.Errorf("Parse() valid envelope: %v", err)
+	}
+	for _, bad := range []string{
+		`not json`,
+		`{"payload":"aGk="}`,
+		`{"payloadType":"text/plain"}`,
+		`{"payloadType":"text/plain","payload":"!!"}`,
+		`{"payloadType":"text/plain","payload":"aGk=","signatures":[{"sig":"!!"}]}`,
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("Parse(%s) succeeded, want error", bad)
+		}
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add([]byte(`{"payloadType":"application/vnd.in-toto+json","payload":"e30=","signatures":[{"keyid":"k","sig":"c2ln"}]}`))
+	f.Add([]byte(`{"payloadType":"text/plain","payload":"aGVsbG8","signatures":[]}`))
+	f.Add([]byte(`{"payloadType":"x","payload":"-_-_","signatures":[{"sig":""}]}`))
+	seeds, _ := filepath.Glob("../attestation/testdata/chains/*.json")
+	for _, path := range seeds {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	key := newKey(f, "k")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		env, err := Parse(data)
+		if err != nil {
+			return
+		}
+		payload, err := env.DecodePayload()
+		if err != nil {
+			t.Fatalf("Parse() accepted an envelope whose payload does not decode: %v", err)
+		}
+		if _, err := env.Verify(key); err == nil {
+			t.Fatal("Verify() accepted a fuzzed signature")
+		}
+
+		// A parsed envelope survives re-encoding unchanged.
+		again, err := json.Marshal(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env2, err := Parse(again)
+		if err != nil {
+			t.Fatalf("re-parsing %s: %v", again, err)
+		}
+		payload2, _ := env2.DecodePayload()
+		if !bytes.Equal(payload, payload2) || env2.PayloadType != env.PayloadType || len(env2.Signatures) != len(env.Signatures) {
+			t.Fatalf("round trip changed the envelope: %s", again)
+		}
+	})
+}
+
+func BenchmarkVerify(b *testing.B) {
+	key := newKey(b, "k")
+	for _, size := range []int{1 << 10, 64 << 10, 1 << 20} {
+		env, err := Sign("application/vnd.in-toto+json", bytes.Repeat([]byte("x"), size), key)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				if _, err := env.Verify(key); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	data, err := os.ReadFile("../attestation/testdata/chains/taskrun-slsa-v0.2.json")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
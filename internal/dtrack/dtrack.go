@@ -0,0 +1,161 @@
+// Package dtrack publishes SBOMs to a Dependency-Track server, which keeps
+// an inventory of the components of every project version and tracks the
+// vulnerabilities found in them as new advisories arrive.
+package dtrack
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/httpclient"
+)
+
+// Client talks to the Dependency-Track REST API, authenticating with an API
+// key. Uploading with AutoCreate needs a key whose team has the
+// BOM_UPLOAD and PROJECT_CREATION_UPLOAD permissions.
+type Client struct {
+	URL    string
+	APIKey string
+	HTTP   *http.Client
+}
+
+// NewClient returns a client for the Dependency-Track server at url.
+func NewClient(url, apiKey string) *Client {
+	return &Client{URL: url, APIKey: apiKey, HTTP: httpclient.Default()}
+}
+
+// Upload is a CycloneDX BOM for one version of a project.
+type Upload struct {
+	Project string
+	Version string
+	// Tags are attached to the project; Dependency-Track 4.12 and later
+	// apply them when AutoCreate creates it.
+	Tags []string
+	// AutoCreate creates the project version if it does not exist yet.
+	AutoCreate bool
+	// BOM is the CycloneDX document; Dependency-Track does not accept
+	// SPDX.
+	BOM []byte
+}
+
+// Project is a project version known to Dependency-Track.
+type Project struct {
+	UUID    string `json:"uuid"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type tag struct {
+	Name string `json:"name"`
+}
+
+type bomRequest struct {
+	ProjectName    string `json:"projectName"`
+	ProjectVersion string `json:"projectVersion"`
+	ProjectTags    []tag  `json:"projectTags,omitempty"`
+	AutoCreate     bool   `json:"autoCreate"`
+	BOM            string `json:"bom"`
+}
+
+// ErrNotFound is returned when Dependency-Track does not know the project.
+var ErrNotFound = errors.New("dtrack: not found")
+
+// UploadBOM submits u for processing and returns the token that identifies
+// the processing task.
+func (c *Client) UploadBOM(ctx context.Context, u Upload) (string, error) {
+	if u.Project == "" || u.Version == "" {
+		return "", errors.New("dtrack: a project name and version are required")
+	}
+	req := bomRequest{
+		ProjectName:    u.Project,
+		ProjectVersion: u.Version,
+		AutoCreate:     u.AutoCreate,
+		BOM:            base64.StdEncoding.EncodeToString(u.BOM),
+	}
+	for _, t := range u.Tags {
+		req.ProjectTags = append(req.ProjectTags, tag{Name: t})
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := c.do(ctx, http.MethodPut, "/api/v1/bom", req, &resp); err != nil {
+		return "", err
+	}
+	return resp.Token, nil
+}
+
+// Processing reports whether the BOM upload identified by token is still
+// being processed.
+func (c *Client) Processing(ctx context.Context, token string) (bool, error) {
+	var resp struct {
+		Processing bool `json:"processing"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/event/token/"+url.PathEscape(token), nil, &resp); err != nil {
+		return false, err
+	}
+	return resp.Processing, nil
+}
+
+// LookupProject returns the project with name and version.
+func (c *Client) LookupProject(ctx context.Context, name, version string) (*Project, error) {
+	q := url.Values{"name": {name}, "version": {version}}
+	var p Project
+	if err := c.do(ctx, http.MethodGet, "/api/v1/project/lookup?"+q.Encode(), nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ProjectURL returns the page of project p in the Dependency-Track UI,
+// which is commonly served from the same origin as the API.
+func (c *Client) ProjectURL(p *Project) string {
+	return strings.TrimSuffix(c.URL, "/") + "/projects/" + p.UUID
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body any, out any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.URL, "/")+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Api-Key", c.APIKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = httpclient.Default()
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("dtrack: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s %s", ErrNotFound, method, path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("dtrack: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("dtrack: decoding %s response: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package dtrack
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeDTrack serves the BOM upload, event token and project lookup APIs,
+// creating projects on upload when asked to.
+func fakeDTrack(t *testing.T) (*Client, map[string]bomRequest) {
+	t.Helper()
+	uploads := map[string]bomRequest{}
+	auth := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Api-Key") != "odt_key" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			h(w, r)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/bom", auth(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req bomRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !req.AutoCreate {
+			http.NotFound(w, r)
+			return
+		}
+		uploads[req.ProjectName+"@"+req.ProjectVersion] = req
+		json.NewEncoder(w).Encode(map[string]string{"token": "token-1"})
+	}))
+	mux.HandleFunc("/api/v1/event/token/token-1", auth(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]bool{"processing": false})
+	}))
+	mux.HandleFunc("/api/v1/project/lookup", auth(func(w http.ResponseWriter, r *http.Request) {
+		name, version := r.URL.Query().Get("name"), r.URL.Query().Get("version")
+		if _, ok := uploads[name+"@"+version]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(Project{UUID: "6f0e5c1a", Name: name, Version: version})
+	}))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return &Client{URL: srv.URL, APIKey: "odt_key", HTTP: srv.Client()}, uploads
+}
+
+func TestUploadBOM(t *testing.T) {
+	client, uploads := fakeDTrack(t)
+	ctx := context.Background()
+	bom := []byte(`{"bomFormat":"CycloneDX","specVersion":"1.5"}`)
+	token, err := client.UploadBOM(ctx, Upload{
+		Project: "ghcr.io/org/app", Version: "v1", Tags: []string{"slsa", "demo"}, AutoCreate: true, BOM: bom,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "token-1" {
+		t.Errorf("token = %q", token)
+	}
+	req, ok := uploads["ghcr.io/org/app@v1"]
+	if !ok {
+		t.Fatalf("uploads = %v", uploads)
+	}
+	if got, _ := base64.StdEncoding.DecodeString(req.BOM); string(got) != string(bom) {
+		t.Errorf("bom = %s", got)
+	}
+	if len(req.ProjectTags) != 2 || req.ProjectTags[0].Name != "slsa" || req.ProjectTags[1].Name != "demo" {
+		t.Errorf("tags = %v", req.ProjectTags)
+	}
+
+	processing, err := client.Processing(ctx, token)
+	if err != nil || processing {
+		t.Errorf("Processing = %v, %v", processing, err)
+	}
+	p, err := client.LookupProject(ctx, "ghcr.io/org/app", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := client.ProjectURL(p), client.URL+"/projects/6f0e5c1a"; got != want {
+		t.Errorf("ProjectURL = %s, want %s", got, want)
+	}
+	if _, err := client.LookupProject(ctx, "ghcr.io/org/app", "v2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("LookupProject(v2) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUploadBOMErrors(t *testing.T) {
+	client, _ := fakeDTrack(t)
+	ctx := context.Background()
+	if _, err := client.UploadBOM(ctx, Upload{Project: "app", BOM: []byte("{}")}); err == nil {
+		t.Error("upload without a version succeeded")
+	}
+	if _, err := client.UploadBOM(ctx, Upload{Project: "app", Version: "v1", BOM: []byte("{}")}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("upload to a missing project without AutoCreate = %v, want ErrNotFound", err)
+	}
+	client.APIKey = "wrong"
+	if _, err := client.UploadBOM(ctx, Upload{Project: "app", Version: "v1", AutoCreate: true, BOM: []byte("{}")}); err == nil {
+		t.Error("upload with a wrong API key succeeded")
+	}
+}
@@ -0,0 +1,30 @@
+// Package env abstracts environment variable lookups so that code reading
+// its configuration from the environment can be tested without mutating
+// the process environment.
+package env
+
+import "os"
+
+// Env looks up environment variables.
+type Env interface {
+	Getenv(key string) string
+}
+
+// OS is the process environment.
+type OS struct{}
+
+func (OS) Getenv(key string) string { return os.Getenv(key) }
+
+// Map is an environment backed by a map, for tests.
+type Map map[string]string
+
+func (m Map) Getenv(key string) string { return m[key] }
+
+// GetOrDefault returns the value of key in e, or def if it is unset or
+// empty.
+func GetOrDefault(e Env, key, def string) string {
+	if v := e.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,75 @@
+// Package failure classifies why verification failed. Every failure the
+// API, the CLI, metrics and the watch list report carries one of a small,
+// stable set of codes, so automation can branch on the class of a failure
+// without parsing its message.
+package failure
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Code is the class of a verification failure.
+type Code string
+
+// Codes of failure.
+const (
+	// SignatureMismatch is a signature, attestation or log entry that does
+	// not verify against the image or a trusted key.
+	SignatureMismatch Code = "SIGNATURE_MISMATCH"
+	// IdentityRejected is a signer identity or issuer that is not allowed:
+	// one outside the --certificate-identity pattern, a certificate that
+	// does not chain to a trusted root, a denied signer or one other than
+	// the identity pinned for the repository.
+	IdentityRejected Code = "IDENTITY_REJECTED"
+	// RekorUnreachable is transparency log evidence that could not be
+	// fetched.
+	RekorUnreachable Code = "REKOR_UNREACHABLE"
+	// PolicyDenied is an artifact that verified but failed a policy: a
+	// denied digest, missing annotations or transparency log entries, or a
+	// failed policy rule.
+	PolicyDenied Code = "POLICY_DENIED"
+	// SchemaInvalid is an envelope or statement that cannot be decoded, or
+	// a predicate that does not match the schema of its type.
+	SchemaInvalid Code = "SCHEMA_INVALID"
+	// StaleProvenance is provenance older than the repository's current
+	// build, or replaying a log entry of another image.
+	StaleProvenance Code = "STALE_PROVENANCE"
+)
+
+// Codes lists every code, in the order metrics report them.
+var Codes = []Code{SignatureMismatch, IdentityRejected, RekorUnreachable, PolicyDenied, SchemaInvalid, StaleProvenance}
+
+// Error attaches a code to an error.
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// New returns an error with code and a message formatted as by
+// fmt.Errorf, which may wrap other errors with %w.
+func New(code Code, format string, args ...any) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// Wrap attaches code to err, returning nil for a nil err. An error that
+// already has a code keeps it.
+func Wrap(code Code, err error) error {
+	if err == nil || CodeOf(err) != "" {
+		return err
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// CodeOf returns the code of the first error in err's tree that has one,
+// or "" when none does.
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
@@ -0,0 +1,40 @@
+package failure
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestCodeOf(t *testing.T) {
+	err := New(RekorUnreachable, "fetching log index %d: %w", 7, io.ErrUnexpectedEOF)
+	if got := CodeOf(err); got != RekorUnreachable {
+		t.Errorf("CodeOf() = %q", got)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("the cause is not wrapped")
+	}
+	if got := CodeOf(fmt.Errorf("collecting: %w", err)); got != RekorUnreachable {
+		t.Errorf("CodeOf(wrapped) = %q", got)
+	}
+	if got := CodeOf(errors.New("plain")); got != "" {
+		t.Errorf("CodeOf(plain) = %q", got)
+	}
+	if got := CodeOf(errors.Join(errors.New("plain"), Wrap(PolicyDenied, io.EOF))); got != PolicyDenied {
+		t.Errorf("CodeOf(joined) = %q", got)
+	}
+}
+
+func TestWrapKeepsCode(t *testing.T) {
+	if Wrap(SignatureMismatch, nil) != nil {
+		t.Error("wrapped nil")
+	}
+	err := Wrap(SignatureMismatch, New(IdentityRejected, "identity %q is not allowed", "x"))
+	if got := CodeOf(err); got != IdentityRejected {
+		t.Errorf("CodeOf() = %q, want the inner code", got)
+	}
+	if err.Error() != `identity "x" is not allowed` {
+		t.Errorf("Error() = %q", err)
+	}
+}
@@ -0,0 +1,160 @@
+// Package fault injects faults into the server on purpose, so that how it
+// copes with a slow transparency log, a failing registry or a corrupted
+// cache can be demonstrated rather than waited for. Faults are set at run
+// time through the admin API, and only when the server was started with
+// fault injection enabled.
+//
+// Outbound faults are injected by the httpclient transport, which asks
+// the Injector before each request: requests to a Rekor log
+// (/api/v1/log/...) are delayed, and requests to a registry (/v2/...)
+// fail at the configured rate.
+package fault
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInjected is the error of a request failed on purpose.
+var ErrInjected = errors.New("injected fault")
+
+// Faults are the faults to inject. The zero value injects none.
+type Faults struct {
+	// RekorDelay, a Go duration such as "2s", delays every request to a
+	// Rekor log.
+	RekorDelay string `json:"rekorDelay,omitempty"`
+	// RegistryFailureRate is the fraction of registry requests, from 0 to
+	// 1, that fail without reaching the registry.
+	RegistryFailureRate float64 `json:"registryFailureRate,omitempty"`
+	// CacheCorruptionRate is the fraction of verification cache hits,
+	// from 0 to 1, whose entry is corrupted before it is read.
+	CacheCorruptionRate float64 `json:"cacheCorruptionRate,omitempty"`
+}
+
+// Active reports whether f injects any fault.
+func (f Faults) Active() bool {
+	return f != Faults{}
+}
+
+func (f Faults) rekorDelay() (time.Duration, error) {
+	if f.RekorDelay == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(f.RekorDelay)
+	if err != nil {
+		return 0, fmt.Errorf("rekorDelay: %w", err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("rekorDelay %s is negative", f.RekorDelay)
+	}
+	return d, nil
+}
+
+// Validate checks that the delay parses and the rates are fractions.
+func (f Faults) Validate() error {
+	if _, err := f.rekorDelay(); err != nil {
+		return err
+	}
+	for _, r := range []struct {
+		name string
+		rate float64
+	}{
+		{"registryFailureRate", f.RegistryFailureRate},
+		{"cacheCorruptionRate", f.CacheCorruptionRate},
+	} {
+		if r.rate < 0 || r.rate > 1 {
+			return fmt.Errorf("%s %v is not between 0 and 1", r.name, r.rate)
+		}
+	}
+	return nil
+}
+
+// Injector holds the faults currently injected. It is safe for concurrent
+// use, and a nil Injector injects nothing.
+type Injector struct {
+	mu     sync.Mutex
+	faults Faults
+	delay  time.Duration
+	rand   *rand.Rand
+}
+
+// New returns an Injector injecting no faults yet.
+func New() *Injector {
+	return &Injector{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// Set replaces the injected faults.
+func (i *Injector) Set(f Faults) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	delay, _ := f.rekorDelay()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.faults, i.delay = f, delay
+	return nil
+}
+
+// Get returns the injected faults.
+func (i *Injector) Get() Faults {
+	if i == nil {
+		return Faults{}
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.faults
+}
+
+// roll reports whether an event with probability rate happens.
+func (i *Injector) roll(rate float64) bool {
+	switch {
+	case rate <= 0:
+		return false
+	case rate >= 1:
+		return true
+	}
+	return i.rand.Float64() < rate
+}
+
+// Before injects the faults for an outbound request: it sleeps for the
+// Rekor delay, or until req's context is done, and returns ErrInjected
+// for registry requests that are to fail.
+func (i *Injector) Before(req *http.Request) error {
+	if i == nil {
+		return nil
+	}
+	i.mu.Lock()
+	delay := i.delay
+	fail := i.roll(i.faults.RegistryFailureRate)
+	i.mu.Unlock()
+
+	switch path := req.URL.Path; {
+	case strings.HasPrefix(path, "/api/v1/log") && delay > 0:
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-req.Context().Done():
+			return req.Context().Err()
+		}
+	case strings.HasPrefix(path, "/v2/") && fail:
+		return fmt.Errorf("%s %s: %w: registry failure", req.Method, req.URL.Redacted(), ErrInjected)
+	}
+	return nil
+}
+
+// CorruptCache reports whether to corrupt the cache entry about to be
+// read.
+func (i *Injector) CorruptCache() bool {
+	if i == nil {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.roll(i.faults.CacheCorruptionRate)
+}
@@ -0,0 +1,57 @@
+package fault
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	for _, f := range []Faults{
+		{RekorDelay: "soon"},
+		{RekorDelay: "-1s"},
+		{RegistryFailureRate: 1.5},
+		{CacheCorruptionRate: -0.1},
+	} {
+		if err := New().Set(f); err == nil {
+			t.Errorf("Set(%+v) succeeded", f)
+		}
+	}
+	if (Faults{}).Active() || !(Faults{RekorDelay: "1s"}).Active() {
+		t.Error("Active() is wrong")
+	}
+}
+
+func TestBefore(t *testing.T) {
+	i := New()
+	if err := i.Set(Faults{RekorDelay: "50ms", RegistryFailureRate: 1}); err != nil {
+		t.Fatal(err)
+	}
+	registry, _ := http.NewRequest(http.MethodGet, "https://ghcr.io/v2/org/app/manifests/v1", nil)
+	if err := i.Before(registry); !errors.Is(err, ErrInjected) {
+		t.Errorf("registry request: %v, want an injected failure", err)
+	}
+
+	rekor, _ := http.NewRequest(http.MethodGet, "https://rekor.sigstore.dev/api/v1/log/entries?logIndex=1", nil)
+	start := time.Now()
+	if err := i.Before(rekor); err != nil || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("Rekor request: %v after %s, want a 50ms delay", err, time.Since(start))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := i.Before(rekor.WithContext(ctx)); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled Rekor request: %v", err)
+	}
+
+	fulcio, _ := http.NewRequest(http.MethodPost, "https://fulcio.sigstore.dev/api/v2/signingCert", nil)
+	if err := i.Before(fulcio); err != nil {
+		t.Errorf("Fulcio request: %v", err)
+	}
+
+	var none *Injector
+	if none.Before(registry) != nil || none.CorruptCache() || none.Get().Active() {
+		t.Error("a nil Injector injected a fault")
+	}
+}
@@ -0,0 +1,883 @@
+// Package graphql executes GraphQL queries against a read-only schema of Go
+// resolvers. It implements the query language (operations, variables,
+// aliases, fragments and the @include and @skip directives) for schemas
+// built from object and scalar types. Mutations, interfaces, input objects
+// and introspection are not supported; Schema.SDL describes the schema
+// instead.
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Object is an object type: a named set of fields.
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+
+	fields map[string]*Field
+}
+
+// Field is a field of an object type.
+type Field struct {
+	Name        string
+	Description string
+	// Type is the field's type in schema language, such as "[Build!]!".
+	Type string
+	Args []Arg
+	// Resolve returns the value of the field on source, the value of the
+	// object it is selected on. When nil, the value is read from the
+	// source's struct field with a matching JSON name, or its map key.
+	Resolve func(ctx context.Context, source any, args Args) (any, error)
+}
+
+// Arg is an argument of a field. Arguments are optional unless their type
+// is non-null.
+type Arg struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// Scalar is a custom scalar type. Its values are output as they encode to
+// JSON and read from strings.
+type Scalar struct {
+	Name        string
+	Description string
+}
+
+// builtinScalars are the scalar types every schema has.
+var builtinScalars = map[string]bool{"Int": true, "Float": true, "String": true, "Boolean": true, "ID": true}
+
+// Definition describes a schema for NewSchema.
+type Definition struct {
+	// Query is the root type of query operations.
+	Query *Object
+	// Types are the other object types, in the order SDL prints them.
+	Types   []*Object
+	Scalars []Scalar
+	// MaxDepth bounds how deeply queries may nest fields, a fragment
+	// spread counting as a level; zero means no limit.
+	MaxDepth int
+	// MaxFields bounds how many fields a query selects with its fragments
+	// expanded, so that fragments spreading others cannot make a short
+	// query an exponentially large one; zero means no limit.
+	MaxFields int
+}
+
+// Schema is a validated set of types that queries execute against.
+type Schema struct {
+	def     Definition
+	objects map[string]*Object
+	scalars map[string]bool
+}
+
+// NewSchema checks that the types def refers to are defined and that field
+// names are unique.
+func NewSchema(def Definition) (*Schema, error) {
+	if def.Query == nil {
+		return nil, errors.New("graphql: the schema has no query type")
+	}
+	s := &Schema{def: def, objects: map[string]*Object{}, scalars: map[string]bool{}}
+	for name := range builtinScalars {
+		s.scalars[name] = true
+	}
+	for _, sc := range def.Scalars {
+		if s.scalars[sc.Name] {
+			return nil, fmt.Errorf("graphql: type %s is defined twice", sc.Name)
+		}
+		s.scalars[sc.Name] = true
+	}
+	for _, o := range append([]*Object{def.Query}, def.Types...) {
+		if s.objects[o.Name] != nil || s.scalars[o.Name] {
+			return nil, fmt.Errorf("graphql: type %s is defined twice", o.Name)
+		}
+		s.objects[o.Name] = o
+		o.fields = map[string]*Field{}
+		for _, f := range o.Fields {
+			if o.fields[f.Name] != nil || strings.HasPrefix(f.Name, "__") {
+				return nil, fmt.Errorf("graphql: field %s.%s is defined twice or reserved", o.Name, f.Name)
+			}
+			o.fields[f.Name] = f
+		}
+	}
+	for _, o := range s.objects {
+		for _, f := range o.Fields {
+			if name := namedType(f.Type); s.objects[name] == nil && !s.scalars[name] {
+				return nil, fmt.Errorf("graphql: field %s.%s has unknown type %s", o.Name, f.Name, f.Type)
+			}
+			for _, a := range f.Args {
+				if !s.scalars[namedType(a.Type)] {
+					return nil, fmt.Errorf("graphql: argument %s of %s.%s is not a scalar or list of scalars", a.Name, o.Name, f.Name)
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+// namedType strips the list and non-null wrappers from a type.
+func namedType(typ string) string {
+	return strings.Trim(typ, "[]!")
+}
+
+// Args are the coerced arguments of a field. Omitted arguments are absent.
+type Args map[string]any
+
+// String returns a String or ID argument, or "" when it is absent.
+func (a Args) String(name string) string {
+	s, _ := a[name].(string)
+	return s
+}
+
+// Int returns an Int argument and whether it was given.
+func (a Args) Int(name string) (int, bool) {
+	n, ok := a[name].(int)
+	return n, ok
+}
+
+// Bool returns a Boolean argument, or false when it is absent.
+func (a Args) Bool(name string) bool {
+	b, _ := a[name].(bool)
+	return b
+}
+
+// Request is a GraphQL request, as clients send it over HTTP.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Response is the result of executing a request. Data is absent when the
+// request failed before execution and null when a non-null root field
+// could not be resolved.
+type Response struct {
+	Data   any      `json:"data,omitempty"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+// Error is an error in a request, or in resolving the field at Path.
+type Error struct {
+	Message   string     `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	// Path lists the response keys and list indexes leading to the field.
+	Path []any `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Execute runs the operation in req that req.OperationName names, or its
+// only operation.
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return failed(err)
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return failed(err)
+	}
+	v := &validator{schema: s, doc: doc, ctx: ctx}
+	if errs := v.validate(op); len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+	vars, err := s.coerceVariables(op, req.Variables)
+	if err != nil {
+		return failed(err)
+	}
+	e := &executor{schema: s, doc: doc, vars: vars, ctx: ctx}
+	data, ok := e.object(s.def.Query, nil, op.selection, nil)
+	res := &Response{Data: data, Errors: e.errs}
+	if !ok {
+		res.Data = json.RawMessage("null")
+	}
+	return res
+}
+
+func failed(err error) *Response {
+	var gqlErr *Error
+	if !errors.As(err, &gqlErr) {
+		gqlErr = &Error{Message: err.Error()}
+	}
+	return &Response{Errors: []*Error{gqlErr}}
+}
+
+func (d *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(d.operations) > 1 {
+			return nil, &Error{Message: "the document has several operations; operationName must name one"}
+		}
+		return d.operations[0], nil
+	}
+	for _, op := range d.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("unknown operation %q", name)}
+}
+
+// validator checks an operation against the schema before it runs, so
+// that no resolver runs for an invalid query.
+type validator struct {
+	schema *Schema
+	doc    *document
+	ctx    context.Context
+	op     *operation
+	errs   []*Error
+	// spreading are the fragments being expanded, to reject cycles.
+	spreading map[string]bool
+	// fragments are the costs of the fragments validated so far, so that
+	// each is validated once however often it is spread.
+	fragments map[string]cost
+}
+
+// cost is the size of a selection set with its fragments expanded: the
+// levels of fields it nests, a spread counting as one, and the fields it
+// selects.
+type cost struct {
+	levels, fields int
+}
+
+// add adds the cost of selections beside c, capping the fields so that
+// they cannot overflow.
+func (c cost) add(o cost) cost {
+	return cost{levels: max(c.levels, o.levels), fields: min(c.fields+o.fields, math.MaxInt32)}
+}
+
+func (v *validator) errorf(loc Location, format string, args ...any) {
+	v.errs = append(v.errs, &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{loc}})
+}
+
+func (v *validator) validate(op *operation) []*Error {
+	v.op = op
+	v.spreading = map[string]bool{}
+	v.fragments = map[string]cost{}
+	if op.kind != "query" {
+		v.errorf(op.loc, "%s operations are not supported", op.kind)
+		return v.errs
+	}
+	seen := map[string]bool{}
+	for _, def := range op.variables {
+		switch {
+		case seen[def.name]:
+			v.errorf(def.loc, "there can be only one variable named $%s", def.name)
+		case !v.schema.scalars[namedType(def.typ)]:
+			v.errorf(def.loc, "variable $%s must have a scalar type, not %s", def.name, def.typ)
+		case def.hasDef:
+			if _, err := v.schema.coerce(def.typ, def.def, nil); err != nil {
+				v.errorf(def.loc, "default value of $%s: %v", def.name, err)
+			}
+		}
+		seen[def.name] = true
+	}
+	c := v.selectionSet(v.schema.def.Query, op.selection, 1)
+	if err := v.ctx.Err(); err != nil {
+		return []*Error{{Message: err.Error()}}
+	}
+	if max := v.schema.def.MaxFields; max > 0 && c.fields > max {
+		v.errorf(op.loc, "the query selects more than %d fields", max)
+	}
+	return v.errs
+}
+
+// selectionSet validates the selections in list, made on type t at the
+// given depth, and returns their cost.
+func (v *validator) selectionSet(t *Object, list []*selection, depth int) cost {
+	var c cost
+	if max := v.schema.def.MaxDepth; max > 0 && depth > max {
+		v.errorf(list[0].loc, "the query is nested more than %d levels deep", max)
+		return c
+	}
+	for _, sel := range list {
+		if v.ctx.Err() != nil {
+			return c
+		}
+		for _, d := range sel.directives {
+			v.directive(d)
+		}
+		switch {
+		case sel.spread != "":
+			f := v.doc.fragments[sel.spread]
+			if f == nil {
+				v.errorf(sel.loc, "unknown fragment %q", sel.spread)
+				continue
+			}
+			if v.spreading[f.name] {
+				v.errorf(sel.loc, "fragment %q spreads itself", f.name)
+				continue
+			}
+			if f.typeCond != t.Name {
+				v.errorf(sel.loc, "fragment %q on %s cannot be spread on %s", f.name, f.typeCond, t.Name)
+				continue
+			}
+			fc := v.fragment(t, f)
+			if max := v.schema.def.MaxDepth; max > 0 && depth+fc.levels > max {
+				v.errorf(sel.loc, "the query is nested more than %d levels deep", max)
+				continue
+			}
+			c = c.add(cost{levels: 1 + fc.levels, fields: fc.fields})
+		case sel.inline:
+			if sel.typeCond != "" && sel.typeCond != t.Name {
+				v.errorf(sel.loc, "fragment on %s cannot be spread on %s", sel.typeCond, t.Name)
+				continue
+			}
+			c = c.add(v.selectionSet(t, sel.selection, depth))
+		default:
+			c = c.add(v.field(t, sel, depth))
+		}
+	}
+	return c
+}
+
+// fragment validates fragment f, spread on its type t, the first time it
+// is spread and returns its cost, as if its fields were at depth 1.
+func (v *validator) fragment(t *Object, f *fragment) cost {
+	if c, ok := v.fragments[f.name]; ok {
+		return c
+	}
+	v.spreading[f.name] = true
+	c := v.selectionSet(t, f.selection, 1)
+	delete(v.spreading, f.name)
+	v.fragments[f.name] = c
+	return c
+}
+
+func (v *validator) field(t *Object, sel *selection, depth int) cost {
+	c := cost{levels: 1, fields: 1}
+	if sel.name == "__typename" {
+		if len(sel.args) > 0 || sel.selection != nil {
+			v.errorf(sel.loc, "__typename takes no arguments or selections")
+		}
+		return c
+	}
+	f := t.fields[sel.name]
+	if f == nil {
+		v.errorf(sel.loc, "cannot query field %q on type %s", sel.name, t.Name)
+		return c
+	}
+	v.arguments(fmt.Sprintf("%s.%s", t.Name, f.Name), f.Args, sel.args, sel.loc)
+	obj := v.schema.objects[namedType(f.Type)]
+	switch {
+	case obj == nil && sel.selection != nil:
+		v.errorf(sel.loc, "field %q of type %s has no fields to select", sel.name, f.Type)
+	case obj != nil && sel.selection == nil:
+		v.errorf(sel.loc, "field %q of type %s must have a selection of subfields", sel.name, f.Type)
+	case obj != nil:
+		sub := v.selectionSet(obj, sel.selection, depth+1)
+		c = cost{levels: 1 + sub.levels, fields: min(1+sub.fields, math.MaxInt32)}
+	}
+	return c
+}
+
+func (v *validator) arguments(owner string, defs []Arg, args []argument, loc Location) {
+	given := map[string]bool{}
+	for _, a := range args {
+		given[a.name] = true
+		def, ok := findArg(defs, a.name)
+		if !ok {
+			v.errorf(a.loc, "unknown argument %q on %s", a.name, owner)
+			continue
+		}
+		v.variables(a.value, def.Type, a.loc)
+		if _, err := v.schema.coerce(def.Type, a.value, nil); err != nil {
+			v.errorf(a.loc, "argument %q of %s: %v", a.name, owner, err)
+		}
+	}
+	for _, def := range defs {
+		if strings.HasSuffix(def.Type, "!") && !given[def.Name] {
+			v.errorf(loc, "argument %q of %s is required", def.Name, owner)
+		}
+	}
+}
+
+// variables checks that the variables used in value are defined with a
+// type that fits where they are used.
+func (v *validator) variables(value any, typ string, loc Location) {
+	switch val := value.(type) {
+	case variable:
+		for _, def := range v.op.variables {
+			if def.name != string(val) {
+				continue
+			}
+			if !typeFits(def, typ) {
+				v.errorf(loc, "variable $%s of type %s cannot be used as %s", def.name, def.typ, typ)
+			}
+			return
+		}
+		v.errorf(loc, "variable $%s is not defined", val)
+	case []any:
+		item := typ
+		if inner, ok := listItem(typ); ok {
+			item = inner
+		}
+		for _, x := range val {
+			v.variables(x, item, loc)
+		}
+	}
+}
+
+// typeFits reports whether a variable can be used where typ is expected:
+// a non-null variable fits a nullable position, and a nullable variable
+// with a default fits a non-null one.
+func typeFits(def variableDef, typ string) bool {
+	have := def.typ
+	if def.hasDef && def.def != nil && !strings.HasSuffix(have, "!") {
+		have += "!"
+	}
+	return have == typ || have == typ+"!"
+}
+
+func (v *validator) directive(d directive) {
+	if d.name != "include" && d.name != "skip" {
+		v.errorf(d.loc, "unknown directive @%s", d.name)
+		return
+	}
+	v.arguments("@"+d.name, []Arg{{Name: "if", Type: "Boolean!"}}, d.args, d.loc)
+}
+
+func findArg(defs []Arg, name string) (Arg, bool) {
+	for _, d := range defs {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Arg{}, false
+}
+
+// listItem returns the item type of a list type.
+func listItem(typ string) (string, bool) {
+	typ = strings.TrimSuffix(typ, "!")
+	if strings.HasPrefix(typ, "[") && strings.HasSuffix(typ, "]") {
+		return typ[1 : len(typ)-1], true
+	}
+	return "", false
+}
+
+func (s *Schema) coerceVariables(op *operation, input map[string]any) (map[string]any, error) {
+	vars := map[string]any{}
+	for _, def := range op.variables {
+		value, given := input[def.name]
+		if !given && def.hasDef {
+			value, given = def.def, true
+		}
+		if !given || value == nil {
+			if strings.HasSuffix(def.typ, "!") {
+				return nil, &Error{Message: fmt.Sprintf("variable $%s of type %s is required", def.name, def.typ), Locations: []Location{def.loc}}
+			}
+			continue
+		}
+		v, err := s.coerce(def.typ, value, vars)
+		if err != nil {
+			return nil, &Error{Message: fmt.Sprintf("variable $%s: %v", def.name, err), Locations: []Location{def.loc}}
+		}
+		vars[def.name] = v
+	}
+	return vars, nil
+}
+
+// coerce converts a literal or JSON input value to typ. With nil vars, as
+// during validation, variables are left for coerceVariables to check.
+func (s *Schema) coerce(typ string, value any, vars map[string]any) (any, error) {
+	if name, ok := value.(variable); ok {
+		if vars == nil {
+			return value, nil
+		}
+		value = vars[string(name)]
+	}
+	if value == nil {
+		if strings.HasSuffix(typ, "!") {
+			return nil, fmt.Errorf("null is not a valid %s", typ)
+		}
+		return nil, nil
+	}
+	if item, ok := listItem(typ); ok {
+		list, isList := value.([]any)
+		if !isList {
+			list = []any{value}
+		}
+		out := make([]any, len(list))
+		for i, x := range list {
+			v, err := s.coerce(item, x, vars)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	}
+	name := strings.TrimSuffix(typ, "!")
+	switch v := value.(type) {
+	case string:
+		if name == "String" || name == "ID" || !builtinScalars[name] {
+			return v, nil
+		}
+	case bool:
+		if name == "Boolean" {
+			return v, nil
+		}
+	case int64, int, float64, json.Number:
+		f, err := toFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case name == "Float":
+			return f, nil
+		case (name == "Int" || name == "ID") && f == math.Trunc(f):
+			if name == "ID" {
+				return strconv.FormatFloat(f, 'f', -1, 64), nil
+			}
+			if f < math.MinInt32 || f > math.MaxInt32 {
+				return nil, fmt.Errorf("%v does not fit in a 32-bit Int", v)
+			}
+			return int(f), nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not a valid %s", describe(value), name)
+}
+
+func toFloat(v any) (float64, error) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case json.Number:
+		return n.Float64()
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// describe names a value in error messages.
+func describe(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case enumValue:
+		return string(v)
+	case map[string]any:
+		return "an input object"
+	}
+	return fmt.Sprint(v)
+}
+
+// executor resolves the fields of a validated operation.
+type executor struct {
+	schema *Schema
+	doc    *document
+	vars   map[string]any
+	ctx    context.Context
+	errs   []*Error
+}
+
+// fieldGroup is the selections of one response key, merged across
+// fragments.
+type fieldGroup struct {
+	key        string
+	selections []*selection
+}
+
+// collect flattens the fragments in list and drops skipped selections,
+// grouping fields by response key in the order they first appear.
+func (e *executor) collect(list []*selection, groups []*fieldGroup, index map[string]*fieldGroup) []*fieldGroup {
+	for _, sel := range list {
+		if !e.included(sel) {
+			continue
+		}
+		switch {
+		case sel.spread != "":
+			groups = e.collect(e.doc.fragments[sel.spread].selection, groups, index)
+		case sel.inline:
+			groups = e.collect(sel.selection, groups, index)
+		default:
+			g := index[sel.key()]
+			if g == nil {
+				g = &fieldGroup{key: sel.key()}
+				index[g.key] = g
+				groups = append(groups, g)
+			}
+			g.selections = append(g.selections, sel)
+		}
+	}
+	return groups
+}
+
+func (e *executor) included(sel *selection) bool {
+	for _, d := range sel.directives {
+		cond, _ := e.schema.coerce("Boolean!", d.args[0].value, e.vars)
+		if b, _ := cond.(bool); b == (d.name == "skip") {
+			return false
+		}
+	}
+	return true
+}
+
+// object resolves the selected fields of source as type t. It reports
+// false when a non-null field failed, nulling the object.
+func (e *executor) object(t *Object, source any, list []*selection, path []any) (*orderedObject, bool) {
+	if err := e.ctx.Err(); err != nil {
+		e.errs = append(e.errs, &Error{Message: err.Error(), Locations: []Location{list[0].loc}, Path: path})
+		return nil, false
+	}
+	out := &orderedObject{}
+	for _, g := range e.collect(list, nil, map[string]*fieldGroup{}) {
+		sel := g.selections[0]
+		if sel.name == "__typename" {
+			out.add(g.key, t.Name)
+			continue
+		}
+		f := t.fields[sel.name]
+		fieldPath := append(append([]any(nil), path...), g.key)
+		var sub []*selection
+		for _, s := range g.selections {
+			sub = append(sub, s.selection...)
+		}
+		value, err := e.resolve(f, source, sel)
+		if err != nil {
+			e.errs = append(e.errs, &Error{Message: err.Error(), Locations: []Location{sel.loc}, Path: fieldPath})
+			if strings.HasSuffix(f.Type, "!") {
+				return nil, false
+			}
+			out.add(g.key, nil)
+			continue
+		}
+		v, ok := e.complete(f.Type, value, sub, fieldPath, sel.loc)
+		if !ok {
+			return nil, false
+		}
+		out.add(g.key, v)
+	}
+	return out, true
+}
+
+func (e *executor) resolve(f *Field, source any, sel *selection) (any, error) {
+	if err := e.ctx.Err(); err != nil {
+		return nil, err
+	}
+	args := Args{}
+	for _, a := range sel.args {
+		if name, isVar := a.value.(variable); isVar {
+			if _, given := e.vars[string(name)]; !given {
+				continue
+			}
+		}
+		def, _ := findArg(f.Args, a.name)
+		v, err := e.schema.coerce(def.Type, a.value, e.vars)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q: %v", a.name, err)
+		}
+		args[a.name] = v
+	}
+	if f.Resolve != nil {
+		return f.Resolve(e.ctx, source, args)
+	}
+	return defaultResolve(source, f.Name)
+}
+
+// complete shapes a resolved value as typ. It reports false when the value
+// is null, or has a null where typ forbids one, so the caller nulls its
+// parent in turn.
+func (e *executor) complete(typ string, value any, sub []*selection, path []any, loc Location) (any, bool) {
+	nonNull := strings.HasSuffix(typ, "!")
+	null := func() (any, bool) {
+		if nonNull {
+			e.errs = append(e.errs, &Error{Message: fmt.Sprintf("non-null field of type %s returned null", typ), Locations: []Location{loc}, Path: path})
+			return nil, false
+		}
+		return nil, true
+	}
+	if item, ok := listItem(typ); ok {
+		rv := reflect.ValueOf(value)
+		if value == nil || rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return null()
+		}
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			e.errs = append(e.errs, &Error{Message: fmt.Sprintf("a %s field returned a %T", typ, value), Locations: []Location{loc}, Path: path})
+			return nil, !nonNull
+		}
+		out := make([]any, rv.Len())
+		for i := range out {
+			v, ok := e.complete(item, rv.Index(i).Interface(), sub, append(append([]any(nil), path...), i), loc)
+			if !ok {
+				return nil, !nonNull
+			}
+			out[i] = v
+		}
+		return out, true
+	}
+	if isNil(value) {
+		return null()
+	}
+	if obj := e.schema.objects[namedType(typ)]; obj != nil {
+		v, ok := e.object(obj, value, sub, path)
+		if !ok {
+			return nil, !nonNull
+		}
+		return v, true
+	}
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	return rv.Interface(), true
+}
+
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// defaultResolve reads the field name from a map or from the struct field
+// whose JSON name is name, including fields of embedded structs.
+func defaultResolve(source any, name string) (any, error) {
+	rv := reflect.ValueOf(source)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			v := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+			if !v.IsValid() {
+				return nil, nil
+			}
+			return v.Interface(), nil
+		}
+	case reflect.Struct:
+		for _, sf := range reflect.VisibleFields(rv.Type()) {
+			if !sf.IsExported() || sf.Anonymous {
+				continue
+			}
+			jsonName, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+			if jsonName == name || jsonName == "" && strings.EqualFold(sf.Name, name) {
+				v, err := rv.FieldByIndexErr(sf.Index)
+				if err != nil {
+					// A nil embedded pointer has no fields.
+					return nil, nil
+				}
+				return v.Interface(), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no resolver for field %q on %T", name, source)
+}
+
+// orderedObject is a response object, which keeps its fields in the order
+// the query selected them.
+type orderedObject struct {
+	keys   []string
+	values []any
+}
+
+func (o *orderedObject) add(key string, v any) {
+	o.keys = append(o.keys, key)
+	o.values = append(o.values, v)
+}
+
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		b.Write(key)
+		b.WriteByte(':')
+		v, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
+
+// SDL describes the schema in the GraphQL schema definition language.
+func (s *Schema) SDL() string {
+	var b strings.Builder
+	scalars := append([]Scalar(nil), s.def.Scalars...)
+	sort.Slice(scalars, func(i, j int) bool { return scalars[i].Name < scalars[j].Name })
+	for _, sc := range scalars {
+		writeDescription(&b, "", sc.Description)
+		fmt.Fprintf(&b, "scalar %s\n\n", sc.Name)
+	}
+	for i, o := range append([]*Object{s.def.Query}, s.def.Types...) {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		writeDescription(&b, "", o.Description)
+		fmt.Fprintf(&b, "type %s {\n", o.Name)
+		for _, f := range o.Fields {
+			writeDescription(&b, "  ", f.Description)
+			b.WriteString("  " + f.Name)
+			if len(f.Args) > 0 {
+				writeArgs(&b, f.Args)
+			}
+			fmt.Fprintf(&b, ": %s\n", f.Type)
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// writeArgs prints arguments on one line, or one per line when any has a
+// description.
+func writeArgs(b *strings.Builder, args []Arg) {
+	described := false
+	for _, a := range args {
+		described = described || a.Description != ""
+	}
+	if !described {
+		list := make([]string, len(args))
+		for i, a := range args {
+			list[i] = a.Name + ": " + a.Type
+		}
+		b.WriteString("(" + strings.Join(list, ", ") + ")")
+		return
+	}
+	b.WriteString("(\n")
+	for _, a := range args {
+		writeDescription(b, "    ", a.Description)
+		fmt.Fprintf(b, "    %s: %s\n", a.Name, a.Type)
+	}
+	b.WriteString("  )")
+}
+
+func writeDescription(b *strings.Builder, indent, desc string) {
+	if desc == "" {
+		return
+	}
+	if !strings.Contains(desc, "\n") {
+		fmt.Fprintf(b, "%s%s\n", indent, strconv.Quote(desc))
+		return
+	}
+	fmt.Fprintf(b, "%s\"\"\"\n", indent)
+	for _, line := range strings.Split(desc, "\n") {
+		fmt.Fprintf(b, "%s%s\n", indent, line)
+	}
+	fmt.Fprintf(b, "%s\"\"\"\n", indent)
+}
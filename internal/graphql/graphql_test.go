@@ -0,0 +1,251 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type book struct {
+	ID     string   `json:"id"`
+	Title  string   `json:"title"`
+	Tags   []string `json:"tags"`
+	Author *author  `json:"author,omitempty"`
+}
+
+type author struct {
+	Name string
+}
+
+func testSchema(t *testing.T) *Schema {
+	t.Helper()
+	books := []*book{
+		{ID: "1", Title: "Reproducible Builds", Tags: []string{"supply-chain"}, Author: &author{Name: "Ada"}},
+		{ID: "2", Title: "Untitled"},
+	}
+	query := &Object{Name: "Query", Fields: []*Field{
+		{Name: "book", Type: "Book", Args: []Arg{{Name: "id", Type: "ID!"}}, Resolve: func(_ context.Context, _ any, args Args) (any, error) {
+			for _, b := range books {
+				if b.ID == args.String("id") {
+					return b, nil
+				}
+			}
+			return nil, nil
+		}},
+		{Name: "books", Type: "[Book!]!", Args: []Arg{{Name: "first", Type: "Int"}, {Name: "ids", Type: "[ID!]"}}, Resolve: func(_ context.Context, _ any, args Args) (any, error) {
+			list := books
+			if ids, ok := args["ids"].([]any); ok {
+				list = nil
+				for _, id := range ids {
+					for _, b := range books {
+						if b.ID == id {
+							list = append(list, b)
+						}
+					}
+				}
+			}
+			if n, ok := args.Int("first"); ok && n < len(list) {
+				list = list[:n]
+			}
+			return list, nil
+		}},
+		{Name: "broken", Type: "String", Resolve: func(context.Context, any, Args) (any, error) {
+			return nil, errors.New("registry unavailable")
+		}},
+	}}
+	schema, err := NewSchema(Definition{
+		Query: query,
+		Types: []*Object{
+			{Name: "Book", Description: "A book.", Fields: []*Field{
+				{Name: "id", Type: "ID!"},
+				{Name: "title", Type: "String!"},
+				{Name: "tags", Type: "[String!]!"},
+				{Name: "author", Type: "Author!"},
+			}},
+			{Name: "Author", Fields: []*Field{{Name: "name", Type: "String!"}}},
+		},
+		MaxDepth: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func run(t *testing.T, s *Schema, req Request) string {
+	t.Helper()
+	data, err := json.Marshal(s.Execute(context.Background(), req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestExecute(t *testing.T) {
+	s := testSchema(t)
+	tests := []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{
+			name: "fields in selection order",
+			req:  Request{Query: `{ book(id: "1") { title, id, __typename } }`},
+			want: `{"data":{"book":{"title":"Reproducible Builds","id":"1","__typename":"Book"}}}`,
+		},
+		{
+			name: "aliases and int IDs",
+			req:  Request{Query: `{ a: book(id: 1) { id } b: book(id: "3") { id } }`},
+			want: `{"data":{"a":{"id":"1"},"b":null}}`,
+		},
+		{
+			name: "variables and defaults",
+			req: Request{
+				Query:     `query Top($n: Int = 5, $ids: [ID!]) { books(first: $n, ids: $ids) { id } }`,
+				Variables: map[string]any{"ids": []any{"2", "1"}, "n": 1.0},
+			},
+			want: `{"data":{"books":[{"id":"2"}]}}`,
+		},
+		{
+			name: "fragments merge fields and directives skip them",
+			req: Request{
+				Query: `query ($full: Boolean!) { book(id: "1") { ...Core ... on Book { tags } author @include(if: $full) { name } } }
+					fragment Core on Book { id title }`,
+				Variables: map[string]any{"full": false},
+			},
+			want: `{"data":{"book":{"id":"1","title":"Reproducible Builds","tags":["supply-chain"]}}}`,
+		},
+		{
+			name: "resolver errors null the field",
+			req:  Request{Query: `{ broken book(id: "1") { id } }`},
+			want: `{"data":{"broken":null,"book":{"id":"1"}},"errors":[{"message":"registry unavailable","locations":[{"line":1,"column":3}],"path":["broken"]}]}`,
+		},
+		{
+			name: "null non-null fields null their parent",
+			req:  Request{Query: `{ books { id author { name } } }`},
+			want: `{"data":null,"errors":[{"message":"non-null field of type Author! returned null","locations":[{"line":1,"column":14}],"path":["books",1,"author"]}]}`,
+		},
+		{
+			name: "nil lists are empty",
+			req:  Request{Query: `{ book(id: "2") { tags } }`},
+			want: `{"data":{"book":{"tags":[]}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := run(t, s, tt.req); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteRejectsInvalidQueries(t *testing.T) {
+	s := testSchema(t)
+	tests := []struct {
+		query string
+		vars  map[string]any
+		want  string
+	}{
+		{`{ book(id: "1") { title `, nil, "syntax error: unexpected end of document"},
+		{`{ book(id: "1") { isbn } }`, nil, `cannot query field "isbn" on type Book`},
+		{`{ book { id } }`, nil, `argument "id" of Query.book is required`},
+		{`{ book(id: "1") { title { length } } }`, nil, `field "title" of type String! has no fields to select`},
+		{`{ book(id: "1") }`, nil, `field "book" of type Book must have a selection of subfields`},
+		{`{ books(first: "ten") { id } }`, nil, `argument "first" of Query.books: "ten" is not a valid Int`},
+		{`{ books(first: $n) { id } }`, nil, "variable $n is not defined"},
+		{`query ($n: String) { books(first: $n) { id } }`, nil, "variable $n of type String cannot be used as Int"},
+		{`query ($id: ID!) { book(id: $id) { id } }`, nil, "variable $id of type ID! is required"},
+		{`query ($n: Int) { books(first: $n) { id } }`, map[string]any{"n": 1.5}, "variable $n: 1.5 is not a valid Int"},
+		{`{ book(id: "1") { ...F } } fragment F on Book { ...F }`, nil, `fragment "F" spreads itself`},
+		{`{ book(id: "1") { ...F } } fragment F on Author { name }`, nil, `fragment "F" on Author cannot be spread on Book`},
+		{`{ book(id: "1") { author { name @deprecated } } }`, nil, "unknown directive @deprecated"},
+		{`mutation { book(id: "1") { id } }`, nil, "mutation operations are not supported"},
+		{`{ books { author { name } } } { books { id } }`, nil, "the document has several operations"},
+	}
+	for _, tt := range tests {
+		res := s.Execute(context.Background(), Request{Query: tt.query, Variables: tt.vars})
+		if len(res.Errors) == 0 || !strings.Contains(res.Errors[0].Message, tt.want) {
+			t.Errorf("%s: errors %+v, want %q", tt.query, res.Errors, tt.want)
+		}
+		if res.Data != nil {
+			t.Errorf("%s: invalid query returned data %v", tt.query, res.Data)
+		}
+	}
+
+	s.def.MaxDepth = 2
+	res := s.Execute(context.Background(), Request{Query: `{ books { author { name } } }`})
+	if len(res.Errors) == 0 || !strings.Contains(res.Errors[0].Message, "nested more than 2 levels") {
+		t.Errorf("errors %+v, want the depth limit", res.Errors)
+	}
+}
+
+// expandingQuery is a query of n fragments, each spreading the one before
+// it twice, which selects 2^n fields.
+func expandingQuery(n int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `{ book(id: "1") { ...F%d } } fragment F0 on Book { id }`, n-1)
+	for i := 1; i < n; i++ {
+		fmt.Fprintf(&b, " fragment F%d on Book { ...F%d ... on Book { ...F%d } }", i, i-1, i-1)
+	}
+	return b.String()
+}
+
+func TestExecuteBoundsFragmentExpansion(t *testing.T) {
+	s := testSchema(t)
+	query := expandingQuery(26)
+	res := s.Execute(context.Background(), Request{Query: query})
+	if len(res.Errors) == 0 || !strings.Contains(res.Errors[0].Message, "nested more than 3 levels") {
+		t.Errorf("errors %+v, want spreads to count toward the depth limit", res.Errors)
+	}
+
+	s.def.MaxDepth = 0
+	s.def.MaxFields = 100
+	res = s.Execute(context.Background(), Request{Query: query})
+	if len(res.Errors) != 1 || res.Errors[0].Message != "the query selects more than 100 fields" || res.Data != nil {
+		t.Errorf("errors %+v, want the field limit", res.Errors)
+	}
+	// Within the limit, the expanded fields merge into one.
+	if got, want := run(t, s, Request{Query: expandingQuery(6)}), `{"data":{"book":{"id":"1"}}}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// A cycle through several fragments is rejected too.
+	res = s.Execute(context.Background(), Request{Query: `{ book(id: "1") { ...A } } fragment A on Book { ...B } fragment B on Book { ...A }`})
+	if len(res.Errors) == 0 || !strings.Contains(res.Errors[0].Message, `fragment "A" spreads itself`) {
+		t.Errorf("errors %+v, want the cycle rejected", res.Errors)
+	}
+}
+
+func TestExecuteStopsWhenCanceled(t *testing.T) {
+	s := testSchema(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := s.Execute(ctx, Request{Query: `{ books { id } }`})
+	if len(res.Errors) != 1 || res.Errors[0].Message != context.Canceled.Error() || res.Data != nil {
+		t.Errorf("response %+v, want the cancellation", res)
+	}
+}
+
+func TestSDL(t *testing.T) {
+	sdl := testSchema(t).SDL()
+	for _, want := range []string{
+		"type Query {\n  book(id: ID!): Book\n  books(first: Int, ids: [ID!]): [Book!]!\n",
+		"\"A book.\"\ntype Book {\n  id: ID!\n",
+		"type Author {\n  name: String!\n}\n",
+	} {
+		if !strings.Contains(sdl, want) {
+			t.Errorf("SDL lacks %q:\n%s", want, sdl)
+		}
+	}
+}
+
+func TestNewSchemaRejectsUnknownTypes(t *testing.T) {
+	_, err := NewSchema(Definition{Query: &Object{Name: "Query", Fields: []*Field{{Name: "x", Type: "[Missing]"}}}})
+	if err == nil || !strings.Contains(err.Error(), "unknown type [Missing]") {
+		t.Errorf("err = %v", err)
+	}
+}
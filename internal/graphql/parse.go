@@ -0,0 +1,736 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Location is a line and column in a query, both counted from 1.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// document is a parsed query document.
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind      string
+	name      string
+	variables []variableDef
+	selection []*selection
+	loc       Location
+}
+
+type variableDef struct {
+	name string
+	typ  string
+	def  any
+	// hasDef distinguishes a null default from none.
+	hasDef bool
+	loc    Location
+}
+
+type fragment struct {
+	name      string
+	typeCond  string
+	selection []*selection
+	loc       Location
+}
+
+// selection is a field, a fragment spread (spread is set) or an inline
+// fragment (inline is set).
+type selection struct {
+	alias, name string
+	args        []argument
+	directives  []directive
+	selection   []*selection
+	spread      string
+	inline      bool
+	typeCond    string
+	loc         Location
+}
+
+// key is the name the field's value is returned under.
+func (s *selection) key() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+type argument struct {
+	name  string
+	value any
+	loc   Location
+}
+
+type directive struct {
+	name string
+	args []argument
+	loc  Location
+}
+
+// Literal values parse to nil, bool, int64, float64, string, enumValue,
+// variable, []any and map[string]any.
+type (
+	enumValue string
+	variable  string
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	loc   Location
+}
+
+type lexer struct {
+	src       string
+	pos       int
+	line, col int
+}
+
+func (l *lexer) errorf(loc Location, format string, args ...any) error {
+	return &Error{Message: "syntax error: " + fmt.Sprintf(format, args...), Locations: []Location{loc}}
+}
+
+func (l *lexer) advance(n int) {
+	for _, r := range l.src[l.pos : l.pos+n] {
+		if r == '\n' {
+			l.line++
+			l.col = 1
+		} else {
+			l.col++
+		}
+	}
+	l.pos += n
+}
+
+// skipIgnored skips whitespace, commas and comments.
+func (l *lexer) skipIgnored() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			l.advance(1)
+		case c == '#':
+			end := strings.IndexByte(l.src[l.pos:], '\n')
+			if end < 0 {
+				end = len(l.src) - l.pos
+			}
+			l.advance(end)
+		case strings.HasPrefix(l.src[l.pos:], "\ufeff"):
+			l.advance(len("\ufeff"))
+		default:
+			return
+		}
+	}
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+func (l *lexer) next() (token, error) {
+	l.skipIgnored()
+	loc := Location{Line: l.line, Column: l.col}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, loc: loc}, nil
+	}
+	rest := l.src[l.pos:]
+	c := rest[0]
+	switch {
+	case strings.HasPrefix(rest, "..."):
+		l.advance(3)
+		return token{kind: tokPunct, value: "...", loc: loc}, nil
+	case strings.IndexByte("!$():=@[]{}|&", c) >= 0:
+		l.advance(1)
+		return token{kind: tokPunct, value: string(c), loc: loc}, nil
+	case isNameStart(c):
+		n := 1
+		for n < len(rest) && (isNameStart(rest[n]) || isDigit(rest[n])) {
+			n++
+		}
+		l.advance(n)
+		return token{kind: tokName, value: rest[:n], loc: loc}, nil
+	case c == '-' || isDigit(c):
+		return l.number(loc)
+	case strings.HasPrefix(rest, `"""`):
+		return l.blockString(loc)
+	case c == '"':
+		return l.string(loc)
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return token{}, l.errorf(loc, "unexpected character %q", r)
+}
+
+func (l *lexer) number(loc Location) (token, error) {
+	rest := l.src[l.pos:]
+	n := 0
+	if rest[0] == '-' {
+		n++
+	}
+	digits := func() int {
+		start := n
+		for n < len(rest) && isDigit(rest[n]) {
+			n++
+		}
+		return n - start
+	}
+	if digits() == 0 {
+		return token{}, l.errorf(loc, "invalid number")
+	}
+	kind := tokInt
+	if n < len(rest) && rest[n] == '.' {
+		n++
+		kind = tokFloat
+		if digits() == 0 {
+			return token{}, l.errorf(loc, "invalid number")
+		}
+	}
+	if n < len(rest) && (rest[n] == 'e' || rest[n] == 'E') {
+		n++
+		kind = tokFloat
+		if n < len(rest) && (rest[n] == '+' || rest[n] == '-') {
+			n++
+		}
+		if digits() == 0 {
+			return token{}, l.errorf(loc, "invalid number")
+		}
+	}
+	if n < len(rest) && (isNameStart(rest[n]) || rest[n] == '.') {
+		return token{}, l.errorf(loc, "invalid number")
+	}
+	l.advance(n)
+	return token{kind: kind, value: rest[:n], loc: loc}, nil
+}
+
+func (l *lexer) string(loc Location) (token, error) {
+	var b strings.Builder
+	i := l.pos + 1
+	for i < len(l.src) {
+		c := l.src[i]
+		switch {
+		case c == '"':
+			l.advance(i + 1 - l.pos)
+			return token{kind: tokString, value: b.String(), loc: loc}, nil
+		case c == '\n' || c == '\r':
+			return token{}, l.errorf(loc, "unterminated string")
+		case c == '\\':
+			if i+1 >= len(l.src) {
+				return token{}, l.errorf(loc, "unterminated string")
+			}
+			switch e := l.src[i+1]; e {
+			case '"', '\\', '/':
+				b.WriteByte(e)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if i+6 > len(l.src) {
+					return token{}, l.errorf(loc, "invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(l.src[i+2:i+6], 16, 32)
+				if err != nil {
+					return token{}, l.errorf(loc, "invalid unicode escape")
+				}
+				b.WriteRune(rune(r))
+				i += 4
+			default:
+				return token{}, l.errorf(loc, "invalid escape \\%c", e)
+			}
+			i += 2
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return token{}, l.errorf(loc, "unterminated string")
+}
+
+// blockString reads a """block string""", removing the common indentation
+// and the blank first and last lines as the specification requires.
+func (l *lexer) blockString(loc Location) (token, error) {
+	body := l.src[l.pos+3:]
+	var raw strings.Builder
+	i := 0
+	for {
+		if i >= len(body) {
+			return token{}, l.errorf(loc, "unterminated string")
+		}
+		if strings.HasPrefix(body[i:], `\"""`) {
+			raw.WriteString(`"""`)
+			i += 4
+			continue
+		}
+		if strings.HasPrefix(body[i:], `"""`) {
+			break
+		}
+		raw.WriteByte(body[i])
+		i++
+	}
+	l.advance(3 + i + 3)
+
+	lines := strings.Split(strings.ReplaceAll(raw.String(), "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent > 0 {
+		for i, line := range lines[1:] {
+			if len(line) >= indent {
+				lines[i+1] = line[indent:]
+			} else {
+				lines[i+1] = ""
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[0], " \t") == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return token{kind: tokString, value: strings.Join(lines, "\n"), loc: loc}, nil
+}
+
+// parser is a recursive descent parser over the executable definitions of
+// the GraphQL grammar.
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+func parse(src string) (*document, error) {
+	p := &parser{lex: &lexer{src: src, line: 1, col: 1}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	doc := &document{fragments: map[string]*fragment{}}
+	for p.tok.kind != tokEOF {
+		switch {
+		case p.isPunct("{"):
+			sel, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", selection: sel, loc: sel[0].loc})
+		case p.isName("fragment"):
+			f, err := p.fragmentDefinition()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := doc.fragments[f.name]; dup {
+				return nil, &Error{Message: fmt.Sprintf("there can be only one fragment named %q", f.name), Locations: []Location{f.loc}}
+			}
+			doc.fragments[f.name] = f
+		case p.isName("query"), p.isName("mutation"), p.isName("subscription"):
+			op, err := p.operationDefinition()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, &Error{Message: "the document has no operation"}
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) isPunct(v string) bool { return p.tok.kind == tokPunct && p.tok.value == v }
+
+func (p *parser) isName(v string) bool { return p.tok.kind == tokName && p.tok.value == v }
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokEOF {
+		return p.lex.errorf(p.tok.loc, "unexpected end of document")
+	}
+	return p.lex.errorf(p.tok.loc, "unexpected %q", p.tok.value)
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.isPunct(punct) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokName {
+		return "", p.unexpected()
+	}
+	v := p.tok.value
+	return v, p.advance()
+}
+
+func (p *parser) operationDefinition() (*operation, error) {
+	op := &operation{kind: p.tok.value, loc: p.tok.loc}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokName {
+		op.name = p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.isPunct("(") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for !p.isPunct(")") {
+			v, err := p.variableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			op.variables = append(op.variables, v)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	sel, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selection = sel
+	return op, nil
+}
+
+func (p *parser) variableDefinition() (variableDef, error) {
+	v := variableDef{loc: p.tok.loc}
+	if err := p.expect("$"); err != nil {
+		return v, err
+	}
+	var err error
+	if v.name, err = p.name(); err != nil {
+		return v, err
+	}
+	if err := p.expect(":"); err != nil {
+		return v, err
+	}
+	if v.typ, err = p.typeRef(); err != nil {
+		return v, err
+	}
+	if p.isPunct("=") {
+		if err := p.advance(); err != nil {
+			return v, err
+		}
+		if v.def, err = p.value(true); err != nil {
+			return v, err
+		}
+		v.hasDef = true
+	}
+	_, err = p.directives()
+	return v, err
+}
+
+// typeRef parses a type reference such as [String!]! into its text.
+func (p *parser) typeRef() (string, error) {
+	var t string
+	if p.isPunct("[") {
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		t = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		t = name
+	}
+	if p.isPunct("!") {
+		t += "!"
+		return t, p.advance()
+	}
+	return t, nil
+}
+
+func (p *parser) fragmentDefinition() (*fragment, error) {
+	f := &fragment{loc: p.tok.loc}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var err error
+	if f.name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if f.name == "on" {
+		return nil, p.lex.errorf(f.loc, "a fragment cannot be named \"on\"")
+	}
+	if !p.isName("on") {
+		return nil, p.unexpected()
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if f.typeCond, err = p.name(); err != nil {
+		return nil, err
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	if f.selection, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (p *parser) selectionSet() ([]*selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var list []*selection
+	for !p.isPunct("}") {
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	if len(list) == 0 {
+		return nil, p.unexpected()
+	}
+	return list, p.advance()
+}
+
+func (p *parser) selection() (*selection, error) {
+	s := &selection{loc: p.tok.loc}
+	var err error
+	if p.isPunct("...") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		switch {
+		case p.isName("on"):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if s.typeCond, err = p.name(); err != nil {
+				return nil, err
+			}
+			s.inline = true
+		case p.tok.kind == tokName:
+			s.spread = p.tok.value
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		default:
+			s.inline = true
+		}
+		if s.directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		if s.inline {
+			if s.selection, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	}
+
+	if s.name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if p.isPunct(":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		s.alias = s.name
+		if s.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if s.args, err = p.arguments(false); err != nil {
+		return nil, err
+	}
+	if s.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.isPunct("{") {
+		if s.selection, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) arguments(constant bool) ([]argument, error) {
+	if !p.isPunct("(") {
+		return nil, nil
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var args []argument
+	seen := map[string]bool{}
+	for !p.isPunct(")") {
+		a := argument{loc: p.tok.loc}
+		var err error
+		if a.name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if seen[a.name] {
+			return nil, &Error{Message: fmt.Sprintf("there can be only one argument named %q", a.name), Locations: []Location{a.loc}}
+		}
+		seen[a.name] = true
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if a.value, err = p.value(constant); err != nil {
+			return nil, err
+		}
+		args = append(args, a)
+	}
+	if len(args) == 0 {
+		return nil, p.unexpected()
+	}
+	return args, p.advance()
+}
+
+func (p *parser) directives() ([]directive, error) {
+	var list []directive
+	for p.isPunct("@") {
+		d := directive{loc: p.tok.loc}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var err error
+		if d.name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if d.args, err = p.arguments(false); err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, nil
+}
+
+// value parses a literal. Constant values, such as variable defaults,
+// cannot refer to variables.
+func (p *parser) value(constant bool) (any, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokInt:
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, p.lex.errorf(tok.loc, "integer %s out of range", tok.value)
+		}
+		return n, p.advance()
+	case tokFloat:
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, p.lex.errorf(tok.loc, "invalid number %s", tok.value)
+		}
+		return f, p.advance()
+	case tokString:
+		return tok.value, p.advance()
+	case tokName:
+		var v any
+		switch tok.value {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			v = enumValue(tok.value)
+		}
+		return v, p.advance()
+	}
+	switch {
+	case p.isPunct("$") && !constant:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return variable(name), err
+	case p.isPunct("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := []any{}
+		for !p.isPunct("]") {
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.advance()
+	case p.isPunct("{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		obj := map[string]any{}
+		for !p.isPunct("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if obj[name], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		return obj, p.advance()
+	}
+	return nil, p.unexpected()
+}
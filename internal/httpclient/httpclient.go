@@ -0,0 +1,163 @@
+// Package httpclient provides the HTTP client every outbound call to
+// registries, Rekor, Fulcio and OSV goes through. Its transport keeps
+// connections alive and pooled per host, so a verification reuses the TLS
+// sessions of the previous one instead of handshaking again, and bounds
+// every phase of a request so a stalled upstream cannot hang a scan.
+// Requests made in a traced context continue the caller's trace.
+package httpclient
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/fault"
+	"github.com/waveywaves/tekton-slsa-demo/internal/metrics"
+	"github.com/waveywaves/tekton-slsa-demo/internal/trace"
+)
+
+// Options tune the transport.
+type Options struct {
+	// Timeout bounds a whole request, including reading the body.
+	Timeout time.Duration
+	// DialTimeout and TLSHandshakeTimeout bound establishing a connection.
+	DialTimeout         time.Duration
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout bounds waiting for the response headers once
+	// the request is written.
+	ResponseHeaderTimeout time.Duration
+	// IdleConnTimeout is how long an idle connection stays in the pool.
+	IdleConnTimeout time.Duration
+	// MaxIdleConnsPerHost is how many idle connections are kept per host;
+	// verifying images concurrently needs more than net/http's default 2.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps connections per host so a large scan does not
+	// trip registry rate limits. Zero means no limit.
+	MaxConnsPerHost int
+}
+
+// DefaultOptions are tuned for verification: a handful of concurrent
+// workers talking to a few hosts, each fetching small manifests and blobs.
+func DefaultOptions() Options {
+	return Options{
+		Timeout:               2 * time.Minute,
+		DialTimeout:           10 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   16,
+		MaxConnsPerHost:       32,
+	}
+}
+
+// NewTransport returns a transport tuned with o.
+func NewTransport(o Options) *http.Transport {
+	dialer := &net.Dialer{Timeout: o.DialTimeout, KeepAlive: 30 * time.Second}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   o.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: o.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       o.IdleConnTimeout,
+		MaxIdleConns:          4 * o.MaxIdleConnsPerHost,
+		MaxIdleConnsPerHost:   o.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       o.MaxConnsPerHost,
+	}
+}
+
+// New returns a client with a transport tuned with o. When stats is not
+// nil, requests through it are counted there.
+func New(o Options, stats *Stats) *http.Client {
+	t := &transport{base: NewTransport(o)}
+	if stats != nil {
+		t.stats.Store(stats)
+	}
+	return &http.Client{Transport: t, Timeout: o.Timeout}
+}
+
+var shared = New(DefaultOptions(), nil)
+
+// Default returns the process-wide client. Sharing it shares its
+// connection pool.
+func Default() *http.Client {
+	return shared
+}
+
+// Instrument counts requests through the Default client in r.
+func Instrument(r *metrics.Registry) {
+	shared.Transport.(*transport).stats.Store(NewStats(r))
+}
+
+// InjectFaults has requests through the Default client consult i before
+// they are sent, to be delayed or failed on purpose. Failed requests count
+// as outbound errors.
+func InjectFaults(i *fault.Injector) {
+	shared.Transport.(*transport).faults.Store(i)
+}
+
+// Stats count outbound requests and connections.
+type Stats struct {
+	requests    *metrics.Counter
+	errors      *metrics.Counter
+	inFlight    *metrics.Gauge
+	connsNew    *metrics.Counter
+	connsReused *metrics.Counter
+}
+
+// NewStats registers the transport metrics in r.
+func NewStats(r *metrics.Registry) *Stats {
+	return &Stats{
+		requests:    r.NewCounter("outbound_requests_total", "Outbound HTTP requests to registries, Rekor, Fulcio and OSV."),
+		errors:      r.NewCounter("outbound_request_errors_total", "Outbound HTTP requests that failed without a response."),
+		inFlight:    r.NewGauge("outbound_requests_in_flight", "Outbound HTTP requests awaiting a response."),
+		connsNew:    r.NewCounter("outbound_connections_opened_total", "Outbound connections dialed."),
+		connsReused: r.NewCounter("outbound_connections_reused_total", "Outbound requests sent on a pooled connection."),
+	}
+}
+
+type transport struct {
+	base   http.RoundTripper
+	stats  atomic.Pointer[Stats]
+	faults atomic.Pointer[fault.Injector]
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if trace.ID(req.Context()) != "" && req.Header.Get(trace.Header) == "" {
+		// A RoundTripper must not modify the caller's request.
+		req = req.Clone(req.Context())
+		trace.Inject(req.Context(), req.Header)
+	}
+	s := t.stats.Load()
+	if s == nil {
+		return t.send(req)
+	}
+	s.requests.Inc()
+	s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				s.connsReused.Inc()
+			} else {
+				s.connsNew.Inc()
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := t.send(req)
+	if err != nil {
+		s.errors.Inc()
+	}
+	return resp, err
+}
+
+func (t *transport) send(req *http.Request) (*http.Response, error) {
+	if err := t.faults.Load().Before(req); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
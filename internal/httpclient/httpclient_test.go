@@ -0,0 +1,90 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/metrics"
+	"github.com/waveywaves/tekton-slsa-demo/internal/trace"
+)
+
+func TestConnectionsArePooled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	reg := metrics.NewRegistry()
+	stats := NewStats(reg)
+	c := New(DefaultOptions(), stats)
+	for i := 0; i < 5; i++ {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if stats.requests.Value() != 5 || stats.connsNew.Value() != 1 || stats.connsReused.Value() != 4 {
+		t.Errorf("requests=%d new=%d reused=%d, want 5 requests on one pooled connection",
+			stats.requests.Value(), stats.connsNew.Value(), stats.connsReused.Value())
+	}
+	if stats.inFlight.Value() != 0 {
+		t.Errorf("%v requests still in flight", stats.inFlight.Value())
+	}
+
+	var b strings.Builder
+	reg.WriteText(&b)
+	if !strings.Contains(b.String(), "tekton_slsa_demo_outbound_connections_reused_total 4\n") {
+		t.Errorf("metrics:\n%s", b.String())
+	}
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	o := DefaultOptions()
+	o.ResponseHeaderTimeout = 20 * time.Millisecond
+	stats := NewStats(metrics.NewRegistry())
+	if _, err := New(o, stats).Get(srv.URL); err == nil {
+		t.Fatal("a stalled server did not time out")
+	}
+	if stats.errors.Value() != 1 {
+		t.Errorf("errors=%d, want 1", stats.errors.Value())
+	}
+}
+
+func TestPropagatesTrace(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(trace.Header)
+	}))
+	defer srv.Close()
+
+	ctx := trace.WithID(context.Background(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := New(DefaultOptions(), nil).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if id, _ := trace.Parse(got); id != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("upstream saw traceparent %q, want the caller's trace", got)
+	}
+	if req.Header.Get(trace.Header) != "" {
+		t.Error("the caller's request was modified")
+	}
+}
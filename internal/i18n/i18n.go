@@ -0,0 +1,131 @@
+// Package i18n holds the message catalogs of the dashboard and the pages
+// the server renders, one JSON file per language under locales/, and
+// negotiates which language to use from an Accept-Language header.
+//
+// Messages are HTML fragments with fmt verbs for their arguments. Every
+// catalog has the keys of the Default one, which is used for keys a
+// catalog lacks.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the language of the default catalog, used when the client
+// accepts none of the others.
+const Default = "en"
+
+//go:embed locales/*.json
+var files embed.FS
+
+// catalogs maps each language to its messages by key.
+var catalogs = mustLoad()
+
+func mustLoad() map[string]map[string]string {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	m := make(map[string]map[string]string, len(entries))
+	for _, e := range entries {
+		data, err := files.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var msgs map[string]string
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			panic(fmt.Sprintf("catalog %s: %v", e.Name(), err))
+		}
+		m[strings.TrimSuffix(e.Name(), ".json")] = msgs
+	}
+	return m
+}
+
+// Languages returns the languages with a catalog, Default first and the
+// others sorted.
+func Languages() []string {
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		if lang != Default {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs)
+	return append([]string{Default}, langs...)
+}
+
+// Localizer formats the messages of one language.
+type Localizer struct {
+	Lang string
+	msgs map[string]string
+}
+
+// For returns the localizer of lang, or of Default when there is no
+// catalog for lang.
+func For(lang string) *Localizer {
+	if _, ok := catalogs[lang]; !ok {
+		lang = Default
+	}
+	return &Localizer{Lang: lang, msgs: catalogs[lang]}
+}
+
+// T formats the message with the given key. Keys missing from the catalog
+// fall back to Default's message, and unknown keys are returned as is so
+// they stand out on the page.
+func (l *Localizer) T(key string, args ...any) string {
+	msg, ok := l.msgs[key]
+	if !ok {
+		if msg, ok = catalogs[Default][key]; !ok {
+			return key
+		}
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Negotiate returns the language with a catalog that best matches an
+// Accept-Language header such as "de-CH, de;q=0.9, en;q=0.8", or Default.
+// A tag matches a catalog of its own language or of its primary subtag.
+func Negotiate(header string) string {
+	type tag struct {
+		lang string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if lang != "" && q > 0 {
+			tags = append(tags, tag{strings.ToLower(lang), q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	for _, t := range tags {
+		if t.lang == "*" {
+			return Default
+		}
+		if _, ok := catalogs[t.lang]; ok {
+			return t.lang
+		}
+		if primary, _, ok := strings.Cut(t.lang, "-"); ok {
+			if _, ok := catalogs[primary]; ok {
+				return primary
+			}
+		}
+	}
+	return Default
+}
@@ -0,0 +1,63 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+)
+
+var verb = regexp.MustCompile(`%[sdv]`)
+
+// Every catalog must translate every message, with the same arguments.
+func TestCatalogsAreComplete(t *testing.T) {
+	if langs := Languages(); len(langs) < 2 || langs[0] != Default {
+		t.Fatalf("Languages() = %v, want %s and at least one other", langs, Default)
+	}
+	for lang, msgs := range catalogs {
+		for key, want := range catalogs[Default] {
+			got, ok := msgs[key]
+			if !ok {
+				t.Errorf("%s: missing %q", lang, key)
+				continue
+			}
+			if len(verb.FindAllString(got, -1)) != len(verb.FindAllString(want, -1)) {
+				t.Errorf("%s: %q has other arguments than in %s: %q", lang, key, Default, got)
+			}
+		}
+		for key := range msgs {
+			if _, ok := catalogs[Default][key]; !ok {
+				t.Errorf("%s: %q is not in the %s catalog", lang, key, Default)
+			}
+		}
+	}
+}
+
+func TestLocalizer(t *testing.T) {
+	de := For("de")
+	if got := de.T("index.footer", "1.0.0"); got != "Version: 1.0.0 | Gebaut mit Tekton Chains" {
+		t.Errorf("T(index.footer) = %q", got)
+	}
+	if got := de.T("no.such.key"); got != "no.such.key" {
+		t.Errorf("T(unknown key) = %q", got)
+	}
+	if l := For("xx"); l.Lang != Default {
+		t.Errorf("For(xx) is %s, want %s", l.Lang, Default)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                          "en",
+		"de":                        "de",
+		"de-CH, de;q=0.9, en;q=0.8": "de",
+		"fr-FR, fr;q=0.9, de;q=0.5": "de",
+		"en-US,en;q=0.9,de;q=0.8":   "en",
+		"fr, *;q=0.1":               "en",
+		"de;q=0, en;q=0.5":          "en",
+		"DE-at":                     "de",
+		"de;q=abc, en":              "en",
+	} {
+		if got := Negotiate(header); got != want {
+			t.Errorf("Negotiate(%q) = %s, want %s", header, got, want)
+		}
+	}
+}
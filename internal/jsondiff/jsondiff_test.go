@@ -0,0 +1,67 @@
+package jsondiff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	a, _ := Normalize(map[string]any{
+		"builder": map[string]any{"id": "https://tekton.dev/chains/v2"},
+		"params":  []any{"a", "b"},
+		"removed": true,
+	})
+	b, _ := Normalize(map[string]any{
+		"builder": map[string]any{"id": "https://example.com/other"},
+		"params":  []any{"a", "b", "c"},
+		"added":   1,
+	})
+
+	want := []Change{
+		{Path: "added", Kind: Added},
+		{Path: "builder.id", Kind: Changed},
+		{Path: "params[2]", Kind: Added},
+		{Path: "removed", Kind: Removed},
+	}
+	got := Compare(a, b)
+	if len(got) != len(want) {
+		t.Fatalf("Compare() = %+v, want %d changes", got, len(want))
+	}
+	for i := range want {
+		if got[i].Path != want[i].Path || got[i].Kind != want[i].Kind {
+			t.Errorf("change %d = %s %s, want %s %s", i, got[i].Kind, got[i].Path, want[i].Kind, want[i].Path)
+		}
+	}
+	if got[1].Old != "https://tekton.dev/chains/v2" || got[1].New != "https://example.com/other" {
+		t.Errorf("changed values = %v -> %v", got[1].Old, got[1].New)
+	}
+
+	if changes := Compare(a, a); len(changes) != 0 {
+		t.Errorf("Compare(a, a) = %+v, want no changes", changes)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := strings.Split("1\n2\n3\n4\n5\n6\n7\n8\n9\n10", "\n")
+	b := strings.Split("1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11", "\n")
+
+	got := Unified("a", "b", a, b, 1)
+	want := `--- a
++++ b
+@@ -4,3 +4,3 @@
+ 4
+-5
++five
+ 6
+@@ -10,1 +10,2 @@
+ 10
++11
+`
+	if got != want {
+		t.Errorf("Unified() =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := Unified("a", "b", a, a, 3); got != "" {
+		t.Errorf("Unified() of equal inputs = %q", got)
+	}
+}
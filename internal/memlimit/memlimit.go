@@ -0,0 +1,111 @@
+// Package memlimit works out how much memory the process may use, so caches
+// can be sized for the pod they run in rather than with fixed defaults.
+package memlimit
+
+import (
+	"io/fs"
+	"math"
+	"os"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+)
+
+// cgroupFiles hold the container memory limit under cgroup v2 and v1.
+var cgroupFiles = []string{
+	"sys/fs/cgroup/memory.max",
+	"sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// Limit returns the Go runtime's soft memory limit when GOMEMLIMIT or
+// debug.SetMemoryLimit set one, otherwise the container's cgroup limit. It
+// returns 0 when there is no limit.
+func Limit() int64 {
+	return limit(debug.SetMemoryLimit(-1), os.DirFS("/"))
+}
+
+func limit(goLimit int64, root fs.FS) int64 {
+	if goLimit > 0 && goLimit != math.MaxInt64 {
+		return goLimit
+	}
+	return cgroup(root)
+}
+
+// cgroup reads the memory limit of the process's cgroup, or 0 when it is
+// unlimited or cannot be read.
+func cgroup(root fs.FS) int64 {
+	for _, name := range cgroupFiles {
+		data, err := fs.ReadFile(root, name)
+		if err != nil {
+			continue
+		}
+		s := strings.TrimSpace(string(data))
+		if s == "max" {
+			return 0
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n <= 0 {
+			continue
+		}
+		// cgroup v1 reports no limit as the largest page-aligned int64.
+		if n >= 1<<62 {
+			return 0
+		}
+		return n
+	}
+	return 0
+}
+
+// ApplyCgroup sets the runtime's soft memory limit to 90% of the cgroup
+// limit when GOMEMLIMIT is not set, so the garbage collector works harder
+// before the kernel OOM-kills the container. It returns the limit now in
+// effect, or 0 when there is none.
+func ApplyCgroup() int64 {
+	if l := debug.SetMemoryLimit(-1); l != math.MaxInt64 {
+		return l
+	}
+	n := cgroup(os.DirFS("/"))
+	if n == 0 {
+		return 0
+	}
+	n = n / 10 * 9
+	debug.SetMemoryLimit(n)
+	return n
+}
+
+// Budget returns the given fraction of limit, or fallback when limit is 0.
+func Budget(limit int64, fraction float64, fallback int64) int64 {
+	if limit <= 0 {
+		return fallback
+	}
+	return int64(float64(limit) * fraction)
+}
+
+var inUseMetrics = []metrics.Sample{
+	{Name: "/memory/classes/total:bytes"},
+	{Name: "/memory/classes/heap/released:bytes"},
+}
+
+// InUse returns the memory the Go runtime holds from the OS, the figure
+// the soft limit is enforced against.
+func InUse() int64 {
+	samples := make([]metrics.Sample, len(inUseMetrics))
+	copy(samples, inUseMetrics)
+	metrics.Read(samples)
+	return int64(samples[0].Value.Uint64() - samples[1].Value.Uint64())
+}
+
+// PressureThreshold is the share of the limit above which memory is
+// considered under pressure.
+const PressureThreshold = 0.9
+
+// Pressure returns a function reporting whether memory in use is above
+// PressureThreshold of limit. It always reports false when limit is 0.
+func Pressure(limit int64) func() bool {
+	if limit <= 0 {
+		return func() bool { return false }
+	}
+	threshold := int64(float64(limit) * PressureThreshold)
+	return func() bool { return InUse() > threshold }
+}
@@ -0,0 +1,53 @@
+package memlimit
+
+import (
+	"math"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLimit(t *testing.T) {
+	v2 := fstest.MapFS{"sys/fs/cgroup/memory.max": {Data: []byte("268435456\n")}}
+	tests := []struct {
+		name    string
+		goLimit int64
+		root    fstest.MapFS
+		want    int64
+	}{
+		{"GOMEMLIMIT wins", 100 << 20, v2, 100 << 20},
+		{"cgroup v2", math.MaxInt64, v2, 256 << 20},
+		{"cgroup v2 unlimited", math.MaxInt64, fstest.MapFS{"sys/fs/cgroup/memory.max": {Data: []byte("max\n")}}, 0},
+		{"cgroup v1", math.MaxInt64, fstest.MapFS{"sys/fs/cgroup/memory/memory.limit_in_bytes": {Data: []byte("134217728\n")}}, 128 << 20},
+		{"cgroup v1 unlimited", math.MaxInt64, fstest.MapFS{"sys/fs/cgroup/memory/memory.limit_in_bytes": {Data: []byte("9223372036854771712\n")}}, 0},
+		{"no cgroup", math.MaxInt64, fstest.MapFS{}, 0},
+		{"garbage", math.MaxInt64, fstest.MapFS{"sys/fs/cgroup/memory.max": {Data: []byte("lots")}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limit(tt.goLimit, tt.root); got != tt.want {
+				t.Errorf("limit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBudget(t *testing.T) {
+	if got := Budget(256<<20, 1.0/16, 32<<20); got != 16<<20 {
+		t.Errorf("Budget with a limit = %d, want %d", got, 16<<20)
+	}
+	if got := Budget(0, 1.0/16, 32<<20); got != 32<<20 {
+		t.Errorf("Budget without a limit = %d, want the fallback", got)
+	}
+}
+
+func TestPressure(t *testing.T) {
+	if Pressure(0)() {
+		t.Error("no limit reported pressure")
+	}
+	if !Pressure(1)() {
+		t.Error("a 1-byte limit reported no pressure")
+	}
+	if Pressure(math.MaxInt64 / 2)() {
+		t.Error("a huge limit reported pressure")
+	}
+}
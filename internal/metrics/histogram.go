@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/trace"
+)
+
+// LatencyBuckets suit calls that take from milliseconds to tens of
+// seconds, such as registry and transparency log round trips.
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Histogram counts observations in cumulative buckets. Each bucket keeps
+// the latest observation made in a traced context as an exemplar, so a
+// dashboard can jump from a slow bucket to a trace that landed in it.
+type Histogram struct {
+	desc   string
+	bounds []float64
+
+	mu        sync.Mutex
+	counts    []uint64 // per bucket, not cumulative; the last is +Inf
+	exemplars []*exemplar
+	sum       float64
+	count     uint64
+}
+
+type exemplar struct {
+	traceID string
+	value   float64
+	at      time.Time
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds,
+// in increasing order. The name gets the Namespace prefix.
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of %s are not sorted", name))
+	}
+	h := &Histogram{
+		desc:      help,
+		bounds:    buckets,
+		counts:    make([]uint64, len(buckets)+1),
+		exemplars: make([]*exemplar, len(buckets)+1),
+	}
+	r.register(name, h)
+	return h
+}
+
+// Observe records v.
+func (h *Histogram) Observe(v float64) {
+	h.observe(v, "")
+}
+
+// ObserveContext records v with the trace ctx carries, if any, as the
+// exemplar of v's bucket.
+func (h *Histogram) ObserveContext(ctx context.Context, v float64) {
+	h.observe(v, trace.ID(ctx))
+}
+
+// ObserveSince records the seconds elapsed since start.
+func (h *Histogram) ObserveSince(ctx context.Context, start time.Time) {
+	h.ObserveContext(ctx, time.Since(start).Seconds())
+}
+
+func (h *Histogram) observe(v float64, traceID string) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	if traceID != "" {
+		h.exemplars[i] = &exemplar{traceID: traceID, value: v, at: time.Now()}
+	}
+}
+
+// snapshot copies the state under the lock.
+func (h *Histogram) snapshot() (counts []uint64, exemplars []*exemplar, sum float64, count uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]uint64(nil), h.counts...), append([]*exemplar(nil), h.exemplars...), h.sum, h.count
+}
+
+func (h *Histogram) kind() string { return "histogram" }
+func (h *Histogram) help() string { return h.desc }
+
+func (h *Histogram) write(w *bufio.Writer, name string, openMetrics bool) {
+	counts, exemplars, sum, count := h.snapshot()
+	var cumulative uint64
+	for i, n := range counts {
+		cumulative += n
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = formatFloat(h.bounds[i])
+			// OpenMetrics wants canonical bounds: 1.0 rather than 1.
+			if openMetrics && !strings.ContainsAny(le, ".eN") {
+				le += ".0"
+			}
+		}
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d", name, le, cumulative)
+		if e := exemplars[i]; openMetrics && e != nil {
+			fmt.Fprintf(w, " # {trace_id=%q} %s %.3f", e.traceID, formatFloat(e.value), float64(e.at.UnixMilli())/1000)
+		}
+		w.WriteByte('\n')
+	}
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", name, formatFloat(sum), name, count)
+}
+
+func (h *Histogram) summary() Summary {
+	counts, _, sum, count := h.snapshot()
+	s := Summary{Count: &count, Sum: &sum}
+	if count > 0 {
+		s.Quantiles = map[string]float64{
+			"p50": h.quantile(0.5, counts, count),
+			"p90": h.quantile(0.9, counts, count),
+			"p99": h.quantile(0.99, counts, count),
+		}
+	}
+	return s
+}
+
+// quantile estimates the q-quantile by interpolating linearly within the
+// bucket it falls in, as Prometheus's histogram_quantile does. Quantiles
+// in the +Inf bucket report the highest finite bound.
+func (h *Histogram) quantile(q float64, counts []uint64, count uint64) float64 {
+	rank := q * float64(count)
+	var cumulative uint64
+	for i, n := range counts {
+		if float64(cumulative+n) < rank || n == 0 {
+			cumulative += n
+			continue
+		}
+		if i == len(h.bounds) {
+			break
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = h.bounds[i-1]
+		}
+		return lower + (h.bounds[i]-lower)*(rank-float64(cumulative))/float64(n)
+	}
+	if len(h.bounds) == 0 {
+		return 0
+	}
+	return h.bounds[len(h.bounds)-1]
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/httptestutil"
+	"github.com/waveywaves/tekton-slsa-demo/internal/trace"
+)
+
+const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+func newTestHistogram(t *testing.T) (*Registry, *Histogram) {
+	t.Helper()
+	r := NewRegistry()
+	h := r.NewHistogram("verify_duration_seconds", "Verification time.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.ObserveContext(trace.WithID(context.Background(), traceID), 0.5)
+	h.Observe(0.7)
+	h.Observe(3)
+	return r, h
+}
+
+func TestHistogramText(t *testing.T) {
+	r, _ := newTestHistogram(t)
+	var b strings.Builder
+	r.WriteText(&b)
+	want := `# HELP tekton_slsa_demo_verify_duration_seconds Verification time.
+# TYPE tekton_slsa_demo_verify_duration_seconds histogram
+tekton_slsa_demo_verify_duration_seconds_bucket{le="0.1"} 1
+tekton_slsa_demo_verify_duration_seconds_bucket{le="1"} 3
+tekton_slsa_demo_verify_duration_seconds_bucket{le="+Inf"} 4
+tekton_slsa_demo_verify_duration_seconds_sum 4.25
+tekton_slsa_demo_verify_duration_seconds_count 4
+`
+	if b.String() != want {
+		t.Errorf("text:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestHistogramOpenMetricsExemplars(t *testing.T) {
+	r, _ := newTestHistogram(t)
+	r.NewCounter("verifications_total", "Verifications.").Inc()
+	var b strings.Builder
+	r.WriteOpenMetrics(&b)
+	out := b.String()
+	exemplar := regexp.MustCompile(`(?m)^tekton_slsa_demo_verify_duration_seconds_bucket\{le="1\.0"\} 3 # \{trace_id="` + traceID + `"\} 0\.5 \d+\.\d{3}$`)
+	if !exemplar.MatchString(out) {
+		t.Errorf("no exemplar on the le=1.0 bucket:\n%s", out)
+	}
+	for _, want := range []string{
+		"# TYPE tekton_slsa_demo_verifications counter\ntekton_slsa_demo_verifications_total 1\n",
+		"tekton_slsa_demo_verify_duration_seconds_bucket{le=\"0.1\"} 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("OpenMetrics output does not end with # EOF:\n%s", out)
+	}
+}
+
+func TestHandlerNegotiatesOpenMetrics(t *testing.T) {
+	r, _ := newTestHistogram(t)
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5")
+	rr := httptestutil.Do(r.Handler(), req)
+	httptestutil.AssertHeader(t, rr, "Content-Type", openMetricsMediaType)
+	httptestutil.AssertContains(t, rr, "trace_id=", "# EOF")
+
+	rr = httptestutil.Get(r.Handler(), "/metrics")
+	httptestutil.AssertHeader(t, rr, "Content-Type", textMediaType)
+	if strings.Contains(rr.Body.String(), "trace_id") {
+		t.Error("the Prometheus text format carries exemplars")
+	}
+}
+
+func TestSummaries(t *testing.T) {
+	r, _ := newTestHistogram(t)
+	r.NewGauge("in_flight", "In flight.").Set(2)
+	got := r.Summaries()
+	if len(got) != 2 || got[0].Name != "tekton_slsa_demo_in_flight" || *got[0].Value != 2 {
+		t.Fatalf("summaries: %+v", got)
+	}
+	h := got[1]
+	if h.Type != "histogram" || *h.Count != 4 || *h.Sum != 4.25 {
+		t.Errorf("histogram summary: %+v", h)
+	}
+	// Rank 2 of 4 falls halfway through the (0.1, 1] bucket's two
+	// observations; p90 and p99 fall in +Inf and report the top bound.
+	if q := h.Quantiles; q["p50"] != 0.55 || q["p90"] != 1 || q["p99"] != 1 {
+		t.Errorf("quantiles: %v", q)
+	}
+}
@@ -0,0 +1,326 @@
+// Package metrics is a small registry of counters, gauges and histograms
+// exported in the Prometheus text format, or in OpenMetrics when the
+// scraper asks for it so histograms can carry trace exemplars. It covers
+// what the server needs without pulling in the Prometheus client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Namespace prefixes every metric name.
+const Namespace = "tekton_slsa_demo_"
+
+// Media types of the exposition formats.
+const (
+	textMediaType        = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsMediaType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// Registry holds named metrics. It is safe for concurrent use.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+type metric interface {
+	kind() string
+	help() string
+	write(w *bufio.Writer, name string, openMetrics bool)
+	summary() Summary
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name = Namespace + name
+	if _, ok := r.metrics[name]; ok {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.metrics[name] = m
+}
+
+// sorted returns the metrics ordered by name.
+func (r *Registry) sorted() ([]string, []metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := make([]metric, len(names))
+	for i, name := range names {
+		metrics[i] = r.metrics[name]
+	}
+	return names, metrics
+}
+
+// WriteText writes every metric, sorted by name, in the Prometheus text
+// exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	return r.write(w, false)
+}
+
+// WriteOpenMetrics writes every metric, sorted by name, in the OpenMetrics
+// text format, including histogram exemplars.
+func (r *Registry) WriteOpenMetrics(w io.Writer) error {
+	return r.write(w, true)
+}
+
+func (r *Registry) write(w io.Writer, openMetrics bool) error {
+	names, metrics := r.sorted()
+	bw := bufio.NewWriter(w)
+	for i, name := range names {
+		m := metrics[i]
+		family := name
+		if openMetrics && m.kind() == "counter" {
+			// OpenMetrics names the counter family without its suffix,
+			// which its sample must carry.
+			family = strings.TrimSuffix(name, "_total")
+			name = family + "_total"
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", family, escapeHelp(m.help(), openMetrics), family, m.kind())
+		m.write(bw, name, openMetrics)
+	}
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+// escapeHelp escapes backslashes and line feeds in help text, and in
+// OpenMetrics double quotes too.
+func escapeHelp(help string, openMetrics bool) string {
+	if openMetrics {
+		return helpEscaperOpenMetrics.Replace(help)
+	}
+	return helpEscaper.Replace(help)
+}
+
+var (
+	helpEscaper            = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	helpEscaperOpenMetrics = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// Handler serves the registry, in OpenMetrics when the Accept header asks
+// for it and in the Prometheus text format otherwise.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if acceptsOpenMetrics(req.Header.Get("Accept")) {
+			w.Header().Set("Content-Type", openMetricsMediaType)
+			r.WriteOpenMetrics(w)
+			return
+		}
+		w.Header().Set("Content-Type", textMediaType)
+		r.WriteText(w)
+	})
+}
+
+func acceptsOpenMetrics(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		if mt, _, err := mime.ParseMediaType(part); err == nil && mt == "application/openmetrics-text" {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary is a metric's current state in the JSON summary.
+type Summary struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Help string `json:"help"`
+	// Value is set for counters and gauges.
+	Value *float64 `json:"value,omitempty"`
+	// Count, Sum and Quantiles are set for histograms. Quantiles are
+	// estimated from the buckets, keyed "p50", "p90" and "p99".
+	Count     *uint64            `json:"count,omitempty"`
+	Sum       *float64           `json:"sum,omitempty"`
+	Quantiles map[string]float64 `json:"quantiles,omitempty"`
+	// Values is set for labelled counters, keyed by the label's value.
+	Values map[string]float64 `json:"values,omitempty"`
+}
+
+// Summaries returns the state of every metric, sorted by name.
+func (r *Registry) Summaries() []Summary {
+	names, metrics := r.sorted()
+	out := make([]Summary, len(names))
+	for i, m := range metrics {
+		out[i] = m.summary()
+		out[i].Name = names[i]
+		out[i].Type = m.kind()
+		out[i].Help = m.help()
+	}
+	return out
+}
+
+func valueSummary(v float64) Summary {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return Summary{}
+	}
+	return Summary{Value: &v}
+}
+
+// Counter is a count that only goes up.
+type Counter struct {
+	desc string
+	v    atomic.Uint64
+}
+
+// NewCounter registers a counter. The name gets the Namespace prefix and
+// should end in _total.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{desc: help}
+	r.register(name, c)
+	return c
+}
+
+// Inc adds one to c.
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add adds n to c.
+func (c *Counter) Add(n uint64) { c.v.Add(n) }
+
+// Value returns the current count.
+func (c *Counter) Value() uint64 { return c.v.Load() }
+
+func (c *Counter) kind() string { return "counter" }
+func (c *Counter) help() string { return c.desc }
+func (c *Counter) write(w *bufio.Writer, name string, _ bool) {
+	fmt.Fprintf(w, "%s %d\n", name, c.Value())
+}
+func (c *Counter) summary() Summary { return valueSummary(float64(c.Value())) }
+
+// CounterVec is a family of counters told apart by the value of one label.
+// The values are fixed when it is registered, so every series is exported
+// from the start.
+type CounterVec struct {
+	desc     string
+	label    string
+	values   []string
+	counters map[string]*Counter
+}
+
+// NewCounterVec registers a counter for each of values, labelled label.
+func (r *Registry) NewCounterVec(name, help, label string, values ...string) *CounterVec {
+	v := &CounterVec{desc: help, label: label, values: values, counters: make(map[string]*Counter, len(values))}
+	for _, value := range values {
+		v.counters[value] = &Counter{}
+	}
+	r.register(name, v)
+	return v
+}
+
+// Inc adds one to the counter of value. Values not registered are
+// ignored.
+func (v *CounterVec) Inc(value string) {
+	if c, ok := v.counters[value]; ok {
+		c.Inc()
+	}
+}
+
+// Value returns the current count of value.
+func (v *CounterVec) Value(value string) uint64 {
+	if c, ok := v.counters[value]; ok {
+		return c.Value()
+	}
+	return 0
+}
+
+func (v *CounterVec) kind() string { return "counter" }
+func (v *CounterVec) help() string { return v.desc }
+func (v *CounterVec) write(w *bufio.Writer, name string, _ bool) {
+	for _, value := range v.values {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, v.label, value, v.counters[value].Value())
+	}
+}
+func (v *CounterVec) summary() Summary {
+	values := make(map[string]float64, len(v.values))
+	for _, value := range v.values {
+		values[value] = float64(v.counters[value].Value())
+	}
+	return Summary{Values: values}
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	desc string
+	bits atomic.Uint64
+}
+
+// NewGauge registers a gauge. The name gets the Namespace prefix.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{desc: help}
+	r.register(name, g)
+	return g
+}
+
+// Set sets g to v.
+func (g *Gauge) Set(v float64) { g.bits.Store(math.Float64bits(v)) }
+
+// Add adds delta to g.
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		if g.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 { return math.Float64frombits(g.bits.Load()) }
+
+func (g *Gauge) kind() string { return "gauge" }
+func (g *Gauge) help() string { return g.desc }
+func (g *Gauge) write(w *bufio.Writer, name string, _ bool) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(g.Value()))
+}
+func (g *Gauge) summary() Summary { return valueSummary(g.Value()) }
+
+// gaugeFunc is a gauge whose value is computed when the metrics are read.
+type gaugeFunc struct {
+	desc string
+	fn   func() float64
+}
+
+// NewGaugeFunc registers a gauge that reports fn's result each time the
+// metrics are read.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &gaugeFunc{desc: help, fn: fn})
+}
+
+func (g *gaugeFunc) kind() string { return "gauge" }
+func (g *gaugeFunc) help() string { return g.desc }
+func (g *gaugeFunc) write(w *bufio.Writer, name string, _ bool) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(g.fn()))
+}
+func (g *gaugeFunc) summary() Summary { return valueSummary(g.fn()) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/httptestutil"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("verifications_total", "Verifications run.")
+	g := r.NewGauge("in_flight", "Requests in flight.")
+	r.NewGaugeFunc("ratio", "A computed ratio.", func() float64 { return math.Inf(1) })
+	c.Add(3)
+	c.Inc()
+	g.Set(2)
+	g.Add(-0.5)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP tekton_slsa_demo_in_flight Requests in flight.
+# TYPE tekton_slsa_demo_in_flight gauge
+tekton_slsa_demo_in_flight 1.5
+# HELP tekton_slsa_demo_ratio A computed ratio.
+# TYPE tekton_slsa_demo_ratio gauge
+tekton_slsa_demo_ratio +Inf
+# HELP tekton_slsa_demo_verifications_total Verifications run.
+# TYPE tekton_slsa_demo_verifications_total counter
+tekton_slsa_demo_verifications_total 4
+`
+	if b.String() != want {
+		t.Errorf("WriteText:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("hits", `Hits, "cached" or not.`).Inc()
+	r.NewGauge("ratio", "A ratio\\of two\ncounts.").Set(1)
+	var b strings.Builder
+	if err := r.WriteOpenMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP tekton_slsa_demo_hits Hits, \"cached\" or not.
+# TYPE tekton_slsa_demo_hits counter
+tekton_slsa_demo_hits_total 1
+# HELP tekton_slsa_demo_ratio A ratio\\of two\ncounts.
+# TYPE tekton_slsa_demo_ratio gauge
+tekton_slsa_demo_ratio 1
+# EOF
+`
+	if b.String() != want {
+		t.Errorf("WriteOpenMetrics:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	v := r.NewCounterVec("failures_total", "Failures by code.", "code", "A", "B")
+	v.Inc("B")
+	v.Inc("B")
+	v.Inc("unknown")
+	var b strings.Builder
+	if err := r.WriteOpenMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP tekton_slsa_demo_failures Failures by code.
+# TYPE tekton_slsa_demo_failures counter
+tekton_slsa_demo_failures_total{code="A"} 0
+tekton_slsa_demo_failures_total{code="B"} 2
+# EOF
+`
+	if b.String() != want {
+		t.Errorf("WriteOpenMetrics:\n%s\nwant:\n%s", b.String(), want)
+	}
+	if s := r.Summaries()[0]; s.Values["A"] != 0 || s.Values["B"] != 2 || len(s.Values) != 2 {
+		t.Errorf("summary values = %v", s.Values)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("hits_total", "Hits.").Inc()
+	rr := httptestutil.Get(r.Handler(), "/metrics")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertHeader(t, rr, "Content-Type", textMediaType)
+	httptestutil.AssertContains(t, rr, "tekton_slsa_demo_hits_total 1\n")
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("x_total", "X.")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	r.NewGauge("x_total", "X again.")
+}
@@ -0,0 +1,60 @@
+package oci
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DockerConfigCredentials looks up registry credentials in
+// $DOCKER_CONFIG/config.json or ~/.docker/config.json. Credential helpers
+// are not supported; registries without inline auth are accessed
+// anonymously.
+func DockerConfigCredentials(registry string) (string, string) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", ""
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return "", ""
+	}
+	var cfg struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return "", ""
+	}
+
+	keys := []string{registry, "https://" + registry, "http://" + registry}
+	if registry == defaultRegistry {
+		keys = append(keys, "https://index.docker.io/v1/", "docker.io")
+	}
+	for _, k := range keys {
+		entry, ok := cfg.Auths[k]
+		if !ok {
+			continue
+		}
+		if entry.Username != "" {
+			return entry.Username, entry.Password
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			continue
+		}
+		if user, pass, ok := strings.Cut(string(decoded), ":"); ok {
+			return user, pass
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,549 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/digest"
+	"github.com/waveywaves/tekton-slsa-demo/internal/httpclient"
+)
+
+// Manifest media types accepted when resolving references.
+const (
+	MediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	MediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+var manifestAccept = strings.Join([]string{
+	MediaTypeOCIIndex, MediaTypeOCIManifest, MediaTypeDockerList, MediaTypeDockerManifest,
+}, ", ")
+
+// DefaultTimeout is the suggested Client.Timeout.
+const DefaultTimeout = 30 * time.Second
+
+// ErrNotFound is returned when the registry has no such manifest or blob.
+var ErrNotFound = errors.New("oci: not found")
+
+// RegistryClient is the read side of a registry, which is all verification
+// needs. *Client implements it.
+type RegistryClient interface {
+	Resolve(ctx context.Context, ref Reference) (string, error)
+	GetManifest(ctx context.Context, ref Reference) (*Manifest, []byte, string, error)
+	GetBlob(ctx context.Context, ref Reference, digest string, limit int64) ([]byte, error)
+}
+
+// Client talks to OCI distribution registries, handling bearer token and
+// basic auth transparently.
+type Client struct {
+	HTTP *http.Client
+	// Insecure selects plain HTTP, e.g. for the kind local registry.
+	Insecure bool
+	// Credentials returns the username and password for a registry. When
+	// nil, credentials are read from the Docker config file.
+	Credentials func(registry string) (user, pass string)
+	// Timeout bounds each call that reads a whole response: Resolve,
+	// GetManifest, GetBlob and ListTags. Zero leaves them bounded only by
+	// the caller's context and the HTTP client.
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// NewClient returns a Client using the shared httpclient.Default client.
+func NewClient() *Client {
+	return &Client{HTTP: httpclient.Default()}
+}
+
+// Resolve returns the manifest digest ref points at. References already
+// pinned by digest are returned as-is without a network round trip.
+func (c *Client) Resolve(ctx context.Context, ref Reference) (string, error) {
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	resp, err := c.do(ctx, ref, request{method: http.MethodHead, path: "/manifests/" + ref.Tag, accept: manifestAccept})
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("oci: registry did not return a digest for %s", ref)
+	}
+	return digest, nil
+}
+
+func (c *Client) scheme(registry string) string {
+	if c.Insecure || strings.HasPrefix(registry, "localhost") || strings.HasPrefix(registry, "127.0.0.1") {
+		return "http"
+	}
+	return "https"
+}
+
+func (c *Client) endpoint(ref Reference, path string) string {
+	host := ref.Registry
+	if host == defaultRegistry {
+		host = "registry-1.docker.io"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s%s", c.scheme(ref.Registry), host, ref.Repository, path)
+}
+
+// withTimeout applies c.Timeout to ctx.
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.Timeout)
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+	return httpclient.Default()
+}
+
+// request describes a registry API call. path is relative to the
+// repository unless it is an absolute URL, as upload locations may be.
+type request struct {
+	method      string
+	path        string
+	accept      string
+	contentType string
+	body        []byte
+	push        bool
+}
+
+// do issues a request, retrying once with a bearer token if the registry
+// challenges for one.
+func (c *Client) do(ctx context.Context, ref Reference, r request) (*http.Response, error) {
+	target := r.path
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		target = c.endpoint(ref, r.path)
+	}
+	scope := "pull"
+	if r.push {
+		scope = "pull,push"
+	}
+	send := func(auth string) (*http.Response, error) {
+		var body io.Reader
+		if r.body != nil {
+			body = bytes.NewReader(r.body)
+		}
+		req, err := http.NewRequestWithContext(ctx, r.method, target, body)
+		if err != nil {
+			return nil, err
+		}
+		if r.accept != "" {
+			req.Header.Set("Accept", r.accept)
+		}
+		if r.contentType != "" {
+			req.Header.Set("Content-Type", r.contentType)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return c.httpClient().Do(req)
+	}
+
+	resp, err := send(c.cachedAuth(ref, scope))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		auth, err := c.authenticate(ctx, ref, scope, challenge)
+		if err != nil {
+			return nil, err
+		}
+		if resp, err = send(auth); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s%s", ErrNotFound, ref.Name(), r.path)
+	case resp.StatusCode >= 300:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("oci: %s %s: %s: %s", r.method, r.path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (c *Client) cachedAuth(ref Reference, scope string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens[ref.Name()+"|"+scope]
+}
+
+// authenticate answers a WWW-Authenticate challenge, returning the
+// Authorization header to retry with. Basic challenges use the configured
+// credentials directly; Bearer challenges exchange them (or nothing, for
+// anonymous pulls) for a token scoped to the repository.
+func (c *Client) authenticate(ctx context.Context, ref Reference, scope, challenge string) (string, error) {
+	user, pass := c.credentials(ref.Registry)
+	var auth string
+	if strings.HasPrefix(strings.ToLower(challenge), "basic") {
+		if user == "" {
+			return "", fmt.Errorf("oci: %s requires credentials", ref.Registry)
+		}
+		auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+	} else {
+		token, err := c.fetchToken(ctx, ref, scope, challenge, user, pass)
+		if err != nil {
+			return "", err
+		}
+		auth = "Bearer " + token
+	}
+	c.mu.Lock()
+	if c.tokens == nil {
+		c.tokens = make(map[string]string)
+	}
+	c.tokens[ref.Name()+"|"+scope] = auth
+	c.mu.Unlock()
+	return auth, nil
+}
+
+func (c *Client) credentials(registry string) (string, string) {
+	if c.Credentials != nil {
+		return c.Credentials(registry)
+	}
+	return DockerConfigCredentials(registry)
+}
+
+// fetchToken follows a Bearer WWW-Authenticate challenge.
+func (c *Client) fetchToken(ctx context.Context, ref Reference, scope, challenge, user, pass string) (string, error) {
+	params := parseChallenge(challenge)
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("oci: unauthorized and no bearer realm offered by %s", ref.Registry)
+	}
+	q := url.Values{}
+	if s := params["service"]; s != "" {
+		q.Set("service", s)
+	}
+	q.Set("scope", "repository:"+ref.Repository+":"+scope)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oci: token endpoint returned %s", resp.Status)
+	}
+	var tr struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", fmt.Errorf("oci: decoding token: %w", err)
+	}
+	if tr.Token != "" {
+		return tr.Token, nil
+	}
+	return tr.AccessToken, nil
+}
+
+// parseChallenge splits `Bearer realm="...",service="..."` into its params.
+func parseChallenge(h string) map[string]string {
+	params := make(map[string]string)
+	_, rest, ok := strings.Cut(h, " ")
+	if !ok {
+		return params
+	}
+	for _, part := range strings.Split(rest, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[strings.ToLower(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return params
+}
+
+// Descriptor references content in a registry.
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Platform     *Platform         `json:"platform,omitempty"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+}
+
+// Platform is the platform of an index entry.
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// Manifest covers both image manifests and indexes; Layers is set for the
+// former and Manifests for the latter.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        *Descriptor       `json:"config,omitempty"`
+	Layers        []Descriptor      `json:"layers,omitempty"`
+	Manifests     []Descriptor      `json:"manifests,omitempty"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// IsIndex reports whether m is a multi-platform index.
+func (m *Manifest) IsIndex() bool {
+	return m.MediaType == MediaTypeOCIIndex || m.MediaType == MediaTypeDockerList || len(m.Manifests) > 0
+}
+
+// maxManifestSize bounds manifest reads; registries reject larger ones too.
+const maxManifestSize = 4 << 20
+
+// GetManifest fetches the manifest ref points at, returning it decoded along
+// with its raw bytes and digest. The bytes are checked against ref's digest,
+// or else the one the registry reports, in whichever algorithm it uses.
+func (c *Client) GetManifest(ctx context.Context, ref Reference) (*Manifest, []byte, string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	resp, err := c.do(ctx, ref, request{method: http.MethodGet, path: "/manifests/" + ref.Identifier(), accept: manifestAccept})
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if ref.Digest != "" {
+		digest = ref.Digest
+	}
+	if digest != "" {
+		if err := verifyContent(digest, raw); err != nil {
+			return nil, nil, "", fmt.Errorf("oci: manifest for %s: %w", ref, err)
+		}
+	}
+	var m Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, nil, "", fmt.Errorf("oci: decoding manifest for %s: %w", ref, err)
+	}
+	if m.MediaType == "" {
+		m.MediaType = resp.Header.Get("Content-Type")
+	}
+	return &m, raw, digest, nil
+}
+
+// GetBlob reads the blob with the given digest from ref's repository,
+// refusing blobs larger than limit bytes.
+func (c *Client) GetBlob(ctx context.Context, ref Reference, digest string, limit int64) ([]byte, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	resp, err := c.do(ctx, ref, request{method: http.MethodGet, path: "/blobs/" + digest})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("oci: blob %s exceeds %d bytes", digest, limit)
+	}
+	if err := verifyContent(digest, data); err != nil {
+		return nil, fmt.Errorf("oci: blob %s: %w", digest, err)
+	}
+	return data, nil
+}
+
+// verifyContent checks data against digest. Content addressed by an
+// algorithm this client cannot compute is accepted as the registry
+// returned it.
+func verifyContent(d string, data []byte) error {
+	alg, _, err := digest.Parse(d)
+	if err != nil {
+		return err
+	}
+	if !digest.Supported(alg) {
+		return nil
+	}
+	return digest.Verify(d, data)
+}
+
+// OpenBlob streams the blob with the given digest from ref's repository.
+// The caller must close the returned reader.
+func (c *Client) OpenBlob(ctx context.Context, ref Reference, digest string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, ref, request{method: http.MethodGet, path: "/blobs/" + digest})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// maxTagPages bounds how many pages of a tag list ListTags follows.
+const maxTagPages = 20
+
+// ListTags returns the tags of ref's repository, following the registry's
+// pagination links.
+func (c *Client) ListTags(ctx context.Context, ref Reference) ([]string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	var tags []string
+	path := "/tags/list?n=1000"
+	for page := 0; path != "" && page < maxTagPages; page++ {
+		resp, err := c.do(ctx, ref, request{method: http.MethodGet, path: path, accept: "application/json"})
+		if err != nil {
+			return nil, err
+		}
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("oci: decoding tags of %s: %w", ref.Name(), err)
+		}
+		tags = append(tags, list.Tags...)
+		path = nextPage(resp.Header.Get("Link"), c.scheme(ref.Registry), resp.Request.URL.Host)
+	}
+	return tags, nil
+}
+
+// nextPage returns the absolute URL of a Link header's rel="next" target,
+// or "" when there is none.
+func nextPage(link, scheme, host string) string {
+	target, params, ok := strings.Cut(link, ";")
+	if !ok || !strings.Contains(params, `rel="next"`) {
+		return ""
+	}
+	target = strings.Trim(strings.TrimSpace(target), "<>")
+	if strings.HasPrefix(target, "/") {
+		target = scheme + "://" + host + target
+	}
+	return target
+}
+
+// ResolvePlatform returns a reference to the image manifest for platform
+// ("os/arch[/variant]") when ref points at an index, or ref pinned to its
+// own digest otherwise.
+func (c *Client) ResolvePlatform(ctx context.Context, ref Reference, platform string) (Reference, *Manifest, error) {
+	m, _, digest, err := c.GetManifest(ctx, ref)
+	if err != nil {
+		return ref, nil, err
+	}
+	if !m.IsIndex() {
+		return ref.WithDigest(digest), m, nil
+	}
+	for _, d := range m.Manifests {
+		if d.Platform != nil && d.Platform.String() == platform {
+			child := ref.WithDigest(d.Digest)
+			cm, _, _, err := c.GetManifest(ctx, child)
+			return child, cm, err
+		}
+	}
+	return ref, nil, fmt.Errorf("oci: %s has no manifest for platform %s", ref, platform)
+}
+
+func (p *Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// PutBlob uploads data to ref's repository unless a blob with the same
+// digest is already present, returning its descriptor.
+func (c *Client) PutBlob(ctx context.Context, ref Reference, mediaType string, data []byte) (Descriptor, error) {
+	sum := sha256.Sum256(data)
+	desc := Descriptor{MediaType: mediaType, Digest: "sha256:" + hex.EncodeToString(sum[:]), Size: int64(len(data))}
+
+	resp, err := c.do(ctx, ref, request{method: http.MethodHead, path: "/blobs/" + desc.Digest, push: true})
+	if err == nil {
+		resp.Body.Close()
+		return desc, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return desc, err
+	}
+
+	resp, err = c.do(ctx, ref, request{method: http.MethodPost, path: "/blobs/uploads/", push: true})
+	if err != nil {
+		return desc, err
+	}
+	resp.Body.Close()
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return desc, errors.New("oci: registry returned no upload location")
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return desc, fmt.Errorf("oci: bad upload location: %w", err)
+	}
+	if !u.IsAbs() {
+		base, _ := url.Parse(c.endpoint(ref, "/"))
+		u = base.ResolveReference(u)
+	}
+	q := u.Query()
+	q.Set("digest", desc.Digest)
+	u.RawQuery = q.Encode()
+
+	resp, err = c.do(ctx, ref, request{
+		method:      http.MethodPut,
+		path:        u.String(),
+		contentType: "application/octet-stream",
+		body:        data,
+		push:        true,
+	})
+	if err != nil {
+		return desc, err
+	}
+	resp.Body.Close()
+	return desc, nil
+}
+
+// PutManifest uploads m under ref's tag (or digest) and returns its digest.
+func (c *Client) PutManifest(ctx context.Context, ref Reference, m *Manifest) (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(ctx, ref, request{
+		method:      http.MethodPut,
+		path:        "/manifests/" + ref.Identifier(),
+		contentType: m.MediaType,
+		body:        data,
+		push:        true,
+	})
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,77 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/digest"
+)
+
+func TestGetManifestChecksDigest(t *testing.T) {
+	manifest := []byte(`{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.manifest.v1+json"}`)
+	sum := sha512.Sum512(manifest)
+	sha512Digest := "sha512:" + hex.EncodeToString(sum[:])
+	served := manifest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Content-Digest", sha512Digest)
+		w.Write(served)
+	}))
+	defer srv.Close()
+	c := &Client{HTTP: srv.Client(), Insecure: true, Credentials: func(string) (string, string) { return "", "" }}
+	ref, err := ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/app@" + sha512Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, d, err := c.GetManifest(context.Background(), ref); err != nil || d != sha512Digest {
+		t.Fatalf("GetManifest() = %s, %v", d, err)
+	}
+	// Tags are checked against the digest the registry reports.
+	if _, _, _, err := c.GetManifest(context.Background(), ref.WithTag("v1")); err != nil {
+		t.Fatalf("GetManifest(tag): %v", err)
+	}
+
+	served = []byte(`{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.index.v1+json"}`)
+	if _, _, _, err := c.GetManifest(context.Background(), ref); !errors.Is(err, digest.ErrMismatch) {
+		t.Errorf("tampered manifest: %v", err)
+	}
+	if _, err := c.GetBlob(context.Background(), ref, sha512Digest, 1<<20); !errors.Is(err, digest.ErrMismatch) {
+		t.Errorf("tampered blob: %v", err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Send the headers, then stall reading the body.
+		w.Header().Set("Docker-Content-Digest", "sha256:"+strings.Repeat("0", 64))
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-stalled:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(stalled)
+	c := &Client{HTTP: srv.Client(), Insecure: true, Credentials: func(string) (string, string) { return "", "" }, Timeout: 50 * time.Millisecond}
+	ref, err := ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, _, _, err := c.GetManifest(context.Background(), ref); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetManifest() = %v, want the deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("GetManifest() took %s", elapsed)
+	}
+}
@@ -0,0 +1,101 @@
+// Package oci is a small OCI distribution client covering what the demo
+// needs: resolving tags, and reading and writing manifests and blobs.
+package oci
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultRegistry = "index.docker.io"
+	defaultTag      = "latest"
+)
+
+// Reference is a parsed image reference.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses an image reference such as
+// "ghcr.io/org/app:v1" or "localhost:5000/app@sha256:...".
+func ParseReference(s string) (Reference, error) {
+	var ref Reference
+	if s == "" {
+		return ref, fmt.Errorf("empty image reference")
+	}
+	name := s
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if !strings.Contains(ref.Digest, ":") {
+			return ref, fmt.Errorf("invalid digest in reference %q", s)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i:], "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+
+	if i := strings.Index(name, "/"); i >= 0 && isRegistryHost(name[:i]) {
+		ref.Registry = name[:i]
+		ref.Repository = name[i+1:]
+	} else {
+		ref.Registry = defaultRegistry
+		ref.Repository = name
+	}
+	if ref.Registry == defaultRegistry && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	if ref.Repository == "" {
+		return ref, fmt.Errorf("missing repository in reference %q", s)
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = defaultTag
+	}
+	return ref, nil
+}
+
+func isRegistryHost(s string) bool {
+	return strings.ContainsAny(s, ".:") || s == "localhost"
+}
+
+// Identifier returns the digest if known, otherwise the tag.
+func (r Reference) Identifier() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// Name returns registry/repository without tag or digest.
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// WithDigest returns a copy of r pinned to digest.
+func (r Reference) WithDigest(digest string) Reference {
+	r.Digest = digest
+	return r
+}
+
+// WithTag returns a copy of r pointing at tag, dropping any digest.
+func (r Reference) WithTag(tag string) Reference {
+	r.Tag = tag
+	r.Digest = ""
+	return r
+}
+
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
@@ -0,0 +1,32 @@
+package oci
+
+import "testing"
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Reference
+	}{
+		{"nginx", Reference{Registry: "index.docker.io", Repository: "library/nginx", Tag: "latest"}},
+		{"ghcr.io/org/app:v1", Reference{Registry: "ghcr.io", Repository: "org/app", Tag: "v1"}},
+		{"localhost:5000/app", Reference{Registry: "localhost:5000", Repository: "app", Tag: "latest"}},
+		{"registry.local/app@sha256:abc", Reference{Registry: "registry.local", Repository: "app", Digest: "sha256:abc"}},
+		{"org/app:v2@sha256:abc", Reference{Registry: "index.docker.io", Repository: "org/app", Tag: "v2", Digest: "sha256:abc"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseReference(tt.in)
+		if err != nil {
+			t.Errorf("ParseReference(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseReference(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "app@nodigest"} {
+		if _, err := ParseReference(bad); err == nil {
+			t.Errorf("ParseReference(%q) succeeded, want error", bad)
+		}
+	}
+}
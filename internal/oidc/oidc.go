@@ -0,0 +1,263 @@
+// Package oidc signs users in with an OpenID Connect provider, using the
+// authorization code flow with PKCE (RFC 7636). The provider's endpoints
+// are discovered from its issuer URL on first use.
+//
+// The ID token is received directly from the provider's token endpoint
+// over TLS, so, as OpenID Connect Core 1.0 section 3.1.3.7 allows, its
+// signature is not checked; its issuer, audience, expiry and nonce are.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/httpclient"
+)
+
+// Provider is the part of a provider's discovery document the flow uses.
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+// Client is an OpenID Connect relying party, safe for concurrent use.
+type Client struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback the provider returns the code to.
+	RedirectURL string
+	// Scopes are requested in addition to openid.
+	Scopes []string
+	HTTP   *http.Client
+
+	mu       sync.Mutex
+	provider *Provider
+}
+
+// NewClient returns a client for the provider at issuer.
+func NewClient(issuer, clientID, clientSecret, redirectURL string) *Client {
+	return &Client{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"email"},
+		HTTP:         httpclient.Default(),
+	}
+}
+
+// Claims are the ID token claims the flow checks and returns.
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	ExpiresAt     int64    `json:"exp"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+}
+
+// Identity is the verified email address of the user, or their subject
+// when the provider gives no verified email.
+func (c *Claims) Identity() string {
+	if c.Email != "" && c.EmailVerified {
+		return c.Email
+	}
+	return c.Subject
+}
+
+// audience is the aud claim, a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// NewVerifier returns a random PKCE code verifier.
+func NewVerifier() string { return random() }
+
+// NewState returns a random state or nonce.
+func NewState() string { return random() }
+
+func random() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Challenge returns the S256 code challenge of verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Discover fetches the provider's discovery document, once.
+func (c *Client) Discover(ctx context.Context) (*Provider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.provider != nil {
+		return c.provider, nil
+	}
+	var p Provider
+	issuer := strings.TrimSuffix(c.Issuer, "/")
+	if err := c.do(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil, &p); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(p.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("oidc: discovery document of %s is for issuer %s", c.Issuer, p.Issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" {
+		return nil, fmt.Errorf("oidc: discovery document of %s has no authorization or token endpoint", c.Issuer)
+	}
+	c.provider = &p
+	return c.provider, nil
+}
+
+// AuthCodeURL returns the URL to send the user to to sign in. state and
+// nonce are checked on the way back; verifier is kept for Exchange.
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	p, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.ClientID},
+		"redirect_uri":          {c.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, c.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems code for an ID token and returns its claims, once
+// they are checked against the issuer, the client, the time now and the
+// nonce of the sign-in.
+func (c *Client) Exchange(ctx context.Context, code, verifier, nonce string, now time.Time) (*Claims, error) {
+	p, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.RedirectURL},
+		"client_id":     {c.ClientID},
+		"code_verifier": {verifier},
+	}
+	if c.ClientSecret != "" {
+		form.Set("client_secret", c.ClientSecret)
+	}
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := c.do(ctx, http.MethodPost, p.TokenEndpoint, form, &tok); err != nil {
+		return nil, err
+	}
+	if tok.IDToken == "" {
+		return nil, errors.New("oidc: token response has no ID token")
+	}
+	claims, err := parseIDToken(tok.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != strings.TrimSuffix(p.Issuer, "/"):
+		return nil, fmt.Errorf("oidc: ID token issued by %s, not %s", claims.Issuer, p.Issuer)
+	case !claims.Audience.contains(c.ClientID):
+		return nil, fmt.Errorf("oidc: ID token is not for client %s", c.ClientID)
+	case now.After(time.Unix(claims.ExpiresAt, 0)):
+		return nil, errors.New("oidc: ID token has expired")
+	case claims.Nonce != nonce:
+		return nil, errors.New("oidc: ID token nonce does not match the sign-in")
+	case claims.Subject == "":
+		return nil, errors.New("oidc: ID token has no subject")
+	}
+	return claims, nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func parseIDToken(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("oidc: ID token is not a JWT")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("oidc: decoding ID token claims: %w", err)
+	}
+	var claims Claims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, fmt.Errorf("oidc: decoding ID token claims: %w", err)
+	}
+	return &claims, nil
+}
+
+// do sends a request, with form as its body when set, and decodes the
+// JSON response into out.
+func (c *Client) do(ctx context.Context, method, u string, form url.Values, out any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = httpclient.Default()
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("oidc: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("oidc: %s %s: %s: %s", method, u, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("oidc: decoding %s response: %w", u, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/fake"
+)
+
+// signIn follows the authorization URL to the provider and returns the
+// code and state it redirects back with.
+func signIn(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	hc := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := hc.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: %s", resp.Status)
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	provider := fake.NewOIDC(t, "slsa-demo")
+	c := NewClient(provider.URL, "slsa-demo", "", "https://demo.example.com/auth/callback")
+	ctx := context.Background()
+
+	verifier, nonce := NewVerifier(), NewState()
+	authURL, err := c.AuthCodeURL(ctx, "state-1", nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(authURL, "code_challenge="+Challenge(verifier)) || !strings.Contains(authURL, "scope=openid+email") {
+		t.Errorf("AuthCodeURL = %s", authURL)
+	}
+	code, state := signIn(t, authURL)
+	if state != "state-1" {
+		t.Errorf("state = %q", state)
+	}
+	claims, err := c.Exchange(ctx, code, verifier, nonce, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Identity() != "admin@example.com" || claims.Issuer != provider.URL {
+		t.Errorf("claims = %+v", claims)
+	}
+	// Codes are redeemed once.
+	if _, err := c.Exchange(ctx, code, verifier, nonce, time.Now()); err == nil {
+		t.Error("redeeming a code twice succeeded")
+	}
+
+	tests := []struct {
+		name     string
+		verifier string
+		nonce    string
+		now      time.Time
+	}{
+		{"wrong verifier", NewVerifier(), nonce, time.Now()},
+		{"wrong nonce", verifier, NewState(), time.Now()},
+		{"expired", verifier, nonce, time.Now().Add(2 * time.Hour)},
+	}
+	for _, tt := range tests {
+		code, _ := signIn(t, authURL)
+		if _, err := c.Exchange(ctx, code, tt.verifier, tt.nonce, tt.now); err == nil {
+			t.Errorf("%s: Exchange succeeded", tt.name)
+		}
+	}
+}
+
+func TestDiscoverChecksIssuer(t *testing.T) {
+	provider := fake.NewOIDC(t, "slsa-demo")
+	c := NewClient(provider.URL+"/tenant", "slsa-demo", "", "https://demo.example.com/auth/callback")
+	if _, err := c.Discover(context.Background()); err == nil {
+		t.Error("Discover accepted a provider without a discovery document at the issuer")
+	}
+}
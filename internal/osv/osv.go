@@ -0,0 +1,180 @@
+// Package osv looks up known vulnerabilities for SBOM components in the
+// OSV database.
+package osv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/httpclient"
+)
+
+// DefaultURL is the public OSV API.
+const DefaultURL = "https://api.osv.dev"
+
+// maxBatch is the number of queries OSV accepts per querybatch call.
+const maxBatch = 1000
+
+// Package identifies a package within an OSV ecosystem.
+type Package struct {
+	Name      string `json:"name"`
+	Ecosystem string `json:"ecosystem"`
+}
+
+// Query asks for vulnerabilities affecting one package version.
+type Query struct {
+	Package Package `json:"package"`
+	Version string  `json:"version"`
+}
+
+// Vulnerability is an OSV record.
+type Vulnerability struct {
+	ID               string         `json:"id"`
+	Summary          string         `json:"summary,omitempty"`
+	Details          string         `json:"details,omitempty"`
+	Aliases          []string       `json:"aliases,omitempty"`
+	Severity         []Severity     `json:"severity,omitempty"`
+	Affected         []Affected     `json:"affected,omitempty"`
+	References       []Reference    `json:"references,omitempty"`
+	DatabaseSpecific map[string]any `json:"database_specific,omitempty"`
+}
+
+// Severity is a scored severity, typically a CVSS vector.
+type Severity struct {
+	Type  string `json:"type"`
+	Score string `json:"score"`
+}
+
+// Affected lists the affected versions of one package.
+type Affected struct {
+	Package           Package        `json:"package"`
+	Ranges            []Range        `json:"ranges,omitempty"`
+	EcosystemSpecific map[string]any `json:"ecosystem_specific,omitempty"`
+	DatabaseSpecific  map[string]any `json:"database_specific,omitempty"`
+}
+
+// Range is a sequence of introduced/fixed events.
+type Range struct {
+	Type   string  `json:"type"`
+	Events []Event `json:"events"`
+}
+
+// Event marks a version where a vulnerability was introduced or fixed.
+type Event struct {
+	Introduced string `json:"introduced,omitempty"`
+	Fixed      string `json:"fixed,omitempty"`
+}
+
+// Reference is a link to an advisory, fix or report.
+type Reference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// Client queries the OSV API.
+type Client struct {
+	URL  string
+	HTTP *http.Client
+}
+
+// NewClient returns a client for the public OSV API.
+func NewClient() *Client {
+	return &Client{URL: DefaultURL, HTTP: httpclient.Default()}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body any, out any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.URL, "/")+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = httpclient.Default()
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("osv: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("osv: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("osv: decoding %s response: %w", path, err)
+	}
+	return nil
+}
+
+// QueryBatch returns, for each query, the IDs of vulnerabilities affecting
+// it.
+func (c *Client) QueryBatch(ctx context.Context, queries []Query) ([][]string, error) {
+	ids := make([][]string, 0, len(queries))
+	for start := 0; start < len(queries); start += maxBatch {
+		end := min(start+maxBatch, len(queries))
+		var resp struct {
+			Results []struct {
+				Vulns []struct {
+					ID string `json:"id"`
+				} `json:"vulns"`
+			} `json:"results"`
+		}
+		if err := c.do(ctx, http.MethodPost, "/v1/querybatch", map[string]any{"queries": queries[start:end]}, &resp); err != nil {
+			return nil, err
+		}
+		if len(resp.Results) != end-start {
+			return nil, fmt.Errorf("osv: got %d results for %d queries", len(resp.Results), end-start)
+		}
+		for _, r := range resp.Results {
+			var vs []string
+			for _, v := range r.Vulns {
+				vs = append(vs, v.ID)
+			}
+			ids = append(ids, vs)
+		}
+	}
+	return ids, nil
+}
+
+// Vuln fetches the full record for id.
+func (c *Client) Vuln(ctx context.Context, id string) (*Vulnerability, error) {
+	var v Vulnerability
+	if err := c.do(ctx, http.MethodGet, "/v1/vulns/"+id, nil, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// FixedVersion returns the first version fixing the vulnerability for the
+// named package, or "" if no fix is recorded.
+func (v *Vulnerability) FixedVersion(pkg string) string {
+	for _, a := range v.Affected {
+		if a.Package.Name != pkg {
+			continue
+		}
+		for _, r := range a.Ranges {
+			for _, e := range r.Events {
+				if e.Fixed != "" {
+					return e.Fixed
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,170 @@
+package osv
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/sbom"
+)
+
+func TestCVSS3BaseScore(t *testing.T) {
+	tests := []struct {
+		vector string
+		want   float64
+	}{
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", 9.8},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H", 10.0},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:H", 7.5},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N", 6.1},
+		{"CVSS:3.0/AV:L/AC:H/PR:H/UI:R/S:U/C:L/I:N/A:N", 1.8},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:N", 0},
+	}
+	for _, tt := range tests {
+		got, ok := CVSS3BaseScore(tt.vector)
+		if !ok || got != tt.want {
+			t.Errorf("CVSS3BaseScore(%q) = %v, %v; want %v", tt.vector, got, ok, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "CVSS:2.0/AV:N", "CVSS:3.1/AV:X/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"} {
+		if _, ok := CVSS3BaseScore(bad); ok {
+			t.Errorf("CVSS3BaseScore(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestQueryFor(t *testing.T) {
+	alpine := &sbom.Distro{ID: "alpine", VersionID: "3.19.1"}
+	debian := &sbom.Distro{ID: "debian", VersionID: "12"}
+	tests := []struct {
+		comp   sbom.Component
+		distro *sbom.Distro
+		want   Query
+		ok     bool
+	}{
+		{sbom.Component{Type: sbom.TypeGolang, Name: "stdlib", Version: "go1.21.5"}, nil,
+			Query{Package{"stdlib", "Go"}, "1.21.5"}, true},
+		{sbom.Component{Type: sbom.TypeGolang, Name: "golang.org/x/net", Version: "v0.17.0"}, nil,
+			Query{Package{"golang.org/x/net", "Go"}, "v0.17.0"}, true},
+		{sbom.Component{Type: sbom.TypeGolang, Name: "example.com/app", Version: "(devel)"}, nil, Query{}, false},
+		{sbom.Component{Type: sbom.TypeAPK, Name: "musl", Version: "1.2.4-r2"}, alpine,
+			Query{Package{"musl", "Alpine:v3.19"}, "1.2.4-r2"}, true},
+		{sbom.Component{Type: sbom.TypeAPK, Name: "musl", Version: "1.2.4-r2"}, nil, Query{}, false},
+		{sbom.Component{Type: sbom.TypeDeb, Name: "libc6", Version: "2.36-9"}, debian,
+			Query{Package{"libc6", "Debian:12"}, "2.36-9"}, true},
+	}
+	for _, tt := range tests {
+		got, ok := QueryFor(tt.comp, tt.distro)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("QueryFor(%+v) = %+v, %v; want %+v, %v", tt.comp, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// fakeOSV serves querybatch and vulns from a fixed package → IDs table.
+func fakeOSV(t *testing.T, affected map[string][]string, vulns map[string]Vulnerability) *Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/querybatch", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Queries []Query `json:"queries"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		type vuln struct {
+			ID string `json:"id"`
+		}
+		var resp struct {
+			Results []struct {
+				Vulns []vuln `json:"vulns,omitempty"`
+			} `json:"results"`
+		}
+		resp.Results = make([]struct {
+			Vulns []vuln `json:"vulns,omitempty"`
+		}, len(req.Queries))
+		for i, q := range req.Queries {
+			for _, id := range affected[q.Package.Name+"@"+q.Version] {
+				resp.Results[i].Vulns = append(resp.Results[i].Vulns, vuln{id})
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/v1/vulns/", func(w http.ResponseWriter, r *http.Request) {
+		v, ok := vulns[strings.TrimPrefix(r.URL.Path, "/v1/vulns/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(v)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return &Client{URL: srv.URL, HTTP: srv.Client()}
+}
+
+func TestScan(t *testing.T) {
+	client := fakeOSV(t,
+		map[string][]string{
+			"golang.org/x/net@v0.17.0": {"GO-2023-2102", "GHSA-qppj-fm5r-hxr3"},
+			"stdlib@1.21.0":            {"GO-2023-2041"},
+		},
+		map[string]Vulnerability{
+			"GO-2023-2102": {
+				ID: "GO-2023-2102", Aliases: []string{"CVE-2023-44487", "GHSA-qppj-fm5r-hxr3"},
+				Summary: "HTTP/2 rapid reset",
+				Affected: []Affected{{Package: Package{"golang.org/x/net", "Go"},
+					Ranges: []Range{{Type: "SEMVER", Events: []Event{{Introduced: "0"}, {Fixed: "0.17.0"}}}}}},
+			},
+			"GHSA-qppj-fm5r-hxr3": {
+				ID: "GHSA-qppj-fm5r-hxr3", Aliases: []string{"CVE-2023-44487", "GO-2023-2102"},
+				Severity: []Severity{{Type: "CVSS_V3", Score: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:H"}},
+			},
+			"GO-2023-2041": {
+				ID: "GO-2023-2041", DatabaseSpecific: map[string]any{"severity": "MODERATE"},
+			},
+		})
+	doc := &sbom.Document{
+		Name: "app",
+		Components: []sbom.Component{
+			{Type: sbom.TypeGolang, Name: "stdlib", Version: "go1.21.0"},
+			{Type: sbom.TypeGolang, Name: "golang.org/x/net", Version: "v0.17.0"},
+			{Type: sbom.TypeGolang, Name: "example.com/app", Version: "(devel)"},
+		},
+	}
+	report, err := Scan(context.Background(), client, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != 2 || report.Skipped != 1 {
+		t.Errorf("scanned %d, skipped %d; want 2, 1", report.Scanned, report.Skipped)
+	}
+	if len(report.Findings) != 2 {
+		t.Fatalf("got %d findings, want 2 (aliases merged): %+v", len(report.Findings), report.Findings)
+	}
+	first := report.Findings[0]
+	if first.ID != "GO-2023-2102" || first.Severity != LevelHigh || first.Score != 7.5 || first.FixedIn != "0.17.0" {
+		t.Errorf("first finding = %+v", first)
+	}
+	if second := report.Findings[1]; second.ID != "GO-2023-2041" || second.Severity != LevelMedium {
+		t.Errorf("second finding = %+v", second)
+	}
+	if report.Max() != LevelHigh || report.AtLeast(LevelMedium) != 2 || report.AtLeast(LevelCritical) != 0 {
+		t.Errorf("Max = %v, AtLeast(medium) = %d", report.Max(), report.AtLeast(LevelMedium))
+	}
+
+	log := report.SARIF("test", "0")
+	if n := len(log.Runs[0].Results); n != 2 {
+		t.Fatalf("SARIF has %d results, want 2", n)
+	}
+	if lvl := log.Runs[0].Results[0].Level; lvl != "error" {
+		t.Errorf("high finding has SARIF level %q, want error", lvl)
+	}
+	if uri := log.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI; uri != "app" {
+		t.Errorf("SARIF location = %q, want app", uri)
+	}
+}
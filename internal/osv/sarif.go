@@ -0,0 +1,82 @@
+package osv
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/sarif"
+)
+
+// SARIF converts the report into a SARIF log with one rule per
+// vulnerability and one result per affected component.
+func (r *Report) SARIF(toolName, toolVersion string) *sarif.Log {
+	log := sarif.New(toolName, toolVersion, "https://osv.dev")
+	for _, f := range r.Findings {
+		props := map[string]any{"tags": []string{"security", "vulnerability"}}
+		if score := severityScore(f); score != "" {
+			props["security-severity"] = score
+		}
+		rule := sarif.Rule{
+			ID:         f.ID,
+			Name:       f.ID,
+			HelpURI:    "https://osv.dev/vulnerability/" + f.ID,
+			Properties: props,
+		}
+		if f.Summary != "" {
+			rule.ShortDescription = &sarif.Message{Text: f.Summary}
+		}
+		log.AddRule(rule)
+
+		msg := fmt.Sprintf("%s %s is affected by %s (%s)", f.Package, f.Version, f.ID, f.Severity)
+		if f.FixedIn != "" {
+			msg += "; fixed in " + f.FixedIn
+		}
+		uri := f.Location
+		if uri == "" {
+			uri = r.Target
+		}
+		log.AddResult(sarif.Result{
+			RuleID:    f.ID,
+			Level:     sarifLevel(f.Severity),
+			Message:   sarif.Message{Text: msg},
+			Locations: []sarif.Location{sarif.FileLocation(strings.TrimPrefix(uri, "/"))},
+			Properties: map[string]any{
+				"package":   f.Package,
+				"version":   f.Version,
+				"ecosystem": f.Ecosystem,
+			},
+		})
+	}
+	return log
+}
+
+func sarifLevel(l Level) string {
+	switch l {
+	case LevelCritical, LevelHigh:
+		return sarif.LevelError
+	case LevelMedium:
+		return sarif.LevelWarning
+	default:
+		return sarif.LevelNote
+	}
+}
+
+// severityScore is the "security-severity" rule property GitHub code
+// scanning uses to rank alerts. Without a CVSS score, a representative score
+// for the level is used.
+func severityScore(f Finding) string {
+	if f.Score > 0 {
+		return fmt.Sprintf("%.1f", f.Score)
+	}
+	switch f.Severity {
+	case LevelCritical:
+		return "9.5"
+	case LevelHigh:
+		return "8.0"
+	case LevelMedium:
+		return "5.5"
+	case LevelLow:
+		return "2.0"
+	}
+	return ""
+}
@@ -0,0 +1,189 @@
+package osv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/sbom"
+)
+
+// Finding is a vulnerability affecting one component.
+type Finding struct {
+	ID        string   `json:"id"`
+	Aliases   []string `json:"aliases,omitempty"`
+	Package   string   `json:"package"`
+	Version   string   `json:"version"`
+	Ecosystem string   `json:"ecosystem"`
+	Location  string   `json:"location,omitempty"`
+	Severity  Level    `json:"severity"`
+	Score     float64  `json:"score,omitempty"`
+	FixedIn   string   `json:"fixedIn,omitempty"`
+	Summary   string   `json:"summary,omitempty"`
+}
+
+// Report is the result of scanning an SBOM.
+type Report struct {
+	Target string `json:"target"`
+	Digest string `json:"digest,omitempty"`
+	// Scanned is the number of components that could be queried; Skipped
+	// counts those with no OSV ecosystem or version.
+	Scanned  int       `json:"scanned"`
+	Skipped  int       `json:"skipped"`
+	Findings []Finding `json:"findings"`
+}
+
+// Max returns the highest severity among the findings.
+func (r *Report) Max() Level {
+	var max Level
+	for _, f := range r.Findings {
+		if f.Severity > max {
+			max = f.Severity
+		}
+	}
+	return max
+}
+
+// AtLeast counts the findings at or above level.
+func (r *Report) AtLeast(level Level) int {
+	n := 0
+	for _, f := range r.Findings {
+		if f.Severity >= level {
+			n++
+		}
+	}
+	return n
+}
+
+// QueryFor maps a component onto an OSV query. It reports false for
+// components OSV cannot look up, such as development builds or OS packages
+// from an unknown distribution.
+func QueryFor(c sbom.Component, distro *sbom.Distro) (Query, bool) {
+	if c.Version == "" || c.Version == "(devel)" {
+		return Query{}, false
+	}
+	switch c.Type {
+	case sbom.TypeGolang:
+		if c.Name == "stdlib" {
+			return Query{Package: Package{Name: "stdlib", Ecosystem: "Go"}, Version: strings.TrimPrefix(c.Version, "go")}, true
+		}
+		return Query{Package: Package{Name: c.Name, Ecosystem: "Go"}, Version: c.Version}, true
+	case sbom.TypeAPK:
+		if distro == nil || distro.ID != "alpine" {
+			return Query{}, false
+		}
+		major, rest, _ := strings.Cut(distro.VersionID, ".")
+		minor, _, _ := strings.Cut(rest, ".")
+		if major == "" || minor == "" {
+			return Query{}, false
+		}
+		return Query{Package: Package{Name: c.Name, Ecosystem: "Alpine:v" + major + "." + minor}, Version: c.Version}, true
+	case sbom.TypeDeb:
+		if distro == nil || distro.ID != "debian" || distro.VersionID == "" {
+			return Query{}, false
+		}
+		major, _, _ := strings.Cut(distro.VersionID, ".")
+		return Query{Package: Package{Name: c.Name, Ecosystem: "Debian:" + major}, Version: c.Version}, true
+	}
+	return Query{}, false
+}
+
+// Scan looks up every component of doc in OSV. Findings reported under
+// several aliases for the same package are merged.
+func Scan(ctx context.Context, c *Client, doc *sbom.Document) (*Report, error) {
+	report := &Report{Target: doc.Name, Digest: doc.Digest, Findings: []Finding{}}
+	var (
+		queries []Query
+		comps   []sbom.Component
+	)
+	for _, comp := range doc.Components {
+		q, ok := QueryFor(comp, doc.Distro)
+		if !ok {
+			report.Skipped++
+			continue
+		}
+		queries = append(queries, q)
+		comps = append(comps, comp)
+	}
+	report.Scanned = len(queries)
+	if len(queries) == 0 {
+		return report, nil
+	}
+
+	ids, err := c.QueryBatch(ctx, queries)
+	if err != nil {
+		return nil, err
+	}
+	vulns := make(map[string]*Vulnerability)
+	for i, vs := range ids {
+		// index maps each ID and alias already reported for this
+		// component to its finding.
+		index := make(map[string]int)
+		for _, id := range vs {
+			v, ok := vulns[id]
+			if !ok {
+				if v, err = c.Vuln(ctx, id); err != nil {
+					return nil, fmt.Errorf("fetching %s: %w", id, err)
+				}
+				vulns[id] = v
+			}
+			score, level := v.Rating()
+			if n, dup := lookup(index, v); dup {
+				f := &report.Findings[n]
+				if level > f.Severity || (level == f.Severity && score > f.Score) {
+					f.Severity, f.Score = level, score
+				}
+				continue
+			}
+			q := queries[i]
+			index[v.ID] = len(report.Findings)
+			for _, a := range v.Aliases {
+				index[a] = len(report.Findings)
+			}
+			report.Findings = append(report.Findings, Finding{
+				ID:        v.ID,
+				Aliases:   v.Aliases,
+				Package:   q.Package.Name,
+				Version:   q.Version,
+				Ecosystem: q.Package.Ecosystem,
+				Location:  comps[i].Location,
+				Severity:  level,
+				Score:     score,
+				FixedIn:   v.FixedVersion(q.Package.Name),
+				Summary:   v.Summary,
+			})
+		}
+	}
+	report.SortFindings()
+	return report, nil
+}
+
+// SortFindings orders the findings most severe first, then by package and
+// ID.
+func (r *Report) SortFindings() {
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		a, b := r.Findings[i], r.Findings[j]
+		if a.Severity != b.Severity {
+			return a.Severity > b.Severity
+		}
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.ID < b.ID
+	})
+}
+
+// lookup returns the finding already recorded for v's ID or one of its
+// aliases.
+func lookup(index map[string]int, v *Vulnerability) (int, bool) {
+	if n, ok := index[v.ID]; ok {
+		return n, true
+	}
+	for _, a := range v.Aliases {
+		if n, ok := index[a]; ok {
+			return n, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,169 @@
+package osv
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Level is a qualitative severity, ordered from least to most severe.
+type Level int
+
+const (
+	LevelUnknown Level = iota
+	LevelLow
+	LevelMedium
+	LevelHigh
+	LevelCritical
+)
+
+var levelNames = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+func (l Level) String() string { return levelNames[l] }
+
+// MarshalText encodes the level by name.
+func (l Level) MarshalText() ([]byte, error) { return []byte(l.String()), nil }
+
+// UnmarshalText decodes a level name, as ParseLevel accepts it.
+func (l *Level) UnmarshalText(text []byte) error {
+	level, ok := ParseLevel(string(text))
+	if !ok {
+		return fmt.Errorf("unknown severity %q", text)
+	}
+	*l = level
+	return nil
+}
+
+// ParseLevel accepts level names case-insensitively, including the GitHub
+// advisory name MODERATE for medium.
+func ParseLevel(s string) (Level, bool) {
+	switch strings.ToUpper(s) {
+	case "LOW":
+		return LevelLow, true
+	case "MEDIUM", "MODERATE":
+		return LevelMedium, true
+	case "HIGH":
+		return LevelHigh, true
+	case "CRITICAL":
+		return LevelCritical, true
+	case "UNKNOWN", "":
+		return LevelUnknown, true
+	}
+	return LevelUnknown, false
+}
+
+// LevelForScore maps a CVSS base score onto a qualitative level.
+func LevelForScore(score float64) Level {
+	switch {
+	case score >= 9:
+		return LevelCritical
+	case score >= 7:
+		return LevelHigh
+	case score >= 4:
+		return LevelMedium
+	case score > 0:
+		return LevelLow
+	}
+	return LevelUnknown
+}
+
+// Rating returns the vulnerability's CVSS v3 base score (0 if none is
+// recorded) and severity level. A severity label from the database, such as
+// GitHub's, is used when there is no CVSS vector to score.
+func (v *Vulnerability) Rating() (float64, Level) {
+	for _, s := range v.Severity {
+		if s.Type != "CVSS_V3" {
+			continue
+		}
+		if score, ok := CVSS3BaseScore(s.Score); ok {
+			return score, LevelForScore(score)
+		}
+	}
+	if label, ok := v.DatabaseSpecific["severity"].(string); ok {
+		if l, ok := ParseLevel(label); ok {
+			return 0, l
+		}
+	}
+	for _, a := range v.Affected {
+		for _, m := range []map[string]any{a.EcosystemSpecific, a.DatabaseSpecific} {
+			if label, ok := m["severity"].(string); ok {
+				if l, ok := ParseLevel(label); ok {
+					return 0, l
+				}
+			}
+		}
+	}
+	return 0, LevelUnknown
+}
+
+// CVSS3BaseScore computes the base score of a CVSS v3.0/v3.1 vector such
+// as "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H".
+func CVSS3BaseScore(vector string) (float64, bool) {
+	parts := strings.Split(vector, "/")
+	if len(parts) < 9 || !strings.HasPrefix(parts[0], "CVSS:3") {
+		return 0, false
+	}
+	m := make(map[string]string)
+	for _, p := range parts[1:] {
+		k, v, ok := strings.Cut(p, ":")
+		if !ok {
+			return 0, false
+		}
+		m[k] = v
+	}
+
+	weights := map[string]map[string]float64{
+		"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+		"AC": {"L": 0.77, "H": 0.44},
+		"UI": {"N": 0.85, "R": 0.62},
+		"C":  {"H": 0.56, "L": 0.22, "N": 0},
+		"I":  {"H": 0.56, "L": 0.22, "N": 0},
+		"A":  {"H": 0.56, "L": 0.22, "N": 0},
+	}
+	val := make(map[string]float64)
+	for metric, table := range weights {
+		w, ok := table[m[metric]]
+		if !ok {
+			return 0, false
+		}
+		val[metric] = w
+	}
+	changed := m["S"] == "C"
+	if !changed && m["S"] != "U" {
+		return 0, false
+	}
+	pr := map[string]float64{"N": 0.85, "L": 0.62, "H": 0.27}
+	if changed {
+		pr["L"], pr["H"] = 0.68, 0.5
+	}
+	prVal, ok := pr[m["PR"]]
+	if !ok {
+		return 0, false
+	}
+
+	iss := 1 - (1-val["C"])*(1-val["I"])*(1-val["A"])
+	var impact float64
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	} else {
+		impact = 6.42 * iss
+	}
+	if impact <= 0 {
+		return 0, true
+	}
+	exploitability := 8.22 * val["AV"] * val["AC"] * prVal * val["UI"]
+	if changed {
+		return roundUp(math.Min(1.08*(impact+exploitability), 10)), true
+	}
+	return roundUp(math.Min(impact+exploitability, 10)), true
+}
+
+// roundUp is the CVSS v3.1 Roundup function: the smallest number with one
+// decimal place that is equal to or higher than x.
+func roundUp(x float64) float64 {
+	i := int64(math.Round(x * 100000))
+	if i%10000 == 0 {
+		return float64(i) / 100000
+	}
+	return (math.Floor(float64(i)/10000) + 1) / 10
+}
@@ -0,0 +1,515 @@
+// Package policy evaluates declarative admission policies against the
+// attestations published for an artifact.
+//
+// A policy is a list of rules. Each rule selects attestations by predicate
+// type and passes when at least one of them satisfies all of its
+// conditions; the policy allows the artifact when every rule passes.
+// Policies are written in YAML or JSON:
+//
+//	name: tekton-built
+//	rules:
+//	  - name: built-by-chains
+//	    predicateType: https://slsa.dev/provenance/v1
+//	    conditions:
+//	      - path: predicate.runDetails.builder.id
+//	        matches: ^https://tekton.dev/chains/
+//	      - path: predicate.buildDefinition.resolvedDependencies[*].uri
+//	        oneOf: [git+https://github.com/org/app]
+//
+// A rule can be phased in: before its effectiveFrom date, plus any
+// gracePeriod, a failure is a warning that does not deny the artifact.
+//
+//	rules:
+//	  - name: slsa-l3
+//	    effectiveFrom: 2025-01-01
+//	    gracePeriod: 720h
+//	    predicateType: https://slsa.dev/provenance/v1
+//	    conditions:
+//	      - path: predicate.runDetails.builder.id
+//	        oneOf: [https://tekton.dev/chains/v2]
+//
+// A provenance rule can also require every material of the build to be
+// pinned by digest, rather than by a branch or tag that can move; the
+// materials that are not are reported as the rule's findings.
+//
+//	rules:
+//	  - name: hermetic
+//	    predicateType: https://slsa.dev/provenance/v1
+//	    pinnedMaterials: true
+//
+// It can deny builds run with disallowed parameters, such as insecure
+// flags. Each pattern's name and value are regular expressions matched
+// against the provenance's parameters, flattened into paths such as
+// externalParameters.runSpec.params[0].value:
+//
+//	rules:
+//	  - name: no-insecure-flags
+//	    predicateType: https://slsa.dev/provenance/v1
+//	    disallowedParameters:
+//	      - value: ^--(insecure|skip-tls-verify)
+//	      - name: \.tls-verify$
+//	        value: ^false$
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/strictyaml"
+)
+
+// Policy is a named set of rules.
+type Policy struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Rules       []Rule `json:"rules"`
+}
+
+// Rule requires an attestation of PredicateType (any type when empty)
+// satisfying all Conditions.
+type Rule struct {
+	Name          string      `json:"name"`
+	PredicateType string      `json:"predicateType,omitempty"`
+	Conditions    []Condition `json:"conditions,omitempty"`
+	// EffectiveFrom is the date (2006-01-02) or RFC 3339 time from which
+	// the rule is enforced; failing it earlier only warns. Empty enforces
+	// the rule always.
+	EffectiveFrom string `json:"effectiveFrom,omitempty"`
+	// GracePeriod is a Go duration, such as 720h, that failures keep
+	// warning for after EffectiveFrom.
+	GracePeriod string `json:"gracePeriod,omitempty"`
+	// PinnedMaterials requires every resolved dependency (v0.2 material)
+	// of the provenance to be pinned by digest. PredicateType must then be
+	// a provenance type.
+	PinnedMaterials bool `json:"pinnedMaterials,omitempty"`
+	// DisallowedParameters deny provenance whose build parameters match
+	// any of them. PredicateType must then be a provenance type.
+	DisallowedParameters []ParameterPattern `json:"disallowedParameters,omitempty"`
+
+	// enforcedFrom is when failures start to deny; zero when always.
+	enforcedFrom time.Time
+}
+
+// ParameterPattern matches build parameters by name and value, both
+// regular expressions; an empty one matches anything, but not both.
+type ParameterPattern struct {
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value,omitempty"`
+
+	name, value *regexp.Regexp
+}
+
+func (pp *ParameterPattern) compile() error {
+	if pp.Name == "" && pp.Value == "" {
+		return errors.New("disallowed parameter needs a name or a value")
+	}
+	var err error
+	if pp.Name != "" {
+		if pp.name, err = regexp.Compile(pp.Name); err != nil {
+			return err
+		}
+	}
+	if pp.Value != "" {
+		if pp.value, err = regexp.Compile(pp.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pp *ParameterPattern) match(p attestation.Parameter) bool {
+	return (pp.name == nil || pp.name.MatchString(p.Name)) && (pp.value == nil || pp.value.MatchString(p.Value))
+}
+
+// Condition tests the value at Path in a statement. Path is a dotted field
+// path from the statement root with [n] indexes; [*] matches any element.
+// Exactly one of Equals, OneOf, Matches or Exists is set.
+type Condition struct {
+	Path    string `json:"path"`
+	Equals  any    `json:"equals,omitempty"`
+	OneOf   []any  `json:"oneOf,omitempty"`
+	Matches string `json:"matches,omitempty"`
+	Exists  *bool  `json:"exists,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Decision is the outcome of evaluating a policy.
+type Decision struct {
+	Policy string       `json:"policy"`
+	Allow  bool         `json:"allow"`
+	Rules  []RuleResult `json:"rules"`
+	// Code is POLICY_DENIED when the policy denies.
+	Code failure.Code `json:"code,omitempty"`
+}
+
+// RuleResult is the outcome of one rule, with the reason it failed.
+type RuleResult struct {
+	Rule   string `json:"rule"`
+	Passed bool   `json:"passed"`
+	Reason string `json:"reason,omitempty"`
+	// Warn is set for failures of a rule not yet enforced, which do not
+	// deny the artifact; EnforcedFrom is when the rule starts to.
+	Warn         bool       `json:"warn,omitempty"`
+	EnforcedFrom *time.Time `json:"enforcedFrom,omitempty"`
+	// Findings are the unpinned materials or disallowed parameters that
+	// failed a pinnedMaterials or disallowedParameters rule.
+	Findings []string `json:"findings,omitempty"`
+}
+
+// Violations returns the reasons of the failed rules that deny.
+func (d *Decision) Violations() []string {
+	var v []string
+	for _, r := range d.Rules {
+		if !r.Passed && !r.Warn {
+			v = append(v, r.Rule+": "+r.Reason)
+		}
+	}
+	return v
+}
+
+// Warnings returns the reasons of the failed rules that are not enforced
+// yet, with the time they will be.
+func (d *Decision) Warnings() []string {
+	var w []string
+	for _, r := range d.Rules {
+		if r.Warn {
+			w = append(w, fmt.Sprintf("%s: %s (enforced from %s)", r.Rule, r.Reason, r.EnforcedFrom.Format(time.RFC3339)))
+		}
+	}
+	return w
+}
+
+// Load reads a policy file.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse decodes a YAML or JSON policy and compiles its conditions.
+// Unknown fields and mistyped values are rejected with their position.
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	if err := strictyaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("decoding policy: %w", err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Policy) compile() error {
+	if len(p.Rules) == 0 {
+		return errors.New("policy has no rules")
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if err := r.compileSchedule(); err != nil {
+			return fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		if (r.PinnedMaterials || r.DisallowedParameters != nil) && !attestation.IsProvenance(r.PredicateType) {
+			return fmt.Errorf("rule %s: pinnedMaterials and disallowedParameters need a provenance predicateType", r.Name)
+		}
+		for j := range r.DisallowedParameters {
+			if err := r.DisallowedParameters[j].compile(); err != nil {
+				return fmt.Errorf("rule %s: %w", r.Name, err)
+			}
+		}
+		for j := range r.Conditions {
+			c := &r.Conditions[j]
+			if c.Path == "" {
+				return fmt.Errorf("rule %s: condition %d has no path", r.Name, j+1)
+			}
+			set := 0
+			for _, ok := range []bool{c.Equals != nil, c.OneOf != nil, c.Matches != "", c.Exists != nil} {
+				if ok {
+					set++
+				}
+			}
+			if set != 1 {
+				return fmt.Errorf("rule %s: condition on %s needs exactly one of equals, oneOf, matches or exists", r.Name, c.Path)
+			}
+			if c.Matches != "" {
+				re, err := regexp.Compile(c.Matches)
+				if err != nil {
+					return fmt.Errorf("rule %s: %w", r.Name, err)
+				}
+				c.re = re
+			}
+		}
+	}
+	return nil
+}
+
+// compileSchedule parses when the rule is enforced.
+func (r *Rule) compileSchedule() error {
+	if r.EffectiveFrom == "" {
+		if r.GracePeriod != "" {
+			return errors.New("gracePeriod needs effectiveFrom")
+		}
+		return nil
+	}
+	from, err := ParseTime(r.EffectiveFrom)
+	if err != nil {
+		return fmt.Errorf("effectiveFrom: %w", err)
+	}
+	if r.GracePeriod != "" {
+		grace, err := time.ParseDuration(r.GracePeriod)
+		if err != nil || grace < 0 {
+			return fmt.Errorf("invalid gracePeriod %q", r.GracePeriod)
+		}
+		from = from.Add(grace)
+	}
+	r.enforcedFrom = from.UTC()
+	return nil
+}
+
+// ParseTime parses a date (2006-01-02, midnight UTC) or an RFC 3339 time,
+// as effectiveFrom takes.
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date nor an RFC 3339 time", s)
+	}
+	return t, nil
+}
+
+// Evaluate decides whether stmts satisfy the policy now.
+func (p *Policy) Evaluate(stmts []*attestation.Statement) (*Decision, error) {
+	return p.EvaluateAt(stmts, time.Now())
+}
+
+// EvaluateAt decides whether stmts satisfy the policy at the given time,
+// which decides whether phased-in rules deny or warn.
+func (p *Policy) EvaluateAt(stmts []*attestation.Statement, now time.Time) (*Decision, error) {
+	docs := make([]any, len(stmts))
+	for i, st := range stmts {
+		raw, err := json.Marshal(st)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &docs[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	d := &Decision{Policy: p.Name, Allow: true}
+	for _, r := range p.Rules {
+		res := RuleResult{Rule: r.Name}
+		res.Passed, res.Reason, res.Findings = r.evaluate(stmts, docs)
+		if !r.enforcedFrom.IsZero() {
+			from := r.enforcedFrom
+			res.EnforcedFrom = &from
+			res.Warn = !res.Passed && now.Before(from)
+		}
+		d.Allow = d.Allow && (res.Passed || res.Warn)
+		d.Rules = append(d.Rules, res)
+	}
+	if !d.Allow {
+		d.Code = failure.PolicyDenied
+	}
+	return d, nil
+}
+
+// evaluate reports whether any statement satisfies the rule, and why not
+// otherwise, with the findings of the first failure.
+func (r *Rule) evaluate(stmts []*attestation.Statement, docs []any) (bool, string, []string) {
+	candidates := 0
+	reason := ""
+	var findings []string
+	for i, st := range stmts {
+		if r.PredicateType != "" && st.PredicateType != r.PredicateType {
+			continue
+		}
+		candidates++
+		ok := true
+		for _, c := range r.Conditions {
+			if why, pass := c.evaluate(docs[i]); !pass {
+				ok = false
+				if reason == "" {
+					reason = why
+				}
+				break
+			}
+		}
+		if ok && (r.PinnedMaterials || r.DisallowedParameters != nil) {
+			why, found := r.checkProvenance(st)
+			if ok = why == ""; !ok && reason == "" {
+				reason, findings = why, found
+			}
+		}
+		if ok {
+			return true, "", nil
+		}
+	}
+	if candidates == 0 {
+		if r.PredicateType != "" {
+			return false, "no attestation with predicate type " + r.PredicateType, nil
+		}
+		return false, "no attestations", nil
+	}
+	return false, reason, findings
+}
+
+// checkProvenance reports why the provenance in st fails the rule's
+// pinnedMaterials or disallowedParameters, if it does, and each material
+// or parameter that fails it.
+func (r *Rule) checkProvenance(st *attestation.Statement) (string, []string) {
+	p, err := attestation.NormalizeProvenance(st)
+	if err != nil {
+		return err.Error(), nil
+	}
+	var findings []string
+	if r.PinnedMaterials {
+		for _, m := range p.UnpinnedMaterials() {
+			findings = append(findings, m.String())
+		}
+		if len(findings) > 0 {
+			return fmt.Sprintf("%d material(s) not pinned by digest, e.g. %s", len(findings), findings[0]), findings
+		}
+	}
+	for _, param := range p.Parameters() {
+		for i := range r.DisallowedParameters {
+			if r.DisallowedParameters[i].match(param) {
+				findings = append(findings, param.String())
+				break
+			}
+		}
+	}
+	if len(findings) > 0 {
+		return fmt.Sprintf("%d disallowed parameter(s), e.g. %s", len(findings), findings[0]), findings
+	}
+	return "", nil
+}
+
+// evaluate reports whether any value at the condition's path satisfies it,
+// and why not otherwise.
+func (c *Condition) evaluate(doc any) (string, bool) {
+	values := lookup(doc, c.Path)
+	if c.Exists != nil {
+		if (len(values) > 0) == *c.Exists {
+			return "", true
+		}
+		if *c.Exists {
+			return c.Path + " is not set", false
+		}
+		return c.Path + " is set", false
+	}
+	if len(values) == 0 {
+		return c.Path + " is not set", false
+	}
+	for _, v := range values {
+		switch {
+		case c.Equals != nil && equal(v, c.Equals):
+			return "", true
+		case c.re != nil:
+			if s, ok := v.(string); ok && c.re.MatchString(s) {
+				return "", true
+			}
+		case c.OneOf != nil:
+			for _, want := range c.OneOf {
+				if equal(v, want) {
+					return "", true
+				}
+			}
+		}
+	}
+	got := fmt.Sprint(values[0])
+	if len(values) > 1 {
+		got = fmt.Sprint(values)
+	}
+	switch {
+	case c.Equals != nil:
+		return fmt.Sprintf("%s is %s, want %v", c.Path, got, c.Equals), false
+	case c.re != nil:
+		return fmt.Sprintf("%s is %s, want a match for %s", c.Path, got, c.Matches), false
+	default:
+		return fmt.Sprintf("%s is %s, want one of %v", c.Path, got, c.OneOf), false
+	}
+}
+
+// equal compares decoded JSON values. Numbers from the policy and the
+// statement both decode as float64.
+func equal(a, b any) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// lookup returns the values at path in doc, expanding [*].
+func lookup(doc any, path string) []any {
+	values := []any{doc}
+	for _, seg := range splitPath(path) {
+		var next []any
+		for _, v := range values {
+			switch {
+			case seg == "[*]":
+				if arr, ok := v.([]any); ok {
+					next = append(next, arr...)
+				}
+			case strings.HasPrefix(seg, "["):
+				i, err := strconv.Atoi(strings.Trim(seg, "[]"))
+				if arr, ok := v.([]any); ok && err == nil && i >= 0 && i < len(arr) {
+					next = append(next, arr[i])
+				}
+			default:
+				if m, ok := v.(map[string]any); ok {
+					if field, ok := m[seg]; ok && field != nil {
+						next = append(next, field)
+					}
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// splitPath splits "a.b[0].c[*]" into ["a" "b" "[0]" "c" "[*]"].
+func splitPath(path string) []string {
+	var segs []string
+	for _, part := range strings.Split(path, ".") {
+		for part != "" {
+			i := strings.IndexByte(part, '[')
+			switch {
+			case i < 0:
+				segs = append(segs, part)
+				part = ""
+			case i > 0:
+				segs = append(segs, part[:i])
+				part = part[i:]
+			default:
+				end := strings.IndexByte(part, ']')
+				if end < 0 {
+					segs = append(segs, part)
+					part = ""
+					continue
+				}
+				segs = append(segs, part[:end+1])
+				part = part[end+1:]
+			}
+		}
+	}
+	return segs
+}
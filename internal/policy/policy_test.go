@@ -0,0 +1,253 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+)
+
+const testPolicy = `
+name: tekton-built
+rules:
+  - name: built-by-chains
+    predicateType: https://slsa.dev/provenance/v1
+    conditions:
+      - path: predicate.runDetails.builder.id
+        matches: ^https://tekton.dev/chains/
+      - path: predicate.buildDefinition.resolvedDependencies[*].uri
+        oneOf: [git+https://github.com/org/app]
+  - name: has-sbom
+    predicateType: https://spdx.dev/Document
+`
+
+func statement(t testing.TB, predicateType, predicate string) *attestation.Statement {
+	t.Helper()
+	return &attestation.Statement{
+		Type:          attestation.StatementTypeV1,
+		Subject:       []attestation.Subject{{Name: "app", Digest: map[string]string{"sha256": "abc"}}},
+		PredicateType: predicateType,
+		Predicate:     json.RawMessage(predicate),
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chains := statement(t, attestation.PredicateSLSAProvenanceV1, `{
+		"buildDefinition": {"resolvedDependencies": [{"uri": "oci://base"}, {"uri": "git+https://github.com/org/app"}]},
+		"runDetails": {"builder": {"id": "https://tekton.dev/chains/v2"}}}`)
+	local := statement(t, attestation.PredicateSLSAProvenanceV1, `{
+		"buildDefinition": {"resolvedDependencies": [{"uri": "git+https://github.com/org/app"}]},
+		"runDetails": {"builder": {"id": "https://example.com/laptop"}}}`)
+	sbom := statement(t, "https://spdx.dev/Document", `{}`)
+
+	tests := []struct {
+		name      string
+		stmts     []*attestation.Statement
+		allow     bool
+		violation string
+	}{
+		{"chains with sbom", []*attestation.Statement{local, chains, sbom}, true, ""},
+		{"missing sbom", []*attestation.Statement{chains}, false, "has-sbom: no attestation with predicate type https://spdx.dev/Document"},
+		{"wrong builder", []*attestation.Statement{local, sbom}, false, "predicate.runDetails.builder.id is https://example.com/laptop"},
+		{"nothing", nil, false, "built-by-chains: no attestation"},
+	}
+	for _, tt := range tests {
+		d, err := p.Evaluate(tt.stmts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if d.Allow != tt.allow || (d.Code == failure.PolicyDenied) == tt.allow {
+			t.Errorf("%s: Allow = %v, want %v (%v)", tt.name, d.Allow, tt.allow, d.Violations())
+		}
+		if tt.violation != "" && !strings.Contains(strings.Join(d.Violations(), "\n"), tt.violation) {
+			t.Errorf("%s: violations %q do not mention %q", tt.name, d.Violations(), tt.violation)
+		}
+	}
+}
+
+func TestPhasedInRules(t *testing.T) {
+	p, err := Parse([]byte(`
+rules:
+  - name: has-sbom
+    predicateType: https://spdx.dev/Document
+    effectiveFrom: 2025-01-01
+    gracePeriod: 168h
+  - name: has-vsa
+    predicateType: https://slsa.dev/verification_summary/v1
+    effectiveFrom: "2025-06-01T12:00:00Z"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbom := statement(t, "https://spdx.dev/Document", `{}`)
+
+	tests := []struct {
+		at         time.Time
+		stmts      []*attestation.Statement
+		allow      bool
+		violations int
+		warnings   int
+	}{
+		{time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), nil, true, 0, 2},
+		{time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC), nil, true, 0, 2},
+		{time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC), nil, false, 1, 1},
+		{time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC), []*attestation.Statement{sbom}, true, 0, 1},
+		{time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC), []*attestation.Statement{sbom}, false, 1, 0},
+	}
+	for _, tt := range tests {
+		d, err := p.EvaluateAt(tt.stmts, tt.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Allow != tt.allow || len(d.Violations()) != tt.violations || len(d.Warnings()) != tt.warnings {
+			t.Errorf("at %s with %d statements: Allow = %v, violations %q, warnings %q", tt.at, len(tt.stmts), d.Allow, d.Violations(), d.Warnings())
+		}
+	}
+
+	d, _ := p.EvaluateAt(nil, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	if w := d.Warnings(); len(w) == 0 || !strings.Contains(w[0], "(enforced from 2025-01-08T00:00:00Z)") {
+		t.Errorf("warnings %q do not say when the rule is enforced", w)
+	}
+}
+
+func TestConditions(t *testing.T) {
+	var doc any
+	json.Unmarshal([]byte(`{"a": {"b": [{"c": 1}, {"c": "x"}]}, "n": null}`), &doc)
+	yes, no := true, false
+	tests := []struct {
+		cond Condition
+		want bool
+	}{
+		{Condition{Path: "a.b[0].c", Equals: 1.0}, true},
+		{Condition{Path: "a.b[1].c", Equals: "y"}, false},
+		{Condition{Path: "a.b[*].c", OneOf: []any{"x"}}, true},
+		{Condition{Path: "a.b[5].c", Exists: &yes}, false},
+		{Condition{Path: "n", Exists: &no}, true},
+		{Condition{Path: "a.b", Exists: &no}, false},
+	}
+	for _, tt := range tests {
+		if _, got := tt.cond.evaluate(doc); got != tt.want {
+			t.Errorf("%+v: got %v, want %v", tt.cond, got, tt.want)
+		}
+	}
+}
+
+func TestPinnedMaterials(t *testing.T) {
+	p, err := Parse([]byte("rules:\n  - {name: hermetic, predicateType: " + attestation.PredicateSLSAProvenanceV1 + ", pinnedMaterials: true}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := statement(t, attestation.PredicateSLSAProvenanceV1, `{
+		"buildDefinition": {"resolvedDependencies": [{"uri": "git+https://github.com/org/app@refs/heads/main", "digest": {"sha1": "`+strings.Repeat("a", 40)+`"}}]}}`)
+	floating := statement(t, attestation.PredicateSLSAProvenanceV1, `{
+		"buildDefinition": {"resolvedDependencies": [
+			{"uri": "git+https://github.com/org/app@refs/heads/main"},
+			{"uri": "oci://ghcr.io/org/base:latest"}]}}`)
+
+	d, err := p.Evaluate([]*attestation.Statement{floating})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"git+https://github.com/org/app@refs/heads/main: no digest; it names the branch main",
+		"oci://ghcr.io/org/base:latest: no digest; it names the tag latest",
+	}
+	if d.Allow || !reflect.DeepEqual(d.Rules[0].Findings, want) {
+		t.Errorf("Evaluate(floating) = %+v, want a denial with findings %q", d, want)
+	}
+	if v := d.Violations(); len(v) != 1 || !strings.Contains(v[0], "2 material(s) not pinned by digest") {
+		t.Errorf("violations %q", v)
+	}
+
+	d, err = p.Evaluate([]*attestation.Statement{floating, pinned})
+	if err != nil || !d.Allow || d.Rules[0].Findings != nil {
+		t.Errorf("Evaluate(floating, pinned) = %+v, %v, want allowed", d, err)
+	}
+}
+
+func TestDisallowedParameters(t *testing.T) {
+	p, err := Parse([]byte(`
+rules:
+  - name: no-insecure-flags
+    predicateType: https://slsa.dev/provenance/v1
+    disallowedParameters:
+      - value: ^--(insecure|skip-tls-verify)
+      - name: \.tls-verify$
+        value: ^false$
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	insecure := statement(t, attestation.PredicateSLSAProvenanceV1, `{
+		"buildDefinition": {"externalParameters": {"args": ["build", "--insecure"], "tls-verify": false, "context": "."}}}`)
+	secure := statement(t, attestation.PredicateSLSAProvenanceV1, `{
+		"buildDefinition": {"externalParameters": {"args": ["build"], "tls-verify": true}}}`)
+
+	d, err := p.Evaluate([]*attestation.Statement{insecure})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"externalParameters.args[1] = --insecure", "externalParameters.tls-verify = false"}
+	if d.Allow || !reflect.DeepEqual(d.Rules[0].Findings, want) {
+		t.Errorf("Evaluate(insecure) = %+v, want a denial with findings %q", d, want)
+	}
+	if d, err := p.Evaluate([]*attestation.Statement{secure}); err != nil || !d.Allow {
+		t.Errorf("Evaluate(secure) = %+v, %v, want allowed", d, err)
+	}
+}
+
+func TestParseRejectsInvalidPolicies(t *testing.T) {
+	for name, src := range map[string]string{
+		"no rules":        `name: empty`,
+		"unknown field":   `{"rules": [{"name": "r", "predicate": "x"}]}`,
+		"two operators":   "rules:\n  - conditions:\n      - {path: a, equals: 1, exists: true}\n",
+		"bad expression":  "rules:\n  - conditions:\n      - {path: a, matches: '('}\n",
+		"missing path":    "rules:\n  - conditions:\n      - {equals: 1}\n",
+		"no operator set": "rules:\n  - conditions:\n      - {path: a}\n",
+		"bad date":        "rules:\n  - {name: r, effectiveFrom: next year}\n",
+		"bad grace":       "rules:\n  - {name: r, effectiveFrom: 2025-01-01, gracePeriod: 30 days}\n",
+		"grace only":      "rules:\n  - {name: r, gracePeriod: 720h}\n",
+		"pinned sbom":     "rules:\n  - {name: r, predicateType: https://spdx.dev/Document, pinnedMaterials: true}\n",
+		"empty parameter": "rules:\n  - {name: r, predicateType: https://slsa.dev/provenance/v1, disallowedParameters: [{}]}\n",
+		"bad parameter":   "rules:\n  - {name: r, predicateType: https://slsa.dev/provenance/v1, disallowedParameters: [{value: '('}]}\n",
+	} {
+		if _, err := Parse([]byte(src)); err == nil {
+			t.Errorf("%s: Parse succeeded", name)
+		}
+	}
+}
+
+func BenchmarkEvaluate(b *testing.B) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		b.Fatal(err)
+	}
+	deps := make([]string, 0, 200)
+	for i := 0; i < 199; i++ {
+		deps = append(deps, fmt.Sprintf(`{"uri": "oci://registry.local/base-%d", "digest": {"sha256": "%064d"}}`, i, i))
+	}
+	deps = append(deps, `{"uri": "git+https://github.com/org/app"}`)
+	stmts := []*attestation.Statement{
+		statement(b, attestation.PredicateSLSAProvenanceV1, `{
+			"buildDefinition": {"resolvedDependencies": [`+strings.Join(deps, ",")+`]},
+			"runDetails": {"builder": {"id": "https://tekton.dev/chains/v2"}}}`),
+		statement(b, "https://spdx.dev/Document", `{}`),
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d, err := p.Evaluate(stmts)
+		if err != nil || !d.Allow {
+			b.Fatalf("Evaluate() = %+v, %v", d, err)
+		}
+	}
+}
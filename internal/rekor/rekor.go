@@ -0,0 +1,361 @@
+// Package rekor reads Rekor transparency log entries and verifies the
+// signed entry timestamps and inclusion proofs cosign stores with them.
+package rekor
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/httpclient"
+	"github.com/waveywaves/tekton-slsa-demo/internal/metrics"
+)
+
+// DefaultURL is the public-good Rekor instance.
+const DefaultURL = "https://rekor.sigstore.dev"
+
+// DefaultTimeout is the suggested Client.Timeout.
+const DefaultTimeout = 15 * time.Second
+
+// Bundle is the offline proof of inclusion cosign attaches to signatures in
+// the dev.sigstore.cosign/bundle annotation.
+type Bundle struct {
+	SignedEntryTimestamp []byte        `json:"SignedEntryTimestamp"`
+	Payload              BundlePayload `json:"Payload"`
+}
+
+// BundlePayload is the part of a log entry covered by the signed entry
+// timestamp.
+type BundlePayload struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogIndex       int64  `json:"logIndex"`
+	LogID          string `json:"logID"`
+}
+
+// InclusionProof is a Merkle audit path from an entry to a signed tree head.
+type InclusionProof struct {
+	LogIndex   int64    `json:"logIndex"`
+	RootHash   string   `json:"rootHash"`
+	TreeSize   int64    `json:"treeSize"`
+	Hashes     []string `json:"hashes"`
+	Checkpoint string   `json:"checkpoint,omitempty"`
+}
+
+// LogEntry is an entry as returned by the Rekor API.
+type LogEntry struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+	Verification   struct {
+		InclusionProof       *InclusionProof `json:"inclusionProof,omitempty"`
+		SignedEntryTimestamp []byte          `json:"signedEntryTimestamp,omitempty"`
+	} `json:"verification"`
+}
+
+// ParseBundle decodes a cosign bundle annotation.
+func ParseBundle(s string) (*Bundle, error) {
+	var b Bundle
+	if err := json.Unmarshal([]byte(s), &b); err != nil {
+		return nil, fmt.Errorf("rekor: decoding bundle: %w", err)
+	}
+	if b.Payload.Body == "" || len(b.SignedEntryTimestamp) == 0 {
+		return nil, errors.New("rekor: bundle is missing its body or signed entry timestamp")
+	}
+	return &b, nil
+}
+
+// IntegratedTime returns when the entry was added to the log.
+func (b *Bundle) IntegratedTime() time.Time {
+	return time.Unix(b.Payload.IntegratedTime, 0).UTC()
+}
+
+// VerifySET checks the signed entry timestamp against the log's key.
+func (b *Bundle) VerifySET(pub crypto.PublicKey) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	// Rekor signs the canonical JSON of the payload; encoding a map sorts
+	// the keys as canonicalisation requires.
+	if err := enc.Encode(map[string]any{
+		"body":           b.Payload.Body,
+		"integratedTime": b.Payload.IntegratedTime,
+		"logID":          b.Payload.LogID,
+		"logIndex":       b.Payload.LogIndex,
+	}); err != nil {
+		return err
+	}
+	canonical := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	digest := sha256.Sum256(canonical)
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], b.SignedEntryTimestamp) {
+			return errors.New("rekor: signed entry timestamp does not verify")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, canonical, b.SignedEntryTimestamp) {
+			return errors.New("rekor: signed entry timestamp does not verify")
+		}
+	default:
+		return fmt.Errorf("rekor: unsupported log key type %T", pub)
+	}
+	return nil
+}
+
+// LeafHash returns the RFC 6962 leaf hash of the entry body.
+func (b *Bundle) LeafHash() ([]byte, error) {
+	body, err := base64.StdEncoding.DecodeString(b.Payload.Body)
+	if err != nil {
+		return nil, fmt.Errorf("rekor: decoding body: %w", err)
+	}
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(body)
+	return h.Sum(nil), nil
+}
+
+// entryBody covers the fields of the hashedrekord, dsse and intoto entry
+// kinds needed to bind an entry to a signature.
+type entryBody struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Data struct {
+			Hash struct {
+				Value string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content string `json:"content"`
+		} `json:"signature"`
+		PayloadHash struct {
+			Value string `json:"value"`
+		} `json:"payloadHash"`
+		// Signatures are the envelope's signatures in a dsse entry.
+		Signatures []struct {
+			Signature string `json:"signature"`
+		} `json:"signatures"`
+		Content struct {
+			PayloadHash struct {
+				Value string `json:"value"`
+			} `json:"payloadHash"`
+			// Envelope has the envelope's signatures in an intoto entry,
+			// encoded in base64 a second time.
+			Envelope struct {
+				Signatures []struct {
+					Sig string `json:"sig"`
+				} `json:"signatures"`
+			} `json:"envelope"`
+		} `json:"content"`
+	} `json:"spec"`
+}
+
+// Matches checks that the log entry records this payload and this exact
+// signature, so a bundle cannot be transplanted from another artifact nor
+// vouch for a signature added to a logged envelope.
+func (b *Bundle) Matches(payload, sig []byte) error {
+	raw, err := base64.StdEncoding.DecodeString(b.Payload.Body)
+	if err != nil {
+		return fmt.Errorf("rekor: decoding body: %w", err)
+	}
+	var body entryBody
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return fmt.Errorf("rekor: decoding body: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	want := hex.EncodeToString(sum[:])
+
+	var got string
+	var logged []string
+	switch body.Kind {
+	case "hashedrekord":
+		got = body.Spec.Data.Hash.Value
+		logged = []string{body.Spec.Signature.Content}
+	case "dsse":
+		got = body.Spec.PayloadHash.Value
+		for _, s := range body.Spec.Signatures {
+			logged = append(logged, s.Signature)
+		}
+	case "intoto":
+		got = body.Spec.Content.PayloadHash.Value
+		for _, s := range body.Spec.Content.Envelope.Signatures {
+			inner, err := base64.StdEncoding.DecodeString(s.Sig)
+			if err != nil {
+				return fmt.Errorf("rekor: decoding logged signature: %w", err)
+			}
+			logged = append(logged, string(inner))
+		}
+	default:
+		return fmt.Errorf("rekor: unsupported entry kind %q", body.Kind)
+	}
+	if !strings.EqualFold(got, want) {
+		return errors.New("rekor: entry records a different payload")
+	}
+	for _, l := range logged {
+		if s, err := base64.StdEncoding.DecodeString(l); err == nil && bytes.Equal(s, sig) {
+			return nil
+		}
+	}
+	return errors.New("rekor: entry records a different signature")
+}
+
+// VerifyInclusion checks the audit path in p from leafHash to p.RootHash
+// using the algorithm from RFC 9162 section 2.1.3.2.
+func VerifyInclusion(p *InclusionProof, leafHash []byte) error {
+	if p.LogIndex < 0 || p.TreeSize <= 0 || p.LogIndex >= p.TreeSize {
+		return fmt.Errorf("rekor: index %d outside tree of size %d", p.LogIndex, p.TreeSize)
+	}
+	root, err := hex.DecodeString(p.RootHash)
+	if err != nil {
+		return fmt.Errorf("rekor: decoding root hash: %w", err)
+	}
+	fn, sn := uint64(p.LogIndex), uint64(p.TreeSize-1)
+	r := leafHash
+	for _, h := range p.Hashes {
+		node, err := hex.DecodeString(h)
+		if err != nil {
+			return fmt.Errorf("rekor: decoding proof hash: %w", err)
+		}
+		if sn == 0 {
+			return errors.New("rekor: inclusion proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = hashChildren(node, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = hashChildren(r, node)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return errors.New("rekor: inclusion proof is too short")
+	}
+	if !bytes.Equal(r, root) {
+		return errors.New("rekor: inclusion proof does not lead to the root hash")
+	}
+	return nil
+}
+
+func hashChildren(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// LogID returns the log ID Rekor derives from its public key.
+func LogID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Client is a minimal Rekor API client.
+type Client struct {
+	URL  string
+	HTTP *http.Client
+	// Timeout bounds each request, including reading its response. Zero
+	// leaves requests bounded only by the caller's context and the HTTP
+	// client.
+	Timeout time.Duration
+}
+
+// latency, when set by Instrument, times every request to Rekor.
+var latency atomic.Pointer[metrics.Histogram]
+
+// Instrument records the latency of requests to Rekor, from any Client, in
+// a histogram registered in r.
+func Instrument(r *metrics.Registry) {
+	latency.Store(r.NewHistogram("rekor_request_duration_seconds", "Time to receive the response headers of Rekor API requests.", metrics.LatencyBuckets))
+}
+
+// NewClient returns a client for the Rekor instance at url.
+func NewClient(url string) *Client {
+	return &Client{URL: strings.TrimSuffix(url, "/"), HTTP: httpclient.Default()}
+}
+
+func (c *Client) get(ctx context.Context, path string) ([]byte, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = httpclient.Default()
+	}
+	start := time.Now()
+	resp, err := hc.Do(req)
+	if h := latency.Load(); h != nil {
+		h.ObserveSince(ctx, start)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rekor: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rekor: GET %s: %s", path, resp.Status)
+	}
+	return data, nil
+}
+
+// EntryByIndex fetches the log entry at index along with its inclusion
+// proof.
+func (c *Client) EntryByIndex(ctx context.Context, index int64) (*LogEntry, error) {
+	data, err := c.get(ctx, fmt.Sprintf("/api/v1/log/entries?logIndex=%d", index))
+	if err != nil {
+		return nil, err
+	}
+	var entries map[string]LogEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("rekor: decoding entry: %w", err)
+	}
+	for _, e := range entries {
+		return &e, nil
+	}
+	return nil, fmt.Errorf("rekor: no entry at index %d", index)
+}
+
+// PublicKey fetches the log's public key.
+func (c *Client) PublicKey(ctx context.Context) (crypto.PublicKey, error) {
+	data, err := c.get(ctx, "/api/v1/log/publicKey")
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("rekor: public key is not PEM")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
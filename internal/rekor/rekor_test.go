@@ -0,0 +1,145 @@
+package rekor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func leaf(data string) []byte {
+	h := sha256.Sum256(append([]byte{0}, data...))
+	return h[:]
+}
+
+func TestVerifyInclusion(t *testing.T) {
+	// Tree of five leaves:
+	//            root
+	//          /      \
+	//        k          e
+	//      /   \
+	//    i       j
+	//   / \     / \
+	//  a   b   c   d
+	l := [][]byte{leaf("a"), leaf("b"), leaf("c"), leaf("d"), leaf("e")}
+	i, j := hashChildren(l[0], l[1]), hashChildren(l[2], l[3])
+	k := hashChildren(i, j)
+	root := hex.EncodeToString(hashChildren(k, l[4]))
+
+	tests := []struct {
+		index int64
+		path  [][]byte
+	}{
+		{0, [][]byte{l[1], j, l[4]}},
+		{3, [][]byte{l[2], i, l[4]}},
+		{4, [][]byte{k}},
+	}
+	for _, tt := range tests {
+		p := &InclusionProof{LogIndex: tt.index, TreeSize: 5, RootHash: root}
+		for _, h := range tt.path {
+			p.Hashes = append(p.Hashes, hex.EncodeToString(h))
+		}
+		if err := VerifyInclusion(p, l[tt.index]); err != nil {
+			t.Errorf("index %d: VerifyInclusion() error: %v", tt.index, err)
+		}
+		if err := VerifyInclusion(p, leaf("x")); err == nil {
+			t.Errorf("index %d: VerifyInclusion() accepted the wrong leaf", tt.index)
+		}
+	}
+
+	bad := &InclusionProof{LogIndex: 5, TreeSize: 5, RootHash: root}
+	if err := VerifyInclusion(bad, l[0]); err == nil {
+		t.Error("VerifyInclusion() accepted an index outside the tree")
+	}
+}
+
+func TestBundle(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logID, err := LogID(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte(`{"critical":{}}`)
+	sig := []byte("signature-bytes")
+	sum := sha256.Sum256(payload)
+	body, _ := json.Marshal(map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]any{
+			"data":      map[string]any{"hash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(sum[:])}},
+			"signature": map[string]any{"content": base64.StdEncoding.EncodeToString(sig)},
+		},
+	})
+	b := &Bundle{Payload: BundlePayload{
+		Body:           base64.StdEncoding.EncodeToString(body),
+		IntegratedTime: 1700000000,
+		LogIndex:       42,
+		LogID:          logID,
+	}}
+	canonical, _ := json.Marshal(map[string]any{
+		"body": b.Payload.Body, "integratedTime": b.Payload.IntegratedTime,
+		"logID": b.Payload.LogID, "logIndex": b.Payload.LogIndex,
+	})
+	digest := sha256.Sum256(canonical)
+	if b.SignedEntryTimestamp, err = ecdsa.SignASN1(rand.Reader, key, digest[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := json.Marshal(b)
+	parsed, err := ParseBundle(string(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.VerifySET(key.Public()); err != nil {
+		t.Errorf("VerifySET() error: %v", err)
+	}
+	if err := parsed.Matches(payload, sig); err != nil {
+		t.Errorf("Matches() error: %v", err)
+	}
+	if err := parsed.Matches([]byte("other"), sig); err == nil {
+		t.Error("Matches() accepted a different payload")
+	}
+	if err := parsed.Matches(payload, []byte("other")); err == nil {
+		t.Error("Matches() accepted a different signature")
+	}
+
+	parsed.Payload.LogIndex++
+	if err := parsed.VerifySET(key.Public()); err == nil {
+		t.Error("VerifySET() accepted a tampered log index")
+	}
+}
+
+func TestBundleMatchesEnvelopeKinds(t *testing.T) {
+	payload := []byte(`{"_type":"https://in-toto.io/Statement/v1"}`)
+	sig := []byte("signature-bytes")
+	sum := sha256.Sum256(payload)
+	hash := map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(sum[:])}
+	b64 := base64.StdEncoding.EncodeToString
+	for kind, spec := range map[string]any{
+		"dsse": map[string]any{
+			"payloadHash": hash,
+			"signatures":  []map[string]string{{"signature": b64(sig)}},
+		},
+		"intoto": map[string]any{"content": map[string]any{
+			"payloadHash": hash,
+			"envelope":    map[string]any{"signatures": []map[string]string{{"sig": b64([]byte(b64(sig)))}}},
+		}},
+	} {
+		body, _ := json.Marshal(map[string]any{"apiVersion": "0.0.1", "kind": kind, "spec": spec})
+		b := &Bundle{Payload: BundlePayload{Body: b64(body)}}
+		if err := b.Matches(payload, sig); err != nil {
+			t.Errorf("%s: Matches() error: %v", kind, err)
+		}
+		if err := b.Matches(payload, []byte("other")); err == nil {
+			t.Errorf("%s: Matches() accepted a signature the entry does not record", kind)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Package replay detects replayed and stale provenance. For each image
+// repository it remembers the Rekor log entries of the SLSA provenance that
+// verified, the newest of which is the repository's current build, and
+// flags verifications that present provenance logged before the current
+// build, or a log entry already seen attesting another image.
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/fsutil"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// maxBuilds bounds the builds remembered per repository; the oldest are
+// forgotten first.
+const maxBuilds = 100
+
+// Kinds of Finding.
+const (
+	// KindStale is provenance logged before the repository's current build,
+	// for an image not seen before.
+	KindStale = "stale"
+	// KindSuperseded is the provenance of an earlier build that a newer one
+	// has since replaced.
+	KindSuperseded = "superseded"
+	// KindReplayed is a log entry already seen attesting a different image.
+	KindReplayed = "replayed"
+)
+
+// Build is the logged provenance of one image.
+type Build struct {
+	Digest   string    `json:"digest"`
+	LogIndex int64     `json:"logIndex"`
+	SignedAt time.Time `json:"signedAt"`
+}
+
+// after reports whether b was logged after o. Integrated times have a
+// resolution of a second, so log indexes break ties.
+func (b Build) after(o Build) bool {
+	if !b.SignedAt.Equal(o.SignedAt) {
+		return b.SignedAt.After(o.SignedAt)
+	}
+	return b.LogIndex > o.LogIndex
+}
+
+// Finding is a verified provenance that is stale, superseded or replayed.
+// Whatever its kind, its Code is STALE_PROVENANCE.
+type Finding struct {
+	Kind          string       `json:"kind"`
+	Code          failure.Code `json:"code"`
+	PredicateType string       `json:"predicateType"`
+	LogIndex      int64        `json:"logIndex"`
+	SignedAt      time.Time    `json:"signedAt"`
+	Detail        string       `json:"detail"`
+}
+
+// Report is the outcome of checking one verification result.
+type Report struct {
+	Repository string `json:"repository"`
+	// Digest is the image the result is about.
+	Digest string `json:"digest"`
+	// Current is the newest build of the repository, which may be Digest.
+	Current  Build     `json:"current"`
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+// Alert describes the first finding for people, or returns "" when there
+// are none.
+func (r *Report) Alert() string {
+	if r == nil || len(r.Findings) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Replay: %s provenance for %s@%s: %s", r.Findings[0].Kind, r.Repository, r.Digest, r.Findings[0].Detail)
+}
+
+// Tracker holds the builds seen for each repository, safe for concurrent
+// use. A tracker opened from a file saves every new build back to it.
+type Tracker struct {
+	path string
+
+	mu     sync.Mutex
+	builds map[string][]Build
+}
+
+// New returns a tracker that is kept in memory only.
+func New() *Tracker {
+	return &Tracker{builds: map[string][]Build{}}
+}
+
+// Open reads the state file at path. A missing file has seen no builds.
+func Open(path string) (*Tracker, error) {
+	t := New()
+	t.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &t.builds); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Current returns the newest build seen for repository, as
+// oci.Reference.Name spells it.
+func (t *Tracker) Current(repository string) (Build, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	builds := t.builds[repository]
+	if len(builds) == 0 {
+		return Build{}, false
+	}
+	return builds[len(builds)-1], true
+}
+
+// Check compares the verified, logged provenance in res with the builds
+// seen for its image's repository and records it. It returns nil when res
+// has no such provenance.
+func (t *Tracker) Check(res *verify.Result) (*Report, error) {
+	ref, err := oci.ParseReference(res.Image)
+	if err != nil {
+		return nil, err
+	}
+	repo := ref.Name()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var r *Report
+	added := false
+	for _, c := range res.Checks {
+		if !c.Verified || c.Kind != verify.KindAttestation || !attestation.IsProvenance(c.PredicateType) || c.LogIndex == nil || c.SignedAt == nil {
+			continue
+		}
+		if r == nil {
+			r = &Report{Repository: repo, Digest: res.Digest}
+		}
+		b := Build{Digest: res.Digest, LogIndex: *c.LogIndex, SignedAt: c.SignedAt.UTC()}
+		if f := t.check(repo, b); f != nil {
+			f.PredicateType = c.PredicateType
+			r.Findings = append(r.Findings, *f)
+			continue
+		}
+		added = t.add(repo, b) || added
+	}
+	if r == nil {
+		return nil, nil
+	}
+	if builds := t.builds[repo]; len(builds) > 0 {
+		r.Current = builds[len(builds)-1]
+	}
+	if added && t.path != "" {
+		if err := t.save(); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// check returns a finding when b replays a log entry seen for another
+// image or was logged before the current build of another image. t.mu must
+// be held.
+func (t *Tracker) check(repo string, b Build) *Finding {
+	builds := t.builds[repo]
+	f := &Finding{Code: failure.StaleProvenance, LogIndex: b.LogIndex, SignedAt: b.SignedAt}
+	for _, seen := range builds {
+		if seen.LogIndex == b.LogIndex && seen.Digest != b.Digest {
+			f.Kind = KindReplayed
+			f.Detail = fmt.Sprintf("log entry %d already attested %s", b.LogIndex, seen.Digest)
+			return f
+		}
+	}
+	if len(builds) == 0 {
+		return nil
+	}
+	current := builds[len(builds)-1]
+	if current.Digest == b.Digest || !current.after(b) {
+		return nil
+	}
+	f.Kind = KindStale
+	for _, seen := range builds {
+		if seen.Digest == b.Digest {
+			f.Kind = KindSuperseded
+			break
+		}
+	}
+	f.Detail = fmt.Sprintf("logged at %s, before the current build %s (log entry %d, %s)",
+		b.SignedAt.Format(time.RFC3339), current.Digest, current.LogIndex, current.SignedAt.Format(time.RFC3339))
+	return f
+}
+
+// add records b, keeping the builds of repo oldest first, and reports
+// whether it was new. t.mu must be held.
+func (t *Tracker) add(repo string, b Build) bool {
+	builds := t.builds[repo]
+	for _, seen := range builds {
+		if seen == b {
+			return false
+		}
+	}
+	builds = append(builds, b)
+	sort.SliceStable(builds, func(i, j int) bool { return builds[j].after(builds[i]) })
+	if len(builds) > maxBuilds {
+		builds = builds[len(builds)-maxBuilds:]
+	}
+	t.builds[repo] = builds
+	return true
+}
+
+// save writes the builds to their file, replacing it atomically. t.mu
+// must be held.
+func (t *Tracker) save() error {
+	data, err := json.MarshalIndent(t.builds, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(t.path, append(data, '\n'))
+}
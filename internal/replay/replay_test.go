@@ -0,0 +1,79 @@
+package replay
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+func provenance(logIndex int64, signedAt time.Time) verify.Check {
+	return verify.Check{Kind: verify.KindAttestation, PredicateType: attestation.PredicateSLSAProvenanceV1, LogIndex: &logIndex, SignedAt: &signedAt, Verified: true}
+}
+
+func result(digest string, checks ...verify.Check) *verify.Result {
+	return &verify.Result{Image: "ghcr.io/org/app:v1", Digest: digest, Checks: checks, Verified: true}
+}
+
+func TestTracker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.json")
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	v1 := provenance(100, day)
+	v2 := provenance(200, day.Add(24*time.Hour))
+
+	tr, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlogged := verify.Check{Kind: verify.KindAttestation, PredicateType: attestation.PredicateSLSAProvenanceV1, Verified: true}
+	if r, err := tr.Check(result("sha256:aaa", unlogged)); err != nil || r != nil {
+		t.Fatalf("no logged provenance: report %+v, %v; want nil", r, err)
+	}
+	for _, res := range []*verify.Result{result("sha256:aaa", v1), result("sha256:bbb", v2), result("sha256:bbb", v2)} {
+		r, err := tr.Check(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.Findings) != 0 || r.Current.Digest != res.Digest {
+			t.Fatalf("newer build %s = %+v, want it current", res.Digest, r)
+		}
+	}
+
+	// The builds survive a restart.
+	if tr, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if cur, ok := tr.Current("ghcr.io/org/app"); !ok || cur.Digest != "sha256:bbb" {
+		t.Fatalf("Current() = %+v, %v", cur, ok)
+	}
+
+	tests := []struct {
+		name   string
+		res    *verify.Result
+		kind   string
+		detail string
+	}{
+		{"superseded", result("sha256:aaa", v1), KindSuperseded, "before the current build sha256:bbb"},
+		{"stale", result("sha256:ccc", provenance(150, day.Add(time.Hour))), KindStale, "2024-03-01T13:00:00Z"},
+		{"replayed", result("sha256:ddd", provenance(200, day.Add(48*time.Hour))), KindReplayed, "log entry 200 already attested sha256:bbb"},
+	}
+	for _, tt := range tests {
+		r, err := tr.Check(tt.res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.Findings) != 1 || r.Findings[0].Kind != tt.kind || r.Findings[0].Code != failure.StaleProvenance || !strings.Contains(r.Findings[0].Detail, tt.detail) {
+			t.Errorf("%s: findings %+v, want %s mentioning %q", tt.name, r.Findings, tt.kind, tt.detail)
+		}
+		if r.Current.Digest != "sha256:bbb" {
+			t.Errorf("%s: current build became %s", tt.name, r.Current.Digest)
+		}
+		if alert := r.Alert(); !strings.Contains(alert, tt.kind) || !strings.Contains(alert, "ghcr.io/org/app@"+tt.res.Digest) {
+			t.Errorf("%s: alert %q", tt.name, alert)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package reproducibility compares the digests of independently rebuilt
+// artifacts with the subjects of their provenance. A rebuild whose digest
+// matches is bit-for-bit reproducible; the Tracker records each comparison
+// and the rate at which builds turn out reproducible, day by day.
+package reproducibility
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/digest"
+)
+
+// maxComparisons bounds the comparisons remembered; the oldest are
+// forgotten first.
+const maxComparisons = 1000
+
+// ErrNoSubject is returned when the provenance has no subject to compare a
+// rebuild with.
+var ErrNoSubject = errors.New("no provenance subject to compare with")
+
+// Comparison is the outcome of comparing a rebuild with the provenance
+// subject it reproduces.
+type Comparison struct {
+	AttestationID string `json:"attestationId"`
+	// Subject and Digest are the provenance subject, its digest in the
+	// algorithm of RebuiltDigest.
+	Subject       string `json:"subject"`
+	Digest        string `json:"digest"`
+	RebuiltDigest string `json:"rebuiltDigest"`
+	// Rebuilder identifies who rebuilt the artifact, as they reported it.
+	Rebuilder    string    `json:"rebuilder,omitempty"`
+	Reproducible bool      `json:"reproducible"`
+	ComparedAt   time.Time `json:"comparedAt"`
+}
+
+// Compare compares rebuilt ("alg:hex") with the subjects of the provenance
+// in stmt that carry a digest in its algorithm. When subject is set, only
+// the subject with that digest is compared. The result has no
+// AttestationID, Rebuilder or ComparedAt.
+func Compare(stmt *attestation.Statement, subject, rebuilt string) (Comparison, error) {
+	alg, value, err := digest.Parse(rebuilt)
+	if err != nil {
+		return Comparison{}, err
+	}
+	var c Comparison
+	found := false
+	for _, s := range stmt.Subject {
+		if subject != "" && !digest.InSet(s.Digest, subject) {
+			continue
+		}
+		for k, v := range s.Digest {
+			if digest.Normalize(k) != alg {
+				continue
+			}
+			c = Comparison{Subject: s.Name, Digest: digest.Canonical(alg + ":" + v), RebuiltDigest: alg + ":" + value}
+			found = true
+			if c.Digest == c.RebuiltDigest {
+				c.Reproducible = true
+				return c, nil
+			}
+		}
+	}
+	if !found {
+		if subject != "" {
+			return Comparison{}, fmt.Errorf("%w: no subject has digest %s and a %s digest", ErrNoSubject, subject, alg)
+		}
+		return Comparison{}, fmt.Errorf("%w: no subject has a %s digest", ErrNoSubject, alg)
+	}
+	return c, nil
+}
+
+// Day is the reproducibility of the comparisons made on one UTC day.
+type Day struct {
+	Date         string  `json:"date"`
+	Compared     int     `json:"compared"`
+	Reproducible int     `json:"reproducible"`
+	Rate         float64 `json:"rate"`
+}
+
+// Report is the record of the comparisons of one subject digest, or all.
+type Report struct {
+	Compared     int     `json:"compared"`
+	Reproducible int     `json:"reproducible"`
+	Rate         float64 `json:"rate"`
+	// Days are the days with comparisons, oldest first.
+	Days []Day `json:"days"`
+	// Comparisons are newest first.
+	Comparisons []Comparison `json:"comparisons"`
+}
+
+// Tracker records comparisons, safe for concurrent use.
+type Tracker struct {
+	mu          sync.Mutex
+	comparisons []Comparison
+}
+
+// New returns a tracker with no comparisons.
+func New() *Tracker {
+	return &Tracker{}
+}
+
+// Record adds a comparison.
+func (t *Tracker) Record(c Comparison) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.comparisons = append(t.comparisons, c)
+	if len(t.comparisons) > maxComparisons {
+		t.comparisons = t.comparisons[len(t.comparisons)-maxComparisons:]
+	}
+}
+
+// Rate returns the share of all comparisons that were reproducible, or 0
+// before the first.
+func (t *Tracker) Rate() float64 {
+	return t.Report("").Rate
+}
+
+// Report summarizes the comparisons with the subject digest d, or all of
+// them when d is empty.
+func (t *Tracker) Report(d string) Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := Report{Days: []Day{}, Comparisons: []Comparison{}}
+	d = digest.Canonical(d)
+	for _, c := range t.comparisons {
+		if d != "" && c.Digest != d {
+			continue
+		}
+		r.Comparisons = append(r.Comparisons, c)
+		r.Compared++
+		date := c.ComparedAt.UTC().Format(time.DateOnly)
+		if n := len(r.Days); n == 0 || r.Days[n-1].Date != date {
+			r.Days = append(r.Days, Day{Date: date})
+		}
+		day := &r.Days[len(r.Days)-1]
+		day.Compared++
+		if c.Reproducible {
+			r.Reproducible++
+			day.Reproducible++
+		}
+		day.Rate = float64(day.Reproducible) / float64(day.Compared)
+	}
+	if r.Compared > 0 {
+		r.Rate = float64(r.Reproducible) / float64(r.Compared)
+	}
+	for i, j := 0, len(r.Comparisons)-1; i < j; i, j = i+1, j-1 {
+		r.Comparisons[i], r.Comparisons[j] = r.Comparisons[j], r.Comparisons[i]
+	}
+	return r
+}
@@ -0,0 +1,66 @@
+package reproducibility
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+)
+
+var (
+	app = "sha256:" + strings.Repeat("a", 64)
+	cli = "sha256:" + strings.Repeat("c", 64)
+)
+
+func TestCompare(t *testing.T) {
+	stmt := &attestation.Statement{Subject: []attestation.Subject{
+		{Name: "app", Digest: map[string]string{"sha256": strings.Repeat("a", 64)}},
+		{Name: "cli", Digest: map[string]string{"SHA256": strings.Repeat("C", 64)}},
+	}}
+
+	c, err := Compare(stmt, "", cli)
+	if err != nil || !c.Reproducible || c.Subject != "cli" || c.Digest != cli {
+		t.Errorf("Compare(cli) = %+v, %v; want cli reproducible", c, err)
+	}
+	other := "sha256:" + strings.Repeat("b", 64)
+	c, err = Compare(stmt, cli, other)
+	if err != nil || c.Reproducible || c.Subject != "cli" || c.RebuiltDigest != other {
+		t.Errorf("Compare(other for cli) = %+v, %v; want cli not reproducible", c, err)
+	}
+	if _, err := Compare(stmt, "", "sha512:"+strings.Repeat("a", 128)); !errors.Is(err, ErrNoSubject) {
+		t.Errorf("Compare(sha512) error = %v, want ErrNoSubject", err)
+	}
+	if _, err := Compare(stmt, "", "sha256:short"); err == nil {
+		t.Error("Compare accepted a malformed digest")
+	}
+}
+
+func TestTracker(t *testing.T) {
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tr := New()
+	if tr.Rate() != 0 {
+		t.Errorf("Rate() = %v before any comparison", tr.Rate())
+	}
+	for i, c := range []Comparison{
+		{Digest: app, Reproducible: false, ComparedAt: day},
+		{Digest: app, Reproducible: true, ComparedAt: day.Add(time.Hour)},
+		{Digest: app, Reproducible: true, ComparedAt: day.Add(24 * time.Hour)},
+		{Digest: cli, Reproducible: true, ComparedAt: day.Add(25 * time.Hour)},
+	} {
+		c.Rebuilder = string(rune('a' + i))
+		tr.Record(c)
+	}
+	if tr.Rate() != 0.75 {
+		t.Errorf("Rate() = %v, want 0.75", tr.Rate())
+	}
+	r := tr.Report(strings.ToUpper(app[:7]) + app[7:])
+	if r.Compared != 3 || r.Reproducible != 2 || len(r.Comparisons) != 3 || r.Comparisons[0].Rebuilder != "c" {
+		t.Fatalf("Report(app) = %+v", r)
+	}
+	want := []Day{{"2024-03-01", 2, 1, 0.5}, {"2024-03-02", 1, 1, 1}}
+	if len(r.Days) != len(want) || r.Days[0] != want[0] || r.Days[1] != want[1] {
+		t.Errorf("days = %+v, want %+v", r.Days, want)
+	}
+}
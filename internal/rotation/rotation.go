@@ -0,0 +1,145 @@
+// Package rotation notices when the identity signing an artifact's
+// attestations changes. Each artifact's first signer is accepted as its
+// baseline; an attestation from any other identity raises an event that
+// stays pending until an administrator approves the new identity.
+package rotation
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Identity is who signed an attestation: the subject alternative name and
+// OIDC issuer of a keyless certificate, or the ID of a signing key.
+type Identity struct {
+	Signer string `json:"signer,omitempty"`
+	Issuer string `json:"issuer,omitempty"`
+	KeyID  string `json:"keyId,omitempty"`
+}
+
+func (id Identity) String() string {
+	switch {
+	case id.Signer != "" && id.Issuer != "":
+		return id.Signer + " (" + id.Issuer + ")"
+	case id.Signer != "":
+		return id.Signer
+	default:
+		return "key " + id.KeyID
+	}
+}
+
+// Event records an artifact signed by an identity it was not signed by
+// before.
+type Event struct {
+	ID string `json:"id"`
+	// Subject is the artifact name, as attestation subjects give it.
+	Subject  string   `json:"subject"`
+	Identity Identity `json:"identity"`
+	// Previous are the identities approved for the subject when the event
+	// was raised.
+	Previous      []Identity `json:"previous"`
+	AttestationID string     `json:"attestationId"`
+	DetectedAt    time.Time  `json:"detectedAt"`
+	// ApprovedAt is set once an administrator accepts the new identity.
+	ApprovedAt *time.Time `json:"approvedAt,omitempty"`
+}
+
+// Pending reports whether the event still awaits approval.
+func (e *Event) Pending() bool { return e.ApprovedAt == nil }
+
+func (e *Event) String() string {
+	previous := make([]string, len(e.Previous))
+	for i, id := range e.Previous {
+		previous[i] = id.String()
+	}
+	return fmt.Sprintf("%s is now signed by %s; previously by %s", e.Subject, e.Identity, strings.Join(previous, ", "))
+}
+
+// ErrUnknownEvent is returned by Approve for event IDs it never issued.
+var ErrUnknownEvent = errors.New("rotation event not found")
+
+// Monitor tracks the approved signing identities of each subject, safe for
+// concurrent use.
+type Monitor struct {
+	mu       sync.Mutex
+	approved map[string][]Identity
+	events   []*Event
+}
+
+// NewMonitor returns a monitor that has seen no attestations.
+func NewMonitor() *Monitor {
+	return &Monitor{approved: map[string][]Identity{}}
+}
+
+// Observe records that attestationID about subject was signed by id. It
+// returns the event raised when id differs from the identities approved
+// for subject, or nil when id is approved, is the subject's first signer,
+// or already has a pending event.
+func (m *Monitor) Observe(subject string, id Identity, attestationID string, now time.Time) *Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	approved := m.approved[subject]
+	if len(approved) == 0 {
+		m.approved[subject] = []Identity{id}
+		return nil
+	}
+	for _, a := range approved {
+		if a == id {
+			return nil
+		}
+	}
+	for _, e := range m.events {
+		if e.Pending() && e.Subject == subject && e.Identity == id {
+			return nil
+		}
+	}
+	e := &Event{
+		ID:            strconv.Itoa(len(m.events) + 1),
+		Subject:       subject,
+		Identity:      id,
+		Previous:      append([]Identity(nil), approved...),
+		AttestationID: attestationID,
+		DetectedAt:    now.UTC(),
+	}
+	m.events = append(m.events, e)
+	copied := *e
+	return &copied
+}
+
+// Events returns the events raised so far, newest first; with pendingOnly,
+// only those awaiting approval.
+func (m *Monitor) Events(pendingOnly bool) []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []Event{}
+	for i := len(m.events) - 1; i >= 0; i-- {
+		if e := m.events[i]; !pendingOnly || e.Pending() {
+			out = append(out, *e)
+		}
+	}
+	return out
+}
+
+// Approve accepts the identity of the event with the given ID for its
+// subject, so later attestations it signs raise no event. Approving an
+// event twice is harmless.
+func (m *Monitor) Approve(id string, now time.Time) (Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.events {
+		if e.ID != id {
+			continue
+		}
+		if e.Pending() {
+			at := now.UTC()
+			e.ApprovedAt = &at
+			m.approved[e.Subject] = append(m.approved[e.Subject], e.Identity)
+		}
+		return *e, nil
+	}
+	return Event{}, ErrUnknownEvent
+}
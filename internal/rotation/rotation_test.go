@@ -0,0 +1,53 @@
+package rotation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitor(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ci := Identity{Signer: "https://github.com/org/app/.github/workflows/release.yml@refs/heads/main", Issuer: "https://token.actions.githubusercontent.com"}
+	key := Identity{KeyID: "SHA256:abc"}
+	m := NewMonitor()
+
+	if e := m.Observe("ghcr.io/org/app", ci, "a1", now); e != nil {
+		t.Fatalf("first signer raised %v", e)
+	}
+	if e := m.Observe("ghcr.io/org/app", ci, "a2", now); e != nil {
+		t.Fatalf("same signer raised %v", e)
+	}
+	if e := m.Observe("ghcr.io/org/other", key, "a3", now); e != nil {
+		t.Fatalf("another subject's first signer raised %v", e)
+	}
+
+	e := m.Observe("ghcr.io/org/app", key, "a4", now)
+	if e == nil || e.Identity != key || len(e.Previous) != 1 || e.Previous[0] != ci || e.AttestationID != "a4" || !e.Pending() {
+		t.Fatalf("new signer raised %+v", e)
+	}
+	if !strings.Contains(e.String(), "key SHA256:abc") || !strings.Contains(e.String(), "release.yml") {
+		t.Errorf("event reads %q", e)
+	}
+	if again := m.Observe("ghcr.io/org/app", key, "a5", now); again != nil {
+		t.Errorf("pending identity raised a second event %+v", again)
+	}
+	if pending := m.Events(true); len(pending) != 1 || pending[0].ID != e.ID {
+		t.Fatalf("pending events = %+v", pending)
+	}
+
+	if _, err := m.Approve("nope", now); !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("approving an unknown event: %v", err)
+	}
+	approved, err := m.Approve(e.ID, now.Add(time.Hour))
+	if err != nil || approved.Pending() {
+		t.Fatalf("Approve = %+v, %v", approved, err)
+	}
+	if next := m.Observe("ghcr.io/org/app", key, "a6", now); next != nil {
+		t.Errorf("approved identity raised %+v", next)
+	}
+	if len(m.Events(true)) != 0 || len(m.Events(false)) != 1 {
+		t.Errorf("events after approval: pending %d, all %d", len(m.Events(true)), len(m.Events(false)))
+	}
+}
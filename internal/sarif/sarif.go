@@ -0,0 +1,145 @@
+// Package sarif writes Static Analysis Results Interchange Format 2.1.0
+// logs, the format code scanning dashboards ingest.
+package sarif
+
+import (
+	"encoding/json"
+	"io"
+)
+
+const (
+	Version = "2.1.0"
+	Schema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// Result levels.
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+	LevelNote    = "note"
+	LevelNone    = "none"
+)
+
+// Log is a SARIF log file.
+type Log struct {
+	Version string `json:"version"`
+	Schema  string `json:"$schema"`
+	Runs    []Run  `json:"runs"`
+}
+
+// Run is the output of one tool invocation.
+type Run struct {
+	Tool    Tool     `json:"tool"`
+	Results []Result `json:"results"`
+}
+
+// Tool describes the analysis tool.
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+// Driver is the tool's primary component and the rules it reports.
+type Driver struct {
+	Name           string `json:"name"`
+	Version        string `json:"version,omitempty"`
+	InformationURI string `json:"informationUri,omitempty"`
+	Rules          []Rule `json:"rules"`
+}
+
+// Rule describes a kind of result, e.g. one vulnerability.
+type Rule struct {
+	ID               string         `json:"id"`
+	Name             string         `json:"name,omitempty"`
+	ShortDescription *Message       `json:"shortDescription,omitempty"`
+	FullDescription  *Message       `json:"fullDescription,omitempty"`
+	HelpURI          string         `json:"helpUri,omitempty"`
+	Help             *Message       `json:"help,omitempty"`
+	Properties       map[string]any `json:"properties,omitempty"`
+}
+
+// Message is a plain-text message.
+type Message struct {
+	Text string `json:"text"`
+}
+
+// Result is one reported problem.
+type Result struct {
+	RuleID     string         `json:"ruleId"`
+	RuleIndex  int            `json:"ruleIndex"`
+	Level      string         `json:"level"`
+	Message    Message        `json:"message"`
+	Locations  []Location     `json:"locations,omitempty"`
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+// Location points at the artifact a result is about.
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+// PhysicalLocation is a file and region.
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Region           *Region          `json:"region,omitempty"`
+}
+
+// ArtifactLocation names a file by URI.
+type ArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// Region is a span within an artifact.
+type Region struct {
+	StartLine int `json:"startLine"`
+}
+
+// New returns a log with a single run for the named tool.
+func New(name, version, uri string) *Log {
+	return &Log{
+		Version: Version,
+		Schema:  Schema,
+		Runs: []Run{{
+			Tool:    Tool{Driver: Driver{Name: name, Version: version, InformationURI: uri, Rules: []Rule{}}},
+			Results: []Result{},
+		}},
+	}
+}
+
+// AddRule registers rule with the first run, unless a rule with the same ID
+// exists, and returns its index.
+func (l *Log) AddRule(rule Rule) int {
+	d := &l.Runs[0].Tool.Driver
+	for i, r := range d.Rules {
+		if r.ID == rule.ID {
+			return i
+		}
+	}
+	d.Rules = append(d.Rules, rule)
+	return len(d.Rules) - 1
+}
+
+// AddResult appends a result to the first run, filling in its rule index.
+func (l *Log) AddResult(res Result) {
+	for i, r := range l.Runs[0].Tool.Driver.Rules {
+		if r.ID == res.RuleID {
+			res.RuleIndex = i
+			break
+		}
+	}
+	l.Runs[0].Results = append(l.Runs[0].Results, res)
+}
+
+// FileLocation returns a location pointing at the first line of uri.
+func FileLocation(uri string) Location {
+	return Location{PhysicalLocation: PhysicalLocation{
+		ArtifactLocation: ArtifactLocation{URI: uri},
+		Region:           &Region{StartLine: 1},
+	}}
+}
+
+// Write encodes the log as indented JSON.
+func (l *Log) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
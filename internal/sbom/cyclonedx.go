@@ -0,0 +1,122 @@
+package sbom
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// PredicateTypeCycloneDX is the in-toto predicate type for CycloneDX BOMs.
+const PredicateTypeCycloneDX = "https://cyclonedx.org/bom"
+
+type cdxBOM struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type       string        `json:"type"`
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Hashes     []cdxHash     `json:"hashes,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// CycloneDX encodes the document as CycloneDX 1.5 JSON.
+func (d *Document) CycloneDX() ([]byte, error) {
+	var buf bytes.Buffer
+	err := d.writeCycloneDX(&buf)
+	return buf.Bytes(), err
+}
+
+// writeCycloneDX streams the CycloneDX encoding of the document to w.
+func (d *Document) writeCycloneDX(w io.Writer) error {
+	id := d.namespaceID()
+	root := cdxComponent{
+		Type:    "application",
+		BOMRef:  "root",
+		Name:    d.Root.Name,
+		Version: d.Root.Version,
+	}
+	if root.Name == "" {
+		root.Name = d.Name
+		root.Type = "container"
+	}
+	if alg, value, ok := splitDigest(d.Digest); ok {
+		root.Hashes = []cdxHash{{Alg: cdxAlgorithm(alg), Content: value}}
+	}
+
+	o := newObjectWriter(w)
+	o.field("bomFormat", "CycloneDX")
+	o.field("specVersion", "1.5")
+	o.field("serialNumber", "urn:uuid:"+id[0:8]+"-"+id[8:12]+"-"+id[12:16]+"-"+id[16:20]+"-"+id[20:32])
+	o.field("version", 1)
+	o.field("metadata", cdxMetadata{
+		Timestamp: d.Created.UTC().Format(time.RFC3339),
+		Tools:     cdxTools{Components: []cdxComponent{{Type: "application", Name: d.tool()}}},
+		Component: root,
+	})
+	seen := make(map[string]int)
+	o.array("components", len(d.Components), func(i int) any {
+		c := d.Components[i]
+		// bom-ref must be unique, but the same module can be vendored into
+		// several binaries of one image.
+		ref := c.PURL()
+		if n := seen[ref]; n > 0 {
+			ref = fmt.Sprintf("%s#%d", ref, n)
+		}
+		seen[c.PURL()]++
+		comp := cdxComponent{
+			Type:    "library",
+			BOMRef:  ref,
+			Name:    c.Name,
+			Version: c.Version,
+			PURL:    c.PURL(),
+		}
+		if c.Location != "" {
+			comp.Properties = append(comp.Properties, cdxProperty{Name: "tekton-slsa-demo:location", Value: c.Location})
+		}
+		return comp
+	})
+	return o.close()
+}
+
+func cdxAlgorithm(alg string) string {
+	switch alg {
+	case "sha256":
+		return "SHA-256"
+	case "sha512":
+		return "SHA-512"
+	case "sha1":
+		return "SHA-1"
+	default:
+		return alg
+	}
+}
@@ -0,0 +1,221 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"debug/buildinfo"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+)
+
+// maxBinarySize bounds the executables read into memory while looking for
+// Go build info.
+const maxBinarySize = 256 << 20
+
+// FromImage catalogues the Go binaries and OS packages in the image at ref
+// for the given platform, e.g. "linux/amd64".
+func FromImage(ctx context.Context, c *oci.Client, ref oci.Reference, platform string) (*Document, error) {
+	manifestRef, m, err := c.ResolvePlatform(ctx, ref, platform)
+	if err != nil {
+		return nil, err
+	}
+
+	cat := NewCatalog()
+	for _, layer := range m.Layers {
+		if err := scanLayer(ctx, c, manifestRef, layer, cat); err != nil {
+			return nil, fmt.Errorf("scanning layer %s: %w", layer.Digest, err)
+		}
+	}
+
+	doc := &Document{
+		Name:    ref.Name(),
+		Digest:  manifestRef.Digest,
+		Root:    Component{Name: ref.Name(), Version: ref.Tag},
+		Created: time.Now().UTC(),
+		Distro:  cat.Distro,
+	}
+	for _, comps := range cat.Files {
+		doc.Components = append(doc.Components, comps...)
+	}
+	doc.Sort()
+	return doc, nil
+}
+
+// Catalog accumulates what was found across an image's layers. Later layers
+// override earlier ones, so components are indexed by the path they were
+// found at.
+type Catalog struct {
+	Files  map[string][]Component
+	Distro *Distro
+}
+
+// NewCatalog returns an empty catalog.
+func NewCatalog() *Catalog {
+	return &Catalog{Files: make(map[string][]Component)}
+}
+
+func scanLayer(ctx context.Context, c *oci.Client, ref oci.Reference, layer oci.Descriptor, cat *Catalog) error {
+	blob, err := c.OpenBlob(ctx, ref, layer.Digest)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	br := bufio.NewReader(blob)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return cat.ScanTar(r)
+}
+
+// ScanTar walks a layer tarball, recording components by the path they
+// were found at and honouring whiteouts for files removed by the layer.
+func (cat *Catalog) ScanTar(r io.Reader) error {
+	found := cat.Files
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := "/" + strings.TrimPrefix(path.Clean(hdr.Name), "/")
+		dir, base := path.Split(name)
+		if strings.HasPrefix(base, ".wh.") {
+			removed := path.Join(dir, strings.TrimPrefix(base, ".wh."))
+			for p := range found {
+				if p == removed || strings.HasPrefix(p, removed+"/") {
+					delete(found, p)
+				}
+			}
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		switch {
+		case name == "/lib/apk/db/installed":
+			found[name] = parseAPKInstalled(tr, name)
+		case name == "/var/lib/dpkg/status":
+			found[name] = parseDpkgStatus(tr, name)
+		case name == "/etc/os-release" || name == "/usr/lib/os-release":
+			if d := parseOSRelease(tr); d != nil {
+				cat.Distro = d
+			}
+		case hdr.Mode&0o111 != 0 && hdr.Size > 0 && hdr.Size <= maxBinarySize:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			info, err := buildinfo.Read(bytes.NewReader(data))
+			if err != nil {
+				delete(found, name)
+				continue
+			}
+			comps := []Component{{Type: TypeGolang, Name: info.Main.Path, Version: info.Main.Version, Location: name}}
+			found[name] = append(comps, goComponents(info, name)...)
+		default:
+			delete(found, name)
+		}
+	}
+}
+
+// parseAPKInstalled reads Alpine's package database, where each package is
+// a block of "K:value" lines separated by blank lines.
+func parseAPKInstalled(r io.Reader, location string) []Component {
+	var comps []Component
+	var cur Component
+	flush := func() {
+		if cur.Name != "" {
+			cur.Type, cur.Location = TypeAPK, location
+			comps = append(comps, cur)
+		}
+		cur = Component{}
+	}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "P:"):
+			cur.Name = line[2:]
+		case strings.HasPrefix(line, "V:"):
+			cur.Version = line[2:]
+		}
+	}
+	flush()
+	return comps
+}
+
+// parseDpkgStatus reads Debian's package database, keeping only packages
+// that are actually installed.
+func parseDpkgStatus(r io.Reader, location string) []Component {
+	var comps []Component
+	var cur Component
+	installed := false
+	flush := func() {
+		if cur.Name != "" && installed {
+			cur.Type, cur.Location = TypeDeb, location
+			comps = append(comps, cur)
+		}
+		cur, installed = Component{}, false
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "Package: "):
+			cur.Name = strings.TrimPrefix(line, "Package: ")
+		case strings.HasPrefix(line, "Version: "):
+			cur.Version = strings.TrimPrefix(line, "Version: ")
+		case strings.HasPrefix(line, "Status: "):
+			installed = strings.HasSuffix(line, " installed")
+		}
+	}
+	flush()
+	return comps
+}
+
+// parseOSRelease reads the distribution ID and version from os-release.
+func parseOSRelease(r io.Reader) *Distro {
+	d := &Distro{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), "=")
+		if !ok {
+			continue
+		}
+		v = strings.Trim(v, `"'`)
+		switch k {
+		case "ID":
+			d.ID = v
+		case "VERSION_ID":
+			d.VersionID = v
+		}
+	}
+	if d.ID == "" {
+		return nil
+	}
+	return d
+}
@@ -0,0 +1,172 @@
+// Package sbom builds software bills of materials from Go build info and
+// container image contents, and encodes them as SPDX or CycloneDX JSON.
+package sbom
+
+import (
+	"bytes"
+	"debug/buildinfo"
+	"fmt"
+	"io"
+	"net/url"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format selects the SBOM encoding.
+type Format string
+
+const (
+	FormatSPDX      Format = "spdx"
+	FormatCycloneDX Format = "cyclonedx"
+)
+
+// ParseFormat accepts the format names used by the CLI and the /sbom
+// endpoint.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "spdx", "spdx-json":
+		return FormatSPDX, nil
+	case "cyclonedx", "cdx", "cyclonedx-json":
+		return FormatCycloneDX, nil
+	default:
+		return "", fmt.Errorf("unknown SBOM format %q (want spdx or cyclonedx)", s)
+	}
+}
+
+// Component types recorded in Component.Type; they double as purl types.
+const (
+	TypeGolang = "golang"
+	TypeAPK    = "apk"
+	TypeDeb    = "deb"
+)
+
+// Component is one package in the bill of materials.
+type Component struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Location is the path inside an image the component was found at.
+	Location string `json:"location,omitempty"`
+	// Hash is the Go module checksum (h1:...) when known.
+	Hash string `json:"hash,omitempty"`
+}
+
+// PURL returns the component's package URL.
+func (c Component) PURL() string {
+	name := c.Name
+	if c.Type != TypeGolang {
+		name = url.PathEscape(name)
+	}
+	p := "pkg:" + c.Type + "/" + name
+	if c.Version != "" {
+		p += "@" + url.PathEscape(c.Version)
+	}
+	return p
+}
+
+// Document is a format-neutral SBOM.
+type Document struct {
+	// Name identifies what the SBOM describes, e.g. a binary or image name.
+	Name string
+	// Digest is the subject digest ("sha256:...") when known.
+	Digest string
+	// Root is the main component, e.g. the Go main module.
+	Root       Component
+	Components []Component
+	Created    time.Time
+	// Tool is recorded as the SBOM creator.
+	Tool string
+	// Distro is the image's base distribution, when it could be detected.
+	Distro *Distro
+}
+
+// Distro identifies a Linux distribution from os-release.
+type Distro struct {
+	ID        string `json:"id"`
+	VersionID string `json:"versionId"`
+}
+
+// FromBuildInfo lists the main module, its dependencies and the Go
+// toolchain from a binary's embedded build info.
+func FromBuildInfo(name string, info *debug.BuildInfo) *Document {
+	doc := &Document{
+		Name:    name,
+		Root:    Component{Type: TypeGolang, Name: info.Main.Path, Version: info.Main.Version},
+		Created: time.Now().UTC(),
+	}
+	doc.Components = append(doc.Components, goComponents(info, "")...)
+	return doc
+}
+
+// FromBinary reads build info from the Go binary at path.
+func FromBinary(path string) (*Document, error) {
+	info, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading Go build info from %s: %w", path, err)
+	}
+	return FromBuildInfo(path, info), nil
+}
+
+func goComponents(info *debug.BuildInfo, location string) []Component {
+	var comps []Component
+	if info.GoVersion != "" {
+		comps = append(comps, Component{Type: TypeGolang, Name: "stdlib", Version: info.GoVersion, Location: location})
+	}
+	for _, dep := range info.Deps {
+		m := dep
+		if dep.Replace != nil {
+			m = dep.Replace
+		}
+		comps = append(comps, Component{Type: TypeGolang, Name: m.Path, Version: m.Version, Hash: m.Sum, Location: location})
+	}
+	return comps
+}
+
+// Sort orders components by type, name and version so output is stable.
+func (d *Document) Sort() {
+	sort.Slice(d.Components, func(i, j int) bool {
+		a, b := d.Components[i], d.Components[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Location < b.Location
+	})
+}
+
+// Encode renders the document in the given format.
+func (d *Document) Encode(f Format) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := d.EncodeTo(&buf, f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeTo writes the document in the given format to w. Components are
+// encoded one at a time, so a large SBOM never exists in memory as a whole
+// encoded document.
+func (d *Document) EncodeTo(w io.Writer, f Format) error {
+	switch f {
+	case FormatSPDX:
+		return d.writeSPDX(w)
+	case FormatCycloneDX:
+		return d.writeCycloneDX(w)
+	default:
+		return fmt.Errorf("unknown SBOM format %q", f)
+	}
+}
+
+func (d *Document) tool() string {
+	if d.Tool != "" {
+		return d.Tool
+	}
+	return "tekton-slsa-demo"
+}
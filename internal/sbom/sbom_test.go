@@ -0,0 +1,209 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/golden"
+)
+
+func testDocument() *Document {
+	info := &debug.BuildInfo{
+		GoVersion: "go1.21.5",
+		Main:      debug.Module{Path: "github.com/waveywaves/tekton-slsa-demo", Version: "(devel)"},
+		Deps: []*debug.Module{
+			{Path: "golang.org/x/crypto", Version: "v0.17.0", Sum: "h1:abc"},
+			{Path: "example.com/old", Version: "v1.0.0", Replace: &debug.Module{Path: "example.com/new", Version: "v1.1.0"}},
+		},
+	}
+	doc := FromBuildInfo("tekton-slsa-demo", info)
+	doc.Created = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return doc
+}
+
+func TestFromBuildInfo(t *testing.T) {
+	doc := testDocument()
+	want := []string{
+		"pkg:golang/stdlib@go1.21.5",
+		"pkg:golang/golang.org/x/crypto@v0.17.0",
+		"pkg:golang/example.com/new@v1.1.0",
+	}
+	if len(doc.Components) != len(want) {
+		t.Fatalf("got %d components, want %d", len(doc.Components), len(want))
+	}
+	for i, w := range want {
+		if got := doc.Components[i].PURL(); got != w {
+			t.Errorf("component %d purl = %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestSPDX(t *testing.T) {
+	data, err := testDocument().SPDX()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc spdxDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.SPDXVersion != "SPDX-2.3" {
+		t.Errorf("spdxVersion = %q", doc.SPDXVersion)
+	}
+	// Root package plus three components, each with a DEPENDS_ON edge.
+	if len(doc.Packages) != 4 || len(doc.Relationships) != 4 {
+		t.Errorf("got %d packages and %d relationships, want 4 and 4", len(doc.Packages), len(doc.Relationships))
+	}
+
+	again, _ := testDocument().SPDX()
+	if !bytes.Equal(data, again) {
+		t.Error("SPDX output is not deterministic")
+	}
+}
+
+func TestCycloneDX(t *testing.T) {
+	doc := testDocument()
+	doc.Components = append(doc.Components, doc.Components[1])
+	data, err := doc.CycloneDX()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bom cdxBOM
+	if err := json.Unmarshal(data, &bom); err != nil {
+		t.Fatal(err)
+	}
+	if bom.BOMFormat != "CycloneDX" || bom.SpecVersion != "1.5" {
+		t.Errorf("bomFormat/specVersion = %q/%q", bom.BOMFormat, bom.SpecVersion)
+	}
+	refs := map[string]bool{}
+	for _, c := range bom.Components {
+		if refs[c.BOMRef] {
+			t.Errorf("duplicate bom-ref %q", c.BOMRef)
+		}
+		refs[c.BOMRef] = true
+	}
+}
+
+func TestEncodeGolden(t *testing.T) {
+	for _, f := range []Format{FormatSPDX, FormatCycloneDX} {
+		data, err := testDocument().Encode(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden.Assert(t, "sbom."+string(f)+".json", data)
+	}
+}
+
+// writeCounter counts the writes it receives.
+type writeCounter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *writeCounter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestEncodeToStreams(t *testing.T) {
+	doc := largeDocument()
+	for _, f := range []Format{FormatSPDX, FormatCycloneDX} {
+		var w writeCounter
+		if err := doc.EncodeTo(&w, f); err != nil {
+			t.Fatal(err)
+		}
+		whole, err := doc.Encode(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(w.Bytes(), whole) {
+			t.Errorf("%s: EncodeTo and Encode differ", f)
+		}
+		if w.writes < 10 {
+			t.Errorf("%s: %d bytes arrived in %d writes, want the document streamed in chunks", f, w.Len(), w.writes)
+		}
+	}
+	if err := doc.EncodeTo(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("EncodeTo accepted an unknown format")
+	}
+}
+
+func TestScanTar(t *testing.T) {
+	layer := func(files map[string]string) *bytes.Buffer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for name, body := range files {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(body)), Typeflag: tar.TypeReg})
+			tw.Write([]byte(body))
+		}
+		tw.Close()
+		return &buf
+	}
+
+	cat := NewCatalog()
+	apk := "P:musl\nV:1.2.4-r2\n\nP:ca-certificates\nV:20230506-r0\n"
+	osRelease := "NAME=\"Alpine Linux\"\nID=alpine\nVERSION_ID=3.18.4\n"
+	if err := cat.ScanTar(layer(map[string]string{"lib/apk/db/installed": apk, "etc/os-release": osRelease})); err != nil {
+		t.Fatal(err)
+	}
+	if cat.Distro == nil || cat.Distro.ID != "alpine" || cat.Distro.VersionID != "3.18.4" {
+		t.Errorf("Distro = %+v", cat.Distro)
+	}
+	comps := cat.Files["/lib/apk/db/installed"]
+	if len(comps) != 2 || comps[0].PURL() != "pkg:apk/musl@1.2.4-r2" {
+		t.Fatalf("apk components = %+v", comps)
+	}
+
+	if err := cat.ScanTar(layer(map[string]string{"lib/apk/db/.wh.installed": ""})); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cat.Files["/lib/apk/db/installed"]; ok {
+		t.Error("whiteout did not remove the apk database")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"": FormatSPDX, "spdx-json": FormatSPDX, "CycloneDX": FormatCycloneDX, "cdx": FormatCycloneDX} {
+		if got, err := ParseFormat(in); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat(xml) succeeded")
+	}
+}
+
+// largeDocument is an SBOM the size of a typical distro base image.
+func largeDocument() *Document {
+	doc := testDocument()
+	for i := 0; i < 5000; i++ {
+		doc.Components = append(doc.Components, Component{
+			Type:     TypeDeb,
+			Name:     fmt.Sprintf("lib%04d", i),
+			Version:  fmt.Sprintf("1.%d.%d-1", i/100, i%100),
+			Location: "/var/lib/dpkg/status",
+		})
+	}
+	return doc
+}
+
+func BenchmarkEncode(b *testing.B) {
+	doc := largeDocument()
+	for _, f := range []Format{FormatSPDX, FormatCycloneDX} {
+		b.Run(string(f), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := doc.Encode(f)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.SetBytes(int64(len(data)))
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package sbom
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// PredicateTypeSPDX is the in-toto predicate type for SPDX documents.
+const PredicateTypeSPDX = "https://spdx.dev/Document"
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// SPDX encodes the document as SPDX 2.3 JSON.
+func (d *Document) SPDX() ([]byte, error) {
+	var buf bytes.Buffer
+	err := d.writeSPDX(&buf)
+	return buf.Bytes(), err
+}
+
+// writeSPDX streams the SPDX encoding of the document to w. The root
+// package comes first, then one package per component.
+func (d *Document) writeSPDX(w io.Writer) error {
+	o := newObjectWriter(w)
+	o.field("spdxVersion", "SPDX-2.3")
+	o.field("dataLicense", "CC0-1.0")
+	o.field("SPDXID", "SPDXRef-DOCUMENT")
+	o.field("name", d.Name)
+	o.field("documentNamespace", "https://github.com/waveywaves/tekton-slsa-demo/spdx/"+d.namespaceID())
+	o.field("creationInfo", spdxCreationInfo{
+		Created:  d.Created.UTC().Format(time.RFC3339),
+		Creators: []string{"Tool: " + d.tool()},
+	})
+	o.array("packages", len(d.Components)+1, func(i int) any {
+		if i == 0 {
+			return d.spdxRoot()
+		}
+		return d.spdxPackage(i)
+	})
+	o.array("relationships", len(d.Components)+1, func(i int) any {
+		if i == 0 {
+			return spdxRelationship{"SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-Root"}
+		}
+		return spdxRelationship{"SPDXRef-Root", "DEPENDS_ON", spdxPackageID(i)}
+	})
+	return o.close()
+}
+
+func (d *Document) spdxRoot() spdxPackage {
+	root := spdxPackage{
+		Name:             d.Root.Name,
+		SPDXID:           "SPDXRef-Root",
+		VersionInfo:      d.Root.Version,
+		DownloadLocation: "NOASSERTION",
+	}
+	if root.Name == "" {
+		root.Name = d.Name
+	}
+	if alg, value, ok := splitDigest(d.Digest); ok {
+		root.Checksums = []spdxChecksum{{Algorithm: spdxAlgorithm(alg), ChecksumValue: value}}
+	}
+	return root
+}
+
+// spdxPackage returns the package for the nth component, counting from 1.
+func (d *Document) spdxPackage(n int) spdxPackage {
+	c := d.Components[n-1]
+	pkg := spdxPackage{
+		Name:             c.Name,
+		SPDXID:           spdxPackageID(n),
+		VersionInfo:      c.Version,
+		DownloadLocation: "NOASSERTION",
+		ExternalRefs: []spdxExternalRef{{
+			ReferenceCategory: "PACKAGE-MANAGER",
+			ReferenceType:     "purl",
+			ReferenceLocator:  c.PURL(),
+		}},
+	}
+	if c.Location != "" {
+		pkg.SourceInfo = "found in " + c.Location
+	}
+	return pkg
+}
+
+func spdxPackageID(n int) string {
+	return fmt.Sprintf("SPDXRef-Package-%d", n)
+}
+
+// namespaceID derives a stable identifier from the document contents so
+// regenerating the same SBOM yields the same namespace.
+func (d *Document) namespaceID() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s@%s\n", d.Name, d.Digest, d.Root.Name, d.Root.Version)
+	for _, c := range d.Components {
+		fmt.Fprintf(h, "%s\n", c.PURL())
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+func splitDigest(digest string) (alg, value string, ok bool) {
+	return strings.Cut(digest, ":")
+}
+
+func spdxAlgorithm(alg string) string {
+	switch alg {
+	case "sha256":
+		return "SHA256"
+	case "sha512":
+		return "SHA512"
+	case "sha1":
+		return "SHA1"
+	default:
+		return alg
+	}
+}
@@ -0,0 +1,96 @@
+package sbom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// objectWriter writes an indented JSON object one field at a time. The
+// output is byte for byte what json.MarshalIndent(v, "", "  ") produces for
+// the equivalent struct, but array fields are encoded element by element so
+// only one element is held in memory at once.
+type objectWriter struct {
+	w      *bufio.Writer
+	fields int
+	err    error
+
+	// enc encodes each value into scratch, reusing both between values.
+	enc     *json.Encoder
+	scratch bytes.Buffer
+}
+
+func newObjectWriter(w io.Writer) *objectWriter {
+	o := &objectWriter{w: bufio.NewWriter(w)}
+	o.enc = json.NewEncoder(&o.scratch)
+	return o
+}
+
+// field writes name with the JSON encoding of v.
+func (o *objectWriter) field(name string, v any) {
+	o.key(name)
+	o.value(v, "  ")
+}
+
+// array writes name as an array of n elements, calling elem for each in
+// order.
+func (o *objectWriter) array(name string, n int, elem func(i int) any) {
+	o.key(name)
+	if n == 0 {
+		o.write("[]")
+		return
+	}
+	o.write("[")
+	for i := 0; i < n && o.err == nil; i++ {
+		if i > 0 {
+			o.write(",")
+		}
+		o.write("\n    ")
+		o.value(elem(i), "    ")
+	}
+	o.write("\n  ]")
+}
+
+// close ends the object and flushes it to the underlying writer.
+func (o *objectWriter) close() error {
+	if o.fields == 0 {
+		o.write("{}")
+	} else {
+		o.write("\n}")
+	}
+	if o.err != nil {
+		return o.err
+	}
+	return o.w.Flush()
+}
+
+func (o *objectWriter) key(name string) {
+	if o.fields == 0 {
+		o.write("{\n  ")
+	} else {
+		o.write(",\n  ")
+	}
+	o.fields++
+	o.value(name, "")
+	o.write(": ")
+}
+
+func (o *objectWriter) value(v any, prefix string) {
+	if o.err != nil {
+		return
+	}
+	o.scratch.Reset()
+	o.enc.SetIndent(prefix, "  ")
+	if o.err = o.enc.Encode(v); o.err != nil {
+		return
+	}
+	// Drop the newline Encode appends.
+	_, o.err = o.w.Write(o.scratch.Bytes()[:o.scratch.Len()-1])
+}
+
+func (o *objectWriter) write(s string) {
+	if o.err == nil {
+		_, o.err = o.w.WriteString(s)
+	}
+}
@@ -0,0 +1,119 @@
+// Package scan scans images for vulnerabilities on demand, for images
+// published without a scan attestation. A Trivy server, or the embedded
+// OSV scanner, produces the findings; the result can be wrapped as a cosign
+// vulnerability attestation about the image.
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/osv"
+	"github.com/waveywaves/tekton-slsa-demo/internal/sbom"
+)
+
+// Scanner scans an image pinned by digest.
+type Scanner interface {
+	Scan(ctx context.Context, ref oci.Reference) (*Result, error)
+}
+
+// Tool identifies the scanner that produced a result, as the cosign
+// vulnerability predicate records it.
+type Tool struct {
+	URI     string `json:"uri"`
+	Version string `json:"version,omitempty"`
+}
+
+// Result is the outcome of scanning an image.
+type Result struct {
+	Scanner Tool `json:"scanner"`
+	// Report holds the findings in the form the scan subcommand reports
+	// them, whichever scanner found them.
+	Report *osv.Report `json:"report"`
+	// Raw is the scanner's own report, recorded in attestations.
+	Raw        json.RawMessage `json:"-"`
+	StartedOn  time.Time       `json:"startedOn"`
+	FinishedOn time.Time       `json:"finishedOn"`
+}
+
+// VulnerabilityPredicate is the cosign vulnerability attestation predicate
+// (https://cosign.sigstore.dev/attestation/vuln/v1).
+type VulnerabilityPredicate struct {
+	Invocation struct {
+		Parameters any    `json:"parameters"`
+		URI        string `json:"uri"`
+		EventID    string `json:"event_id"`
+		BuilderID  string `json:"builder.id"`
+	} `json:"invocation"`
+	Scanner struct {
+		URI     string `json:"uri"`
+		Version string `json:"version"`
+		DB      struct {
+			URI     string `json:"uri"`
+			Version string `json:"version"`
+		} `json:"db"`
+		Result json.RawMessage `json:"result"`
+	} `json:"scanner"`
+	Metadata struct {
+		ScanStartedOn  time.Time `json:"scanStartedOn"`
+		ScanFinishedOn time.Time `json:"scanFinishedOn"`
+	} `json:"metadata"`
+}
+
+// Statement wraps the result as a cosign vulnerability attestation about
+// ref, which must be pinned by digest. builderID names who ran the scan.
+func (r *Result) Statement(ref oci.Reference, builderID string) (*attestation.Statement, error) {
+	var p VulnerabilityPredicate
+	p.Invocation.BuilderID = builderID
+	p.Scanner.URI, p.Scanner.Version = r.Scanner.URI, r.Scanner.Version
+	p.Scanner.Result = r.Raw
+	p.Metadata.ScanStartedOn, p.Metadata.ScanFinishedOn = r.StartedOn.UTC(), r.FinishedOn.UTC()
+	predicate, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	alg, hex, _ := strings.Cut(ref.Digest, ":")
+	return &attestation.Statement{
+		Type:          attestation.StatementTypeV1,
+		Subject:       []attestation.Subject{{Name: ref.Name(), Digest: map[string]string{alg: hex}}},
+		PredicateType: attestation.PredicateVulnerability,
+		Predicate:     predicate,
+	}, nil
+}
+
+// OSV is the embedded scanner: it catalogues the image's packages and
+// looks them up in OSV, as the scan subcommand does.
+type OSV struct {
+	Registry *oci.Client
+	Client   *osv.Client
+	// Platform selects the image of a multi-arch index.
+	Platform string
+}
+
+// Scan catalogues ref and looks its components up in OSV.
+func (s *OSV) Scan(ctx context.Context, ref oci.Reference) (*Result, error) {
+	started := time.Now()
+	doc, err := sbom.FromImage(ctx, s.Registry, ref, s.Platform)
+	if err != nil {
+		return nil, err
+	}
+	report, err := osv.Scan(ctx, s.Client, doc)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Scanner:    Tool{URI: s.Client.URL},
+		Report:     report,
+		Raw:        raw,
+		StartedOn:  started,
+		FinishedOn: time.Now(),
+	}, nil
+}
@@ -0,0 +1,93 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/osv"
+)
+
+var ref = oci.Reference{Registry: "ghcr.io", Repository: "org/app", Digest: "sha256:" + strings.Repeat("a", 64)}
+
+func TestDecodeTrivyReport(t *testing.T) {
+	data, err := os.ReadFile("testdata/trivy.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, version, err := decodeTrivyReport(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "0.56.2" || report.Scanned != 3 || len(report.Findings) != 2 {
+		t.Fatalf("report = %+v, version %q", report, version)
+	}
+	f := report.Findings[0]
+	if f.ID != "CVE-2023-45288" || f.Severity != osv.LevelHigh || f.Ecosystem != "gobinary" || f.Location != "app" || f.FixedIn != "0.23.0" {
+		t.Errorf("most severe finding = %+v", f)
+	}
+}
+
+func TestTrivyScan(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake trivy is a shell script")
+	}
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	fake := filepath.Join(dir, "trivy")
+	script := "#!/bin/sh\necho \"$@\" > " + args + "\ncat " + filepath.Join(mustAbs(t, "testdata"), "trivy.json") + "\n"
+	if err := os.WriteFile(fake, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := (&Trivy{Path: fake, Server: "http://trivy:4954"}).Scan(context.Background(), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(args)
+	if want := "image --format json --quiet --server http://trivy:4954 " + ref.String(); strings.TrimSpace(string(got)) != want {
+		t.Errorf("trivy ran with %q, want %q", got, want)
+	}
+	if res.Scanner.URI != trivyURI || res.Report.Digest != ref.Digest || len(res.Report.Findings) != 2 {
+		t.Errorf("result = %+v", res)
+	}
+
+	if _, err := (&Trivy{Path: filepath.Join(dir, "missing")}).Scan(context.Background(), ref); err == nil {
+		t.Error("Scan succeeded without trivy")
+	}
+}
+
+func TestStatement(t *testing.T) {
+	started := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	res := &Result{Scanner: Tool{URI: trivyURI, Version: "0.56.2"}, Raw: json.RawMessage(`{"Results": []}`), StartedOn: started, FinishedOn: started.Add(time.Minute)}
+	stmt, err := res.Statement(ref, "https://example.com/scanner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmt.PredicateType != attestation.PredicateVulnerability || stmt.Subject[0].Name != "ghcr.io/org/app" || stmt.Subject[0].Digest["sha256"] != strings.Repeat("a", 64) {
+		t.Errorf("statement = %+v", stmt)
+	}
+	var p VulnerabilityPredicate
+	if err := json.Unmarshal(stmt.Predicate, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Scanner.Version != "0.56.2" || string(p.Scanner.Result) != `{"Results":[]}` || !p.Metadata.ScanFinishedOn.Equal(started.Add(time.Minute)) || p.Invocation.BuilderID != "https://example.com/scanner" {
+		t.Errorf("predicate = %+v", p)
+	}
+}
+
+func mustAbs(t *testing.T, path string) string {
+	t.Helper()
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abs
+}
@@ -0,0 +1,113 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/osv"
+)
+
+// trivyURI identifies Trivy in attestations.
+const trivyURI = "pkg:github/aquasecurity/trivy"
+
+// Trivy is a Scanner that runs the trivy binary. With Server set it runs in
+// client mode, leaving the vulnerability database and the matching to a
+// Trivy server; otherwise trivy scans on its own.
+type Trivy struct {
+	// Path is the trivy binary; empty finds trivy on $PATH.
+	Path string
+	// Server is the URL of a Trivy server, such as http://trivy:4954.
+	Server string
+	// Platform selects the image of a multi-arch index.
+	Platform string
+}
+
+// trivyReport is the part of trivy's JSON report the findings come from.
+type trivyReport struct {
+	ArtifactName string `json:"ArtifactName"`
+	Trivy        struct {
+		Version string `json:"Version"`
+	} `json:"Trivy"`
+	Results []struct {
+		Target          string `json:"Target"`
+		Type            string `json:"Type"`
+		Vulnerabilities []struct {
+			VulnerabilityID  string `json:"VulnerabilityID"`
+			PkgName          string `json:"PkgName"`
+			InstalledVersion string `json:"InstalledVersion"`
+			FixedVersion     string `json:"FixedVersion"`
+			Severity         string `json:"Severity"`
+			Title            string `json:"Title"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+// Scan runs trivy image on ref.
+func (t *Trivy) Scan(ctx context.Context, ref oci.Reference) (*Result, error) {
+	path := t.Path
+	if path == "" {
+		path = "trivy"
+	}
+	args := []string{"image", "--format", "json", "--quiet"}
+	if t.Server != "" {
+		args = append(args, "--server", t.Server)
+	}
+	if t.Platform != "" {
+		args = append(args, "--platform", t.Platform)
+	}
+	cmd := exec.CommandContext(ctx, path, append(args, ref.String())...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	started := time.Now()
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("trivy image: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	report, version, err := decodeTrivyReport(out)
+	if err != nil {
+		return nil, err
+	}
+	report.Target, report.Digest = ref.String(), ref.Digest
+	return &Result{
+		Scanner:    Tool{URI: trivyURI, Version: version},
+		Report:     report,
+		Raw:        out,
+		StartedOn:  started,
+		FinishedOn: time.Now(),
+	}, nil
+}
+
+// decodeTrivyReport converts trivy's JSON report into findings, and
+// returns the version of trivy that wrote it, if recorded.
+func decodeTrivyReport(data []byte) (*osv.Report, string, error) {
+	var tr trivyReport
+	if err := json.Unmarshal(data, &tr); err != nil {
+		return nil, "", fmt.Errorf("decoding trivy report: %w", err)
+	}
+	// Trivy reports findings by target, such as the OS packages or a Go
+	// binary, rather than by package, so Scanned counts targets.
+	report := &osv.Report{Target: tr.ArtifactName, Scanned: len(tr.Results), Findings: []osv.Finding{}}
+	for _, res := range tr.Results {
+		for _, v := range res.Vulnerabilities {
+			level, _ := osv.ParseLevel(v.Severity)
+			report.Findings = append(report.Findings, osv.Finding{
+				ID:        v.VulnerabilityID,
+				Package:   v.PkgName,
+				Version:   v.InstalledVersion,
+				Ecosystem: res.Type,
+				Location:  res.Target,
+				Severity:  level,
+				FixedIn:   v.FixedVersion,
+				Summary:   v.Title,
+			})
+		}
+	}
+	report.SortFindings()
+	return report, tr.Trivy.Version, nil
+}
@@ -0,0 +1,339 @@
+// Package schema validates attestation predicates against the JSON Schemas
+// of the SLSA provenance formats, embedded from schemas/. Violations are
+// findings about the shape of the provenance, reported alongside, and
+// independently of, whether its signature verifies.
+//
+// The validator implements the subset of JSON Schema 2020-12 the embedded
+// schemas use: type, properties, required, additionalProperties, items,
+// enum, pattern, format ("uri", "uri-reference" and "date-time"),
+// minProperties, anyOf and local $refs. Chains writes v0.2 build types
+// such as "tekton.dev/v1beta1/TaskRun", so that schema accepts relative
+// URI references for them.
+package schema
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/strutil"
+)
+
+// maxViolations bounds the violations reported for one predicate.
+const maxViolations = 50
+
+// Violation is a predicate value that does not match its schema.
+type Violation struct {
+	// Path is the JSON pointer to the value, such as
+	// "/buildDefinition/buildType"; empty for the predicate itself.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return strutil.Default(v.Path, "/") + ": " + v.Message
+}
+
+//go:embed schemas/*.json
+var files embed.FS
+
+// schemas maps predicate types to their schemas, keyed by $id.
+var schemas = mustLoad()
+
+func mustLoad() map[string]map[string]any {
+	entries, err := files.ReadDir("schemas")
+	if err != nil {
+		panic(err)
+	}
+	m := make(map[string]map[string]any, len(entries))
+	for _, e := range entries {
+		data, err := files.ReadFile(path.Join("schemas", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var s map[string]any
+		if err := json.Unmarshal(data, &s); err != nil {
+			panic(fmt.Sprintf("schema %s: %v", e.Name(), err))
+		}
+		id, _ := s["$id"].(string)
+		m[id] = s
+	}
+	return m
+}
+
+// Types returns the predicate types with an embedded schema, sorted.
+func Types() []string {
+	types := make([]string, 0, len(schemas))
+	for t := range schemas {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Validate checks a predicate against the schema of its type. It reports
+// false when no schema is embedded for the type, which is not checked.
+func Validate(predicateType string, predicate []byte) ([]Violation, bool) {
+	root, ok := schemas[predicateType]
+	if !ok {
+		return nil, false
+	}
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(predicate))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return []Violation{{Message: "predicate is not valid JSON: " + err.Error()}}, true
+	}
+	v := &validator{root: root}
+	v.validate(root, doc, "")
+	return v.violations, true
+}
+
+// ValidateStatement checks the predicate of stmt; see Validate.
+func ValidateStatement(stmt *attestation.Statement) ([]Violation, bool) {
+	return Validate(stmt.PredicateType, stmt.Predicate)
+}
+
+type validator struct {
+	root       map[string]any
+	violations []Violation
+}
+
+func (v *validator) add(ptr, format string, args ...any) {
+	if len(v.violations) < maxViolations {
+		v.violations = append(v.violations, Violation{Path: ptr, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// check reports whether doc matches s without recording violations.
+func (v *validator) check(s map[string]any, doc any) bool {
+	sub := &validator{root: v.root}
+	sub.validate(s, doc, "")
+	return len(sub.violations) == 0
+}
+
+func (v *validator) validate(s map[string]any, doc any, ptr string) {
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := v.resolve(ref)
+		if err != nil {
+			v.add(ptr, "%v", err)
+			return
+		}
+		v.validate(target, doc, ptr)
+	}
+	if t, ok := s["type"]; ok && !hasType(t, doc) {
+		v.add(ptr, "expected %s, got %s", describeTypes(t), typeOf(doc))
+		return
+	}
+	if enum, ok := s["enum"].([]any); ok && !contains(enum, doc) {
+		v.add(ptr, "must be one of %v", enum)
+	}
+	if anyOf, ok := s["anyOf"].([]any); ok {
+		matched := false
+		for _, alt := range anyOf {
+			if alt, ok := alt.(map[string]any); ok && v.check(alt, doc) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.add(ptr, "%s", describeAnyOf(anyOf))
+		}
+	}
+
+	switch doc := doc.(type) {
+	case map[string]any:
+		v.object(s, doc, ptr)
+	case []any:
+		if items, ok := s["items"].(map[string]any); ok {
+			for i, item := range doc {
+				v.validate(items, item, fmt.Sprintf("%s/%d", ptr, i))
+			}
+		}
+	case string:
+		if p, ok := s["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err == nil && !re.MatchString(doc) {
+				v.add(ptr, "%q does not match %s", doc, p)
+			}
+		}
+		if f, ok := s["format"].(string); ok {
+			if err := checkFormat(f, doc); err != nil {
+				v.add(ptr, "%q is not a valid %s: %v", doc, f, err)
+			}
+		}
+	}
+}
+
+func (v *validator) object(s map[string]any, doc map[string]any, ptr string) {
+	if required, ok := s["required"].([]any); ok {
+		for _, r := range required {
+			if name, _ := r.(string); name != "" {
+				if _, ok := doc[name]; !ok {
+					v.add(ptr, "missing required field %q", name)
+				}
+			}
+		}
+	}
+	if n, ok := s["minProperties"].(float64); ok && float64(len(doc)) < n {
+		v.add(ptr, "must have at least %v field(s)", n)
+	}
+	props, _ := s["properties"].(map[string]any)
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := ptr + "/" + escapePointer(k)
+		if ps, ok := props[k].(map[string]any); ok {
+			v.validate(ps, doc[k], child)
+			continue
+		}
+		switch ap := s["additionalProperties"].(type) {
+		case bool:
+			if !ap {
+				v.add(child, "unknown field")
+			}
+		case map[string]any:
+			v.validate(ap, doc[k], child)
+		}
+	}
+}
+
+// resolve looks up a local reference such as "#/$defs/DigestSet".
+func (v *validator) resolve(ref string) (map[string]any, error) {
+	p, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	var node any = v.root
+	for _, part := range strings.Split(p, "/") {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolved $ref %q", ref)
+		}
+		node = m[part]
+	}
+	s, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unresolved $ref %q", ref)
+	}
+	return s, nil
+}
+
+func checkFormat(format, s string) error {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, s)
+		return err
+	case "uri":
+		u, err := url.Parse(s)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" {
+			return fmt.Errorf("not an absolute URI")
+		}
+	case "uri-reference":
+		_, err := url.Parse(s)
+		return err
+	}
+	return nil
+}
+
+func hasType(t, doc any) bool {
+	switch t := t.(type) {
+	case string:
+		return isType(t, doc)
+	case []any:
+		for _, name := range t {
+			if name, ok := name.(string); ok && isType(name, doc) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isType(name string, doc any) bool {
+	switch name {
+	case "integer":
+		n, ok := doc.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	case "number":
+		_, ok := doc.(json.Number)
+		return ok
+	}
+	return typeOf(doc) == name
+}
+
+func typeOf(doc any) string {
+	switch doc.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", doc)
+}
+
+func describeTypes(t any) string {
+	if list, ok := t.([]any); ok {
+		names := make([]string, len(list))
+		for i, n := range list {
+			names[i] = fmt.Sprint(n)
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+// describeAnyOf describes an anyOf that failed to match, naming the fields
+// when each alternative requires one, as the resource descriptor's "uri",
+// "digest" or "content".
+func describeAnyOf(alts []any) string {
+	var names []string
+	for _, alt := range alts {
+		m, _ := alt.(map[string]any)
+		req, _ := m["required"].([]any)
+		if len(m) != 1 || len(req) != 1 {
+			return fmt.Sprintf("must match one of %d alternatives", len(alts))
+		}
+		names = append(names, fmt.Sprintf("%q", req[0]))
+	}
+	return "must have one of the fields " + strings.Join(names, ", ")
+}
+
+func contains(list []any, doc any) bool {
+	for _, x := range list {
+		if fmt.Sprint(x) == fmt.Sprint(doc) && typeOf(x) == typeOf(doc) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapePointer escapes a key for use in a JSON pointer.
+func escapePointer(k string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(k)
+}
@@ -0,0 +1,70 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+)
+
+func TestChainsProvenanceIsValid(t *testing.T) {
+	paths, _ := filepath.Glob("../attestation/testdata/chains/*.json")
+	if len(paths) == 0 {
+		t.Fatal("no Chains fixtures")
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		envs, err := attestation.DecodeEnvelopes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, env := range envs {
+			payload, _ := env.DecodePayload()
+			stmt, err := attestation.ParseStatement(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			violations, checked := ValidateStatement(stmt)
+			if !checked || len(violations) > 0 {
+				t.Errorf("%s (%s): checked %v, violations %v", filepath.Base(path), stmt.PredicateType, checked, violations)
+			}
+		}
+	}
+}
+
+func TestValidateReportsViolations(t *testing.T) {
+	predicate := []byte(`{
+		"buildDefinition": {
+			"buildType": "tekton",
+			"resolvedDependencies": [{"name": "source"}, {"uri": "git+https://github.com/org/app", "digest": {"sha1": "not-hex"}}]
+		},
+		"runDetails": {
+			"builder": {"id": "https://tekton.dev/chains/v2", "version": {"chains": 2}},
+			"metadata": {"startedOn": "yesterday"}
+		}
+	}`)
+	violations, checked := Validate(attestation.PredicateSLSAProvenanceV1, predicate)
+	want := []Violation{
+		{Path: "/buildDefinition", Message: `missing required field "externalParameters"`},
+		{Path: "/buildDefinition/buildType", Message: `"tekton" is not a valid uri: not an absolute URI`},
+		{Path: "/buildDefinition/resolvedDependencies/0", Message: `must have one of the fields "uri", "digest", "content"`},
+		{Path: "/buildDefinition/resolvedDependencies/1/digest/sha1", Message: `"not-hex" does not match ^[0-9a-fA-F]+$`},
+		{Path: "/runDetails/builder/version/chains", Message: "expected string, got number"},
+		{Path: "/runDetails/metadata/startedOn", Message: `"yesterday" is not a valid date-time: parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`},
+	}
+	if !checked || !reflect.DeepEqual(violations, want) {
+		t.Errorf("Validate() = %v, %v\nwant %v", violations, checked, want)
+	}
+
+	if v, _ := Validate(attestation.PredicateSLSAProvenanceV02, []byte(`[]`)); len(v) != 1 || v[0].String() != "/: expected object, got array" {
+		t.Errorf("Validate(array) = %v", v)
+	}
+	if _, checked := Validate("https://cyclonedx.org/bom", []byte(`{}`)); checked {
+		t.Error("checked a predicate type without a schema")
+	}
+}
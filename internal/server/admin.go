@@ -0,0 +1,369 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/denylist"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oidc"
+	"github.com/waveywaves/tekton-slsa-demo/internal/rotation"
+)
+
+// Cookies of the admin dashboard: the session of a signed-in
+// administrator, and the state of a sign-in under way, which binds the
+// provider's callback to the browser that started it.
+const (
+	sessionCookie = "admin_session"
+	loginCookie   = "admin_login"
+)
+
+const (
+	// defaultSessionTTL is how long a session lasts when
+	// Config.SessionTTL is zero.
+	defaultSessionTTL = 8 * time.Hour
+	// loginTTL bounds the time from starting a sign-in to the callback.
+	loginTTL = 10 * time.Minute
+	// maxPendingLogins bounds the sign-ins under way, so that requests to
+	// /auth/login cannot exhaust memory.
+	maxPendingLogins = 1000
+)
+
+// adminSession is a signed-in administrator. Forms they submit must carry
+// CSRF, which only pages served to them contain.
+type adminSession struct {
+	Identity string
+	CSRF     string
+	Expires  time.Time
+}
+
+// pendingLogin is a sign-in waiting for the provider's callback.
+type pendingLogin struct {
+	verifier, nonce, next string
+	expires               time.Time
+}
+
+// sessions holds the admin sessions and the sign-ins under way, in memory:
+// restarting the server signs everyone out.
+type sessions struct {
+	mu     sync.Mutex
+	byID   map[string]*adminSession
+	logins map[string]pendingLogin
+}
+
+func newSessions() *sessions {
+	return &sessions{byID: map[string]*adminSession{}, logins: map[string]pendingLogin{}}
+}
+
+// startLogin records a sign-in that returns to next and returns its state,
+// or false when too many are under way.
+func (ss *sessions) startLogin(next string, now time.Time) (string, pendingLogin, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for state, l := range ss.logins {
+		if now.After(l.expires) {
+			delete(ss.logins, state)
+		}
+	}
+	if len(ss.logins) >= maxPendingLogins {
+		return "", pendingLogin{}, false
+	}
+	state := oidc.NewState()
+	l := pendingLogin{verifier: oidc.NewVerifier(), nonce: oidc.NewState(), next: next, expires: now.Add(loginTTL)}
+	ss.logins[state] = l
+	return state, l, true
+}
+
+// finishLogin removes and returns the sign-in with state, if it has not
+// expired.
+func (ss *sessions) finishLogin(state string, now time.Time) (pendingLogin, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	l, ok := ss.logins[state]
+	delete(ss.logins, state)
+	return l, ok && !now.After(l.expires)
+}
+
+// create starts a session for identity and returns its ID.
+func (ss *sessions) create(identity string, expires, now time.Time) string {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for id, sess := range ss.byID {
+		if now.After(sess.Expires) {
+			delete(ss.byID, id)
+		}
+	}
+	id := oidc.NewState()
+	ss.byID[id] = &adminSession{Identity: identity, CSRF: oidc.NewState(), Expires: expires}
+	return id
+}
+
+// get returns the session with id, if it has not expired.
+func (ss *sessions) get(id string, now time.Time) (*adminSession, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	sess, ok := ss.byID[id]
+	if !ok || now.After(sess.Expires) {
+		delete(ss.byID, id)
+		return nil, false
+	}
+	return sess, true
+}
+
+func (ss *sessions) remove(id string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	delete(ss.byID, id)
+}
+
+// adminPage is the data of the admin dashboard.
+type adminPage struct {
+	Identity    string
+	CSRF        string
+	Maintenance maintenanceState
+	Denylist    []denylist.Entry
+	Rotations   []rotation.Event
+}
+
+// isAdmin reports whether identity, an email address or OIDC subject, is
+// one of the configured administrators.
+func (s *server) isAdmin(identity string) bool {
+	for _, a := range s.cfg.Admins {
+		if strings.EqualFold(a, identity) {
+			return true
+		}
+	}
+	return false
+}
+
+// secureCookies reports whether session cookies are only sent over HTTPS:
+// when the provider redirects back to an https URL.
+func (s *server) secureCookies() bool {
+	return strings.HasPrefix(s.oidc.RedirectURL, "https://")
+}
+
+func (s *server) setCookie(w http.ResponseWriter, name, value, path string, maxAge time.Duration) {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		HttpOnly: true,
+		Secure:   s.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge > 0 {
+		c.MaxAge = int(maxAge / time.Second)
+	} else {
+		c.MaxAge = -1
+	}
+	http.SetCookie(w, c)
+}
+
+// localPath returns next if it is a path on this server, to return to
+// after signing in, or /admin.
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.Contains(next, `\`) {
+		return "/admin"
+	}
+	return next
+}
+
+// loginHandler serves GET /auth/login, which sends the browser to the
+// OIDC provider to sign in, and back to the next parameter afterwards.
+func (s *server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.Error(w, "admin sign-in is not configured", http.StatusNotImplemented)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	state, l, ok := s.sessions.startLogin(localPath(r.URL.Query().Get("next")), s.clock.Now())
+	if !ok {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "too many sign-ins under way", http.StatusServiceUnavailable)
+		return
+	}
+	authURL, err := s.oidc.AuthCodeURL(r.Context(), state, l.nonce, l.verifier)
+	if err != nil {
+		s.logger.Printf("Admin: %v", err)
+		http.Error(w, "the sign-in provider is unavailable", http.StatusBadGateway)
+		return
+	}
+	s.setCookie(w, loginCookie, state, "/auth/", loginTTL)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// callbackHandler serves GET /auth/callback, where the provider returns
+// the browser with an authorization code. Administrators get a session;
+// anyone else is refused.
+func (s *server) callbackHandler(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.Error(w, "admin sign-in is not configured", http.StatusNotImplemented)
+		return
+	}
+	q := r.URL.Query()
+	state := q.Get("state")
+	c, err := r.Cookie(loginCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(c.Value), []byte(state)) != 1 {
+		s.stats.adminSignInFailures.Inc()
+		http.Error(w, "sign-in was not started by this browser", http.StatusBadRequest)
+		return
+	}
+	s.setCookie(w, loginCookie, "", "/auth/", 0)
+	l, ok := s.sessions.finishLogin(state, s.clock.Now())
+	if !ok {
+		s.stats.adminSignInFailures.Inc()
+		http.Error(w, "sign-in expired; try again", http.StatusBadRequest)
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		s.stats.adminSignInFailures.Inc()
+		http.Error(w, "sign-in failed: "+e+": "+q.Get("error_description"), http.StatusForbidden)
+		return
+	}
+	claims, err := s.oidc.Exchange(r.Context(), q.Get("code"), l.verifier, l.nonce, s.clock.Now())
+	if err != nil {
+		s.stats.adminSignInFailures.Inc()
+		s.logger.Printf("Admin: sign-in failed: %v", err)
+		http.Error(w, "sign-in failed", http.StatusForbidden)
+		return
+	}
+	identity := claims.Identity()
+	if !s.isAdmin(identity) {
+		s.stats.adminSignInFailures.Inc()
+		s.logger.Printf("Admin: refused sign-in of %s, who is not an administrator", identity)
+		http.Error(w, identity+" is not an administrator", http.StatusForbidden)
+		return
+	}
+	ttl := s.cfg.SessionTTL
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+	id := s.sessions.create(identity, s.clock.Now().Add(ttl), s.clock.Now())
+	s.setCookie(w, sessionCookie, id, "/", ttl)
+	s.stats.adminSignIns.Inc()
+	s.logger.Printf("Admin: %s signed in", identity)
+	http.Redirect(w, r, l.next, http.StatusSeeOther)
+}
+
+// requireSession wraps the admin dashboard's handlers. GET requests
+// without a session are sent to sign in; POST requests need a session and
+// its CSRF token in the csrf form field, and are refused when another
+// site's page sent them.
+func (s *server) requireSession(next func(http.ResponseWriter, *http.Request, *adminSession)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.oidc == nil {
+			http.Error(w, "admin sign-in is not configured", http.StatusNotImplemented)
+			return
+		}
+		var sess *adminSession
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			sess, _ = s.sessions.get(c.Value, s.clock.Now())
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if sess == nil {
+				http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+		case http.MethodPost:
+			if sess == nil {
+				http.Error(w, "not signed in", http.StatusUnauthorized)
+				return
+			}
+			if origin := r.Header.Get("Origin"); origin != "" {
+				if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+					http.Error(w, "cross-origin request refused", http.StatusForbidden)
+					return
+				}
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+			if subtle.ConstantTimeCompare([]byte(r.PostFormValue("csrf")), []byte(sess.CSRF)) != 1 {
+				http.Error(w, "missing or invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		next(w, r, sess)
+	}
+}
+
+// logoutHandler serves POST /auth/logout, which ends the session.
+func (s *server) logoutHandler(w http.ResponseWriter, r *http.Request, sess *adminSession) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		s.sessions.remove(c.Value)
+	}
+	s.setCookie(w, sessionCookie, "", "/", 0)
+	s.logger.Printf("Admin: %s signed out", sess.Identity)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// adminHandler serves the admin dashboard at /admin, where a signed-in
+// administrator manages maintenance mode, the denylist and signing
+// identity rotations: the actions of the /api/v1/admin API, without its
+// token.
+func (s *server) adminHandler(w http.ResponseWriter, r *http.Request, sess *adminSession) {
+	if r.URL.Path != "/admin" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.web.render(w, r, "admin.html", adminPage{
+		Identity:    sess.Identity,
+		CSRF:        sess.CSRF,
+		Maintenance: s.maintenance.get(),
+		Denylist:    s.denylist.Entries(),
+		Rotations:   s.rotations.Events(true),
+	})
+}
+
+// adminActionHandler serves the forms of the admin dashboard, each POSTed
+// to /admin/{action}, and returns to the dashboard.
+func (s *server) adminActionHandler(w http.ResponseWriter, r *http.Request, sess *adminSession) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var err error
+	status := http.StatusBadRequest
+	switch strings.TrimPrefix(r.URL.Path, "/admin/") {
+	case "maintenance":
+		s.setMaintenance(r.PostFormValue("enabled") == "true", r.PostFormValue("reason"), sess.Identity)
+	case "denylist":
+		_, err = s.addDenylistEntry(denylist.Entry{Kind: r.PostFormValue("kind"), Value: r.PostFormValue("value"), Reason: r.PostFormValue("reason")}, sess.Identity)
+	case "denylist/remove":
+		_, err = s.removeDenylistEntry(r.PostFormValue("id"), sess.Identity)
+		status = http.StatusNotFound
+	case "rotations/approve":
+		_, err = s.approveRotation(r.PostFormValue("id"), sess.Identity)
+		status = http.StatusNotFound
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/oidc"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/fake"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/httptestutil"
+)
+
+// adminClient is a browser signing in to the admin dashboard.
+type adminClient struct {
+	t       *testing.T
+	h       http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func (c *adminClient) do(method, target string, form url.Values) *httptest.ResponseRecorder {
+	c.t.Helper()
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	for _, ck := range c.cookies {
+		req.AddCookie(ck)
+	}
+	rr := httptestutil.Do(c.h, req)
+	for _, ck := range rr.Result().Cookies() {
+		if ck.MaxAge < 0 {
+			delete(c.cookies, ck.Name)
+		} else {
+			c.cookies[ck.Name] = ck
+		}
+	}
+	return rr
+}
+
+// signIn goes through the authorization code flow with the provider and
+// returns the callback's response.
+func (c *adminClient) signIn() *httptest.ResponseRecorder {
+	c.t.Helper()
+	rr := c.do(http.MethodGet, "/auth/login?next=/admin", nil)
+	httptestutil.AssertStatus(c.t, rr, http.StatusFound)
+	hc := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := hc.Get(rr.Header().Get("Location"))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return c.do(http.MethodGet, callback.RequestURI(), nil)
+}
+
+var csrfField = regexp.MustCompile(`name="csrf" value="([^"]+)"`)
+
+func TestAdminDashboard(t *testing.T) {
+	provider := fake.NewOIDC(t, "slsa-demo")
+	client := oidc.NewClient(provider.URL, "slsa-demo", "", "https://demo.example.com/auth/callback")
+	h := NewServer(Config{APIToken: "s3cret", Admins: []string{"Admin@example.com"}}, Deps{OIDC: client})
+	c := &adminClient{t: t, h: h, cookies: map[string]*http.Cookie{}}
+
+	httptestutil.AssertStatus(t, httptestutil.Get(NewServer(Config{}, Deps{}), "/admin"), http.StatusNotImplemented)
+	rr := c.do(http.MethodGet, "/admin", nil)
+	httptestutil.AssertStatus(t, rr, http.StatusFound)
+	if got := rr.Header().Get("Location"); got != "/auth/login?next=%2Fadmin" {
+		t.Errorf("Location = %s", got)
+	}
+	// The callback only completes sign-ins this browser started.
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/auth/callback?code=x&state=y"), http.StatusBadRequest)
+
+	rr = c.signIn()
+	httptestutil.AssertStatus(t, rr, http.StatusSeeOther)
+	if got := rr.Header().Get("Location"); got != "/admin" {
+		t.Errorf("Location after sign-in = %s", got)
+	}
+	session := c.cookies[sessionCookie]
+	if session == nil || !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("session cookie = %+v", session)
+	}
+	rr = c.do(http.MethodGet, "/admin", nil)
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertContains(t, rr, "Signed in as admin@example.com", "No digests or signer identities are denied.")
+	m := csrfField.FindStringSubmatch(rr.Body.String())
+	if m == nil {
+		t.Fatal("no CSRF token on the dashboard")
+	}
+	csrf := m[1]
+
+	deny := url.Values{"kind": {"digest"}, "value": {"sha256:" + strings.Repeat("a", 64)}, "reason": {"leaked"}}
+	httptestutil.AssertStatus(t, c.do(http.MethodPost, "/admin/denylist", deny), http.StatusForbidden)
+	deny.Set("csrf", csrf)
+	httptestutil.AssertStatus(t, c.do(http.MethodPost, "/admin/denylist", deny), http.StatusSeeOther)
+	httptestutil.AssertContains(t, c.do(http.MethodGet, "/admin", nil), strings.Repeat("a", 64), "leaked")
+	httptestutil.AssertStatus(t, c.do(http.MethodPost, "/admin/denylist", url.Values{"csrf": {csrf}, "kind": {"tag"}, "value": {"v1"}}), http.StatusBadRequest)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/maintenance", strings.NewReader(url.Values{"csrf": {csrf}, "enabled": {"true"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", "https://evil.example.com")
+	req.AddCookie(session)
+	httptestutil.AssertStatus(t, httptestutil.Do(h, req), http.StatusForbidden)
+	httptestutil.AssertStatus(t, c.do(http.MethodPost, "/admin/maintenance", url.Values{"csrf": {csrf}, "enabled": {"true"}, "reason": {"key rotation"}}), http.StatusSeeOther)
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/ready"), http.StatusServiceUnavailable)
+
+	// The session is no API token.
+	httptestutil.AssertStatus(t, c.do(http.MethodGet, "/api/v1/admin/denylist", nil), http.StatusUnauthorized)
+
+	httptestutil.AssertStatus(t, c.do(http.MethodPost, "/auth/logout", url.Values{"csrf": {csrf}}), http.StatusSeeOther)
+	req = httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.AddCookie(session)
+	httptestutil.AssertStatus(t, httptestutil.Do(h, req), http.StatusFound)
+
+	// Only administrators get a session.
+	provider.Email = "mallory@example.com"
+	c = &adminClient{t: t, h: h, cookies: map[string]*http.Cookie{}}
+	httptestutil.AssertStatus(t, c.signIn(), http.StatusForbidden)
+	if c.cookies[sessionCookie] != nil {
+		t.Error("non-administrator got a session")
+	}
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/metrics"),
+		"tekton_slsa_demo_admin_sign_ins_total 1", "tekton_slsa_demo_admin_sign_in_failures_total 2")
+}
@@ -0,0 +1,622 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/metrics"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/replay"
+	"github.com/waveywaves/tekton-slsa-demo/internal/rotation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/sourcelink"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/tofu"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// maxIngestBytes bounds the body of an attestation upload.
+const maxIngestBytes = 10 << 20
+
+// attestationList is the response of GET /api/v1/attestations.
+type attestationList struct {
+	Count        int                  `json:"count"`
+	Attestations []*store.Attestation `json:"attestations"`
+}
+
+// attestationDetail is the response of GET /api/v1/attestations/{id}: the
+// stored attestation and, for provenance built from GitHub or GitLab,
+// links to its source.
+type attestationDetail struct {
+	*store.Attestation
+	Source *sourcelink.Links `json:"source,omitempty"`
+}
+
+// sourceLinks links a provenance attestation to the repository and commit
+// it was built from, or returns nil.
+func sourceLinks(a *store.Attestation) *sourcelink.Links {
+	if !attestation.IsProvenance(a.PredicateType) {
+		return nil
+	}
+	p, err := attestation.NormalizeProvenance(a.Statement())
+	if err != nil {
+		return nil
+	}
+	l, _ := sourcelink.FromProvenance(p)
+	return l
+}
+
+// ingestResult is the response of POST /api/v1/attestations.
+type ingestResult struct {
+	Added        int                  `json:"added"`
+	Duplicates   int                  `json:"duplicates"`
+	Attestations []*store.Attestation `json:"attestations"`
+	// Rotations are the events raised by attestations signed by an
+	// identity not yet approved for their subject.
+	Rotations []rotation.Event `json:"rotations,omitempty"`
+}
+
+// attestationsHandler lists stored attestations, filtered by the digest and
+// predicateType query parameters, or ingests the DSSE envelopes in the
+// request body.
+func (s *server) attestationsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		list := s.store.List(store.Filter{Digest: q.Get("digest"), PredicateType: q.Get("predicateType")})
+		if q.Get("format") == "ndjson" || r.Header.Get("Accept") == ndjsonMediaType {
+			if err := streamEnvelopes(w, list); err != nil {
+				s.logger.Printf("streaming attestations: %v", err)
+			}
+			return
+		}
+		writeJSON(w, http.StatusOK, attestationList{Count: len(list), Attestations: list})
+	case http.MethodPost:
+		s.requireToken(s.ingestAttestations)(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Result limits of the search endpoint.
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+)
+
+// searchHandler serves GET /api/v1/attestations/search, selecting stored
+// attestations by the predicateType, builder, source and commit query
+// parameters and a since/until build time range (RFC 3339 timestamps or
+// dates). limit caps the results at up to 1000, 100 by default.
+func (s *server) searchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	query := store.Query{
+		PredicateType: q.Get("predicateType"),
+		BuilderID:     q.Get("builder"),
+		Source:        q.Get("source"),
+		Commit:        q.Get("commit"),
+		Limit:         defaultSearchLimit,
+	}
+	var err error
+	if query.Since, err = parseSearchTime(q.Get("since"), false); err != nil {
+		http.Error(w, "since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Until, err = parseSearchTime(q.Get("until"), true); err != nil {
+		http.Error(w, "until: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit), http.StatusBadRequest)
+			return
+		}
+		query.Limit = n
+	}
+	if c := query.Commit; c != "" && len(c) < store.MinCommitPrefix {
+		http.Error(w, fmt.Sprintf("commit must have at least %d characters", store.MinCommitPrefix), http.StatusBadRequest)
+		return
+	}
+	list := s.store.Search(query)
+	if list == nil {
+		list = []*store.Attestation{}
+	}
+	writeJSON(w, http.StatusOK, attestationList{Count: len(list), Attestations: list})
+}
+
+// parseSearchTime parses an RFC 3339 timestamp or a date. A date used as
+// the end of a range covers the whole day.
+func parseSearchTime(v string, end bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 timestamp nor a date", v)
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// attestationHandler serves GET /api/v1/attestations/{id}, the archived
+// envelope and in-toto statement as downloads under
+// /api/v1/attestations/{id}/envelope and /api/v1/attestations/{id}/payload,
+// the signing certificates under /api/v1/attestations/{id}/certificate and
+// a provenance's build parameters under
+// /api/v1/attestations/{id}/build/parameters.
+func (s *server) attestationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, part, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/attestations/"), "/")
+	a, err := s.store.Get(id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	switch part {
+	case "":
+		writeJSON(w, http.StatusOK, attestationDetail{Attestation: a, Source: sourceLinks(a)})
+	case "envelope":
+		serveArchived(w, r, a, a.ID+".dsse.json", "application/json", a.OpenEnvelope())
+	case "payload":
+		serveArchived(w, r, a, a.ID+".intoto.json", "application/vnd.in-toto+json", a.OpenPayload())
+	case "certificate":
+		writeJSON(w, http.StatusOK, s.describeCertificates(a))
+	case "build/parameters":
+		res, err := describeBuild(a)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveArchived serves one of an attestation's archived documents as a
+// download. http.ServeContent copies it from the store and answers Range,
+// If-Range and conditional requests, so large attestations can be fetched
+// in parts or resumed.
+func serveArchived(w http.ResponseWriter, r *http.Request, a *store.Attestation, filename, contentType string, content io.ReadSeeker) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	// Stored documents never change, so the file name identifies the
+	// content.
+	w.Header().Set("ETag", fmt.Sprintf("%q", filename))
+	http.ServeContent(w, r, filename, a.ReceivedAt, content)
+}
+
+// ndjsonMediaType selects the streamed listing of envelopes, one JSON
+// document per line.
+const ndjsonMediaType = "application/x-ndjson"
+
+// streamEnvelopes writes the envelopes of list one per line, copying each
+// from the store and flushing it to the client before the next, so the
+// response is sent in chunks rather than encoded as a whole. The output can
+// be posted back to the ingest endpoint as is.
+func streamEnvelopes(w http.ResponseWriter, list []*store.Attestation) error {
+	w.Header().Set("Content-Type", ndjsonMediaType)
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	for _, a := range list {
+		if _, err := io.Copy(w, a.OpenEnvelope()); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ingestAttestations accepts a single envelope, a JSON array or stream of
+// envelopes, or bare in-toto statements, which are stored unsigned. The
+// transparency query parameter records the Rekor entry Chains reported for
+// the upload against each of its attestations.
+func (s *server) ingestAttestations(w http.ResponseWriter, r *http.Request) {
+	var transparency string
+	if v := r.URL.Query().Get("transparency"); v != "" {
+		var err error
+		if transparency, err = parseTransparencyURI(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	envs, err := attestation.DecodeEnvelopes(data)
+	if err != nil {
+		s.countFailure(failure.SchemaInvalid)
+		httpFailure(w, failure.Wrap(failure.SchemaInvalid, err), http.StatusBadRequest)
+		return
+	}
+	// Reject the whole upload if any envelope is invalid.
+	for i, env := range envs {
+		if err := store.Validate(env); err != nil {
+			s.countFailure(failure.SchemaInvalid)
+			httpFailure(w, failure.New(failure.SchemaInvalid, "envelope %d: %w", i+1, err), http.StatusBadRequest)
+			return
+		}
+	}
+	res := ingestResult{Attestations: make([]*store.Attestation, 0, len(envs))}
+	now := s.clock.Now()
+	for _, env := range envs {
+		a, added, err := s.store.Add(env, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if transparency != "" {
+			if err := s.store.SetTransparencyURI(a.ID, transparency); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if added {
+			res.Added++
+			res.Rotations = append(res.Rotations, s.watchRotation(a)...)
+			if n := len(a.SchemaViolations); n > 0 {
+				s.stats.schemaViolations.Inc()
+				s.logger.Printf("Ingest: %s attestation %s has %d schema violation(s), e.g. %s", attestation.PredicateName(a.PredicateType), a.ID, n, a.SchemaViolations[0])
+			}
+		} else {
+			res.Duplicates++
+		}
+		res.Attestations = append(res.Attestations, a)
+	}
+	status := http.StatusOK
+	if res.Added > 0 {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, res)
+}
+
+// verifyHandler serves GET /api/v1/verify?image=<ref>, verifying the
+// image's signatures and attestations with the server's VerifyFunc.
+// The identity, issuer, requireTlog and (repeated) annotation parameters
+// mirror the verify flags. The result is JSON, SARIF with format=sarif or
+// an Accept header of application/sarif+json, or with format=vsa a SLSA
+// verification summary attestation signed by the server's signer. The
+// JSON also reports whether the provenance is older than the repository's
+// current build or replays another image's log entry and, with trust on
+// first use enabled, the repository's pinned identity and any mismatch.
+// Only requests carrying the API token pin a repository; others are
+// compared with the pins.
+func (s *server) verifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	image := q.Get("image")
+	if image == "" {
+		http.Error(w, "the image parameter is required", http.StatusBadRequest)
+		return
+	}
+	ref, err := oci.ParseReference(image)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	asSARIF := q.Get("format") == "sarif" || r.Header.Get("Accept") == sarifMediaType
+	asVSA := q.Get("format") == "vsa"
+	if f := q.Get("format"); f != "" && f != "json" && f != "sarif" && !asVSA {
+		http.Error(w, fmt.Sprintf("unknown format %q", f), http.StatusBadRequest)
+		return
+	}
+	if asVSA && s.signer == nil {
+		http.Error(w, "signing VSAs is not configured", http.StatusNotImplemented)
+		return
+	}
+
+	if s.verifyImage == nil {
+		http.Error(w, "verification is not configured", http.StatusNotImplemented)
+		return
+	}
+	annotations, err := parseAnnotations(q["annotation"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := verify.Options{
+		Identity:    q.Get("identity"),
+		Issuer:      q.Get("issuer"),
+		RequireTlog: q.Get("requireTlog") == "true",
+		Annotations: annotations,
+	}
+	res, err := s.cachedVerify(r.Context(), ref, opts)
+	if err != nil {
+		s.upstreamFailed(w, r, err)
+		return
+	}
+	rep := s.checkReplay(res)
+	pin := s.checkPins(res, s.cfg.Dev || s.hasToken(r))
+	if asVSA {
+		s.writeVSA(w, res, q)
+		return
+	}
+	if asSARIF {
+		w.Header().Set("Content-Type", sarifMediaType)
+		w.WriteHeader(http.StatusOK)
+		res.SARIF("tekton-slsa-demo", s.getenv("APP_VERSION", "1.0.0")).Write(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, verifyResponse{Result: res, Replay: rep, TOFU: pin})
+}
+
+// checkPins compares res with the trust on first use pins, pinning its
+// repository first if mayPin is set, and logs and counts a mismatch. It
+// returns nil when trust on first use is off.
+func (s *server) checkPins(res *verify.Result, mayPin bool) *tofu.Report {
+	if s.pins == nil {
+		return nil
+	}
+	var pin *tofu.Report
+	var err error
+	if mayPin {
+		pin, err = s.pins.Check(res, s.clock.Now())
+	} else {
+		pin, err = s.pins.Compare(res)
+	}
+	if err != nil {
+		s.logger.Printf("TOFU pins: %v", err)
+	}
+	if alert := pin.Alert(); alert != "" {
+		s.logger.Print(alert)
+		s.stats.tofuMismatches.Inc()
+		s.countFailure(failure.IdentityRejected)
+	}
+	return pin
+}
+
+// verifyResponse is the JSON body of GET /api/v1/verify: the verification
+// result, how its provenance compares with the builds seen for the image's
+// repository and, with trust on first use enabled, how it compares with
+// the identity pinned for the repository. The result, replay findings and
+// TOFU mismatches each carry their failure codes.
+type verifyResponse struct {
+	*verify.Result
+	Replay *replay.Report `json:"replay,omitempty"`
+	TOFU   *tofu.Report   `json:"tofu,omitempty"`
+}
+
+// MetricsSummary is the body of /api/v1/metrics/summary.
+type MetricsSummary struct {
+	GeneratedAt string            `json:"generatedAt"`
+	Metrics     []metrics.Summary `json:"metrics"`
+}
+
+// metricsSummaryHandler serves GET /api/v1/metrics/summary, the server's
+// metrics as JSON for dashboards that cannot scrape Prometheus. Histograms
+// are summarised by count, sum and estimated quantiles.
+func (s *server) metricsSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, MetricsSummary{
+		GeneratedAt: s.clock.Now().UTC().Format(time.RFC3339),
+		Metrics:     s.metrics.Summaries(),
+	})
+}
+
+// verifyKey identifies a cached verification result.
+type verifyKey struct {
+	image, identity, issuer string
+	requireTlog             bool
+	annotations             string
+}
+
+// parseAnnotations parses the key=value annotations signatures must carry.
+func parseAnnotations(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	m := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("annotation %q is not key=value", p)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+// annotationsKey encodes required annotations for a cache key. Keys and
+// values may contain "," and "=", so they are encoded as JSON, which sorts
+// the keys, rather than joined: a=1,b=2 as one annotation must not share a
+// key with a=1 and b=2.
+func annotationsKey(m map[string]string) string {
+	if len(m) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+// cachedVerify verifies ref, reusing a recent result when ref is pinned by
+// digest; tags can move, so they are always verified afresh. Concurrent
+// requests for the same image and options share one verification. The
+// denylist is applied to every result, cached or not, and every failure is
+// counted by its code. Verifications run afresh are logged for attestation
+// bundles.
+func (s *server) cachedVerify(ctx context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+	key := verifyKey{ref.String(), opts.Identity, opts.Issuer, opts.RequireTlog, annotationsKey(opts.Annotations)}
+	pinned := ref.Digest != ""
+	if pinned {
+		if c, ok := s.verified.Get(key); ok {
+			if s.faults.CorruptCache() {
+				c = c.corrupted()
+			}
+			if c.intact() {
+				s.stats.verifyCacheHits.Inc()
+				res := s.applyDenylist(c.res)
+				s.countResult(res)
+				return res, nil
+			}
+			s.stats.verifyCacheCorrupt.Inc()
+			s.logger.Printf("Verification cache: the result for %s failed its checksum; verifying afresh", key.image)
+			s.verified.Remove(key)
+		}
+	}
+	res, shared, err := s.inFlight.Do(ctx, key, func(ctx context.Context) (*verify.Result, error) {
+		s.stats.verifications.Inc()
+		start := time.Now()
+		res, err := s.verifyImage(ctx, ref, opts)
+		s.stats.verifyDuration.ObserveSince(ctx, start)
+		if err == nil && pinned {
+			s.verified.Add(key, s.cacheResult(res))
+		}
+		return res, err
+	})
+	if shared {
+		s.stats.verifyDeduplicated.Inc()
+	}
+	if err != nil {
+		s.countFailure(failure.CodeOf(err))
+		if !shared {
+			s.logVerification(ref, nil, err)
+		}
+		return nil, err
+	}
+	res = s.applyDenylist(res)
+	s.countResult(res)
+	if !shared {
+		s.logVerification(ref, res, nil)
+	}
+	return res, nil
+}
+
+// cachedResult is a cached verification result. With fault injection
+// enabled, the only way entries get corrupted, it carries a checksum of
+// the result that is checked on every hit.
+type cachedResult struct {
+	res *verify.Result
+	sum []byte
+}
+
+func (s *server) cacheResult(res *verify.Result) cachedResult {
+	c := cachedResult{res: res}
+	if s.faults != nil {
+		c.sum = checksum(res)
+	}
+	return c
+}
+
+func checksum(res *verify.Result) []byte {
+	data, _ := json.Marshal(res)
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// intact reports whether the result still matches its checksum.
+func (c cachedResult) intact() bool {
+	return c.sum == nil || bytes.Equal(c.sum, checksum(c.res))
+}
+
+// corrupted returns a copy of c whose result no longer matches the
+// checksum, as if its memory had been overwritten.
+func (c cachedResult) corrupted() cachedResult {
+	res := *c.res
+	res.Verified = !res.Verified
+	res.Digest = "sha256:" + strings.Repeat("0", 64)
+	return cachedResult{res: &res, sum: c.sum}
+}
+
+// verifyResultSize estimates the memory a cached result holds: its strings
+// plus a fixed overhead per struct.
+func verifyResultSize(k verifyKey, c cachedResult) int64 {
+	res := c.res
+	n := len(c.sum) + len(k.image) + len(k.identity) + len(k.issuer) + len(k.annotations) + len(res.Image) + len(res.Digest) + 128
+	for _, c := range res.Checks {
+		n += len(c.Kind) + len(c.PredicateType) + len(c.Signer) + len(c.Issuer) + len(c.Error) + 128
+		for k, v := range c.Annotations {
+			n += len(k) + len(v) + 32
+		}
+	}
+	return int64(n)
+}
+
+// sarifMediaType is the registered media type for SARIF logs.
+const sarifMediaType = "application/sarif+json"
+
+// responseBuffer is a pooled buffer with a JSON encoder bound to it.
+// Responses are encoded into one before anything is written, so encoding
+// errors can still become a 500 and the body goes out in a single write.
+// Pooling both keeps probe-heavy endpoints such as /health from allocating
+// an encoder and growing a fresh buffer on every request.
+type responseBuffer struct {
+	bytes.Buffer
+	enc *json.Encoder
+}
+
+var responseBuffers = sync.Pool{New: func() any {
+	b := new(responseBuffer)
+	b.enc = json.NewEncoder(&b.Buffer)
+	return b
+}}
+
+// maxPooledBuffer keeps an occasional large response from pinning its
+// buffer in the pool.
+const maxPooledBuffer = 64 << 10
+
+func getBuffer() *responseBuffer {
+	return responseBuffers.Get().(*responseBuffer)
+}
+
+func putBuffer(b *responseBuffer) {
+	if b.Cap() > maxPooledBuffer {
+		return
+	}
+	b.Reset()
+	responseBuffers.Put(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := buf.enc.Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
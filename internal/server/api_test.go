@@ -0,0 +1,1339 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/clock"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cosign"
+	"github.com/waveywaves/tekton-slsa-demo/internal/denylist"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/env"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/metrics"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/replay"
+	"github.com/waveywaves/tekton-slsa-demo/internal/reproducibility"
+	"github.com/waveywaves/tekton-slsa-demo/internal/sarif"
+	"github.com/waveywaves/tekton-slsa-demo/internal/shard"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/sourcelink"
+	"github.com/waveywaves/tekton-slsa-demo/internal/status"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/fake"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/httptestutil"
+	"github.com/waveywaves/tekton-slsa-demo/internal/tofu"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+	"github.com/waveywaves/tekton-slsa-demo/internal/watch"
+)
+
+// testEnvelope is an unsigned provenance envelope about sha256:deadbeef.
+func testEnvelope(t testing.TB) *dsse.Envelope {
+	t.Helper()
+	stmt, err := attestation.NewStatement(attestation.PredicateSLSAProvenanceV1, attestation.Provenance{},
+		attestation.Subject{Name: "app", Digest: map[string]string{"sha256": "deadbeef"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(stmt)
+	env, err := dsse.Sign(attestation.PayloadType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestAttestationsAPIAuth(t *testing.T) {
+	body, _ := json.Marshal(testEnvelope(t))
+	post := func(h http.Handler, token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/attestations", bytes.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return httptestutil.Do(h, req).Code
+	}
+
+	if code := post(NewServer(Config{}, Deps{}), "anything"); code != http.StatusForbidden {
+		t.Errorf("ingest without a configured token: status %d, want 403", code)
+	}
+
+	h := NewServer(Config{APIToken: "s3cret"}, Deps{})
+	if code := post(h, "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d, want 401", code)
+	}
+	if code := post(h, "s3cret"); code != http.StatusCreated {
+		t.Errorf("valid token: status %d, want 201", code)
+	}
+	if code := post(h, "s3cret"); code != http.StatusOK {
+		t.Errorf("duplicate upload: status %d, want 200", code)
+	}
+
+	h = NewServer(Config{Dev: true, WebDir: "web"}, Deps{})
+	if code := post(h, ""); code != http.StatusCreated {
+		t.Errorf("dev mode without token: status %d, want 201", code)
+	}
+
+	var list attestationList
+	httptestutil.DecodeJSON(t, httptestutil.Get(h, "/api/v1/attestations?digest=sha256:deadbeef"), &list)
+	if list.Count != 1 {
+		t.Fatalf("listed %d attestations, want 1", list.Count)
+	}
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/attestations/"+list.Attestations[0].ID), http.StatusOK)
+}
+
+func TestIngestYAML(t *testing.T) {
+	h := NewServer(Config{Dev: true, WebDir: "web"}, Deps{Logger: log.New(io.Discard, "", 0)})
+	post := func(body string) *httptest.ResponseRecorder {
+		return httptestutil.Do(h, httptest.NewRequest(http.MethodPost, "/api/v1/attestations", strings.NewReader(body)))
+	}
+	statement := `_type: https://in-toto.io/Statement/v1
+subject:
+  - name: app
+    digest: {sha256: "0123"}
+predicateType: https://slsa.dev/provenance/v1
+predicate: {}
+`
+	httptestutil.AssertStatus(t, post(statement), http.StatusCreated)
+	var list attestationList
+	httptestutil.DecodeJSON(t, httptestutil.Get(h, "/api/v1/attestations?digest=sha256:0123"), &list)
+	if list.Count != 1 {
+		t.Errorf("listed %d attestations, want 1", list.Count)
+	}
+
+	rr := post(strings.Replace(statement, "predicate: {}", "predicate: {}\nsignature: none", 1))
+	httptestutil.AssertStatus(t, rr, http.StatusBadRequest)
+	httptestutil.AssertContains(t, rr, `line 7, column 1: unknown field "signature" in Statement`)
+}
+
+func TestIngestReportsSchemaViolations(t *testing.T) {
+	h := NewServer(Config{Dev: true, WebDir: "web"}, Deps{Logger: log.New(io.Discard, "", 0)})
+	body, _ := json.Marshal(testEnvelope(t))
+	rr := httptestutil.Do(h, httptest.NewRequest(http.MethodPost, "/api/v1/attestations", bytes.NewReader(body)))
+	httptestutil.AssertStatus(t, rr, http.StatusCreated)
+	var res ingestResult
+	httptestutil.DecodeJSON(t, rr, &res)
+	// The test provenance is empty, so its build type and builder are not URIs.
+	if v := res.Attestations[0].SchemaViolations; len(v) == 0 || v[0].Path != "/buildDefinition/buildType" {
+		t.Errorf("schema violations = %+v", v)
+	}
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/metrics"), "tekton_slsa_demo_schema_invalid_attestations_total 1\n")
+}
+
+func TestArchivedDownloads(t *testing.T) {
+	env := testEnvelope(t)
+	body, _ := json.Marshal(env)
+	h := NewServer(Config{Dev: true, WebDir: "web"}, Deps{Logger: log.New(io.Discard, "", 0)})
+	rr := httptestutil.Do(h, httptest.NewRequest(http.MethodPost, "/api/v1/attestations", bytes.NewReader(body)))
+	httptestutil.AssertStatus(t, rr, http.StatusCreated)
+	var res ingestResult
+	httptestutil.DecodeJSON(t, rr, &res)
+	base := "/api/v1/attestations/" + res.Attestations[0].ID
+
+	rr = httptestutil.Get(h, base+"/envelope")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertHeader(t, rr, "Accept-Ranges", "bytes")
+	httptestutil.AssertJSONEqual(t, rr.Body.Bytes(), body)
+	envelope := rr.Body.Bytes()
+
+	req := httptest.NewRequest(http.MethodGet, base+"/envelope", nil)
+	req.Header.Set("Range", "bytes=10-19")
+	rr = httptestutil.Do(h, req)
+	httptestutil.AssertStatus(t, rr, http.StatusPartialContent)
+	httptestutil.AssertHeader(t, rr, "Content-Range", fmt.Sprintf("bytes 10-19/%d", len(envelope)))
+	if got := rr.Body.String(); got != string(envelope[10:20]) {
+		t.Errorf("range body = %q, want %q", got, envelope[10:20])
+	}
+
+	req = httptest.NewRequest(http.MethodGet, base+"/envelope", nil)
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	httptestutil.AssertStatus(t, httptestutil.Do(h, req), http.StatusNotModified)
+
+	rr = httptestutil.Get(h, base+"/payload")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertHeader(t, rr, "Content-Type", "application/vnd.in-toto+json")
+	if sum := sha256.Sum256(rr.Body.Bytes()); hex.EncodeToString(sum[:]) != res.Attestations[0].ID {
+		t.Error("payload download does not hash to the attestation ID")
+	}
+	httptestutil.AssertStatus(t, httptestutil.Get(h, base+"/other"), http.StatusNotFound)
+}
+
+func TestAttestationCertificate(t *testing.T) {
+	id := fake.NewFulcio(t).Identity(t, "https://github.com/org/app/.github/workflows/release.yml@refs/heads/main")
+	stmt, _ := attestation.NewStatement(attestation.PredicateSLSAProvenanceV1, attestation.Provenance{},
+		attestation.Subject{Name: "app", Digest: map[string]string{"sha256": "deadbeef"}})
+	payload, _ := json.Marshal(stmt)
+	env, err := dsse.Sign(attestation.PayloadType, payload, id.Signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Signatures[0].Cert = id.Certificate
+	body, _ := json.Marshal(env)
+	h := NewServer(Config{Dev: true, WebDir: "web"}, Deps{Logger: log.New(io.Discard, "", 0)})
+	ingest := func(query string, body []byte) *httptest.ResponseRecorder {
+		return httptestutil.Do(h, httptest.NewRequest(http.MethodPost, "/api/v1/attestations"+query, bytes.NewReader(body)))
+	}
+
+	httptestutil.AssertStatus(t, ingest("?transparency=ftp://rekor", body), http.StatusBadRequest)
+	bad := *env
+	bad.Signatures = []dsse.Signature{{KeyID: env.Signatures[0].KeyID, Sig: env.Signatures[0].Sig, Cert: "not a certificate"}}
+	badBody, _ := json.Marshal(&bad)
+	httptestutil.AssertStatus(t, ingest("", badBody), http.StatusBadRequest)
+
+	const entry = "https://rekor.sigstore.dev/api/v1/log/entries?logIndex=42"
+	rr := ingest("?transparency="+url.QueryEscape(entry), body)
+	httptestutil.AssertStatus(t, rr, http.StatusCreated)
+	var res ingestResult
+	httptestutil.DecodeJSON(t, rr, &res)
+	a := res.Attestations[0]
+
+	var got CertificateResponse
+	httptestutil.DecodeJSON(t, httptestutil.Get(h, "/api/v1/attestations/"+a.ID+"/certificate"), &got)
+	if got.TransparencyURI != entry {
+		t.Errorf("transparency URI = %q, want %q", got.TransparencyURI, entry)
+	}
+	if len(got.Certificates) != 1 {
+		t.Fatalf("got %d certificates, want 1", len(got.Certificates))
+	}
+	c := got.Certificates[0]
+	if c.Identity != "https://github.com/org/app/.github/workflows/release.yml@refs/heads/main" || c.Extensions.Issuer != fake.DefaultIssuer {
+		t.Errorf("certificate identity = %q from %q", c.Identity, c.Extensions.Issuer)
+	}
+	if c.KeyID != env.Signatures[0].KeyID || c.Issuer != "CN=fake-fulcio,O=sigstore.dev" {
+		t.Errorf("certificate = %+v", c)
+	}
+
+	rr = httptestutil.Get(h, "/attestations/"+a.ID+"/certificate")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertContains(t, rr, "release.yml@refs/heads/main")
+	httptestutil.AssertContains(t, rr, "logIndex=42")
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/attestations/unknown/certificate"), http.StatusNotFound)
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/attestations/"+a.ID), http.StatusNotFound)
+}
+
+func TestSigningIdentityRotation(t *testing.T) {
+	var logs bytes.Buffer
+	h := NewServer(Config{APIToken: "s3cret"}, Deps{Logger: log.New(&logs, "", 0)})
+	do := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		return httptestutil.Do(h, req)
+	}
+	ingest := func(id *fake.Identity, digest string) ingestResult {
+		t.Helper()
+		stmt, _ := attestation.NewStatement(attestation.PredicateSLSAProvenanceV1, attestation.Provenance{},
+			attestation.Subject{Name: "ghcr.io/org/app", Digest: map[string]string{"sha256": digest}})
+		payload, _ := json.Marshal(stmt)
+		env, err := dsse.Sign(attestation.PayloadType, payload, id.Signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env.Signatures[0].Cert = id.Certificate
+		body, _ := json.Marshal(env)
+		rr := do(http.MethodPost, "/api/v1/attestations", body)
+		httptestutil.AssertStatus(t, rr, http.StatusCreated)
+		var res ingestResult
+		httptestutil.DecodeJSON(t, rr, &res)
+		return res
+	}
+	fulcio := fake.NewFulcio(t)
+	release := fulcio.Identity(t, "release@example.com")
+	rotated := fake.KeyIdentity(t)
+
+	if res := ingest(release, "aaa"); len(res.Rotations) != 0 {
+		t.Fatalf("first signer raised %+v", res.Rotations)
+	}
+	res := ingest(rotated, "bbb")
+	if len(res.Rotations) != 1 || res.Rotations[0].Identity.KeyID != rotated.Signer.KeyID() || res.Rotations[0].Previous[0].Signer != "release@example.com" {
+		t.Fatalf("new key raised %+v", res.Rotations)
+	}
+	if !strings.Contains(logs.String(), "Signing identity rotation: ghcr.io/org/app") {
+		t.Errorf("rotation was not logged: %q", logs.String())
+	}
+
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/admin/rotations"), http.StatusUnauthorized)
+	var list rotationList
+	httptestutil.DecodeJSON(t, do(http.MethodGet, "/api/v1/admin/rotations?pending=true", nil), &list)
+	if list.Count != 1 {
+		t.Fatalf("%d pending rotations, want 1", list.Count)
+	}
+	id := list.Events[0].ID
+	httptestutil.AssertStatus(t, do(http.MethodGet, "/api/v1/admin/rotations/"+id+"/approve", nil), http.StatusMethodNotAllowed)
+	httptestutil.AssertStatus(t, do(http.MethodPost, "/api/v1/admin/rotations/99/approve", nil), http.StatusNotFound)
+	httptestutil.AssertStatus(t, do(http.MethodPost, "/api/v1/admin/rotations/"+id+"/approve", nil), http.StatusOK)
+
+	if res := ingest(rotated, "ccc"); len(res.Rotations) != 0 {
+		t.Errorf("approved key raised %+v", res.Rotations)
+	}
+	httptestutil.DecodeJSON(t, do(http.MethodGet, "/api/v1/admin/rotations?pending=true", nil), &list)
+	if list.Count != 0 {
+		t.Errorf("%d rotations still pending after approval", list.Count)
+	}
+}
+
+func TestAttestationSourceLinks(t *testing.T) {
+	st := store.New()
+	if _, err := SeedSampleData(st, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(Config{}, Deps{Store: st})
+	for _, a := range st.List(store.Filter{}) {
+		var got struct {
+			ID     string
+			Source *sourcelink.Links
+		}
+		httptestutil.DecodeJSON(t, httptestutil.Get(h, "/api/v1/attestations/"+a.ID), &got)
+		if got.ID != a.ID {
+			t.Fatalf("detail ID = %q, want %q", got.ID, a.ID)
+		}
+		if !attestation.IsProvenance(a.PredicateType) {
+			if got.Source != nil {
+				t.Errorf("%s attestation has source links", a.PredicateType)
+			}
+			continue
+		}
+		if got.Source == nil {
+			t.Fatal("provenance has no source links")
+		}
+		commit := got.Source.Revision
+		if got.Source.Commit != "https://github.com/waveywaves/tekton-slsa-demo/commit/"+commit ||
+			got.Source.Pipeline != "https://github.com/waveywaves/tekton-slsa-demo/blob/"+commit+"/k8s/slsa-demo-pipeline.yaml" {
+			t.Errorf("source links = %+v", got.Source)
+		}
+	}
+}
+
+func TestBuildParameters(t *testing.T) {
+	st := store.New()
+	if _, err := SeedSampleData(st, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(Config{}, Deps{Store: st})
+	for _, a := range st.List(store.Filter{}) {
+		if !attestation.IsProvenance(a.PredicateType) {
+			httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/attestations/"+a.ID+"/build/parameters"), http.StatusNotFound)
+			httptestutil.AssertStatus(t, httptestutil.Get(h, "/attestations/"+a.ID+"/build/parameters"), http.StatusNotFound)
+			continue
+		}
+		var got BuildParametersResponse
+		httptestutil.DecodeJSON(t, httptestutil.Get(h, "/api/v1/attestations/"+a.ID+"/build/parameters"), &got)
+		if got.Builder.ID != "https://tekton.dev/chains/v2" || len(got.ExternalParameters) != 7 || got.InternalParameters == nil {
+			t.Fatalf("build parameters = %+v", got)
+		}
+		if p := got.ExternalParameters[0]; p.Name != "externalParameters.runSpec.pipelineRef.params[0].name" || p.Value != "url" {
+			t.Errorf("first parameter = %+v", p)
+		}
+
+		rr := httptestutil.Get(h, "/attestations/"+a.ID+"/build/parameters")
+		httptestutil.AssertStatus(t, rr, http.StatusOK)
+		httptestutil.AssertContains(t, rr, "<code>externalParameters.runSpec.pipelineRef.resolver</code></th><td><code>git</code>", "slsa-demo-run-")
+	}
+}
+
+func TestStreamEnvelopes(t *testing.T) {
+	h := NewServer(Config{Dev: true, WebDir: "web"}, Deps{Logger: log.New(io.Discard, "", 0)})
+	for _, digest := range []string{"aaa", "bbb"} {
+		stmt, _ := attestation.NewStatement(attestation.PredicateSLSAProvenanceV1, attestation.Provenance{},
+			attestation.Subject{Name: "app", Digest: map[string]string{"sha256": digest}})
+		payload, _ := json.Marshal(stmt)
+		env, _ := dsse.Sign(attestation.PayloadType, payload)
+		body, _ := json.Marshal(env)
+		httptestutil.AssertStatus(t, httptestutil.Do(h, httptest.NewRequest(http.MethodPost, "/api/v1/attestations", bytes.NewReader(body))), http.StatusCreated)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/attestations", nil)
+	req.Header.Set("Accept", ndjsonMediaType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Errorf("Transfer-Encoding = %v, want chunked", resp.TransferEncoding)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("streamed %d lines, want one per envelope", lines)
+	}
+
+	// The stream is accepted back by the ingest endpoint.
+	rr := httptestutil.Do(h, httptest.NewRequest(http.MethodPost, "/api/v1/attestations", bytes.NewReader(data)))
+	var res ingestResult
+	httptestutil.DecodeJSON(t, rr, &res)
+	if res.Duplicates != 2 {
+		t.Errorf("re-ingesting the stream: %+v, want 2 duplicates", res)
+	}
+}
+
+func TestVerifyAPI(t *testing.T) {
+	h := NewServer(Config{}, Deps{
+		Verify: func(_ context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+			return &verify.Result{
+				Image:  ref.String(),
+				Digest: "sha256:deadbeef",
+				Checks: []verify.Check{{Kind: verify.KindSignature, Error: "signature is for another image", Annotations: opts.Annotations}},
+			}, nil
+		},
+	})
+	get := func(query, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/verify"+query, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		return httptestutil.Do(h, req)
+	}
+
+	if rr := get("", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("missing image: status %d, want 400", rr.Code)
+	}
+	if rr := get("?image=ghcr.io/org/app:v1&format=xml", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: status %d, want 400", rr.Code)
+	}
+
+	rr := get("?image=ghcr.io/org/app:v1", "")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	var res verify.Result
+	httptestutil.DecodeJSON(t, rr, &res)
+	if res.Verified || len(res.Checks) != 1 {
+		t.Errorf("JSON result: %+v", res)
+	}
+
+	// Required annotations are passed on to verification.
+	httptestutil.DecodeJSON(t, get("?image=ghcr.io/org/app:v1&annotation=env=prod&annotation=team=security", ""), &res)
+	if got := verify.FormatAnnotations(res.Checks[0].Annotations); got != "env=prod,team=security" {
+		t.Errorf("annotations passed to verification: %s", got)
+	}
+	if rr := get("?image=ghcr.io/org/app:v1&annotation=env", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("malformed annotation: status %d, want 400", rr.Code)
+	}
+
+	for _, rr := range []*httptest.ResponseRecorder{
+		get("?image=ghcr.io/org/app:v1&format=sarif", ""),
+		get("?image=ghcr.io/org/app:v1", sarifMediaType),
+	} {
+		httptestutil.AssertHeader(t, rr, "Content-Type", sarifMediaType)
+		var log sarif.Log
+		httptestutil.DecodeJSON(t, rr, &log)
+		if log.Version != sarif.Version || len(log.Runs[0].Results) != 2 {
+			t.Errorf("SARIF log has version %s and %d results, want %s and 2", log.Version, len(log.Runs[0].Results), sarif.Version)
+		}
+	}
+
+	rr = httptestutil.Get(NewServer(Config{}, Deps{}), "/api/v1/verify?image=ghcr.io/org/app:v1")
+	httptestutil.AssertStatus(t, rr, http.StatusNotImplemented)
+}
+
+func TestVerifyAPIVSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := signing.NewSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deps := Deps{
+		Verify: func(_ context.Context, ref oci.Reference, _ verify.Options) (*verify.Result, error) {
+			return &verify.Result{
+				Image:    ref.String(),
+				Digest:   "sha256:deadbeef",
+				Checks:   []verify.Check{{Kind: verify.KindSignature, Verified: true}},
+				Verified: true,
+			}, nil
+		},
+		Signer: signing.KeyBackend(signer),
+	}
+	h := NewServer(Config{}, deps)
+
+	rr := httptestutil.Get(h, "/api/v1/verify?image=ghcr.io/org/app:v1&format=vsa&identity=release@example.com")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertHeader(t, rr, "Content-Type", cosign.MediaTypeDSSE)
+	env, err := dsse.Parse(rr.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := signing.NewVerifier(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Verify(v); err != nil {
+		t.Fatalf("the VSA signature does not verify: %v", err)
+	}
+	payload, _ := env.DecodePayload()
+	stmt, err := attestation.ParseStatement(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p verify.VSAPredicate
+	if err := json.Unmarshal(stmt.Predicate, &p); err != nil {
+		t.Fatal(err)
+	}
+	if stmt.PredicateType != attestation.PredicateVSA || stmt.Subject[0].Digest["sha256"] != "deadbeef" {
+		t.Errorf("statement = %+v", stmt)
+	}
+	if p.VerificationResult != "PASSED" || p.Policy.URI != vsaVerifierID+"?identity=release%40example.com" {
+		t.Errorf("predicate = %+v", p)
+	}
+
+	deps.Signer = nil
+	rr = httptestutil.Get(NewServer(Config{}, deps), "/api/v1/verify?image=ghcr.io/org/app:v1&format=vsa")
+	httptestutil.AssertStatus(t, rr, http.StatusNotImplemented)
+}
+
+func TestVerifyAPIFailureCodes(t *testing.T) {
+	h := NewServer(Config{Dev: true}, Deps{
+		Logger: log.New(io.Discard, "", 0),
+		Verify: func(_ context.Context, ref oci.Reference, _ verify.Options) (*verify.Result, error) {
+			if ref.Repository == "org/offline" {
+				return nil, failure.New(failure.RekorUnreachable, "fetching inclusion proof for log index 7: %w", io.ErrUnexpectedEOF)
+			}
+			return &verify.Result{
+				Image:  ref.String(),
+				Digest: "sha256:deadbeef",
+				Checks: []verify.Check{{Kind: verify.KindSignature, Error: "certificate identity \"mallory\" is not allowed", Code: failure.IdentityRejected}},
+				Code:   failure.IdentityRejected,
+			}, nil
+		},
+	})
+
+	var res verify.Result
+	httptestutil.DecodeJSON(t, httptestutil.Get(h, "/api/v1/verify?image=ghcr.io/org/app:v1"), &res)
+	if res.Code != failure.IdentityRejected || res.Checks[0].Code != failure.IdentityRejected {
+		t.Errorf("codes = %q, %q; want %s", res.Code, res.Checks[0].Code, failure.IdentityRejected)
+	}
+
+	rr := httptestutil.Get(h, "/api/v1/verify?image=ghcr.io/org/offline:v1")
+	httptestutil.AssertStatus(t, rr, http.StatusBadGateway)
+	httptestutil.AssertHeader(t, rr, failureHeader, string(failure.RekorUnreachable))
+
+	rr = httptestutil.Do(h, httptest.NewRequest(http.MethodPost, "/api/v1/attestations", strings.NewReader("not an envelope")))
+	httptestutil.AssertStatus(t, rr, http.StatusBadRequest)
+	httptestutil.AssertHeader(t, rr, failureHeader, string(failure.SchemaInvalid))
+
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/metrics"),
+		`tekton_slsa_demo_verification_failures_total{code="IDENTITY_REJECTED"} 1`+"\n",
+		`tekton_slsa_demo_verification_failures_total{code="REKOR_UNREACHABLE"} 1`+"\n",
+		`tekton_slsa_demo_verification_failures_total{code="SCHEMA_INVALID"} 1`+"\n",
+		`tekton_slsa_demo_verification_failures_total{code="POLICY_DENIED"} 0`+"\n",
+	)
+}
+
+func TestVerifyAPIRequestTimeout(t *testing.T) {
+	abandoned := make(chan error, 1)
+	h := NewServer(Config{RequestTimeout: 50 * time.Millisecond}, Deps{
+		Logger: log.New(io.Discard, "", 0),
+		Verify: func(ctx context.Context, _ oci.Reference, _ verify.Options) (*verify.Result, error) {
+			// A registry that never answers.
+			<-ctx.Done()
+			abandoned <- ctx.Err()
+			return nil, fmt.Errorf("oci: GET /manifests/v1: %w", ctx.Err())
+		},
+	})
+
+	rr := httptestutil.Get(h, "/api/v1/verify?image=ghcr.io/org/app:v1")
+	httptestutil.AssertStatus(t, rr, http.StatusGatewayTimeout)
+	select {
+	case err := <-abandoned:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("verification ended with %v, want it cancelled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the verification was not cancelled")
+	}
+}
+
+func TestVerifyAPIClientGone(t *testing.T) {
+	abandoned := make(chan struct{})
+	h := NewServer(Config{}, Deps{
+		Logger: log.New(io.Discard, "", 0),
+		Verify: func(ctx context.Context, _ oci.Reference, _ verify.Options) (*verify.Result, error) {
+			<-ctx.Done()
+			close(abandoned)
+			return nil, ctx.Err()
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/verify?image=ghcr.io/org/app:v1", nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		httptestutil.Do(h, req)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-abandoned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the verification outlived its client")
+	}
+	<-done
+}
+
+func TestVerifyAPITrustOnFirstUse(t *testing.T) {
+	signers := map[string]string{"sha256:aaa": "release@example.com", "sha256:bbb": "mallory@example.com"}
+	var logs bytes.Buffer
+	reg := metrics.NewRegistry()
+	h := NewServer(Config{APIToken: "s3cret"}, Deps{
+		Verify: func(_ context.Context, ref oci.Reference, _ verify.Options) (*verify.Result, error) {
+			return &verify.Result{
+				Image:    ref.String(),
+				Digest:   ref.Digest,
+				Checks:   []verify.Check{{Kind: verify.KindAttestation, Signer: signers[ref.Digest], Issuer: "https://accounts.google.com", Verified: true}},
+				Verified: true,
+			}, nil
+		},
+		Logger:  log.New(&logs, "", 0),
+		Metrics: reg,
+		Pins:    tofu.New(),
+	})
+	check := func(digest, token string) verifyResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/verify?image=ghcr.io/org/app@"+digest, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		var res verifyResponse
+		httptestutil.DecodeJSON(t, httptestutil.Do(h, req), &res)
+		if res.Result == nil {
+			t.Fatalf("response for %s has no result", digest)
+		}
+		return res
+	}
+
+	// Anonymous requests do not pin, so they cannot pin first.
+	if res := check("sha256:bbb", ""); res.TOFU != nil {
+		t.Errorf("anonymous verification pinned: %+v", res.TOFU)
+	}
+	if res := check("sha256:aaa", "s3cret"); res.TOFU == nil || !res.TOFU.NewPin || res.TOFU.Pin.Signer != "release@example.com" || !res.Verified {
+		t.Errorf("first authenticated verification: %+v", res.TOFU)
+	}
+	if res := check("sha256:bbb", ""); res.TOFU == nil || len(res.TOFU.Mismatches) != 1 || res.TOFU.Mismatches[0].Signer != "mallory@example.com" {
+		t.Errorf("different signer: %+v", res.TOFU)
+	}
+	if !strings.Contains(logs.String(), "mallory@example.com") {
+		t.Errorf("mismatch was not logged: %q", logs.String())
+	}
+	var text bytes.Buffer
+	reg.WriteText(&text)
+	if !strings.Contains(text.String(), "tekton_slsa_demo_tofu_mismatches_total 1") {
+		t.Errorf("metrics do not count the mismatch:\n%s", text.String())
+	}
+}
+
+func TestVerifyAPIFlagsReplayedProvenance(t *testing.T) {
+	built := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	logIndexes := map[string]int64{"sha256:aaa": 100, "sha256:bbb": 200, "sha256:ccc": 200}
+	var logs bytes.Buffer
+	h := NewServer(Config{}, Deps{
+		Verify: func(_ context.Context, ref oci.Reference, _ verify.Options) (*verify.Result, error) {
+			idx := logIndexes[ref.Digest]
+			at := built.Add(time.Duration(idx) * time.Minute)
+			return &verify.Result{
+				Image:    ref.String(),
+				Digest:   ref.Digest,
+				Checks:   []verify.Check{{Kind: verify.KindAttestation, PredicateType: attestation.PredicateSLSAProvenanceV1, LogIndex: &idx, SignedAt: &at, Verified: true}},
+				Verified: true,
+			}, nil
+		},
+		Logger: log.New(&logs, "", 0),
+	})
+	check := func(digest string) verifyResponse {
+		t.Helper()
+		var res verifyResponse
+		httptestutil.DecodeJSON(t, httptestutil.Get(h, "/api/v1/verify?image=ghcr.io/org/app@"+digest), &res)
+		if res.Result == nil || res.Replay == nil {
+			t.Fatalf("response for %s has no result or replay report", digest)
+		}
+		return res
+	}
+
+	check("sha256:aaa")
+	if res := check("sha256:bbb"); len(res.Replay.Findings) != 0 || res.Replay.Current.Digest != "sha256:bbb" {
+		t.Errorf("newer build: %+v", res.Replay)
+	}
+	if res := check("sha256:aaa"); len(res.Replay.Findings) != 1 || res.Replay.Findings[0].Kind != replay.KindSuperseded {
+		t.Errorf("older build: %+v", res.Replay)
+	}
+	if res := check("sha256:ccc"); len(res.Replay.Findings) != 1 || res.Replay.Findings[0].Kind != replay.KindReplayed {
+		t.Errorf("reused log entry: %+v", res.Replay)
+	}
+	if !strings.Contains(logs.String(), "Replay: replayed provenance for ghcr.io/org/app@sha256:ccc") {
+		t.Errorf("replay was not logged: %q", logs.String())
+	}
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/metrics"), "tekton_slsa_demo_replay_findings_total 2\n")
+}
+
+func TestVerifyAPICachesPinnedImages(t *testing.T) {
+	calls := map[string]int{}
+	h := NewServer(Config{}, Deps{
+		Verify: func(_ context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+			calls[ref.String()+" "+opts.Identity]++
+			return &verify.Result{Image: ref.String(), Checks: []verify.Check{}}, nil
+		},
+	})
+	pinned := "ghcr.io/org/app@sha256:" + strings.Repeat("ab", 32)
+	for _, query := range []string{
+		"?image=ghcr.io/org/app:v1",
+		"?image=ghcr.io/org/app:v1",
+		"?image=" + pinned,
+		"?image=" + pinned,
+		"?image=" + pinned + "&identity=ci",
+	} {
+		httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/verify"+query), http.StatusOK)
+	}
+	want := map[string]int{
+		"ghcr.io/org/app:v1 ": 2,
+		pinned + " ":          1,
+		pinned + " ci":        1,
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("verifications: %v, want %v", calls, want)
+	}
+}
+
+func TestVerifyAPICacheKeepsAnnotationsApart(t *testing.T) {
+	// Only a signature annotated a=1 and b=2 verifies.
+	h := NewServer(Config{}, Deps{
+		Verify: func(_ context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+			ok := len(opts.Annotations) == 2 && opts.Annotations["a"] == "1" && opts.Annotations["b"] == "2"
+			return &verify.Result{Image: ref.String(), Checks: []verify.Check{{Kind: verify.KindSignature, Verified: ok}}, Verified: ok}, nil
+		},
+	})
+	pinned := "ghcr.io/org/app@sha256:" + strings.Repeat("ab", 32)
+	var one, two verify.Result
+	httptestutil.DecodeJSON(t, httptestutil.Get(h, "/api/v1/verify?image="+pinned+"&annotation="+url.QueryEscape("a=1,b=2")), &one)
+	httptestutil.DecodeJSON(t, httptestutil.Get(h, "/api/v1/verify?image="+pinned+"&annotation=a=1&annotation=b=2"), &two)
+	if one.Verified || !two.Verified {
+		t.Errorf("one annotation a=%q verified %v; a=1 and b=2 verified %v", "1,b=2", one.Verified, two.Verified)
+	}
+}
+
+func TestVerifyAPIDeduplicatesConcurrentRequests(t *testing.T) {
+	const n = 8
+	var calls atomic.Int32
+	arrived := make(chan struct{}, n)
+	release := make(chan struct{})
+	h := NewServer(Config{}, Deps{
+		Verify: func(_ context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+			calls.Add(1)
+			<-release
+			return &verify.Result{Image: ref.String(), Checks: []verify.Check{}}, nil
+		},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			arrived <- struct{}{}
+			rr := httptestutil.Get(h, "/api/v1/verify?image=ghcr.io/org/app:v1")
+			if rr.Code != http.StatusOK {
+				t.Errorf("status %d", rr.Code)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		<-arrived
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("%d concurrent requests ran %d verifications, want 1", n, calls.Load())
+	}
+	rr := httptestutil.Get(h, "/metrics")
+	httptestutil.AssertContains(t, rr,
+		"tekton_slsa_demo_verifications_total 1\n",
+		fmt.Sprintf("tekton_slsa_demo_verify_deduplicated_total %d\n", n-1),
+	)
+}
+
+func TestVerificationMetrics(t *testing.T) {
+	h := NewServer(Config{}, Deps{
+		Verify: func(_ context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+			return &verify.Result{Image: ref.String(), Checks: []verify.Check{}}, nil
+		},
+		Clock: clock.Fixed(time.Date(2024, 3, 12, 9, 0, 0, 0, time.UTC)),
+	})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/verify?image=ghcr.io/org/app:v1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	httptestutil.AssertStatus(t, httptestutil.Do(h, req), http.StatusOK)
+
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text")
+	httptestutil.AssertContains(t, httptestutil.Do(h, req),
+		"tekton_slsa_demo_verification_duration_seconds_count 1\n",
+		`# {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"}`,
+	)
+
+	rr := httptestutil.Get(h, "/api/v1/metrics/summary")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	var summary MetricsSummary
+	httptestutil.DecodeJSON(t, rr, &summary)
+	if summary.GeneratedAt != "2024-03-12T09:00:00Z" {
+		t.Errorf("generatedAt = %q", summary.GeneratedAt)
+	}
+	found := false
+	for _, m := range summary.Metrics {
+		if m.Name == "tekton_slsa_demo_verification_duration_seconds" {
+			found = m.Count != nil && *m.Count == 1 && m.Quantiles["p50"] >= 0
+		}
+	}
+	if !found {
+		t.Errorf("summary lacks the verification histogram: %+v", summary.Metrics)
+	}
+}
+
+func TestSearchAPI(t *testing.T) {
+	st := store.New()
+	now := time.Date(2024, 3, 12, 12, 0, 0, 0, time.UTC)
+	if _, err := SeedSampleData(st, now); err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(Config{}, Deps{Store: st})
+	search := func(query string) attestationList {
+		t.Helper()
+		rr := httptestutil.Get(h, "/api/v1/attestations/search"+query)
+		httptestutil.AssertStatus(t, rr, http.StatusOK)
+		var list attestationList
+		httptestutil.DecodeJSON(t, rr, &list)
+		return list
+	}
+
+	sum := sha256.Sum256([]byte(SampleImages[0]))
+	commit := hex.EncodeToString(sum[:20])
+	list := search("?commit=" + commit[:12] + "&source=https://github.com/waveywaves/tekton-slsa-demo")
+	if list.Count != 1 || list.Attestations[0].Subjects[0].Name != SampleImages[0] {
+		t.Errorf("by commit and source: %+v", list)
+	}
+	// Only the first sample finished building within the last hour.
+	list = search("?builder=https://tekton.dev/chains/v2&since=" + now.Add(-time.Hour).Format(time.RFC3339))
+	if list.Count != 1 {
+		t.Errorf("by builder since an hour ago: %d results, want 1", list.Count)
+	}
+	if list := search("?builder=https://example.com/other"); list.Count != 0 || list.Attestations == nil {
+		t.Errorf("no match: %+v", list)
+	}
+	if list := search("?limit=2"); list.Count != 2 {
+		t.Errorf("limit=2: %d results", list.Count)
+	}
+	if list := search("?until=2024-03-12"); list.Count == 0 {
+		t.Error("until a date did not cover that day")
+	}
+
+	for _, bad := range []string{"?since=yesterday", "?limit=0", "?limit=5000", "?commit=abc"} {
+		httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/attestations/search"+bad), http.StatusBadRequest)
+	}
+}
+
+func FuzzIngestAttestations(f *testing.F) {
+	paths, _ := filepath.Glob("../attestation/testdata/chains/*.json")
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	one, _ := json.Marshal(testEnvelope(f))
+	f.Add(one)
+	f.Add([]byte("[" + string(one) + "," + string(one) + "]"))
+	f.Add([]byte(`{"payloadType":"application/vnd.in-toto+json","payload":"bnVsbA==","signatures":[]}`))
+
+	h := NewServer(Config{APIToken: "s3cret"}, Deps{})
+	f.Fuzz(func(t *testing.T, body []byte) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/attestations", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rr := httptestutil.Do(h, req)
+		switch rr.Code {
+		case http.StatusOK, http.StatusCreated:
+		case http.StatusBadRequest:
+			return
+		default:
+			t.Fatalf("status %d: %s", rr.Code, rr.Body)
+		}
+
+		var res ingestResult
+		if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		for _, a := range res.Attestations {
+			if rr := httptestutil.Get(h, "/api/v1/attestations/"+a.ID); rr.Code != http.StatusOK {
+				t.Fatalf("GET %s after ingest: status %d", a.ID, rr.Code)
+			}
+		}
+	})
+}
+
+func TestSelfVerificationMetrics(t *testing.T) {
+	now := time.Date(2024, 3, 12, 12, 0, 0, 0, time.UTC)
+	st := store.New()
+	if _, err := SeedSampleData(st, now); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(SampleImages[0]))
+	const identity, issuer = "^https://github.com/waveywaves/", "https://token.actions.githubusercontent.com"
+	h := NewServer(Config{SelfImage: SampleImages[0], SelfIdentity: identity, SelfIssuer: issuer}, Deps{
+		Store: st,
+		Clock: clock.Fixed(now),
+		Verify: func(_ context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+			if opts.Identity != identity || opts.Issuer != issuer {
+				t.Errorf("self image verified with identity %q and issuer %q", opts.Identity, opts.Issuer)
+			}
+			return &verify.Result{
+				Image:    ref.String(),
+				Digest:   "sha256:" + hex.EncodeToString(sum[:]),
+				Checks:   []verify.Check{{Kind: verify.KindAttestation, PredicateType: attestation.PredicateSLSAProvenanceV1, Verified: true}},
+				Verified: true,
+			}, nil
+		},
+	})
+
+	// The first verification runs in the background as the server starts.
+	deadline := time.Now().Add(5 * time.Second)
+	var body string
+	for time.Now().Before(deadline) {
+		if body = httptestutil.Get(h, "/metrics").Body.String(); strings.Contains(body, "tekton_slsa_demo_slsa_verified 1\n") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, want := range []string{
+		"tekton_slsa_demo_slsa_verified 1\n",
+		"tekton_slsa_demo_self_verification_age_seconds 0\n",
+		// The sample build finished 57 minutes before the seed time.
+		"tekton_slsa_demo_provenance_age_seconds 3420\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+
+	plain := NewServer(Config{}, Deps{Verify: func(context.Context, oci.Reference, verify.Options) (*verify.Result, error) {
+		t.Error("verified without a self image")
+		return nil, errors.New("unexpected")
+	}})
+	if strings.Contains(httptestutil.Get(plain, "/metrics").Body.String(), "slsa_verified") {
+		t.Error("gauges registered without a self image")
+	}
+
+	// Without an identity and issuer, the image is reported unverified
+	// rather than verified against any trusted signer.
+	unpinned := NewServer(Config{SelfImage: SampleImages[0], SelfIdentity: identity}, Deps{
+		Logger: log.New(io.Discard, "", 0),
+		Verify: func(context.Context, oci.Reference, verify.Options) (*verify.Result, error) {
+			t.Error("verified without a self issuer")
+			return nil, errors.New("unexpected")
+		},
+	})
+	var st2 StatusJSON
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if st2 = (StatusJSON{}); json.Unmarshal(httptestutil.Get(unpinned, "/status.json").Body.Bytes(), &st2) == nil && st2.LastVerification != nil {
+			break
+		}
+	}
+	if st2.LastVerification == nil || st2.LastVerification.Verified {
+		t.Errorf("status without a self issuer = %+v", st2)
+	}
+	httptestutil.AssertContains(t, httptestutil.Get(unpinned, "/metrics"), "tekton_slsa_demo_slsa_verified 0\n")
+}
+
+func TestStatusJSON(t *testing.T) {
+	h := NewServer(Config{APIToken: "s3cret"}, Deps{Env: env.Map{"APP_VERSION": "1.2.3"}, Logger: log.New(io.Discard, "", 0)})
+	rr := httptestutil.Get(h, "/status.json")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertHeader(t, rr, "Cache-Control", "public, max-age=10")
+	var st StatusJSON
+	httptestutil.DecodeJSON(t, rr, &st)
+	if st.Status != "ok" || st.Version != "1.2.3" || st.LastVerification != nil {
+		t.Errorf("status = %+v", st)
+	}
+	// Monitors polling with the ETag get 304 until the status changes.
+	etag := rr.Header().Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, "/status.json", nil)
+	req.Header.Set("If-None-Match", etag)
+	httptestutil.AssertStatus(t, httptestutil.Do(h, req), http.StatusNotModified)
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/admin/maintenance", strings.NewReader(`{"enabled": true, "reason": "upgrade"}`))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	httptestutil.AssertStatus(t, httptestutil.Do(h, req), http.StatusOK)
+	rr = httptestutil.Get(h, "/status.json")
+	httptestutil.AssertContains(t, rr, `"status":"maintenance"`, `"reason":"upgrade"`)
+	if rr.Header().Get("ETag") == etag {
+		t.Error("the ETag did not change with the status")
+	}
+
+	// A failing verification of the server's own image degrades it.
+	h = NewServer(Config{SelfImage: "ghcr.io/org/app:v1", SelfIdentity: "^https://github.com/org/", SelfIssuer: "https://token.actions.githubusercontent.com"}, Deps{
+		Logger: log.New(io.Discard, "", 0),
+		Verify: func(_ context.Context, ref oci.Reference, _ verify.Options) (*verify.Result, error) {
+			return &verify.Result{Image: ref.String(), Digest: "sha256:" + strings.Repeat("a", 64), Checks: []verify.Check{}}, nil
+		},
+	})
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if st = (StatusJSON{}); json.Unmarshal(httptestutil.Get(h, "/status.json").Body.Bytes(), &st) == nil && st.LastVerification != nil {
+			break
+		}
+	}
+	if st.Status != "degraded" || st.Digest != "sha256:"+strings.Repeat("a", 64) || st.LastVerification == nil ||
+		st.LastVerification.Verified || st.LastVerification.LastVerified != nil || st.LastVerification.Image != "ghcr.io/org/app:v1" {
+		t.Errorf("status after a failed self-verification = %+v", st)
+	}
+}
+
+func TestStatusHistory(t *testing.T) {
+	now := time.Date(2024, 3, 12, 12, 0, 0, 0, time.UTC)
+	var calls atomic.Int64
+	h := NewServer(Config{
+		SelfImage:          "ghcr.io/org/app:v1",
+		SelfVerifyInterval: 10 * time.Millisecond,
+		SelfIdentity:       "^https://github.com/org/",
+		SelfIssuer:         "https://token.actions.githubusercontent.com",
+	}, Deps{
+		Clock:  clock.Fixed(now),
+		Logger: log.New(io.Discard, "", 0),
+		Verify: func(_ context.Context, ref oci.Reference, _ verify.Options) (*verify.Result, error) {
+			// Alternate between verified and unverified provenance.
+			ok := calls.Add(1)%2 == 1
+			return &verify.Result{
+				Image:    ref.String(),
+				Digest:   "sha256:aaa",
+				Checks:   []verify.Check{{Kind: verify.KindAttestation, PredicateType: attestation.PredicateSLSAProvenanceV1, Verified: ok}},
+				Verified: ok,
+			}, nil
+		},
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	var history statusHistory
+	for time.Now().Before(deadline) {
+		history = statusHistory{}
+		httptestutil.DecodeJSON(t, httptestutil.Get(h, "/api/v1/status/history?check=self:ghcr.io/org/app:v1"), &history)
+		if len(history.Checks) == 1 && history.Checks[0].Flapping {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(history.Checks) != 1 || !history.Checks[0].Flapping || history.Checks[0].Damped != status.Unverified {
+		t.Fatalf("checks = %+v, want self-verification flapping", history.Checks)
+	}
+	if n := len(history.Transitions); n < status.DefaultThreshold+1 || history.Transitions[n-1].From != "" || history.Transitions[n-1].To != status.Verified {
+		t.Errorf("transitions = %+v", history.Transitions)
+	}
+	body := httptestutil.Get(h, "/metrics").Body.String()
+	for _, want := range []string{"tekton_slsa_demo_status_flapping_checks 1\n", "tekton_slsa_demo_slsa_verified_damped 0\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q", want)
+		}
+	}
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/api/v1/status/history?check=watch:none"), `"checks":[]`, `"transitions":[]`)
+}
+
+func TestWatchList(t *testing.T) {
+	reg := fake.NewRegistry(t)
+	v1 := reg.PushImage(t, "app:v1")
+	reg.PushImage(t, "app:dev")
+	h := NewServer(Config{Watch: []WatchTarget{{Image: reg.Ref(t, "app").String(), Tags: "v*", Identity: "release@example.com"}}}, Deps{
+		Registry: reg.Client(),
+		Logger:   log.New(io.Discard, "", 0),
+		Verify: func(_ context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+			return &verify.Result{Image: ref.String(), Digest: ref.Digest, Verified: opts.Identity == "release@example.com"}, nil
+		},
+	})
+
+	// The first poll runs in the background as the server starts.
+	var metricsBody string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if metricsBody = httptestutil.Get(h, "/metrics").Body.String(); strings.Contains(metricsBody, "tekton_slsa_demo_watch_new_digests_total 1\n") {
+			break
+		}
+	}
+	if !strings.Contains(metricsBody, "tekton_slsa_demo_watch_unverified_images 0\n") {
+		t.Errorf("metrics after the first poll:\n%s", metricsBody)
+	}
+	rr := httptestutil.Get(h, "/api/v1/watch")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	var st watch.Status
+	httptestutil.DecodeJSON(t, rr, &st)
+	if len(st.Current) != 1 || st.Current[0].Digest != v1.Digest || !st.Current[0].Verified || st.LastPoll.IsZero() {
+		t.Fatalf("watch status = %+v", st)
+	}
+
+	unconfigured := NewServer(Config{}, Deps{})
+	httptestutil.AssertStatus(t, httptestutil.Get(unconfigured, "/api/v1/watch"), http.StatusNotImplemented)
+	if _, err := watchTargets([]WatchTarget{{Image: v1.String()}}); err == nil {
+		t.Error("watching a digest was accepted")
+	}
+}
+
+func TestWatchSharding(t *testing.T) {
+	reg := fake.NewRegistry(t)
+	want := map[string]bool{}
+	for _, tag := range []string{"v1", "v2", "v3", "v4", "v5", "v6"} {
+		want[reg.PushImage(t, "app:"+tag).Digest] = true
+	}
+	dir := t.TempDir()
+	a, err := shard.New(dir, "replica-0", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := shard.New(dir, "replica-1", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	verified := map[string]int{}
+	servers := map[*shard.Sharder]http.Handler{}
+	for _, sh := range []*shard.Sharder{a, b} {
+		servers[sh] = NewServer(Config{Watch: []WatchTarget{{Image: reg.Ref(t, "app").String(), Tags: "v*"}}}, Deps{
+			Registry: reg.Client(),
+			Logger:   log.New(io.Discard, "", 0),
+			Shard:    sh,
+			Verify: func(_ context.Context, ref oci.Reference, _ verify.Options) (*verify.Result, error) {
+				mu.Lock()
+				verified[ref.Digest]++
+				mu.Unlock()
+				return &verify.Result{Image: ref.String(), Digest: ref.Digest, Verified: true}, nil
+			},
+		})
+	}
+	done := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(verified) == len(want)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !done() && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+	}
+
+	// Every digest is verified by exactly the replica owning it.
+	mu.Lock()
+	defer mu.Unlock()
+	for d := range want {
+		if verified[d] != 1 {
+			t.Errorf("%s verified %d times", d, verified[d])
+		}
+	}
+	for sh, h := range servers {
+		var st watch.Status
+		httptestutil.DecodeJSON(t, httptestutil.Get(h, "/api/v1/watch"), &st)
+		for _, rec := range st.Current {
+			if !sh.Owns(rec.Digest) {
+				t.Errorf("%s reports %s, owned by the other replica", sh.ID(), rec.Digest)
+			}
+		}
+		httptestutil.AssertContains(t, httptestutil.Get(h, "/metrics"), "tekton_slsa_demo_shard_replicas 2\n")
+	}
+}
+
+func TestRegistryWebhook(t *testing.T) {
+	var calls atomic.Int32
+	const identity, issuer = "^https://github.com/org/app/", "https://token.actions.githubusercontent.com"
+	h := NewServer(Config{WebhookSecret: "hook", WebhookRepositories: []WebhookRepository{
+		{Repository: "registry.example.com/org/app", Identity: identity, Issuer: issuer},
+		// Without an issuer, pushes to the repository are refused.
+		{Repository: "registry.example.com/org/lib", Identity: identity},
+	}}, Deps{
+		Logger: log.New(io.Discard, "", 0),
+		Verify: func(_ context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+			calls.Add(1)
+			if opts.Identity != identity || opts.Issuer != issuer {
+				t.Errorf("%s verified with identity %q and issuer %q", ref, opts.Identity, opts.Issuer)
+			}
+			return &verify.Result{Image: ref.String(), Digest: ref.Digest, Checks: []verify.Check{}, Verified: true}, nil
+		},
+	})
+	const digest = "sha256:0f5d4c2a9b6e7d8c1a3f5e7b9d0c2e4f6a8b0d2c4e6f8a0b2d4c6e8f0a2b4c6d"
+	push := func(repository string) string {
+		return `{"events": [{"action": "push", "target": {"mediaType": "application/vnd.oci.image.manifest.v1+json",
+		"digest": "` + digest + `", "repository": "` + repository + `", "tag": "v1"}, "request": {"host": "registry.example.com"}}]}`
+	}
+	body := push("org/app")
+	post := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/registry", strings.NewReader(body))
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return httptestutil.Do(h, req)
+	}
+
+	httptestutil.AssertStatus(t, post(""), http.StatusUnauthorized)
+	httptestutil.AssertStatus(t, post("wrong"), http.StatusUnauthorized)
+	rr := post("hook")
+	httptestutil.AssertStatus(t, rr, http.StatusAccepted)
+	httptestutil.AssertContains(t, rr, `"format":"distribution"`, "registry.example.com/org/app:v1@"+digest)
+
+	var list pushList
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		httptestutil.DecodeJSON(t, httptestutil.Get(h, "/webhooks/registry"), &list)
+		if list.Count == 1 && list.Pushes[0].VerifiedAt != nil {
+			break
+		}
+	}
+	if list.Count != 1 || !list.Pushes[0].Verified || list.Pushes[0].Image != "registry.example.com/org/app:v1" {
+		t.Fatalf("pushes = %+v", list)
+	}
+	// The verification is cached for the digest and policy.
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/verify?image=registry.example.com/org/app@"+digest+
+		"&identity="+url.QueryEscape(identity)+"&issuer="+url.QueryEscape(issuer)), http.StatusOK)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("verified %d times, want 1", n)
+	}
+
+	// Pushes to repositories without an identity and issuer are recorded
+	// but not verified.
+	for _, repository := range []string{"org/lib", "org/other"} {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/registry", strings.NewReader(push(repository)))
+		req.Header.Set("Authorization", "hook")
+		httptestutil.AssertStatus(t, httptestutil.Do(h, req), http.StatusAccepted)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		list = pushList{}
+		httptestutil.DecodeJSON(t, httptestutil.Get(h, "/webhooks/registry"), &list)
+		if list.Count == 3 && list.Pushes[0].VerifiedAt != nil && list.Pushes[1].VerifiedAt != nil {
+			break
+		}
+	}
+	for _, rec := range list.Pushes[:2] {
+		if rec.Verified || rec.Code != failure.PolicyDenied {
+			t.Errorf("push to unconfigured repository = %+v", rec)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("verified %d times, want 1", n)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/registry", strings.NewReader(`{"kind": "unknown"}`))
+	req.Header.Set("Authorization", "Bearer hook")
+	httptestutil.AssertStatus(t, httptestutil.Do(h, req), http.StatusUnsupportedMediaType)
+
+	disabled := NewServer(Config{}, Deps{Verify: func(context.Context, oci.Reference, verify.Options) (*verify.Result, error) {
+		return nil, errors.New("unexpected")
+	}})
+	httptestutil.AssertStatus(t, httptestutil.Do(disabled, httptest.NewRequest(http.MethodPost, "/webhooks/registry", strings.NewReader(body))), http.StatusForbidden)
+}
+
+func TestDenylist(t *testing.T) {
+	const digest = "sha256:deadbeef"
+	h := NewServer(Config{APIToken: "s3cret"}, Deps{
+		Logger: log.New(io.Discard, "", 0),
+		Verify: func(_ context.Context, ref oci.Reference, _ verify.Options) (*verify.Result, error) {
+			return &verify.Result{
+				Image:    ref.String(),
+				Digest:   digest,
+				Checks:   []verify.Check{{Kind: verify.KindSignature, Signer: "release@example.com", Verified: true}},
+				Verified: true,
+			}, nil
+		},
+	})
+	admin := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		return httptestutil.Do(h, req)
+	}
+	verified := func() verifyResponse {
+		rr := httptestutil.Get(h, "/api/v1/verify?image=ghcr.io/org/app@"+digest)
+		httptestutil.AssertStatus(t, rr, http.StatusOK)
+		var res verifyResponse
+		httptestutil.DecodeJSON(t, rr, &res)
+		return res
+	}
+
+	if res := verified(); !res.Verified {
+		t.Fatalf("before denying: %+v", res.Result)
+	}
+	httptestutil.AssertStatus(t, httptestutil.Do(h, httptest.NewRequest(http.MethodPost, "/api/v1/admin/denylist", strings.NewReader(`{}`))), http.StatusUnauthorized)
+	httptestutil.AssertStatus(t, admin(http.MethodPost, "/api/v1/admin/denylist", `{"kind": "tag", "value": "v1"}`), http.StatusBadRequest)
+
+	rr := admin(http.MethodPost, "/api/v1/admin/denylist", `{"kind": "identity", "value": "release@example.com", "reason": "key compromised"}`)
+	httptestutil.AssertStatus(t, rr, http.StatusCreated)
+	var entry denylist.Entry
+	httptestutil.DecodeJSON(t, rr, &entry)
+
+	// Cached results are denied too.
+	res := verified()
+	if res.Verified || res.Checks[0].Verified || !strings.Contains(res.Checks[0].Error, "key compromised") {
+		t.Errorf("after denying the signer: %+v", res.Result)
+	}
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/metrics"), "tekton_slsa_demo_denylist_denials_total 1\n")
+	httptestutil.AssertContains(t, admin(http.MethodGet, "/api/v1/admin/denylist", ""), `"count":1`, "release@example.com")
+
+	httptestutil.AssertStatus(t, admin(http.MethodDelete, "/api/v1/admin/denylist/"+entry.ID, ""), http.StatusOK)
+	httptestutil.AssertStatus(t, admin(http.MethodDelete, "/api/v1/admin/denylist/"+entry.ID, ""), http.StatusNotFound)
+	if res := verified(); !res.Verified {
+		t.Errorf("after removing the entry: %+v", res.Result)
+	}
+}
+
+func TestReproducibility(t *testing.T) {
+	st := store.New()
+	if _, err := SeedSampleData(st, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	h := NewServer(Config{APIToken: "s3cret"}, Deps{Store: st, Clock: clock.Func(func() time.Time { return now })})
+	compare := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/reproducibility", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		return httptestutil.Do(h, req)
+	}
+
+	original := sampleDigest(SampleImages[0])
+	rebuilt := "sha256:" + strings.Repeat("0", 64)
+	httptestutil.AssertStatus(t, httptestutil.Do(h, httptest.NewRequest(http.MethodPost, "/api/v1/reproducibility", strings.NewReader(`{}`))), http.StatusUnauthorized)
+	httptestutil.AssertStatus(t, compare(`{"digest": "`+original+`"}`), http.StatusBadRequest)
+	httptestutil.AssertStatus(t, compare(`{"digest": "sha256:`+strings.Repeat("f", 64)+`", "rebuiltDigest": "`+rebuilt+`"}`), http.StatusNotFound)
+	httptestutil.AssertStatus(t, compare(`{"digest": "`+original+`", "rebuiltDigest": "sha512:`+strings.Repeat("0", 128)+`"}`), http.StatusUnprocessableEntity)
+
+	var c reproducibility.Comparison
+	rr := compare(`{"digest": "` + original + `", "rebuiltDigest": "` + rebuilt + `", "rebuilder": "alice"}`)
+	httptestutil.AssertStatus(t, rr, http.StatusCreated)
+	httptestutil.DecodeJSON(t, rr, &c)
+	if c.Reproducible || c.Subject != SampleImages[0] || c.Rebuilder != "alice" || c.AttestationID == "" {
+		t.Errorf("comparison = %+v, want a differing rebuild of %s", c, SampleImages[0])
+	}
+	now = now.Add(24 * time.Hour)
+	rr = compare(`{"attestationId": "` + c.AttestationID + `", "rebuiltDigest": "` + original + `"}`)
+	httptestutil.AssertStatus(t, rr, http.StatusCreated)
+	httptestutil.DecodeJSON(t, rr, &c)
+	if !c.Reproducible {
+		t.Errorf("comparison = %+v, want reproducible", c)
+	}
+
+	var report reproducibility.Report
+	httptestutil.DecodeJSON(t, httptestutil.Get(h, "/api/v1/reproducibility?digest="+original), &report)
+	if report.Compared != 2 || report.Rate != 0.5 || len(report.Days) != 2 || !report.Comparisons[0].Reproducible {
+		t.Errorf("report = %+v", report)
+	}
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/metrics"), "tekton_slsa_demo_reproducibility_rate 0.5", "tekton_slsa_demo_reproducible_rebuilds_total 1")
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/digest"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/strutil"
+)
+
+// maxArtifactSize bounds the artifacts /artifacts/{digest} downloads.
+const maxArtifactSize = 1 << 30
+
+// maxArtifactDownloads bounds the artifacts /artifacts/{digest} downloads
+// and serves at once, and so the bandwidth and temporary disk space they
+// take; further requests are rejected with 503 until one finishes.
+const maxArtifactDownloads = 4
+
+// artifactLocation is where an attested artifact can be downloaded from.
+type artifactLocation struct {
+	URL  string
+	Name string
+	// AttestationID is the attestation naming the artifact.
+	AttestationID string
+}
+
+// artifactHandler serves /artifacts/{digest}: it downloads the artifact an
+// attestation signed with one of the artifact keys names with that digest
+// from one of the configured artifact sources, checks the download against
+// the digest and only then serves it. A provenance byproduct is found at
+// its download location; a subject is found by name under the first
+// artifact source. Artifacts whose download does not match are never
+// served.
+func (s *server) artifactHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(s.cfg.ArtifactSources) == 0 || len(s.artifactKeys) == 0 {
+		http.Error(w, "artifact downloads are not configured", http.StatusNotImplemented)
+		return
+	}
+	alg, value, err := digest.Parse(strings.TrimPrefix(r.URL.Path, "/artifacts/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !digest.Supported(alg) {
+		http.Error(w, fmt.Sprintf("unsupported digest algorithm %q", alg), http.StatusBadRequest)
+		return
+	}
+	d := alg + ":" + value
+	// The slot is taken before the artifact is looked up, and held while
+	// it is served too, for as long as its download takes up disk space.
+	select {
+	case s.artifactSlots <- struct{}{}:
+		defer func() { <-s.artifactSlots }()
+	default:
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, fmt.Sprintf("%d artifact downloads are in progress, retry later", cap(s.artifactSlots)), http.StatusServiceUnavailable)
+		return
+	}
+	locs := s.artifactLocations(d)
+	if len(locs) == 0 {
+		http.Error(w, "no attestation signed with an artifact key names an artifact with digest "+d, http.StatusNotFound)
+		return
+	}
+	var loc *artifactLocation
+	for i := range locs {
+		if s.artifactSourceAllowed(locs[i].URL) {
+			loc = &locs[i]
+			break
+		}
+	}
+	if loc == nil {
+		http.Error(w, fmt.Sprintf("%s is not under a configured artifact source; refusing to download it", locs[0].URL), http.StatusForbidden)
+		return
+	}
+	f, err := s.downloadArtifact(r, loc.URL, alg, value)
+	if err != nil {
+		s.logger.Printf("Artifacts: %s: %v", d, err)
+		s.upstreamFailed(w, r, err)
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	s.stats.artifactDownloads.Inc()
+	name := path.Base(loc.Name)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("ETag", `"`+d+`"`)
+	w.Header().Set("X-Attestation-Id", loc.AttestationID)
+	http.ServeContent(w, r, name, time.Time{}, f)
+}
+
+// artifactLocations lists where the attested artifacts with digest d can
+// be downloaded from: subjects named under the first artifact source, then
+// provenance byproducts at their download location, most recently
+// received first. Only attestations signed with an artifact key count.
+// The store indexes subjects and byproducts by digest, so only the
+// attestations naming d are looked at.
+func (s *server) artifactLocations(d string) []artifactLocation {
+	var locs []artifactLocation
+	for _, a := range s.store.List(store.Filter{Digest: d}) {
+		if !s.signedByArtifactKey(a) {
+			continue
+		}
+		for _, sub := range a.Subjects {
+			if !digest.InSet(sub.Digest, d) {
+				continue
+			}
+			if u := s.subjectURL(sub.Name); u != "" {
+				locs = append(locs, artifactLocation{URL: u, Name: sub.Name, AttestationID: a.ID})
+			}
+		}
+	}
+	for _, a := range s.store.List(store.Filter{Byproduct: d}) {
+		if !s.signedByArtifactKey(a) {
+			continue
+		}
+		p, err := attestation.NormalizeProvenance(a.Statement())
+		if err != nil {
+			continue
+		}
+		for _, b := range p.RunDetails.Byproducts {
+			if !digest.InSet(b.Digest, d) {
+				continue
+			}
+			u := b.DownloadLocation
+			if u == "" {
+				u = b.URI
+			}
+			if strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "http://") {
+				locs = append(locs, artifactLocation{URL: u, Name: strutil.Default(b.Name, u), AttestationID: a.ID})
+			}
+		}
+	}
+	return locs
+}
+
+// subjectURL returns the URL of the subject called name: name itself when
+// it is an HTTP URL, or name under the first artifact source when it is a
+// relative path. Images, whose names start with a registry host, and other
+// names have no URL.
+func (s *server) subjectURL(name string) string {
+	if strings.HasPrefix(name, "https://") || strings.HasPrefix(name, "http://") {
+		return name
+	}
+	if name == "" || strings.Contains(name, "://") || strings.HasPrefix(name, "/") || path.Clean(name) != name || strings.HasPrefix(name, "..") {
+		return ""
+	}
+	if host, _, ok := strings.Cut(name, "/"); ok && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		return ""
+	}
+	return s.cfg.ArtifactSources[0] + name
+}
+
+// signedByArtifactKey reports whether a has a valid signature by one of
+// the artifact keys. The store keeps attestations whatever their
+// signatures, so the artifacts of unsigned or forged ones are not served.
+func (s *server) signedByArtifactKey(a *store.Attestation) bool {
+	return s.artifactSigned.check(a, s.artifactKeys)
+}
+
+// artifactSignatures remembers which attestations have a valid signature
+// by an artifact key. A stored attestation never changes, so each is
+// verified once rather than on every download.
+type artifactSignatures struct {
+	mu     sync.Mutex
+	signed map[string]bool
+}
+
+func (c *artifactSignatures) check(a *store.Attestation, keys []dsse.Verifier) bool {
+	c.mu.Lock()
+	signed, ok := c.signed[a.ID]
+	c.mu.Unlock()
+	if ok {
+		return signed
+	}
+	_, err := a.Envelope.Verify(keys...)
+	c.mu.Lock()
+	c.signed[a.ID] = err == nil
+	c.mu.Unlock()
+	return err == nil
+}
+
+// artifactSourceAllowed reports whether u is under one of the configured
+// artifact sources: whether it has a source's scheme and host and its
+// path, which must have no dot segments, is below the source's path
+// segment by segment.
+func (s *server) artifactSourceAllowed(u string) bool {
+	target, err := url.Parse(u)
+	if err != nil || target.User != nil || target.Path != path.Clean(target.Path) {
+		return false
+	}
+	for _, src := range s.cfg.ArtifactSources {
+		base, err := url.Parse(src)
+		if err != nil {
+			continue
+		}
+		// Sources end in a slash, so a prefix of the path is whole
+		// segments.
+		if strings.EqualFold(target.Scheme, base.Scheme) && strings.EqualFold(target.Host, base.Host) && strings.HasPrefix(target.Path, base.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadArtifact downloads u to a temporary file, hashing it on the way,
+// and returns the file, rewound, only if its alg digest is value. The
+// caller removes the file.
+func (s *server) downloadArtifact(r *http.Request, u, alg, value string) (*os.File, error) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: %s", u, resp.Status)
+	}
+	h, err := digest.New(alg)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp("", "artifact-*")
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (*os.File, error) {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(resp.Body, maxArtifactSize+1))
+	if err != nil {
+		return fail(fmt.Errorf("downloading %s: %w", u, err))
+	}
+	if n > maxArtifactSize {
+		return fail(fmt.Errorf("downloading %s: larger than %d bytes", u, maxArtifactSize))
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != value {
+		s.stats.artifactMismatches.Inc()
+		return fail(fmt.Errorf("%w: %s has digest %s:%s, not %s:%s; refusing to serve it", digest.ErrMismatch, u, alg, got, alg, value))
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	return f, nil
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/httptestutil"
+)
+
+func TestArtifactDownloads(t *testing.T) {
+	binary, logs := []byte("\x7fELF app binary"), []byte("build log\n")
+	sum := func(data []byte) string {
+		s := sha256.Sum256(data)
+		return hex.EncodeToString(s[:])
+	}
+	secret, unsigned := []byte("outside the releases"), []byte("\x7fELF unsigned binary")
+	bucket := map[string][]byte{
+		"/releases/bin/app":      binary,
+		"/releases/build.log":    logs,
+		"/releases/bin/tampered": []byte("not the attested binary"),
+		"/releases/bin/unsigned": unsigned,
+		"/elsewhere/build.log":   logs,
+		"/elsewhere/secret":      secret,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := bucket[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	// The provenance is about two binaries, one of which the bucket holds
+	// a different file for, and records the build log as a byproduct, as
+	// well as a file whose location climbs out of the releases.
+	tampered := sum([]byte("the attested binary"))
+	otherLog := sum([]byte("another log"))
+	pred := attestation.Provenance{RunDetails: attestation.RunDetails{Byproducts: []attestation.ResourceDescriptor{
+		{Name: "build.log", DownloadLocation: srv.URL + "/releases/build.log", Digest: map[string]string{"sha256": sum(logs)}},
+		{Name: "other.log", DownloadLocation: srv.URL + "/elsewhere/build.log", Digest: map[string]string{"sha256": otherLog}},
+		{Name: "secret", DownloadLocation: srv.URL + "/releases/../elsewhere/secret", Digest: map[string]string{"sha256": sum(secret)}},
+	}}}
+	key, other := artifactSigner(t), artifactSigner(t)
+	st := store.New()
+	a := addArtifactAttestation(t, st, key, pred,
+		attestation.Subject{Name: "bin/app", Digest: map[string]string{"sha256": sum(binary)}},
+		attestation.Subject{Name: "bin/tampered", Digest: map[string]string{"sha256": tampered}})
+	// Attestations without a signature by an artifact key name nothing
+	// downloadable.
+	addArtifactAttestation(t, st, nil, attestation.Provenance{}, attestation.Subject{Name: "bin/unsigned", Digest: map[string]string{"sha256": sum(unsigned)}})
+	addArtifactAttestation(t, st, other, attestation.Provenance{}, attestation.Subject{Name: "bin/unsigned", Digest: map[string]string{"sha256": sum(unsigned)}})
+	verifier, err := signing.NewVerifier(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(Config{ArtifactSources: []string{srv.URL + "/releases"}}, Deps{Store: st, HTTPClient: srv.Client(), ArtifactKeys: []dsse.Verifier{verifier}})
+
+	httptestutil.AssertStatus(t, httptestutil.Get(NewServer(Config{}, Deps{Store: st}), "/artifacts/sha256:"+sum(binary)), http.StatusNotImplemented)
+	httptestutil.AssertStatus(t, httptestutil.Get(NewServer(Config{ArtifactSources: []string{srv.URL + "/releases"}}, Deps{Store: st}), "/artifacts/sha256:"+sum(binary)), http.StatusNotImplemented)
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/artifacts/sha256:abc"), http.StatusBadRequest)
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/artifacts/sha256:"+strings.Repeat("0", 64)), http.StatusNotFound)
+
+	rr := httptestutil.Get(h, "/artifacts/sha256:"+sum(binary))
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	if rr.Body.String() != string(binary) {
+		t.Errorf("artifact = %q", rr.Body.String())
+	}
+	if got := rr.Header().Get("Content-Disposition"); got != `attachment; filename="app"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if got := rr.Header().Get("X-Attestation-Id"); got != a.ID {
+		t.Errorf("X-Attestation-Id = %q, want %s", got, a.ID)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/artifacts/sha256:"+sum(binary), nil)
+	req.Header.Set("Range", "bytes=5-7")
+	rr = httptestutil.Do(h, req)
+	httptestutil.AssertStatus(t, rr, http.StatusPartialContent)
+	if rr.Body.String() != "app" {
+		t.Errorf("range = %q", rr.Body.String())
+	}
+
+	rr = httptestutil.Get(h, "/artifacts/sha256:"+sum(logs))
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertContains(t, rr, "build log")
+
+	// A download that does not match its digest is refused, as is one from
+	// outside the artifact sources.
+	rr = httptestutil.Get(h, "/artifacts/sha256:"+tampered)
+	httptestutil.AssertStatus(t, rr, http.StatusBadGateway)
+	httptestutil.AssertContains(t, rr, "refusing to serve it")
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/artifacts/sha256:"+otherLog), http.StatusForbidden)
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/artifacts/sha256:"+sum(secret)), http.StatusForbidden)
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/artifacts/sha256:"+sum(unsigned)), http.StatusNotFound)
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/metrics"),
+		"tekton_slsa_demo_artifact_downloads_total 3", "tekton_slsa_demo_artifact_digest_mismatches_total 1")
+}
+
+func TestArtifactSourceAllowed(t *testing.T) {
+	s := &server{cfg: Config{ArtifactSources: []string{"https://storage.example.com/releases/", "http://mirror.example.com/"}}}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://storage.example.com/releases/bin/app", true},
+		{"https://STORAGE.example.com/releases/bin/app", true},
+		{"http://mirror.example.com/app.tar.gz", true},
+		{"https://storage.example.com/releases/../secret", false},
+		{"https://storage.example.com/releases/%2e%2e/secret", false},
+		{"https://storage.example.com/releases/bin/../../secret", false},
+		{"https://storage.example.com/releases-evil/app", false},
+		{"https://storage.example.com/releases", false},
+		{"http://storage.example.com/releases/bin/app", false},
+		{"https://storage.example.com.evil.com/releases/bin/app", false},
+		{"https://storage.example.com@evil.com/releases/bin/app", false},
+		{"https://user@storage.example.com/releases/bin/app", false},
+	}
+	for _, tt := range tests {
+		if got := s.artifactSourceAllowed(tt.url); got != tt.want {
+			t.Errorf("artifactSourceAllowed(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestArtifactDownloadsBounded(t *testing.T) {
+	data := []byte("\x7fELF app binary")
+	sum := sha256.Sum256(data)
+	arrived, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		w.Write(data)
+	}))
+	defer srv.Close()
+	key := artifactSigner(t)
+	st := store.New()
+	addArtifactAttestation(t, st, key, attestation.Provenance{}, attestation.Subject{Name: "bin/app", Digest: map[string]string{"sha256": hex.EncodeToString(sum[:])}})
+	verifier, err := signing.NewVerifier(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(Config{ArtifactSources: []string{srv.URL + "/releases"}}, Deps{Store: st, HTTPClient: srv.Client(), ArtifactKeys: []dsse.Verifier{verifier}})
+	target := "/artifacts/sha256:" + hex.EncodeToString(sum[:])
+
+	var wg sync.WaitGroup
+	for i := 0; i < maxArtifactDownloads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			httptestutil.AssertStatus(t, httptestutil.Get(h, target), http.StatusOK)
+		}()
+		<-arrived
+	}
+	rr := httptestutil.Get(h, target)
+	httptestutil.AssertStatus(t, rr, http.StatusServiceUnavailable)
+	httptestutil.AssertHeader(t, rr, "Retry-After", "10")
+	// The slot is taken before the store is searched.
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/artifacts/sha256:"+strings.Repeat("0", 64)), http.StatusServiceUnavailable)
+	close(release)
+	wg.Wait()
+}
+
+func TestArtifactDownloadOutlastsRequestTimeout(t *testing.T) {
+	data := []byte("\x7fELF app binary")
+	sum := sha256.Sum256(data)
+	// The artifact source sends half the artifact, then stalls for longer
+	// than the request timeout before sending the rest.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data[:len(data)/2])
+		w.(http.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+		w.Write(data[len(data)/2:])
+	}))
+	defer srv.Close()
+	key := artifactSigner(t)
+	st := store.New()
+	addArtifactAttestation(t, st, key, attestation.Provenance{}, attestation.Subject{Name: "bin/app", Digest: map[string]string{"sha256": hex.EncodeToString(sum[:])}})
+	verifier, err := signing.NewVerifier(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(Config{ArtifactSources: []string{srv.URL + "/releases"}, RequestTimeout: 50 * time.Millisecond},
+		Deps{Store: st, HTTPClient: srv.Client(), ArtifactKeys: []dsse.Verifier{verifier}})
+
+	rr := httptestutil.Get(h, "/artifacts/sha256:"+hex.EncodeToString(sum[:]))
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	if rr.Body.String() != string(data) {
+		t.Errorf("artifact = %q, want %q", rr.Body.String(), data)
+	}
+}
+
+// artifactSigner returns a fresh signing key.
+func artifactSigner(t *testing.T) *signing.Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := signing.NewSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// addArtifactAttestation stores a provenance about subjects, signed by
+// signer unless it is nil.
+func addArtifactAttestation(t *testing.T, st *store.Store, signer *signing.Signer, pred attestation.Provenance, subjects ...attestation.Subject) *store.Attestation {
+	t.Helper()
+	stmt, err := attestation.NewStatement(attestation.PredicateSLSAProvenanceV1, pred, subjects...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(stmt)
+	var signers []dsse.Signer
+	if signer != nil {
+		signers = append(signers, signer)
+	}
+	env, err := dsse.Sign(attestation.PayloadType, payload, signers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _, err := st.Add(env, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
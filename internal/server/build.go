@@ -0,0 +1,48 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+)
+
+// BuildParametersResponse is the body of a GET
+// /api/v1/attestations/{id}/build/parameters response: what a provenance
+// attestation discloses of how the build was invoked and where it ran.
+type BuildParametersResponse struct {
+	AttestationID string `json:"attestationId"`
+	PredicateType string `json:"predicateType"`
+	BuildType     string `json:"buildType"`
+	// ExternalParameters are the parameters under the control of whoever
+	// started the build, flattened into the dotted paths policies name
+	// them by; InternalParameters are those the builder set, including a
+	// v0.2 invocation environment.
+	ExternalParameters []attestation.Parameter    `json:"externalParameters"`
+	InternalParameters []attestation.Parameter    `json:"internalParameters"`
+	Builder            attestation.Builder        `json:"builder"`
+	Metadata           *attestation.BuildMetadata `json:"metadata,omitempty"`
+}
+
+// describeBuild flattens the parameters of a's provenance, v0.2 or v1.
+func describeBuild(a *store.Attestation) (*BuildParametersResponse, error) {
+	if !attestation.IsProvenance(a.PredicateType) {
+		return nil, fmt.Errorf("attestation %s is %s, not provenance", a.ID, attestation.PredicateName(a.PredicateType))
+	}
+	p, err := attestation.NormalizeProvenance(a.Statement())
+	if err != nil {
+		return nil, err
+	}
+	res := &BuildParametersResponse{
+		AttestationID:      a.ID,
+		PredicateType:      a.PredicateType,
+		BuildType:          p.BuildDefinition.BuildType,
+		ExternalParameters: []attestation.Parameter{},
+		InternalParameters: []attestation.Parameter{},
+		Builder:            p.RunDetails.Builder,
+		Metadata:           p.RunDetails.Metadata,
+	}
+	res.ExternalParameters = append(res.ExternalParameters, attestation.FlattenParameters("externalParameters", p.BuildDefinition.ExternalParameters)...)
+	res.InternalParameters = append(res.InternalParameters, attestation.FlattenParameters("internalParameters", p.BuildDefinition.InternalParameters)...)
+	return res, nil
+}
@@ -0,0 +1,311 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/denylist"
+	"github.com/waveywaves/tekton-slsa-demo/internal/digest"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// Bounds of the verification log: the digests it keeps records for, the
+// oldest dropped first, and the records kept per digest.
+const (
+	maxLoggedDigests          = 500
+	maxVerificationsPerDigest = 10
+)
+
+// verificationRecord is one verification of a digest, by /api/v1/verify,
+// the registry webhook or the watch list.
+type verificationRecord struct {
+	Image      string         `json:"image"`
+	VerifiedAt time.Time      `json:"verifiedAt"`
+	Verified   bool           `json:"verified"`
+	Result     *verify.Result `json:"result,omitempty"`
+	// Error is why the image could not be verified at all.
+	Error string       `json:"error,omitempty"`
+	Code  failure.Code `json:"code,omitempty"`
+}
+
+// verificationLog keeps the latest verifications of recently verified
+// digests, for attestation bundles. It is safe for concurrent use.
+type verificationLog struct {
+	mu       sync.Mutex
+	byDigest map[string][]verificationRecord
+	// digests are the keys of byDigest, least recently verified first.
+	digests []string
+}
+
+func newVerificationLog() *verificationLog {
+	return &verificationLog{byDigest: make(map[string][]verificationRecord)}
+}
+
+// record adds rec to the records of digest d.
+func (l *verificationLog) record(d string, rec verificationRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	recs, ok := l.byDigest[d]
+	if ok {
+		for i, k := range l.digests {
+			if k == d {
+				l.digests = append(l.digests[:i], l.digests[i+1:]...)
+				break
+			}
+		}
+	} else if len(l.digests) == maxLoggedDigests {
+		delete(l.byDigest, l.digests[0])
+		l.digests = l.digests[1:]
+	}
+	l.digests = append(l.digests, d)
+	recs = append(recs, rec)
+	if len(recs) > maxVerificationsPerDigest {
+		recs = recs[len(recs)-maxVerificationsPerDigest:]
+	}
+	l.byDigest[d] = recs
+}
+
+// list returns the records of digest d, newest first.
+func (l *verificationLog) list(d string) []verificationRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	recs := l.byDigest[d]
+	out := make([]verificationRecord, 0, len(recs))
+	for i := len(recs) - 1; i >= 0; i-- {
+		out = append(out, recs[i])
+	}
+	return out
+}
+
+// logVerification records the outcome of verifying ref, once denylisted
+// digests and signers have been failed, under its digest. Failures to
+// verify an image not pinned by digest have no digest to record them
+// under and are dropped.
+func (s *server) logVerification(ref oci.Reference, res *verify.Result, err error) {
+	rec := verificationRecord{Image: ref.String(), VerifiedAt: s.clock.Now()}
+	d := ref.Digest
+	if err != nil {
+		rec.Error, rec.Code = err.Error(), failure.CodeOf(err)
+	} else {
+		rec.Verified, rec.Result, rec.Code = res.Verified, res, res.Code
+		d = res.Digest
+	}
+	if d == "" {
+		return
+	}
+	s.verifications.record(digest.Canonical(d), rec)
+}
+
+// ImageBundle is the body of /api/v1/images/{digest}/bundle: everything
+// the server knows about an image digest.
+type ImageBundle struct {
+	Digest    string    `json:"digest"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Attestations are those stored about the digest, provenance, SBOMs
+	// and scan results among them, most recently received first.
+	Attestations []bundleAttestation `json:"attestations"`
+	// Registry has the signatures and attestations attached to the image
+	// in its registry, with their Rekor proofs and the trust root to check
+	// them, as bundle verify reads it. It is missing when the server
+	// cannot collect evidence or does not know the image's repository;
+	// RegistryError says why collecting it failed.
+	Registry          *verify.Bundle `json:"registry,omitempty"`
+	RegistryError     string         `json:"registryError,omitempty"`
+	RegistryErrorCode failure.Code   `json:"registryErrorCode,omitempty"`
+	// Verifications are the latest verifications of the digest, newest
+	// first.
+	Verifications []verificationRecord `json:"verifications"`
+	// Denylist has the entries denying the digest.
+	Denylist []denylist.Entry `json:"denylist"`
+}
+
+// bundleAttestation is a stored attestation with the transparency log
+// entry recorded for it.
+type bundleAttestation struct {
+	*store.Attestation
+	TransparencyURI string `json:"transparencyUri,omitempty"`
+}
+
+// Formats of attestation bundles.
+const (
+	bundleFormatJSON  = "json"
+	bundleFormatTarGz = "tar.gz"
+)
+
+// imagesHandler serves GET /api/v1/images/{digest}/bundle, which returns
+// an ImageBundle about the digest as a JSON download, or with
+// format=tar.gz as an archive with each attestation envelope and the
+// registry bundle in files of their own. The image's repository, needed
+// to collect evidence from its registry, is taken from the subjects of
+// the attestations stored about the digest, or from the repository
+// parameter.
+func (s *server) imagesHandler(w http.ResponseWriter, r *http.Request) {
+	d, part, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/images/"), "/")
+	if part != "bundle" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	alg, value, err := digest.Parse(d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d = alg + ":" + value
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = bundleFormatJSON
+	}
+	if format != bundleFormatJSON && format != bundleFormatTarGz {
+		http.Error(w, fmt.Sprintf("unknown format %q: want json or tar.gz", format), http.StatusBadRequest)
+		return
+	}
+
+	b, err := s.imageBundle(r, d, q.Get("repository"))
+	if len(b.Attestations) == 0 && b.Registry == nil && len(b.Verifications) == 0 && len(b.Denylist) == 0 {
+		if err != nil {
+			s.upstreamFailed(w, r, err)
+			return
+		}
+		http.Error(w, "nothing is known about "+d, http.StatusNotFound)
+		return
+	}
+	name := alg + "-" + value + ".bundle"
+	if format == bundleFormatJSON {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".json"))
+		writeJSON(w, http.StatusOK, b)
+		return
+	}
+	data, err := tarBundle(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".tar.gz"))
+	w.Write(data)
+}
+
+// imageBundle gathers what the server knows about digest d, collecting
+// the registry's evidence about it in repository, or in the repository
+// of a stored subject with that digest. It returns the error collecting
+// the evidence failed with too, which the bundle records.
+func (s *server) imageBundle(r *http.Request, d, repository string) (*ImageBundle, error) {
+	b := &ImageBundle{
+		Digest:        d,
+		CreatedAt:     s.clock.Now().UTC(),
+		Attestations:  []bundleAttestation{},
+		Verifications: s.verifications.list(d),
+		Denylist:      []denylist.Entry{},
+	}
+	stored := s.store.List(store.Filter{Digest: d})
+	for _, a := range stored {
+		b.Attestations = append(b.Attestations, bundleAttestation{Attestation: a, TransparencyURI: s.store.TransparencyURI(a.ID)})
+	}
+	for _, e := range s.denylist.Entries() {
+		if e.Kind == denylist.KindDigest && digest.Canonical(e.Value) == d {
+			b.Denylist = append(b.Denylist, e)
+		}
+	}
+	if s.collect == nil {
+		return b, nil
+	}
+	ref, err := scanTarget(d, repository, stored)
+	if err != nil {
+		// Without a repository there is no registry to ask.
+		return b, nil
+	}
+	if b.Registry, err = s.collect(r.Context(), ref); err != nil {
+		s.logger.Printf("Bundle: collecting the evidence of %s: %v", ref, err)
+		b.RegistryError, b.RegistryErrorCode = err.Error(), failure.CodeOf(err)
+		return b, err
+	}
+	return b, nil
+}
+
+// bundleFile is a file of a tar.gz attestation bundle, listed in its
+// manifest.json.
+type bundleFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+// tarBundle archives b as a gzip-compressed tarball:
+//
+//	bundle.json
+//	attestations/<id>.dsse.json
+//	registry.bundle.json, when the registry's evidence was collected
+//	verifications.json
+//	manifest.json
+func tarBundle(b *ImageBundle) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	var files []bundleFile
+	add := func(path string, data []byte) error {
+		sum := sha256.Sum256(data)
+		files = append(files, bundleFile{Path: path, SHA256: hex.EncodeToString(sum[:]), Size: len(data)})
+		hdr := &tar.Header{Name: path, Mode: 0o644, Size: int64(len(data)), ModTime: b.CreatedAt}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	addJSON := func(path string, v any) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		return add(path, append(data, '\n'))
+	}
+
+	if err := addJSON("bundle.json", b); err != nil {
+		return nil, err
+	}
+	for _, a := range b.Attestations {
+		var env bytes.Buffer
+		if _, err := env.ReadFrom(a.OpenEnvelope()); err != nil {
+			return nil, err
+		}
+		if err := add("attestations/"+a.ID+".dsse.json", env.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	if b.Registry != nil {
+		if err := addJSON("registry.bundle.json", b.Registry); err != nil {
+			return nil, err
+		}
+	}
+	if err := addJSON("verifications.json", b.Verifications); err != nil {
+		return nil, err
+	}
+	if err := addJSON("manifest.json", files); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
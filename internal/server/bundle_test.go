@@ -0,0 +1,155 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/denylist"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/httptestutil"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+func TestImageBundle(t *testing.T) {
+	st := store.New()
+	if _, err := SeedSampleData(st, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	sample := sampleDigest(SampleImages[0])
+	stored := st.List(store.Filter{Digest: sample})
+	if err := st.SetTransparencyURI(stored[0].ID, "https://rekor.sigstore.dev/api/v1/log/entries?logIndex=7"); err != nil {
+		t.Fatal(err)
+	}
+	deny := denylist.New()
+	if _, err := deny.Add(denylist.Entry{Kind: denylist.KindDigest, Value: strings.ToUpper(sample), Reason: "incident 42"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	offline := "sha256:" + strings.Repeat("e", 64)
+	var collected []string
+	h := NewServer(Config{}, Deps{
+		Store:    st,
+		Denylist: deny,
+		Logger:   log.New(io.Discard, "", 0),
+		Verify: func(_ context.Context, ref oci.Reference, _ verify.Options) (*verify.Result, error) {
+			return &verify.Result{Image: ref.String(), Digest: ref.Digest, Checks: []verify.Check{{Kind: verify.KindSignature, Verified: true}}, Verified: true}, nil
+		},
+		Collect: func(_ context.Context, ref oci.Reference) (*verify.Bundle, error) {
+			collected = append(collected, ref.String())
+			if ref.Digest == offline {
+				return nil, failure.New(failure.RekorUnreachable, "fetching inclusion proof for log index 7: %w", io.ErrUnexpectedEOF)
+			}
+			return &verify.Bundle{MediaType: verify.BundleMediaType, Evidence: verify.Evidence{Image: ref.String(), Digest: ref.Digest, Signatures: []verify.Signature{{Signature: "MEUCIQ"}}}}, nil
+		},
+	})
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/verify?image="+SampleImages[0]+"@"+sample), http.StatusOK)
+
+	rr := httptestutil.Get(h, "/api/v1/images/"+sample+"/bundle")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertHeader(t, rr, "Content-Disposition", `attachment; filename="sha256-`+strings.TrimPrefix(sample, "sha256:")+`.bundle.json"`)
+	var b ImageBundle
+	httptestutil.DecodeJSON(t, rr, &b)
+	if b.Digest != sample || len(b.Attestations) != len(stored) || b.Attestations[0].TransparencyURI == "" {
+		t.Errorf("attestations = %+v", b.Attestations)
+	}
+	if b.Registry == nil || len(b.Registry.Evidence.Signatures) != 1 || collected[0] != SampleImages[0]+"@"+sample {
+		t.Errorf("registry evidence = %+v, collected for %q", b.Registry, collected)
+	}
+	// The verification is logged as the denylist failed it.
+	if len(b.Verifications) != 1 || b.Verifications[0].Verified || b.Verifications[0].Code != failure.PolicyDenied {
+		t.Errorf("verifications = %+v", b.Verifications)
+	}
+	if len(b.Denylist) != 1 || b.Denylist[0].Reason != "incident 42" {
+		t.Errorf("denylist = %+v", b.Denylist)
+	}
+
+	rr = httptestutil.Get(h, "/api/v1/images/"+sample+"/bundle?format=tar.gz")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertHeader(t, rr, "Content-Type", "application/gzip")
+	files := untarBundle(t, rr.Body)
+	want := []string{"bundle.json", "registry.bundle.json", "verifications.json", "manifest.json"}
+	for _, a := range stored {
+		want = append(want, "attestations/"+a.ID+".dsse.json")
+	}
+	for _, name := range want {
+		if _, ok := files[name]; !ok {
+			t.Errorf("the archive has no %s", name)
+		}
+	}
+	var manifest []bundleFile
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest) != len(files)-1 {
+		t.Errorf("the manifest lists %d of %d files", len(manifest), len(files)-1)
+	}
+	for _, f := range manifest {
+		sum := sha256.Sum256(files[f.Path])
+		if hex.EncodeToString(sum[:]) != f.SHA256 {
+			t.Errorf("%s does not match its digest in the manifest", f.Path)
+		}
+	}
+
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/images/"+sample+"/bundle?format=zip"), http.StatusBadRequest)
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/images/sha256:abc/bundle"), http.StatusBadRequest)
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/images/"+sample+"/signatures"), http.StatusNotFound)
+	// Nothing is known about a digest no attestation names.
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/images/sha256:"+strings.Repeat("f", 64)+"/bundle"), http.StatusNotFound)
+	// Nor about one whose registry cannot be reached.
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/images/"+offline+"/bundle?repository=ghcr.io/org/app"), http.StatusBadGateway)
+}
+
+// untarBundle reads the files of a tar.gz attestation bundle.
+func untarBundle(t *testing.T, r io.Reader) map[string][]byte {
+	t.Helper()
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files[hdr.Name], err = io.ReadAll(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerificationLogBounds(t *testing.T) {
+	l := newVerificationLog()
+	for i := 0; i < maxVerificationsPerDigest+2; i++ {
+		l.record("sha256:0", verificationRecord{Image: fmt.Sprint(i)})
+	}
+	recs := l.list("sha256:0")
+	if len(recs) != maxVerificationsPerDigest || recs[0].Image != fmt.Sprint(maxVerificationsPerDigest+1) {
+		t.Errorf("kept %d records, newest %s", len(recs), recs[0].Image)
+	}
+	for i := 1; i < maxLoggedDigests; i++ {
+		l.record(fmt.Sprintf("sha256:%d", i), verificationRecord{})
+	}
+	// Verifying the first digest again keeps it over the second.
+	l.record("sha256:0", verificationRecord{})
+	l.record("sha256:new", verificationRecord{})
+	if len(l.list("sha256:0")) == 0 || len(l.list("sha256:1")) != 0 || len(l.byDigest) != maxLoggedDigests {
+		t.Errorf("kept %d digests", len(l.byDigest))
+	}
+}
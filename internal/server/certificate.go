@@ -0,0 +1,125 @@
+package server
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+)
+
+// CertificateResponse is the body of a GET
+// /api/v1/attestations/{id}/certificate response: where the attestation
+// was logged and who signed it.
+type CertificateResponse struct {
+	AttestationID string `json:"attestationId"`
+	PredicateType string `json:"predicateType"`
+	// TransparencyURI is the Rekor entry Chains reported for the
+	// attestation, when it was given at ingest.
+	TransparencyURI string `json:"transparencyURI,omitempty"`
+	// Certificates describes the signing certificate of each signature
+	// that carries one; key-based signatures have none.
+	Certificates []CertificateDetails `json:"certificates"`
+}
+
+// CertificateDetails describes a signature's signing certificate.
+type CertificateDetails struct {
+	KeyID        string    `json:"keyId,omitempty"`
+	Subject      string    `json:"subject,omitempty"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serialNumber"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+	// Identity is the subject alternative name Fulcio bound the key to.
+	Identity                string             `json:"identity,omitempty"`
+	SubjectAlternativeNames []string           `json:"subjectAlternativeNames"`
+	Extensions              signing.Extensions `json:"extensions"`
+	PEM                     string             `json:"pem"`
+}
+
+// describeCertificates decodes the signing certificates on a's envelope.
+// The store rejects envelopes whose certificates do not parse.
+func (s *server) describeCertificates(a *store.Attestation) *CertificateResponse {
+	res := &CertificateResponse{
+		AttestationID:   a.ID,
+		PredicateType:   a.PredicateType,
+		TransparencyURI: s.store.TransparencyURI(a.ID),
+		Certificates:    []CertificateDetails{},
+	}
+	for _, sig := range a.Envelope.Signatures {
+		if sig.Cert == "" {
+			continue
+		}
+		chain, err := signing.ParseCertificates([]byte(sig.Cert))
+		if err != nil {
+			continue
+		}
+		res.Certificates = append(res.Certificates, certificateDetails(sig.KeyID, sig.Cert, chain[0]))
+	}
+	return res
+}
+
+func certificateDetails(keyID, pem string, cert *x509.Certificate) CertificateDetails {
+	d := CertificateDetails{
+		KeyID:                   keyID,
+		Subject:                 cert.Subject.String(),
+		Issuer:                  cert.Issuer.String(),
+		SerialNumber:            cert.SerialNumber.String(),
+		NotBefore:               cert.NotBefore.UTC(),
+		NotAfter:                cert.NotAfter.UTC(),
+		SubjectAlternativeNames: []string{},
+		Extensions:              signing.FulcioExtensions(cert),
+		PEM:                     pem,
+	}
+	d.Identity, _ = signing.CertificateIdentity(cert)
+	for _, u := range cert.URIs {
+		d.SubjectAlternativeNames = append(d.SubjectAlternativeNames, "URI:"+u.String())
+	}
+	for _, e := range cert.EmailAddresses {
+		d.SubjectAlternativeNames = append(d.SubjectAlternativeNames, "email:"+e)
+	}
+	for _, n := range cert.DNSNames {
+		d.SubjectAlternativeNames = append(d.SubjectAlternativeNames, "DNS:"+n)
+	}
+	return d
+}
+
+// parseTransparencyURI checks a transparency log entry URI given at
+// ingest, such as https://rekor.sigstore.dev/api/v1/log/entries?logIndex=1.
+func parseTransparencyURI(v string) (string, error) {
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("transparency must be an http or https URL")
+	}
+	return u.String(), nil
+}
+
+// attestationPage serves the HTML views of an attestation:
+// /attestations/{id}/certificate, its signing certificates, and
+// /attestations/{id}/build/parameters, its build parameters.
+func (s *server) attestationPage(w http.ResponseWriter, r *http.Request) {
+	id, view, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/attestations/"), "/")
+	if id == "" || (view != "certificate" && view != "build/parameters") {
+		http.NotFound(w, r)
+		return
+	}
+	a, err := s.store.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if view == "certificate" {
+		s.web.render(w, r, "certificate.html", s.describeCertificates(a))
+		return
+	}
+	res, err := describeBuild(a)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	s.web.render(w, r, "build.html", res)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// withDeadline cancels the context of each request once it has been
+// handled for timeout, so that verifications and the registry, Rekor and
+// Kubernetes calls they make are abandoned rather than left running for
+// a client that has stopped waiting. Transfers are exempt: they take as
+// long as the client and the artifact source need, and a deadline would
+// only cut them short.
+func withDeadline(next http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isTransfer(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// isTransfer reports whether r downloads or streams content whose size,
+// not the work of answering it, decides how long it takes: artifacts,
+// archived attestation documents, the streamed attestation listing and
+// the SBOM.
+func isTransfer(r *http.Request) bool {
+	p := r.URL.Path
+	switch {
+	case strings.HasPrefix(p, "/artifacts/"), p == "/sbom":
+		return true
+	case p == "/api/v1/attestations":
+		return r.URL.Query().Get("format") == "ndjson" || r.Header.Get("Accept") == ndjsonMediaType
+	case strings.HasPrefix(p, "/api/v1/attestations/"):
+		_, part, _ := strings.Cut(strings.TrimPrefix(p, "/api/v1/attestations/"), "/")
+		return part == "envelope" || part == "payload"
+	}
+	return false
+}
+
+// upstreamFailed replies to a request whose call to a registry, Rekor or
+// another backend failed with err: 504 when the request ran out of time,
+// 502 otherwise. Nothing is written when the client has gone away.
+func (s *server) upstreamFailed(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(r.Context().Err(), context.Canceled):
+		s.logger.Printf("%s %s: client went away: %v", r.Method, r.URL.Path, err)
+	default:
+		httpFailure(w, err, upstreamStatus(err))
+	}
+}
+
+// upstreamStatus is the status reporting a failed call to a backend.
+func upstreamStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
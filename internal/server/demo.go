@@ -0,0 +1,218 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/policy"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+)
+
+// maxDemoBody bounds the part of a response the demo page shows.
+const maxDemoBody = 16 << 10
+
+// demoPolicy is the policy the demo page evaluates unless given another.
+const demoPolicy = `name: tekton-built
+rules:
+  - name: built-by-chains
+    predicateType: https://slsa.dev/provenance/v1
+    conditions:
+      - path: predicate.runDetails.builder.id
+        matches: ^https://tekton.dev/chains/
+`
+
+// demoPage is the data rendered by the demo template.
+type demoPage struct {
+	Image  string
+	Policy string
+	// Steps are empty until an image is given.
+	Steps []demoStep
+}
+
+// demoStep is one step of the walkthrough: the request it made of the API
+// and the response, as a terminal would show them.
+type demoStep struct {
+	// Title is the i18n key of the step's title.
+	Title   string
+	Command string
+	Status  int
+	Output  string
+	OK      bool
+	// Note is the i18n key of a remark on the step, formatted with
+	// NoteArg, such as why it made no request.
+	Note, NoteArg string
+}
+
+// demoHandler serves /demo, a walkthrough of verifying an image with the
+// API: it resolves the image's digest, lists the attestations about it,
+// verifies its signatures and evaluates a policy against its attestations,
+// making each request of this server in-process and rendering the
+// responses inline, so presenters need no terminal.
+func (s *server) demoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	page := demoPage{Image: strings.TrimSpace(q.Get("image")), Policy: q.Get("policy")}
+	if page.Policy == "" {
+		page.Policy = demoPolicy
+	}
+	if page.Image == "" {
+		page.Image = s.demoImage()
+		s.web.render(w, r, "demo.html", page)
+		return
+	}
+	page.Steps = s.runDemo(r, page.Image, page.Policy)
+	s.web.render(w, r, "demo.html", page)
+}
+
+// demoImage suggests an image to walk through: the server's own, or in
+// development mode a seeded sample.
+func (s *server) demoImage() string {
+	if s.cfg.SelfImage != "" {
+		return s.cfg.SelfImage
+	}
+	if s.cfg.Dev {
+		return SampleImages[0] + "@" + sampleDigest(SampleImages[0])
+	}
+	return ""
+}
+
+func (s *server) runDemo(r *http.Request, image, policyText string) []demoStep {
+	ref, err := oci.ParseReference(image)
+	if err != nil {
+		return []demoStep{{Title: "demo.step.digest", Output: err.Error()}}
+	}
+
+	// An image pinned by digest needs no registry lookup.
+	digest := ref.Digest
+	var steps []demoStep
+	if digest != "" {
+		steps = append(steps, demoStep{Title: "demo.step.digest", Note: "demo.pinned", NoteArg: digest, OK: true})
+	} else {
+		body, _ := json.Marshal(map[string]string{"image": image})
+		step, res := s.demoRequest(r, http.MethodPost, "/api/v1/digest", body)
+		var d DigestResponse
+		if step.OK && json.Unmarshal(res, &d) == nil && d.Digests["sha256"] != "" {
+			digest = "sha256:" + d.Digests["sha256"]
+		}
+		steps = append(steps, step)
+	}
+
+	var stmts []*attestation.Statement
+	if digest != "" {
+		step, _ := s.demoRequest(r, http.MethodGet, "/api/v1/attestations?digest="+url.QueryEscape(digest), nil)
+		steps = append(steps, step)
+		for _, a := range s.store.List(store.Filter{Digest: digest}) {
+			stmts = append(stmts, a.Statement())
+		}
+	}
+
+	step, _ := s.demoRequest(r, http.MethodGet, "/api/v1/verify?image="+url.QueryEscape(image), nil)
+	steps = append(steps, step)
+
+	return append(steps, s.demoPolicy(policyText, stmts))
+}
+
+// demoRequest makes a request of the server's own API and describes it as
+// a step.
+func (s *server) demoRequest(r *http.Request, method, target string, body []byte) (demoStep, []byte) {
+	step := demoStep{Title: demoStepTitle(target), Command: demoCommand(method, target, body)}
+	req, err := http.NewRequestWithContext(r.Context(), method, target, bytes.NewReader(body))
+	if err != nil {
+		step.Output = err.Error()
+		return step, nil
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := &demoRecorder{header: make(http.Header), status: http.StatusOK}
+	s.mux.ServeHTTP(rec, req)
+	res := rec.body.Bytes()
+	step.Status = rec.status
+	step.OK = rec.status < 300
+	step.Output = demoOutput(res)
+	return step, res
+}
+
+// demoPolicy evaluates the policy against the stored attestations, as
+// "tekton-slsa-demo policy test" evaluates it against fixtures.
+func (s *server) demoPolicy(text string, stmts []*attestation.Statement) demoStep {
+	step := demoStep{Title: "demo.step.policy", Note: "demo.evaluated", NoteArg: strconv.Itoa(len(stmts))}
+	p, err := policy.Parse([]byte(text))
+	if err != nil {
+		step.Output = err.Error()
+		return step
+	}
+	d, err := p.EvaluateAt(stmts, s.clock.Now())
+	if err != nil {
+		step.Output = err.Error()
+		return step
+	}
+	out, _ := json.MarshalIndent(d, "", "  ")
+	step.OK = d.Allow
+	step.Output = string(out)
+	return step
+}
+
+func demoStepTitle(target string) string {
+	switch {
+	case strings.HasPrefix(target, "/api/v1/digest"):
+		return "demo.step.digest"
+	case strings.HasPrefix(target, "/api/v1/attestations"):
+		return "demo.step.attestations"
+	}
+	return "demo.step.verify"
+}
+
+// demoCommand writes a request as the curl command that would make it.
+func demoCommand(method, target string, body []byte) string {
+	cmd := "curl"
+	if method != http.MethodGet {
+		cmd += " -X " + method
+	}
+	if body != nil {
+		cmd += " -H 'Content-Type: application/json' -d '" + string(body) + "'"
+	}
+	return cmd + ` "$SERVER` + target + `"`
+}
+
+// demoOutput indents a JSON response and cuts it to maxDemoBody.
+func demoOutput(res []byte) string {
+	var buf bytes.Buffer
+	if json.Indent(&buf, res, "", "  ") != nil {
+		buf.Reset()
+		buf.Write(res)
+	}
+	out := strings.TrimSpace(buf.String())
+	if len(out) > maxDemoBody {
+		out = out[:maxDemoBody] + "\n…"
+	}
+	return out
+}
+
+// demoRecorder records a response of the API for the demo page.
+type demoRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *demoRecorder) Header() http.Header { return r.header }
+
+func (r *demoRecorder) Write(p []byte) (int, error) {
+	if r.body.Len() > maxDemoBody {
+		return len(p), nil
+	}
+	return r.body.Write(p)
+}
+
+func (r *demoRecorder) WriteHeader(status int) { r.status = status }
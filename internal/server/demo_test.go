@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/fake"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/httptestutil"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+func TestDemoPage(t *testing.T) {
+	st := store.New()
+	if _, err := SeedSampleData(st, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(Config{}, Deps{
+		Store: st,
+		Verify: func(_ context.Context, ref oci.Reference, _ verify.Options) (*verify.Result, error) {
+			return &verify.Result{Image: ref.String(), Digest: ref.Digest, Verified: true}, nil
+		},
+	})
+
+	// Without an image, the page is only the form.
+	rr := httptestutil.Get(h, "/demo")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertContains(t, rr, `<form class="demo"`, "built-by-chains")
+	if strings.Contains(rr.Body.String(), `class="terminal"`) {
+		t.Error("steps run without an image")
+	}
+
+	image := SampleImages[0] + "@" + sampleDigest(SampleImages[0])
+	rr = httptestutil.Get(h, "/demo?image="+url.QueryEscape(image))
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	body := html.UnescapeString(rr.Body.String())
+	for _, want := range []string{
+		"1. Fetch the digest", "The reference pins <code>" + sampleDigest(SampleImages[0]) + "</code>",
+		"2. Discover attestations", `curl "$SERVER/api/v1/attestations?digest=sha256%3A`, `"count": 2`,
+		"3. Verify signatures", `"verified": true`,
+		"4. Evaluate the policy", "against the 2 stored attestation(s)", `"allow": true`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+	if strings.Contains(body, `class="failed"`) {
+		t.Error("a step failed")
+	}
+
+	rr = httptestutil.Get(h, "/demo?image="+url.QueryEscape(image)+"&policy="+url.QueryEscape("rules: [}"))
+	httptestutil.AssertContains(t, rr, `class="failed"`)
+}
+
+func TestDemoPageResolvesTags(t *testing.T) {
+	reg := fake.NewRegistry(t)
+	ref := reg.PushImage(t, "app:v1")
+	h := NewServer(Config{}, Deps{Registry: reg.Client()})
+
+	rr := httptestutil.Get(h, "/demo?image="+url.QueryEscape(ref.WithTag("v1").String()))
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	body := html.UnescapeString(rr.Body.String())
+	for _, want := range []string{
+		`curl -X POST -H 'Content-Type: application/json' -d '{"image":"` + ref.WithTag("v1").String() + `"}' "$SERVER/api/v1/digest"`,
+		`"source": "image"`,
+		"?digest=" + url.QueryEscape(ref.Digest),
+		`"count": 0`,
+		// Verification is not configured.
+		"HTTP 501",
+		`"allow": false`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+}
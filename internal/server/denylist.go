@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/denylist"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// denylistResponse is the response of GET /api/v1/admin/denylist.
+type denylistResponse struct {
+	Count   int              `json:"count"`
+	Entries []denylist.Entry `json:"entries"`
+}
+
+// applyDenylist fails res when its digest or one of its signers is on the
+// denylist, logging and counting the denial.
+func (s *server) applyDenylist(res *verify.Result) *verify.Result {
+	denied, matched := s.denylist.Apply(res)
+	for _, e := range matched {
+		s.logger.Printf("Denylist: verification of %s failed: %s %s is denied (entry %s)", res.Image, e.Kind, e.Value, e.ID)
+	}
+	if len(matched) > 0 {
+		s.stats.denied.Inc()
+	}
+	return denied
+}
+
+// denylistHandler manages the denylist: GET /api/v1/admin/denylist lists
+// the entries, POST adds one ({"kind": "digest"|"identity", "value": ...,
+// "reason": ...}) and DELETE /api/v1/admin/denylist/{id} removes one. All
+// need the API token.
+func (s *server) denylistHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/denylist"), "/")
+	if id != "" {
+		if r.Method != http.MethodDelete {
+			w.Header().Set("Allow", "DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		e, err := s.removeDenylistEntry(id, "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, e)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		entries := s.denylist.Entries()
+		writeJSON(w, http.StatusOK, denylistResponse{Count: len(entries), Entries: entries})
+	case http.MethodPost:
+		var e denylist.Entry
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&e); err != nil {
+			http.Error(w, "invalid denylist entry: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		added, err := s.addDenylistEntry(e, "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusCreated, added)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// addDenylistEntry adds the kind, value and reason of e to the denylist on
+// behalf of actor, the signed-in administrator or "" for the API token.
+// It fails only for invalid entries; failing to save the list is logged.
+func (s *server) addDenylistEntry(e denylist.Entry, actor string) (denylist.Entry, error) {
+	added, err := s.denylist.Add(denylist.Entry{Kind: e.Kind, Value: e.Value, Reason: e.Reason}, s.clock.Now())
+	if errors.Is(err, denylist.ErrInvalidEntry) {
+		return denylist.Entry{}, err
+	}
+	if err != nil {
+		s.logger.Printf("saving the denylist: %v", err)
+	}
+	s.logger.Printf("Denylist: added %s %s%s", added.Kind, added.Value, by(actor))
+	return added, nil
+}
+
+// removeDenylistEntry removes entry id on behalf of actor. It fails only
+// for unknown entries.
+func (s *server) removeDenylistEntry(id, actor string) (denylist.Entry, error) {
+	e, err := s.denylist.Remove(id)
+	if errors.Is(err, denylist.ErrUnknownEntry) {
+		return denylist.Entry{}, err
+	}
+	if err != nil {
+		s.logger.Printf("saving the denylist: %v", err)
+	}
+	s.logger.Printf("Denylist: removed %s %s%s", e.Kind, e.Value, by(actor))
+	return e, nil
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/digest"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+)
+
+// maxDigestBytes bounds a file uploaded to the digest calculator.
+const maxDigestBytes = 64 << 20
+
+// DigestResponse is the body of a POST /api/v1/digest response.
+type DigestResponse struct {
+	// Source is "upload" or "image".
+	Source string `json:"source"`
+	// Name is the uploaded file name or the image reference.
+	Name string `json:"name,omitempty"`
+	Size int64  `json:"size"`
+	// Digests maps algorithm to hex digest, for sha256, sha512, sha3_256
+	// and sha3_512. For an image they are digests of its manifest.
+	Digests map[string]string `json:"digests"`
+	// Attested reports whether any stored attestation names one of the
+	// digests as a subject.
+	Attested     bool              `json:"attested"`
+	Attestations []attestationLink `json:"attestations"`
+}
+
+// attestationLink identifies a stored attestation about the digested
+// artifact.
+type attestationLink struct {
+	ID            string `json:"id"`
+	PredicateType string `json:"predicateType"`
+}
+
+// digestHandler serves POST /api/v1/digest. The body is either the file
+// to digest, raw or as the "file" field of a multipart form, or names an
+// image to digest by its manifest: an "image" form field or a JSON
+// {"image": "<ref>"} document. Uploads are limited to maxDigestBytes.
+func (s *server) digestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxDigestBytes)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var res *DigestResponse
+	var err error
+	switch mediaType {
+	case "multipart/form-data":
+		res, err = s.digestForm(r)
+	case "application/json":
+		var body struct {
+			Image string `json:"image"`
+		}
+		if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+			err = badRequest(err)
+			break
+		}
+		res, err = s.digestImage(r, body.Image)
+	default:
+		res, err = digestReader(r.Body, "")
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		var he *httpError
+		switch {
+		case errors.As(err, &tooLarge):
+			http.Error(w, fmt.Sprintf("upload exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		case errors.As(err, &he):
+			http.Error(w, he.Error(), he.status)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	s.linkAttestations(res)
+	writeJSON(w, http.StatusOK, res)
+}
+
+// httpError is an error with the status it should be reported with.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string { return e.err.Error() }
+func (e *httpError) Unwrap() error { return e.err }
+
+func badRequest(err error) error { return &httpError{http.StatusBadRequest, err} }
+
+func (s *server) digestForm(r *http.Request) (*DigestResponse, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, badRequest(errors.New(`the form has neither a "file" nor an "image" field`))
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch part.FormName() {
+		case "file":
+			return digestReader(part, part.FileName())
+		case "image":
+			ref, err := io.ReadAll(io.LimitReader(part, 4096))
+			if err != nil {
+				return nil, err
+			}
+			return s.digestImage(r, string(ref))
+		}
+	}
+}
+
+// digestReader digests everything read from rd.
+func digestReader(rd io.Reader, name string) (*DigestResponse, error) {
+	sums, n, err := digest.Compute(rd, digest.Common...)
+	if err != nil {
+		return nil, err
+	}
+	return &DigestResponse{Source: "upload", Name: name, Size: n, Digests: sums}, nil
+}
+
+// digestImage digests the manifest the image reference points at.
+func (s *server) digestImage(r *http.Request, image string) (*DigestResponse, error) {
+	if image == "" {
+		return nil, badRequest(errors.New("the image is empty"))
+	}
+	ref, err := oci.ParseReference(image)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	if s.registry == nil {
+		return nil, &httpError{http.StatusNotImplemented, errors.New("no registry is configured to resolve images")}
+	}
+	_, raw, _, err := s.registry.GetManifest(r.Context(), ref)
+	if err != nil {
+		return nil, &httpError{upstreamStatus(err), err}
+	}
+	sums, n, err := digest.Compute(bytes.NewReader(raw), digest.Common...)
+	if err != nil {
+		return nil, err
+	}
+	return &DigestResponse{Source: "image", Name: ref.String(), Size: n, Digests: sums}, nil
+}
+
+// linkAttestations fills in the stored attestations naming any of res's
+// digests as a subject.
+func (s *server) linkAttestations(res *DigestResponse) {
+	seen := map[string]bool{}
+	res.Attestations = []attestationLink{}
+	for alg, hex := range res.Digests {
+		for _, a := range s.store.List(store.Filter{Digest: alg + ":" + hex}) {
+			if seen[a.ID] {
+				continue
+			}
+			seen[a.ID] = true
+			res.Attestations = append(res.Attestations, attestationLink{ID: a.ID, PredicateType: a.PredicateType})
+		}
+	}
+	sort.Slice(res.Attestations, func(i, j int) bool { return res.Attestations[i].ID < res.Attestations[j].ID })
+	res.Attested = len(res.Attestations) > 0
+}
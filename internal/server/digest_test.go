@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/fake"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/httptestutil"
+)
+
+func postDigest(t *testing.T, h http.Handler, contentType string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/digest", bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return httptestutil.Do(h, req)
+}
+
+func TestDigestUpload(t *testing.T) {
+	st := store.New()
+	if _, err := SeedSampleData(st, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(Config{}, Deps{Store: st})
+	// The sample attestations' subjects are digests of the image names.
+	artifact := []byte(SampleImages[0])
+	sum256, sum512 := sha256.Sum256(artifact), sha512.Sum512(artifact)
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, _ := mw.CreateFormFile("file", "app.tar")
+	fw.Write(artifact)
+	mw.Close()
+
+	for name, rr := range map[string]*httptest.ResponseRecorder{
+		"raw":       postDigest(t, h, "application/octet-stream", artifact),
+		"multipart": postDigest(t, h, mw.FormDataContentType(), form.Bytes()),
+	} {
+		httptestutil.AssertStatus(t, rr, http.StatusOK)
+		var res DigestResponse
+		httptestutil.DecodeJSON(t, rr, &res)
+		if res.Source != "upload" || res.Size != int64(len(artifact)) ||
+			res.Digests["sha256"] != hex.EncodeToString(sum256[:]) || res.Digests["sha512"] != hex.EncodeToString(sum512[:]) || len(res.Digests["sha3_256"]) != 64 {
+			t.Errorf("%s: %+v", name, res)
+		}
+		if !res.Attested || len(res.Attestations) == 0 {
+			t.Errorf("%s: the sample image is not reported as attested: %+v", name, res)
+		}
+		if name == "multipart" && res.Name != "app.tar" {
+			t.Errorf("multipart: name %q, want the uploaded file name", res.Name)
+		}
+	}
+
+	rr := postDigest(t, h, "", []byte("unknown artifact"))
+	var res DigestResponse
+	httptestutil.DecodeJSON(t, rr, &res)
+	if res.Attested || res.Attestations == nil || len(res.Attestations) != 0 {
+		t.Errorf("unknown artifact: %+v", res)
+	}
+
+	rr = postDigest(t, h, "", bytes.Repeat([]byte("x"), maxDigestBytes+1))
+	httptestutil.AssertStatus(t, rr, http.StatusRequestEntityTooLarge)
+
+	rr = httptestutil.Get(h, "/api/v1/digest")
+	httptestutil.AssertStatus(t, rr, http.StatusMethodNotAllowed)
+	httptestutil.AssertHeader(t, rr, "Allow", "POST")
+}
+
+func TestDigestImage(t *testing.T) {
+	reg := fake.NewRegistry(t)
+	ref := reg.PushImage(t, "app:v1")
+	h := NewServer(Config{}, Deps{Registry: reg.Client()})
+
+	rr := postDigest(t, h, "application/json", []byte(`{"image":"`+ref.WithTag("v1").String()+`"}`))
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	var res DigestResponse
+	httptestutil.DecodeJSON(t, rr, &res)
+	if res.Source != "image" || "sha256:"+res.Digests["sha256"] != ref.Digest || len(res.Digests["sha512"]) != 128 {
+		t.Errorf("image digest: %+v, want the manifest digest %s", res, ref.Digest)
+	}
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	mw.WriteField("image", ref.String())
+	mw.Close()
+	rr = postDigest(t, h, mw.FormDataContentType(), form.Bytes())
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+
+	rr = postDigest(t, h, "application/json", []byte(`{"image":"`+reg.Host()+`/missing:v1"}`))
+	httptestutil.AssertStatus(t, rr, http.StatusBadGateway)
+	rr = postDigest(t, h, "application/json", []byte(`{"image":""}`))
+	httptestutil.AssertStatus(t, rr, http.StatusBadRequest)
+
+	rr = postDigest(t, NewServer(Config{}, Deps{}), "application/json", []byte(`{"image":"ghcr.io/org/app:v1"}`))
+	httptestutil.AssertStatus(t, rr, http.StatusNotImplemented)
+	if !strings.Contains(rr.Body.String(), "no registry") {
+		t.Errorf("501 body: %q", rr.Body.String())
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// failureHeader carries the failure code of an error response, so clients
+// can branch on the class of a failure without parsing the plain-text
+// body. JSON responses carry their codes in the body instead.
+const failureHeader = "X-Failure-Code"
+
+// failureCodes are the values of the code label of
+// verification_failures_total.
+func failureCodes() []string {
+	codes := make([]string, len(failure.Codes))
+	for i, c := range failure.Codes {
+		codes[i] = string(c)
+	}
+	return codes
+}
+
+// countFailure counts a failure of class code. Unclassified failures, with
+// an empty code, are not counted.
+func (s *server) countFailure(code failure.Code) {
+	s.stats.failures.Inc(string(code))
+}
+
+// countResult counts the failure of a result that did not verify.
+func (s *server) countResult(res *verify.Result) {
+	if !res.Verified {
+		s.countFailure(res.Code)
+	}
+}
+
+// codeSuffix formats code for the end of a log line, or returns "" when
+// there is none.
+func codeSuffix(code failure.Code) string {
+	if code == "" {
+		return ""
+	}
+	return " [" + string(code) + "]"
+}
+
+// httpFailure replies with err as plain text, as http.Error does, and its
+// failure code, if it has one, in the failure header.
+func httpFailure(w http.ResponseWriter, err error, status int) {
+	if code := failure.CodeOf(err); code != "" {
+		w.Header().Set(failureHeader, string(code))
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/fault"
+)
+
+// faultsHandler serves /api/v1/admin/faults: GET reports the injected
+// faults, PUT ({"rekorDelay": "2s", "registryFailureRate": 0.5,
+// "cacheCorruptionRate": 1}) replaces them and DELETE clears them. All need
+// the API token, and the server must have been started with fault
+// injection enabled.
+func (s *server) faultsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.faults == nil {
+		http.Error(w, "fault injection is disabled: start the server with --fault-injection", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodDelete:
+		var f fault.Faults
+		if r.Method == http.MethodPut {
+			dec := json.NewDecoder(io.LimitReader(r.Body, 64<<10))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&f); err != nil {
+				http.Error(w, "invalid faults: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := s.faults.Set(f); err != nil {
+			http.Error(w, "invalid faults: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if f.Active() {
+			s.logger.Printf("Fault injection: rekorDelay=%q registryFailureRate=%v cacheCorruptionRate=%v", f.RekorDelay, f.RegistryFailureRate, f.CacheCorruptionRate)
+		} else {
+			s.logger.Printf("Fault injection: faults cleared")
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.faults.Get())
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/fault"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/httptestutil"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+func TestFaultInjection(t *testing.T) {
+	verifyImage := func(_ context.Context, ref oci.Reference, _ verify.Options) (*verify.Result, error) {
+		return &verify.Result{Image: ref.String(), Digest: ref.Digest, Verified: true}, nil
+	}
+	disabled := NewServer(Config{APIToken: "s3cret"}, Deps{Verify: verifyImage})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/faults", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	httptestutil.AssertStatus(t, httptestutil.Do(disabled, req), http.StatusNotFound)
+
+	h := NewServer(Config{APIToken: "s3cret"}, Deps{Verify: verifyImage, Faults: fault.New(), Logger: log.New(io.Discard, "", 0)})
+	faults := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/admin/faults", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		return httptestutil.Do(h, req)
+	}
+	httptestutil.AssertStatus(t, faults(http.MethodPut, `{"registryFailureRate": 2}`), http.StatusBadRequest)
+	httptestutil.AssertStatus(t, faults(http.MethodPut, `{"rekorDelay": "soon"}`), http.StatusBadRequest)
+	httptestutil.AssertStatus(t, faults(http.MethodPut, `{"cacheCorruption": 1}`), http.StatusBadRequest)
+
+	rr := faults(http.MethodPut, `{"cacheCorruptionRate": 1}`)
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertContains(t, rr, `"cacheCorruptionRate":1`)
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/health"), `"status":"degraded"`, `"faults":{"cacheCorruptionRate":1}`)
+
+	// A corrupted cache entry fails its checksum, so the image is verified
+	// afresh rather than answered from the cache.
+	verifyURL := "/api/v1/verify?image=ghcr.io/org/app@sha256:" + strings.Repeat("a", 64)
+	for i := 0; i < 2; i++ {
+		rr := httptestutil.Get(h, verifyURL)
+		httptestutil.AssertStatus(t, rr, http.StatusOK)
+		httptestutil.AssertContains(t, rr, `"verified":true`, strings.Repeat("a", 64))
+	}
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/metrics"),
+		"tekton_slsa_demo_verifications_total 2\n", "tekton_slsa_demo_verify_cache_corrupt_total 1\n", "tekton_slsa_demo_verify_cache_hits_total 0\n")
+
+	httptestutil.AssertContains(t, faults(http.MethodDelete, ""), `{}`)
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/health"), `"status":"healthy"`)
+	httptestutil.Get(h, verifyURL)
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/metrics"), "tekton_slsa_demo_verify_cache_hits_total 1\n")
+}
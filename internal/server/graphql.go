@@ -0,0 +1,525 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/digest"
+	"github.com/waveywaves/tekton-slsa-demo/internal/graphql"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/sourcelink"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// maxGraphQLBytes bounds the body of a GraphQL request.
+const maxGraphQLBytes = 1 << 20
+
+// maxGraphQLDepth bounds how deeply GraphQL queries nest, which also
+// bounds how many verifications one query can fan out to.
+const maxGraphQLDepth = 8
+
+// maxGraphQLFields bounds how many fields a GraphQL query selects once its
+// fragments are expanded.
+const maxGraphQLFields = 1000
+
+// build is a provenance attestation as the GraphQL Build type sees it.
+type build struct {
+	att  *store.Attestation
+	prov *attestation.Provenance
+}
+
+// image is an attestation subject as the GraphQL Image type sees it.
+type image struct {
+	name    string
+	digests map[string]string
+}
+
+// ociDigestAlgorithms are the algorithms registries address manifests
+// by, in order of preference.
+var ociDigestAlgorithms = []string{"sha256", "sha512"}
+
+// ociDigest is the image's digest in an algorithm registries address
+// manifests by, or "" when it has none.
+func (img image) ociDigest() string {
+	for _, alg := range ociDigestAlgorithms {
+		for k, v := range img.digests {
+			if digest.Normalize(k) == alg {
+				return digest.Canonical(alg + ":" + v)
+			}
+		}
+	}
+	return ""
+}
+
+// digest is the image's registry digest, or its first digest in "alg:hex"
+// order when it has none.
+func (img image) digest() string {
+	if d := img.ociDigest(); d != "" {
+		return d
+	}
+	return sortedDigests(img.digests)[0]
+}
+
+func sortedDigests(digests map[string]string) []string {
+	list := make([]string, 0, len(digests))
+	for alg, v := range digests {
+		list = append(list, alg+":"+v)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// source is the GraphQL Source type: a build's source repository.
+type source struct {
+	URI    string `json:"uri"`
+	Commit string `json:"commit,omitempty"`
+	*sourcelink.Links
+}
+
+// asBuild decodes the provenance of a, or returns nil for other predicates.
+func asBuild(a *store.Attestation) *build {
+	if !attestation.IsProvenance(a.PredicateType) {
+		return nil
+	}
+	p, err := attestation.NormalizeProvenance(a.Statement())
+	if err != nil {
+		return nil
+	}
+	return &build{att: a, prov: p}
+}
+
+// usesDependency reports whether b resolved the dependency named by its
+// URI or an "alg:hex" digest.
+func (b *build) usesDependency(dep string) bool {
+	for _, d := range b.prov.BuildDefinition.ResolvedDependencies {
+		if d.URI == dep {
+			return true
+		}
+		for alg, v := range d.Digest {
+			if alg+":"+v == dep {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// searchArgs are the arguments the attestations, builds and images fields
+// share with /api/v1/attestations/search.
+var searchArgs = []graphql.Arg{
+	{Name: "predicateType", Type: "String"},
+	{Name: "builder", Type: "String", Description: "The provenance builder ID."},
+	{Name: "source", Type: "String", Description: "The source repository, with or without a git+ prefix, .git suffix or @revision."},
+	{Name: "commit", Type: "String", Description: "The source commit, or a prefix of at least 7 characters."},
+	{Name: "since", Type: "String", Description: "Built at or after this RFC 3339 timestamp or date."},
+	{Name: "until", Type: "String", Description: "Built at or before this RFC 3339 timestamp or date."},
+	{Name: "limit", Type: "Int", Description: fmt.Sprintf("At most this many results; %d by default, at most %d.", defaultSearchLimit, maxSearchLimit)},
+}
+
+// buildArgs are searchArgs without predicateType, plus dependency.
+var buildArgs = append(append([]graphql.Arg{}, searchArgs[1:]...),
+	graphql.Arg{Name: "dependency", Type: "String", Description: "A resolved dependency URI or \"alg:hex\" digest the build used."})
+
+// searchQuery turns search arguments into a store query.
+func searchQuery(args graphql.Args) (store.Query, error) {
+	q := store.Query{
+		PredicateType: args.String("predicateType"),
+		BuilderID:     args.String("builder"),
+		Source:        args.String("source"),
+		Commit:        args.String("commit"),
+		Limit:         defaultSearchLimit,
+	}
+	var err error
+	if q.Since, err = parseSearchTime(args.String("since"), false); err != nil {
+		return q, fmt.Errorf("since: %w", err)
+	}
+	if q.Until, err = parseSearchTime(args.String("until"), true); err != nil {
+		return q, fmt.Errorf("until: %w", err)
+	}
+	if n, ok := args.Int("limit"); ok {
+		if n < 1 || n > maxSearchLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxSearchLimit)
+		}
+		q.Limit = n
+	}
+	if c := q.Commit; c != "" && len(c) < store.MinCommitPrefix {
+		return q, fmt.Errorf("commit must have at least %d characters", store.MinCommitPrefix)
+	}
+	return q, nil
+}
+
+// builds returns the provenance matching args, most recently received
+// first.
+func (s *server) builds(args graphql.Args) ([]*build, error) {
+	q, err := searchQuery(args)
+	if err != nil {
+		return nil, err
+	}
+	limit := q.Limit
+	q.Limit = 0
+	dep := args.String("dependency")
+	var out []*build
+	for _, a := range s.store.Search(q) {
+		b := asBuild(a)
+		if b == nil || dep != "" && !b.usesDependency(dep) {
+			continue
+		}
+		out = append(out, b)
+		if len(out) == limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+// images returns the distinct subjects of the given attestations.
+func images(list []*store.Attestation, limit int) []image {
+	var out []image
+	seen := map[string]bool{}
+	for _, a := range list {
+		for _, sub := range a.Subjects {
+			if len(sub.Digest) == 0 {
+				continue
+			}
+			img := image{name: sub.Name, digests: sub.Digest}
+			if seen[img.digest()] {
+				continue
+			}
+			seen[img.digest()] = true
+			out = append(out, img)
+			if len(out) == limit {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+// verification verifies the image at ref, sharing the cache of
+// /api/v1/verify.
+func (s *server) verification(ctx context.Context, ref string, args graphql.Args) (*verify.Result, error) {
+	if s.verifyImage == nil {
+		return nil, errors.New("verification is not configured")
+	}
+	r, err := oci.ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	return s.cachedVerify(ctx, r, verify.Options{
+		Identity:    args.String("identity"),
+		Issuer:      args.String("issuer"),
+		RequireTlog: args.Bool("requireTlog"),
+	})
+}
+
+var verifyArgs = []graphql.Arg{
+	{Name: "identity", Type: "String", Description: "The signer identity certificates must carry."},
+	{Name: "issuer", Type: "String", Description: "The OIDC issuer certificates must carry."},
+	{Name: "requireTlog", Type: "Boolean", Description: "Require a transparency log entry for every signature."},
+}
+
+// newGraphQLSchema describes the store as a graph of attestations, the
+// builds their provenance records, the images they were made for and the
+// dependencies builds used, with image verification on demand.
+func (s *server) newGraphQLSchema() *graphql.Schema {
+	query := &graphql.Object{Name: "Query", Fields: []*graphql.Field{
+		{Name: "attestation", Type: "Attestation", Description: "An attestation by ID.",
+			Args: []graphql.Arg{{Name: "id", Type: "ID!"}},
+			Resolve: func(_ context.Context, _ any, args graphql.Args) (any, error) {
+				a, err := s.store.Get(args.String("id"))
+				if errors.Is(err, store.ErrNotFound) {
+					return nil, nil
+				}
+				return a, err
+			}},
+		{Name: "attestations", Type: "[Attestation!]!", Description: "Stored attestations, most recently received first.",
+			Args: append([]graphql.Arg{{Name: "digest", Type: "String", Description: "A subject digest in \"alg:hex\" form."}}, searchArgs...),
+			Resolve: func(_ context.Context, _ any, args graphql.Args) (any, error) {
+				q, err := searchQuery(args)
+				if err != nil {
+					return nil, err
+				}
+				q.Digest = args.String("digest")
+				return s.store.Search(q), nil
+			}},
+		{Name: "builds", Type: "[Build!]!", Description: "Builds recorded in provenance, most recently received first.",
+			Args: buildArgs,
+			Resolve: func(_ context.Context, _ any, args graphql.Args) (any, error) {
+				return s.builds(args)
+			}},
+		{Name: "images", Type: "[Image!]!", Description: "Images built as provenance records, such as every image built from a commit.",
+			Args: buildArgs,
+			Resolve: func(_ context.Context, _ any, args graphql.Args) (any, error) {
+				q, err := searchQuery(args)
+				if err != nil {
+					return nil, err
+				}
+				// Limit the images rather than the builds they come from.
+				args["limit"] = maxSearchLimit
+				bs, err := s.builds(args)
+				if err != nil {
+					return nil, err
+				}
+				list := make([]*store.Attestation, len(bs))
+				for i, b := range bs {
+					list[i] = b.att
+				}
+				return images(list, q.Limit), nil
+			}},
+		{Name: "image", Type: "Image", Description: "The image with an attested digest.",
+			Args: []graphql.Arg{{Name: "digest", Type: "String!", Description: "The digest in \"alg:hex\" form."}},
+			Resolve: func(_ context.Context, _ any, args graphql.Args) (any, error) {
+				d := args.String("digest")
+				for _, img := range images(s.store.List(store.Filter{Digest: d}), 0) {
+					for _, v := range sortedDigests(img.digests) {
+						if v == d {
+							return img, nil
+						}
+					}
+				}
+				return nil, nil
+			}},
+		{Name: "verification", Type: "Verification", Description: "Verifies an image's signatures and attestations.",
+			Args: append([]graphql.Arg{{Name: "image", Type: "String!", Description: "An image reference, by tag or digest."}}, verifyArgs...),
+			Resolve: func(ctx context.Context, _ any, args graphql.Args) (any, error) {
+				return s.verification(ctx, args.String("image"), args)
+			}},
+	}}
+
+	attestationType := &graphql.Object{Name: "Attestation", Description: "A stored DSSE envelope and the in-toto statement it signs.", Fields: []*graphql.Field{
+		{Name: "id", Type: "ID!"},
+		{Name: "predicateType", Type: "String!"},
+		{Name: "receivedAt", Type: "Time!"},
+		{Name: "keyIds", Type: "[String!]!"},
+		{Name: "subjects", Type: "[Image!]!", Description: "The images the statement is about.",
+			Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+				return images([]*store.Attestation{src.(*store.Attestation)}, 0), nil
+			}},
+		{Name: "build", Type: "Build", Description: "The build, for provenance attestations.",
+			Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+				return asBuild(src.(*store.Attestation)), nil
+			}},
+		{Name: "transparencyURI", Type: "String", Description: "The transparency log entry recorded at ingest.",
+			Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+				if uri := s.store.TransparencyURI(src.(*store.Attestation).ID); uri != "" {
+					return uri, nil
+				}
+				return nil, nil
+			}},
+	}}
+
+	buildType := &graphql.Object{Name: "Build", Description: "A build as its SLSA provenance records it.", Fields: []*graphql.Field{
+		{Name: "attestation", Type: "Attestation!", Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+			return src.(*build).att, nil
+		}},
+		{Name: "buildType", Type: "String!", Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+			return src.(*build).prov.BuildDefinition.BuildType, nil
+		}},
+		{Name: "builder", Type: "String!", Description: "The builder ID.", Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+			return src.(*build).prov.RunDetails.Builder.ID, nil
+		}},
+		{Name: "invocationId", Type: "String", Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+			if md := src.(*build).prov.RunDetails.Metadata; md != nil && md.InvocationID != "" {
+				return md.InvocationID, nil
+			}
+			return nil, nil
+		}},
+		{Name: "startedOn", Type: "Time", Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+			if md := src.(*build).prov.RunDetails.Metadata; md != nil {
+				return md.StartedOn, nil
+			}
+			return nil, nil
+		}},
+		{Name: "finishedOn", Type: "Time", Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+			if md := src.(*build).prov.RunDetails.Metadata; md != nil {
+				return md.FinishedOn, nil
+			}
+			return nil, nil
+		}},
+		{Name: "source", Type: "Source", Description: "The source repository and commit built.", Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+			b := src.(*build)
+			dep, ok := b.prov.Source()
+			if !ok {
+				return nil, nil
+			}
+			links, _ := sourcelink.FromProvenance(b.prov)
+			return &source{URI: dep.URI, Commit: sourcelink.Commit(dep.Digest), Links: links}, nil
+		}},
+		{Name: "dependencies", Type: "[Dependency!]!", Description: "The resolved dependencies, starting with the source.", Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+			return src.(*build).prov.BuildDefinition.ResolvedDependencies, nil
+		}},
+		{Name: "images", Type: "[Image!]!", Description: "The images the build produced.", Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+			return images([]*store.Attestation{src.(*build).att}, 0), nil
+		}},
+	}}
+
+	sourceType := &graphql.Object{Name: "Source", Description: "A source repository at the commit a build used, with links into GitHub or GitLab.", Fields: []*graphql.Field{
+		{Name: "uri", Type: "String!"},
+		{Name: "commit", Type: "String"},
+		{Name: "forge", Type: "String", Description: "\"github\" or \"gitlab\" when the repository is on one."},
+		{Name: "repository", Type: "String"},
+		{Name: "commitURL", Type: "String", Resolve: linkField(func(l *sourcelink.Links) string { return l.Commit })},
+		{Name: "treeURL", Type: "String", Resolve: linkField(func(l *sourcelink.Links) string { return l.Tree })},
+		{Name: "pipelineURL", Type: "String", Resolve: linkField(func(l *sourcelink.Links) string { return l.Pipeline })},
+	}}
+
+	dependencyType := &graphql.Object{Name: "Dependency", Description: "An artifact a build resolved, such as its source or a base image.", Fields: []*graphql.Field{
+		{Name: "uri", Type: "String"},
+		{Name: "name", Type: "String"},
+		{Name: "digests", Type: "[String!]!", Description: "The digests in \"alg:hex\" form.", Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+			return sortedDigests(src.(attestation.ResourceDescriptor).Digest), nil
+		}},
+		{Name: "builds", Type: "[Build!]!", Description: "The builds that used this dependency.",
+			Args: []graphql.Arg{{Name: "limit", Type: "Int"}},
+			Resolve: func(_ context.Context, src any, args graphql.Args) (any, error) {
+				dep := src.(attestation.ResourceDescriptor)
+				key := dep.URI
+				if key == "" {
+					if ds := sortedDigests(dep.Digest); len(ds) > 0 {
+						key = ds[0]
+					}
+				}
+				if key == "" {
+					return nil, nil
+				}
+				args["dependency"] = key
+				return s.builds(args)
+			}},
+	}}
+
+	imageType := &graphql.Object{Name: "Image", Description: "An artifact attestations are about, identified by digest.", Fields: []*graphql.Field{
+		{Name: "name", Type: "String!", Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+			return src.(image).name, nil
+		}},
+		{Name: "digest", Type: "String!", Description: "The digest registries address the image by (sha256, else sha512) in \"alg:hex\" form, when there is one.", Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+			return src.(image).digest(), nil
+		}},
+		{Name: "digests", Type: "[String!]!", Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+			return sortedDigests(src.(image).digests), nil
+		}},
+		{Name: "attestations", Type: "[Attestation!]!", Args: []graphql.Arg{{Name: "predicateType", Type: "String"}},
+			Resolve: func(_ context.Context, src any, args graphql.Args) (any, error) {
+				return s.store.List(store.Filter{Digest: src.(image).digest(), PredicateType: args.String("predicateType")}), nil
+			}},
+		{Name: "builds", Type: "[Build!]!", Description: "The builds whose provenance names the image.", Resolve: func(_ context.Context, src any, _ graphql.Args) (any, error) {
+			var out []*build
+			for _, a := range s.store.List(store.Filter{Digest: src.(image).digest()}) {
+				if b := asBuild(a); b != nil {
+					out = append(out, b)
+				}
+			}
+			return out, nil
+		}},
+		{Name: "verification", Type: "Verification", Description: "Verifies the image's signatures and attestations.", Args: verifyArgs,
+			Resolve: func(ctx context.Context, src any, args graphql.Args) (any, error) {
+				img := src.(image)
+				d := img.ociDigest()
+				if d == "" {
+					return nil, errors.New("only images with a sha256 or sha512 digest can be verified")
+				}
+				return s.verification(ctx, img.name+"@"+d, args)
+			}},
+	}}
+
+	verificationType := &graphql.Object{Name: "Verification", Description: "The outcome of verifying an image, as /api/v1/verify reports it.", Fields: []*graphql.Field{
+		{Name: "image", Type: "String!"},
+		{Name: "digest", Type: "String!"},
+		{Name: "verified", Type: "Boolean!", Description: "Whether at least one signature or attestation verified."},
+		{Name: "code", Type: "String", Description: "Why the image did not verify, such as SIGNATURE_MISMATCH or POLICY_DENIED."},
+		{Name: "checks", Type: "[Check!]!"},
+	}}
+
+	checkType := &graphql.Object{Name: "Check", Description: "The outcome of verifying one signature or attestation.", Fields: []*graphql.Field{
+		{Name: "kind", Type: "String!", Description: "\"signature\" or \"attestation\"."},
+		{Name: "predicateType", Type: "String"},
+		{Name: "signer", Type: "String"},
+		{Name: "issuer", Type: "String"},
+		{Name: "logIndex", Type: "Float", Description: "The Rekor log index, which can exceed the range of Int."},
+		{Name: "signedAt", Type: "Time"},
+		{Name: "verified", Type: "Boolean!"},
+		{Name: "error", Type: "String"},
+		{Name: "code", Type: "String", Description: "The failure code classifying error."},
+	}}
+
+	schema, err := graphql.NewSchema(graphql.Definition{
+		Query:     query,
+		Types:     []*graphql.Object{attestationType, buildType, sourceType, dependencyType, imageType, verificationType, checkType},
+		Scalars:   []graphql.Scalar{{Name: "Time", Description: "An RFC 3339 timestamp."}},
+		MaxDepth:  maxGraphQLDepth,
+		MaxFields: maxGraphQLFields,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// linkField resolves a Source field from its forge links, which are nil
+// for repositories elsewhere.
+func linkField(get func(*sourcelink.Links) string) func(context.Context, any, graphql.Args) (any, error) {
+	return func(_ context.Context, src any, _ graphql.Args) (any, error) {
+		if l := src.(*source).Links; l != nil && get(l) != "" {
+			return get(l), nil
+		}
+		return nil, nil
+	}
+}
+
+// graphqlHandler serves /graphql: queries are POSTed as JSON, or as
+// application/graphql text, or given in the query, variables and
+// operationName parameters of a GET.
+func (s *server) graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				graphqlError(w, "variables: "+err.Error())
+				return
+			}
+		}
+	case http.MethodPost:
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGraphQLBytes))
+		if err != nil {
+			graphqlError(w, err.Error())
+			return
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+			req.Query = string(body)
+		} else if err := json.Unmarshal(body, &req); err != nil {
+			graphqlError(w, "decoding request: "+err.Error())
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		graphqlError(w, "the query is required; the schema is served at /graphql/schema")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.graphql.Execute(r.Context(), req))
+}
+
+// graphqlError rejects a request that carries no executable query.
+func graphqlError(w http.ResponseWriter, msg string) {
+	writeJSON(w, http.StatusBadRequest, &graphql.Response{Errors: []*graphql.Error{{Message: msg}}})
+}
+
+// graphqlSchemaHandler serves the schema in the GraphQL schema definition
+// language.
+func (s *server) graphqlSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, s.graphql.SDL())
+}
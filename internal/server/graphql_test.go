@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/graphql"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/httptestutil"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// graphqlResponse is a GraphQL response whose data decodes into D.
+type graphqlResponse[D any] struct {
+	Data   *D              `json:"data"`
+	Errors []graphql.Error `json:"errors"`
+}
+
+func postGraphQL[D any](t *testing.T, h http.Handler, query string, variables map[string]any) graphqlResponse[D] {
+	t.Helper()
+	body, _ := json.Marshal(graphql.Request{Query: query, Variables: variables})
+	rr := httptestutil.Do(h, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	var res graphqlResponse[D]
+	httptestutil.DecodeJSON(t, rr, &res)
+	return res
+}
+
+func TestGraphQL(t *testing.T) {
+	st := store.New()
+	if _, err := SeedSampleData(st, time.Date(2024, 3, 12, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	var verified []string
+	h := NewServer(Config{}, Deps{
+		Store: st,
+		Verify: func(_ context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+			verified = append(verified, ref.String())
+			return &verify.Result{
+				Image:    ref.String(),
+				Digest:   ref.Digest,
+				Checks:   []verify.Check{{Kind: verify.KindSignature, Signer: opts.Identity, Verified: true}},
+				Verified: true,
+			}, nil
+		},
+	})
+	sum := sha256.Sum256([]byte(SampleImages[0]))
+	commit := hex.EncodeToString(sum[:20])
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	// All images whose provenance references a commit, in one request.
+	type imagesData struct {
+		Images []struct {
+			Name   string
+			Digest string
+			Builds []struct {
+				Builder      string
+				InvocationID string
+				Source       struct{ Commit, CommitURL string }
+			}
+			Attestations []struct{ PredicateType string }
+			Verification struct {
+				Verified bool
+				Checks   []struct{ Signer string }
+			}
+		}
+	}
+	res := postGraphQL[imagesData](t, h, `query ImagesAt($commit: String!) {
+		images(commit: $commit) {
+			name digest
+			builds { builder invocationId source { commit commitURL } }
+			attestations { predicateType }
+			verification(identity: "release@example.com") { verified checks { signer } }
+		}
+	}`, map[string]any{"commit": commit[:12]})
+	if len(res.Errors) > 0 {
+		t.Fatalf("errors: %+v", res.Errors)
+	}
+	if len(res.Data.Images) != 1 {
+		t.Fatalf("images at %s: %+v", commit[:12], res.Data.Images)
+	}
+	img := res.Data.Images[0]
+	if img.Name != SampleImages[0] || img.Digest != digest || len(img.Attestations) != 2 || len(img.Builds) != 1 {
+		t.Errorf("image = %+v", img)
+	}
+	if b := img.Builds[0]; b.Builder != "https://tekton.dev/chains/v2" || b.InvocationID != "slsa-demo-run-1" ||
+		b.Source.Commit != commit || b.Source.CommitURL != "https://github.com/waveywaves/tekton-slsa-demo/commit/"+commit {
+		t.Errorf("build = %+v", b)
+	}
+	if !img.Verification.Verified || img.Verification.Checks[0].Signer != "release@example.com" {
+		t.Errorf("verification = %+v", img.Verification)
+	}
+	if len(verified) != 1 || verified[0] != SampleImages[0]+"@"+digest {
+		t.Errorf("verified %v, want the image by digest", verified)
+	}
+
+	// Builds and the other builds sharing their dependencies, over GET.
+	q := url.Values{
+		"query":     {`query ($n: Int) { builds(limit: $n) { dependencies { uri digests builds { invocationId } } } }`},
+		"variables": {`{"n": 2}`},
+	}
+	rr := httptestutil.Get(h, "/graphql?"+q.Encode())
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	var builds graphqlResponse[struct {
+		Builds []struct {
+			Dependencies []struct {
+				URI     string
+				Digests []string
+				Builds  []struct{ InvocationID string }
+			}
+		}
+	}]
+	httptestutil.DecodeJSON(t, rr, &builds)
+	if len(builds.Errors) > 0 || len(builds.Data.Builds) != 2 {
+		t.Fatalf("builds: %+v", builds)
+	}
+	if deps := builds.Data.Builds[0].Dependencies; len(deps) != 1 || len(deps[0].Builds) != len(SampleImages) || !strings.HasPrefix(deps[0].Digests[0], "sha1:") {
+		t.Errorf("dependencies = %+v", deps)
+	}
+
+	// Resolver errors are reported with their path.
+	type attestationsData struct {
+		Attestations []struct{ ID string }
+	}
+	bad := postGraphQL[attestationsData](t, h, `{ attestations(commit: "abc") { id } }`, nil)
+	if bad.Data != nil || len(bad.Errors) != 1 || !strings.Contains(bad.Errors[0].Message, "at least 7 characters") || bad.Errors[0].Path[0] != "attestations" {
+		t.Errorf("short commit: %+v", bad)
+	}
+	invalid := postGraphQL[attestationsData](t, h, `{ attestations { signature } }`, nil)
+	if invalid.Data != nil || len(invalid.Errors) != 1 {
+		t.Errorf("unknown field: %+v", invalid)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{ attestations(digest: "`+digest+`", predicateType: "https://spdx.dev/Document") { id } }`))
+	req.Header.Set("Content-Type", "application/graphql")
+	var byDigest graphqlResponse[attestationsData]
+	httptestutil.DecodeJSON(t, httptestutil.Do(h, req), &byDigest)
+	if len(byDigest.Errors) > 0 || len(byDigest.Data.Attestations) != 1 {
+		t.Errorf("SBOM by digest: %+v", byDigest)
+	}
+
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/graphql"), http.StatusBadRequest)
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/graphql?query={}&variables=nope"), http.StatusBadRequest)
+	httptestutil.AssertStatus(t, httptestutil.Do(h, httptest.NewRequest(http.MethodPut, "/graphql", nil)), http.StatusMethodNotAllowed)
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/graphql/schema"), "type Image {", "scalar Time")
+}
+
+func TestGraphQLVerificationNotConfigured(t *testing.T) {
+	h := NewServer(Config{}, Deps{})
+	res := postGraphQL[struct{ Verification *struct{ Verified bool } }](t, h,
+		`{ verification(image: "ghcr.io/org/app:v1") { verified } }`, nil)
+	if res.Data == nil || res.Data.Verification != nil || len(res.Errors) != 1 || res.Errors[0].Message != "verification is not configured" {
+		t.Errorf("response = %+v", res)
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/env"
+	"github.com/waveywaves/tekton-slsa-demo/internal/fault"
+	"github.com/waveywaves/tekton-slsa-demo/internal/sbom"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+)
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Version   string    `json:"version"`
+	Component string    `json:"component"`
+	// Faults are the faults injected on purpose, while the status is
+	// "degraded".
+	Faults *fault.Faults `json:"faults,omitempty"`
+}
+
+type InfoResponse struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	BuildTime   string `json:"build_time"`
+	GoVersion   string `json:"go_version"`
+}
+
+// FingerprintResponse identifies the configuration a replica runs with.
+type FingerprintResponse struct {
+	Fingerprint string `json:"fingerprint"`
+	Version     string `json:"version"`
+}
+
+// indexPage is the data rendered by the index template.
+type indexPage struct {
+	Version      string
+	Dev          bool
+	Maintenance  maintenanceState
+	Attestations []*store.Attestation
+}
+
+func (s *server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	response := HealthResponse{
+		Status:    "healthy",
+		Timestamp: s.clock.Now(),
+		Version:   s.getenv("APP_VERSION", "1.0.0"),
+		Component: "tekton-slsa-demo",
+	}
+	// Injected faults degrade the server without taking it down, so the
+	// liveness probe still passes.
+	if f := s.faults.Get(); f.Active() {
+		response.Status = "degraded"
+		response.Faults = &f
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *server) infoHandler(w http.ResponseWriter, r *http.Request) {
+	response := InfoResponse{
+		Name:        "Tekton SLSA Demo Application",
+		Version:     s.getenv("APP_VERSION", "1.0.0"),
+		Description: "A sample application demonstrating SLSA compliance with Tekton Chains",
+		BuildTime:   s.getenv("BUILD_TIME", s.clock.Now().Format(time.RFC3339)),
+		GoVersion:   s.getenv("GO_VERSION", "unknown"),
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// fingerprintHandler serves the fingerprint of the effective
+// configuration, for comparing replicas.
+func (s *server) fingerprintHandler(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.Fingerprint == "" {
+		http.Error(w, "no configuration fingerprint", http.StatusNotImplemented)
+		return
+	}
+	writeJSON(w, http.StatusOK, FingerprintResponse{
+		Fingerprint: s.cfg.Fingerprint,
+		Version:     s.getenv("APP_VERSION", "1.0.0"),
+	})
+}
+
+func (s *server) rootHandler(w http.ResponseWriter, r *http.Request) {
+	recent := s.store.List(store.Filter{})
+	if len(recent) > 10 {
+		recent = recent[:10]
+	}
+	s.web.render(w, r, "index.html", indexPage{
+		Version:      s.getenv("APP_VERSION", "1.0.0"),
+		Dev:          s.cfg.Dev,
+		Maintenance:  s.maintenance.get(),
+		Attestations: recent,
+	})
+}
+
+// sbomHandler serves an SBOM of the running binary built from its embedded
+// Go build info. The format query parameter selects spdx (default) or
+// cyclonedx.
+func (s *server) sbomHandler(w http.ResponseWriter, r *http.Request) {
+	format, err := sbom.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		http.Error(w, "build info unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	doc := sbom.FromBuildInfo("tekton-slsa-demo", info)
+	doc.Tool = "tekton-slsa-demo-" + s.getenv("APP_VERSION", "1.0.0")
+	doc.Created = s.clock.Now().UTC()
+
+	contentType := "application/spdx+json"
+	if format == sbom.FormatCycloneDX {
+		contentType = "application/vnd.cyclonedx+json"
+	}
+	// The document is streamed as it is encoded; once the first chunk is
+	// out the status can no longer change, so a failure is only logged.
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if err := doc.EncodeTo(w, format); err != nil {
+		s.logger.Printf("streaming SBOM: %v", err)
+	}
+}
+
+func (s *server) getenv(key, defaultValue string) string {
+	return env.GetOrDefault(s.env, key, defaultValue)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maintenance is whether the server is in maintenance mode, in which it
+// reports not ready and pauses its background verification, e.g. while
+// keys rotate or Sigstore is down.
+type maintenance struct {
+	mu    sync.Mutex
+	state maintenanceState
+	// resumed is closed while the server is not in maintenance.
+	resumed chan struct{}
+}
+
+// maintenanceState is the body of /api/v1/admin/maintenance.
+type maintenanceState struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+func newMaintenance() *maintenance {
+	m := &maintenance{resumed: make(chan struct{})}
+	close(m.resumed)
+	return m
+}
+
+// get returns the current state.
+func (m *maintenance) get() maintenanceState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// active reports whether the server is in maintenance.
+func (m *maintenance) active() bool {
+	return m.get().Enabled
+}
+
+// set enters or leaves maintenance, reporting whether that changed it.
+func (m *maintenance) set(enabled bool, reason string, now time.Time) (maintenanceState, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := enabled != m.state.Enabled
+	switch {
+	case enabled && changed:
+		m.resumed = make(chan struct{})
+		m.state = maintenanceState{Enabled: true, Reason: reason, Since: &now}
+	case enabled:
+		m.state.Reason = reason
+	case changed:
+		close(m.resumed)
+		m.state = maintenanceState{}
+	}
+	return m.state, changed
+}
+
+// wait returns a channel that is closed once the server is not in
+// maintenance.
+func (m *maintenance) wait() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.resumed
+}
+
+// readyHandler serves /ready for readiness probes: 503 while the server is
+// in maintenance, so it is taken out of load balancing while still passing
+// the /health liveness probe.
+func (s *server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if m := s.maintenance.get(); m.Enabled {
+		w.Header().Set("Retry-After", "60")
+		writeJSON(w, http.StatusServiceUnavailable, m)
+		return
+	}
+	writeJSON(w, http.StatusOK, maintenanceState{})
+}
+
+// setMaintenance enters or leaves maintenance on behalf of actor, the
+// signed-in administrator or "" for the API token, logging any change.
+func (s *server) setMaintenance(enabled bool, reason, actor string) maintenanceState {
+	state, changed := s.maintenance.set(enabled, reason, s.clock.Now())
+	switch {
+	case changed && state.Enabled:
+		s.logger.Printf("Maintenance mode on%s: %s; background verification paused", by(actor), state.Reason)
+	case changed:
+		s.logger.Printf("Maintenance mode off%s; background verification resumed", by(actor))
+	}
+	return state
+}
+
+// by names the administrator who took an action, for logs.
+func by(actor string) string {
+	if actor == "" {
+		return ""
+	}
+	return " by " + actor
+}
+
+// maintenanceHandler serves /api/v1/admin/maintenance: GET reports whether
+// the server is in maintenance and PUT ({"enabled": true, "reason": ...})
+// enters or leaves it. Both need the API token.
+func (s *server) maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.maintenance.get())
+	case http.MethodPut:
+		var req maintenanceState
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+			http.Error(w, "invalid maintenance state: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.setMaintenance(req.Enabled, req.Reason, ""))
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/replay"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// checkReplay records the logged provenance in res as a build of its
+// repository, logging and counting provenance that is stale, superseded
+// or replayed.
+func (s *server) checkReplay(res *verify.Result) *replay.Report {
+	r, err := s.replay.Check(res)
+	if err != nil {
+		s.logger.Printf("saving replay state: %v", err)
+	}
+	if alert := r.Alert(); alert != "" {
+		s.logger.Print(alert)
+		s.stats.replayFindings.Inc()
+		s.countFailure(failure.StaleProvenance)
+	}
+	return r
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/reproducibility"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+)
+
+// reproducibilityRequest is the body of a POST /api/v1/reproducibility
+// request: the digest of a rebuilt artifact, and the provenance it
+// reproduces, named by attestation ID or by the digest of its subject.
+type reproducibilityRequest struct {
+	AttestationID string `json:"attestationId"`
+	Digest        string `json:"digest"`
+	RebuiltDigest string `json:"rebuiltDigest"`
+	Rebuilder     string `json:"rebuilder"`
+}
+
+// reproducibilityHandler serves /api/v1/reproducibility. POST compares the
+// digest of an independently rebuilt artifact with the subject of its
+// provenance, records whether the build is reproducible and returns the
+// comparison; it needs the API token. GET reports the comparisons, newest
+// first, and the reproducibility rate overall and day by day; the digest
+// parameter selects one subject.
+func (s *server) reproducibilityHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.reproducibility.Report(r.URL.Query().Get("digest")))
+	case http.MethodPost:
+		s.requireToken(s.compareRebuild)(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *server) compareRebuild(w http.ResponseWriter, r *http.Request) {
+	var req reproducibilityRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.RebuiltDigest == "" || (req.AttestationID == "") == (req.Digest == "") {
+		http.Error(w, "invalid request: rebuiltDigest and one of attestationId or digest are required", http.StatusBadRequest)
+		return
+	}
+	a, err := s.provenanceFor(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	c, err := reproducibility.Compare(a.Statement(), req.Digest, req.RebuiltDigest)
+	if errors.Is(err, reproducibility.ErrNoSubject) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.AttestationID, c.Rebuilder, c.ComparedAt = a.ID, req.Rebuilder, s.clock.Now().UTC()
+	s.reproducibility.Record(c)
+	s.stats.rebuilds.Inc()
+	if c.Reproducible {
+		s.stats.reproducibleRebuilds.Inc()
+		s.logger.Printf("Reproducibility: %s rebuilt bit for bit as %s", c.Subject, c.RebuiltDigest)
+	} else {
+		s.logger.Printf("Reproducibility: %s rebuilt as %s, not %s", c.Subject, c.RebuiltDigest, c.Digest)
+	}
+	writeJSON(w, http.StatusCreated, c)
+}
+
+// provenanceFor finds the provenance a rebuild reproduces: the attestation
+// named, or the newest provenance about the digest.
+func (s *server) provenanceFor(req reproducibilityRequest) (*store.Attestation, error) {
+	if req.AttestationID != "" {
+		a, err := s.store.Get(req.AttestationID)
+		if err != nil {
+			return nil, err
+		}
+		if !attestation.IsProvenance(a.PredicateType) {
+			return nil, fmt.Errorf("attestation %s is %s, not provenance", a.ID, attestation.PredicateName(a.PredicateType))
+		}
+		return a, nil
+	}
+	for _, a := range s.store.List(store.Filter{Digest: req.Digest}) {
+		if attestation.IsProvenance(a.PredicateType) {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("no provenance about %s", req.Digest)
+}
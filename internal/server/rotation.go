@@ -0,0 +1,118 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/rotation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+)
+
+// rotationList is the response of GET /api/v1/admin/rotations.
+type rotationList struct {
+	Count  int              `json:"count"`
+	Events []rotation.Event `json:"events"`
+}
+
+// signerIdentities returns who signed a: the certificate identity of each
+// keyless signature and the key ID of the others. Unsigned envelopes, and
+// signatures with neither a certificate nor a key ID, have no identity.
+func signerIdentities(a *store.Attestation) []rotation.Identity {
+	var ids []rotation.Identity
+	seen := map[rotation.Identity]bool{}
+	for _, sig := range a.Envelope.Signatures {
+		var id rotation.Identity
+		switch {
+		case sig.Cert != "":
+			chain, err := signing.ParseCertificates([]byte(sig.Cert))
+			if err != nil {
+				continue
+			}
+			id.Signer, id.Issuer = signing.CertificateIdentity(chain[0])
+		case sig.KeyID != "":
+			id.KeyID = sig.KeyID
+		default:
+			continue
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// watchRotation compares the signers of a newly stored attestation with
+// those approved for each of its subjects, logging and returning the
+// events raised for identities not seen before.
+func (s *server) watchRotation(a *store.Attestation) []rotation.Event {
+	ids := signerIdentities(a)
+	if len(ids) == 0 {
+		return nil
+	}
+	var events []rotation.Event
+	seen := map[string]bool{}
+	for _, subject := range a.Subjects {
+		if subject.Name == "" || seen[subject.Name] {
+			continue
+		}
+		seen[subject.Name] = true
+		for _, id := range ids {
+			e := s.rotations.Observe(subject.Name, id, a.ID, s.clock.Now())
+			if e == nil {
+				continue
+			}
+			s.logger.Printf("Signing identity rotation: %s (approve with POST /api/v1/admin/rotations/%s/approve)", e, e.ID)
+			s.stats.rotations.Inc()
+			events = append(events, *e)
+		}
+	}
+	return events
+}
+
+// rotationsHandler serves the signing identity rotation events: GET
+// /api/v1/admin/rotations lists them, only those awaiting approval with
+// pending=true, and POST /api/v1/admin/rotations/{id}/approve accepts an
+// event's identity for its subject. Both need the API token.
+func (s *server) rotationsHandler(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/rotations"), "/")
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		events := s.rotations.Events(r.URL.Query().Get("pending") == "true")
+		writeJSON(w, http.StatusOK, rotationList{Count: len(events), Events: events})
+		return
+	}
+	id, ok := strings.CutSuffix(rest, "/approve")
+	if !ok || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	e, err := s.approveRotation(id, "")
+	if errors.Is(err, rotation.ErrUnknownEvent) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+// approveRotation accepts the identity of event id for its subject on
+// behalf of actor, the signed-in administrator or "" for the API token.
+func (s *server) approveRotation(id, actor string) (rotation.Event, error) {
+	e, err := s.rotations.Approve(id, s.clock.Now())
+	if err != nil {
+		return e, err
+	}
+	s.logger.Printf("Signing identity approved for %s%s: %s", e.Subject, by(actor), e.Identity)
+	return e, nil
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+)
+
+// SampleImages are the fictional images development mode seeds the store
+// with.
+var SampleImages = []string{
+	"ghcr.io/example/frontend",
+	"ghcr.io/example/api",
+	"ghcr.io/example/worker",
+}
+
+// sampleDigest is the digest the sample attestations give image.
+func sampleDigest(image string) string {
+	sum := sha256.Sum256([]byte(image))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// SeedSampleData adds signed provenance and SBOM attestations for the
+// sample images, signed with a throwaway key, as if built in the hours
+// before now.
+func SeedSampleData(st *store.Store, now time.Time) (int, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return 0, err
+	}
+	signer, err := signing.NewSigner(key)
+	if err != nil {
+		return 0, err
+	}
+	now = now.UTC()
+	added := 0
+	for i, image := range SampleImages {
+		sum := sha256.Sum256([]byte(image))
+		subject := attestation.Subject{Name: image, Digest: map[string]string{"sha256": hex.EncodeToString(sum[:])}}
+		started := now.Add(-time.Duration(i+1) * time.Hour)
+		finished := started.Add(3 * time.Minute)
+		commit := hex.EncodeToString(sum[:20])
+		pipelineRef := map[string]any{"resolver": "git", "params": []any{
+			map[string]any{"name": "url", "value": "https://github.com/waveywaves/tekton-slsa-demo"},
+			map[string]any{"name": "revision", "value": commit},
+			map[string]any{"name": "pathInRepo", "value": "k8s/slsa-demo-pipeline.yaml"},
+		}}
+		prov := attestation.Provenance{
+			BuildDefinition: attestation.BuildDefinition{
+				BuildType:          "https://tekton.dev/chains/v2/slsa",
+				ExternalParameters: map[string]any{"runSpec": map[string]any{"pipelineRef": pipelineRef}},
+				ResolvedDependencies: []attestation.ResourceDescriptor{{
+					URI:    "git+https://github.com/waveywaves/tekton-slsa-demo",
+					Digest: map[string]string{"sha1": commit},
+				}},
+			},
+			RunDetails: attestation.RunDetails{
+				Builder:  attestation.Builder{ID: "https://tekton.dev/chains/v2"},
+				Metadata: &attestation.BuildMetadata{InvocationID: fmt.Sprintf("slsa-demo-run-%d", i+1), StartedOn: &started, FinishedOn: &finished},
+			},
+		}
+		sbomDoc := map[string]any{
+			"spdxVersion": "SPDX-2.3",
+			"name":        image,
+			"packages":    []map[string]any{{"name": "stdlib", "versionInfo": "go1.21.5"}},
+		}
+		for _, p := range []struct {
+			predicateType string
+			predicate     any
+		}{
+			{attestation.PredicateSLSAProvenanceV1, prov},
+			{attestation.PredicateSPDX, sbomDoc},
+		} {
+			stmt, err := attestation.NewStatement(p.predicateType, p.predicate, subject)
+			if err != nil {
+				return added, err
+			}
+			payload, err := json.Marshal(stmt)
+			if err != nil {
+				return added, err
+			}
+			env, err := dsse.Sign(attestation.PayloadType, payload, signer)
+			if err != nil {
+				return added, err
+			}
+			if _, ok, err := st.Add(env, finished); err != nil {
+				return added, err
+			} else if ok {
+				added++
+			}
+		}
+	}
+	return added, nil
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/digest"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/osv"
+	"github.com/waveywaves/tekton-slsa-demo/internal/scan"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+)
+
+// scanBuilderID identifies the server as the author of the vulnerability
+// attestations it signs.
+const scanBuilderID = "https://github.com/waveywaves/tekton-slsa-demo/scan"
+
+// ScanResponse is the body of a /api/v1/scan/{digest} response.
+type ScanResponse struct {
+	Image   string      `json:"image"`
+	Digest  string      `json:"digest"`
+	Scanner scan.Tool   `json:"scanner"`
+	Report  *osv.Report `json:"report"`
+	// AttestationID is the vulnerability attestation the result was
+	// signed and stored as, for POST requests.
+	AttestationID string `json:"attestationId,omitempty"`
+}
+
+// scanHandler serves /api/v1/scan/{digest}, which scans an image for
+// vulnerabilities. GET returns fresh results; POST also signs them as a
+// cosign vulnerability attestation, stores it and needs the API token.
+// The image's repository is taken from the subjects of the attestations
+// stored about the digest, or from the repository parameter. Images that
+// already have a vulnerability attestation are scanned again only with
+// force=true.
+func (s *server) scanHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.scanImage(w, r)
+	case http.MethodPost:
+		s.requireToken(s.scanImage)(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *server) scanImage(w http.ResponseWriter, r *http.Request) {
+	if s.scanner == nil {
+		http.Error(w, "scanning is not configured", http.StatusNotImplemented)
+		return
+	}
+	sign := r.Method == http.MethodPost
+	if sign && s.signer == nil {
+		http.Error(w, "signing scan results is not configured", http.StatusNotImplemented)
+		return
+	}
+	d := strings.TrimPrefix(r.URL.Path, "/api/v1/scan/")
+	alg, hex, err := digest.Parse(d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d = alg + ":" + hex
+	q := r.URL.Query()
+	stored := s.store.List(store.Filter{Digest: d})
+	if q.Get("force") != "true" {
+		for _, a := range stored {
+			if a.PredicateType == attestation.PredicateVulnerability {
+				http.Error(w, fmt.Sprintf("%s already has vulnerability attestation %s; add force=true to scan it again", d, a.ID), http.StatusConflict)
+				return
+			}
+		}
+	}
+	ref, err := scanTarget(d, q.Get("repository"), stored)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := s.scanner.Scan(r.Context(), ref)
+	s.stats.scans.Inc()
+	if err != nil {
+		s.logger.Printf("Scan: %s: %v", ref, err)
+		s.upstreamFailed(w, r, err)
+		return
+	}
+	s.logger.Printf("Scan: %s: %d finding(s)", ref, len(res.Report.Findings))
+	body := ScanResponse{Image: ref.String(), Digest: d, Scanner: res.Scanner, Report: res.Report}
+	if !sign {
+		writeJSON(w, http.StatusOK, body)
+		return
+	}
+	a, err := s.storeScan(ref, res)
+	if err != nil {
+		http.Error(w, "signing scan results: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body.AttestationID = a.ID
+	writeJSON(w, http.StatusCreated, body)
+}
+
+// scanTarget names the image to scan: digest d in repository, or in the
+// repository of a stored subject with that digest.
+func scanTarget(d, repository string, stored []*store.Attestation) (oci.Reference, error) {
+	if repository == "" {
+		for _, a := range stored {
+			for _, sub := range a.Subjects {
+				if digest.InSet(sub.Digest, d) && sub.Name != "" {
+					repository = sub.Name
+					break
+				}
+			}
+			if repository != "" {
+				break
+			}
+		}
+	}
+	if repository == "" {
+		return oci.Reference{}, fmt.Errorf("no attestation names the repository of %s; add the repository parameter", d)
+	}
+	ref, err := oci.ParseReference(repository)
+	if err != nil {
+		return oci.Reference{}, err
+	}
+	ref.Tag = ""
+	return ref.WithDigest(d), nil
+}
+
+// storeScan signs res as a vulnerability attestation about ref and stores
+// it.
+func (s *server) storeScan(ref oci.Reference, res *scan.Result) (*store.Attestation, error) {
+	stmt, err := res.Statement(ref, scanBuilderID)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(stmt)
+	if err != nil {
+		return nil, err
+	}
+	env, err := signing.Sign(s.signer, attestation.PayloadType, payload)
+	if err != nil {
+		return nil, err
+	}
+	a, _, err := s.store.Add(env, s.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Printf("Scan: stored vulnerability attestation %s for %s", a.ID, ref)
+	return a, nil
+}
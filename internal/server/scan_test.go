@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/osv"
+	"github.com/waveywaves/tekton-slsa-demo/internal/scan"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/httptestutil"
+)
+
+// fakeScanner finds one vulnerability in every image.
+type fakeScanner struct{ scanned []string }
+
+func (f *fakeScanner) Scan(_ context.Context, ref oci.Reference) (*scan.Result, error) {
+	f.scanned = append(f.scanned, ref.String())
+	report := &osv.Report{Target: ref.String(), Digest: ref.Digest, Scanned: 1, Findings: []osv.Finding{{ID: "CVE-2024-0727", Package: "libcrypto3", Severity: osv.LevelMedium}}}
+	raw, _ := json.Marshal(report)
+	return &scan.Result{Scanner: scan.Tool{URI: "pkg:github/aquasecurity/trivy"}, Report: report, Raw: raw}, nil
+}
+
+func TestScan(t *testing.T) {
+	st := store.New()
+	if _, err := SeedSampleData(st, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := signing.NewSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := &fakeScanner{}
+	h := NewServer(Config{APIToken: "s3cret"}, Deps{Store: st, Scanner: scanner, Signer: signing.KeyBackend(signer)})
+	sample := sampleDigest(SampleImages[0])
+
+	httptestutil.AssertStatus(t, httptestutil.Get(NewServer(Config{}, Deps{}), "/api/v1/scan/"+sample), http.StatusNotImplemented)
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/scan/sha256:abc"), http.StatusBadRequest)
+	// Nothing names the repository of an unknown digest.
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/scan/sha256:"+strings.Repeat("f", 64)), http.StatusBadRequest)
+
+	var got ScanResponse
+	httptestutil.DecodeJSON(t, httptestutil.Get(h, "/api/v1/scan/"+sample), &got)
+	if got.Image != SampleImages[0]+"@"+sample || len(got.Report.Findings) != 1 || got.AttestationID != "" {
+		t.Errorf("scan = %+v", got)
+	}
+	httptestutil.DecodeJSON(t, httptestutil.Get(h, "/api/v1/scan/sha256:"+strings.Repeat("f", 64)+"?repository=ghcr.io/org/other:v1"), &got)
+	if got.Image != "ghcr.io/org/other@sha256:"+strings.Repeat("f", 64) {
+		t.Errorf("scan with a repository = %+v", got)
+	}
+
+	post := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		return httptestutil.Do(h, req)
+	}
+	httptestutil.AssertStatus(t, httptestutil.Do(h, httptest.NewRequest(http.MethodPost, "/api/v1/scan/"+sample, nil)), http.StatusUnauthorized)
+	rr := post("/api/v1/scan/" + sample)
+	httptestutil.AssertStatus(t, rr, http.StatusCreated)
+	httptestutil.DecodeJSON(t, rr, &got)
+	a, err := st.Get(got.AttestationID)
+	if err != nil || a.PredicateType != attestation.PredicateVulnerability {
+		t.Fatalf("stored scan attestation %q: %+v, %v", got.AttestationID, a, err)
+	}
+
+	// The image now has a scan attestation.
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/scan/"+sample), http.StatusConflict)
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/api/v1/scan/"+sample+"?force=true"), http.StatusOK)
+	if len(scanner.scanned) != 4 {
+		t.Errorf("scanned %q, want 4 scans", scanner.scanned)
+	}
+}
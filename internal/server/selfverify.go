@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/status"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// defaultSelfVerifyInterval is how often the server verifies its own
+// image when Config.SelfVerifyInterval is zero.
+const defaultSelfVerifyInterval = 5 * time.Minute
+
+// selfVerification tracks the server's periodic verification of its own
+// image, which the freshness gauges report.
+type selfVerification struct {
+	ref      oci.Reference
+	interval time.Duration
+
+	mu      sync.Mutex
+	started time.Time
+	// lastSuccess is when SLSA provenance for the image last verified.
+	lastSuccess time.Time
+	// verified is the outcome of the last attempt.
+	verified bool
+	// builtAt is when the verified provenance says the image was built.
+	builtAt time.Time
+	// lastAttempt is when the image was last verified, successfully or
+	// not, and digest what it last resolved to.
+	lastAttempt time.Time
+	digest      string
+}
+
+// startSelfVerification registers the freshness gauges and starts
+// verifying cfg.SelfImage in the background. An unparsable reference is
+// logged and leaves self-verification off.
+func (s *server) startSelfVerification() {
+	ref, err := oci.ParseReference(s.cfg.SelfImage)
+	if err != nil {
+		s.logger.Printf("Self-verification disabled: %v", err)
+		return
+	}
+	sv := &selfVerification{ref: ref, interval: s.cfg.SelfVerifyInterval, started: s.clock.Now()}
+	if sv.interval <= 0 {
+		sv.interval = defaultSelfVerifyInterval
+	}
+	s.registerSelfMetrics(sv)
+	s.self = sv
+	go s.selfVerifyLoop(sv)
+}
+
+// registerSelfMetrics exports the freshness of self-verification, for
+// alerts on the supply-chain state going stale or failing.
+func (s *server) registerSelfMetrics(sv *selfVerification) {
+	s.metrics.NewGaugeFunc("self_verification_age_seconds",
+		"Seconds since SLSA provenance for the server's own image last verified, counted from startup until it first does.",
+		func() float64 {
+			sv.mu.Lock()
+			defer sv.mu.Unlock()
+			since := sv.lastSuccess
+			if since.IsZero() {
+				since = sv.started
+			}
+			return s.clock.Now().Sub(since).Seconds()
+		})
+	s.metrics.NewGaugeFunc("slsa_verified_damped",
+		"slsa_verified damped for alerting: 0 while self-verification flaps between verified and unverified.",
+		func() float64 {
+			for _, c := range s.history.Checks(s.clock.Now()) {
+				if c.Name == selfCheckPrefix+sv.ref.String() && c.Damped == status.Verified {
+					return 1
+				}
+			}
+			return 0
+		})
+	s.metrics.NewGaugeFunc("provenance_age_seconds",
+		"Seconds since the server's own image was built, according to its verified provenance; NaN until provenance verifies.",
+		func() float64 {
+			sv.mu.Lock()
+			defer sv.mu.Unlock()
+			if sv.builtAt.IsZero() {
+				return math.NaN()
+			}
+			return s.clock.Now().Sub(sv.builtAt).Seconds()
+		})
+	s.metrics.NewGaugeFunc("slsa_verified",
+		"1 when the last verification of the server's own image verified its SLSA provenance, 0 otherwise.",
+		func() float64 {
+			sv.mu.Lock()
+			defer sv.mu.Unlock()
+			if sv.verified {
+				return 1
+			}
+			return 0
+		})
+}
+
+// selfVerifyLoop verifies the server's own image now and then every
+// interval, for as long as the process runs, except in maintenance.
+func (s *server) selfVerifyLoop(sv *selfVerification) {
+	ticker := time.NewTicker(sv.interval)
+	defer ticker.Stop()
+	for {
+		if !s.maintenance.active() {
+			ctx, cancel := context.WithTimeout(context.Background(), sv.interval)
+			s.selfVerify(ctx, sv)
+			cancel()
+		}
+		<-ticker.C
+	}
+}
+
+// errNoSelfPolicy reports a self image verified without the identity and
+// issuer it must be signed by, which any signer the trust root accepts
+// would otherwise satisfy.
+var errNoSelfPolicy = failure.New(failure.PolicyDenied, "no self identity and issuer are configured")
+
+// selfVerify verifies the image once, bypassing the result cache so the
+// gauges reflect the registry and transparency log as they are now. It
+// records the outcome in the status history and logs when the damped
+// outcome changes or starts or stops flapping. Without a configured
+// identity and issuer the image is not verified and counts as unverified.
+func (s *server) selfVerify(ctx context.Context, sv *selfVerification) {
+	var res *verify.Result
+	err := errNoSelfPolicy
+	if s.cfg.SelfIdentity != "" && s.cfg.SelfIssuer != "" {
+		res, err = s.verifyImage(ctx, sv.ref, verify.Options{Identity: s.cfg.SelfIdentity, Issuer: s.cfg.SelfIssuer})
+	}
+	var check *verify.Check
+	if err == nil {
+		res = s.applyDenylist(res)
+		check = verifiedProvenance(res)
+	}
+	now := s.clock.Now()
+
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.verified = check != nil
+	sv.lastAttempt = now
+	if err == nil {
+		sv.digest = res.Digest
+	}
+	if check != nil {
+		sv.lastSuccess = now
+		sv.builtAt = s.buildTime(res.Digest, check)
+	}
+	c, changed := s.history.Record(selfCheckPrefix+sv.ref.String(), check != nil, now)
+	switch {
+	case errors.Is(err, errNoSelfPolicy) && !changed:
+	case err != nil:
+		s.logger.Printf("Self-verification of %s failed: %v", sv.ref, err)
+	case !changed:
+	case c.Flapping:
+		s.logger.Printf("Self-verification of %s is flapping: %d changes recently; treating it as unverified", sv.ref, c.Changes)
+	case check != nil:
+		s.logger.Printf("Self-verification: SLSA provenance for %s verified", sv.ref)
+	default:
+		s.logger.Printf("Self-verification of %s failed: no SLSA provenance verified", sv.ref)
+	}
+}
+
+// verifiedProvenance returns the first verified SLSA provenance check in
+// res, or nil.
+func verifiedProvenance(res *verify.Result) *verify.Check {
+	for i, c := range res.Checks {
+		if c.Kind == verify.KindAttestation && c.Verified && attestation.IsProvenance(c.PredicateType) {
+			return &res.Checks[i]
+		}
+	}
+	return nil
+}
+
+// buildTime is when the newest stored provenance for digest says the
+// build finished, or else when the verified provenance was logged.
+func (s *server) buildTime(digest string, check *verify.Check) time.Time {
+	for _, a := range s.store.List(store.Filter{Digest: digest}) {
+		if b := asBuild(a); b != nil {
+			if md := b.prov.RunDetails.Metadata; md != nil && md.FinishedOn != nil {
+				return *md.FinishedOn
+			}
+		}
+	}
+	if check.SignedAt != nil {
+		return *check.SignedAt
+	}
+	return time.Time{}
+}
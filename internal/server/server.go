@@ -0,0 +1,498 @@
+// Package server implements the demo's HTTP server: the landing page, the
+// health, info and SBOM endpoints, and the attestation API.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/cache"
+	"github.com/waveywaves/tekton-slsa-demo/internal/clock"
+	"github.com/waveywaves/tekton-slsa-demo/internal/denylist"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/env"
+	"github.com/waveywaves/tekton-slsa-demo/internal/fault"
+	"github.com/waveywaves/tekton-slsa-demo/internal/graphql"
+	"github.com/waveywaves/tekton-slsa-demo/internal/httpclient"
+	"github.com/waveywaves/tekton-slsa-demo/internal/memlimit"
+	"github.com/waveywaves/tekton-slsa-demo/internal/metrics"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oidc"
+	"github.com/waveywaves/tekton-slsa-demo/internal/replay"
+	"github.com/waveywaves/tekton-slsa-demo/internal/reproducibility"
+	"github.com/waveywaves/tekton-slsa-demo/internal/rotation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/scan"
+	"github.com/waveywaves/tekton-slsa-demo/internal/shard"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/singleflight"
+	"github.com/waveywaves/tekton-slsa-demo/internal/status"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/tofu"
+	"github.com/waveywaves/tekton-slsa-demo/internal/trace"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+	"github.com/waveywaves/tekton-slsa-demo/internal/watch"
+)
+
+// Config is the configuration of the HTTP server.
+type Config struct {
+	// Dev enables development mode: assets from WebDir, request logging
+	// and no API authentication.
+	Dev    bool
+	WebDir string
+	// APIToken is the bearer token required to ingest attestations and to
+	// use the admin endpoints. When empty, both are disabled outside
+	// development mode.
+	APIToken string
+	// MaxInFlight bounds the requests handled at once; zero disables load
+	// shedding. Requests over the limit wait up to MaxQueueWait for a slot
+	// and are then rejected with 503. /health and /metrics are never shed.
+	MaxInFlight  int
+	MaxQueueWait time.Duration
+	// RequestTimeout bounds handling a request once it is admitted; zero
+	// disables it. A verification still running when it passes is
+	// abandoned and answered with 504. Downloads and streamed responses
+	// are not bounded.
+	RequestTimeout time.Duration
+	// SelfImage is a reference to the image the server runs from. When
+	// set, the server verifies it every SelfVerifyInterval (five minutes
+	// when zero) and exports the outcome and its age as gauges. It must
+	// be signed by SelfIdentity as issued by SelfIssuer; while either is
+	// empty it is reported unverified.
+	SelfImage          string
+	SelfVerifyInterval time.Duration
+	SelfIdentity       string
+	SelfIssuer         string
+	// Watch lists images to poll every WatchInterval (five minutes when
+	// zero), verifying each new digest. It needs Deps.Registry and
+	// Deps.Verify.
+	Watch         []WatchTarget
+	WatchInterval time.Duration
+	// WebhookSecret authenticates the push notifications registries send
+	// to /webhooks/registry. When empty, the webhook is disabled outside
+	// development mode.
+	WebhookSecret string
+	// WebhookRepositories are what images pushed to each repository must
+	// satisfy. Pushes to other repositories are not verified.
+	WebhookRepositories []WebhookRepository
+	// ArtifactSources are the URL prefixes, such as a bucket's, that
+	// /artifacts/{digest} downloads attested artifacts from. Subjects named
+	// by a relative path are looked up under the first. Empty, or no
+	// Deps.ArtifactKeys, disables artifact downloads.
+	ArtifactSources []string
+	// Admins are the email addresses, or OIDC subjects, of the users who
+	// may sign in to the admin dashboard at /admin with Deps.OIDC.
+	// Sessions last SessionTTL, eight hours when zero.
+	Admins     []string
+	SessionTTL time.Duration
+	// Fingerprint identifies the effective configuration, served at
+	// /config/fingerprint so that drift between replicas shows. Empty
+	// disables the endpoint.
+	Fingerprint string
+}
+
+// VerifyFunc collects an image's evidence and verifies it.
+type VerifyFunc func(ctx context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error)
+
+// Deps are the collaborators the server is assembled from. Zero fields get
+// working defaults, except Verify and Registry: without them
+// /api/v1/verify and image digests report 501.
+type Deps struct {
+	Store  *store.Store
+	Verify VerifyFunc
+	// Clock timestamps responses and received attestations.
+	Clock clock.Clock
+	// Env supplies APP_VERSION, BUILD_TIME and GO_VERSION.
+	Env env.Env
+	// Logger receives request logs in development mode.
+	Logger *log.Logger
+	// Registry fetches image manifests for the digest calculator. Without
+	// it, digesting an image reports 501.
+	Registry oci.RegistryClient
+	// Metrics receives the server's metrics, served at /metrics. A nil
+	// registry gets a fresh one.
+	Metrics *metrics.Registry
+	// Pins enables trust on first use: the first identity verified for
+	// each repository is pinned, and any other identity signing later is
+	// reported and logged. Only watched images, webhook pushes and
+	// /api/v1/verify requests carrying the API token pin a repository.
+	// Nil disables it.
+	Pins *tofu.Pins
+	// Denylist holds the digests and signer identities that fail every
+	// verification, managed at /api/v1/admin/denylist. A nil list gets an
+	// empty one kept in memory.
+	Denylist *denylist.List
+	// Replay remembers the logged provenance of each repository's builds,
+	// to flag stale and replayed provenance in verification results. A nil
+	// tracker gets one kept in memory.
+	Replay *replay.Tracker
+	// Faults injects faults on purpose, set at /api/v1/admin/faults, for
+	// resilience demos. Nil disables fault injection; outbound requests
+	// consult the injector only if it is also given to the httpclient
+	// package.
+	Faults *fault.Injector
+	// Scanner scans images for vulnerabilities at /api/v1/scan/{digest}.
+	// Without one, scanning reports 501.
+	Scanner scan.Scanner
+	// Signer signs the VSAs /api/v1/verify issues with format=vsa and the
+	// scan results stored as attestations, with whichever backend it is.
+	// Without one, both report 501.
+	Signer signing.Backend
+	// Collect gathers the signatures, attestations and Rekor proofs
+	// attached to an image in its registry, with the trust root to check
+	// them, for /api/v1/images/{digest}/bundle. Without it, bundles have
+	// only what the server stores and records.
+	Collect func(ctx context.Context, ref oci.Reference) (*verify.Bundle, error)
+	// HTTPClient downloads artifacts for /artifacts/{digest}. Nil uses the
+	// shared outbound client.
+	HTTPClient *http.Client
+	// ArtifactKeys are the keys an attestation must be signed with for
+	// /artifacts/{digest} to download the artifacts it names. Without any,
+	// artifact downloads report 501.
+	ArtifactKeys []dsse.Verifier
+	// OIDC signs administrators in to the admin dashboard, with sessions
+	// separate from the API token. Nil disables the dashboard.
+	OIDC *oidc.Client
+	// Shard splits the watch list's verifications with the other replicas
+	// of the server by digest, so each new digest is verified once rather
+	// than by every replica. Nil verifies every digest here.
+	Shard *shard.Sharder
+}
+
+type server struct {
+	cfg         Config
+	store       *store.Store
+	verifyImage VerifyFunc
+	registry    oci.RegistryClient
+	clock       clock.Clock
+	env         env.Env
+	logger      *log.Logger
+	web         *site
+	verified    *cache.Cache[verifyKey, cachedResult]
+	inFlight    singleflight.Group[verifyKey, *verify.Result]
+	metrics     *metrics.Registry
+	stats       serverMetrics
+	pins        *tofu.Pins
+	rotations   *rotation.Monitor
+	graphql     *graphql.Schema
+	watch       *watch.Monitor
+	pushes      *pushQueue
+	denylist    *denylist.List
+	replay      *replay.Tracker
+	history     *status.History
+	maintenance *maintenance
+	faults      *fault.Injector
+	scanner     scan.Scanner
+	signer      signing.Backend
+	collect     func(context.Context, oci.Reference) (*verify.Bundle, error)
+	httpClient  *http.Client
+	oidc        *oidc.Client
+	sessions    *sessions
+	shard       *shard.Sharder
+	// self is the verification of SelfImage, nil when it is not set.
+	self *selfVerification
+	// reproducibility records the rebuilds compared with provenance.
+	reproducibility *reproducibility.Tracker
+	// verifications are the latest verifications of each digest.
+	verifications *verificationLog
+	// artifactKeys verify the attestations naming downloadable artifacts,
+	// and artifactSlots bound the downloads running at once.
+	artifactKeys   []dsse.Verifier
+	artifactSigned *artifactSignatures
+	artifactSlots  chan struct{}
+	// mux routes the requests the demo page makes of the API.
+	mux *http.ServeMux
+}
+
+// serverMetrics are the metrics the server updates as it works.
+type serverMetrics struct {
+	verifications        *metrics.Counter
+	verifyCacheHits      *metrics.Counter
+	verifyDeduplicated   *metrics.Counter
+	verifyDuration       *metrics.Histogram
+	tofuMismatches       *metrics.Counter
+	rotations            *metrics.Counter
+	watchDigests         *metrics.Counter
+	webhookPushes        *metrics.Counter
+	denied               *metrics.Counter
+	replayFindings       *metrics.Counter
+	schemaViolations     *metrics.Counter
+	verifyCacheCorrupt   *metrics.Counter
+	rebuilds             *metrics.Counter
+	reproducibleRebuilds *metrics.Counter
+	scans                *metrics.Counter
+	artifactDownloads    *metrics.Counter
+	artifactMismatches   *metrics.Counter
+	adminSignIns         *metrics.Counter
+	adminSignInFailures  *metrics.Counter
+	vsasIssued           *metrics.Counter
+	failures             *metrics.CounterVec
+}
+
+func newServerMetrics(r *metrics.Registry) serverMetrics {
+	return serverMetrics{
+		verifications:        r.NewCounter("verifications_total", "Image verifications run against registries and Rekor."),
+		verifyCacheHits:      r.NewCounter("verify_cache_hits_total", "Verification requests answered from the result cache."),
+		verifyDeduplicated:   r.NewCounter("verify_deduplicated_total", "Verification requests that shared a concurrent identical verification."),
+		verifyDuration:       r.NewHistogram("verification_duration_seconds", "Time to collect and verify an image's signatures and attestations.", metrics.LatencyBuckets),
+		tofuMismatches:       r.NewCounter("tofu_mismatches_total", "Verified images signed by an identity other than the one pinned for their repository."),
+		rotations:            r.NewCounter("signing_identity_rotations_total", "Ingested attestations signed by an identity not yet approved for their subject."),
+		watchDigests:         r.NewCounter("watch_new_digests_total", "New digests of watched images verified."),
+		webhookPushes:        r.NewCounter("webhook_pushes_total", "Pushed images queued for verification by registry webhooks."),
+		denied:               r.NewCounter("denylist_denials_total", "Verifications failed because the image digest or a signer is on the denylist."),
+		replayFindings:       r.NewCounter("replay_findings_total", "Verified provenance that is stale, superseded or replays a log entry of another image."),
+		schemaViolations:     r.NewCounter("schema_invalid_attestations_total", "Ingested attestations whose predicate does not match the schema of its type."),
+		verifyCacheCorrupt:   r.NewCounter("verify_cache_corrupt_total", "Cached verification results that failed their checksum and were verified afresh."),
+		rebuilds:             r.NewCounter("reproducibility_comparisons_total", "Independent rebuilds compared with the subject of their provenance."),
+		scans:                r.NewCounter("image_scans_total", "On-demand vulnerability scans of images run."),
+		reproducibleRebuilds: r.NewCounter("reproducible_rebuilds_total", "Independent rebuilds that matched the subject of their provenance bit for bit."),
+		artifactDownloads:    r.NewCounter("artifact_downloads_total", "Attested artifacts downloaded, verified against their digest and served."),
+		artifactMismatches:   r.NewCounter("artifact_digest_mismatches_total", "Artifact downloads refused because they did not match their attested digest."),
+		adminSignIns:         r.NewCounter("admin_sign_ins_total", "Administrators signed in to the admin dashboard."),
+		adminSignInFailures:  r.NewCounter("admin_sign_in_failures_total", "Sign-ins to the admin dashboard refused or failed."),
+		vsasIssued:           r.NewCounter("vsas_issued_total", "Verification summary attestations signed and issued by /api/v1/verify."),
+		failures:             r.NewCounterVec("verification_failures_total", "Failed verifications, stale provenance, pinned identity mismatches and rejected uploads, by failure code.", "code", failureCodes()...),
+	}
+}
+
+// Cache budgets as shares of the memory limit, and the fixed sizes used
+// when the process has no limit.
+const (
+	verifyCacheShare    = 1.0 / 16
+	verifyCacheFallback = 16 << 20
+	rowCacheShare       = 1.0 / 32
+	rowCacheFallback    = 8 << 20
+)
+
+// verifyCacheTTL bounds how stale a cached verification result can be.
+// Results are only cached for digest-pinned images, so this covers changes
+// in the evidence attached to a digest, not in what a tag points to.
+const verifyCacheTTL = 5 * time.Minute
+
+// NewServer assembles the routes and middleware of the server.
+func NewServer(cfg Config, deps Deps) http.Handler {
+	s := &server{
+		cfg:         cfg,
+		store:       deps.Store,
+		verifyImage: deps.Verify,
+		registry:    deps.Registry,
+		clock:       deps.Clock,
+		env:         deps.Env,
+		logger:      deps.Logger,
+		web:         embeddedSite(),
+		metrics:     deps.Metrics,
+		pins:        deps.Pins,
+		rotations:   rotation.NewMonitor(),
+		denylist:    deps.Denylist,
+		replay:      deps.Replay,
+		history:     status.New(0, 0),
+		maintenance: newMaintenance(),
+		faults:      deps.Faults,
+		scanner:     deps.Scanner,
+		signer:      deps.Signer,
+		collect:     deps.Collect,
+		httpClient:  deps.HTTPClient,
+		oidc:        deps.OIDC,
+		sessions:    newSessions(),
+		shard:       deps.Shard,
+
+		reproducibility: reproducibility.New(),
+		verifications:   newVerificationLog(),
+		artifactKeys:    deps.ArtifactKeys,
+		artifactSigned:  &artifactSignatures{signed: make(map[string]bool)},
+		artifactSlots:   make(chan struct{}, maxArtifactDownloads),
+	}
+	if s.store == nil {
+		s.store = store.New()
+	}
+	if s.clock == nil {
+		s.clock = clock.System{}
+	}
+	if s.env == nil {
+		s.env = env.OS{}
+	}
+	if s.logger == nil {
+		s.logger = log.Default()
+	}
+	if s.metrics == nil {
+		s.metrics = metrics.NewRegistry()
+	}
+	if s.denylist == nil {
+		s.denylist = denylist.New()
+	}
+	if s.replay == nil {
+		s.replay = replay.New()
+	}
+	if s.httpClient == nil {
+		s.httpClient = httpclient.Default()
+	}
+	// A source must end in a slash, so that a bucket's prefix does not
+	// admit its namesakes: https://host/bucket-evil after https://host/bucket.
+	s.cfg.ArtifactSources = make([]string, len(cfg.ArtifactSources))
+	for i, src := range cfg.ArtifactSources {
+		if !strings.HasSuffix(src, "/") {
+			src += "/"
+		}
+		s.cfg.ArtifactSources[i] = src
+	}
+	s.stats = newServerMetrics(s.metrics)
+	s.metrics.NewGaugeFunc("status_flapping_checks", "Checks, such as self-verification and watched tags, flapping between verified and unverified.",
+		func() float64 { return float64(s.flappingChecks()) })
+	s.metrics.NewGaugeFunc("maintenance_mode", "1 while the server is in maintenance mode, with background verification paused.",
+		func() float64 {
+			if s.maintenance.active() {
+				return 1
+			}
+			return 0
+		})
+	s.metrics.NewGaugeFunc("shard_replicas", "Live replicas sharing background verification, this one included.",
+		func() float64 { return float64(max(len(s.shard.Members()), 1)) })
+	s.metrics.NewGaugeFunc("reproducibility_rate", "Share of the independent rebuilds compared that were reproducible bit for bit.", s.reproducibility.Rate)
+	s.graphql = s.newGraphQLSchema()
+	if cfg.SelfImage != "" && s.verifyImage != nil {
+		s.startSelfVerification()
+	}
+	if len(cfg.Watch) > 0 && s.verifyImage != nil && s.registry != nil {
+		s.startWatch()
+	}
+	if s.verifyImage != nil && (cfg.Dev || cfg.WebhookSecret != "") {
+		s.startPushQueue()
+	}
+
+	// Size the caches for the pod rather than with fixed defaults, and
+	// shed cached entries when memory runs short.
+	limit := memlimit.Limit()
+	pressure := memlimit.Pressure(limit)
+	s.verified = cache.New(memlimit.Budget(limit, verifyCacheShare, verifyCacheFallback), verifyResultSize)
+	s.verified.TTL = verifyCacheTTL
+	s.verified.Clock = s.clock
+	s.verified.Pressure = pressure
+	if cfg.Dev {
+		s.web = diskSite(cfg.WebDir)
+	}
+	s.web.rowBytes = memlimit.Budget(limit, rowCacheShare, rowCacheFallback)
+	s.web.pressure = pressure
+	if !cfg.Dev {
+		// Parse the templates and pre-render their fragments now rather
+		// than on the first request; errors resurface when rendering.
+		s.web.templates()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.rootHandler)
+	mux.HandleFunc("/health", s.healthHandler)
+	mux.HandleFunc("/ready", s.readyHandler)
+	mux.HandleFunc("/status.json", s.statusJSONHandler)
+	mux.HandleFunc("/info", s.infoHandler)
+	mux.HandleFunc("/config/fingerprint", s.fingerprintHandler)
+	mux.Handle("/metrics", s.metrics.Handler())
+	mux.HandleFunc("/api/v1/metrics/summary", s.metricsSummaryHandler)
+	mux.HandleFunc("/sbom", s.sbomHandler)
+	mux.HandleFunc("/demo", s.demoHandler)
+	mux.Handle("/static/", s.web.static())
+	mux.HandleFunc("/attestations/", s.attestationPage)
+	mux.HandleFunc("/api/v1/attestations", s.attestationsHandler)
+	mux.HandleFunc("/api/v1/attestations/", s.attestationHandler)
+	mux.HandleFunc("/api/v1/attestations/search", s.searchHandler)
+	mux.HandleFunc("/api/v1/verify", s.verifyHandler)
+	mux.HandleFunc("/api/v1/digest", s.digestHandler)
+	mux.HandleFunc("/api/v1/watch", s.watchHandler)
+	mux.HandleFunc("/api/v1/status/history", s.statusHistoryHandler)
+	mux.HandleFunc("/api/v1/reproducibility", s.reproducibilityHandler)
+	mux.HandleFunc("/api/v1/scan/", s.scanHandler)
+	mux.HandleFunc("/api/v1/images/", s.imagesHandler)
+	mux.HandleFunc("/artifacts/", s.artifactHandler)
+	mux.HandleFunc("/auth/login", s.loginHandler)
+	mux.HandleFunc("/auth/callback", s.callbackHandler)
+	mux.HandleFunc("/auth/logout", s.requireSession(s.logoutHandler))
+	mux.HandleFunc("/admin", s.requireSession(s.adminHandler))
+	mux.HandleFunc("/admin/", s.requireSession(s.adminActionHandler))
+	mux.HandleFunc("/webhooks/registry", s.registryWebhookHandler)
+	mux.HandleFunc("/graphql", s.graphqlHandler)
+	mux.HandleFunc("/graphql/schema", s.graphqlSchemaHandler)
+	mux.HandleFunc("/api/v1/admin/rotations", s.requireToken(s.rotationsHandler))
+	mux.HandleFunc("/api/v1/admin/rotations/", s.requireToken(s.rotationsHandler))
+	mux.HandleFunc("/api/v1/admin/denylist", s.requireToken(s.denylistHandler))
+	mux.HandleFunc("/api/v1/admin/denylist/", s.requireToken(s.denylistHandler))
+	mux.HandleFunc("/api/v1/admin/maintenance", s.requireToken(s.maintenanceHandler))
+	mux.HandleFunc("/api/v1/admin/faults", s.requireToken(s.faultsHandler))
+	s.mux = mux
+	var h http.Handler = withTrace(mux)
+	if cfg.RequestTimeout > 0 {
+		h = withDeadline(h, cfg.RequestTimeout)
+	}
+	if cfg.MaxInFlight > 0 {
+		h = newShedder(cfg.MaxInFlight, cfg.MaxQueueWait, s.logger).wrap(h)
+	}
+	if cfg.Dev {
+		return s.logRequests(h)
+	}
+	return h
+}
+
+// withTrace carries the trace ID of an incoming traceparent header in the
+// request context, for metric exemplars and outbound calls.
+func withTrace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(trace.Header) != "" {
+			r = r.WithContext(trace.FromRequest(r))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireToken guards write and admin endpoints with the configured bearer
+// token. Development mode lets every request through.
+func (s *server) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.Dev {
+			next(w, r)
+			return
+		}
+		if s.cfg.APIToken == "" {
+			http.Error(w, "this endpoint is disabled: no API token configured", http.StatusForbidden)
+			return
+		}
+		if !s.hasToken(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tekton-slsa-demo"`)
+			http.Error(w, "missing or invalid API token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// hasToken reports whether r carries the configured API token.
+func (s *server) hasToken(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && s.cfg.APIToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.APIToken)) == 1
+}
+
+// statusRecorder captures the response status for request logging.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, so
+// streamed responses can still be flushed in development mode.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (s *server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := s.clock.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		s.logger.Printf("%s %s %d %s", r.Method, r.URL.RequestURI(), rec.status, s.clock.Now().Sub(start).Round(time.Microsecond))
+	})
+}
@@ -0,0 +1,289 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/clock"
+	"github.com/waveywaves/tekton-slsa-demo/internal/env"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/golden"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/httptestutil"
+)
+
+func TestHealthHandler(t *testing.T) {
+	rr := httptestutil.Get(NewServer(Config{}, Deps{}), "/health")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+
+	var response HealthResponse
+	httptestutil.DecodeJSON(t, rr, &response)
+
+	if response.Status != "healthy" {
+		t.Errorf("Expected status 'healthy', got '%s'", response.Status)
+	}
+
+	if response.Component != "tekton-slsa-demo" {
+		t.Errorf("Expected component 'tekton-slsa-demo', got '%s'", response.Component)
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	h := NewServer(Config{APIToken: "s3cret"}, Deps{Logger: log.New(io.Discard, "", 0)})
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/maintenance", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		return httptestutil.Do(h, req)
+	}
+
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/ready"), http.StatusOK)
+	httptestutil.AssertStatus(t, httptestutil.Do(h, httptest.NewRequest(http.MethodPut, "/api/v1/admin/maintenance", strings.NewReader(`{"enabled": true}`))), http.StatusUnauthorized)
+	httptestutil.AssertStatus(t, put(`{"enabled": "yes"}`), http.StatusBadRequest)
+
+	rr := put(`{"enabled": true, "reason": "rotating signing keys"}`)
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertContains(t, rr, `"enabled":true`, `"since":`)
+	rr = httptestutil.Get(h, "/ready")
+	httptestutil.AssertStatus(t, rr, http.StatusServiceUnavailable)
+	httptestutil.AssertContains(t, rr, "rotating signing keys")
+	// Liveness is unaffected, so the pod is not restarted.
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/health"), http.StatusOK)
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/"), `class="maintenance"`, "Maintenance in progress: rotating signing keys")
+	httptestutil.AssertContains(t, httptestutil.Get(h, "/metrics"), "tekton_slsa_demo_maintenance_mode 1\n")
+
+	httptestutil.AssertStatus(t, put(`{"enabled": false}`), http.StatusOK)
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/ready"), http.StatusOK)
+	if body := httptestutil.Get(h, "/").Body.String(); strings.Contains(body, "Maintenance in progress") {
+		t.Error("banner shown after maintenance ended")
+	}
+}
+
+func TestInfoHandler(t *testing.T) {
+	// Set environment variable for testing
+	os.Setenv("APP_VERSION", "1.2.3")
+	defer os.Unsetenv("APP_VERSION")
+
+	rr := httptestutil.Get(NewServer(Config{}, Deps{}), "/info")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+
+	var response InfoResponse
+	httptestutil.DecodeJSON(t, rr, &response)
+
+	if response.Name != "Tekton SLSA Demo Application" {
+		t.Errorf("Expected name 'Tekton SLSA Demo Application', got '%s'", response.Name)
+	}
+
+	if response.Version != "1.2.3" {
+		t.Errorf("Expected version '1.2.3', got '%s'", response.Version)
+	}
+}
+
+func TestFingerprintHandler(t *testing.T) {
+	httptestutil.AssertStatus(t, httptestutil.Get(NewServer(Config{}, Deps{}), "/config/fingerprint"), http.StatusNotImplemented)
+
+	rr := httptestutil.Get(NewServer(Config{Fingerprint: "sha256:abc"}, Deps{Env: env.Map{"APP_VERSION": "1.2.3"}}), "/config/fingerprint")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	var response FingerprintResponse
+	httptestutil.DecodeJSON(t, rr, &response)
+	if response != (FingerprintResponse{Fingerprint: "sha256:abc", Version: "1.2.3"}) {
+		t.Errorf("response = %+v", response)
+	}
+}
+
+func TestRootHandler(t *testing.T) {
+	rr := httptestutil.Get(NewServer(Config{}, Deps{}), "/")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertHeader(t, rr, "Content-Type", "text/html")
+	httptestutil.AssertContains(t, rr, "Tekton SLSA Demo Application", "/health")
+}
+
+func TestSBOMHandler(t *testing.T) {
+	for _, tt := range []struct {
+		query       string
+		contentType string
+		field       string
+	}{
+		{"", "application/spdx+json", "spdxVersion"},
+		{"?format=cyclonedx", "application/vnd.cyclonedx+json", "bomFormat"},
+	} {
+		rr := httptestutil.Get(NewServer(Config{}, Deps{}), "/sbom"+tt.query)
+		httptestutil.AssertStatus(t, rr, http.StatusOK)
+		httptestutil.AssertHeader(t, rr, "Content-Type", tt.contentType)
+		var doc map[string]any
+		httptestutil.DecodeJSON(t, rr, &doc)
+		if _, ok := doc[tt.field]; !ok {
+			t.Errorf("GET /sbom%s: missing %q field", tt.query, tt.field)
+		}
+	}
+
+	rr := httptestutil.Get(NewServer(Config{}, Deps{}), "/sbom?format=xml")
+	httptestutil.AssertStatus(t, rr, http.StatusBadRequest)
+}
+
+func TestDevModeSite(t *testing.T) {
+	st := store.New()
+	n, err := SeedSampleData(st, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 || st.Len() != n {
+		t.Fatalf("seeded %d attestations, store has %d", n, st.Len())
+	}
+
+	// Templates are read from disk on every request.
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "templates"), 0o755)
+	os.MkdirAll(filepath.Join(dir, "static"), 0o755)
+	page := filepath.Join(dir, "templates", "index.html")
+	os.WriteFile(page, []byte(`v1 {{len .Attestations}}`), 0o644)
+	var logs strings.Builder
+	h := NewServer(Config{Dev: true, WebDir: dir}, Deps{Store: st, Logger: log.New(&logs, "", 0)})
+
+	get := func() string {
+		return httptestutil.Get(h, "/").Body.String()
+	}
+	if got := get(); got != "v1 6" {
+		t.Errorf("first render = %q", got)
+	}
+	os.WriteFile(page, []byte(`v2`), 0o644)
+	if got := get(); got != "v2" {
+		t.Errorf("render after edit = %q, want the edited template", got)
+	}
+	if !strings.Contains(logs.String(), "GET / 200") {
+		t.Errorf("development mode did not log requests: %q", logs.String())
+	}
+}
+
+func TestInjectedClockAndEnv(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	h := NewServer(Config{}, Deps{
+		Clock: clock.Fixed(now),
+		Env:   env.Map{"APP_VERSION": "9.9.9"},
+	})
+
+	httptestutil.AssertJSONEqual(t, httptestutil.Get(h, "/health").Body.Bytes(), []byte(`{
+		"status": "healthy",
+		"timestamp": "2024-03-01T12:00:00Z",
+		"version": "9.9.9",
+		"component": "tekton-slsa-demo"
+	}`))
+
+	// The build time falls back to the injected clock.
+	httptestutil.AssertJSONEqual(t, httptestutil.Get(h, "/info").Body.Bytes(), []byte(`{
+		"name": "Tekton SLSA Demo Application",
+		"version": "9.9.9",
+		"description": "A sample application demonstrating SLSA compliance with Tekton Chains",
+		"build_time": "2024-03-01T12:00:00Z",
+		"go_version": "unknown"
+	}`))
+}
+
+func TestIndexGolden(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	st := store.New()
+	if _, err := SeedSampleData(st, now); err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(Config{}, Deps{Store: st, Clock: clock.Fixed(now), Env: env.Map{"APP_VERSION": "1.0.0"}})
+
+	rr := httptestutil.Get(h, "/")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	golden.Assert(t, "index.html", rr.Body.Bytes())
+	httptestutil.AssertHeader(t, rr, "Content-Language", "en")
+}
+
+func TestIndexLocalized(t *testing.T) {
+	st := store.New()
+	if _, err := SeedSampleData(st, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(Config{}, Deps{Store: st, Env: env.Map{"APP_VERSION": "1.0.0"}})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Language", "de-AT, de;q=0.9, en;q=0.5")
+	rr := httptestutil.Do(h, req)
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertHeader(t, rr, "Content-Language", "de")
+	httptestutil.AssertHeader(t, rr, "Vary", "Accept-Language, Cookie")
+	httptestutil.AssertContains(t, rr, `<html lang="de"`, "Neueste Attestierungen", ">Zertifikat</a>", "Version: 1.0.0 | Gebaut mit Tekton Chains")
+
+	// Rows are cached per language.
+	rr = httptestutil.Get(h, "/")
+	httptestutil.AssertHeader(t, rr, "Content-Language", "en")
+	httptestutil.AssertContains(t, rr, "Recent Attestations", ">certificate</a>")
+}
+
+func TestThemes(t *testing.T) {
+	h := NewServer(Config{}, Deps{Env: env.Map{}})
+
+	rr := httptestutil.Get(h, "/")
+	httptestutil.AssertContains(t, rr, `data-theme="system"`, `<link rel="stylesheet" href="/static/print.css" media="print">`, `<strong>System</strong>`, `<a href="?theme=dark">Dark</a>`)
+	if c := rr.Result().Cookies(); len(c) != 0 {
+		t.Errorf("cookies = %v without a theme parameter", c)
+	}
+
+	rr = httptestutil.Get(h, "/?theme=dark")
+	httptestutil.AssertContains(t, rr, `data-theme="dark"`, `<strong>Dark</strong>`)
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != themeCookie || cookies[0].Value != "dark" {
+		t.Fatalf("cookies = %v, want the theme remembered", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	httptestutil.AssertContains(t, httptestutil.Do(h, req), `data-theme="dark"`)
+	req = httptest.NewRequest(http.MethodGet, "/?theme=sepia", nil)
+	req.AddCookie(cookies[0])
+	httptestutil.AssertContains(t, httptestutil.Do(h, req), `data-theme="dark"`)
+
+	rr = httptestutil.Get(h, "/static/print.css")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	httptestutil.AssertContains(t, rr, "@page")
+}
+
+func TestFragments(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "templates"), 0o755)
+	os.MkdirAll(filepath.Join(dir, "static"), 0o755)
+	page := filepath.Join(dir, "templates", "index.html")
+	os.WriteFile(filepath.Join(dir, "templates", "fragments.html"), []byte(`{{define "fragment:nav"}}<nav>{{"a&b"}}</nav>{{end}}`), 0o644)
+	h := NewServer(Config{Dev: true, WebDir: dir}, Deps{Logger: log.New(io.Discard, "", 0)})
+
+	os.WriteFile(page, []byte(`{{fragment "nav"}} v{{.Version}}`), 0o644)
+	rr := httptestutil.Get(h, "/")
+	httptestutil.AssertStatus(t, rr, http.StatusOK)
+	if got := rr.Body.String(); got != "<nav>a&amp;b</nav> v1.0.0" {
+		t.Errorf("page = %q, want the fragment included unescaped", got)
+	}
+
+	os.WriteFile(page, []byte(`{{fragment "missing"}}`), 0o644)
+	httptestutil.AssertStatus(t, httptestutil.Get(h, "/"), http.StatusInternalServerError)
+}
+
+func BenchmarkHealth(b *testing.B) {
+	h := NewServer(Config{}, Deps{Env: env.Map{}})
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func BenchmarkIndex(b *testing.B) {
+	st := store.New()
+	if _, err := SeedSampleData(st, time.Now()); err != nil {
+		b.Fatal(err)
+	}
+	h := NewServer(Config{}, Deps{Store: st, Env: env.Map{}})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
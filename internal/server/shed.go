@@ -0,0 +1,76 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// probePaths are never shed: a pod that fails its probes while busy would
+// be restarted, turning overload into an outage, and metrics scraped and
+// the status uptime monitors poll during overload are the ones operators
+// need most.
+var probePaths = map[string]bool{
+	"/health":      true,
+	"/ready":       true,
+	"/metrics":     true,
+	"/status.json": true,
+}
+
+// shedder admits a bounded number of requests at once. Requests over the
+// limit queue for a slot for at most maxWait and are then rejected with
+// 503 and a Retry-After header, so a burst of scans fails fast instead of
+// piling up behind slow verifications.
+type shedder struct {
+	slots   chan struct{}
+	maxWait time.Duration
+	logger  *log.Logger
+}
+
+func newShedder(maxInFlight int, maxWait time.Duration, logger *log.Logger) *shedder {
+	return &shedder{slots: make(chan struct{}, maxInFlight), maxWait: maxWait, logger: logger}
+}
+
+// admit waits for a slot and returns the function that releases it, or
+// false when none freed up within maxWait or the client went away.
+func (s *shedder) admit(r *http.Request) (release func(), ok bool) {
+	release = func() { <-s.slots }
+	select {
+	case s.slots <- struct{}{}:
+		return release, true
+	default:
+	}
+	if s.maxWait <= 0 {
+		return nil, false
+	}
+	timer := time.NewTimer(s.maxWait)
+	defer timer.Stop()
+	select {
+	case s.slots <- struct{}{}:
+		return release, true
+	case <-timer.C:
+		return nil, false
+	case <-r.Context().Done():
+		return nil, false
+	}
+}
+
+func (s *shedder) wrap(next http.Handler) http.Handler {
+	retryAfter := strconv.Itoa(max(1, int(s.maxWait.Round(time.Second)/time.Second)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if probePaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		release, ok := s.admit(r)
+		if !ok {
+			s.logger.Printf("shedding %s %s: %d requests in flight", r.Method, r.URL.Path, cap(s.slots))
+			w.Header().Set("Retry-After", retryAfter)
+			http.Error(w, "server is overloaded, retry later", http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
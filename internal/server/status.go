@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/status"
+)
+
+// Prefixes of the checks recorded in the status history.
+const (
+	selfCheckPrefix  = "self:"
+	watchCheckPrefix = "watch:"
+)
+
+// statusHistory is the response of GET /api/v1/status/history.
+type statusHistory struct {
+	Checks      []status.Check      `json:"checks"`
+	Transitions []status.Transition `json:"transitions"`
+}
+
+// flappingChecks counts the checks flapping now.
+func (s *server) flappingChecks() int {
+	n := 0
+	for _, c := range s.history.Checks(s.clock.Now()) {
+		if c.Flapping {
+			n++
+		}
+	}
+	return n
+}
+
+// statusHistoryHandler serves GET /api/v1/status/history: the status of
+// self-verification and of each watched tag, damped while flapping, and
+// their transitions, newest first. The check parameter selects one check.
+func (s *server) statusHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("check")
+	checks := []status.Check{}
+	for _, c := range s.history.Checks(s.clock.Now()) {
+		if name == "" || c.Name == name {
+			checks = append(checks, c)
+		}
+	}
+	writeJSON(w, http.StatusOK, statusHistory{Checks: checks, Transitions: s.history.Transitions(name)})
+}
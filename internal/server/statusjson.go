@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// statusMaxAge is how long caches and monitors may reuse /status.json.
+const statusMaxAge = 10 * time.Second
+
+// Overall statuses reported by /status.json.
+const (
+	statusOK          = "ok"
+	statusDegraded    = "degraded"
+	statusMaintenance = "maintenance"
+)
+
+// StatusJSON is the summary served at /status.json for external uptime
+// monitors.
+type StatusJSON struct {
+	// Status is "ok"; "degraded" while faults are injected or the last
+	// verification of the server's own image failed; or "maintenance".
+	Status  string `json:"status"`
+	Version string `json:"version"`
+	// Digest is the digest of the server's own image, once verifying it
+	// has resolved it.
+	Digest string `json:"digest,omitempty"`
+	// Reason explains maintenance.
+	Reason           string            `json:"reason,omitempty"`
+	LastVerification *LastVerification `json:"lastVerification,omitempty"`
+}
+
+// LastVerification is the latest verification of the server's own image.
+type LastVerification struct {
+	Image    string    `json:"image"`
+	At       time.Time `json:"at"`
+	Verified bool      `json:"verified"`
+	// LastVerified is when the image last verified, if it ever did.
+	LastVerified *time.Time `json:"lastVerified,omitempty"`
+}
+
+// statusJSONHandler serves GET /status.json without authentication. The
+// body holds no timestamp of its own, so it only changes with the status:
+// responses carry an ETag and may be cached for statusMaxAge, and monitors
+// polling with If-None-Match get 304 while nothing changes.
+func (s *server) statusJSONHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := json.Marshal(s.statusJSON())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(statusMaxAge.Seconds())))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(append(body, '\n')))
+}
+
+func (s *server) statusJSON() StatusJSON {
+	st := StatusJSON{Status: statusOK, Version: s.getenv("APP_VERSION", "1.0.0")}
+	if sv := s.self; sv != nil {
+		sv.mu.Lock()
+		st.Digest = sv.digest
+		if !sv.lastAttempt.IsZero() {
+			last := &LastVerification{Image: sv.ref.String(), At: sv.lastAttempt, Verified: sv.verified}
+			if !sv.lastSuccess.IsZero() {
+				t := sv.lastSuccess
+				last.LastVerified = &t
+			}
+			st.LastVerification = last
+		}
+		sv.mu.Unlock()
+	}
+	switch m := s.maintenance.get(); {
+	case m.Enabled:
+		st.Status, st.Reason = statusMaintenance, m.Reason
+	case s.faults.Get().Active(), st.LastVerification != nil && !st.LastVerification.Verified:
+		st.Status = statusDegraded
+	}
+	return st
+}
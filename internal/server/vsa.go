@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cosign"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// vsaVerifierID identifies the server as the verifier of the VSAs it
+// signs.
+const vsaVerifierID = "https://github.com/waveywaves/tekton-slsa-demo/verify"
+
+// vsaPolicyParams are the verify parameters that make up the policy a VSA
+// names.
+var vsaPolicyParams = []string{"identity", "issuer", "requireTlog", "annotation"}
+
+// writeVSA replies with res summarised as a verification summary
+// attestation in a DSSE envelope signed by the server's signer. Its policy
+// URI is the verifier ID with the parameters the image was verified
+// against.
+func (s *server) writeVSA(w http.ResponseWriter, res *verify.Result, q url.Values) {
+	policy := url.Values{}
+	for _, k := range vsaPolicyParams {
+		if v, ok := q[k]; ok {
+			policy[k] = v
+		}
+	}
+	policyURI := vsaVerifierID
+	if len(policy) > 0 {
+		policyURI += "?" + policy.Encode()
+	}
+	stmt, err := res.VSA(vsaVerifierID, policyURI, s.clock.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	payload, err := json.Marshal(stmt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	env, err := signing.Sign(s.signer, attestation.PayloadType, payload)
+	if err != nil {
+		s.logger.Printf("Signing the VSA of %s with the %s backend: %v", res.Image, s.signer.Name(), err)
+		http.Error(w, "signing the VSA failed", http.StatusInternalServerError)
+		return
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.stats.vsasIssued.Inc()
+	w.Header().Set("Content-Type", cosign.MediaTypeDSSE)
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+	"github.com/waveywaves/tekton-slsa-demo/internal/watch"
+)
+
+// defaultWatchInterval is how often watched images are polled when
+// Config.WatchInterval is zero.
+const defaultWatchInterval = 5 * time.Minute
+
+// WatchTarget is an image the server monitors for new digests.
+type WatchTarget struct {
+	// Image is the tag to watch, or the repository when Tags is set.
+	Image string
+	// Tags is a pattern such as "v*" selecting every matching tag of the
+	// repository, including tags pushed later.
+	Tags string
+	// Identity, Issuer, RequireTlog and Annotations are what new digests
+	// must satisfy, as in /api/v1/verify.
+	Identity    string
+	Issuer      string
+	RequireTlog bool
+	Annotations map[string]string
+}
+
+// watchTargets converts the configured targets for the monitor.
+func watchTargets(list []WatchTarget) ([]watch.Target, error) {
+	targets := make([]watch.Target, 0, len(list))
+	for _, w := range list {
+		ref, err := oci.ParseReference(w.Image)
+		if err != nil {
+			return nil, err
+		}
+		if ref.Digest != "" {
+			return nil, fmt.Errorf("watching %s: a digest never changes, watch a tag instead", w.Image)
+		}
+		if _, err := path.Match(w.Tags, ""); err != nil {
+			return nil, fmt.Errorf("watching %s: invalid tag pattern %q", w.Image, w.Tags)
+		}
+		targets = append(targets, watch.Target{
+			Image:   ref,
+			Tags:    w.Tags,
+			Options: verify.Options{Identity: w.Identity, Issuer: w.Issuer, RequireTlog: w.RequireTlog, Annotations: w.Annotations},
+		})
+	}
+	return targets, nil
+}
+
+// startWatch starts polling the watch list in the background, with
+// metrics for alerting on new digests that fail verification. An invalid
+// watch list is logged and leaves the watch off.
+func (s *server) startWatch() {
+	targets, err := watchTargets(s.cfg.Watch)
+	if err != nil {
+		s.logger.Printf("Watch list disabled: %v", err)
+		return
+	}
+	verifyDigest := func(ctx context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+		res, err := s.verifyImage(ctx, ref, opts)
+		if err != nil {
+			s.countFailure(failure.CodeOf(err))
+			s.logVerification(ref, nil, err)
+			return nil, err
+		}
+		res = s.applyDenylist(res)
+		s.countResult(res)
+		s.checkReplay(res)
+		s.checkPins(res, true)
+		s.logVerification(ref, res, nil)
+		return res, nil
+	}
+	s.watch = watch.New(targets, s.registry, verifyDigest, s.clock)
+	if s.shard != nil {
+		s.watch.Owns = s.shard.Owns
+	}
+	s.metrics.NewGaugeFunc("watch_unverified_images", "Watched tags whose current digest did not verify.",
+		func() float64 { return float64(s.watch.Unverified()) })
+
+	interval := s.cfg.WatchInterval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if !s.maintenance.active() {
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				s.pollWatch(ctx)
+				cancel()
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// pollWatch polls the watch list once, logging each new digest, and
+// records whether each watched tag verifies in the status history.
+func (s *server) pollWatch(ctx context.Context) {
+	fresh, err := s.watch.Poll(ctx)
+	if err != nil {
+		s.logger.Printf("Watch: %v", err)
+	}
+	now := s.clock.Now()
+	for _, rec := range s.watch.Status().Current {
+		c, changed := s.history.Record(watchCheckPrefix+rec.Image, rec.Verified, now)
+		if changed && c.Flapping {
+			s.logger.Printf("Watch: %s is flapping between verified and unverified digests: %d changes recently", rec.Image, c.Changes)
+		}
+	}
+	for _, rec := range fresh {
+		s.stats.watchDigests.Inc()
+		switch {
+		case rec.Error != "":
+			s.logger.Printf("Watch: %s is now %s, which could not be verified: %s%s", rec.Image, rec.Digest, rec.Error, codeSuffix(rec.Code))
+		case rec.Verified:
+			s.logger.Printf("Watch: %s is now %s, verified", rec.Image, rec.Digest)
+		default:
+			s.logger.Printf("Watch: %s is now %s, which FAILED verification%s", rec.Image, rec.Digest, codeSuffix(rec.Code))
+		}
+	}
+}
+
+// watchHandler serves GET /api/v1/watch: the digest each watched tag
+// points at with its verification, and the digests seen most recently.
+func (s *server) watchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.watch == nil {
+		http.Error(w, "the watch list is not configured", http.StatusNotImplemented)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.watch.Status())
+}
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cache"
+	"github.com/waveywaves/tekton-slsa-demo/internal/i18n"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+)
+
+//go:embed web
+var embeddedWeb embed.FS
+
+// site holds the HTML templates and static assets. Production serves them
+// from the binary; development mode reads them from disk and re-parses the
+// templates on every request so edits show up on reload. Pages are
+// rendered in the language negotiated from the request's Accept-Language
+// header, with the messages of its catalog in the i18n package.
+type site struct {
+	files  fs.FS
+	reload bool
+
+	// rowBytes bounds the cache of rendered attestation rows and pressure
+	// reports when it should shrink; see NewServer.
+	rowBytes int64
+	pressure func() bool
+
+	once  sync.Once
+	tmpls map[pageKey]*template.Template
+	err   error
+}
+
+func embeddedSite() *site {
+	files, err := fs.Sub(embeddedWeb, "web")
+	if err != nil {
+		panic(err)
+	}
+	return &site{files: files}
+}
+
+// diskSite serves the site from dir, e.g. internal/server/web in a checkout.
+func diskSite(dir string) *site {
+	return &site{files: os.DirFS(dir), reload: true}
+}
+
+var templateFuncs = template.FuncMap{
+	"predicateName": attestation.PredicateName,
+	"isProvenance":  attestation.IsProvenance,
+	"sourceLinks":   sourceLinks,
+}
+
+// localeFuncs returns the funcs that translate a page into the language of
+// l: t formats a message, escaping its arguments, and lang is the
+// language's tag.
+func localeFuncs(l *i18n.Localizer) template.FuncMap {
+	return template.FuncMap{
+		"t": func(key string, args ...any) template.HTML {
+			for i, arg := range args {
+				args[i] = template.HTMLEscapeString(fmt.Sprint(arg))
+			}
+			return template.HTML(l.T(key, args...))
+		},
+		"lang": func() string { return l.Lang },
+	}
+}
+
+// fragmentPrefix marks templates that do not depend on the request. They
+// are rendered once, when the templates are parsed, and pages include the
+// result with {{fragment "name"}}.
+const fragmentPrefix = "fragment:"
+
+// Themes of the pages: system follows the browser's color scheme.
+const (
+	themeSystem = "system"
+	themeLight  = "light"
+	themeDark   = "dark"
+)
+
+var themes = []string{themeSystem, themeLight, themeDark}
+
+// themeCookie remembers the theme a ?theme= query parameter chose.
+const themeCookie = "theme"
+
+// themeFuncs returns the funcs of pages in the given theme: theme is its
+// name, set as the data-theme attribute the stylesheet keys on.
+func themeFuncs(theme string) template.FuncMap {
+	return template.FuncMap{
+		"theme":  func() string { return theme },
+		"themes": func() []string { return themes },
+	}
+}
+
+func validTheme(v string) bool {
+	for _, t := range themes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// pageTheme returns the theme r asks for with the theme query parameter,
+// which it remembers in a cookie, or with that cookie, or themeSystem.
+func pageTheme(w http.ResponseWriter, r *http.Request) string {
+	if v := r.URL.Query().Get("theme"); validTheme(v) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     themeCookie,
+			Value:    v,
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return v
+	}
+	if c, err := r.Cookie(themeCookie); err == nil && validTheme(c.Value) {
+		return c.Value
+	}
+	return themeSystem
+}
+
+// pageKey selects the templates of a language and theme.
+type pageKey struct {
+	lang, theme string
+}
+
+// templates returns the templates of each language and theme.
+func (s *site) templates() (map[pageKey]*template.Template, error) {
+	if s.reload {
+		return s.parse()
+	}
+	s.once.Do(func() { s.tmpls, s.err = s.parse() })
+	return s.tmpls, s.err
+}
+
+// parse parses the templates once and clones them for each language and
+// theme, with the funcs of those.
+func (s *site) parse() (map[pageKey]*template.Template, error) {
+	base, err := template.New("").Funcs(templateFuncs).Funcs(localeFuncs(i18n.For(i18n.Default))).Funcs(themeFuncs(themeSystem)).Funcs(template.FuncMap{
+		"fragment":       func(string) (template.HTML, error) { return "", nil },
+		"attestationRow": func(*store.Attestation) (template.HTML, error) { return "", nil },
+	}).ParseFS(s.files, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	// rows caches the attestation-row template per language and
+	// attestation ID for as long as these templates are in use; stored
+	// attestations never change.
+	rows := cache.New(s.rowBytes, func(key string, html template.HTML) int64 {
+		return int64(len(key) + len(html))
+	})
+	rows.Pressure = s.pressure
+
+	tmpls := make(map[pageKey]*template.Template)
+	for _, lang := range i18n.Languages() {
+		for _, theme := range themes {
+			tmpl, err := clonePage(base, rows, lang, theme)
+			if err != nil {
+				return nil, err
+			}
+			tmpls[pageKey{lang, theme}] = tmpl
+		}
+	}
+	return tmpls, nil
+}
+
+// clonePage clones base for lang and theme and renders its fragments.
+// Attestation rows depend on the language only and are cached in rows.
+func clonePage(base *template.Template, rows *cache.Cache[string, template.HTML], lang, theme string) (*template.Template, error) {
+	tmpl, err := base.Clone()
+	if err != nil {
+		return nil, err
+	}
+	fragments := make(map[string]template.HTML)
+	tmpl.Funcs(localeFuncs(i18n.For(lang))).Funcs(themeFuncs(theme)).Funcs(template.FuncMap{
+		"fragment": func(name string) (template.HTML, error) {
+			html, ok := fragments[name]
+			if !ok {
+				return "", fmt.Errorf("no fragment %q", name)
+			}
+			return html, nil
+		},
+		"attestationRow": func(a *store.Attestation) (template.HTML, error) {
+			key := lang + "/" + a.ID
+			if html, ok := rows.Get(key); ok {
+				return html, nil
+			}
+			var buf bytes.Buffer
+			if err := tmpl.ExecuteTemplate(&buf, "attestation-row", a); err != nil {
+				return "", err
+			}
+			html := template.HTML(buf.String())
+			rows.Add(key, html)
+			return html, nil
+		},
+	})
+	var buf bytes.Buffer
+	for _, t := range tmpl.Templates() {
+		name, ok := strings.CutPrefix(t.Name(), fragmentPrefix)
+		if !ok {
+			continue
+		}
+		buf.Reset()
+		if err := t.Execute(&buf, nil); err != nil {
+			return nil, err
+		}
+		fragments[name] = template.HTML(buf.String())
+	}
+	return tmpl, nil
+}
+
+// render executes the named template in the language r accepts and the
+// theme it chose into a buffer first, so template errors produce a 500 instead of a truncated
+// page.
+func (s *site) render(w http.ResponseWriter, r *http.Request, name string, data any) {
+	tmpls, err := s.templates()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	lang := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	theme := pageTheme(w, r)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := tmpls[pageKey{lang, theme}].ExecuteTemplate(buf, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language, Cookie")
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// static serves the files under static/.
+func (s *site) static() http.Handler {
+	files, err := fs.Sub(s.files, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/static/", http.FileServer(http.FS(files)))
+}
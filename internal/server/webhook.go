@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/replay"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+	"github.com/waveywaves/tekton-slsa-demo/internal/webhook"
+)
+
+const (
+	// maxWebhookBytes bounds the size of a registry notification.
+	maxWebhookBytes = 1 << 20
+	// pushQueueSize bounds the pushed images waiting for verification;
+	// notifications beyond it are rejected for the registry to retry.
+	pushQueueSize = 64
+	// maxPushRecords bounds the pushes GET /webhooks/registry reports.
+	maxPushRecords = 100
+	// pushVerifyTimeout bounds the verification of one pushed image.
+	pushVerifyTimeout = 2 * time.Minute
+)
+
+// WebhookRepository is a repository whose pushes the registry webhook
+// verifies, and what they must satisfy.
+type WebhookRepository struct {
+	// Repository is the repository name, such as "ghcr.io/org/app".
+	Repository string
+	// Identity and Issuer are required, as pushes are verified against
+	// them rather than against any signer the trust root accepts.
+	// RequireTlog and Annotations are as in /api/v1/verify.
+	Identity    string
+	Issuer      string
+	RequireTlog bool
+	Annotations map[string]string
+}
+
+// webhookPolicies maps the repositories in list to the options their
+// pushes are verified with. Entries without an identity and an issuer are
+// left out, so pushes to their repositories are refused.
+func webhookPolicies(list []WebhookRepository) (map[string]verify.Options, error) {
+	policies := make(map[string]verify.Options, len(list))
+	var errs []error
+	for _, w := range list {
+		ref, err := oci.ParseReference(w.Repository)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("webhook repository %q: %w", w.Repository, err))
+			continue
+		}
+		// Parsing defaults the tag, so one is only named when it ends w.
+		if ref.Digest != "" || strings.HasSuffix(w.Repository, ":"+ref.Tag) {
+			errs = append(errs, fmt.Errorf("webhook repository %q: name a repository, without a tag or digest", w.Repository))
+			continue
+		}
+		if w.Identity == "" || w.Issuer == "" {
+			errs = append(errs, fmt.Errorf("webhook repository %s: an identity and an issuer are required", w.Repository))
+			continue
+		}
+		policies[ref.Name()] = verify.Options{Identity: w.Identity, Issuer: w.Issuer, RequireTlog: w.RequireTlog, Annotations: w.Annotations}
+	}
+	return policies, errors.Join(errs...)
+}
+
+// pushRecord is a pushed image and, once verified, the outcome.
+type pushRecord struct {
+	ref        oci.Reference
+	Image      string         `json:"image"`
+	Digest     string         `json:"digest"`
+	ReceivedAt time.Time      `json:"receivedAt"`
+	VerifiedAt *time.Time     `json:"verifiedAt,omitempty"`
+	Verified   bool           `json:"verified"`
+	Result     *verify.Result `json:"result,omitempty"`
+	Replay     *replay.Report `json:"replay,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	// Code classifies Error, or the failure of an image that did not
+	// verify.
+	Code failure.Code `json:"code,omitempty"`
+}
+
+// pushQueue hands pushed images to the verification worker and keeps the
+// most recent outcomes.
+type pushQueue struct {
+	pending chan *pushRecord
+	// policies are the options pushes are verified with, by repository.
+	policies map[string]verify.Options
+
+	mu     sync.Mutex
+	recent []*pushRecord
+}
+
+// pushList is the response of GET /webhooks/registry.
+type pushList struct {
+	Count  int          `json:"count"`
+	Pushes []pushRecord `json:"pushes"`
+}
+
+// webhookAccepted is the response to a registry notification.
+type webhookAccepted struct {
+	Format string   `json:"format"`
+	Queued []string `json:"queued"`
+}
+
+// startPushQueue starts the worker verifying images pushed to registries
+// that notify /webhooks/registry. In maintenance pushes stay queued.
+func (s *server) startPushQueue() {
+	policies, err := webhookPolicies(s.cfg.WebhookRepositories)
+	if err != nil {
+		s.logger.Printf("Webhook: %v", err)
+	}
+	s.pushes = &pushQueue{pending: make(chan *pushRecord, pushQueueSize), policies: policies}
+	go func() {
+		for rec := range s.pushes.pending {
+			<-s.maintenance.wait()
+			s.verifyPush(rec)
+		}
+	}()
+}
+
+// verifyPush verifies a pushed image by digest through the result cache,
+// so /api/v1/verify answers for the digest from the cache afterwards.
+// Images pushed to a repository without a policy are not verified: any
+// signer the trust root accepts would do otherwise.
+func (s *server) verifyPush(rec *pushRecord) {
+	var res *verify.Result
+	opts, ok := s.pushes.policies[rec.ref.Name()]
+	err := failure.New(failure.PolicyDenied, "no identity and issuer are configured for %s in the webhook repositories", rec.ref.Name())
+	if ok {
+		ctx, cancel := context.WithTimeout(context.Background(), pushVerifyTimeout)
+		res, err = s.cachedVerify(ctx, rec.ref, opts)
+		cancel()
+	}
+	var rep *replay.Report
+	if err == nil {
+		rep = s.checkReplay(res)
+		s.checkPins(res, true)
+	}
+	now := s.clock.Now()
+
+	s.pushes.mu.Lock()
+	defer s.pushes.mu.Unlock()
+	rec.VerifiedAt, rec.Replay = &now, rep
+	switch {
+	case err != nil:
+		rec.Error, rec.Code = err.Error(), failure.CodeOf(err)
+		s.logger.Printf("Webhook: %s@%s could not be verified: %v%s", rec.Image, rec.Digest, err, codeSuffix(rec.Code))
+	case res.Verified:
+		rec.Verified, rec.Result = true, res
+		s.logger.Printf("Webhook: %s@%s verified", rec.Image, rec.Digest)
+	default:
+		rec.Result, rec.Code = res, res.Code
+		s.logger.Printf("Webhook: %s@%s FAILED verification%s", rec.Image, rec.Digest, codeSuffix(rec.Code))
+	}
+}
+
+// enqueue records a pushed image and queues it for verification,
+// reporting false when the queue is full.
+func (q *pushQueue) enqueue(rec *pushRecord) bool {
+	select {
+	case q.pending <- rec:
+	default:
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.recent = append(q.recent, rec)
+	if len(q.recent) > maxPushRecords {
+		q.recent = q.recent[len(q.recent)-maxPushRecords:]
+	}
+	return true
+}
+
+// list returns the recorded pushes, newest first.
+func (q *pushQueue) list() []pushRecord {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := make([]pushRecord, 0, len(q.recent))
+	for i := len(q.recent) - 1; i >= 0; i-- {
+		list = append(list, *q.recent[i])
+	}
+	return list
+}
+
+// registryWebhookHandler serves /webhooks/registry. POST accepts push
+// notifications from Docker Distribution, Harbor and GitHub (GHCR),
+// authenticated with the webhook secret, and queues each pushed image for
+// verification; GET lists the recent pushes and their outcomes.
+func (s *server) registryWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet:
+		if s.pushes == nil {
+			writeJSON(w, http.StatusOK, pushList{Pushes: []pushRecord{}})
+			return
+		}
+		pushes := s.pushes.list()
+		writeJSON(w, http.StatusOK, pushList{Count: len(pushes), Pushes: pushes})
+		return
+	case r.Method != http.MethodPost:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	case s.verifyImage == nil:
+		http.Error(w, "verification is not configured", http.StatusNotImplemented)
+		return
+	case s.pushes == nil:
+		http.Error(w, "this endpoint is disabled: no webhook secret configured", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+	if err != nil {
+		http.Error(w, "reading notification: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.cfg.Dev && !webhook.Authorized(r.Header, body, s.cfg.WebhookSecret) {
+		http.Error(w, "missing or invalid webhook secret", http.StatusUnauthorized)
+		return
+	}
+	refs, format, err := webhook.Parse(r.Header, body)
+	if errors.Is(err, webhook.ErrUnknownFormat) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	accepted := webhookAccepted{Format: format, Queued: []string{}}
+	for _, ref := range refs {
+		image := ref.Name()
+		if ref.Tag != "" {
+			image += ":" + ref.Tag
+		}
+		// Verify by digest alone, as /api/v1/verify?image=<name>@<digest>
+		// would, to share its cache entry.
+		pinned := ref
+		pinned.Tag = ""
+		rec := &pushRecord{ref: pinned, Image: image, Digest: ref.Digest, ReceivedAt: s.clock.Now()}
+		if !s.pushes.enqueue(rec) {
+			s.logger.Printf("Webhook: verification queue full, rejecting %s", ref)
+			w.Header().Set("Retry-After", strconv.Itoa(60))
+			http.Error(w, "verification queue full", http.StatusServiceUnavailable)
+			return
+		}
+		s.stats.webhookPushes.Inc()
+		accepted.Queued = append(accepted.Queued, ref.String())
+	}
+	writeJSON(w, http.StatusAccepted, accepted)
+}
@@ -0,0 +1,242 @@
+// Package shard splits background verification between the replicas of the
+// server by consistent hashing on image digests, so each digest is verified
+// by one replica and registries and Rekor are not asked the same questions
+// once per replica.
+//
+// Replicas find each other through leases they renew in a directory shared
+// between them, such as a ReadWriteMany volume:
+//
+//	s, err := shard.New("/var/lib/slsa-demo/replicas", hostname, shard.DefaultTTL, clock.System{})
+//	go s.Run(ctx, log.Printf)
+//	if s.Owns(digest) { ... }
+package shard
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/clock"
+	"github.com/waveywaves/tekton-slsa-demo/internal/fsutil"
+)
+
+// DefaultTTL is how long a lease lasts unless renewed. Replicas renew
+// theirs three times per TTL, so one that stops is dropped within a TTL.
+const DefaultTTL = 30 * time.Second
+
+// vnodes is the number of points each replica gets on the ring, which
+// evens out the share of digests each owns.
+const vnodes = 64
+
+// leaseSuffix ends the name of every lease file in the directory.
+const leaseSuffix = ".lease"
+
+// validID keeps replica IDs usable as file names.
+var validID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Ring assigns keys to members by consistent hashing: adding or removing a
+// member only moves the keys it gains or loses.
+type Ring struct {
+	points []uint64
+	owners map[uint64]string
+}
+
+// NewRing returns a ring of members. Duplicates are ignored.
+func NewRing(members []string) *Ring {
+	r := &Ring{owners: map[uint64]string{}}
+	for _, m := range members {
+		for i := 0; i < vnodes; i++ {
+			p := hash(m + "#" + strconv.Itoa(i))
+			if _, ok := r.owners[p]; ok {
+				continue
+			}
+			r.owners[p] = m
+			r.points = append(r.points, p)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// Owner returns the member owning key, or "" for an empty ring.
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+func hash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// lease is the content of a lease file.
+type lease struct {
+	Replica string    `json:"replica"`
+	Expires time.Time `json:"expires"`
+}
+
+// Sharder is one replica's view of the replicas sharing the work. A nil
+// Sharder is a single replica owning every key.
+type Sharder struct {
+	dir   string
+	id    string
+	ttl   time.Duration
+	clock clock.Clock
+
+	mu      sync.Mutex
+	members []string
+	ring    *Ring
+}
+
+// New joins the replicas keeping leases in dir as id, taking its lease
+// and reading the others'.
+func New(dir, id string, ttl time.Duration, c clock.Clock) (*Sharder, error) {
+	if !validID.MatchString(id) {
+		return nil, fmt.Errorf("shard: invalid replica ID %q", id)
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if c == nil {
+		c = clock.System{}
+	}
+	s := &Sharder{dir: dir, id: id, ttl: ttl, clock: c}
+	if err := s.Refresh(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ID returns the replica's ID.
+func (s *Sharder) ID() string {
+	return s.id
+}
+
+// Refresh renews the replica's lease and rebuilds the ring from the
+// leases that have not expired.
+func (s *Sharder) Refresh() error {
+	now := s.clock.Now()
+	if err := s.renew(now); err != nil {
+		return err
+	}
+	members, err := s.live(now)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.members, s.ring = members, NewRing(members)
+	s.mu.Unlock()
+	return nil
+}
+
+// renew writes the replica's lease, replacing the file atomically so
+// other replicas never read half of it.
+func (s *Sharder) renew(now time.Time) error {
+	data, err := json.Marshal(lease{Replica: s.id, Expires: now.Add(s.ttl)})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, s.id+leaseSuffix)
+	if err := fsutil.WriteFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("shard: %w", err)
+	}
+	return nil
+}
+
+// live lists the replicas holding a lease at now, always including this
+// one. Unreadable leases are skipped: a replica writing its first lease
+// is picked up on the next refresh.
+func (s *Sharder) live(now time.Time) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("shard: %w", err)
+	}
+	members := []string{s.id}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), leaseSuffix)
+		if !ok || id == s.id || e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		var l lease
+		if json.Unmarshal(data, &l) != nil || l.Replica != id || !now.Before(l.Expires) {
+			continue
+		}
+		members = append(members, id)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// Release gives up the replica's lease, so the others take over its keys
+// on their next refresh rather than when it expires.
+func (s *Sharder) Release() error {
+	err := os.Remove(filepath.Join(s.dir, s.id+leaseSuffix))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Run refreshes the ring three times per TTL until ctx is done, then
+// releases the lease. Refresh errors are passed to logf and the previous
+// ring is kept.
+func (s *Sharder) Run(ctx context.Context, logf func(format string, args ...any)) {
+	ticker := time.NewTicker(s.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Release(); err != nil {
+				logf("Sharding: releasing the lease of %s: %v", s.id, err)
+			}
+			return
+		case <-ticker.C:
+			if err := s.Refresh(); err != nil {
+				logf("Sharding: %v", err)
+			}
+		}
+	}
+}
+
+// Owns reports whether this replica is responsible for key, such as an
+// image digest.
+func (s *Sharder) Owns(key string) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ring.Owner(key) == s.id
+}
+
+// Members returns the IDs of the live replicas, sorted.
+func (s *Sharder) Members() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.members...)
+}
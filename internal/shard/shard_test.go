@@ -0,0 +1,106 @@
+package shard
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/clock"
+)
+
+func keys(n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("sha256:%064x", i)
+	}
+	return out
+}
+
+func TestRing(t *testing.T) {
+	if got := NewRing(nil).Owner("sha256:a"); got != "" {
+		t.Errorf("owner on an empty ring = %q", got)
+	}
+	three := NewRing([]string{"a", "b", "c"})
+	four := NewRing([]string{"a", "b", "c", "d"})
+	counts := map[string]int{}
+	moved := 0
+	for _, k := range keys(3000) {
+		owner := three.Owner(k)
+		counts[owner]++
+		if next := four.Owner(k); next != owner {
+			if next != "d" {
+				t.Fatalf("%s moved from %s to %s, not to the new member", k, owner, next)
+			}
+			moved++
+		}
+	}
+	for m, n := range counts {
+		if n < 600 || n > 1400 {
+			t.Errorf("%s owns %d of 3000 keys", m, n)
+		}
+	}
+	if moved < 400 || moved > 1200 {
+		t.Errorf("%d of 3000 keys moved to the fourth member", moved)
+	}
+}
+
+func TestSharder(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := clock.Func(func() time.Time { return now })
+	if _, err := New(dir, "../escape", 0, c); err == nil {
+		t.Error("New accepted a replica ID that is not a file name")
+	}
+	a, err := New(dir, "replica-0", 30*time.Second, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(dir, "replica-1", 30*time.Second, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"replica-0", "replica-1"}; !reflect.DeepEqual(a.Members(), want) || !reflect.DeepEqual(b.Members(), want) {
+		t.Fatalf("members %v and %v, want %v", a.Members(), b.Members(), want)
+	}
+	// Every digest is verified by exactly one replica.
+	for _, k := range keys(200) {
+		if a.Owns(k) == b.Owns(k) {
+			t.Fatalf("%s: owned by replica-0 %v, by replica-1 %v", k, a.Owns(k), b.Owns(k))
+		}
+	}
+
+	// A replica that stops renewing is dropped once its lease expires.
+	now = now.Add(20 * time.Second)
+	if err := a.Refresh(); err != nil || len(a.Members()) != 2 {
+		t.Fatalf("members before expiry %v, %v", a.Members(), err)
+	}
+	now = now.Add(20 * time.Second)
+	if err := a.Refresh(); err != nil || len(a.Members()) != 1 {
+		t.Fatalf("members after expiry %v, %v", a.Members(), err)
+	}
+	for _, k := range keys(200) {
+		if !a.Owns(k) {
+			t.Fatalf("the only live replica does not own %s", k)
+		}
+	}
+
+	// Releasing a lease hands its keys over at once.
+	if err := b.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Refresh(); err != nil || !reflect.DeepEqual(a.Members(), []string{"replica-0"}) {
+		t.Errorf("members after release %v, %v", a.Members(), err)
+	}
+
+	var single *Sharder
+	if !single.Owns("sha256:a") {
+		t.Error("a nil Sharder does not own every key")
+	}
+}
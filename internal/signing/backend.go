@@ -0,0 +1,121 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+)
+
+// Backends that Open can select.
+const (
+	BackendKey     = "key"
+	BackendKMS     = "kms"
+	BackendKeyless = "keyless"
+	BackendSPIFFE  = "spiffe"
+)
+
+// Backends lists every backend, in the order help text names them.
+var Backends = []string{BackendKey, BackendKMS, BackendKeyless, BackendSPIFFE}
+
+// Backend is a pluggable signer: whatever signs VSAs, scan attestations
+// and exported reports, whichever kind of key it holds.
+type Backend interface {
+	dsse.Signer
+	// Name is the kind of backend, one of Backends.
+	Name() string
+	// ChainPEM is the PEM certificate chain, leaf first, that must
+	// accompany the backend's signatures, or nil for bare keys.
+	ChainPEM() []byte
+}
+
+// Options select and configure a Backend.
+type Options struct {
+	// Backend is one of Backends; empty disables signing.
+	Backend string
+	// Key is the private key file of the key backend, read with LoadKey,
+	// or LoadPrivateKey when LoadKey is nil.
+	Key     string
+	LoadKey func(path string) (crypto.Signer, error)
+	// KMS is the key of the kms backend, as a URI such as
+	// hashivault://release.
+	KMS string
+	// FulcioURL and IdentityToken are the certificate authority and OIDC
+	// token of the keyless backend.
+	FulcioURL     string
+	IdentityToken string
+	// SVIDDir is the directory where the SPIFFE helper writes the X.509
+	// SVID of the spiffe backend.
+	SVIDDir string
+}
+
+// Open returns the backend opts select, or nil when they select none.
+func Open(ctx context.Context, opts Options) (Backend, error) {
+	switch opts.Backend {
+	case "":
+		return nil, nil
+	case BackendKey:
+		if opts.Key == "" {
+			return nil, errors.New("the key backend needs a private key")
+		}
+		load := opts.LoadKey
+		if load == nil {
+			load = LoadPrivateKey
+		}
+		key, err := load(opts.Key)
+		if err != nil {
+			return nil, fmt.Errorf("loading key: %w", err)
+		}
+		s, err := NewSigner(key)
+		if err != nil {
+			return nil, err
+		}
+		return KeyBackend(s), nil
+	case BackendKMS:
+		s, err := OpenKMS(ctx, opts.KMS)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case BackendKeyless:
+		s, err := NewKeylessSigner(ctx, opts.FulcioURL, opts.IdentityToken)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case BackendSPIFFE:
+		s, err := LoadSVID(opts.SVIDDir)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown signing backend %q: want key, kms, keyless or spiffe", opts.Backend)
+	}
+}
+
+// KeyBackend returns s as the key backend.
+func KeyBackend(s *Signer) Backend { return keyBackend{s} }
+
+type keyBackend struct{ *Signer }
+
+func (keyBackend) Name() string     { return BackendKey }
+func (keyBackend) ChainPEM() []byte { return nil }
+
+// Name returns BackendKeyless.
+func (k *KeylessSigner) Name() string { return BackendKeyless }
+
+// Sign wraps payload in a DSSE envelope signed by b, recording b's
+// certificate chain, if it has one, with the signature.
+func Sign(b Backend, payloadType string, payload []byte) (*dsse.Envelope, error) {
+	env, err := dsse.Sign(payloadType, payload, b)
+	if err != nil {
+		return nil, err
+	}
+	if chain := b.ChainPEM(); chain != nil {
+		env.Signatures[0].Cert = string(chain)
+	}
+	return env, nil
+}
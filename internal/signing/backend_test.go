@@ -0,0 +1,216 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+)
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func writeKey(t *testing.T, path string, key crypto.Signer) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// verifyEnvelope checks env's one signature against pub.
+func verifyEnvelope(t *testing.T, env *dsse.Envelope, pub crypto.PublicKey) {
+	t.Helper()
+	v, err := NewVerifier(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Verify(v); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+}
+
+func TestOpenKeyBackend(t *testing.T) {
+	key := newKey(t)
+	path := filepath.Join(t.TempDir(), "cosign.key")
+	writeKey(t, path, key)
+
+	b, err := Open(context.Background(), Options{Backend: BackendKey, Key: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Name() != BackendKey || b.ChainPEM() != nil {
+		t.Errorf("backend = %s with chain %q", b.Name(), b.ChainPEM())
+	}
+	env, err := Sign(b, "text/plain", []byte("report"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyEnvelope(t, env, key.Public())
+	if env.Signatures[0].Cert != "" {
+		t.Errorf("a bare key recorded a certificate")
+	}
+
+	if b, err := Open(context.Background(), Options{}); b != nil || err != nil {
+		t.Errorf("Open(no backend) = %v, %v", b, err)
+	}
+	if _, err := Open(context.Background(), Options{Backend: "hsm"}); err == nil || !strings.Contains(err.Error(), `unknown signing backend "hsm"`) {
+		t.Errorf("Open(hsm) = %v", err)
+	}
+	if _, err := Open(context.Background(), Options{Backend: BackendKMS, KMS: "awskms:///alias/release"}); err == nil || !strings.Contains(err.Error(), `unsupported KMS "awskms"`) {
+		t.Errorf("Open(awskms) = %v", err)
+	}
+}
+
+func TestVaultSigner(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tt := range map[string]struct {
+		key crypto.Signer
+		// algorithm is the signature_algorithm Sign must request.
+		algorithm string
+	}{
+		"ecdsa": {newKey(t), ""},
+		"rsa":   {rsaKey, "pkcs1v15"},
+	} {
+		pubPEM, err := MarshalPublicKey(tt.key.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Vault-Token") != "s.token" {
+				http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+				return
+			}
+			switch r.URL.Path {
+			case "/v1/transit/keys/release":
+				json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+					"latest_version": 2,
+					"keys":           map[string]any{"2": map[string]string{"public_key": string(pubPEM)}},
+				}})
+			case "/v1/transit/sign/release/sha2-256":
+				var req struct {
+					Input              string
+					KeyVersion         int    `json:"key_version"`
+					SignatureAlgorithm string `json:"signature_algorithm"`
+				}
+				json.NewDecoder(r.Body).Decode(&req)
+				if req.KeyVersion != 2 || req.SignatureAlgorithm != tt.algorithm {
+					t.Errorf("%s: signed with key version %d and algorithm %q", name, req.KeyVersion, req.SignatureAlgorithm)
+				}
+				data, _ := base64.StdEncoding.DecodeString(req.Input)
+				digest := sha256.Sum256(data)
+				sig, _ := tt.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+				json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"signature": "vault:v2:" + base64.StdEncoding.EncodeToString(sig)}})
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer vault.Close()
+
+		v, err := NewVaultSigner(context.Background(), vault.URL, "s.token", "release")
+		if err != nil {
+			t.Fatal(err)
+		}
+		env, err := Sign(v, "text/plain", []byte("report"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifyEnvelope(t, env, tt.key.Public())
+
+		if _, err := NewVaultSigner(context.Background(), vault.URL, "wrong", "release"); err == nil || !strings.Contains(err.Error(), "403") {
+			t.Errorf("%s: NewVaultSigner(wrong token) = %v", name, err)
+		}
+	}
+}
+
+// writeSVID writes an SVID for id with a new key to dir, as the SPIFFE
+// helper does, and returns its key.
+func writeSVID(t *testing.T, dir, id string, modTime time.Time) *ecdsa.PrivateKey {
+	t.Helper()
+	key := newKey(t)
+	u, _ := url.Parse(id)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{u},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, filepath.Join(dir, SVIDKeyFile), key)
+	cert := filepath.Join(dir, SVIDCertFile)
+	if err := os.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(cert, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSVIDSigner(t *testing.T) {
+	dir := t.TempDir()
+	const id = "spiffe://demo.example/ns/slsa/sa/server"
+	now := time.Now()
+	key := writeSVID(t, dir, id, now)
+
+	b, err := Open(context.Background(), Options{Backend: BackendSPIFFE, SVIDDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := b.(*SVIDSigner); s.ID() != id {
+		t.Errorf("ID() = %s", s.ID())
+	}
+	env, err := Sign(b, "text/plain", []byte("report"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyEnvelope(t, env, key.Public())
+	if certs, err := ParseCertificates([]byte(env.Signatures[0].Cert)); err != nil || certs[0].URIs[0].String() != id {
+		t.Errorf("recorded certificate = %v, %v", certs, err)
+	}
+
+	// The helper rotates the SVID.
+	rotated := writeSVID(t, dir, id, now.Add(time.Minute))
+	env, err = Sign(b, "text/plain", []byte("report"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyEnvelope(t, env, rotated.Public())
+
+	if _, err := LoadSVID(t.TempDir()); err == nil {
+		t.Error("loaded an SVID from an empty directory")
+	}
+}
@@ -0,0 +1,96 @@
+package signing
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+)
+
+// Fulcio certificate extension OIDs.
+var (
+	OIDIssuerV1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	OIDIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// CertificateIdentity returns the subject alternative name Fulcio bound the
+// certificate to and the OIDC issuer that vouched for it.
+func CertificateIdentity(cert *x509.Certificate) (san, issuer string) {
+	switch {
+	case len(cert.URIs) > 0:
+		san = cert.URIs[0].String()
+	case len(cert.EmailAddresses) > 0:
+		san = cert.EmailAddresses[0]
+	case len(cert.DNSNames) > 0:
+		san = cert.DNSNames[0]
+	}
+	return san, FulcioExtensions(cert).Issuer
+}
+
+// Extensions are the claims Fulcio copies from the identity token into a
+// certificate, describing the workload that signed.
+type Extensions struct {
+	Issuer              string `json:"issuer,omitempty"`
+	BuildSignerURI      string `json:"buildSignerURI,omitempty"`
+	BuildSignerDigest   string `json:"buildSignerDigest,omitempty"`
+	RunnerEnvironment   string `json:"runnerEnvironment,omitempty"`
+	SourceRepositoryURI string `json:"sourceRepositoryURI,omitempty"`
+	BuildConfigURI      string `json:"buildConfigURI,omitempty"`
+	RunInvocationURI    string `json:"runInvocationURI,omitempty"`
+	WorkflowName        string `json:"workflowName,omitempty"`
+	WorkflowRepository  string `json:"workflowRepository,omitempty"`
+	WorkflowRef         string `json:"workflowRef,omitempty"`
+	WorkflowSHA         string `json:"workflowSHA,omitempty"`
+	BuildTrigger        string `json:"buildTrigger,omitempty"`
+}
+
+// fulcioExtensions maps extension OIDs to fields. The deprecated v1
+// extensions hold raw strings and come first, so the DER-encoded v2
+// extensions replace them when a certificate carries both.
+var fulcioExtensions = []struct {
+	id    asn1.ObjectIdentifier
+	der   bool
+	field func(*Extensions) *string
+}{
+	{OIDIssuerV1, false, func(e *Extensions) *string { return &e.Issuer }},
+	{oidFulcio(2), false, func(e *Extensions) *string { return &e.BuildTrigger }},
+	{oidFulcio(3), false, func(e *Extensions) *string { return &e.WorkflowSHA }},
+	{oidFulcio(4), false, func(e *Extensions) *string { return &e.WorkflowName }},
+	{oidFulcio(5), false, func(e *Extensions) *string { return &e.WorkflowRepository }},
+	{oidFulcio(6), false, func(e *Extensions) *string { return &e.WorkflowRef }},
+	{OIDIssuerV2, true, func(e *Extensions) *string { return &e.Issuer }},
+	{oidFulcio(9), true, func(e *Extensions) *string { return &e.BuildSignerURI }},
+	{oidFulcio(10), true, func(e *Extensions) *string { return &e.BuildSignerDigest }},
+	{oidFulcio(11), true, func(e *Extensions) *string { return &e.RunnerEnvironment }},
+	{oidFulcio(12), true, func(e *Extensions) *string { return &e.SourceRepositoryURI }},
+	{oidFulcio(13), true, func(e *Extensions) *string { return &e.WorkflowSHA }},
+	{oidFulcio(14), true, func(e *Extensions) *string { return &e.WorkflowRef }},
+	{oidFulcio(18), true, func(e *Extensions) *string { return &e.BuildConfigURI }},
+	{oidFulcio(20), true, func(e *Extensions) *string { return &e.BuildTrigger }},
+	{oidFulcio(21), true, func(e *Extensions) *string { return &e.RunInvocationURI }},
+}
+
+func oidFulcio(n int) asn1.ObjectIdentifier {
+	return asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, n}
+}
+
+// FulcioExtensions decodes the Fulcio extensions of cert. Extensions that
+// are missing or malformed are left empty.
+func FulcioExtensions(cert *x509.Certificate) Extensions {
+	var e Extensions
+	for _, f := range fulcioExtensions {
+		for _, ext := range cert.Extensions {
+			if !ext.Id.Equal(f.id) {
+				continue
+			}
+			v := string(ext.Value)
+			if f.der {
+				if _, err := asn1.Unmarshal(ext.Value, &v); err != nil {
+					continue
+				}
+			}
+			if v != "" {
+				*f.field(&e) = v
+			}
+		}
+	}
+	return e
+}
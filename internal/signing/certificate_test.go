@@ -0,0 +1,67 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestFulcioExtensions(t *testing.T) {
+	der := func(s string) []byte {
+		b, err := asn1.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	san, _ := url.Parse("https://github.com/org/app/.github/workflows/release.yml@refs/tags/v1")
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{san},
+		ExtraExtensions: []pkix.Extension{
+			{Id: OIDIssuerV1, Value: []byte("https://token.actions.githubusercontent.com")},
+			{Id: oidFulcio(2), Value: []byte("push")},
+			{Id: oidFulcio(6), Value: []byte("refs/tags/v0")},
+			{Id: oidFulcio(14), Value: der("refs/tags/v1")},
+			{Id: oidFulcio(12), Value: der("https://github.com/org/app")},
+			{Id: oidFulcio(20), Value: []byte("not DER")},
+		},
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := FulcioExtensions(cert)
+	want := Extensions{
+		Issuer:              "https://token.actions.githubusercontent.com",
+		SourceRepositoryURI: "https://github.com/org/app",
+		// The v2 extension replaces the v1 one.
+		WorkflowRef: "refs/tags/v1",
+		// The malformed v2 extension leaves the v1 value in place.
+		BuildTrigger: "push",
+	}
+	if got != want {
+		t.Errorf("FulcioExtensions = %+v, want %+v", got, want)
+	}
+	if gotSAN, issuer := CertificateIdentity(cert); gotSAN != san.String() || issuer != want.Issuer {
+		t.Errorf("CertificateIdentity = %q, %q", gotSAN, issuer)
+	}
+}
@@ -0,0 +1,125 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PEM block types of cosign's password-encrypted private keys. Cosign
+// writes the Sigstore type and still reads the older cosign one.
+const (
+	EncryptedKeyPEMType       = "ENCRYPTED SIGSTORE PRIVATE KEY"
+	LegacyEncryptedKeyPEMType = "ENCRYPTED COSIGN PRIVATE KEY"
+)
+
+// ErrIncorrectPassword is returned when an encrypted key cannot be
+// decrypted with the given password.
+var ErrIncorrectPassword = errors.New("decrypting private key: incorrect password")
+
+// Default scrypt cost parameters, matching cosign.
+const (
+	scryptN = 32768
+	scryptR = 8
+	scryptP = 1
+)
+
+// encryptedKey is the JSON document inside an encrypted key's PEM block,
+// in the layout cosign inherits from go-securesystemslib.
+type encryptedKey struct {
+	KDF struct {
+		Name   string `json:"name"`
+		Params struct {
+			N int `json:"N"`
+			R int `json:"r"`
+			P int `json:"p"`
+		} `json:"params"`
+		Salt []byte `json:"salt"`
+	} `json:"kdf"`
+	Cipher struct {
+		Name  string `json:"name"`
+		Nonce []byte `json:"nonce"`
+	} `json:"cipher"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// IsEncryptedKey reports whether data is a password-encrypted private key.
+func IsEncryptedKey(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil && (block.Type == EncryptedKeyPEMType || block.Type == LegacyEncryptedKeyPEMType)
+}
+
+// EncryptPrivateKey encodes key as a cosign-compatible encrypted private
+// key: PKCS#8 sealed with NaCl secretbox under an scrypt-derived key.
+func EncryptPrivateKey(key crypto.Signer, password []byte) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("encoding private key: %w", err)
+	}
+	var ek encryptedKey
+	ek.KDF.Name = "scrypt"
+	ek.KDF.Params.N, ek.KDF.Params.R, ek.KDF.Params.P = scryptN, scryptR, scryptP
+	ek.KDF.Salt = make([]byte, 32)
+	ek.Cipher.Name = "nacl/secretbox"
+	ek.Cipher.Nonce = make([]byte, 24)
+	if _, err := rand.Read(ek.KDF.Salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(ek.Cipher.Nonce); err != nil {
+		return nil, err
+	}
+	secret, err := scrypt.Key(password, ek.KDF.Salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	var k [32]byte
+	var nonce [24]byte
+	copy(k[:], secret)
+	copy(nonce[:], ek.Cipher.Nonce)
+	ek.Ciphertext = secretbox.Seal(nil, der, &nonce, &k)
+
+	doc, err := json.Marshal(ek)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: EncryptedKeyPEMType, Bytes: doc}), nil
+}
+
+// DecryptPrivateKey decodes a cosign encrypted private key.
+func DecryptPrivateKey(data, password []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || (block.Type != EncryptedKeyPEMType && block.Type != LegacyEncryptedKeyPEMType) {
+		return nil, errors.New("not an encrypted private key")
+	}
+	var ek encryptedKey
+	if err := json.Unmarshal(block.Bytes, &ek); err != nil {
+		return nil, fmt.Errorf("decoding encrypted private key: %w", err)
+	}
+	if ek.KDF.Name != "scrypt" || ek.Cipher.Name != "nacl/secretbox" {
+		return nil, fmt.Errorf("unsupported key encryption %s with %s", ek.Cipher.Name, ek.KDF.Name)
+	}
+	if len(ek.Cipher.Nonce) != 24 {
+		return nil, errors.New("encrypted private key has an invalid nonce")
+	}
+	p := ek.KDF.Params
+	secret, err := scrypt.Key(password, ek.KDF.Salt, p.N, p.R, p.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("deriving key: %w", err)
+	}
+	var k [32]byte
+	var nonce [24]byte
+	copy(k[:], secret)
+	copy(nonce[:], ek.Cipher.Nonce)
+	der, ok := secretbox.Open(nil, ek.Ciphertext, &nonce, &k)
+	if !ok {
+		return nil, ErrIncorrectPassword
+	}
+	return ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
@@ -0,0 +1,37 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestEncryptedPrivateKeyRoundTrip(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := EncryptPrivateKey(key, []byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncryptedKey(data) {
+		t.Fatal("IsEncryptedKey = false for an encrypted key")
+	}
+	if _, err := ParsePrivateKey(data); err == nil {
+		t.Error("ParsePrivateKey accepted an encrypted key")
+	}
+
+	got, err := DecryptPrivateKey(data, []byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(got) {
+		t.Error("decrypted key differs from the original")
+	}
+	if _, err := DecryptPrivateKey(data, []byte("wrong")); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("wrong password: got %v, want ErrIncorrectPassword", err)
+	}
+}
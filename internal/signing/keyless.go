@@ -0,0 +1,197 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/httpclient"
+)
+
+// DefaultFulcioURL is the public-good Sigstore certificate authority.
+const DefaultFulcioURL = "https://fulcio.sigstore.dev"
+
+// KeylessSigner is a Signer backed by an ephemeral key and a short-lived
+// Fulcio certificate bound to an OIDC identity.
+type KeylessSigner struct {
+	*Signer
+	// Chain is the leaf certificate followed by its issuing chain.
+	Chain []*x509.Certificate
+}
+
+// NewKeylessSigner generates an ephemeral P-256 key and exchanges idToken
+// for a signing certificate from the Fulcio instance at fulcioURL.
+func NewKeylessSigner(ctx context.Context, fulcioURL, idToken string) (*KeylessSigner, error) {
+	if idToken == "" {
+		return nil, errors.New("keyless signing requires an OIDC identity token")
+	}
+	subject, err := tokenSubject(idToken)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	pubPEM, err := MarshalPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(subject))
+	proof, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := requestCertificate(ctx, fulcioURL, idToken, pubPEM, proof)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := NewSigner(key)
+	if err != nil {
+		return nil, err
+	}
+	return &KeylessSigner{Signer: signer, Chain: chain}, nil
+}
+
+// ChainPEM returns the certificate chain PEM-encoded, leaf first.
+func (k *KeylessSigner) ChainPEM() []byte {
+	var buf bytes.Buffer
+	for _, c := range k.Chain {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	}
+	return buf.Bytes()
+}
+
+type fulcioRequest struct {
+	Credentials struct {
+		OIDCIdentityToken string `json:"oidcIdentityToken"`
+	} `json:"credentials"`
+	PublicKeyRequest struct {
+		PublicKey struct {
+			Algorithm string `json:"algorithm"`
+			Content   string `json:"content"`
+		} `json:"publicKey"`
+		ProofOfPossession []byte `json:"proofOfPossession"`
+	} `json:"publicKeyRequest"`
+}
+
+type fulcioChain struct {
+	Chain struct {
+		Certificates []string `json:"certificates"`
+	} `json:"chain"`
+}
+
+type fulcioResponse struct {
+	SignedCertificateEmbeddedSct *fulcioChain `json:"signedCertificateEmbeddedSct"`
+	SignedCertificateDetachedSct *fulcioChain `json:"signedCertificateDetachedSct"`
+}
+
+func requestCertificate(ctx context.Context, fulcioURL, idToken string, pubPEM, proof []byte) ([]*x509.Certificate, error) {
+	var body fulcioRequest
+	body.Credentials.OIDCIdentityToken = idToken
+	body.PublicKeyRequest.PublicKey.Algorithm = "ECDSA"
+	body.PublicKeyRequest.PublicKey.Content = string(pubPEM)
+	body.PublicKeyRequest.ProofOfPossession = proof
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimSuffix(fulcioURL, "/") + "/api/v2/signingCert"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+idToken)
+	resp, err := httpclient.Default().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting certificate from Fulcio: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("fulcio returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var fr fulcioResponse
+	if err := json.Unmarshal(data, &fr); err != nil {
+		return nil, fmt.Errorf("decoding Fulcio response: %w", err)
+	}
+	fc := fr.SignedCertificateEmbeddedSct
+	if fc == nil {
+		fc = fr.SignedCertificateDetachedSct
+	}
+	if fc == nil || len(fc.Chain.Certificates) == 0 {
+		return nil, errors.New("fulcio response contained no certificates")
+	}
+	return ParseCertificates([]byte(strings.Join(fc.Chain.Certificates, "\n")))
+}
+
+// ParseCertificates decodes every CERTIFICATE block in data.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
+
+// tokenSubject extracts the identity Fulcio will bind the certificate to:
+// the email claim when present, otherwise sub. The token is not verified
+// here; Fulcio does that.
+func tokenSubject(idToken string) (string, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return "", errors.New("identity token is not a JWT")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("decoding identity token claims: %w", err)
+	}
+	var claims struct {
+		Subject string `json:"sub"`
+		Email   string `json:"email"`
+	}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return "", fmt.Errorf("decoding identity token claims: %w", err)
+	}
+	if claims.Email != "" {
+		return claims.Email, nil
+	}
+	if claims.Subject == "" {
+		return "", errors.New("identity token has no sub or email claim")
+	}
+	return claims.Subject, nil
+}
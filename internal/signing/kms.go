@@ -0,0 +1,175 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/httpclient"
+)
+
+// VaultScheme is the URI scheme of keys in HashiCorp Vault's transit
+// secrets engine, as cosign names them.
+const VaultScheme = "hashivault://"
+
+// vaultTimeout bounds each call to Vault; signing has no context of its
+// own to bound it with.
+const vaultTimeout = 30 * time.Second
+
+// OpenKMS returns a signer for the KMS key named by uri. Only
+// hashivault://<key> is supported, with the Vault server and token taken
+// from $VAULT_ADDR and $VAULT_TOKEN.
+func OpenKMS(ctx context.Context, uri string) (*VaultSigner, error) {
+	name, ok := strings.CutPrefix(uri, VaultScheme)
+	if !ok {
+		scheme, _, _ := strings.Cut(uri, "://")
+		return nil, fmt.Errorf("unsupported KMS %q: only %s keys are supported", scheme, VaultScheme)
+	}
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, errors.New("signing with Vault needs $VAULT_ADDR and $VAULT_TOKEN")
+	}
+	return NewVaultSigner(ctx, addr, token, name)
+}
+
+// VaultSigner signs with a key of HashiCorp Vault's transit secrets
+// engine, which never leaves Vault.
+type VaultSigner struct {
+	addr, token, key string
+	http             *http.Client
+	public           crypto.PublicKey
+	keyID            string
+	// version is the key version public belongs to. Signing pins it, so a
+	// rotation in Vault cannot sign with a key KeyID does not name.
+	version int
+}
+
+// NewVaultSigner looks up the latest version of the transit key named key
+// on the Vault server at addr, which it then signs with.
+func NewVaultSigner(ctx context.Context, addr, token, key string) (*VaultSigner, error) {
+	if key == "" || strings.Contains(key, "/") {
+		return nil, fmt.Errorf("invalid Vault transit key name %q", key)
+	}
+	v := &VaultSigner{addr: strings.TrimSuffix(addr, "/"), token: token, key: key, http: httpclient.Default()}
+	var resp struct {
+		Data struct {
+			LatestVersion int `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}
+	if err := v.call(ctx, http.MethodGet, "/v1/transit/keys/"+url.PathEscape(key), nil, &resp); err != nil {
+		return nil, err
+	}
+	latest, ok := resp.Data.Keys[strconv.Itoa(resp.Data.LatestVersion)]
+	if !ok || latest.PublicKey == "" {
+		return nil, fmt.Errorf("vault: transit key %s has no public key; is it a signing key?", key)
+	}
+	pub, err := ParsePublicKey([]byte(latest.PublicKey))
+	if err != nil {
+		// Vault returns ed25519 public keys as bare base64.
+		raw, derr := base64.StdEncoding.DecodeString(latest.PublicKey)
+		if derr != nil {
+			return nil, fmt.Errorf("vault: public key of %s: %w", key, err)
+		}
+		pub = ed25519.PublicKey(raw)
+	}
+	if v.keyID, err = Fingerprint(pub); err != nil {
+		return nil, err
+	}
+	v.public, v.version = pub, resp.Data.LatestVersion
+	return v, nil
+}
+
+// Name returns BackendKMS.
+func (v *VaultSigner) Name() string { return BackendKMS }
+
+// ChainPEM returns nil: KMS keys have no certificates.
+func (v *VaultSigner) ChainPEM() []byte { return nil }
+
+// KeyID returns the SHA-256 fingerprint of the public key.
+func (v *VaultSigner) KeyID() string { return v.keyID }
+
+// Public returns the key's public key.
+func (v *VaultSigner) Public() crypto.PublicKey { return v.public }
+
+// Sign has Vault sign data with the key version read when the signer was
+// opened, hashing it with SHA-256 unless the key is ed25519, as Signer
+// does. RSA keys sign with PKCS #1 v1.5 rather than Vault's default of
+// PSS, as cosign does.
+func (v *VaultSigner) Sign(data []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+	body := map[string]any{"input": base64.StdEncoding.EncodeToString(data), "key_version": v.version}
+	if _, ok := v.public.(*rsa.PublicKey); ok {
+		body["signature_algorithm"] = "pkcs1v15"
+	}
+	var resp struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+	if err := v.call(ctx, http.MethodPost, "/v1/transit/sign/"+url.PathEscape(v.key)+"/sha2-256", body, &resp); err != nil {
+		return nil, err
+	}
+	// Signatures read "vault:v<version>:<base64>".
+	parts := strings.SplitN(resp.Data.Signature, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, fmt.Errorf("vault: unexpected signature %q", resp.Data.Signature)
+	}
+	if parts[1] != "v"+strconv.Itoa(v.version) {
+		return nil, fmt.Errorf("vault: signed with key version %s, want v%d", parts[1], v.version)
+	}
+	return base64.StdEncoding.DecodeString(parts[2])
+}
+
+// call sends a request to the Vault API and decodes its JSON response
+// into out.
+func (v *VaultSigner) call(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.addr+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("vault: decoding %s: %w", path, err)
+	}
+	return nil
+}
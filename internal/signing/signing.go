@@ -0,0 +1,184 @@
+// Package signing provides DSSE signers and verifiers backed by local keys
+// or short-lived Fulcio certificates.
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Signer signs DSSE PAE bytes with a private key.
+type Signer struct {
+	key   crypto.Signer
+	keyID string
+}
+
+// NewSigner wraps key as a DSSE signer whose key ID is the key fingerprint.
+func NewSigner(key crypto.Signer) (*Signer, error) {
+	fp, err := Fingerprint(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{key: key, keyID: fp}, nil
+}
+
+// KeyID returns the SHA-256 fingerprint of the public key.
+func (s *Signer) KeyID() string { return s.keyID }
+
+// Public returns the signer's public key.
+func (s *Signer) Public() crypto.PublicKey { return s.key.Public() }
+
+// Sign signs data, hashing it first with SHA-256 unless the key is ed25519.
+func (s *Signer) Sign(data []byte) ([]byte, error) {
+	switch k := s.key.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, data), nil
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.SignASN1(rand.Reader, k, digest[:])
+	default:
+		digest := sha256.Sum256(data)
+		return s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+}
+
+// Verifier checks DSSE signatures against a public key.
+type Verifier struct {
+	key   crypto.PublicKey
+	keyID string
+}
+
+// NewVerifier wraps key as a DSSE verifier.
+func NewVerifier(key crypto.PublicKey) (*Verifier, error) {
+	fp, err := Fingerprint(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{key: key, keyID: fp}, nil
+}
+
+// KeyID returns the SHA-256 fingerprint of the public key.
+func (v *Verifier) KeyID() string { return v.keyID }
+
+// Public returns the verifier's public key.
+func (v *Verifier) Public() crypto.PublicKey { return v.key }
+
+// Verify checks sig over data.
+func (v *Verifier) Verify(data, sig []byte) error {
+	digest := sha256.Sum256(data)
+	switch k := v.key.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, data, sig) {
+			return errors.New("ed25519 signature mismatch")
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return errors.New("ecdsa signature mismatch")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig); err != nil {
+			if err := rsa.VerifyPSS(k, crypto.SHA256, digest[:], sig, nil); err != nil {
+				return errors.New("rsa signature mismatch")
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", v.key)
+	}
+	return nil
+}
+
+// Fingerprint returns the hex SHA-256 of the PKIX encoding of pub.
+func Fingerprint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("encoding public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// LoadPrivateKey reads a PEM-encoded PKCS#8, SEC 1 or PKCS#1 private key.
+func LoadPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKey(data)
+}
+
+// ParsePrivateKey decodes a PEM-encoded private key.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found in private key")
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	case EncryptedKeyPEMType, LegacyEncryptedKeyPEMType:
+		return nil, errors.New("private key is encrypted; use DecryptPrivateKey")
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// LoadPublicKey reads a PEM-encoded PKIX public key or certificate.
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKey(data)
+}
+
+// ParsePublicKey decodes a PEM-encoded public key. A certificate is accepted
+// in place of a bare key and its subject public key is returned.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found in public key")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// MarshalPublicKey PEM-encodes pub as a PKIX public key.
+func MarshalPublicKey(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
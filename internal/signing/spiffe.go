@@ -0,0 +1,118 @@
+package signing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Files the SPIFFE helper writes an X.509 SVID to, by default.
+const (
+	SVIDCertFile = "svid.pem"
+	SVIDKeyFile  = "svid_key.pem"
+)
+
+// SVIDSigner signs with a workload's X.509 SVID, as written to a directory
+// by the SPIFFE helper. SVIDs are short-lived, so the files are read again
+// whenever the helper has rotated them.
+type SVIDSigner struct {
+	dir string
+
+	mu      sync.Mutex
+	modTime time.Time
+	signer  *Signer
+	chain   []byte
+	id      string
+}
+
+// LoadSVID reads the SVID in dir.
+func LoadSVID(dir string) (*SVIDSigner, error) {
+	if dir == "" {
+		return nil, errors.New("the spiffe backend needs the SVID directory")
+	}
+	s := &SVIDSigner{dir: dir}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reload reads the SVID again if its certificate file changed.
+func (s *SVIDSigner) reload() error {
+	certPath := filepath.Join(s.dir, SVIDCertFile)
+	fi, err := os.Stat(certPath)
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(s.modTime) {
+		return nil
+	}
+	chain, err := os.ReadFile(certPath)
+	if err != nil {
+		return err
+	}
+	certs, err := ParseCertificates(chain)
+	if err != nil {
+		return fmt.Errorf("%s: %w", certPath, err)
+	}
+	var id string
+	for _, u := range certs[0].URIs {
+		if u.Scheme == "spiffe" {
+			id = u.String()
+		}
+	}
+	if id == "" {
+		return fmt.Errorf("%s: the certificate has no SPIFFE ID", certPath)
+	}
+	key, err := LoadPrivateKey(filepath.Join(s.dir, SVIDKeyFile))
+	if err != nil {
+		return err
+	}
+	signer, err := NewSigner(key)
+	if err != nil {
+		return err
+	}
+	if fp, _ := Fingerprint(certs[0].PublicKey); fp != signer.KeyID() {
+		return fmt.Errorf("%s does not match the key of %s", SVIDKeyFile, certPath)
+	}
+	s.modTime, s.signer, s.chain, s.id = fi.ModTime(), signer, chain, id
+	return nil
+}
+
+// Name returns BackendSPIFFE.
+func (s *SVIDSigner) Name() string { return BackendSPIFFE }
+
+// ID returns the SPIFFE ID of the SVID.
+func (s *SVIDSigner) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// ChainPEM returns the SVID's certificate chain, leaf first.
+func (s *SVIDSigner) ChainPEM() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.chain
+}
+
+// KeyID returns the SHA-256 fingerprint of the SVID's public key.
+func (s *SVIDSigner) KeyID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.signer.KeyID()
+}
+
+// Sign signs data with the SVID's key, first picking up a rotated SVID.
+// The previous SVID is used while a rotation is only partly written.
+func (s *SVIDSigner) Sign(data []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil && s.signer == nil {
+		return nil, err
+	}
+	return s.signer.Sign(data)
+}
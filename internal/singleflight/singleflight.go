@@ -0,0 +1,74 @@
+// Package singleflight lets concurrent callers asking for the same thing
+// share one call, so a burst of identical verifications costs a single
+// round of registry and Rekor requests.
+package singleflight
+
+import (
+	"context"
+	"sync"
+)
+
+// Group deduplicates concurrent calls by key. The zero value is ready to
+// use.
+type Group[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*call[V]
+}
+
+type call[V any] struct {
+	done    chan struct{}
+	val     V
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Do returns the result of fn for key. When a call for key is already in
+// flight, Do waits for it instead and reports shared as true.
+//
+// fn runs detached from any one caller's cancellation: it receives a
+// context that is cancelled only once every caller waiting on it has
+// given up, so the first caller leaving does not fail the rest. A caller
+// whose ctx ends returns ctx.Err() without waiting.
+func (g *Group[K, V]) Do(ctx context.Context, key K, fn func(context.Context) (V, error)) (v V, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[K]*call[V]{}
+	}
+	c, shared := g.calls[key]
+	if shared {
+		c.waiters++
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &call[V]{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		g.calls[key] = c
+		go g.run(callCtx, key, c, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, shared, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 && g.calls[key] == c {
+			delete(g.calls, key)
+			c.cancel()
+		}
+		g.mu.Unlock()
+		var zero V
+		return zero, shared, ctx.Err()
+	}
+}
+
+func (g *Group[K, V]) run(ctx context.Context, key K, c *call[V], fn func(context.Context) (V, error)) {
+	c.val, c.err = fn(ctx)
+	g.mu.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+	c.cancel()
+	close(c.done)
+}
@@ -0,0 +1,121 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoSharesConcurrentCalls(t *testing.T) {
+	var g Group[string, int]
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	var sharedCount atomic.Int32
+	started := make(chan struct{}, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started <- struct{}{}
+			v, shared, err := g.Do(context.Background(), "sha256:abc", fn)
+			if err != nil || v != 42 {
+				t.Errorf("Do = %d, %v", v, err)
+			}
+			if shared {
+				sharedCount.Add(1)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		<-started
+	}
+	// Give the goroutines time to join the call before it finishes.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("fn ran %d times, want 1", calls.Load())
+	}
+	if sharedCount.Load() != n-1 {
+		t.Errorf("%d callers shared the result, want %d", sharedCount.Load(), n-1)
+	}
+
+	// Once finished, the next call runs fn again.
+	release = make(chan struct{})
+	close(release)
+	if _, shared, _ := g.Do(context.Background(), "sha256:abc", fn); shared || calls.Load() != 2 {
+		t.Errorf("call after completion: shared=%v, fn ran %d times", shared, calls.Load())
+	}
+}
+
+func TestDoSurvivesFirstCallerCancelling(t *testing.T) {
+	var g Group[string, string]
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		select {
+		case <-release:
+			return "ok", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, _, err := g.Do(ctx, "k", fn)
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	second := make(chan string)
+	go func() {
+		v, _, _ := g.Do(context.Background(), "k", fn)
+		second <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller got %v, want context.Canceled", err)
+	}
+	close(release)
+	if v := <-second; v != "ok" {
+		t.Errorf("remaining caller got %q, want the shared result", v)
+	}
+}
+
+func TestDoCancelsWhenEveryCallerLeaves(t *testing.T) {
+	var g Group[string, string]
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return "", ctx.Err()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		g.Do(ctx, "k", fn)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	<-done
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fn was not cancelled after its only caller left")
+	}
+}
@@ -0,0 +1,175 @@
+// Package sourcelink turns the source repository and commit recorded in
+// SLSA provenance into links to GitHub and GitLab: the commit, the file
+// tree at that commit, and the Tekton pipeline definition the build ran.
+package sourcelink
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+)
+
+// Links are web links into the source repository of a build.
+type Links struct {
+	// Forge is "github" or "gitlab".
+	Forge      string `json:"forge"`
+	Repository string `json:"repository"`
+	// Revision is the commit the build used, or the ref it named when the
+	// provenance records no commit.
+	Revision string `json:"revision"`
+	// Commit links to the commit; empty when only a ref is known.
+	Commit string `json:"commit,omitempty"`
+	// Tree links to the repository's files at Revision.
+	Tree string `json:"tree"`
+	// Pipeline links to the pipeline definition, which may live in another
+	// repository, when the provenance says where it came from.
+	Pipeline string `json:"pipeline,omitempty"`
+}
+
+// repo is a repository on a forge that Resolve knows how to link into.
+type repo struct {
+	forge string
+	base  string
+}
+
+// parseRepo recognizes GitHub and GitLab repository URIs in the forms
+// provenance uses: https URLs with optional git+ prefix, .git suffix and
+// @revision, and scp-like git@host:path addresses. The revision is
+// returned separately.
+func parseRepo(uri string) (repo, string, bool) {
+	uri = strings.TrimPrefix(strings.TrimSpace(uri), "git+")
+	if rest, ok := strings.CutPrefix(uri, "git@"); ok {
+		host, path, ok := strings.Cut(rest, ":")
+		if !ok {
+			return repo{}, "", false
+		}
+		uri = "https://" + host + "/" + path
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return repo{}, "", false
+	}
+	path, rev, _ := strings.Cut(strings.Trim(u.Path, "/"), "@")
+	path = strings.TrimSuffix(path, ".git")
+	if strings.Count(path, "/") < 1 {
+		return repo{}, "", false
+	}
+	host := strings.ToLower(u.Hostname())
+	var forge string
+	switch {
+	case host == "github.com":
+		forge = "github"
+	case host == "gitlab.com" || strings.HasPrefix(host, "gitlab."):
+		forge = "gitlab"
+	default:
+		return repo{}, "", false
+	}
+	return repo{forge: forge, base: "https://" + host + "/" + path}, rev, true
+}
+
+// link returns the URL of kind ("commit", "tree" or "blob") at rev in r.
+// GitLab puts these pages under /-/.
+func (r repo) link(kind, rev, path string) string {
+	u := r.base + "/"
+	if r.forge == "gitlab" {
+		u += "-/"
+	}
+	u += kind + "/" + rev
+	if path != "" {
+		u += "/" + strings.TrimPrefix(path, "/")
+	}
+	return u
+}
+
+// Resolve links the source repository at uri, built at commit. With no
+// commit the revision named after @ in uri is used instead. It reports
+// false for repositories on other forges.
+func Resolve(uri, commit string) (*Links, bool) {
+	r, rev, ok := parseRepo(uri)
+	if !ok {
+		return nil, false
+	}
+	l := &Links{Forge: r.forge, Repository: r.base, Revision: rev}
+	if commit != "" {
+		l.Revision = commit
+		l.Commit = r.link("commit", commit, "")
+	}
+	if l.Revision == "" {
+		return nil, false
+	}
+	l.Tree = r.link("tree", l.Revision, "")
+	return l, true
+}
+
+// FromProvenance links the source the provenance records, as
+// Provenance.Source selects it, and the pipeline definition, taken from a
+// git resolver pipelineRef or a v0.2 configSource.
+func FromProvenance(p *attestation.Provenance) (*Links, bool) {
+	src, ok := p.Source()
+	if !ok {
+		return nil, false
+	}
+	l, ok := Resolve(src.URI, Commit(src.Digest))
+	if !ok {
+		return nil, false
+	}
+	if uri, rev, path, ok := pipelineSource(p.BuildDefinition.ExternalParameters); ok {
+		if r, uriRev, ok := parseRepo(uri); ok {
+			if rev == "" {
+				rev = uriRev
+			}
+			if rev == "" && r.base == l.Repository {
+				rev = l.Revision
+			}
+			if rev != "" {
+				l.Pipeline = r.link("blob", rev, path)
+			}
+		}
+	}
+	return l, true
+}
+
+// Commit picks the commit out of a source digest: its sha1, gitCommit or
+// sha256 entry, in that order of preference.
+func Commit(digest map[string]string) string {
+	for _, alg := range []string{"sha1", "gitCommit", "sha256"} {
+		if c := digest[alg]; c != "" {
+			return c
+		}
+	}
+	return ""
+}
+
+// pipelineSource finds where the pipeline definition came from: the url,
+// revision and pathInRepo parameters of a git resolver pipelineRef, which
+// Chains records under runSpec, or the configSource of v0.2 provenance.
+func pipelineSource(params map[string]any) (uri, rev, path string, ok bool) {
+	if cs, isMap := params["configSource"].(map[string]any); isMap {
+		uri, _ = cs["uri"].(string)
+		path, _ = cs["entryPoint"].(string)
+		// NormalizeProvenance copies the digest over as is.
+		digest, _ := cs["digest"].(map[string]string)
+		rev = Commit(digest)
+		return uri, rev, path, uri != "" && path != ""
+	}
+	spec, _ := params["runSpec"].(map[string]any)
+	ref, _ := spec["pipelineRef"].(map[string]any)
+	if resolver, _ := ref["resolver"].(string); resolver != "git" {
+		return "", "", "", false
+	}
+	list, _ := ref["params"].([]any)
+	for _, item := range list {
+		param, _ := item.(map[string]any)
+		value, _ := param["value"].(string)
+		switch param["name"] {
+		case "url":
+			uri = value
+		case "revision":
+			rev = value
+		case "pathInRepo":
+			path = value
+		}
+	}
+	return uri, rev, path, uri != "" && path != ""
+}
@@ -0,0 +1,94 @@
+package sourcelink
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+)
+
+func TestResolve(t *testing.T) {
+	const sha = "3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a"
+	tests := []struct {
+		uri, commit string
+		want        *Links
+	}{
+		{"git+https://github.com/org/app.git@refs/heads/main", sha, &Links{
+			Forge:      "github",
+			Repository: "https://github.com/org/app",
+			Revision:   sha,
+			Commit:     "https://github.com/org/app/commit/" + sha,
+			Tree:       "https://github.com/org/app/tree/" + sha,
+		}},
+		{"https://gitlab.example.com/group/sub/app", sha, &Links{
+			Forge:      "gitlab",
+			Repository: "https://gitlab.example.com/group/sub/app",
+			Revision:   sha,
+			Commit:     "https://gitlab.example.com/group/sub/app/-/commit/" + sha,
+			Tree:       "https://gitlab.example.com/group/sub/app/-/tree/" + sha,
+		}},
+		{"git@github.com:org/app.git@v1.2.0", "", &Links{
+			Forge:      "github",
+			Repository: "https://github.com/org/app",
+			Revision:   "v1.2.0",
+			Tree:       "https://github.com/org/app/tree/v1.2.0",
+		}},
+		{"https://git.example.com/org/app", sha, nil},
+		{"https://github.com/org", sha, nil},
+		{"https://github.com/org/app", "", nil},
+		{"oci://ghcr.io/org/app", sha, nil},
+	}
+	for _, tt := range tests {
+		got, ok := Resolve(tt.uri, tt.commit)
+		if ok != (tt.want != nil) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Resolve(%q, %q) = %+v, %v; want %+v", tt.uri, tt.commit, got, ok, tt.want)
+		}
+	}
+}
+
+func TestFromProvenance(t *testing.T) {
+	const sha = "3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a"
+	source := []attestation.ResourceDescriptor{{URI: "git+https://github.com/org/app", Digest: map[string]string{"sha1": sha}}}
+	tests := []struct {
+		name   string
+		params map[string]any
+		want   string
+	}{
+		{"git resolver", map[string]any{"runSpec": map[string]any{"pipelineRef": map[string]any{
+			"resolver": "git",
+			"params": []any{
+				map[string]any{"name": "url", "value": "https://github.com/org/pipelines.git"},
+				map[string]any{"name": "revision", "value": "main"},
+				map[string]any{"name": "pathInRepo", "value": "build/pipeline.yaml"},
+			},
+		}}}, "https://github.com/org/pipelines/blob/main/build/pipeline.yaml"},
+		{"git resolver in the source repository", map[string]any{"runSpec": map[string]any{"pipelineRef": map[string]any{
+			"resolver": "git",
+			"params": []any{
+				map[string]any{"name": "url", "value": "https://github.com/org/app"},
+				map[string]any{"name": "pathInRepo", "value": "/tekton/pipeline.yaml"},
+			},
+		}}}, "https://github.com/org/app/blob/" + sha + "/tekton/pipeline.yaml"},
+		{"v0.2 config source", map[string]any{"configSource": map[string]any{
+			"uri":        "git+https://gitlab.com/org/ci",
+			"digest":     map[string]string{"sha1": "abc1234"},
+			"entryPoint": "pipeline.yaml",
+		}}, "https://gitlab.com/org/ci/-/blob/abc1234/pipeline.yaml"},
+		{"pipeline by name", map[string]any{"runSpec": map[string]any{"pipelineRef": map[string]any{"name": "build"}}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &attestation.Provenance{BuildDefinition: attestation.BuildDefinition{ExternalParameters: tt.params, ResolvedDependencies: source}}
+			l, ok := FromProvenance(p)
+			if !ok {
+				t.Fatal("no links")
+			}
+			if l.Commit != "https://github.com/org/app/commit/"+sha {
+				t.Errorf("commit link = %q", l.Commit)
+			}
+			if l.Pipeline != tt.want {
+				t.Errorf("pipeline link = %q, want %q", l.Pipeline, tt.want)
+			}
+		})
+	}
+}
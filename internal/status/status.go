@@ -0,0 +1,170 @@
+// Package status records how the verification status of the server's
+// checks, such as its own image and each watched tag, changes over time,
+// and detects checks that flap between verified and unverified.
+//
+// A check flaps once it has changed threshold times within the window, and
+// stops when fewer than half as many changes remain in it. While
+// it flaps, its damped status is unverified, so alerts on the damped
+// status fire once instead of with every oscillation.
+package status
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Statuses of a check.
+const (
+	Verified   = "verified"
+	Unverified = "unverified"
+)
+
+// Defaults for flap detection.
+const (
+	DefaultWindow    = 30 * time.Minute
+	DefaultThreshold = 4
+)
+
+// maxTransitions bounds the transitions kept across all checks.
+const maxTransitions = 500
+
+// Transition is a change in the status of a check. The first status
+// recorded for a check is a transition from "".
+type Transition struct {
+	Check string    `json:"check"`
+	From  string    `json:"from,omitempty"`
+	To    string    `json:"to"`
+	At    time.Time `json:"at"`
+	// Flapping is whether the check was flapping after the change.
+	Flapping bool `json:"flapping"`
+}
+
+// Check is the current status of a check.
+type Check struct {
+	Name string `json:"name"`
+	// Status is the last recorded status; Damped is Unverified while the
+	// check flaps, and Status otherwise.
+	Status string `json:"status"`
+	Damped string `json:"damped"`
+	// Since is when Status was first recorded after the last change.
+	Since    time.Time `json:"since"`
+	Flapping bool      `json:"flapping"`
+	// FlappingSince is when the check started flapping.
+	FlappingSince *time.Time `json:"flappingSince,omitempty"`
+	// Changes counts the transitions within the flap window.
+	Changes int `json:"changes"`
+}
+
+// History is the status history of the checks, safe for concurrent use.
+type History struct {
+	window    time.Duration
+	threshold int
+
+	mu          sync.Mutex
+	checks      map[string]*check
+	transitions []Transition
+}
+
+// check is the state of one check: its current status and the times of
+// its recent changes, oldest first.
+type check struct {
+	Check
+	changes []time.Time
+}
+
+// New returns an empty history that detects flapping with the given
+// window and threshold, or the defaults when they are not positive.
+func New(window time.Duration, threshold int) *History {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	return &History{window: window, threshold: threshold, checks: map[string]*check{}}
+}
+
+// Record records the status of the named check at the given time. It
+// returns the check and whether its damped status or flapping changed,
+// which is when to alert.
+func (h *History) Record(name string, verified bool, at time.Time) (Check, bool) {
+	status := Unverified
+	if verified {
+		status = Verified
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c, ok := h.checks[name]
+	if !ok {
+		c = &check{Check: Check{Name: name}}
+		h.checks[name] = c
+	}
+	damped, flapping := c.Damped, c.Flapping
+	if c.Status != status {
+		if ok {
+			c.changes = append(c.changes, at)
+		}
+		from := c.Status
+		c.Status, c.Since = status, at
+		h.update(c, at)
+		h.transitions = append(h.transitions, Transition{Check: name, From: from, To: status, At: at, Flapping: c.Flapping})
+		if len(h.transitions) > maxTransitions {
+			h.transitions = h.transitions[len(h.transitions)-maxTransitions:]
+		}
+	} else {
+		h.update(c, at)
+	}
+	return c.Check, c.Damped != damped || c.Flapping != flapping
+}
+
+// update forgets the changes of c older than the window and updates its
+// flapping and damped status as of now. h.mu must be held.
+func (h *History) update(c *check, now time.Time) {
+	cutoff := now.Add(-h.window)
+	i := 0
+	for i < len(c.changes) && !c.changes[i].After(cutoff) {
+		i++
+	}
+	c.changes = c.changes[i:]
+	c.Changes = len(c.changes)
+
+	switch {
+	case !c.Flapping && c.Changes >= h.threshold:
+		at := now
+		c.Flapping, c.FlappingSince = true, &at
+	case c.Flapping && c.Changes < (h.threshold+1)/2:
+		c.Flapping, c.FlappingSince = false, nil
+	}
+	c.Damped = c.Status
+	if c.Flapping {
+		c.Damped = Unverified
+	}
+}
+
+// Checks returns the status of every check as of now, ordered by name.
+func (h *History) Checks(now time.Time) []Check {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	checks := make([]Check, 0, len(h.checks))
+	for _, c := range h.checks {
+		h.update(c, now)
+		checks = append(checks, c.Check)
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+	return checks
+}
+
+// Transitions returns the recorded transitions of the named check, or of
+// every check when name is empty, newest first.
+func (h *History) Transitions(name string) []Transition {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := []Transition{}
+	for i := len(h.transitions) - 1; i >= 0; i-- {
+		if t := h.transitions[i]; name == "" || t.Check == name {
+			list = append(list, t)
+		}
+	}
+	return list
+}
@@ -0,0 +1,51 @@
+package status
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlapDetection(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	h := New(10*time.Minute, 4)
+
+	steps := []struct {
+		after    time.Duration
+		verified bool
+		flapping bool
+		damped   string
+		changed  bool
+	}{
+		{0, true, false, Verified, true},
+		{time.Minute, true, false, Verified, false},
+		{2 * time.Minute, false, false, Unverified, true},
+		{3 * time.Minute, true, false, Verified, true},
+		{4 * time.Minute, false, false, Unverified, true},
+		// The fourth change within ten minutes starts flapping, which
+		// holds the damped status at unverified.
+		{5 * time.Minute, true, true, Unverified, true},
+		{6 * time.Minute, false, true, Unverified, false},
+		{7 * time.Minute, true, true, Unverified, false},
+		// Flapping stops once fewer than two changes are left in the window.
+		{15 * time.Minute, true, true, Unverified, false},
+		{16*time.Minute + 30*time.Second, true, false, Verified, true},
+	}
+	for i, s := range steps {
+		c, changed := h.Record("self", s.verified, start.Add(s.after))
+		if c.Flapping != s.flapping || c.Damped != s.damped || changed != s.changed {
+			t.Errorf("step %d: %+v, changed %v; want flapping %v, damped %s, changed %v", i, c, changed, s.flapping, s.damped, s.changed)
+		}
+	}
+
+	if got := h.Transitions("self"); len(got) != 7 || got[0].To != Verified || !got[0].Flapping || got[6].From != "" {
+		t.Errorf("Transitions() = %+v", got)
+	}
+	h.Record("watch:app:v1", false, start)
+	if got := h.Transitions(""); len(got) != 8 || got[0].Check != "watch:app:v1" {
+		t.Errorf("Transitions(\"\") = %+v", got)
+	}
+	checks := h.Checks(start.Add(time.Hour))
+	if len(checks) != 2 || checks[0].Name != "self" || checks[0].Changes != 0 || checks[1].Status != Unverified {
+		t.Errorf("Checks() = %+v", checks)
+	}
+}
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/digest"
+)
+
+// Query selects attestations by fields of their predicate. Empty fields
+// match everything; set fields must all match.
+type Query struct {
+	// Digest is a subject digest in "alg:hex" form.
+	Digest        string
+	PredicateType string
+	// BuilderID is the provenance builder ID.
+	BuilderID string
+	// Source is the source repository the provenance records, compared
+	// without a git+ prefix, .git suffix or @revision, so
+	// "https://github.com/org/repo" matches
+	// "git+https://github.com/org/repo.git@refs/heads/main".
+	Source string
+	// Commit is the source revision, or a prefix of at least 7 characters.
+	Commit string
+	// Since and Until bound the build time: when the provenance says the
+	// build finished, or when the attestation was received if it does not.
+	Since, Until time.Time
+	// Limit caps the results; zero means no limit.
+	Limit int
+}
+
+// MinCommitPrefix is the shortest commit prefix Search accepts, as git
+// abbreviates by default.
+const MinCommitPrefix = 7
+
+// searchFields are the predicate fields Search indexes, extracted once
+// when an attestation is stored.
+type searchFields struct {
+	builderID string
+	source    string
+	commit    string
+	builtAt   time.Time
+	// byproducts are the canonical digests of provenance byproducts.
+	byproducts []string
+}
+
+// extractSearchFields reads the indexed fields from a provenance
+// statement. Other predicates only have a build time, their receipt.
+func extractSearchFields(stmt *attestation.Statement, received time.Time) searchFields {
+	f := searchFields{builtAt: received}
+	if !attestation.IsProvenance(stmt.PredicateType) {
+		return f
+	}
+	p, err := attestation.NormalizeProvenance(stmt)
+	if err != nil {
+		return f
+	}
+	f.builderID = p.RunDetails.Builder.ID
+	if src, ok := p.Source(); ok {
+		f.source = normalizeSource(src.URI)
+		for _, alg := range []string{"sha1", "gitCommit", "sha256"} {
+			if c := src.Digest[alg]; c != "" {
+				f.commit = strings.ToLower(c)
+				break
+			}
+		}
+	}
+	if md := p.RunDetails.Metadata; md != nil && md.FinishedOn != nil {
+		f.builtAt = md.FinishedOn.UTC()
+	}
+	for _, b := range p.RunDetails.Byproducts {
+		for alg, v := range b.Digest {
+			f.byproducts = append(f.byproducts, digest.Canonical(alg+":"+v))
+		}
+	}
+	return f
+}
+
+// normalizeSource reduces a source URI to the repository it names.
+func normalizeSource(uri string) string {
+	uri = strings.TrimPrefix(strings.TrimSpace(uri), "git+")
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		scheme, rest = "", uri
+	}
+	// A revision follows the last @ of the path, after any user info.
+	if slash := strings.Index(rest, "/"); slash >= 0 {
+		if at := strings.LastIndex(rest[slash:], "@"); at >= 0 {
+			rest = rest[:slash+at]
+		}
+	}
+	rest = strings.TrimSuffix(strings.TrimSuffix(rest, "/"), ".git")
+	if scheme != "" {
+		return strings.ToLower(scheme) + "://" + rest
+	}
+	return rest
+}
+
+// Search returns the attestations matching q, most recently received
+// first. Exact-match fields are answered from indexes, starting with the
+// most selective one.
+func (s *Store) Search(q Query) []*Attestation {
+	q.Source = normalizeSource(q.Source)
+	q.Commit = strings.ToLower(q.Commit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	candidates := s.items
+	narrow := func(index map[string][]*Attestation, key string) {
+		if key == "" {
+			return
+		}
+		if list := index[key]; len(list) < len(candidates) || len(list) == 0 {
+			candidates = list
+		}
+	}
+	narrow(s.byDigest, digest.Canonical(q.Digest))
+	narrow(s.byPredicate, q.PredicateType)
+	narrow(s.byBuilder, q.BuilderID)
+	narrow(s.bySource, q.Source)
+	if len(q.Commit) >= MinCommitPrefix {
+		if _, ok := s.byCommit[q.Commit]; ok {
+			narrow(s.byCommit, q.Commit)
+		}
+	}
+
+	var out []*Attestation
+	for i := len(candidates) - 1; i >= 0; i-- {
+		a := candidates[i]
+		if q.matches(a) {
+			out = append(out, a)
+			if q.Limit > 0 && len(out) == q.Limit {
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (q *Query) matches(a *Attestation) bool {
+	f := a.search
+	switch {
+	case q.Digest != "" && !a.hasDigest(q.Digest),
+		q.PredicateType != "" && a.PredicateType != q.PredicateType,
+		q.BuilderID != "" && f.builderID != q.BuilderID,
+		q.Source != "" && f.source != q.Source,
+		q.Commit != "" && (len(q.Commit) < MinCommitPrefix || !strings.HasPrefix(f.commit, q.Commit)),
+		!q.Since.IsZero() && f.builtAt.Before(q.Since),
+		!q.Until.IsZero() && f.builtAt.After(q.Until):
+		return false
+	}
+	return true
+}
+
+func (a *Attestation) hasDigest(d string) bool {
+	for _, sub := range a.Subjects {
+		if digest.InSet(sub.Digest, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// index adds a to the search indexes. The caller holds the write lock.
+func (s *Store) index(a *Attestation) {
+	s.byPredicate[a.PredicateType] = append(s.byPredicate[a.PredicateType], a)
+	if f := a.search; f.builderID != "" {
+		s.byBuilder[f.builderID] = append(s.byBuilder[f.builderID], a)
+	}
+	if f := a.search; f.source != "" {
+		s.bySource[f.source] = append(s.bySource[f.source], a)
+	}
+	if f := a.search; f.commit != "" {
+		s.byCommit[f.commit] = append(s.byCommit[f.commit], a)
+	}
+	for _, d := range a.search.byproducts {
+		if list := s.byByproduct[d]; len(list) == 0 || list[len(list)-1] != a {
+			s.byByproduct[d] = append(list, a)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+)
+
+func provenanceEnvelope(t *testing.T, subject, builder, source, commit string, finished time.Time) *dsse.Envelope {
+	t.Helper()
+	stmt, err := attestation.NewStatement(attestation.PredicateSLSAProvenanceV1, attestation.Provenance{
+		BuildDefinition: attestation.BuildDefinition{
+			BuildType: "https://tekton.dev/chains/v2/slsa",
+			ResolvedDependencies: []attestation.ResourceDescriptor{
+				{URI: source, Digest: map[string]string{"sha1": commit}},
+			},
+		},
+		RunDetails: attestation.RunDetails{
+			Builder:  attestation.Builder{ID: builder},
+			Metadata: &attestation.BuildMetadata{FinishedOn: &finished},
+		},
+	}, attestation.Subject{Name: subject, Digest: map[string]string{"sha256": subject}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(stmt)
+	env, err := dsse.Sign(attestation.PayloadType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestSearch(t *testing.T) {
+	s := New()
+	day := time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC)
+	const (
+		chains = "https://tekton.dev/chains/v2"
+		gha    = "https://github.com/actions/runner"
+		commit = "3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a"
+	)
+	for _, env := range []*dsse.Envelope{
+		provenanceEnvelope(t, "a1", chains, "git+https://github.com/org/app.git@refs/heads/main", commit, day.Add(1*time.Hour)),
+		provenanceEnvelope(t, "a2", chains, "git+https://github.com/org/app", "0000000000000000000000000000000000000001", day.Add(30*time.Hour)),
+		provenanceEnvelope(t, "b1", gha, "git+https://github.com/org/lib.git", "0000000000000000000000000000000000000002", day.Add(2*time.Hour)),
+		envelope(t, attestation.PredicateSPDX, "a1"),
+	} {
+		if _, _, err := s.Add(env, day.Add(48*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	subjects := func(list []*Attestation) []string {
+		var out []string
+		for _, a := range list {
+			out = append(out, a.Subjects[0].Name+"/"+attestation.PredicateName(a.PredicateType))
+		}
+		return out
+	}
+	tests := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{"everything", Query{}, []string{"app/SPDX SBOM", "b1/SLSA Provenance v1", "a2/SLSA Provenance v1", "a1/SLSA Provenance v1"}},
+		{"predicate", Query{PredicateType: attestation.PredicateSPDX}, []string{"app/SPDX SBOM"}},
+		{"digest", Query{Digest: "sha256:a1"}, []string{"app/SPDX SBOM", "a1/SLSA Provenance v1"}},
+		{"digest and builder", Query{Digest: "sha256:a1", BuilderID: chains}, []string{"a1/SLSA Provenance v1"}},
+		{"unknown digest", Query{Digest: "sha256:ffff"}, nil},
+		{"builder", Query{BuilderID: chains}, []string{"a2/SLSA Provenance v1", "a1/SLSA Provenance v1"}},
+		{"source normalized", Query{Source: "https://github.com/org/app"}, []string{"a2/SLSA Provenance v1", "a1/SLSA Provenance v1"}},
+		{"source as recorded", Query{Source: "git+https://github.com/org/lib.git@v1.2.0"}, []string{"b1/SLSA Provenance v1"}},
+		{"full commit", Query{Commit: commit}, []string{"a1/SLSA Provenance v1"}},
+		{"commit prefix", Query{Commit: "3F2A1B0"}, []string{"a1/SLSA Provenance v1"}},
+		{"commit prefix too short", Query{Commit: "3f2a"}, nil},
+		{"time range", Query{Since: day, Until: day.Add(3 * time.Hour)}, []string{"b1/SLSA Provenance v1", "a1/SLSA Provenance v1"}},
+		{"received time for non-provenance", Query{PredicateType: attestation.PredicateSPDX, Until: day.Add(24 * time.Hour)}, nil},
+		{"combined", Query{BuilderID: chains, Since: day.Add(24 * time.Hour)}, []string{"a2/SLSA Provenance v1"}},
+		{"no match", Query{BuilderID: "https://example.com/unknown"}, nil},
+		{"limit", Query{BuilderID: chains, Limit: 1}, []string{"a2/SLSA Provenance v1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := subjects(s.Search(tt.q)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%+v) = %v, want %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeSource(t *testing.T) {
+	for in, want := range map[string]string{
+		"git+https://github.com/org/app.git@refs/heads/main": "https://github.com/org/app",
+		"https://github.com/org/app/":                        "https://github.com/org/app",
+		"git+ssh://git@github.com/org/app.git@v1":            "ssh://git@github.com/org/app",
+		"HTTPS://github.com/org/app":                         "https://github.com/org/app",
+		"github.com/org/app@abc":                             "github.com/org/app",
+	} {
+		if got := normalizeSource(in); got != want {
+			t.Errorf("normalizeSource(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestListByproduct(t *testing.T) {
+	s := New()
+	log := map[string]string{"sha256": "cafe"}
+	for _, subject := range []string{"a1", "b1"} {
+		stmt, err := attestation.NewStatement(attestation.PredicateSLSAProvenanceV1, attestation.Provenance{
+			RunDetails: attestation.RunDetails{Byproducts: []attestation.ResourceDescriptor{{Name: "build.log", Digest: log}}},
+		}, attestation.Subject{Name: subject, Digest: map[string]string{"sha256": subject}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload, _ := json.Marshal(stmt)
+		env, err := dsse.Sign(attestation.PayloadType, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := s.Add(env, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Add(envelope(t, attestation.PredicateSPDX, "cafe"), time.Now())
+
+	names := func(list []*Attestation) []string {
+		var out []string
+		for _, a := range list {
+			out = append(out, a.Subjects[0].Name)
+		}
+		return out
+	}
+	for _, tt := range []struct {
+		f    Filter
+		want []string
+	}{
+		{Filter{Byproduct: "SHA256:CAFE"}, []string{"b1", "a1"}},
+		{Filter{Byproduct: "sha256:cafe", Digest: "sha256:a1"}, []string{"a1"}},
+		{Filter{Byproduct: "sha256:a1"}, nil},
+	} {
+		if got := names(s.List(tt.f)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("List(%+v) = %v, want %v", tt.f, got, tt.want)
+		}
+	}
+}
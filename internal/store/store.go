@@ -0,0 +1,254 @@
+// Package store keeps the attestations ingested by the server, indexed by
+// subject digest.
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/digest"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/schema"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+)
+
+// Attestation is a stored DSSE envelope with its decoded statement.
+type Attestation struct {
+	// ID is the hex SHA-256 of the envelope payload, so re-ingesting the
+	// same statement is idempotent.
+	ID            string                `json:"id"`
+	PredicateType string                `json:"predicateType"`
+	Subjects      []attestation.Subject `json:"subjects"`
+	KeyIDs        []string              `json:"keyIds"`
+	ReceivedAt    time.Time             `json:"receivedAt"`
+	Envelope      *dsse.Envelope        `json:"envelope"`
+	// SchemaViolations are where the predicate does not match the schema
+	// of its type; such attestations are stored all the same.
+	SchemaViolations []schema.Violation `json:"schemaViolations,omitempty"`
+
+	statement *attestation.Statement
+	search    searchFields
+	// raw and payload are the archived envelope JSON and in-toto
+	// statement, served as downloads without re-encoding.
+	raw     []byte
+	payload []byte
+}
+
+// Statement returns the decoded in-toto statement.
+func (a *Attestation) Statement() *attestation.Statement { return a.statement }
+
+// OpenEnvelope returns a reader over the envelope's JSON encoding.
+func (a *Attestation) OpenEnvelope() *bytes.Reader { return bytes.NewReader(a.raw) }
+
+// OpenPayload returns a reader over the in-toto statement the envelope
+// carries, exactly as signed.
+func (a *Attestation) OpenPayload() *bytes.Reader { return bytes.NewReader(a.payload) }
+
+// Digests returns the subject digests as canonical "alg:hex" strings.
+func (a *Attestation) Digests() []string {
+	var ds []string
+	for _, s := range a.Subjects {
+		for alg, v := range s.Digest {
+			ds = append(ds, digest.Canonical(alg+":"+v))
+		}
+	}
+	sort.Strings(ds)
+	return ds
+}
+
+// hasSubject reports whether a subject of a has digest d ("alg:hex").
+func (a *Attestation) hasSubject(d string) bool {
+	for _, s := range a.Subjects {
+		if digest.InSet(s.Digest, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter selects attestations; empty fields match everything.
+type Filter struct {
+	// Digest is a subject digest in "alg:hex" form.
+	Digest        string
+	PredicateType string
+	// Byproduct is the digest of a provenance byproduct in "alg:hex" form.
+	Byproduct string
+}
+
+// Store is an in-memory attestation store, safe for concurrent use.
+type Store struct {
+	mu       sync.RWMutex
+	items    []*Attestation
+	byID     map[string]*Attestation
+	byDigest map[string][]*Attestation
+	// Search indexes, in insertion order like items.
+	byPredicate map[string][]*Attestation
+	byBuilder   map[string][]*Attestation
+	bySource    map[string][]*Attestation
+	byCommit    map[string][]*Attestation
+	byByproduct map[string][]*Attestation
+	// transparency holds the transparency log entry URIs recorded for
+	// attestations, which arrive separately from the envelopes.
+	transparency map[string]string
+}
+
+// New returns an empty store.
+func New() *Store {
+	return &Store{
+		byID:         make(map[string]*Attestation),
+		byDigest:     make(map[string][]*Attestation),
+		byPredicate:  make(map[string][]*Attestation),
+		byBuilder:    make(map[string][]*Attestation),
+		bySource:     make(map[string][]*Attestation),
+		byCommit:     make(map[string][]*Attestation),
+		byByproduct:  make(map[string][]*Attestation),
+		transparency: make(map[string]string),
+	}
+}
+
+// Validate checks that env carries an in-toto statement the store accepts.
+func Validate(env *dsse.Envelope) error {
+	_, _, err := decode(env)
+	return err
+}
+
+func decode(env *dsse.Envelope) ([]byte, *attestation.Statement, error) {
+	if env.PayloadType != attestation.PayloadType {
+		return nil, nil, fmt.Errorf("unsupported payload type %q", env.PayloadType)
+	}
+	payload, err := env.DecodePayload()
+	if err != nil {
+		return nil, nil, err
+	}
+	stmt, err := attestation.ParseStatement(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, sig := range env.Signatures {
+		if sig.Cert == "" {
+			continue
+		}
+		if _, err := signing.ParseCertificates([]byte(sig.Cert)); err != nil {
+			return nil, nil, fmt.Errorf("signature %d certificate: %w", i+1, err)
+		}
+	}
+	return payload, stmt, nil
+}
+
+// Add stores an in-toto envelope received at now. It reports false, with
+// the existing record, when the payload is already stored.
+func (s *Store) Add(env *dsse.Envelope, now time.Time) (*Attestation, bool, error) {
+	payload, stmt, err := decode(env)
+	if err != nil {
+		return nil, false, err
+	}
+	raw, err := json.Marshal(env)
+	if err != nil {
+		return nil, false, err
+	}
+	sum := sha256.Sum256(payload)
+	a := &Attestation{
+		ID:            hex.EncodeToString(sum[:]),
+		PredicateType: stmt.PredicateType,
+		Subjects:      stmt.Subject,
+		KeyIDs:        make([]string, 0, len(env.Signatures)),
+		ReceivedAt:    now.UTC(),
+		Envelope:      env,
+		statement:     stmt,
+		search:        extractSearchFields(stmt, now.UTC()),
+		raw:           raw,
+		payload:       payload,
+	}
+	for _, sig := range env.Signatures {
+		a.KeyIDs = append(a.KeyIDs, sig.KeyID)
+	}
+	a.SchemaViolations, _ = schema.ValidateStatement(stmt)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.byID[a.ID]; ok {
+		return existing, false, nil
+	}
+	s.items = append(s.items, a)
+	s.byID[a.ID] = a
+	for _, d := range a.Digests() {
+		s.byDigest[d] = append(s.byDigest[d], a)
+	}
+	s.index(a)
+	return a, true, nil
+}
+
+// ErrNotFound is returned by Get for unknown IDs.
+var ErrNotFound = errors.New("attestation not found")
+
+// Get returns the attestation with the given ID.
+func (s *Store) Get(id string) (*Attestation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.byID[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return a, nil
+}
+
+// SetTransparencyURI records uri as the transparency log entry of the
+// attestation with the given ID, as Tekton Chains reports it in the
+// chains.tekton.dev/transparency annotation.
+func (s *Store) SetTransparencyURI(id, uri string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byID[id]; !ok {
+		return ErrNotFound
+	}
+	s.transparency[id] = uri
+	return nil
+}
+
+// TransparencyURI returns the transparency log entry recorded for the
+// attestation with the given ID, or "" when there is none.
+func (s *Store) TransparencyURI(id string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.transparency[id]
+}
+
+// List returns the attestations matching f, most recently received first.
+func (s *Store) List(f Filter) []*Attestation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	candidates := s.items
+	switch {
+	case f.Byproduct != "":
+		candidates = s.byByproduct[digest.Canonical(f.Byproduct)]
+	case f.Digest != "":
+		candidates = s.byDigest[digest.Canonical(f.Digest)]
+	}
+	out := make([]*Attestation, 0, len(candidates))
+	for i := len(candidates) - 1; i >= 0; i-- {
+		a := candidates[i]
+		if f.PredicateType != "" && a.PredicateType != f.PredicateType {
+			continue
+		}
+		if f.Byproduct != "" && f.Digest != "" && !a.hasSubject(f.Digest) {
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// Len returns the number of stored attestations.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.items)
+}
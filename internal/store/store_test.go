@@ -0,0 +1,76 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+)
+
+func envelope(t *testing.T, predicateType, digest string) *dsse.Envelope {
+	t.Helper()
+	stmt, err := attestation.NewStatement(predicateType, map[string]any{},
+		attestation.Subject{Name: "app", Digest: map[string]string{"sha256": digest}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(stmt)
+	env, err := dsse.Sign(attestation.PayloadType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestStore(t *testing.T) {
+	s := New()
+	now := time.Now()
+	prov := envelope(t, attestation.PredicateSLSAProvenanceV1, "aaa")
+	sbom := envelope(t, attestation.PredicateSPDX, "aaa")
+	other := envelope(t, attestation.PredicateSLSAProvenanceV1, "bbb")
+	for _, env := range []*dsse.Envelope{prov, sbom, other} {
+		if _, added, err := s.Add(env, now); err != nil || !added {
+			t.Fatalf("Add = %v, %v", added, err)
+		}
+	}
+	first, added, err := s.Add(prov, now.Add(time.Minute))
+	if err != nil || added {
+		t.Fatalf("re-adding an envelope: added = %v, err = %v", added, err)
+	}
+	if s.Len() != 3 {
+		t.Errorf("Len = %d, want 3", s.Len())
+	}
+	if got, err := s.Get(first.ID); err != nil || got != first {
+		t.Errorf("Get(%s) = %v, %v", first.ID, got, err)
+	}
+	var archived dsse.Envelope
+	if err := json.NewDecoder(first.OpenEnvelope()).Decode(&archived); err != nil || archived.Payload != prov.Payload {
+		t.Errorf("archived envelope = %+v, %v; want the ingested envelope", archived, err)
+	}
+	payload, _ := io.ReadAll(first.OpenPayload())
+	if sum := sha256.Sum256(payload); hex.EncodeToString(sum[:]) != first.ID {
+		t.Errorf("archived payload does not hash to the attestation ID")
+	}
+	if _, err := s.Get("missing"); err != ErrNotFound {
+		t.Errorf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+
+	if got := s.List(Filter{Digest: "sha256:aaa"}); len(got) != 2 || got[0].PredicateType != attestation.PredicateSPDX {
+		t.Errorf("List(digest) = %d attestations, newest first expected", len(got))
+	}
+	if got := s.List(Filter{PredicateType: attestation.PredicateSLSAProvenanceV1}); len(got) != 2 {
+		t.Errorf("List(predicateType) = %d attestations, want 2", len(got))
+	}
+	if got := s.List(Filter{Digest: "sha256:ccc"}); len(got) != 0 {
+		t.Errorf("List(unknown digest) = %d attestations, want 0", len(got))
+	}
+
+	if _, _, err := s.Add(&dsse.Envelope{PayloadType: "text/plain", Payload: "aGk="}, now); err == nil {
+		t.Error("Add accepted a non in-toto payload")
+	}
+}
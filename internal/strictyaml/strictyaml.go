@@ -0,0 +1,351 @@
+// Package strictyaml decodes YAML documents, and so JSON ones, strictly
+// against Go types: unknown fields and values of the wrong kind are
+// rejected with their line and column, which encoding/json and yaml.v3
+// report without, or not at all.
+//
+// Scalars are read as the type they are decoded into expects, so an
+// unquoted hex digest or date stays the string it was written as instead
+// of becoming a number or a timestamp.
+package strictyaml
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Error is a value that does not match the type it is decoded into.
+type Error struct {
+	Line   int
+	Column int
+	// Path locates the value, such as "rules[0].name"; it is empty for
+	// the document itself.
+	Path string
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("line %d, column %d: %s: %s", e.Line, e.Column, e.Path, e.Msg)
+}
+
+var (
+	rawMessageType      = reflect.TypeOf(json.RawMessage(nil))
+	durationType        = reflect.TypeOf(time.Duration(0))
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	yamlUnmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Unmarshal decodes a YAML or JSON document into v, matching fields by
+// their json tags as encoding/json does.
+func Unmarshal(data []byte, v any) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	return Decode(&doc, v)
+}
+
+// Decode decodes the YAML node n into v, matching fields by their json
+// tags.
+func Decode(n *yaml.Node, v any) error {
+	raw, err := ToJSON(n, v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// ToJSON checks the YAML node n against the type of v, matching fields by
+// their json tags, and returns it as JSON.
+func ToJSON(n *yaml.Node, v any) ([]byte, error) {
+	val, err := (&walker{tag: "json"}).walk(n, reflect.TypeOf(v), "")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(val)
+}
+
+// Check checks the YAML node n against the type of v, matching fields by
+// their yaml tags, for documents yaml.v3 decodes itself.
+func Check(n *yaml.Node, v any) error {
+	_, err := (&walker{tag: "yaml"}).walk(n, reflect.TypeOf(v), "")
+	return err
+}
+
+// maxNodes bounds the nodes a document expands to, as aliases can make
+// a small document exponentially large.
+const maxNodes = 1 << 20
+
+// walker converts nodes to the values encoding/json marshals, checking
+// them against the types they are decoded into.
+type walker struct {
+	// tag is the struct tag naming fields: "json" or "yaml".
+	tag string
+	// nodes counts the nodes walked.
+	nodes int
+}
+
+func (w *walker) errorf(n *yaml.Node, path, format string, args ...any) error {
+	return &Error{Line: n.Line, Column: n.Column, Path: path, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (w *walker) walk(n *yaml.Node, t reflect.Type, path string) (any, error) {
+	for n.Kind == yaml.DocumentNode || n.Kind == yaml.AliasNode {
+		if n.Kind == yaml.AliasNode {
+			n = n.Alias
+		} else if len(n.Content) == 0 {
+			return nil, nil
+		} else {
+			n = n.Content[0]
+		}
+	}
+	if n.Kind == 0 || n.ShortTag() == "!!null" {
+		return nil, nil
+	}
+	if w.nodes++; w.nodes > maxNodes {
+		return nil, w.errorf(n, path, "document expands to more than %d values", maxNodes)
+	}
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || w.opaque(t) {
+		return w.generic(n, path)
+	}
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		switch t.Kind() {
+		case reflect.Struct:
+			return w.object(n, t, path)
+		case reflect.Map:
+			return w.mapping(n, t, path)
+		}
+	case yaml.SequenceNode:
+		if (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8 {
+			list := make([]any, len(n.Content))
+			for i, item := range n.Content {
+				var err error
+				if list[i], err = w.walk(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return nil, err
+				}
+			}
+			return list, nil
+		}
+	case yaml.ScalarNode:
+		if v, ok, err := w.scalar(n, t, path); ok || err != nil {
+			return v, err
+		}
+	}
+	return nil, w.errorf(n, path, "expected %s, got %s", describeType(t), describeNode(n))
+}
+
+// opaque reports whether values of t decode themselves, or are arbitrary,
+// and so are not checked.
+func (w *walker) opaque(t reflect.Type) bool {
+	if t.Kind() == reflect.Interface || t == rawMessageType {
+		return true
+	}
+	p := reflect.PointerTo(t)
+	if w.tag == "yaml" {
+		return p.Implements(yamlUnmarshalerType)
+	}
+	return p.Implements(jsonUnmarshalerType) || p.Implements(textUnmarshalerType)
+}
+
+// object converts a mapping decoded into the struct type t.
+func (w *walker) object(n *yaml.Node, t reflect.Type, path string) (any, error) {
+	fields := w.fields(t, map[string]reflect.Type{})
+	obj := make(map[string]any, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		name, ft, ok := lookupField(fields, k.Value, w.tag == "json")
+		if k.Kind != yaml.ScalarNode || !ok {
+			return nil, w.errorf(k, path, "unknown field %q in %s", k.Value, typeName(t))
+		}
+		val, err := w.walk(v, ft, join(path, name))
+		if err != nil {
+			return nil, err
+		}
+		obj[name] = val
+	}
+	return obj, nil
+}
+
+// mapping converts a mapping decoded into the map type t.
+func (w *walker) mapping(n *yaml.Node, t reflect.Type, path string) (any, error) {
+	obj := make(map[string]any, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Kind != yaml.ScalarNode {
+			return nil, w.errorf(k, path, "mapping keys must be scalars")
+		}
+		val, err := w.walk(v, t.Elem(), join(path, k.Value))
+		if err != nil {
+			return nil, err
+		}
+		obj[k.Value] = val
+	}
+	return obj, nil
+}
+
+// scalar converts a scalar decoded into t, reporting false when it is of
+// the wrong kind.
+func (w *walker) scalar(n *yaml.Node, t reflect.Type, path string) (any, bool, error) {
+	tag := n.ShortTag()
+	switch {
+	case t == durationType && w.tag == "yaml" && tag == "!!str":
+		if _, err := time.ParseDuration(n.Value); err != nil {
+			return nil, false, w.errorf(n, path, "invalid duration %q", n.Value)
+		}
+		return n.Value, true, nil
+	case t.Kind() == reflect.String, t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return n.Value, true, nil
+	case t.Kind() == reflect.Bool:
+		if tag != "!!bool" {
+			return nil, false, nil
+		}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		if tag != "!!int" {
+			return nil, false, nil
+		}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		if tag != "!!int" && tag != "!!float" {
+			return nil, false, nil
+		}
+	default:
+		return nil, false, nil
+	}
+	v, err := w.generic(n, path)
+	return v, err == nil, err
+}
+
+// generic converts a node of arbitrary type.
+func (w *walker) generic(n *yaml.Node, path string) (any, error) {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.AliasNode:
+		return w.walk(n, nil, path)
+	case yaml.MappingNode:
+		return w.mapping(n, reflect.TypeOf(map[string]any{}), path)
+	case yaml.SequenceNode:
+		return w.walk(n, reflect.TypeOf([]any{}), path)
+	}
+	var v any
+	if err := n.Decode(&v); err != nil {
+		return nil, w.errorf(n, path, "%v", err)
+	}
+	if f, ok := v.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+		return nil, w.errorf(n, path, "%s cannot be represented in JSON", n.Value)
+	}
+	return v, nil
+}
+
+// fields adds the fields of the struct type t to fields by name,
+// including those of embedded structs.
+func (w *walker) fields(t reflect.Type, fields map[string]reflect.Type) map[string]reflect.Type {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get(w.tag), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		inline := strings.Contains(opts, "inline")
+		if w.tag == "json" {
+			inline = f.Anonymous && name == "" && ft.Kind() == reflect.Struct
+		}
+		switch {
+		case inline:
+			w.fields(ft, fields)
+		case !f.IsExported():
+		case name != "":
+			fields[name] = f.Type
+		case w.tag == "yaml":
+			fields[strings.ToLower(f.Name)] = f.Type
+		default:
+			fields[f.Name] = f.Type
+		}
+	}
+	return fields
+}
+
+// lookupField finds the field named key, falling back to a
+// case-insensitive match as encoding/json does when fold is set.
+func lookupField(fields map[string]reflect.Type, key string, fold bool) (string, reflect.Type, bool) {
+	if t, ok := fields[key]; ok {
+		return key, t, true
+	}
+	if fold {
+		for name, t := range fields {
+			if strings.EqualFold(name, key) {
+				return name, t, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func typeName(t reflect.Type) string {
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return "object"
+}
+
+func describeType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if t == durationType {
+			return "a duration"
+		}
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Struct, reflect.Map:
+		return "a mapping"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "a string"
+		}
+		return "a list"
+	}
+	return t.String()
+}
+
+func describeNode(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	return strconv.Quote(n.Value)
+}
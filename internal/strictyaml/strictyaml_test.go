@@ -0,0 +1,118 @@
+package strictyaml
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type doc struct {
+	Name    string            `json:"name"`
+	Count   int               `json:"count,omitempty"`
+	Enabled *bool             `json:"enabled,omitempty"`
+	Digest  map[string]string `json:"digest,omitempty"`
+	Items   []item            `json:"items,omitempty"`
+	Extra   json.RawMessage   `json:"extra,omitempty"`
+}
+
+type item struct {
+	Value any `json:"value"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	data := []byte(`
+name: app
+count: 3
+enabled: true
+digest:
+  sha256: 1234
+  created: 2024-06-01
+items:
+  - value: 1.5
+  - value: {nested: [a, b]}
+extra:
+  when: 2024-06-01
+`)
+	var d doc
+	if err := Unmarshal(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	// Scalars decoded into strings keep the text they were written as.
+	if d.Name != "app" || d.Count != 3 || d.Enabled == nil || !*d.Enabled ||
+		d.Digest["sha256"] != "1234" || d.Digest["created"] != "2024-06-01" || len(d.Items) != 2 {
+		t.Errorf("Unmarshal() = %+v", d)
+	}
+	if string(d.Extra) != `{"when":"2024-06-01T00:00:00Z"}` {
+		t.Errorf("extra = %s", d.Extra)
+	}
+
+	var j doc
+	if err := Unmarshal([]byte(`{"name": "app", "items": [{"value": null}]}`), &j); err != nil || j.Name != "app" {
+		t.Errorf("Unmarshal(JSON) = %+v, %v", j, err)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"name: app\nnmae: typo\n", `line 2, column 1: unknown field "nmae" in doc`},
+		{"name: app\ncount: three\n", `line 2, column 8: count: expected an integer, got "three"`},
+		{"items:\n  - value: 1\n  - valeu: 2\n", `line 3, column 5: items[1]: unknown field "valeu" in item`},
+		{"name: [a]\n", `line 1, column 7: name: expected a string, got a list`},
+		{"digest: sha256\n", `line 1, column 9: digest: expected a mapping, got "sha256"`},
+		{"{\"name\": \"app\",\n \"enabled\": \"yes\"}", `line 2, column 13: enabled: expected a boolean, got "yes"`},
+	}
+	for _, tt := range tests {
+		var d doc
+		err := Unmarshal([]byte(tt.data), &d)
+		var serr *Error
+		if !errors.As(err, &serr) || err.Error() != tt.want {
+			t.Errorf("Unmarshal(%q) = %v, want %s", tt.data, err, tt.want)
+		}
+	}
+}
+
+func TestCheckYAMLTags(t *testing.T) {
+	type config struct {
+		Addr     string        `yaml:"addr"`
+		Interval time.Duration `yaml:"interval"`
+		Inline   struct {
+			Dev bool `yaml:"dev"`
+		} `yaml:",inline"`
+	}
+	check := func(data string) error {
+		var n yaml.Node
+		if err := yaml.Unmarshal([]byte(data), &n); err != nil {
+			t.Fatal(err)
+		}
+		return Check(&n, &config{})
+	}
+	if err := check("addr: :8080\ninterval: 5m\ndev: true\n"); err != nil {
+		t.Errorf("Check() = %v", err)
+	}
+	if err := check("addr: :8080\ninterval: 5 minutes\n"); err == nil || err.Error() != `line 2, column 11: interval: invalid duration "5 minutes"` {
+		t.Errorf("Check(bad duration) = %v", err)
+	}
+	if err := check("adr: :8080\n"); err == nil || err.Error() != `line 1, column 1: unknown field "adr" in config` {
+		t.Errorf("Check(unknown field) = %v", err)
+	}
+}
+
+func TestAliasExpansionIsBounded(t *testing.T) {
+	data := "a: &a [x, x, x, x, x, x, x, x, x, x]\n"
+	prev := "a"
+	for _, name := range []string{"b", "c", "d", "e", "f", "g", "h"} {
+		data += name + ": &" + name + " [" + strings.Repeat("*"+prev+", ", 9) + "*" + prev + "]\n"
+		prev = name
+	}
+	var v map[string]any
+	if err := Unmarshal([]byte(data), &v); err == nil || !strings.Contains(err.Error(), "expands to more than") {
+		t.Errorf("Unmarshal(alias bomb) = %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+// Package strutil holds small string helpers shared by the command line
+// and the test support packages.
+package strutil
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// CutLast slices s around the last instance of sep, returning the text
+// before and after it. When sep does not appear it returns s, "", false.
+func CutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// FirstLine returns s up to its first newline.
+func FirstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// Default returns s, or def when s is empty.
+func Default(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// Truncate shortens s to at most n runes, marking the cut with an
+// ellipsis that counts towards n.
+func Truncate(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,63 @@
+package strutil
+
+import "testing"
+
+func TestCutLast(t *testing.T) {
+	for _, tt := range []struct {
+		s, sep        string
+		before, after string
+		found         bool
+	}{
+		{"org/app/manifests/v1", "/manifests/", "org/app", "v1", true},
+		{"a/manifests/b/manifests/c", "/manifests/", "a/manifests/b", "c", true},
+		{"org/app/blobs/", "/blobs/", "org/app", "", true},
+		{"org/app", "/blobs/", "org/app", "", false},
+		{"", "/", "", "", false},
+	} {
+		before, after, found := CutLast(tt.s, tt.sep)
+		if before != tt.before || after != tt.after || found != tt.found {
+			t.Errorf("CutLast(%q, %q) = %q, %q, %v; want %q, %q, %v", tt.s, tt.sep, before, after, found, tt.before, tt.after, tt.found)
+		}
+	}
+}
+
+func TestFirstLine(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                     "",
+		"one line":             "one line",
+		"summary\nmore detail": "summary",
+		"\nleading newline":    "",
+	} {
+		if got := FirstLine(in); got != want {
+			t.Errorf("FirstLine(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDefault(t *testing.T) {
+	if got := Default("", "-"); got != "-" {
+		t.Errorf("Default(\"\", \"-\") = %q", got)
+	}
+	if got := Default(" ", "-"); got != " " {
+		t.Errorf("Default(\" \", \"-\") = %q, want the blank string kept", got)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exact", 5, "exact"},
+		{"too long", 5, "too …"},
+		{"héllo wörld", 6, "héllo…"},
+		{"anything", 1, "…"},
+		{"anything", 0, ""},
+	} {
+		if got := Truncate(tt.s, tt.n); got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
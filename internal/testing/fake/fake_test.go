@@ -0,0 +1,90 @@
+package fake
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/cosign"
+	"github.com/waveywaves/tekton-slsa-demo/internal/rekor"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+)
+
+func TestRekorInclusionProofs(t *testing.T) {
+	log := NewRekor(t)
+	var bundles []*rekor.Bundle
+	for i := 0; i < 7; i++ {
+		sum := sha256.Sum256([]byte{byte(i)})
+		bundles = append(bundles, log.LogHashedRekord(t, []byte{byte(i)}, sum[:]))
+
+		// Every entry so far must prove inclusion in the grown tree.
+		for _, b := range bundles {
+			entry, err := log.Client().EntryByIndex(context.Background(), b.Payload.LogIndex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaf, err := b.LeafHash()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := rekor.VerifyInclusion(entry.Verification.InclusionProof, leaf); err != nil {
+				t.Errorf("tree size %d, index %d: %v", len(bundles), b.Payload.LogIndex, err)
+			}
+		}
+	}
+
+	pub, err := log.Client().PublicKey(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bundles[3].VerifySET(pub); err != nil {
+		t.Errorf("VerifySET: %v", err)
+	}
+}
+
+func TestFulcioKeylessSigner(t *testing.T) {
+	ca := NewFulcio(t)
+	s, err := signing.NewKeylessSigner(context.Background(), ca.URL, Token("https://github.com/example/app/.github/workflows/build.yaml@refs/heads/main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	san, issuer := signing.CertificateIdentity(s.Chain[0])
+	if san != "https://github.com/example/app/.github/workflows/build.yaml@refs/heads/main" || issuer != DefaultIssuer {
+		t.Errorf("identity = %q, %q", san, issuer)
+	}
+	if err := s.Chain[0].CheckSignatureFrom(ca.CA); err != nil {
+		t.Errorf("certificate not issued by the CA: %v", err)
+	}
+}
+
+func TestSignImage(t *testing.T) {
+	reg := NewRegistry(t)
+	ref := reg.PushImage(t, "app:v1")
+	id := KeyIdentity(t)
+	SignImage(t, reg, ref, id, nil)
+	SignImage(t, reg, ref, id, nil)
+	Attest(t, reg, ref, Provenance(t, ref), id, nil)
+
+	ctx := context.Background()
+	digest, err := reg.Client().Resolve(ctx, reg.Ref(t, "app:v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != ref.Digest {
+		t.Errorf("resolved %s, pushed %s", digest, ref.Digest)
+	}
+	sigs, err := cosign.Signatures(ctx, reg.Client(), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 2 {
+		t.Errorf("got %d signatures, want 2", len(sigs))
+	}
+	atts, err := cosign.Attestations(ctx, reg.Client(), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(atts) != 1 || atts[0].PredicateType != Provenance(t, ref).PredicateType {
+		t.Errorf("attestations = %+v", atts)
+	}
+}
@@ -0,0 +1,226 @@
+package fake
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/clock"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+)
+
+// DefaultIssuer is the OIDC issuer Fulcio records in certificates unless
+// Fulcio.Issuer is changed.
+const DefaultIssuer = "https://token.actions.githubusercontent.com"
+
+// Fulcio is a certificate authority that issues short-lived code signing
+// certificates the way Fulcio does. It does not verify identity tokens: the
+// token's email or sub claim is trusted as is.
+type Fulcio struct {
+	// URL is the base URL of the CA's HTTP server.
+	URL string
+	CA  *x509.Certificate
+	Key *ecdsa.PrivateKey
+	// Issuer is recorded in the OIDC issuer extension of new certificates.
+	Issuer string
+	// Clock sets the validity window of new certificates.
+	Clock clock.Clock
+
+	mu     sync.Mutex
+	serial int64
+}
+
+// NewFulcio starts a CA with a fresh self-signed root that is shut down
+// when the test ends.
+func NewFulcio(t testing.TB) *Fulcio {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"sigstore.dev"}, CommonName: "fake-fulcio"},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &Fulcio{CA: ca, Key: key, Issuer: DefaultIssuer, Clock: clock.System{}, serial: 1}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	f.URL = srv.URL
+	return f
+}
+
+// RootPEM returns the CA certificate PEM-encoded.
+func (f *Fulcio) RootPEM() string {
+	return pemCertificate(f.CA)
+}
+
+// Issue signs a certificate for pub bound to identity: a URI subject
+// alternative name when identity has a scheme, otherwise an email address.
+func (f *Fulcio) Issue(t testing.TB, pub crypto.PublicKey, identity string) *x509.Certificate {
+	t.Helper()
+	cert, err := f.issue(pub, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func (f *Fulcio) issue(pub crypto.PublicKey, identity string) (*x509.Certificate, error) {
+	f.mu.Lock()
+	f.serial++
+	serial := f.serial
+	f.mu.Unlock()
+
+	issuer, err := asn1.Marshal(f.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	now := f.Clock.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(serial),
+		NotBefore:       now.Add(-time.Minute),
+		NotAfter:        now.Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		ExtraExtensions: []pkix.Extension{{Id: signing.OIDIssuerV2, Value: issuer}},
+	}
+	if u, err := url.Parse(identity); err == nil && u.Scheme != "" {
+		tmpl.URIs = []*url.URL{u}
+	} else {
+		tmpl.EmailAddresses = []string{identity}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, f.CA, pub, f.Key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// Token returns an unsigned identity token for identity, accepted by this
+// CA and by signing.NewKeylessSigner.
+func Token(identity string) string {
+	claims, _ := json.Marshal(map[string]string{"iss": DefaultIssuer, "sub": identity})
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString(claims) + "." + enc.EncodeToString([]byte("sig"))
+}
+
+func (f *Fulcio) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case "/api/v1/rootCert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		fmt.Fprint(w, f.RootPEM())
+	case "/api/v2/signingCert":
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		f.signingCert(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (f *Fulcio) signingCert(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Credentials struct {
+			OIDCIdentityToken string `json:"oidcIdentityToken"`
+		} `json:"credentials"`
+		PublicKeyRequest struct {
+			PublicKey struct {
+				Content string `json:"content"`
+			} `json:"publicKey"`
+		} `json:"publicKeyRequest"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	identity, err := tokenIdentity(body.Credentials.OIDCIdentityToken)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	pub, err := signing.ParsePublicKey([]byte(body.PublicKeyRequest.PublicKey.Content))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cert, err := f.issue(pub, identity)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var resp struct {
+		SignedCertificateEmbeddedSct struct {
+			Chain struct {
+				Certificates []string `json:"certificates"`
+			} `json:"chain"`
+		} `json:"signedCertificateEmbeddedSct"`
+	}
+	resp.SignedCertificateEmbeddedSct.Chain.Certificates = []string{pemCertificate(cert), f.RootPEM()}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// tokenIdentity returns the email claim of an identity token, or its sub
+// claim when there is no email.
+func tokenIdentity(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("identity token is not a JWT")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+	var claims struct {
+		Subject string `json:"sub"`
+		Email   string `json:"email"`
+	}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return "", err
+	}
+	if claims.Email != "" {
+		return claims.Email, nil
+	}
+	if claims.Subject == "" {
+		return "", errors.New("identity token has no sub or email claim")
+	}
+	return claims.Subject, nil
+}
+
+func pemCertificate(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
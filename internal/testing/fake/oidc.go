@@ -0,0 +1,123 @@
+package fake
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// OIDC is an OpenID Connect provider that signs in Email without asking,
+// supporting the authorization code flow with PKCE. Its ID tokens are not
+// signed.
+type OIDC struct {
+	// URL is the issuer, the base URL of the provider's HTTP server.
+	URL      string
+	ClientID string
+	// Email is the verified email address of the user signing in next.
+	Email string
+
+	mu    sync.Mutex
+	codes map[string]oidcGrant
+	next  int
+}
+
+// oidcGrant is an authorization code waiting to be redeemed.
+type oidcGrant struct {
+	redirectURI, challenge, nonce, email string
+}
+
+// NewOIDC starts a provider for clientID that is shut down when the test
+// ends.
+func NewOIDC(t testing.TB, clientID string) *OIDC {
+	t.Helper()
+	p := &OIDC{ClientID: clientID, Email: "admin@example.com", codes: map[string]oidcGrant{}}
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	p.URL = srv.URL
+	return p
+}
+
+func (p *OIDC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+		})
+	case "/authorize":
+		p.authorize(w, r)
+	case "/token":
+		p.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorize signs Email in and redirects back with a code.
+func (p *OIDC) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != p.ClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	p.next++
+	code := "code-" + strconv.Itoa(p.next)
+	p.codes[code] = oidcGrant{redirectURI: redirect.String(), challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), email: p.Email}
+	p.mu.Unlock()
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token redeems a code once, checking the PKCE verifier.
+func (p *OIDC) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	g, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok, r.PostForm.Get("grant_type") != "authorization_code", r.PostForm.Get("redirect_uri") != g.redirectURI,
+		base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+	claims, _ := json.Marshal(map[string]any{
+		"iss":            p.URL,
+		"sub":            "user-" + g.email,
+		"aud":            p.ClientID,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          g.nonce,
+		"email":          g.email,
+		"email_verified": true,
+	})
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "access-" + g.email,
+		"token_type":   "Bearer",
+		"id_token":     header + "." + base64.RawURLEncoding.EncodeToString(claims) + ".",
+	})
+}
@@ -0,0 +1,261 @@
+// Package fake provides in-process fakes of an OCI registry, a Rekor
+// transparency log and a Fulcio certificate authority, plus helpers that
+// sign images and attach attestations the way cosign and Tekton Chains do.
+// Together they let tests run the verification pipeline end to end without
+// network access.
+package fake
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/strutil"
+)
+
+// Registry is an in-memory OCI distribution registry. It implements enough
+// of the API for oci.Client: manifests by tag or digest, tag lists, blobs,
+// and monolithic blob uploads.
+type Registry struct {
+	// URL is the base URL of the registry's HTTP server.
+	URL string
+
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string]map[string]storedManifest
+	uploads   int
+}
+
+type storedManifest struct {
+	mediaType string
+	data      []byte
+}
+
+// NewRegistry starts a registry that is shut down when the test ends.
+func NewRegistry(t testing.TB) *Registry {
+	t.Helper()
+	r := &Registry{blobs: map[string][]byte{}, manifests: map[string]map[string]storedManifest{}}
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	r.URL = srv.URL
+	return r
+}
+
+// Host is the registry host to use in image references.
+func (r *Registry) Host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+// Client returns an oci.Client that talks to the registry over plain HTTP.
+func (r *Registry) Client() *oci.Client {
+	return &oci.Client{
+		HTTP:        http.DefaultClient,
+		Insecure:    true,
+		Credentials: func(string) (string, string) { return "", "" },
+	}
+}
+
+// Ref parses name, e.g. "app:v1", as a reference into the registry.
+func (r *Registry) Ref(t testing.TB, name string) oci.Reference {
+	t.Helper()
+	ref, err := oci.ParseReference(r.Host() + "/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+// PushImage pushes a minimal image under name, e.g. "app:v1", and returns
+// its reference pinned to the manifest digest.
+func (r *Registry) PushImage(t testing.TB, name string) oci.Reference {
+	t.Helper()
+	ctx := context.Background()
+	ref := r.Ref(t, name)
+	c := r.Client()
+	layer, err := c.PutBlob(ctx, ref, "application/vnd.oci.image.layer.v1.tar", []byte(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := fmt.Sprintf(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[%q]}}`, layer.Digest)
+	configDesc, err := c.PutBlob(ctx, ref, "application/vnd.oci.image.config.v1+json", []byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := c.PutManifest(ctx, ref, &oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeOCIManifest,
+		Config:        &configDesc,
+		Layers:        []oci.Descriptor{layer},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref.WithDigest(digest)
+}
+
+// PushIndex pushes a minimal image for each platform ("os/arch[/variant]")
+// and a multi-platform index of them under name. It returns the index and
+// the platform images, all pinned by digest.
+func (r *Registry) PushIndex(t testing.TB, name string, platforms ...string) (oci.Reference, []oci.Reference) {
+	t.Helper()
+	ctx := context.Background()
+	ref := r.Ref(t, name)
+	repo, _, _ := strutil.CutLast(name, ":")
+	index := &oci.Manifest{SchemaVersion: 2, MediaType: oci.MediaTypeOCIIndex}
+	var children []oci.Reference
+	for _, p := range platforms {
+		child := r.PushImage(t, repo+":"+strings.ReplaceAll(p, "/", "-"))
+		m, raw, _, err := r.Client().GetManifest(ctx, child)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.SplitN(p, "/", 3)
+		platform := &oci.Platform{OS: parts[0]}
+		if len(parts) > 1 {
+			platform.Architecture = parts[1]
+		}
+		if len(parts) > 2 {
+			platform.Variant = parts[2]
+		}
+		index.Manifests = append(index.Manifests, oci.Descriptor{
+			MediaType: m.MediaType,
+			Digest:    child.Digest,
+			Size:      int64(len(raw)),
+			Platform:  platform,
+		})
+		children = append(children, child)
+	}
+	digest, err := r.Client().PutManifest(ctx, ref, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref.WithDigest(digest), children
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	path := req.URL.Path
+	if path == "/v2/" || path == "/v2" {
+		return
+	}
+	if !strings.HasPrefix(path, "/v2/") {
+		http.NotFound(w, req)
+		return
+	}
+	path = strings.TrimPrefix(path, "/v2/")
+	if repo, ok := strings.CutSuffix(path, "/tags/list"); ok {
+		r.tags(w, repo)
+		return
+	}
+	if repo, id, ok := strutil.CutLast(path, "/manifests/"); ok {
+		r.manifest(w, req, repo, id)
+		return
+	}
+	if repo, id, ok := strutil.CutLast(path, "/blobs/uploads/"); ok {
+		r.upload(w, req, repo, id)
+		return
+	}
+	if _, digest, ok := strutil.CutLast(path, "/blobs/"); ok {
+		data, found := r.blobs[digest]
+		if !found {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Header().Set("Docker-Content-Digest", digest)
+		if req.Method != http.MethodHead {
+			w.Write(data)
+		}
+		return
+	}
+	http.NotFound(w, req)
+}
+
+func (r *Registry) manifest(w http.ResponseWriter, req *http.Request, repo, id string) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		m, ok := r.manifests[repo][id]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Content-Length", fmt.Sprint(len(m.data)))
+		w.Header().Set("Docker-Content-Digest", digestOf(m.data))
+		if req.Method == http.MethodGet {
+			w.Write(m.data)
+		}
+	case http.MethodPut:
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m := storedManifest{mediaType: req.Header.Get("Content-Type"), data: data}
+		if r.manifests[repo] == nil {
+			r.manifests[repo] = map[string]storedManifest{}
+		}
+		digest := digestOf(data)
+		r.manifests[repo][id] = m
+		r.manifests[repo][digest] = m
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// tags lists the tags of repo, everything manifests were stored under
+// except digests.
+func (r *Registry) tags(w http.ResponseWriter, repo string) {
+	tags := []string{}
+	for id := range r.manifests[repo] {
+		if !strings.Contains(id, ":") {
+			tags = append(tags, id)
+		}
+	}
+	sort.Strings(tags)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"name": repo, "tags": tags})
+}
+
+func (r *Registry) upload(w http.ResponseWriter, req *http.Request, repo, id string) {
+	switch {
+	case req.Method == http.MethodPost && id == "":
+		r.uploads++
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%d", repo, r.uploads))
+		w.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodPut && id != "":
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		digest := req.URL.Query().Get("digest")
+		if digest != digestOf(data) {
+			http.Error(w, "digest does not match the uploaded content", http.StatusBadRequest)
+			return
+		}
+		r.blobs[digest] = data
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,243 @@
+package fake
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/clock"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/rekor"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+)
+
+// Rekor is an in-memory transparency log. Entries get signed entry
+// timestamps from the log's key and inclusion proofs against the current
+// tree, computed as RFC 6962 Merkle audit paths.
+type Rekor struct {
+	// URL is the base URL of the log's HTTP server.
+	URL string
+	Key *ecdsa.PrivateKey
+	// Clock sets the integrated time of new entries.
+	Clock clock.Clock
+
+	mu      sync.Mutex
+	entries []rekor.LogEntry
+	leaves  [][]byte
+}
+
+// NewRekor starts a log that is shut down when the test ends.
+func NewRekor(t testing.TB) *Rekor {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Rekor{Key: key, Clock: clock.System{}}
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	r.URL = srv.URL
+	return r
+}
+
+// Client returns a rekor.Client for the log.
+func (r *Rekor) Client() *rekor.Client {
+	return rekor.NewClient(r.URL)
+}
+
+// LogID is the log's ID as recorded in its entries.
+func (r *Rekor) LogID(t testing.TB) string {
+	t.Helper()
+	id, err := rekor.LogID(r.Key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// PublicKeyPEM returns the log's public key.
+func (r *Rekor) PublicKeyPEM(t testing.TB) string {
+	t.Helper()
+	p, err := signing.MarshalPublicKey(r.Key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(p)
+}
+
+// LogHashedRekord records a signature over payload, as cosign does for
+// image signatures, and returns the entry's bundle.
+func (r *Rekor) LogHashedRekord(t testing.TB, payload, sig []byte) *rekor.Bundle {
+	t.Helper()
+	sum := sha256.Sum256(payload)
+	return r.add(t, map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]any{
+			"data":      map[string]any{"hash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(sum[:])}},
+			"signature": map[string]any{"content": base64.StdEncoding.EncodeToString(sig)},
+		},
+	})
+}
+
+// LogDSSE records a DSSE envelope, as cosign does for attestations, and
+// returns the entry's bundle.
+func (r *Rekor) LogDSSE(t testing.TB, env *dsse.Envelope) *rekor.Bundle {
+	t.Helper()
+	payload, err := env.DecodePayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(payload)
+	sigs := make([]map[string]string, len(env.Signatures))
+	for i, sig := range env.Signatures {
+		sigs[i] = map[string]string{"signature": sig.Sig}
+	}
+	return r.add(t, map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "dsse",
+		"spec": map[string]any{
+			"payloadHash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(sum[:])},
+			"signatures":  sigs,
+		},
+	})
+}
+
+func (r *Rekor) add(t testing.TB, body any) *rekor.Bundle {
+	t.Helper()
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := &rekor.Bundle{Payload: rekor.BundlePayload{
+		Body:           base64.StdEncoding.EncodeToString(raw),
+		IntegratedTime: r.Clock.Now().Unix(),
+		LogIndex:       int64(len(r.entries)),
+		LogID:          r.LogID(t),
+	}}
+	canonical, err := json.Marshal(map[string]any{
+		"body":           b.Payload.Body,
+		"integratedTime": b.Payload.IntegratedTime,
+		"logID":          b.Payload.LogID,
+		"logIndex":       b.Payload.LogIndex,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(canonical)
+	if b.SignedEntryTimestamp, err = ecdsa.SignASN1(rand.Reader, r.Key, digest[:]); err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := b.LeafHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e rekor.LogEntry
+	e.Body = b.Payload.Body
+	e.IntegratedTime = b.Payload.IntegratedTime
+	e.LogID = b.Payload.LogID
+	e.LogIndex = b.Payload.LogIndex
+	e.Verification.SignedEntryTimestamp = b.SignedEntryTimestamp
+	r.entries = append(r.entries, e)
+	r.leaves = append(r.leaves, leaf)
+	return b
+}
+
+// BundleAnnotation encodes b as cosign stores it on signature layers.
+func BundleAnnotation(t testing.TB, b *rekor.Bundle) string {
+	t.Helper()
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func (r *Rekor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch req.URL.Path {
+	case "/api/v1/log/publicKey":
+		p, err := signing.MarshalPublicKey(r.Key.Public())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Write(p)
+	case "/api/v1/log/entries":
+		index, err := strconv.Atoi(req.URL.Query().Get("logIndex"))
+		if err != nil || index < 0 || index >= len(r.entries) {
+			http.NotFound(w, req)
+			return
+		}
+		e := r.entries[index]
+		path := auditPath(index, r.leaves)
+		hashes := make([]string, len(path))
+		for i, h := range path {
+			hashes[i] = hex.EncodeToString(h)
+		}
+		e.Verification.InclusionProof = &rekor.InclusionProof{
+			LogIndex: int64(index),
+			RootHash: hex.EncodeToString(treeHash(r.leaves)),
+			TreeSize: int64(len(r.leaves)),
+			Hashes:   hashes,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]rekor.LogEntry{fmt.Sprintf("%016x", index): e})
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// treeHash is the RFC 6962 Merkle tree hash of the given leaf hashes.
+func treeHash(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := split(len(leaves))
+	return nodeHash(treeHash(leaves[:k]), treeHash(leaves[k:]))
+}
+
+// auditPath is the RFC 6962 audit path for leaf m, ordered from the leaf
+// up.
+func auditPath(m int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := split(len(leaves))
+	if m < k {
+		return append(auditPath(m, leaves[:k]), treeHash(leaves[k:]))
+	}
+	return append(auditPath(m-k, leaves[k:]), treeHash(leaves[:k]))
+}
+
+// split returns the largest power of two smaller than n.
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
@@ -0,0 +1,180 @@
+package fake
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cosign"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+)
+
+// Identity is a signing key and, for keyless signing, the certificate
+// Fulcio bound it to.
+type Identity struct {
+	Signer *signing.Signer
+	// Certificate is the PEM signing certificate; empty for key-based
+	// signing.
+	Certificate string
+	Chain       string
+}
+
+// KeyIdentity returns an identity with a fresh key and no certificate.
+func KeyIdentity(t testing.TB) *Identity {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := signing.NewSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Identity{Signer: s}
+}
+
+// Identity returns an identity with a fresh key certified by f for
+// subject, as keyless signing produces.
+func (f *Fulcio) Identity(t testing.TB, subject string) *Identity {
+	t.Helper()
+	id := KeyIdentity(t)
+	id.Certificate = pemCertificate(f.Issue(t, id.Signer.Public(), subject))
+	id.Chain = f.RootPEM()
+	return id
+}
+
+// PublicKeyPEM returns the identity's public key.
+func (id *Identity) PublicKeyPEM(t testing.TB) string {
+	t.Helper()
+	p, err := signing.MarshalPublicKey(id.Signer.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(p)
+}
+
+func (id *Identity) annotations() map[string]string {
+	a := map[string]string{}
+	if id.Certificate != "" {
+		a[cosign.AnnotationCertificate] = id.Certificate
+		a[cosign.AnnotationChain] = id.Chain
+	}
+	return a
+}
+
+// Provenance returns a SLSA v1 provenance statement about the image at ref,
+// which must be pinned by digest.
+func Provenance(t testing.TB, ref oci.Reference) *attestation.Statement {
+	t.Helper()
+	alg, hex := splitDigest(t, ref.Digest)
+	stmt, err := attestation.NewStatement(attestation.PredicateSLSAProvenanceV1, attestation.Provenance{
+		BuildDefinition: attestation.BuildDefinition{
+			BuildType:          "https://tekton.dev/chains/v2/slsa",
+			ExternalParameters: map[string]any{"runSpec": map[string]any{"pipelineRef": map[string]any{"name": "build"}}},
+		},
+		RunDetails: attestation.RunDetails{
+			Builder: attestation.Builder{ID: "https://tekton.dev/chains/v2"},
+		},
+	}, attestation.Subject{Name: ref.Name(), Digest: map[string]string{alg: hex}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stmt
+}
+
+// SignImage signs the image at ref, which must be pinned by digest, and
+// attaches the signature under cosign's .sig tag. When log is not nil the
+// signature is recorded there and its bundle attached too.
+func SignImage(t testing.TB, reg *Registry, ref oci.Reference, id *Identity, log *Rekor) {
+	t.Helper()
+	var ss cosign.SimpleSigning
+	ss.Critical.Identity.DockerReference = ref.Name()
+	ss.Critical.Image.DockerManifestDigest = ref.Digest
+	ss.Critical.Type = "cosign container image signature"
+	payload, err := json.Marshal(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := id.Signer.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	annotations := id.annotations()
+	annotations[cosign.AnnotationSignature] = base64.StdEncoding.EncodeToString(sig)
+	if log != nil {
+		annotations[cosign.AnnotationBundle] = BundleAnnotation(t, log.LogHashedRekord(t, payload, sig))
+	}
+
+	ctx := context.Background()
+	c := reg.Client()
+	sigRef := ref.WithTag(cosign.Tag(ref.Digest, "sig"))
+	var layers []oci.Descriptor
+	if existing, _, _, err := c.GetManifest(ctx, sigRef); err == nil {
+		layers = existing.Layers
+	}
+	layer, err := c.PutBlob(ctx, sigRef, cosign.MediaTypeSimpleSigning, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer.Annotations = annotations
+	layers = append(layers, layer)
+	config, err := c.PutBlob(ctx, sigRef, "application/vnd.oci.image.config.v1+json", []byte(`{"architecture":"","os":"","config":{},"rootfs":{"type":"layers","diff_ids":[]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.PutManifest(ctx, sigRef, &oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeOCIManifest,
+		Config:        &config,
+		Layers:        layers,
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Attest signs stmt as a DSSE envelope and attaches it to the image at
+// ref, which must be pinned by digest, under cosign's .att tag. When log is
+// not nil the envelope is recorded there and its bundle attached too. The
+// signed envelope is returned.
+func Attest(t testing.TB, reg *Registry, ref oci.Reference, stmt *attestation.Statement, id *Identity, log *Rekor) *dsse.Envelope {
+	t.Helper()
+	payload, err := json.Marshal(stmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := dsse.Sign(attestation.PayloadType, payload, id.Signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	annotations := id.annotations()
+	if log != nil {
+		annotations[cosign.AnnotationBundle] = BundleAnnotation(t, log.LogDSSE(t, env))
+	}
+	if err := cosign.Attach(context.Background(), reg.Client(), ref, raw, stmt.PredicateType, annotations); err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func splitDigest(t testing.TB, digest string) (alg, hex string) {
+	t.Helper()
+	alg, hex, ok := strings.Cut(digest, ":")
+	if !ok {
+		t.Fatalf("reference is not pinned by digest: %q", digest)
+	}
+	return alg, hex
+}
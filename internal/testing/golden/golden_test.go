@@ -0,0 +1,21 @@
+package golden
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		want, got, line string
+	}{
+		{"a\nb\nc\n", "a\nB\nc\n", "line 2:"},
+		{"a\nb\n", "a\nb\nc\n", "line 3:"},
+		{"a\nb\nc", "a\nb", "line 3:"},
+	}
+	for _, tt := range tests {
+		if d := diff([]byte(tt.want), []byte(tt.got)); !strings.HasPrefix(d, tt.line) {
+			t.Errorf("diff(%q, %q) = %q, want prefix %q", tt.want, tt.got, d, tt.line)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package httptestutil serves requests against an http.Handler in memory
+// and asserts on the recorded responses, so handler tests read as a list of
+// expectations instead of recorder and decoding boilerplate.
+package httptestutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/jsondiff"
+	"github.com/waveywaves/tekton-slsa-demo/internal/strutil"
+)
+
+// maxBody bounds how much of a response body failure messages quote.
+const maxBody = 512
+
+// Do serves req with h and returns the recorded response.
+func Do(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// Get serves a GET request for target with h.
+func Get(h http.Handler, target string) *httptest.ResponseRecorder {
+	return Do(h, httptest.NewRequest(http.MethodGet, target, nil))
+}
+
+// AssertStatus stops the test unless the response has status want. The
+// failure quotes the start of the body, which usually says what went wrong.
+func AssertStatus(t testing.TB, rr *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rr.Code != want {
+		t.Fatalf("status %d, want %d: %s", rr.Code, want, strutil.Truncate(rr.Body.String(), maxBody))
+	}
+}
+
+// AssertHeader fails the test unless header name of the response is want.
+func AssertHeader(t testing.TB, rr *httptest.ResponseRecorder, name, want string) {
+	t.Helper()
+	if got := rr.Header().Get(name); got != want {
+		t.Errorf("%s = %q, want %q", name, got, want)
+	}
+}
+
+// AssertContains fails the test for each of substrs the response body does
+// not contain.
+func AssertContains(t testing.TB, rr *httptest.ResponseRecorder, substrs ...string) {
+	t.Helper()
+	body := rr.Body.String()
+	for _, s := range substrs {
+		if !strings.Contains(body, s) {
+			t.Errorf("body does not contain %q: %s", s, strutil.Truncate(body, maxBody))
+		}
+	}
+}
+
+// DecodeJSON stops the test unless the response body decodes into v.
+func DecodeJSON(t testing.TB, rr *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(rr.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding response: %v: %s", err, strutil.Truncate(rr.Body.String(), maxBody))
+	}
+}
+
+// AssertJSONEqual fails the test unless got and want are the same JSON
+// document. Object key order and whitespace are ignored; each differing
+// path is reported.
+func AssertJSONEqual(t testing.TB, got, want []byte) {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("got is not JSON: %v: %s", err, strutil.Truncate(string(got), maxBody))
+	}
+	if err := json.Unmarshal(want, &w); err != nil {
+		t.Fatalf("want is not JSON: %v", err)
+	}
+	changes := jsondiff.Compare(w, g)
+	if len(changes) == 0 {
+		return
+	}
+	var b strings.Builder
+	for _, c := range changes {
+		if c.Path == "" {
+			c.Path = "(document)"
+		}
+		switch c.Kind {
+		case jsondiff.Added:
+			fmt.Fprintf(&b, "\n  %s: unexpected %s", c.Path, marshal(c.New))
+		case jsondiff.Removed:
+			fmt.Fprintf(&b, "\n  %s: missing, want %s", c.Path, marshal(c.Old))
+		default:
+			fmt.Fprintf(&b, "\n  %s: got %s, want %s", c.Path, marshal(c.New), marshal(c.Old))
+		}
+	}
+	t.Errorf("JSON differs:%s", b.String())
+}
+
+func marshal(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
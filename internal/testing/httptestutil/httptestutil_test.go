@@ -0,0 +1,118 @@
+package httptestutil
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// recorder is a testing.TB that records failures instead of reporting
+// them. Fatalf panics with errFatal, which run recovers.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+var errFatal = errors.New("fatal")
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	panic(errFatal)
+}
+
+// run calls fn with a recorder and returns the failures it reported.
+func run(fn func(t testing.TB)) (failures []string) {
+	r := &recorder{}
+	defer func() {
+		if v := recover(); v != nil && v != errFatal {
+			panic(v)
+		}
+		failures = r.failures
+	}()
+	fn(r)
+	return r.failures
+}
+
+var handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case "/json":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status":"healthy","checks":[1,2]}`)
+	default:
+		http.Error(w, strings.Repeat("x", 2*maxBody), http.StatusNotFound)
+	}
+})
+
+func TestAssertStatus(t *testing.T) {
+	if f := run(func(t testing.TB) { AssertStatus(t, Get(handler, "/json"), http.StatusOK) }); len(f) != 0 {
+		t.Errorf("matching status reported %q", f)
+	}
+	f := run(func(t testing.TB) { AssertStatus(t, Get(handler, "/missing"), http.StatusOK) })
+	if len(f) != 1 || !strings.HasPrefix(f[0], "status 404, want 200: xxx") {
+		t.Fatalf("failures = %q", f)
+	}
+	if len(f[0]) > 2*maxBody {
+		t.Errorf("failure quotes %d bytes of body, want it truncated", len(f[0]))
+	}
+}
+
+func TestAssertHeaderAndContains(t *testing.T) {
+	rr := Get(handler, "/json")
+	f := run(func(t testing.TB) {
+		AssertHeader(t, rr, "Content-Type", "application/json")
+		AssertContains(t, rr, `"healthy"`, `"checks"`)
+	})
+	if len(f) != 0 {
+		t.Errorf("matching response reported %q", f)
+	}
+	f = run(func(t testing.TB) {
+		AssertHeader(t, rr, "Content-Type", "text/html")
+		AssertContains(t, rr, "healthy", "degraded", "failing")
+	})
+	if len(f) != 3 {
+		t.Fatalf("failures = %q, want one for the header and one per missing string", f)
+	}
+	if !strings.Contains(f[1], `"degraded"`) || !strings.Contains(f[2], `"failing"`) {
+		t.Errorf("failures do not name the missing strings: %q", f)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	var v struct{ Status string }
+	if f := run(func(t testing.TB) { DecodeJSON(t, Get(handler, "/json"), &v) }); len(f) != 0 || v.Status != "healthy" {
+		t.Errorf("decoded %+v, failures %q", v, f)
+	}
+	if f := run(func(t testing.TB) { DecodeJSON(t, Get(handler, "/missing"), &v) }); len(f) != 1 {
+		t.Errorf("decoding a plain text body: failures = %q", f)
+	}
+}
+
+func TestAssertJSONEqual(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		got, want string
+		failures  []string
+	}{
+		{"key order and whitespace", `{"a":1, "b":[true]}`, `{ "b": [true], "a": 1 }`, nil},
+		{"changed", `{"a":1}`, `{"a":2}`, []string{"JSON differs:\n  a: got 1, want 2"}},
+		{"added and removed", `{"a":1,"c":[1,2]}`, `{"a":1,"b":"x","c":[1]}`,
+			[]string{"JSON differs:\n  b: missing, want \"x\"\n  c[1]: unexpected 2"}},
+		{"different types", `[1]`, `{"a":1}`, []string{"JSON differs:\n  (document): got [1], want {\"a\":1}"}},
+		{"invalid", `{`, `{}`, []string{"got is not JSON: unexpected end of JSON input: {"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f := run(func(t testing.TB) { AssertJSONEqual(t, []byte(tt.got), []byte(tt.want)) })
+			if fmt.Sprint(f) != fmt.Sprint(tt.failures) {
+				t.Errorf("failures = %q, want %q", f, tt.failures)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+// Package tofu implements trust on first use for demo environments: the
+// first signer identity that verifies for an image repository is pinned,
+// and later signatures or attestations from any other identity are
+// reported as mismatches.
+//
+// Pins are advisory only. A mismatch is reported, not refused, and the
+// pin is whatever identity verified first, so it is only as trustworthy
+// as whoever triggered that verification: callers should pin from
+// verifications they started or authenticated, and compare otherwise.
+package tofu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/fsutil"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// Identity is who signed: a keyless certificate's subject alternative name
+// and OIDC issuer, or a key ID with no issuer.
+type Identity struct {
+	Signer string `json:"signer"`
+	Issuer string `json:"issuer,omitempty"`
+}
+
+func (id Identity) String() string {
+	if id.Issuer == "" {
+		return id.Signer
+	}
+	return id.Signer + " (" + id.Issuer + ")"
+}
+
+// Pin is the identity first seen verifying a repository.
+type Pin struct {
+	Identity
+	// Digest is the image whose verification pinned the identity.
+	Digest   string    `json:"digest"`
+	PinnedAt time.Time `json:"pinnedAt"`
+}
+
+// Mismatch is a verified signature or attestation from an identity other
+// than the pinned one. Its Code is IDENTITY_REJECTED.
+type Mismatch struct {
+	Identity
+	Kind          string       `json:"kind"`
+	PredicateType string       `json:"predicateType,omitempty"`
+	Code          failure.Code `json:"code"`
+}
+
+// Report is the outcome of checking one verification result.
+type Report struct {
+	Repository string `json:"repository"`
+	// Digest is the image the result is about.
+	Digest string `json:"digest"`
+	Pin    Pin    `json:"pin"`
+	// NewPin is true when this result pinned the repository.
+	NewPin     bool       `json:"newPin"`
+	Mismatches []Mismatch `json:"mismatches,omitempty"`
+}
+
+// Alert describes the mismatches for people, or returns "" when there are
+// none.
+func (r *Report) Alert() string {
+	if r == nil || len(r.Mismatches) == 0 {
+		return ""
+	}
+	m := r.Mismatches[0]
+	return fmt.Sprintf("TOFU: %s is pinned to %s since %s, but the %s of %s is signed by %s",
+		r.Repository, r.Pin.Identity, r.Pin.PinnedAt.Format(time.DateOnly),
+		m.Kind, r.Digest, m.Identity)
+}
+
+// MaxPins bounds the repositories pinned, so verifications of ever more
+// repositories cannot grow the pins, and their file, without bound.
+const MaxPins = 10000
+
+// ErrFull is returned by Check when a repository is left unpinned because
+// MaxPins repositories are pinned already.
+var ErrFull = fmt.Errorf("tofu: %d repositories are pinned already", MaxPins)
+
+// Pins holds the pinned identity of each repository, safe for concurrent
+// use. Pins opened from a file save every new pin back to it.
+type Pins struct {
+	path string
+
+	mu   sync.Mutex
+	pins map[string]Pin
+}
+
+// New returns pins that are kept in memory only.
+func New() *Pins {
+	return &Pins{pins: map[string]Pin{}}
+}
+
+// Open reads the pins file at path. A missing file has no pins yet.
+func Open(path string) (*Pins, error) {
+	p := New()
+	p.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &p.pins); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Lookup returns the pin for repository, as oci.Reference.Name spells it.
+func (p *Pins) Lookup(repository string) (Pin, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pin, ok := p.pins[repository]
+	return pin, ok
+}
+
+// Check compares the verified checks of res with the pin for its image's
+// repository, pinning the first verified identity when there is none. It
+// returns nil when the repository is not pinned and nothing verified.
+func (p *Pins) Check(res *verify.Result, now time.Time) (*Report, error) {
+	return p.check(res, now, true)
+}
+
+// Compare is Check without pinning: it returns nil when the repository of
+// res is not pinned yet.
+func (p *Pins) Compare(res *verify.Result) (*Report, error) {
+	return p.check(res, time.Time{}, false)
+}
+
+func (p *Pins) check(res *verify.Result, now time.Time, mayPin bool) (*Report, error) {
+	ref, err := oci.ParseReference(res.Image)
+	if err != nil {
+		return nil, err
+	}
+	repo := ref.Name()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pin, pinned := p.pins[repo]
+	r := &Report{Repository: repo, Digest: res.Digest, Pin: pin}
+	for _, c := range res.Checks {
+		if !c.Verified {
+			continue
+		}
+		id := Identity{Signer: c.Signer, Issuer: c.Issuer}
+		if !pinned {
+			if !mayPin {
+				return nil, nil
+			}
+			if len(p.pins) >= MaxPins {
+				return nil, ErrFull
+			}
+			pin = Pin{Identity: id, Digest: res.Digest, PinnedAt: now.UTC()}
+			pinned = true
+			p.pins[repo] = pin
+			r.Pin, r.NewPin = pin, true
+			continue
+		}
+		if id != pin.Identity {
+			r.Mismatches = append(r.Mismatches, Mismatch{Identity: id, Kind: c.Kind, PredicateType: c.PredicateType, Code: failure.IdentityRejected})
+		}
+	}
+	if !pinned {
+		return nil, nil
+	}
+	if r.NewPin && p.path != "" {
+		if err := p.save(); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// save writes the pins to their file, replacing it atomically. p.mu must
+// be held.
+func (p *Pins) save() error {
+	data, err := json.MarshalIndent(p.pins, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(p.path, append(data, '\n'))
+}
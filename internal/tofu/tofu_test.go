@@ -0,0 +1,84 @@
+package tofu
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+func result(digest string, checks ...verify.Check) *verify.Result {
+	return &verify.Result{Image: "ghcr.io/org/app:v1", Digest: digest, Checks: checks}
+}
+
+func TestPins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pins.json")
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ci := verify.Check{Kind: verify.KindSignature, Signer: "https://github.com/org/app/.github/workflows/release.yml@refs/heads/main", Issuer: "https://token.actions.githubusercontent.com", Verified: true}
+	other := verify.Check{Kind: verify.KindAttestation, Signer: "mallory@example.com", Issuer: "https://accounts.google.com", Verified: true}
+	failed := other
+	failed.Verified = false
+
+	p, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := p.Check(result("sha256:aaa", failed), now); err != nil || r != nil {
+		t.Fatalf("nothing verified: report %+v, %v; want nil", r, err)
+	}
+	r, err := p.Check(result("sha256:aaa", ci, failed), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.NewPin || r.Repository != "ghcr.io/org/app" || r.Pin.Signer != ci.Signer || len(r.Mismatches) != 0 {
+		t.Fatalf("first verification = %+v, want a new pin", r)
+	}
+
+	// The pin survives a restart.
+	if p, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	r, err = p.Check(result("sha256:bbb", ci, other), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.NewPin || len(r.Mismatches) != 1 || r.Mismatches[0].Signer != other.Signer {
+		t.Fatalf("second verification = %+v, want one mismatch", r)
+	}
+	alert := r.Alert()
+	for _, want := range []string{"ghcr.io/org/app", "2024-03-01", "attestation of sha256:bbb", "mallory@example.com"} {
+		if !strings.Contains(alert, want) {
+			t.Errorf("alert %q does not mention %q", alert, want)
+		}
+	}
+
+	if r, _ := p.Check(result("sha256:ccc", ci), now); r.Alert() != "" {
+		t.Errorf("pinned identity raised %q", r.Alert())
+	}
+}
+
+func TestPinsCompareAndLimit(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	signed := verify.Check{Kind: verify.KindSignature, Signer: "release@example.com", Verified: true}
+	p := New()
+	if r, err := p.Compare(result("sha256:aaa", signed)); err != nil || r != nil {
+		t.Fatalf("Compare() on an unpinned repository = %+v, %v; want nil", r, err)
+	}
+	if _, ok := p.Lookup("ghcr.io/org/app"); ok {
+		t.Fatal("Compare() pinned the repository")
+	}
+
+	for i := 0; i < MaxPins; i++ {
+		res := &verify.Result{Image: fmt.Sprintf("ghcr.io/org/app%d:v1", i), Digest: "sha256:aaa", Checks: []verify.Check{signed}}
+		if _, err := p.Check(res, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r, err := p.Check(result("sha256:aaa", signed), now); !errors.Is(err, ErrFull) || r != nil {
+		t.Errorf("Check() beyond MaxPins = %+v, %v; want ErrFull", r, err)
+	}
+}
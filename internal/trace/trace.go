@@ -0,0 +1,82 @@
+// Package trace carries W3C Trace Context identifiers through a request,
+// so metrics exemplars and outbound calls can point at the caller's trace.
+// It does not record spans itself.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Header is the W3C Trace Context request header.
+const Header = "traceparent"
+
+type idKey struct{}
+
+// Parse returns the trace ID of a traceparent header value, e.g.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func Parse(traceparent string) (traceID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", false
+	}
+	traceID, spanID := parts[1], parts[2]
+	if !isHex(traceID, 32) || !isHex(spanID, 16) || allZero(traceID) || allZero(spanID) {
+		return "", false
+	}
+	return traceID, true
+}
+
+// WithID returns a copy of ctx carrying traceID.
+func WithID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, idKey{}, traceID)
+}
+
+// ID returns the trace ID ctx carries, or "" when there is none.
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// FromRequest returns r's context carrying the trace ID of its
+// traceparent header, if it has a valid one.
+func FromRequest(r *http.Request) context.Context {
+	if id, ok := Parse(r.Header.Get(Header)); ok {
+		return WithID(r.Context(), id)
+	}
+	return r.Context()
+}
+
+// Inject sets the traceparent header of an outbound request to continue the
+// trace ctx carries, with a fresh span ID. Requests that already have the
+// header or whose context has no trace are left alone.
+func Inject(ctx context.Context, h http.Header) {
+	id := ID(ctx)
+	if id == "" || h.Get(Header) != "" {
+		return
+	}
+	var span [8]byte
+	if _, err := rand.Read(span[:]); err != nil {
+		return
+	}
+	h.Set(Header, "00-"+id+"-"+hex.EncodeToString(span[:])+"-01")
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func allZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
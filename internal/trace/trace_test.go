@@ -0,0 +1,52 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ""},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", ""},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", ""},
+		{"00-4bf92f35-00f067aa0ba902b7-01", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, ok := Parse(tt.header)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("Parse(%q) = %q, %v, want %q", tt.header, got, ok, tt.want)
+		}
+	}
+}
+
+func TestFromRequestAndInject(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(Header, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := FromRequest(req)
+	if ID(ctx) != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("ID = %q", ID(ctx))
+	}
+
+	h := http.Header{}
+	Inject(ctx, h)
+	id, ok := Parse(h.Get(Header))
+	if !ok || id != ID(ctx) || h.Get(Header) == req.Header.Get(Header) {
+		t.Errorf("injected %q, want the same trace with a new span", h.Get(Header))
+	}
+
+	h = http.Header{}
+	Inject(context.Background(), h)
+	if h.Get(Header) != "" {
+		t.Errorf("injected %q without a trace", h.Get(Header))
+	}
+}
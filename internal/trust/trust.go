@@ -0,0 +1,258 @@
+// Package trust holds the trust material verification is anchored to:
+// verification keys, Fulcio certificate authorities and Rekor log keys.
+package trust
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/httpclient"
+	"github.com/waveywaves/tekton-slsa-demo/internal/rekor"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+)
+
+// Root is a set of PEM-encoded trust anchors. It is serialised as-is into
+// offline bundles.
+type Root struct {
+	// PublicKeys verify key-based signatures.
+	PublicKeys []string `json:"publicKeys,omitempty"`
+	// FulcioCertificates are the root and intermediate CA certificates
+	// keyless signing certificates must chain to.
+	FulcioCertificates []string `json:"fulcioCertificates,omitempty"`
+	// RekorKeys verify signed entry timestamps.
+	RekorKeys []string `json:"rekorKeys,omitempty"`
+}
+
+// Keys decodes the verification keys.
+func (r *Root) Keys() ([]crypto.PublicKey, error) {
+	keys := make([]crypto.PublicKey, 0, len(r.PublicKeys))
+	for _, p := range r.PublicKeys {
+		k, err := signing.ParsePublicKey([]byte(p))
+		if err != nil {
+			return nil, fmt.Errorf("trust: public key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// RekorLogKeys returns the Rekor keys indexed by log ID.
+func (r *Root) RekorLogKeys() (map[string]crypto.PublicKey, error) {
+	keys := make(map[string]crypto.PublicKey, len(r.RekorKeys))
+	for _, p := range r.RekorKeys {
+		k, err := signing.ParsePublicKey([]byte(p))
+		if err != nil {
+			return nil, fmt.Errorf("trust: rekor key: %w", err)
+		}
+		id, err := rekor.LogID(k)
+		if err != nil {
+			return nil, err
+		}
+		keys[id] = k
+	}
+	return keys, nil
+}
+
+// CertPools splits the Fulcio certificates into self-signed roots and
+// intermediates.
+func (r *Root) CertPools() (roots, intermediates *x509.CertPool, err error) {
+	roots, intermediates = x509.NewCertPool(), x509.NewCertPool()
+	for _, p := range r.FulcioCertificates {
+		certs, err := signing.ParseCertificates([]byte(p))
+		if err != nil {
+			return nil, nil, fmt.Errorf("trust: fulcio certificate: %w", err)
+		}
+		for _, c := range certs {
+			if c.CheckSignatureFrom(c) == nil {
+				roots.AddCert(c)
+			} else {
+				intermediates.AddCert(c)
+			}
+		}
+	}
+	return roots, intermediates, nil
+}
+
+// AddPublicKey appends a PEM-encoded verification key.
+func (r *Root) AddPublicKey(pub crypto.PublicKey) error {
+	p, err := signing.MarshalPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	r.PublicKeys = append(r.PublicKeys, string(p))
+	return nil
+}
+
+// Empty reports whether r trusts nothing.
+func (r *Root) Empty() bool {
+	return len(r.PublicKeys) == 0 && len(r.FulcioCertificates) == 0 && len(r.RekorKeys) == 0
+}
+
+// Covers reports an error naming the first anchor of other that r does
+// not hold. Anchors are compared by their decoded keys and certificates,
+// not their PEM text.
+func (r *Root) Covers(other *Root) error {
+	for _, kind := range []struct {
+		name         string
+		have, want   []string
+		fingerprints func([]string) ([]string, error)
+	}{
+		{"public key", r.PublicKeys, other.PublicKeys, keyFingerprints},
+		{"Fulcio certificate", r.FulcioCertificates, other.FulcioCertificates, certFingerprints},
+		{"Rekor key", r.RekorKeys, other.RekorKeys, keyFingerprints},
+	} {
+		have, err := kind.fingerprints(kind.have)
+		if err != nil {
+			return err
+		}
+		want, err := kind.fingerprints(kind.want)
+		if err != nil {
+			return err
+		}
+		held := make(map[string]bool, len(have))
+		for _, fp := range have {
+			held[fp] = true
+		}
+		for _, fp := range want {
+			if !held[fp] {
+				return fmt.Errorf("trust: %s %s is not trusted", kind.name, fp)
+			}
+		}
+	}
+	return nil
+}
+
+// keyFingerprints returns the SHA-256 fingerprints of PEM public keys.
+func keyFingerprints(pems []string) ([]string, error) {
+	var fps []string
+	for _, p := range pems {
+		k, err := signing.ParsePublicKey([]byte(p))
+		if err != nil {
+			return nil, fmt.Errorf("trust: public key: %w", err)
+		}
+		fp, err := signing.Fingerprint(k)
+		if err != nil {
+			return nil, err
+		}
+		fps = append(fps, fp)
+	}
+	return fps, nil
+}
+
+// certFingerprints returns the SHA-256 fingerprints of every certificate
+// in PEM chains.
+func certFingerprints(pems []string) ([]string, error) {
+	var fps []string
+	for _, p := range pems {
+		certs, err := signing.ParseCertificates([]byte(p))
+		if err != nil {
+			return nil, fmt.Errorf("trust: fulcio certificate: %w", err)
+		}
+		for _, c := range certs {
+			sum := sha256.Sum256(c.Raw)
+			fps = append(fps, hex.EncodeToString(sum[:]))
+		}
+	}
+	return fps, nil
+}
+
+// sigstoreTrustedRoot is the subset of Sigstore's trusted_root.json used
+// here.
+type sigstoreTrustedRoot struct {
+	Tlogs []struct {
+		PublicKey struct {
+			RawBytes string `json:"rawBytes"`
+		} `json:"publicKey"`
+	} `json:"tlogs"`
+	CertificateAuthorities []struct {
+		CertChain struct {
+			Certificates []struct {
+				RawBytes string `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"certChain"`
+	} `json:"certificateAuthorities"`
+}
+
+// ParseSigstoreTrustedRoot converts a Sigstore trusted_root.json, as
+// distributed through Sigstore's TUF repository, into a Root.
+func ParseSigstoreTrustedRoot(data []byte) (*Root, error) {
+	var tr sigstoreTrustedRoot
+	if err := json.Unmarshal(data, &tr); err != nil {
+		return nil, fmt.Errorf("trust: decoding trusted root: %w", err)
+	}
+	root := &Root{}
+	for _, tl := range tr.Tlogs {
+		der, err := base64.StdEncoding.DecodeString(tl.PublicKey.RawBytes)
+		if err != nil {
+			return nil, fmt.Errorf("trust: tlog key: %w", err)
+		}
+		root.RekorKeys = append(root.RekorKeys, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	}
+	for _, ca := range tr.CertificateAuthorities {
+		for _, c := range ca.CertChain.Certificates {
+			der, err := base64.StdEncoding.DecodeString(c.RawBytes)
+			if err != nil {
+				return nil, fmt.Errorf("trust: CA certificate: %w", err)
+			}
+			root.FulcioCertificates = append(root.FulcioCertificates, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+		}
+	}
+	return root, nil
+}
+
+// Fetch builds a Root from the public key of the Rekor instance and the CA
+// chain of the Fulcio instance at the given URLs. Either may be empty to
+// skip it.
+func Fetch(ctx context.Context, client *http.Client, rekorURL, fulcioURL string) (*Root, error) {
+	if client == nil {
+		client = httpclient.Default()
+	}
+	root := &Root{}
+	if rekorURL != "" {
+		rc := rekor.NewClient(rekorURL)
+		rc.HTTP = client
+		key, err := rc.PublicKey(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p, err := signing.MarshalPublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		root.RekorKeys = append(root.RekorKeys, string(p))
+	}
+	if fulcioURL != "" {
+		url := strings.TrimSuffix(fulcioURL, "/") + "/api/v1/rootCert"
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("trust: fetching Fulcio root: %w", err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("trust: fetching Fulcio root: %s", resp.Status)
+		}
+		if _, err := signing.ParseCertificates(data); err != nil {
+			return nil, fmt.Errorf("trust: Fulcio root: %w", err)
+		}
+		root.FulcioCertificates = append(root.FulcioCertificates, string(data))
+	}
+	return root, nil
+}
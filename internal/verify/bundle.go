@@ -0,0 +1,78 @@
+package verify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/trust"
+)
+
+// BundleMediaType identifies offline verification bundles.
+const BundleMediaType = "application/vnd.tekton-slsa-demo.bundle.v1+json"
+
+// Bundle packages an image's evidence with the trust root needed to verify
+// it, so verification can happen later without network access.
+type Bundle struct {
+	MediaType   string     `json:"mediaType"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	Evidence    Evidence   `json:"evidence"`
+	TrustedRoot trust.Root `json:"trustedRoot"`
+}
+
+// NewBundle wraps ev and root in a bundle.
+func NewBundle(ev *Evidence, root *trust.Root, createdAt time.Time) *Bundle {
+	return &Bundle{
+		MediaType:   BundleMediaType,
+		CreatedAt:   createdAt.UTC(),
+		Evidence:    *ev,
+		TrustedRoot: *root,
+	}
+}
+
+// ReadBundle loads a bundle written by Bundle.Write.
+func ReadBundle(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("decoding bundle: %w", err)
+	}
+	if b.MediaType != BundleMediaType {
+		return nil, fmt.Errorf("unsupported bundle media type %q", b.MediaType)
+	}
+	return &b, nil
+}
+
+// Write stores the bundle as JSON at path.
+func (b *Bundle) Write(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Verify checks the bundled evidence against opts.Root, trust material
+// obtained apart from the bundle: whoever wrote the bundle could have put
+// any key in its trusted root. That root is only a hint, and it must hold
+// nothing opts.Root does not. Keyless signatures are accepted only for an
+// identity and issuer set in opts, as any Fulcio certificate chains to a
+// trusted root.
+func (b *Bundle) Verify(opts Options) (*Result, error) {
+	if opts.Root == nil || opts.Root.Empty() {
+		return nil, errors.New("verifying a bundle needs trust material from outside it: a public key or a trusted root")
+	}
+	if len(opts.Root.FulcioCertificates) > 0 && (opts.Identity == "" || opts.Issuer == "") {
+		return nil, errors.New("trusting Fulcio certificates needs the certificate identity and OIDC issuer to accept")
+	}
+	if err := opts.Root.Covers(&b.TrustedRoot); err != nil {
+		return nil, failure.New(failure.IdentityRejected, "the bundle's trusted root does not match the local one: %w", err)
+	}
+	return Verify(&b.Evidence, opts)
+}
@@ -0,0 +1,119 @@
+// Package verify checks the signatures and attestations attached to an
+// image against a trust root, online or from an offline bundle.
+package verify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/cosign"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/rekor"
+)
+
+// Evidence is everything attached to an image that verification looks at.
+// It is self-contained so it can be written to an offline bundle.
+type Evidence struct {
+	Image        string        `json:"image"`
+	Digest       string        `json:"digest"`
+	Signatures   []Signature   `json:"signatures"`
+	Attestations []Attestation `json:"attestations"`
+}
+
+// TlogProof is the transparency log evidence for one signature.
+type TlogProof struct {
+	Bundle         *rekor.Bundle         `json:"bundle,omitempty"`
+	InclusionProof *rekor.InclusionProof `json:"inclusionProof,omitempty"`
+}
+
+// Signature is a cosign simple signing signature over the image.
+type Signature struct {
+	Payload     []byte     `json:"payload"`
+	Signature   string     `json:"signature"`
+	Certificate string     `json:"certificate,omitempty"`
+	Chain       string     `json:"chain,omitempty"`
+	Tlog        *TlogProof `json:"tlog,omitempty"`
+}
+
+// Attestation is a DSSE-enveloped in-toto statement about the image.
+type Attestation struct {
+	Envelope    *dsse.Envelope `json:"envelope"`
+	Certificate string         `json:"certificate,omitempty"`
+	Chain       string         `json:"chain,omitempty"`
+	Tlog        *TlogProof     `json:"tlog,omitempty"`
+}
+
+// RekorClient fetches transparency log entries; *rekor.Client implements
+// it.
+type RekorClient interface {
+	EntryByIndex(ctx context.Context, index int64) (*rekor.LogEntry, error)
+}
+
+// Collect fetches the signatures and attestations attached to ref. When rc
+// is non-nil, inclusion proofs for their Rekor entries are fetched as well
+// so the evidence can later be verified without network access.
+func Collect(ctx context.Context, reg oci.RegistryClient, rc RekorClient, ref oci.Reference) (*Evidence, error) {
+	digest, err := reg.Resolve(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", ref, err)
+	}
+	pinned := ref.WithDigest(digest)
+	ev := &Evidence{Image: ref.String(), Digest: digest}
+
+	sigs, err := cosign.Signatures(ctx, reg, pinned)
+	if err != nil {
+		return nil, fmt.Errorf("fetching signatures: %w", err)
+	}
+	for _, s := range sigs {
+		tlog, err := collectTlog(ctx, rc, s.Bundle)
+		if err != nil {
+			return nil, err
+		}
+		ev.Signatures = append(ev.Signatures, Signature{
+			Payload:     s.Payload,
+			Signature:   s.Signature,
+			Certificate: s.Certificate,
+			Chain:       s.Chain,
+			Tlog:        tlog,
+		})
+	}
+
+	atts, err := cosign.Attestations(ctx, reg, pinned)
+	if err != nil {
+		return nil, fmt.Errorf("fetching attestations: %w", err)
+	}
+	for _, a := range atts {
+		tlog, err := collectTlog(ctx, rc, a.Bundle)
+		if err != nil {
+			return nil, err
+		}
+		ev.Attestations = append(ev.Attestations, Attestation{
+			Envelope:    a.Envelope,
+			Certificate: a.Certificate,
+			Chain:       a.Chain,
+			Tlog:        tlog,
+		})
+	}
+	return ev, nil
+}
+
+func collectTlog(ctx context.Context, rc RekorClient, annotation string) (*TlogProof, error) {
+	if annotation == "" {
+		return nil, nil
+	}
+	b, err := rekor.ParseBundle(annotation)
+	if err != nil {
+		return nil, err
+	}
+	proof := &TlogProof{Bundle: b}
+	if rc != nil {
+		entry, err := rc.EntryByIndex(ctx, b.Payload.LogIndex)
+		if err != nil {
+			return nil, failure.New(failure.RekorUnreachable, "fetching inclusion proof for log index %d: %w", b.Payload.LogIndex, err)
+		}
+		proof.InclusionProof = entry.Verification.InclusionProof
+	}
+	return proof, nil
+}
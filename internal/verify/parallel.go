@@ -0,0 +1,83 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+)
+
+// DefaultWorkers is how many images All verifies at once unless told
+// otherwise. Verification is bound by registry and Rekor round trips, not
+// CPU, so it does not scale with the number of cores.
+const DefaultWorkers = 4
+
+// Subjects returns the images to verify for ref, pinned by digest: ref
+// itself and, when it names a multi-platform index, the manifest of every
+// platform in it, since cosign and Chains sign and attest each of them
+// separately. Index entries without a platform, such as BuildKit's
+// attestation manifests, are skipped.
+func Subjects(ctx context.Context, reg oci.RegistryClient, ref oci.Reference) ([]oci.Reference, error) {
+	m, _, digest, err := reg.GetManifest(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", ref, err)
+	}
+	refs := []oci.Reference{ref.WithDigest(digest)}
+	if !m.IsIndex() {
+		return refs, nil
+	}
+	for _, d := range m.Manifests {
+		if d.Platform == nil || d.Platform.OS == "unknown" {
+			continue
+		}
+		refs = append(refs, ref.WithDigest(d.Digest))
+	}
+	return refs, nil
+}
+
+// Func verifies one image.
+type Func func(ctx context.Context, ref oci.Reference) (*Result, error)
+
+// All verifies every ref with fn, running at most workers verifications at
+// once; workers below one means DefaultWorkers. Results are in the order of
+// refs. When verifying a ref fails its result is nil and the error, naming
+// the ref, is joined into the returned error, so one unreachable image does
+// not hide the results of the others.
+func All(ctx context.Context, refs []oci.Reference, workers int, fn Func) ([]*Result, error) {
+	if workers < 1 {
+		workers = DefaultWorkers
+	}
+	results := make([]*Result, len(refs))
+	errs := make([]error, len(refs))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, ref := range refs {
+		if err := ctx.Err(); err != nil {
+			errs[i] = fmt.Errorf("%s: %w", ref, err)
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = fmt.Errorf("%s: %w", ref, ctx.Err())
+			continue
+		}
+		wg.Add(1)
+		go func(i int, ref oci.Reference) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			res, err := fn(ctx, ref)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", ref, err)
+				return
+			}
+			results[i] = res
+		}(i, ref)
+	}
+	wg.Wait()
+	return results, errors.Join(errs...)
+}
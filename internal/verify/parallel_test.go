@@ -0,0 +1,105 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/fake"
+	"github.com/waveywaves/tekton-slsa-demo/internal/trust"
+)
+
+func TestVerifyMultiPlatformImage(t *testing.T) {
+	reg := fake.NewRegistry(t)
+	index, platforms := reg.PushIndex(t, "app:v1", "linux/amd64", "linux/arm64", "unknown/unknown")
+	id := fake.KeyIdentity(t)
+	fake.SignImage(t, reg, platforms[0], id, nil)
+	root := &trust.Root{}
+	if err := root.AddPublicKey(id.Signer.Public()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	refs, err := Subjects(ctx, reg.Client(), reg.Ref(t, "app:v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{index.Digest, platforms[0].Digest, platforms[1].Digest}
+	if len(refs) != len(want) {
+		t.Fatalf("Subjects = %v, want the index and two platforms", refs)
+	}
+	for i, ref := range refs {
+		if ref.Digest != want[i] {
+			t.Errorf("subject %d = %s, want %s", i, ref.Digest, want[i])
+		}
+	}
+
+	results, err := All(ctx, refs, 2, func(ctx context.Context, ref oci.Reference) (*Result, error) {
+		ev, err := Collect(ctx, reg.Client(), nil, ref)
+		if err != nil {
+			return nil, err
+		}
+		return Verify(ev, Options{Root: root})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, verified := range []bool{false, true, false} {
+		if results[i].Digest != want[i] || results[i].Verified != verified {
+			t.Errorf("result %d = %s verified=%v, want %s verified=%v", i, results[i].Digest, results[i].Verified, want[i], verified)
+		}
+	}
+}
+
+func TestAllBoundsConcurrency(t *testing.T) {
+	var refs []oci.Reference
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		ref, err := oci.ParseReference("registry.local/" + name + ":v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, ref)
+	}
+
+	var running, peak atomic.Int32
+	results, err := All(context.Background(), refs, 3, func(ctx context.Context, ref oci.Reference) (*Result, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if ref.Repository == "c" || ref.Repository == "f" {
+			return nil, errors.New("registry unavailable")
+		}
+		return &Result{Image: ref.String(), Verified: true}, nil
+	})
+
+	if p := peak.Load(); p != 3 {
+		t.Errorf("peak concurrency = %d, want 3", p)
+	}
+	if err == nil || !strings.Contains(err.Error(), "registry.local/c:v1: registry unavailable") || !strings.Contains(err.Error(), "registry.local/f:v1: registry unavailable") {
+		t.Errorf("error = %v, want both failures named", err)
+	}
+	for i, res := range results {
+		failed := refs[i].Repository == "c" || refs[i].Repository == "f"
+		if (res == nil) != failed || (res != nil && res.Image != refs[i].String()) {
+			t.Errorf("result %d for %s = %+v", i, refs[i], res)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := All(ctx, refs, 1, func(ctx context.Context, ref oci.Reference) (*Result, error) {
+		return &Result{}, nil
+	}); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled context: error = %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package verify
+
+import (
+	"fmt"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/sarif"
+)
+
+// SARIF rule IDs for verification findings.
+const (
+	RuleUnverified         = "SLSA0001"
+	RuleInvalidSignature   = "SLSA0002"
+	RuleInvalidAttestation = "SLSA0003"
+	RuleSchemaViolation    = "SLSA0004"
+	RuleUnpinnedMaterial   = "SLSA0005"
+)
+
+var sarifRules = map[string]sarif.Rule{
+	RuleUnverified: {
+		ID:               RuleUnverified,
+		Name:             "UnverifiedImage",
+		ShortDescription: &sarif.Message{Text: "No signature or attestation on the image verified"},
+		Properties:       map[string]any{"tags": []string{"security", "supply-chain"}, "security-severity": "8.0"},
+	},
+	RuleInvalidSignature: {
+		ID:               RuleInvalidSignature,
+		Name:             "InvalidSignature",
+		ShortDescription: &sarif.Message{Text: "An image signature failed verification"},
+		Properties:       map[string]any{"tags": []string{"security", "supply-chain"}, "security-severity": "7.0"},
+	},
+	RuleInvalidAttestation: {
+		ID:               RuleInvalidAttestation,
+		Name:             "InvalidAttestation",
+		ShortDescription: &sarif.Message{Text: "An attestation failed verification"},
+		Properties:       map[string]any{"tags": []string{"security", "supply-chain"}, "security-severity": "7.0"},
+	},
+	RuleSchemaViolation: {
+		ID:               RuleSchemaViolation,
+		Name:             "PredicateSchemaViolation",
+		ShortDescription: &sarif.Message{Text: "An attestation predicate does not match the schema of its type"},
+		Properties:       map[string]any{"tags": []string{"supply-chain"}, "security-severity": "4.0"},
+	},
+	RuleUnpinnedMaterial: {
+		ID:               RuleUnpinnedMaterial,
+		Name:             "UnpinnedMaterial",
+		ShortDescription: &sarif.Message{Text: "A build material in the provenance is not pinned by digest"},
+		Properties:       map[string]any{"tags": []string{"supply-chain"}, "security-severity": "5.0"},
+	},
+}
+
+// SARIF converts the result into a SARIF log with one result per failed
+// check, plus one for the image itself when nothing verified. Failed checks
+// are errors when the image did not verify and warnings when another
+// signature or attestation vouched for it. Schema violations and unpinned
+// materials are reported as warnings under their own rules, whether or not
+// the check verified.
+func (r *Result) SARIF(toolName, toolVersion string) *sarif.Log {
+	log := sarif.New(toolName, toolVersion, "https://slsa.dev")
+	loc := []sarif.Location{sarif.FileLocation(r.Image)}
+	level := sarif.LevelWarning
+	if !r.Verified {
+		level = sarif.LevelError
+		log.AddRule(sarifRules[RuleUnverified])
+		log.AddResult(sarif.Result{
+			RuleID:     RuleUnverified,
+			Level:      sarif.LevelError,
+			Message:    sarif.Message{Text: fmt.Sprintf("%s@%s has no verified signature or attestation (%d checked)", r.Image, r.Digest, len(r.Checks))},
+			Locations:  loc,
+			Properties: map[string]any{"digest": r.Digest, "code": r.Code},
+		})
+	}
+	for _, c := range r.Checks {
+		for _, v := range c.SchemaViolations {
+			log.AddRule(sarifRules[RuleSchemaViolation])
+			log.AddResult(sarif.Result{
+				RuleID:     RuleSchemaViolation,
+				Level:      sarif.LevelWarning,
+				Message:    sarif.Message{Text: fmt.Sprintf("%s attestation on %s: %s", attestation.PredicateName(c.PredicateType), r.Image, v)},
+				Locations:  loc,
+				Properties: map[string]any{"digest": r.Digest, "predicateType": c.PredicateType, "path": v.Path},
+			})
+		}
+		for _, m := range c.UnpinnedMaterials {
+			log.AddRule(sarifRules[RuleUnpinnedMaterial])
+			log.AddResult(sarif.Result{
+				RuleID:     RuleUnpinnedMaterial,
+				Level:      sarif.LevelWarning,
+				Message:    sarif.Message{Text: fmt.Sprintf("%s attestation on %s: material %s", attestation.PredicateName(c.PredicateType), r.Image, m)},
+				Locations:  loc,
+				Properties: map[string]any{"digest": r.Digest, "predicateType": c.PredicateType, "uri": m.URI},
+			})
+		}
+		if c.Verified {
+			continue
+		}
+		rule, what := RuleInvalidSignature, "signature"
+		if c.Kind == KindAttestation {
+			rule, what = RuleInvalidAttestation, attestation.PredicateName(c.PredicateType)+" attestation"
+		}
+		log.AddRule(sarifRules[rule])
+		props := map[string]any{"digest": r.Digest, "kind": c.Kind}
+		if c.PredicateType != "" {
+			props["predicateType"] = c.PredicateType
+		}
+		if c.Signer != "" {
+			props["signer"] = c.Signer
+		}
+		if c.LogIndex != nil {
+			props["logIndex"] = *c.LogIndex
+		}
+		if c.Code != "" {
+			props["code"] = c.Code
+		}
+		log.AddResult(sarif.Result{
+			RuleID:     rule,
+			Level:      level,
+			Message:    sarif.Message{Text: fmt.Sprintf("%s on %s failed verification: %s", what, r.Image, c.Error)},
+			Locations:  loc,
+			Properties: props,
+		})
+	}
+	return log
+}
@@ -0,0 +1,449 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/clock"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cosign"
+	"github.com/waveywaves/tekton-slsa-demo/internal/digest"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/rekor"
+	"github.com/waveywaves/tekton-slsa-demo/internal/schema"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/trust"
+)
+
+// Options controls what a signature must satisfy to be accepted.
+type Options struct {
+	Root *trust.Root
+	// Identity is a regular expression the keyless certificate's subject
+	// alternative name must match. Empty accepts any identity.
+	Identity string
+	// Issuer is the OIDC issuer keyless certificates must carry. Empty
+	// accepts any issuer.
+	Issuer string
+	// RequireTlog rejects signatures without a verified Rekor entry.
+	RequireTlog bool
+	// Annotations are the annotations image signatures must carry in the
+	// optional section of their signed payload, as with cosign verify -a.
+	Annotations map[string]string
+	// Clock is used to check certificates that have no log timestamp. It
+	// defaults to the system clock.
+	Clock clock.Clock
+}
+
+// Kinds of Check.
+const (
+	KindSignature   = "signature"
+	KindAttestation = "attestation"
+)
+
+// Check is the outcome of verifying one signature or attestation.
+type Check struct {
+	Kind          string     `json:"kind"`
+	PredicateType string     `json:"predicateType,omitempty"`
+	Signer        string     `json:"signer,omitempty"`
+	Issuer        string     `json:"issuer,omitempty"`
+	LogIndex      *int64     `json:"logIndex,omitempty"`
+	SignedAt      *time.Time `json:"signedAt,omitempty"`
+	Verified      bool       `json:"verified"`
+	Error         string     `json:"error,omitempty"`
+	// Code classifies Error.
+	Code failure.Code `json:"code,omitempty"`
+	// Annotations are the annotations of a signature's signed payload.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// SchemaViolations are where an attestation's predicate does not match
+	// the schema of its type. They do not affect Verified.
+	SchemaViolations []schema.Violation `json:"schemaViolations,omitempty"`
+	// UnpinnedMaterials are the materials of a provenance attestation that
+	// are not pinned by digest. They do not affect Verified.
+	UnpinnedMaterials []attestation.UnpinnedMaterial `json:"unpinnedMaterials,omitempty"`
+}
+
+// Result summarises verification of an image.
+type Result struct {
+	Image  string  `json:"image"`
+	Digest string  `json:"digest"`
+	Checks []Check `json:"checks"`
+	// Verified is true when at least one signature or attestation verified.
+	Verified bool `json:"verified"`
+	// Code classifies why the image did not verify: the code of its first
+	// failed check, or SIGNATURE_MISMATCH when it has none.
+	Code failure.Code `json:"code,omitempty"`
+}
+
+// Classify sets r.Code from the checks.
+func (r *Result) Classify() {
+	r.Code = ""
+	if r.Verified {
+		return
+	}
+	r.Code = failure.SignatureMismatch
+	for _, c := range r.Checks {
+		if !c.Verified && c.Code != "" {
+			r.Code = c.Code
+			return
+		}
+	}
+}
+
+// Verify checks every signature and attestation in ev.
+func Verify(ev *Evidence, opts Options) (*Result, error) {
+	v, err := newVerifier(opts)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Image: ev.Image, Digest: ev.Digest, Checks: []Check{}}
+	for _, s := range ev.Signatures {
+		c := v.signature(ev.Digest, s)
+		res.Checks = append(res.Checks, c)
+		res.Verified = res.Verified || c.Verified
+	}
+	for _, a := range ev.Attestations {
+		c := v.attestation(ev.Digest, a)
+		res.Checks = append(res.Checks, c)
+		res.Verified = res.Verified || c.Verified
+	}
+	res.Classify()
+	return res, nil
+}
+
+type verifier struct {
+	opts          Options
+	keys          []crypto.PublicKey
+	rekorKeys     map[string]crypto.PublicKey
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+	identity      *regexp.Regexp
+}
+
+func newVerifier(opts Options) (*verifier, error) {
+	root := opts.Root
+	if root == nil {
+		root = &trust.Root{}
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.System{}
+	}
+	v := &verifier{opts: opts}
+	var err error
+	if v.keys, err = root.Keys(); err != nil {
+		return nil, err
+	}
+	if v.rekorKeys, err = root.RekorLogKeys(); err != nil {
+		return nil, err
+	}
+	if v.roots, v.intermediates, err = root.CertPools(); err != nil {
+		return nil, err
+	}
+	if opts.Identity != "" {
+		if v.identity, err = regexp.Compile(opts.Identity); err != nil {
+			return nil, fmt.Errorf("invalid identity pattern: %w", err)
+		}
+	}
+	return v, nil
+}
+
+func (v *verifier) signature(imageDigest string, s Signature) Check {
+	c := Check{Kind: KindSignature}
+	fail := func(err error) Check {
+		c.Error = err.Error()
+		c.Code = codeOf(err)
+		return c
+	}
+
+	var ss cosign.SimpleSigning
+	if err := json.Unmarshal(s.Payload, &ss); err != nil {
+		return fail(failure.New(failure.SchemaInvalid, "decoding signed payload: %w", err))
+	}
+	if digest.Canonical(ss.Critical.Image.DockerManifestDigest) != digest.Canonical(imageDigest) {
+		return fail(fmt.Errorf("signature is for %s, not %s", ss.Critical.Image.DockerManifestDigest, imageDigest))
+	}
+	c.Annotations = annotations(ss.Optional)
+	sig, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil {
+		return fail(fmt.Errorf("decoding signature: %w", err))
+	}
+
+	signedAt, err := v.tlog(&c, s.Tlog, s.Payload, sig)
+	if err != nil {
+		return fail(err)
+	}
+	verifiers, err := v.verifiers(&c, s.Certificate, s.Chain, signedAt)
+	if err != nil {
+		return fail(err)
+	}
+	var errs []error
+	for _, ver := range verifiers {
+		if err := ver.Verify(s.Payload, sig); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if c.Signer == "" {
+			c.Signer = ver.KeyID()
+		}
+		if err := checkAnnotations(c.Annotations, v.opts.Annotations); err != nil {
+			return fail(err)
+		}
+		c.Verified = true
+		return c
+	}
+	return fail(fmt.Errorf("signature does not verify: %w", errors.Join(errs...)))
+}
+
+// codeOf classifies the error of a failed check. Errors without a code
+// are signatures, envelopes or log entries that did not verify.
+func codeOf(err error) failure.Code {
+	if code := failure.CodeOf(err); code != "" {
+		return code
+	}
+	return failure.SignatureMismatch
+}
+
+// annotations returns the optional section of a signed payload as string
+// annotations, or nil when it is empty.
+func annotations(optional map[string]any) map[string]string {
+	if len(optional) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(optional))
+	for k, v := range optional {
+		if s, ok := v.(string); ok {
+			m[k] = s
+		} else {
+			m[k] = fmt.Sprint(v)
+		}
+	}
+	return m
+}
+
+// checkAnnotations reports the first required annotation that got lacks
+// or carries with another value.
+func checkAnnotations(got, required map[string]string) error {
+	keys := make([]string, 0, len(required))
+	for k := range required {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, ok := got[k]
+		switch {
+		case !ok:
+			return failure.New(failure.PolicyDenied, "signature lacks the required annotation %s=%s", k, required[k])
+		case v != required[k]:
+			return failure.New(failure.PolicyDenied, "signature annotation %s is %q, not %q", k, v, required[k])
+		}
+	}
+	return nil
+}
+
+// FormatAnnotations renders annotations as sorted, comma-separated
+// key=value pairs.
+func FormatAnnotations(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v *verifier) attestation(imageDigest string, a Attestation) Check {
+	c := Check{Kind: KindAttestation}
+	fail := func(err error) Check {
+		c.Error = err.Error()
+		c.Code = codeOf(err)
+		return c
+	}
+	if a.Envelope == nil {
+		return fail(failure.New(failure.SchemaInvalid, "missing envelope"))
+	}
+	if err := a.Envelope.Validate(); err != nil {
+		return fail(failure.Wrap(failure.SchemaInvalid, err))
+	}
+	payload, _ := a.Envelope.DecodePayload()
+	stmt, err := attestation.ParseStatement(payload)
+	if err != nil {
+		return fail(failure.Wrap(failure.SchemaInvalid, err))
+	}
+	c.PredicateType = stmt.PredicateType
+	c.SchemaViolations, _ = schema.ValidateStatement(stmt)
+	if attestation.IsProvenance(stmt.PredicateType) {
+		if p, err := attestation.NormalizeProvenance(stmt); err == nil {
+			c.UnpinnedMaterials = p.UnpinnedMaterials()
+		}
+	}
+	if !SubjectMatches(stmt, imageDigest) {
+		return fail(fmt.Errorf("no statement subject matches %s", imageDigest))
+	}
+
+	// Each signature is checked on its own, against the log entry as well as
+	// the keys, so a logged entry cannot vouch for a signature that was
+	// added to the envelope afterwards.
+	if len(a.Envelope.Signatures) == 0 {
+		return fail(dsse.ErrNoSignatures)
+	}
+	var errs []error
+	for _, sig := range a.Envelope.Signatures {
+		sc, err := v.envelopeSignature(c, a, payload, sig)
+		if err == nil {
+			return sc
+		}
+		errs = append(errs, err)
+	}
+	return fail(errors.Join(errs...))
+}
+
+// envelopeSignature verifies one signature of a's envelope, filling in a
+// copy of c.
+func (v *verifier) envelopeSignature(c Check, a Attestation, payload []byte, sig dsse.Signature) (Check, error) {
+	raw, err := sig.Decode()
+	if err != nil {
+		return c, failure.Wrap(failure.SchemaInvalid, err)
+	}
+	signedAt, err := v.tlog(&c, a.Tlog, payload, raw)
+	if err != nil {
+		return c, err
+	}
+	verifiers, err := v.verifiers(&c, a.Certificate, a.Chain, signedAt)
+	if err != nil {
+		return c, err
+	}
+	dsseVerifiers := make([]dsse.Verifier, len(verifiers))
+	for i, ver := range verifiers {
+		dsseVerifiers[i] = ver
+	}
+	one := *a.Envelope
+	one.Signatures = []dsse.Signature{sig}
+	keyID, err := one.Verify(dsseVerifiers...)
+	if err != nil {
+		return c, err
+	}
+	if c.Signer == "" {
+		c.Signer = keyID
+	}
+	c.Verified = true
+	return c, nil
+}
+
+// SubjectMatches reports whether any statement subject carries d
+// ("alg:hex"), in whichever algorithm d uses.
+func SubjectMatches(stmt *attestation.Statement, d string) bool {
+	for _, s := range stmt.Subject {
+		if digest.InSet(s.Digest, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// tlog verifies the Rekor evidence, if any, returning the time the log
+// vouches the signature existed at.
+func (v *verifier) tlog(c *Check, proof *TlogProof, payload, sig []byte) (time.Time, error) {
+	if proof == nil || proof.Bundle == nil {
+		if v.opts.RequireTlog {
+			return time.Time{}, failure.New(failure.PolicyDenied, "no transparency log entry")
+		}
+		return v.opts.Clock.Now(), nil
+	}
+	b := proof.Bundle
+	key, ok := v.rekorKeys[b.Payload.LogID]
+	if !ok {
+		return time.Time{}, fmt.Errorf("transparency log %s is not trusted", b.Payload.LogID)
+	}
+	if err := b.VerifySET(key); err != nil {
+		return time.Time{}, err
+	}
+	if err := b.Matches(payload, sig); err != nil {
+		return time.Time{}, err
+	}
+	if proof.InclusionProof != nil {
+		leaf, err := b.LeafHash()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if err := rekor.VerifyInclusion(proof.InclusionProof, leaf); err != nil {
+			return time.Time{}, err
+		}
+	}
+	idx := b.Payload.LogIndex
+	at := b.IntegratedTime()
+	c.LogIndex, c.SignedAt = &idx, &at
+	return at, nil
+}
+
+// verifiers returns the keys a signature may be checked against: the
+// trusted keys, plus the certificate's key if it chains to a trusted Fulcio
+// root at signedAt and satisfies the identity constraints.
+func (v *verifier) verifiers(c *Check, certPEM, chainPEM string, signedAt time.Time) ([]*signing.Verifier, error) {
+	var out []*signing.Verifier
+	if certPEM != "" {
+		cert, err := v.checkCertificate(certPEM, chainPEM, signedAt)
+		if err != nil {
+			return nil, err
+		}
+		c.Signer, c.Issuer = signing.CertificateIdentity(cert)
+		ver, err := signing.NewVerifier(cert.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		return append(out, ver), nil
+	}
+	for _, k := range v.keys {
+		ver, err := signing.NewVerifier(k)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ver)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no trusted key or certificate to verify with")
+	}
+	return out, nil
+}
+
+func (v *verifier) checkCertificate(certPEM, chainPEM string, at time.Time) (*x509.Certificate, error) {
+	certs, err := signing.ParseCertificates([]byte(certPEM))
+	if err != nil {
+		return nil, fmt.Errorf("signing certificate: %w", err)
+	}
+	cert := certs[0]
+	intermediates := v.intermediates.Clone()
+	if chainPEM != "" {
+		chain, err := signing.ParseCertificates([]byte(chainPEM))
+		if err != nil {
+			return nil, fmt.Errorf("certificate chain: %w", err)
+		}
+		for _, ic := range chain {
+			intermediates.AddCert(ic)
+		}
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return nil, failure.New(failure.IdentityRejected, "certificate does not chain to a trusted Fulcio root: %w", err)
+	}
+	san, issuer := signing.CertificateIdentity(cert)
+	if v.identity != nil && !v.identity.MatchString(san) {
+		return nil, failure.New(failure.IdentityRejected, "certificate identity %q is not allowed", san)
+	}
+	if v.opts.Issuer != "" && issuer != v.opts.Issuer {
+		return nil, failure.New(failure.IdentityRejected, "certificate issuer %q is not allowed", issuer)
+	}
+	return cert, nil
+}
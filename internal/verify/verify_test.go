@@ -0,0 +1,631 @@
+package verify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/rekor"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/fake"
+	"github.com/waveywaves/tekton-slsa-demo/internal/trust"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func newKey(t testing.TB) *ecdsa.PrivateKey {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func pemCert(der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func simpleSigningPayload(digest string) []byte {
+	return []byte(`{"critical":{"identity":{"docker-reference":"registry.local/app"},"image":{"docker-manifest-digest":"` +
+		digest + `"},"type":"cosign container image signature"},"optional":null}`)
+}
+
+func signPayload(t testing.TB, key *ecdsa.PrivateKey, payload []byte) string {
+	t.Helper()
+	s, err := signing.NewSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := s.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func provenanceEnvelope(t testing.TB, key *ecdsa.PrivateKey, digest string) *dsse.Envelope {
+	t.Helper()
+	hexDigest := digest[len("sha256:"):]
+	stmt, err := attestation.NewStatement(attestation.PredicateSLSAProvenanceV1, attestation.Provenance{},
+		attestation.Subject{Name: "registry.local/app", Digest: map[string]string{"sha256": hexDigest}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(stmt)
+	s, err := signing.NewSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := dsse.Sign(attestation.PayloadType, payload, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func keyRoot(t testing.TB, key *ecdsa.PrivateKey) *trust.Root {
+	t.Helper()
+	root := &trust.Root{}
+	if err := root.AddPublicKey(key.Public()); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestVerifyKeyBased(t *testing.T) {
+	key := newKey(t)
+	payload := simpleSigningPayload(testDigest)
+	ev := &Evidence{
+		Image:        "registry.local/app:v1",
+		Digest:       testDigest,
+		Signatures:   []Signature{{Payload: payload, Signature: signPayload(t, key, payload)}},
+		Attestations: []Attestation{{Envelope: provenanceEnvelope(t, key, testDigest)}},
+	}
+
+	res, err := Verify(ev, Options{Root: keyRoot(t, key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Verified || len(res.Checks) != 2 {
+		t.Fatalf("Verify() = %+v", res)
+	}
+	for _, c := range res.Checks {
+		if !c.Verified {
+			t.Errorf("%s check failed: %s", c.Kind, c.Error)
+		}
+	}
+	if res.Checks[1].PredicateType != attestation.PredicateSLSAProvenanceV1 {
+		t.Errorf("attestation predicate = %q", res.Checks[1].PredicateType)
+	}
+	// The empty provenance verifies, but is reported as not matching the
+	// provenance schema.
+	if len(res.Checks[1].SchemaViolations) == 0 {
+		t.Error("no schema violations reported for empty provenance")
+	}
+	if log := res.SARIF("test", "0"); len(log.Runs[0].Results) != len(res.Checks[1].SchemaViolations) || log.Runs[0].Results[0].RuleID != RuleSchemaViolation {
+		t.Errorf("SARIF results = %+v", log.Runs[0].Results)
+	}
+
+	res, _ = Verify(ev, Options{Root: keyRoot(t, newKey(t))})
+	if res.Verified {
+		t.Error("Verify() accepted signatures from an untrusted key")
+	}
+	if res.Code != failure.SignatureMismatch {
+		t.Errorf("untrusted key: Code = %q, want %s", res.Code, failure.SignatureMismatch)
+	}
+
+	res, _ = Verify(ev, Options{Root: keyRoot(t, key), RequireTlog: true})
+	if res.Verified {
+		t.Error("Verify() accepted signatures without a tlog entry when one is required")
+	}
+	if res.Code != failure.PolicyDenied {
+		t.Errorf("missing tlog: Code = %q, want %s", res.Code, failure.PolicyDenied)
+	}
+}
+
+func TestVerifyAnnotations(t *testing.T) {
+	key := newKey(t)
+	payload := []byte(strings.Replace(string(simpleSigningPayload(testDigest)), `"optional":null`, `"optional":{"env":"prod","team":"security","build":42}`, 1))
+	ev := &Evidence{Digest: testDigest, Signatures: []Signature{{Payload: payload, Signature: signPayload(t, key, payload)}}}
+
+	for _, tt := range []struct {
+		required map[string]string
+		err      string
+	}{
+		{nil, ""},
+		{map[string]string{"env": "prod", "build": "42"}, ""},
+		{map[string]string{"env": "staging"}, `signature annotation env is "prod", not "staging"`},
+		{map[string]string{"env": "prod", "owner": "sre"}, "signature lacks the required annotation owner=sre"},
+	} {
+		res, err := Verify(ev, Options{Root: keyRoot(t, key), Annotations: tt.required})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := res.Checks[0]
+		if c.Verified != (tt.err == "") || c.Error != tt.err {
+			t.Errorf("required %v: verified %v, error %q; want error %q", tt.required, c.Verified, c.Error, tt.err)
+		}
+		if want := failure.PolicyDenied; tt.err != "" && (c.Code != want || res.Code != want) {
+			t.Errorf("required %v: codes %q, %q; want %s", tt.required, c.Code, res.Code, want)
+		}
+		if got := FormatAnnotations(c.Annotations); got != "build=42,env=prod,team=security" {
+			t.Errorf("required %v: annotations %s", tt.required, got)
+		}
+	}
+}
+
+func TestVerifyRejectsOtherDigest(t *testing.T) {
+	key := newKey(t)
+	other := "sha256:" + hex.EncodeToString(make([]byte, 32))
+	payload := simpleSigningPayload(other)
+	ev := &Evidence{
+		Digest:       testDigest,
+		Signatures:   []Signature{{Payload: payload, Signature: signPayload(t, key, payload)}},
+		Attestations: []Attestation{{Envelope: provenanceEnvelope(t, key, other)}},
+	}
+	res, err := Verify(ev, Options{Root: keyRoot(t, key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Verified {
+		t.Error("Verify() accepted evidence for a different digest")
+	}
+}
+
+func TestVerifyAttestationTlogCoversSignature(t *testing.T) {
+	logged, added := newKey(t), newKey(t)
+	log := fake.NewRekor(t)
+	env := provenanceEnvelope(t, logged, testDigest)
+	proof := &TlogProof{Bundle: log.LogDSSE(t, env)}
+	// A second signature, by another key, added after the envelope was
+	// logged.
+	payload, _ := env.DecodePayload()
+	s, err := signing.NewSigner(added)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra, err := dsse.Sign(env.PayloadType, payload, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := *env
+	tampered.Signatures = append([]dsse.Signature{}, env.Signatures...)
+	tampered.Signatures = append(tampered.Signatures, extra.Signatures...)
+
+	for name, tt := range map[string]struct {
+		key  *ecdsa.PrivateKey
+		want bool
+	}{
+		"logged signature": {logged, true},
+		"added signature":  {added, false},
+	} {
+		root := keyRoot(t, tt.key)
+		root.RekorKeys = []string{log.PublicKeyPEM(t)}
+		ev := &Evidence{
+			Digest:       testDigest,
+			Attestations: []Attestation{{Envelope: &tampered, Tlog: proof}},
+		}
+		res, err := Verify(ev, Options{Root: root, RequireTlog: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := res.Checks[0]; c.Verified != tt.want {
+			t.Errorf("%s: Verified = %v, want %v (%s)", name, c.Verified, tt.want, c.Error)
+		}
+	}
+}
+
+func TestSubjectMatchesOtherAlgorithms(t *testing.T) {
+	sha512Hex := hex.EncodeToString(make([]byte, 64))
+	sha3Hex := strings.Repeat("ab", 32)
+	stmt, err := attestation.NewStatement(attestation.PredicateSLSAProvenanceV1, attestation.Provenance{},
+		attestation.Subject{Name: "app.tar", Digest: map[string]string{"sha512": sha512Hex, "sha3_256": sha3Hex}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for d, want := range map[string]bool{
+		"sha512:" + sha512Hex:                  true,
+		"SHA3-256:" + strings.ToUpper(sha3Hex): true,
+		"sha3_512:" + sha3Hex:                  false,
+		testDigest:                             false,
+	} {
+		if got := SubjectMatches(stmt, d); got != want {
+			t.Errorf("SubjectMatches(%s) = %v, want %v", d, got, want)
+		}
+	}
+}
+
+// keylessFixture is a Fulcio-like CA and Rekor-like log for one signature.
+type keylessFixture struct {
+	root    *trust.Root
+	sig     Signature
+	signed  time.Time
+	subject string
+}
+
+func newKeylessFixture(t testing.TB) *keylessFixture {
+	t.Helper()
+	signed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	caKey := newKey(t)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-fulcio"},
+		NotBefore:             signed.Add(-24 * time.Hour),
+		NotAfter:              signed.Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	subject := "https://github.com/waveywaves/tekton-slsa-demo/.github/workflows/release.yml@refs/heads/main"
+	san, _ := url.Parse(subject)
+	issuer, _ := asn1.Marshal("https://token.actions.githubusercontent.com")
+	leafKey := newKey(t)
+	leafTmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       signed.Add(-time.Minute),
+		NotAfter:        signed.Add(9 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:            []*url.URL{san},
+		ExtraExtensions: []pkix.Extension{{Id: signing.OIDIssuerV2, Value: issuer}},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, caCert, leafKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := simpleSigningPayload(testDigest)
+	sigB64 := signPayload(t, leafKey, payload)
+	sigRaw, _ := base64.StdEncoding.DecodeString(sigB64)
+
+	logKey := newKey(t)
+	logID, _ := rekor.LogID(logKey.Public())
+	sum := sha256.Sum256(payload)
+	body, _ := json.Marshal(map[string]any{
+		"kind": "hashedrekord",
+		"spec": map[string]any{
+			"data":      map[string]any{"hash": map[string]string{"value": hex.EncodeToString(sum[:])}},
+			"signature": map[string]any{"content": base64.StdEncoding.EncodeToString(sigRaw)},
+		},
+	})
+	b := &rekor.Bundle{Payload: rekor.BundlePayload{
+		Body:           base64.StdEncoding.EncodeToString(body),
+		IntegratedTime: signed.Unix(),
+		LogIndex:       7,
+		LogID:          logID,
+	}}
+	canonical, _ := json.Marshal(map[string]any{
+		"body": b.Payload.Body, "integratedTime": b.Payload.IntegratedTime,
+		"logID": b.Payload.LogID, "logIndex": b.Payload.LogIndex,
+	})
+	digest := sha256.Sum256(canonical)
+	b.SignedEntryTimestamp, _ = ecdsa.SignASN1(rand.Reader, logKey, digest[:])
+
+	logPEM, _ := signing.MarshalPublicKey(logKey.Public())
+	return &keylessFixture{
+		root: &trust.Root{
+			FulcioCertificates: []string{pemCert(caDER)},
+			RekorKeys:          []string{string(logPEM)},
+		},
+		sig: Signature{
+			Payload:     payload,
+			Signature:   sigB64,
+			Certificate: pemCert(leafDER),
+			Tlog:        &TlogProof{Bundle: b},
+		},
+		signed:  signed,
+		subject: subject,
+	}
+}
+
+func TestVerifyKeyless(t *testing.T) {
+	f := newKeylessFixture(t)
+	ev := &Evidence{Digest: testDigest, Signatures: []Signature{f.sig}}
+
+	res, err := Verify(ev, Options{
+		Root:     f.root,
+		Identity: `^https://github\.com/waveywaves/`,
+		Issuer:   "https://token.actions.githubusercontent.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := res.Checks[0]
+	if !c.Verified {
+		t.Fatalf("keyless signature failed: %s", c.Error)
+	}
+	if c.Signer != f.subject {
+		t.Errorf("Signer = %q, want %q", c.Signer, f.subject)
+	}
+	if c.LogIndex == nil || *c.LogIndex != 7 || !c.SignedAt.Equal(f.signed) {
+		t.Errorf("tlog details = %v, %v", c.LogIndex, c.SignedAt)
+	}
+
+	for name, tt := range map[string]struct {
+		opts Options
+		code failure.Code
+	}{
+		"wrong identity": {Options{Root: f.root, Identity: `^https://gitlab\.com/`}, failure.IdentityRejected},
+		"wrong issuer":   {Options{Root: f.root, Issuer: "https://accounts.google.com"}, failure.IdentityRejected},
+		"untrusted log":  {Options{Root: &trust.Root{FulcioCertificates: f.root.FulcioCertificates}}, failure.SignatureMismatch},
+	} {
+		res, err := Verify(ev, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Verified {
+			t.Errorf("%s: Verify() succeeded", name)
+		}
+		if res.Code != tt.code {
+			t.Errorf("%s: Code = %q, want %s", name, res.Code, tt.code)
+		}
+	}
+
+	// Without the log timestamp the short-lived certificate has expired.
+	noTlog := f.sig
+	noTlog.Tlog = nil
+	res, _ = Verify(&Evidence{Digest: testDigest, Signatures: []Signature{noTlog}}, Options{Root: f.root})
+	if res.Verified {
+		t.Error("Verify() accepted an expired certificate without a log timestamp")
+	}
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	f := newKeylessFixture(t)
+	ev := &Evidence{Image: "registry.local/app:v1", Digest: testDigest, Signatures: []Signature{f.sig}}
+	path := filepath.Join(t.TempDir(), "app.bundle.json")
+	if err := NewBundle(ev, f.root, f.signed).Write(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadBundle(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Root: f.root, Identity: regexp.QuoteMeta(f.subject), Issuer: "https://token.actions.githubusercontent.com", RequireTlog: true}
+	res, err := b.Verify(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Verified {
+		t.Errorf("bundle did not verify: %+v", res.Checks)
+	}
+
+	// The bundle's own trusted root is not trusted.
+	if _, err := b.Verify(Options{RequireTlog: true}); err == nil {
+		t.Error("verified a bundle against its own trusted root")
+	}
+	// Nor is any Fulcio identity.
+	if _, err := b.Verify(Options{Root: f.root}); err == nil {
+		t.Error("verified keyless signatures without an identity and issuer")
+	}
+}
+
+func TestBundleForgedTrustedRoot(t *testing.T) {
+	f := newKeylessFixture(t)
+	// Someone signs with their own key and adds it to the bundle's root.
+	key := newKey(t)
+	payload := simpleSigningPayload(testDigest)
+	ev := &Evidence{Image: "registry.local/app:v1", Digest: testDigest, Signatures: []Signature{{Payload: payload, Signature: signPayload(t, key, payload)}}}
+	forged := &trust.Root{}
+	if err := forged.AddPublicKey(key.Public()); err != nil {
+		t.Fatal(err)
+	}
+	b := NewBundle(ev, forged, f.signed)
+
+	local := &trust.Root{RekorKeys: f.root.RekorKeys}
+	if err := local.AddPublicKey(newKey(t).Public()); err != nil {
+		t.Fatal(err)
+	}
+	_, err := b.Verify(Options{Root: local})
+	if err == nil || !strings.Contains(err.Error(), "does not match the local one") {
+		t.Errorf("Verify() with a forged trusted root = %v", err)
+	}
+
+	// The root is only a hint: a bundle without one verifies against the
+	// local key.
+	if err := local.AddPublicKey(key.Public()); err != nil {
+		t.Fatal(err)
+	}
+	b.TrustedRoot = trust.Root{}
+	res, err := b.Verify(Options{Root: local})
+	if err != nil || !res.Verified {
+		t.Errorf("Verify() against the local key = %+v, %v", res, err)
+	}
+}
+
+func TestResultSARIF(t *testing.T) {
+	idx := int64(42)
+	res := &Result{
+		Image:  "ghcr.io/org/app:v1",
+		Digest: testDigest,
+		Checks: []Check{
+			{Kind: KindSignature, Verified: true},
+			{Kind: KindAttestation, PredicateType: attestation.PredicateSLSAProvenanceV1, LogIndex: &idx, Error: "no key verified the envelope"},
+		},
+		Verified: true,
+	}
+	run := res.SARIF("tekton-slsa-demo", "1.0.0").Runs[0]
+	if len(run.Results) != 1 {
+		t.Fatalf("got %d results, want 1 for the failed attestation", len(run.Results))
+	}
+	if r := run.Results[0]; r.RuleID != RuleInvalidAttestation || r.Level != "warning" || r.Properties["logIndex"] != idx {
+		t.Errorf("failed check on a verified image = %+v", r)
+	}
+
+	res.Verified = false
+	run = res.SARIF("tekton-slsa-demo", "1.0.0").Runs[0]
+	if len(run.Results) != 2 || len(run.Tool.Driver.Rules) != 2 {
+		t.Fatalf("got %d results and %d rules, want 2 of each", len(run.Results), len(run.Tool.Driver.Rules))
+	}
+	for _, r := range run.Results {
+		if r.Level != "error" {
+			t.Errorf("%s on an unverified image has level %s, want error", r.RuleID, r.Level)
+		}
+	}
+	if run.Results[0].RuleID != RuleUnverified || run.Results[1].RuleIndex != 1 {
+		t.Errorf("unexpected results %+v", run.Results)
+	}
+
+	// Unpinned materials are warnings even on an unverified image.
+	res.Checks[1].UnpinnedMaterials = []attestation.UnpinnedMaterial{{URI: "oci://ghcr.io/org/base:latest", Reason: "no digest; it names the tag latest"}}
+	run = res.SARIF("tekton-slsa-demo", "1.0.0").Runs[0]
+	if r := run.Results[1]; len(run.Results) != 3 || r.RuleID != RuleUnpinnedMaterial || r.Level != "warning" || !strings.Contains(r.Message.Text, "oci://ghcr.io/org/base:latest") {
+		t.Errorf("unpinned material results %+v", run.Results)
+	}
+}
+
+func TestResultVSA(t *testing.T) {
+	res := &Result{
+		Image:  "ghcr.io/org/app:v1",
+		Digest: testDigest,
+		Checks: []Check{
+			{Kind: KindSignature, Verified: true},
+			{Kind: KindAttestation, PredicateType: attestation.PredicateSLSAProvenanceV1, Verified: true},
+		},
+		Verified: true,
+	}
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	stmt, err := res.VSA("https://example.com/verifier", "https://example.com/policy", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alg, hex, _ := strings.Cut(testDigest, ":")
+	if stmt.PredicateType != attestation.PredicateVSA || stmt.Subject[0].Name != "ghcr.io/org/app" || stmt.Subject[0].Digest[alg] != hex {
+		t.Errorf("statement = %+v", stmt)
+	}
+	var p VSAPredicate
+	if err := json.Unmarshal(stmt.Predicate, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.VerificationResult != "PASSED" || len(p.VerifiedLevels) != 1 || p.VerifiedLevels[0] != "SLSA_BUILD_LEVEL_2" || p.TimeVerified.Location() != time.UTC || p.Policy.URI != "https://example.com/policy" {
+		t.Errorf("predicate = %+v", p)
+	}
+
+	res.Checks[1].Verified = false
+	if stmt, err = res.VSA("https://example.com/verifier", "https://example.com/policy", at); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(stmt.Predicate, &p)
+	if p.VerifiedLevels[0] != "SLSA_BUILD_LEVEL_0" {
+		t.Errorf("levels without provenance = %v", p.VerifiedLevels)
+	}
+
+	res.Verified = false
+	if stmt, err = res.VSA("https://example.com/verifier", "https://example.com/policy", at); err != nil {
+		t.Fatal(err)
+	}
+	p = VSAPredicate{}
+	json.Unmarshal(stmt.Predicate, &p)
+	if p.VerificationResult != "FAILED" || len(p.VerifiedLevels) != 0 {
+		t.Errorf("failed predicate = %+v", p)
+	}
+}
+
+func TestVerifyAgainstFakeSigstore(t *testing.T) {
+	reg := fake.NewRegistry(t)
+	log := fake.NewRekor(t)
+	ca := fake.NewFulcio(t)
+	ref := reg.PushImage(t, "app:v1")
+	id := ca.Identity(t, "https://github.com/waveywaves/tekton-slsa-demo/.github/workflows/release.yaml@refs/heads/main")
+	fake.SignImage(t, reg, ref, id, log)
+	fake.Attest(t, reg, ref, fake.Provenance(t, ref), id, log)
+
+	ctx := context.Background()
+	ev, err := Collect(ctx, reg.Client(), log.Client(), reg.Ref(t, "app:v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Digest != ref.Digest || len(ev.Signatures) != 1 || len(ev.Attestations) != 1 {
+		t.Fatalf("evidence = %s, %d signatures, %d attestations", ev.Digest, len(ev.Signatures), len(ev.Attestations))
+	}
+	root, err := trust.Fetch(ctx, nil, log.URL, ca.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Verify(ev, Options{
+		Root:        root,
+		Identity:    `^https://github\.com/waveywaves/`,
+		Issuer:      fake.DefaultIssuer,
+		RequireTlog: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range res.Checks {
+		if !c.Verified {
+			t.Errorf("%s check failed: %s", c.Kind, c.Error)
+		}
+		if c.LogIndex == nil {
+			t.Errorf("%s check has no log index", c.Kind)
+		}
+	}
+
+	// The signed entry timestamp covers the log index.
+	ev.Signatures[0].Tlog.Bundle.Payload.LogIndex = 1
+	res, err = Verify(ev, Options{Root: root, RequireTlog: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Checks[0].Verified {
+		t.Error("signature verified with a tampered log index")
+	}
+}
+
+func BenchmarkVerify(b *testing.B) {
+	key := newKey(b)
+	payload := simpleSigningPayload(testDigest)
+	keyBased := &Evidence{
+		Digest:       testDigest,
+		Signatures:   []Signature{{Payload: payload, Signature: signPayload(b, key, payload)}},
+		Attestations: []Attestation{{Envelope: provenanceEnvelope(b, key, testDigest)}},
+	}
+	f := newKeylessFixture(b)
+	keyless := &Evidence{Digest: testDigest, Signatures: []Signature{f.sig}}
+
+	for _, bc := range []struct {
+		name string
+		ev   *Evidence
+		opts Options
+	}{
+		{"key", keyBased, Options{Root: keyRoot(b, key)}},
+		{"keyless", keyless, Options{Root: f.root, Identity: `^https://github\.com/`, RequireTlog: true}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				res, err := Verify(bc.ev, bc.opts)
+				if err != nil || !res.Verified {
+					b.Fatalf("Verify() = %+v, %v", res, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package verify
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+)
+
+// VSAPredicate is a SLSA verification summary (VSA) v1: who verified an
+// artifact, when, against which policy, and the outcome.
+type VSAPredicate struct {
+	Verifier struct {
+		ID string `json:"id"`
+	} `json:"verifier"`
+	TimeVerified time.Time `json:"timeVerified"`
+	ResourceURI  string    `json:"resourceUri"`
+	Policy       struct {
+		URI string `json:"uri"`
+	} `json:"policy"`
+	// VerificationResult is PASSED or FAILED.
+	VerificationResult string   `json:"verificationResult"`
+	VerifiedLevels     []string `json:"verifiedLevels"`
+}
+
+// VSA summarises r as a verification summary statement about its digest,
+// from verifierID at t against the policy identified by policyURI. An
+// image with verified provenance reaches SLSA build level 2, which signed
+// provenance is; one that verified otherwise reaches level 0.
+func (r *Result) VSA(verifierID, policyURI string, t time.Time) (*attestation.Statement, error) {
+	alg, hex, ok := strings.Cut(r.Digest, ":")
+	if !ok {
+		return nil, errors.New("vsa: the result has no digest")
+	}
+	var p VSAPredicate
+	p.Verifier.ID = verifierID
+	p.TimeVerified = t.UTC()
+	p.ResourceURI = r.Image
+	p.Policy.URI = policyURI
+	p.VerificationResult = "FAILED"
+	p.VerifiedLevels = []string{}
+	if r.Verified {
+		p.VerificationResult = "PASSED"
+		level := "SLSA_BUILD_LEVEL_0"
+		for _, c := range r.Checks {
+			if c.Verified && attestation.IsProvenance(c.PredicateType) {
+				level = "SLSA_BUILD_LEVEL_2"
+			}
+		}
+		p.VerifiedLevels = append(p.VerifiedLevels, level)
+	}
+	name := r.Image
+	if ref, err := oci.ParseReference(r.Image); err == nil {
+		name = ref.Name()
+	}
+	return attestation.NewStatement(attestation.PredicateVSA, p, attestation.Subject{Name: name, Digest: map[string]string{alg: hex}})
+}
@@ -0,0 +1,263 @@
+// Package watch monitors image tags for new digests and verifies each
+// digest once, the first time a watched tag points at it.
+//
+// A target watches one tag, or every tag of a repository matching a
+// pattern, so new releases are verified as they are pushed:
+//
+//	m := watch.New([]watch.Target{{Image: ref, Tags: "v*"}}, registry, verifyFunc, clock.System{})
+//	newRecords, err := m.Poll(ctx)
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/clock"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// Target is a watched image.
+type Target struct {
+	// Image is the repository to watch, and the tag to watch when Tags is
+	// empty.
+	Image oci.Reference
+	// Tags is a path.Match pattern such as "v*". When set, every tag of
+	// the repository matching it is watched, including tags pushed later.
+	Tags string
+	// Options are what each new digest is verified against.
+	Options verify.Options
+}
+
+// Registry resolves tags to digests. A registry that also implements
+// TagLister can watch tag patterns.
+type Registry interface {
+	Resolve(ctx context.Context, ref oci.Reference) (string, error)
+}
+
+// TagLister lists the tags of a repository. *oci.Client implements it.
+type TagLister interface {
+	ListTags(ctx context.Context, ref oci.Reference) ([]string, error)
+}
+
+// VerifyFunc verifies an image pinned by digest.
+type VerifyFunc func(ctx context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error)
+
+// Record is the outcome of verifying one digest of a watched tag.
+type Record struct {
+	// Image is the watched tag the digest was found under.
+	Image  string `json:"image"`
+	Digest string `json:"digest"`
+	// FirstSeen is when the tag was first seen pointing at Digest.
+	FirstSeen  time.Time      `json:"firstSeen"`
+	VerifiedAt time.Time      `json:"verifiedAt"`
+	Verified   bool           `json:"verified"`
+	Result     *verify.Result `json:"result,omitempty"`
+	// Error is why the digest could not be verified at all; such digests
+	// are retried on the next poll.
+	Error string `json:"error,omitempty"`
+	// Code classifies Error, or the failure of a digest that did not
+	// verify.
+	Code failure.Code `json:"code,omitempty"`
+}
+
+// Status is a snapshot of the monitor.
+type Status struct {
+	// LastPoll is when the last poll finished; zero before the first.
+	LastPoll time.Time `json:"lastPoll"`
+	// Current has the record of the digest each watched tag points at,
+	// ordered by image.
+	Current []Record `json:"current"`
+	// Recent has the latest records of new digests, newest first.
+	Recent []Record `json:"recent"`
+}
+
+// maxRecent bounds the records Status reports as recent.
+const maxRecent = 100
+
+// Monitor watches a set of targets. It is safe for concurrent use, but
+// polls should not overlap.
+type Monitor struct {
+	// Owns reports whether this monitor verifies a digest, when replicas
+	// share the watch list; nil verifies every digest. Digests owned
+	// elsewhere are neither verified nor reported, and are picked up
+	// should they become owned.
+	Owns func(digest string) bool
+
+	targets  []Target
+	registry Registry
+	verify   VerifyFunc
+	clock    clock.Clock
+
+	mu       sync.Mutex
+	current  map[string]*Record // by watched tag
+	byDigest map[string]*Record // by repository@digest
+	recent   []*Record
+	lastPoll time.Time
+}
+
+// New returns a monitor that has seen nothing yet.
+func New(targets []Target, registry Registry, verify VerifyFunc, c clock.Clock) *Monitor {
+	if c == nil {
+		c = clock.System{}
+	}
+	return &Monitor{
+		targets:  targets,
+		registry: registry,
+		verify:   verify,
+		clock:    c,
+		current:  map[string]*Record{},
+		byDigest: map[string]*Record{},
+	}
+}
+
+// Poll resolves every watched tag and verifies the digests not seen
+// before, returning their records. Targets that cannot be resolved are
+// skipped and reported in the error; the others are still polled.
+func (m *Monitor) Poll(ctx context.Context) ([]Record, error) {
+	var fresh []Record
+	var errs []error
+	for _, t := range m.targets {
+		tags, err := m.tags(ctx, t)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.Image.Name(), err))
+			continue
+		}
+		for _, tag := range tags {
+			ref := t.Image.WithTag(tag)
+			digest, err := m.registry.Resolve(ctx, ref)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", ref, err))
+				continue
+			}
+			if m.Owns != nil && !m.Owns(digest) {
+				m.mu.Lock()
+				delete(m.current, ref.String())
+				m.mu.Unlock()
+				continue
+			}
+			if rec, ok := m.check(ctx, t, ref, digest); ok {
+				fresh = append(fresh, rec)
+			}
+		}
+	}
+	m.mu.Lock()
+	m.lastPoll = m.clock.Now()
+	m.mu.Unlock()
+	return fresh, errors.Join(errs...)
+}
+
+// tags returns the tags t watches.
+func (m *Monitor) tags(ctx context.Context, t Target) ([]string, error) {
+	if t.Tags == "" {
+		return []string{t.Image.Tag}, nil
+	}
+	lister, ok := m.registry.(TagLister)
+	if !ok {
+		return nil, errors.New("the registry cannot list tags")
+	}
+	all, err := lister.ListTags(ctx, t.Image)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, tag := range all {
+		if isCosignTag(tag) {
+			continue
+		}
+		if ok, _ := path.Match(t.Tags, tag); ok {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// isCosignTag reports whether tag holds cosign signatures, attestations or
+// SBOMs rather than an image.
+func isCosignTag(tag string) bool {
+	for _, suffix := range []string{".sig", ".att", ".sbom"} {
+		if strings.HasSuffix(tag, suffix) && strings.Contains(tag, "-") {
+			return true
+		}
+	}
+	return false
+}
+
+// check makes digest the current digest of ref, verifying it unless it
+// was verified before, and reports the record when it is new.
+func (m *Monitor) check(ctx context.Context, t Target, ref oci.Reference, digest string) (Record, bool) {
+	key := ref.Name() + "@" + digest
+	m.mu.Lock()
+	rec := m.byDigest[key]
+	if rec != nil && rec.Error == "" {
+		m.current[ref.String()] = rec
+		m.mu.Unlock()
+		return Record{}, false
+	}
+	m.mu.Unlock()
+
+	now := m.clock.Now()
+	next := &Record{Image: ref.String(), Digest: digest, FirstSeen: now, VerifiedAt: now}
+	if rec != nil {
+		next.FirstSeen = rec.FirstSeen
+	}
+	res, err := m.verify(ctx, ref.WithDigest(digest), t.Options)
+	if err != nil {
+		next.Error, next.Code = err.Error(), failure.CodeOf(err)
+	} else {
+		next.Result, next.Verified, next.Code = res, res.Verified, res.Code
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rec != nil {
+		// A retry: update the record in place, where Recent has it.
+		*rec = *next
+		next = rec
+	}
+	m.byDigest[key] = next
+	m.current[ref.String()] = next
+	if rec == nil {
+		m.recent = append(m.recent, next)
+		if len(m.recent) > maxRecent {
+			m.recent = m.recent[len(m.recent)-maxRecent:]
+		}
+	}
+	return *next, true
+}
+
+// Status returns a snapshot of what the monitor has seen.
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := Status{LastPoll: m.lastPoll, Current: []Record{}, Recent: []Record{}}
+	for _, rec := range m.current {
+		st.Current = append(st.Current, *rec)
+	}
+	sort.Slice(st.Current, func(i, j int) bool { return st.Current[i].Image < st.Current[j].Image })
+	for i := len(m.recent) - 1; i >= 0; i-- {
+		st.Recent = append(st.Recent, *m.recent[i])
+	}
+	return st
+}
+
+// Unverified counts the watched tags whose current digest did not verify.
+func (m *Monitor) Unverified() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, rec := range m.current {
+		if !rec.Verified {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,140 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/clock"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/testing/fake"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// recorder verifies images whose tag is in good and fails those in broken,
+// remembering what it was asked to verify.
+type recorder struct {
+	good, broken map[string]bool
+	verified     []string
+}
+
+func (r *recorder) verify(_ context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+	r.verified = append(r.verified, ref.String())
+	if r.broken[ref.Tag] {
+		return nil, errors.New("registry unavailable")
+	}
+	return &verify.Result{Image: ref.String(), Digest: ref.Digest, Verified: r.good[ref.Tag]}, nil
+}
+
+func TestPollTagPattern(t *testing.T) {
+	reg := fake.NewRegistry(t)
+	v1 := reg.PushImage(t, "app:v1")
+	fake.SignImage(t, reg, v1, fake.KeyIdentity(t), nil)
+	reg.PushImage(t, "app:dev")
+	rec := &recorder{good: map[string]bool{"v1": true}}
+	m := New([]Target{{Image: reg.Ref(t, "app:latest"), Tags: "v*"}}, reg.Client(), rec.verify,
+		clock.Fixed(time.Date(2024, 3, 12, 9, 0, 0, 0, time.UTC)))
+	ctx := context.Background()
+
+	fresh, err := m.Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fresh) != 1 || fresh[0].Digest != v1.Digest || !fresh[0].Verified || rec.verified[0] != v1.String() {
+		t.Fatalf("first poll = %+v, verified %v", fresh, rec.verified)
+	}
+	if fresh, err := m.Poll(ctx); err != nil || len(fresh) != 0 {
+		t.Errorf("second poll = %+v, %v; want nothing new", fresh, err)
+	}
+
+	v2 := reg.PushImage(t, "app:v2")
+	fresh, err = m.Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fresh) != 1 || fresh[0].Digest != v2.Digest || fresh[0].Verified {
+		t.Errorf("poll after pushing v2 = %+v", fresh)
+	}
+	if len(rec.verified) != 2 {
+		t.Errorf("verified %v, want v1 and v2 once each", rec.verified)
+	}
+
+	st := m.Status()
+	if len(st.Current) != 2 || st.Current[0].Image != reg.Ref(t, "app:v1").String() || len(st.Recent) != 2 || st.Recent[0].Digest != v2.Digest {
+		t.Errorf("status = %+v", st)
+	}
+	if st.LastPoll.IsZero() {
+		t.Error("status lacks the last poll time")
+	}
+	if n := m.Unverified(); n != 1 {
+		t.Errorf("Unverified() = %d, want 1", n)
+	}
+}
+
+func TestPollMovedTagAndRetries(t *testing.T) {
+	reg := fake.NewRegistry(t)
+	first := reg.PushImage(t, "app:latest")
+	rec := &recorder{good: map[string]bool{"latest": true}, broken: map[string]bool{"latest": true}}
+	m := New([]Target{{Image: reg.Ref(t, "app:latest")}}, reg.Client(), rec.verify, nil)
+	ctx := context.Background()
+
+	fresh, err := m.Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fresh) != 1 || fresh[0].Error == "" || fresh[0].Verified {
+		t.Fatalf("poll with verification failing = %+v", fresh)
+	}
+
+	// Digests that could not be verified are retried.
+	delete(rec.broken, "latest")
+	fresh, err = m.Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fresh) != 1 || fresh[0].Digest != first.Digest || fresh[0].Error != "" || !fresh[0].Verified {
+		t.Errorf("retry = %+v", fresh)
+	}
+
+	moved, _ := reg.PushIndex(t, "app:latest", "linux/amd64")
+	if fresh, _ = m.Poll(ctx); len(fresh) != 1 || fresh[0].Digest != moved.Digest {
+		t.Errorf("poll after moving the tag = %+v", fresh)
+	}
+	st := m.Status()
+	if len(st.Current) != 1 || st.Current[0].Digest != moved.Digest || len(st.Recent) != 2 || st.Recent[1].Error != "" {
+		t.Errorf("status = %+v", st)
+	}
+
+	if _, err := New([]Target{{Image: reg.Ref(t, "missing:v1")}}, reg.Client(), rec.verify, nil).Poll(ctx); !errors.Is(err, oci.ErrNotFound) {
+		t.Errorf("missing image: %v", err)
+	}
+}
+
+func TestPollSkipsDigestsOwnedElsewhere(t *testing.T) {
+	reg := fake.NewRegistry(t)
+	v1 := reg.PushImage(t, "app:v1")
+	v2 := reg.PushImage(t, "app:v2")
+	rec := &recorder{good: map[string]bool{"v1": true, "v2": true}}
+	m := New([]Target{{Image: reg.Ref(t, "app:latest"), Tags: "v*"}}, reg.Client(), rec.verify, nil)
+	owned := map[string]bool{v1.Digest: true}
+	m.Owns = func(digest string) bool { return owned[digest] }
+	ctx := context.Background()
+
+	fresh, err := m.Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fresh) != 1 || fresh[0].Digest != v1.Digest || len(rec.verified) != 1 {
+		t.Fatalf("poll = %+v, verified %v; want v1 only", fresh, rec.verified)
+	}
+
+	// Ownership moves when replicas come and go.
+	owned = map[string]bool{v2.Digest: true}
+	if fresh, err = m.Poll(ctx); err != nil || len(fresh) != 1 || fresh[0].Digest != v2.Digest {
+		t.Errorf("poll after v2 became owned = %+v, %v", fresh, err)
+	}
+	if st := m.Status(); len(st.Current) != 1 || st.Current[0].Digest != v2.Digest {
+		t.Errorf("status lists digests owned elsewhere: %+v", st.Current)
+	}
+}
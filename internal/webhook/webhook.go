@@ -0,0 +1,227 @@
+// Package webhook decodes the notifications container registries send when
+// an image is pushed: Docker Distribution (registry v2) notification
+// envelopes, Harbor webhooks and GitHub package events for GHCR.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+)
+
+// Formats of notification Parse understands.
+const (
+	FormatDistribution = "distribution"
+	FormatHarbor       = "harbor"
+	FormatGitHub       = "github"
+)
+
+// ErrUnknownFormat is returned for payloads of no supported registry.
+var ErrUnknownFormat = errors.New("webhook: unrecognized notification format")
+
+// Parse returns the images pushed according to a notification, each pinned
+// to its manifest digest and carrying its tag when the registry reports
+// one, along with the payload's format. Events other than pushes of
+// images, such as pulls, deletions and layer uploads, are ignored, so a
+// valid notification may yield no images.
+func Parse(h http.Header, body []byte) ([]oci.Reference, string, error) {
+	if event := h.Get("X-GitHub-Event"); event != "" {
+		if event != "package" && event != "registry_package" {
+			return nil, FormatGitHub, nil
+		}
+		refs, err := parseGitHub(body)
+		return refs, FormatGitHub, err
+	}
+	var probe struct {
+		Events    json.RawMessage `json:"events"`
+		Type      string          `json:"type"`
+		EventData json.RawMessage `json:"event_data"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return nil, "", fmt.Errorf("webhook: %w", err)
+	}
+	switch {
+	case probe.Events != nil:
+		refs, err := parseDistribution(body)
+		return refs, FormatDistribution, err
+	case probe.Type != "" && probe.EventData != nil:
+		refs, err := parseHarbor(body)
+		return refs, FormatHarbor, err
+	}
+	return nil, "", ErrUnknownFormat
+}
+
+// parseDistribution reads a Docker Distribution notification envelope.
+// Registries send an event for every blob as well as the manifest; only
+// manifests name an image.
+func parseDistribution(body []byte) ([]oci.Reference, error) {
+	var env struct {
+		Events []struct {
+			Action string `json:"action"`
+			Target struct {
+				MediaType  string `json:"mediaType"`
+				Digest     string `json:"digest"`
+				Repository string `json:"repository"`
+				Tag        string `json:"tag"`
+			} `json:"target"`
+			Request struct {
+				Host string `json:"host"`
+			} `json:"request"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(body, &env); err != nil {
+		return nil, fmt.Errorf("webhook: %w", err)
+	}
+	var refs []oci.Reference
+	for _, e := range env.Events {
+		t := e.Target
+		if e.Action != "push" || t.Digest == "" || !isManifest(t.MediaType) {
+			continue
+		}
+		ref, err := pushed(e.Request.Host+"/"+t.Repository, t.Tag, t.Digest)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// isManifest reports whether mediaType is that of an image manifest or
+// index rather than a blob.
+func isManifest(mediaType string) bool {
+	switch mediaType {
+	case oci.MediaTypeOCIManifest, oci.MediaTypeOCIIndex, oci.MediaTypeDockerManifest, oci.MediaTypeDockerList:
+		return true
+	}
+	return false
+}
+
+// parseHarbor reads a Harbor webhook of the default payload format.
+func parseHarbor(body []byte) ([]oci.Reference, error) {
+	var n struct {
+		Type      string `json:"type"`
+		EventData struct {
+			Resources []struct {
+				Digest      string `json:"digest"`
+				Tag         string `json:"tag"`
+				ResourceURL string `json:"resource_url"`
+			} `json:"resources"`
+		} `json:"event_data"`
+	}
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("webhook: %w", err)
+	}
+	if n.Type != "PUSH_ARTIFACT" {
+		return nil, nil
+	}
+	var refs []oci.Reference
+	for _, res := range n.EventData.Resources {
+		if res.Digest == "" {
+			continue
+		}
+		// resource_url is the image by tag, or by digest when untagged.
+		name, _, _ := strings.Cut(res.ResourceURL, "@")
+		if res.Tag != "" {
+			name = strings.TrimSuffix(name, ":"+res.Tag)
+		}
+		ref, err := pushed(name, res.Tag, res.Digest)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// githubPackage is the package a GitHub package event is about.
+type githubPackage struct {
+	Name        string `json:"name"`
+	PackageType string `json:"package_type"`
+	Owner       struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	PackageVersion struct {
+		Version           string `json:"version"`
+		ContainerMetadata struct {
+			Tag struct {
+				Name   string `json:"name"`
+				Digest string `json:"digest"`
+			} `json:"tag"`
+		} `json:"container_metadata"`
+	} `json:"package_version"`
+}
+
+// parseGitHub reads a GitHub package or registry_package event, keeping
+// container images published to GHCR.
+func parseGitHub(body []byte) ([]oci.Reference, error) {
+	var e struct {
+		Action  string         `json:"action"`
+		Package *githubPackage `json:"package"`
+		// registry_package events carry the package under another key.
+		RegistryPackage *githubPackage `json:"registry_package"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("webhook: %w", err)
+	}
+	if e.Package == nil {
+		e.Package = e.RegistryPackage
+	}
+	p := e.Package
+	if e.Action != "published" || p == nil || !strings.EqualFold(p.PackageType, "container") {
+		return nil, nil
+	}
+	v := p.PackageVersion
+	digest := v.ContainerMetadata.Tag.Digest
+	if digest == "" {
+		digest = v.Version
+	}
+	if !strings.HasPrefix(digest, "sha256:") {
+		return nil, fmt.Errorf("webhook: package version %q has no image digest", v.Version)
+	}
+	ref, err := pushed("ghcr.io/"+strings.ToLower(p.Owner.Login)+"/"+p.Name, v.ContainerMetadata.Tag.Name, digest)
+	if err != nil {
+		return nil, err
+	}
+	return []oci.Reference{ref}, nil
+}
+
+// pushed returns the reference to an image pushed to name under tag, which
+// may be empty, and digest.
+func pushed(name, tag, digest string) (oci.Reference, error) {
+	ref, err := oci.ParseReference(name + "@" + digest)
+	if err != nil {
+		return oci.Reference{}, fmt.Errorf("webhook: %w", err)
+	}
+	ref.Tag = tag
+	return ref, nil
+}
+
+// Authorized reports whether a notification was sent by a registry that
+// knows secret: GitHub signs the body with it (X-Hub-Signature-256), while
+// Harbor and Distribution registries send it as the Authorization header,
+// configured with or without a "Bearer " prefix.
+func Authorized(h http.Header, body []byte, secret string) bool {
+	if sig, ok := strings.CutPrefix(h.Get("X-Hub-Signature-256"), "sha256="); ok {
+		got, err := hex.DecodeString(sig)
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return hmac.Equal(got, mac.Sum(nil))
+	}
+	auth := h.Get("Authorization")
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+		auth = token
+	}
+	return auth != "" && subtle.ConstantTimeCompare([]byte(auth), []byte(secret)) == 1
+}
@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		file   string
+		header http.Header
+		format string
+		want   []string
+	}{
+		{"distribution.json", nil, FormatDistribution, []string{
+			"registry.example.com/org/app:v1.2.0@sha256:0f5d4c2a9b6e7d8c1a3f5e7b9d0c2e4f6a8b0d2c4e6f8a0b2d4c6e8f0a2b4c6d",
+		}},
+		{"harbor.json", nil, FormatHarbor, []string{
+			"harbor.example.com/library/app:v2.0.1@sha256:1e2d3c4b5a69788796a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3",
+		}},
+		{"ghcr.json", http.Header{"X-Github-Event": {"package"}}, FormatGitHub, []string{
+			"ghcr.io/org/app:main@sha256:5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b",
+		}},
+		{"ghcr.json", http.Header{"X-Github-Event": {"push"}}, FormatGitHub, nil},
+	}
+	for _, tt := range tests {
+		body, err := os.ReadFile(filepath.Join("testdata", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs, format, err := Parse(tt.header, body)
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		var got []string
+		for _, ref := range refs {
+			got = append(got, ref.String())
+		}
+		if format != tt.format || len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("%s with %v: Parse() = %v, %s; want %v, %s", tt.file, tt.header, got, format, tt.want, tt.format)
+		}
+	}
+
+	if _, _, err := Parse(nil, []byte(`{"hello": "world"}`)); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("unknown payload: %v", err)
+	}
+	if _, _, err := Parse(nil, []byte(`{`)); err == nil {
+		t.Error("Parse accepted malformed JSON")
+	}
+	harborDelete := []byte(`{"type": "DELETE_ARTIFACT", "event_data": {"resources": [{"digest": "sha256:abc", "resource_url": "harbor.example.com/library/app:v1"}]}}`)
+	if refs, _, err := Parse(nil, harborDelete); err != nil || len(refs) != 0 {
+		t.Errorf("Harbor deletion = %v, %v; want no images", refs, err)
+	}
+}
+
+func TestAuthorized(t *testing.T) {
+	body := []byte(`{"events": []}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		header http.Header
+		want   bool
+	}{
+		{http.Header{"Authorization": {"s3cret"}}, true},
+		{http.Header{"Authorization": {"Bearer s3cret"}}, true},
+		{http.Header{"X-Hub-Signature-256": {signature}}, true},
+		{http.Header{"Authorization": {"Bearer wrong"}}, false},
+		{http.Header{"X-Hub-Signature-256": {"sha256=00"}}, false},
+		{http.Header{}, false},
+	}
+	for _, tt := range tests {
+		if got := Authorized(tt.header, body, "s3cret"); got != tt.want {
+			t.Errorf("Authorized(%v) = %t, want %t", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+// Package client is a Go client for the demo server's REST API, for
+// services in the cluster that verify images or read attestations
+// programmatically instead of shelling out to the CLI.
+//
+//	c := client.New("http://tekton-slsa-demo.default.svc:8080")
+//	res, err := c.VerifyImage(ctx, "ghcr.io/org/app@sha256:...", client.VerifyOptions{
+//		Identity: "https://github.com/org/app/.github/workflows/release.yaml@refs/heads/main",
+//	})
+//
+// The types mirror the server's JSON responses; fields the server adds
+// later are ignored until this package learns them.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the API of one server. Its zero value is not usable; the
+// fields may be changed before first use.
+type Client struct {
+	// URL is the server's base URL, such as http://localhost:8080.
+	URL string
+	// Token is the bearer token sent to endpoints that require one.
+	Token string
+	// HTTP makes the requests; http.DefaultClient when nil.
+	HTTP *http.Client
+}
+
+// New returns a client for the server at baseURL.
+func New(baseURL string) *Client {
+	return &Client{URL: baseURL}
+}
+
+// Code is the class of a verification failure. Automation can branch on
+// it without parsing error messages.
+type Code string
+
+// Codes of failure the server reports.
+const (
+	// CodeSignatureMismatch is a signature, attestation or log entry that
+	// does not verify against the image or a trusted key.
+	CodeSignatureMismatch Code = "SIGNATURE_MISMATCH"
+	// CodeIdentityRejected is a signer identity or issuer that is not
+	// allowed, denied or other than the one pinned for the repository.
+	CodeIdentityRejected Code = "IDENTITY_REJECTED"
+	// CodeRekorUnreachable is transparency log evidence that could not be
+	// fetched.
+	CodeRekorUnreachable Code = "REKOR_UNREACHABLE"
+	// CodePolicyDenied is an artifact that verified but failed a policy,
+	// such as a denied digest or missing annotations.
+	CodePolicyDenied Code = "POLICY_DENIED"
+	// CodeSchemaInvalid is an envelope, statement or predicate that does
+	// not decode or match its schema.
+	CodeSchemaInvalid Code = "SCHEMA_INVALID"
+	// CodeStaleProvenance is provenance older than the repository's
+	// current build, or replaying a log entry of another image.
+	CodeStaleProvenance Code = "STALE_PROVENANCE"
+)
+
+// Error is an API response with an unexpected status.
+type Error struct {
+	Method     string
+	Path       string
+	StatusCode int
+	// Message is the error the server reported.
+	Message string
+	// Code classifies the failure, when the server reported one in the
+	// X-Failure-Code header.
+	Code Code
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("client: %s %s: %d %s: %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Subject is an artifact an attestation is about.
+type Subject struct {
+	Name string `json:"name"`
+	// Digest maps algorithms, such as sha256, to hex digests.
+	Digest map[string]string `json:"digest"`
+}
+
+// Attestation is a stored DSSE envelope and what the server decoded from
+// it.
+type Attestation struct {
+	ID            string    `json:"id"`
+	PredicateType string    `json:"predicateType"`
+	Subjects      []Subject `json:"subjects"`
+	KeyIDs        []string  `json:"keyIds"`
+	ReceivedAt    time.Time `json:"receivedAt"`
+	// Envelope is the DSSE envelope as stored.
+	Envelope json.RawMessage `json:"envelope"`
+	// SchemaViolations are where the predicate does not match the schema
+	// of its type; such attestations are stored all the same.
+	SchemaViolations []SchemaViolation `json:"schemaViolations,omitempty"`
+	// Source links provenance to the commit it was built from; only
+	// GetAttestation fills it in.
+	Source *SourceLinks `json:"source,omitempty"`
+}
+
+// SourceLinks are links to the source of a build on GitHub or GitLab.
+type SourceLinks struct {
+	Forge      string `json:"forge"`
+	Repository string `json:"repository"`
+	Revision   string `json:"revision"`
+	Commit     string `json:"commit,omitempty"`
+	Tree       string `json:"tree"`
+	Pipeline   string `json:"pipeline,omitempty"`
+}
+
+// ListOptions filter ListAttestations; empty fields match everything.
+type ListOptions struct {
+	// Digest is a subject digest in "alg:hex" form.
+	Digest        string
+	PredicateType string
+}
+
+// SearchQuery selects attestations by fields of their predicate; empty
+// fields match everything.
+type SearchQuery struct {
+	PredicateType string
+	// Builder is the provenance builder ID.
+	Builder string
+	// Source is the source repository; Commit is a commit or a prefix of
+	// at least 7 characters.
+	Source, Commit string
+	// Since and Until bound the build time.
+	Since, Until time.Time
+	// Limit caps the results; zero leaves the server's default.
+	Limit int
+}
+
+// VerifyOptions mirror the flags of the verify subcommand.
+type VerifyOptions struct {
+	// Identity and Issuer are the certificate identity and OIDC issuer
+	// keyless signatures must carry.
+	Identity, Issuer string
+	// RequireTlog requires a transparency log entry for every signature.
+	RequireTlog bool
+	// Annotations are the key=value annotations signatures must carry.
+	Annotations map[string]string
+}
+
+// VerifyResult is the outcome of verifying an image.
+type VerifyResult struct {
+	Image  string  `json:"image"`
+	Digest string  `json:"digest"`
+	Checks []Check `json:"checks"`
+	// Verified is true when at least one signature or attestation
+	// verified.
+	Verified bool `json:"verified"`
+	// Code classifies why the image did not verify.
+	Code Code `json:"code,omitempty"`
+	// Replay reports provenance that is older than the repository's
+	// current build or replays another image's log entry.
+	Replay *ReplayReport `json:"replay,omitempty"`
+	// TOFU compares the signers with the identity pinned for the image's
+	// repository, when the server runs with trust on first use.
+	TOFU *TOFUReport `json:"tofu,omitempty"`
+}
+
+// Check is the outcome of verifying one signature or attestation.
+type Check struct {
+	// Kind is "signature" or "attestation".
+	Kind          string     `json:"kind"`
+	PredicateType string     `json:"predicateType,omitempty"`
+	Signer        string     `json:"signer,omitempty"`
+	Issuer        string     `json:"issuer,omitempty"`
+	LogIndex      *int64     `json:"logIndex,omitempty"`
+	SignedAt      *time.Time `json:"signedAt,omitempty"`
+	Verified      bool       `json:"verified"`
+	Error         string     `json:"error,omitempty"`
+	// Code classifies Error.
+	Code Code `json:"code,omitempty"`
+	// Annotations are the annotations of a signature's signed payload.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// SchemaViolations are where an attestation's predicate does not match
+	// the schema of its type. They do not affect Verified.
+	SchemaViolations []SchemaViolation `json:"schemaViolations,omitempty"`
+	// UnpinnedMaterials are the materials of a provenance attestation that
+	// are not pinned by digest. They do not affect Verified.
+	UnpinnedMaterials []UnpinnedMaterial `json:"unpinnedMaterials,omitempty"`
+}
+
+// SchemaViolation is where a predicate does not match its schema.
+type SchemaViolation struct {
+	// Path is the JSON pointer to the value; empty for the predicate
+	// itself.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// UnpinnedMaterial is a build material not pinned by digest.
+type UnpinnedMaterial struct {
+	URI    string `json:"uri,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ReplayReport is how a verified provenance compares with the logged
+// builds of the image's repository.
+type ReplayReport struct {
+	Repository string `json:"repository"`
+	Digest     string `json:"digest"`
+	// Current is the newest build of the repository, which may be Digest.
+	Current struct {
+		Digest   string    `json:"digest"`
+		LogIndex int64     `json:"logIndex"`
+		SignedAt time.Time `json:"signedAt"`
+	} `json:"current"`
+	Findings []ReplayFinding `json:"findings,omitempty"`
+}
+
+// ReplayFinding is a verified provenance that is stale, superseded or
+// replayed. Its Code is CodeStaleProvenance.
+type ReplayFinding struct {
+	// Kind is "stale", "superseded" or "replayed".
+	Kind          string    `json:"kind"`
+	Code          Code      `json:"code"`
+	PredicateType string    `json:"predicateType"`
+	LogIndex      int64     `json:"logIndex"`
+	SignedAt      time.Time `json:"signedAt"`
+	Detail        string    `json:"detail"`
+}
+
+// TOFUReport is how a verification compares with the repository's pinned
+// signer identity.
+type TOFUReport struct {
+	Repository string `json:"repository"`
+	Digest     string `json:"digest"`
+	Pin        struct {
+		Signer   string    `json:"signer"`
+		Issuer   string    `json:"issuer,omitempty"`
+		Digest   string    `json:"digest"`
+		PinnedAt time.Time `json:"pinnedAt"`
+	} `json:"pin"`
+	NewPin     bool `json:"newPin"`
+	Mismatches []struct {
+		Signer        string `json:"signer"`
+		Issuer        string `json:"issuer,omitempty"`
+		Kind          string `json:"kind"`
+		PredicateType string `json:"predicateType,omitempty"`
+	} `json:"mismatches,omitempty"`
+}
+
+// IngestResult reports what IngestAttestations stored.
+type IngestResult struct {
+	Added        int           `json:"added"`
+	Duplicates   int           `json:"duplicates"`
+	Attestations []Attestation `json:"attestations"`
+}
+
+// Health is the server's health report.
+type Health struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Version   string    `json:"version"`
+	Component string    `json:"component"`
+}
+
+// SBOM formats GetSBOM can return.
+const (
+	FormatSPDX      = "spdx"
+	FormatCycloneDX = "cyclonedx"
+)
+
+// Health reports whether the server is up.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var h Health
+	if err := c.do(ctx, http.MethodGet, "/health", nil, "", nil, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// VerifyImage verifies the signatures and attestations of the image at
+// ref, a reference by tag or digest.
+func (c *Client) VerifyImage(ctx context.Context, ref string, opts VerifyOptions) (*VerifyResult, error) {
+	q := url.Values{"image": {ref}}
+	if opts.Identity != "" {
+		q.Set("identity", opts.Identity)
+	}
+	if opts.Issuer != "" {
+		q.Set("issuer", opts.Issuer)
+	}
+	if opts.RequireTlog {
+		q.Set("requireTlog", "true")
+	}
+	keys := make([]string, 0, len(opts.Annotations))
+	for k := range opts.Annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		q.Add("annotation", k+"="+opts.Annotations[k])
+	}
+	var res VerifyResult
+	if err := c.do(ctx, http.MethodGet, "/api/v1/verify", q, "", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// attestationList is the body of the attestation list and search
+// responses.
+type attestationList struct {
+	Count        int           `json:"count"`
+	Attestations []Attestation `json:"attestations"`
+}
+
+// ListAttestations returns the stored attestations matching opts, most
+// recently received first.
+func (c *Client) ListAttestations(ctx context.Context, opts ListOptions) ([]Attestation, error) {
+	q := url.Values{}
+	if opts.Digest != "" {
+		q.Set("digest", opts.Digest)
+	}
+	if opts.PredicateType != "" {
+		q.Set("predicateType", opts.PredicateType)
+	}
+	var list attestationList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/attestations", q, "", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Attestations, nil
+}
+
+// SearchAttestations returns the attestations matching query, most recently
+// received first.
+func (c *Client) SearchAttestations(ctx context.Context, query SearchQuery) ([]Attestation, error) {
+	q := url.Values{}
+	for name, v := range map[string]string{
+		"predicateType": query.PredicateType,
+		"builder":       query.Builder,
+		"source":        query.Source,
+		"commit":        query.Commit,
+	} {
+		if v != "" {
+			q.Set(name, v)
+		}
+	}
+	if !query.Since.IsZero() {
+		q.Set("since", query.Since.Format(time.RFC3339))
+	}
+	if !query.Until.IsZero() {
+		q.Set("until", query.Until.Format(time.RFC3339))
+	}
+	if query.Limit > 0 {
+		q.Set("limit", strconv.Itoa(query.Limit))
+	}
+	var list attestationList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/attestations/search", q, "", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Attestations, nil
+}
+
+// GetAttestation returns the attestation with the given ID.
+func (c *Client) GetAttestation(ctx context.Context, id string) (*Attestation, error) {
+	var a Attestation
+	if err := c.do(ctx, http.MethodGet, "/api/v1/attestations/"+url.PathEscape(id), nil, "", nil, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// IngestAttestations uploads DSSE envelopes: a JSON envelope, an array of
+// them, or one per line. It needs the client's Token.
+func (c *Client) IngestAttestations(ctx context.Context, envelopes []byte) (*IngestResult, error) {
+	var res IngestResult
+	if err := c.do(ctx, http.MethodPost, "/api/v1/attestations", nil, "application/json", bytes.NewReader(envelopes), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// GetSBOM returns the server's own SBOM in format, FormatSPDX or
+// FormatCycloneDX.
+func (c *Client) GetSBOM(ctx context.Context, format string) ([]byte, error) {
+	var doc json.RawMessage
+	if err := c.do(ctx, http.MethodGet, "/sbom", url.Values{"format": {format}}, "", nil, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// do sends a request and decodes its JSON response into out.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, contentType string, body io.Reader, out any) error {
+	u := strings.TrimSuffix(c.URL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("client: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &Error{Method: method, Path: path, StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg)), Code: Code(resp.Header.Get("X-Failure-Code"))}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("client: decoding %s response: %w", path, err)
+	}
+	return nil
+}
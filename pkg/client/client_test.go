@@ -0,0 +1,186 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/dsse"
+	"github.com/waveywaves/tekton-slsa-demo/internal/failure"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/schema"
+	"github.com/waveywaves/tekton-slsa-demo/internal/server"
+	"github.com/waveywaves/tekton-slsa-demo/internal/store"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+// newServer serves the real API, with sample data and a stub verifier.
+func newServer(t *testing.T) *Client {
+	t.Helper()
+	st := store.New()
+	if _, err := server.SeedSampleData(st, time.Date(2024, 3, 12, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	h := server.NewServer(server.Config{APIToken: "s3cret"}, server.Deps{
+		Store: st,
+		Verify: func(_ context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+			return &verify.Result{
+				Image:    ref.String(),
+				Digest:   "sha256:deadbeef",
+				Checks:   []verify.Check{{Kind: verify.KindAttestation, PredicateType: attestation.PredicateSLSAProvenanceV1, Signer: opts.Identity, Verified: true}},
+				Verified: true,
+			}, nil
+		},
+	})
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return New(srv.URL + "/")
+}
+
+func TestClient(t *testing.T) {
+	c := newServer(t)
+	ctx := context.Background()
+
+	if h, err := c.Health(ctx); err != nil || h.Status != "healthy" {
+		t.Errorf("Health() = %+v, %v", h, err)
+	}
+
+	res, err := c.VerifyImage(ctx, "ghcr.io/org/app:v1", VerifyOptions{Identity: "release@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Verified || res.Image != "ghcr.io/org/app:v1" || res.Checks[0].Signer != "release@example.com" {
+		t.Errorf("VerifyImage() = %+v", res)
+	}
+
+	all, err := c.ListAttestations(ctx, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2*len(server.SampleImages) {
+		t.Fatalf("ListAttestations() returned %d attestations", len(all))
+	}
+	prov, err := c.ListAttestations(ctx, ListOptions{PredicateType: attestation.PredicateSLSAProvenanceV1})
+	if err != nil || len(prov) != len(server.SampleImages) {
+		t.Errorf("provenance: %d attestations, %v", len(prov), err)
+	}
+	found, err := c.SearchAttestations(ctx, SearchQuery{Builder: "https://tekton.dev/chains/v2", Limit: 2})
+	if err != nil || len(found) != 2 {
+		t.Errorf("SearchAttestations() = %d attestations, %v", len(found), err)
+	}
+
+	a, err := c.GetAttestation(ctx, prov[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID != prov[0].ID || a.Source == nil || a.Source.Forge != "github" || len(a.Envelope) == 0 {
+		t.Errorf("GetAttestation() = %+v", a)
+	}
+
+	for _, format := range []string{FormatSPDX, FormatCycloneDX} {
+		doc, err := c.GetSBOM(ctx, format)
+		if err != nil || !json.Valid(doc) {
+			t.Errorf("GetSBOM(%s): %v", format, err)
+		}
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	c := newServer(t)
+	ctx := context.Background()
+
+	_, err := c.GetAttestation(ctx, "missing")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "attestation not found" {
+		t.Errorf("unknown attestation: %v", err)
+	}
+	if _, err := c.SearchAttestations(ctx, SearchQuery{Commit: "abc"}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("short commit: %v", err)
+	}
+	if _, err := c.GetSBOM(ctx, "xml"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown SBOM format: %v", err)
+	}
+
+	stmt, _ := attestation.NewStatement(attestation.PredicateSLSAProvenanceV1, attestation.Provenance{},
+		attestation.Subject{Name: "app", Digest: map[string]string{"sha256": "abc"}})
+	payload, _ := json.Marshal(stmt)
+	env, err := dsse.Sign(attestation.PayloadType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(env)
+	if _, err := c.IngestAttestations(ctx, body); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("ingest without a token: %v", err)
+	}
+	c.Token = "s3cret"
+	res, err := c.IngestAttestations(ctx, body)
+	if err != nil || res.Added != 1 || res.Attestations[0].Subjects[0].Digest["sha256"] != "abc" {
+		t.Errorf("IngestAttestations() = %+v, %v", res, err)
+	}
+
+	c.URL = "http://127.0.0.1:0"
+	if _, err := c.Health(ctx); err == nil || !strings.HasPrefix(err.Error(), "client: ") {
+		t.Errorf("unreachable server: %v", err)
+	}
+}
+
+func TestClientCodedFailure(t *testing.T) {
+	h := server.NewServer(server.Config{}, server.Deps{
+		Verify: func(_ context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+			if ref.Tag == "offline" {
+				return nil, failure.New(failure.RekorUnreachable, "fetching log entry 7: %w", io.ErrUnexpectedEOF)
+			}
+			res := &verify.Result{
+				Image:  ref.String(),
+				Digest: "sha256:deadbeef",
+				Checks: []verify.Check{
+					{Kind: verify.KindSignature, Error: "missing annotation env=prod", Code: failure.PolicyDenied, Annotations: opts.Annotations},
+					{
+						Kind:              verify.KindAttestation,
+						PredicateType:     attestation.PredicateSLSAProvenanceV1,
+						Verified:          true,
+						SchemaViolations:  []schema.Violation{{Path: "/buildDefinition/buildType", Message: "is required"}},
+						UnpinnedMaterials: []attestation.UnpinnedMaterial{{URI: "git+https://github.com/org/app", Reason: "no digest"}},
+					},
+				},
+			}
+			res.Classify()
+			return res, nil
+		},
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	res, err := c.VerifyImage(ctx, "ghcr.io/org/app:v1", VerifyOptions{Annotations: map[string]string{"env": "prod", "team": "core"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Verified || res.Code != CodePolicyDenied {
+		t.Errorf("VerifyImage() = verified %v, code %q; want %q", res.Verified, res.Code, CodePolicyDenied)
+	}
+	sig, att := res.Checks[0], res.Checks[1]
+	if sig.Code != CodePolicyDenied || sig.Annotations["env"] != "prod" || sig.Annotations["team"] != "core" {
+		t.Errorf("signature check = %+v", sig)
+	}
+	if len(att.SchemaViolations) != 1 || att.SchemaViolations[0].Path != "/buildDefinition/buildType" {
+		t.Errorf("schema violations = %+v", att.SchemaViolations)
+	}
+	if len(att.UnpinnedMaterials) != 1 || att.UnpinnedMaterials[0].Reason != "no digest" {
+		t.Errorf("unpinned materials = %+v", att.UnpinnedMaterials)
+	}
+
+	_, err = c.VerifyImage(ctx, "ghcr.io/org/app:offline", VerifyOptions{})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || apiErr.Code != CodeRekorUnreachable {
+		t.Errorf("unreachable Rekor: %v", err)
+	}
+}
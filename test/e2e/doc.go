@@ -0,0 +1,13 @@
+// Package e2e holds the end-to-end test, which builds an image with the
+// demo pipeline on a kind cluster running Tekton Pipelines and Chains and
+// checks that the server discovers and verifies the resulting provenance.
+//
+// The test is behind the e2e build tag so go test ./... never needs a
+// cluster. Set the cluster up with scripts/01 to scripts/04b, then run
+//
+//	make e2e
+//
+// or, with flags,
+//
+//	go test -tags e2e -v -timeout 30m ./test/e2e -args -context kind-tekton-slsa-demo
+package e2e
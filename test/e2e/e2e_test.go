@@ -0,0 +1,323 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/tekton-slsa-demo/internal/attestation"
+	"github.com/waveywaves/tekton-slsa-demo/internal/cosign"
+	"github.com/waveywaves/tekton-slsa-demo/internal/oci"
+	"github.com/waveywaves/tekton-slsa-demo/internal/rekor"
+	"github.com/waveywaves/tekton-slsa-demo/internal/server"
+	"github.com/waveywaves/tekton-slsa-demo/internal/signing"
+	"github.com/waveywaves/tekton-slsa-demo/internal/trust"
+	"github.com/waveywaves/tekton-slsa-demo/internal/verify"
+)
+
+var (
+	kubeContext = flag.String("context", "kind-tekton-slsa-demo", "kubectl context of the kind cluster")
+	namespace   = flag.String("namespace", "default", "namespace to run the pipeline in")
+	imageName   = flag.String("image", "", "repository to push the built image to (default ttl.sh/tekton-slsa-demo-e2e-<time>)")
+	rekorURL    = flag.String("rekor-url", rekor.DefaultURL, "Rekor instance Chains records entries in; empty skips the transparency log")
+	keyFile     = flag.String("key", "", "Chains public key (default: cosign.pub from the signing-secrets secret)")
+	runTimeout  = flag.Duration("run-timeout", 15*time.Minute, "how long to wait for the PipelineRun")
+)
+
+// repoRoot is where the Kubernetes manifests live, relative to this package.
+const repoRoot = "../.."
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if err := checkCluster(); err != nil {
+		fmt.Fprintf(os.Stderr, "e2e: %v\nSet up the cluster with scripts/01-setup-kind-cluster-with-oidc.sh through scripts/04b-configure-key-signing.sh first.\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// kubectl runs kubectl against the test cluster and returns its stdout.
+func kubectl(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "kubectl", append([]string{"--context", *kubeContext}, args...)...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("kubectl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func checkCluster() error {
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for _, d := range []struct{ ns, name string }{
+		{"tekton-pipelines", "tekton-pipelines-controller"},
+		{"tekton-chains", "tekton-chains-controller"},
+	} {
+		if _, err := kubectl(ctx, nil, "rollout", "status", "-n", d.ns, "deployment/"+d.name, "--timeout=30s"); err != nil {
+			return fmt.Errorf("%s is not ready: %w", d.name, err)
+		}
+	}
+	return nil
+}
+
+func TestBuildDiscoverVerify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), *runTimeout+10*time.Minute)
+	defer cancel()
+
+	for _, m := range []string{"service-account.yaml", "workspace-pvc.yaml", "enhanced-build-task.yaml", "slsa-demo-pipeline.yaml"} {
+		if _, err := kubectl(ctx, nil, "apply", "-n", *namespace, "-f", filepath.Join(repoRoot, "k8s", m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ref := runPipeline(ctx, t)
+	t.Logf("built %s", ref)
+
+	envs := discover(ctx, t, ref)
+	pub := chainsKey(ctx, t)
+
+	// Serve the app with a verifier trusting the Chains key and Rekor.
+	root, err := trust.Fetch(ctx, nil, *rekorURL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddPublicKey(pub); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(server.NewServer(server.Config{APIToken: "e2e"}, server.Deps{
+		Verify: func(ctx context.Context, ref oci.Reference, opts verify.Options) (*verify.Result, error) {
+			var rc verify.RekorClient
+			if *rekorURL != "" {
+				rc = rekor.NewClient(*rekorURL)
+			}
+			ev, err := verify.Collect(ctx, oci.NewClient(), rc, ref)
+			if err != nil {
+				return nil, err
+			}
+			opts.Root = root
+			return verify.Verify(ev, opts)
+		},
+	}))
+	defer srv.Close()
+
+	t.Run("ingest", func(t *testing.T) {
+		var body bytes.Buffer
+		for _, env := range envs {
+			json.NewEncoder(&body).Encode(env)
+		}
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/api/v1/attestations", &body)
+		req.Header.Set("Authorization", "Bearer e2e")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("ingest: status %d", resp.StatusCode)
+		}
+
+		var list struct {
+			Count        int `json:"count"`
+			Attestations []struct {
+				PredicateType string `json:"predicateType"`
+			} `json:"attestations"`
+		}
+		getJSON(ctx, t, srv.URL+"/api/v1/attestations?digest="+url.QueryEscape(ref.Digest), &list)
+		found := false
+		for _, a := range list.Attestations {
+			found = found || attestation.IsProvenance(a.PredicateType)
+		}
+		if !found {
+			t.Errorf("no provenance listed for %s: %+v", ref.Digest, list)
+		}
+	})
+
+	t.Run("verify api", func(t *testing.T) {
+		var res verify.Result
+		q := url.Values{"image": {ref.String()}, "requireTlog": {fmt.Sprint(*rekorURL != "")}}
+		getJSON(ctx, t, srv.URL+"/api/v1/verify?"+q.Encode(), &res)
+		if !res.Verified {
+			t.Fatalf("image did not verify: %+v", res.Checks)
+		}
+		provenance := false
+		for _, c := range res.Checks {
+			provenance = provenance || (c.Verified && attestation.IsProvenance(c.PredicateType))
+		}
+		if !provenance {
+			t.Errorf("no verified provenance attestation: %+v", res.Checks)
+		}
+	})
+
+	t.Run("verify cli", func(t *testing.T) {
+		keyPath := filepath.Join(t.TempDir(), "cosign.pub")
+		p, err := signing.MarshalPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(keyPath, p, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		args := []string{"run", filepath.Join(repoRoot, "cmd"), "verify", "--key", keyPath}
+		if *rekorURL == "" {
+			args = append(args, "--no-tlog")
+		} else {
+			args = append(args, "--rekor-url", *rekorURL, "--require-tlog")
+		}
+		out, err := exec.CommandContext(ctx, "go", append(args, ref.String())...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("verify: %v\n%s", err, out)
+		}
+		if !bytes.Contains(out, []byte("Verification: PASSED")) {
+			t.Errorf("unexpected verify output:\n%s", out)
+		}
+	})
+}
+
+// runPipeline starts the demo pipeline, waits for it to succeed and returns
+// the digest-pinned image it built.
+func runPipeline(ctx context.Context, t *testing.T) oci.Reference {
+	t.Helper()
+	image := *imageName
+	if image == "" {
+		image = fmt.Sprintf("ttl.sh/tekton-slsa-demo-e2e-%d", time.Now().Unix())
+	}
+	run := map[string]any{
+		"apiVersion": "tekton.dev/v1",
+		"kind":       "PipelineRun",
+		"metadata":   map[string]any{"generateName": "slsa-demo-e2e-", "labels": map[string]string{"slsa-demo": "true"}},
+		"spec": map[string]any{
+			"pipelineRef": map[string]string{"name": "slsa-demo-pipeline"},
+			"params": []map[string]string{
+				{"name": "IMAGE_NAME", "value": image},
+				// ttl.sh reads the tag as the image's lifetime.
+				{"name": "IMAGE_TAG", "value": "2h"},
+			},
+			"workspaces": []map[string]any{{"name": "shared-data", "persistentVolumeClaim": map[string]string{"claimName": "demo-workspace-pvc"}}},
+		},
+	}
+	manifest, _ := json.Marshal(run)
+	out, err := kubectl(ctx, manifest, "create", "-n", *namespace, "-f", "-", "-o", "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := strings.TrimSpace(string(out))
+	t.Logf("started %s", name)
+	if _, err := kubectl(ctx, nil, "wait", "-n", *namespace, "--for=condition=Succeeded", name, "--timeout="+runTimeout.String()); err != nil {
+		logs, _ := kubectl(ctx, nil, "get", "-n", *namespace, name, "-o", "jsonpath={.status.conditions}")
+		t.Fatalf("%v\nconditions: %s", err, logs)
+	}
+
+	out, err = kubectl(ctx, nil, "get", "-n", *namespace, name, "-o", "jsonpath={.status.results}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []struct{ Name, Value string }
+	if err := json.Unmarshal(out, &results); err != nil {
+		t.Fatalf("decoding results %s: %v", out, err)
+	}
+	var imageURL, digest string
+	for _, r := range results {
+		switch r.Name {
+		case "IMAGE_URL":
+			imageURL = r.Value
+		case "IMAGE_DIGEST":
+			digest = r.Value
+		}
+	}
+	ref, err := oci.ParseReference(imageURL)
+	if err != nil || digest == "" {
+		t.Fatalf("pipeline results %+v do not name an image: %v", results, err)
+	}
+	return ref.WithDigest(digest)
+}
+
+// discover waits for Chains to attach SLSA provenance to ref and returns
+// the attached envelopes.
+func discover(ctx context.Context, t *testing.T, ref oci.Reference) []json.RawMessage {
+	t.Helper()
+	c := oci.NewClient()
+	deadline := time.Now().Add(5 * time.Minute)
+	for {
+		atts, err := cosign.Attestations(ctx, c, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var envs []json.RawMessage
+		provenance := false
+		for _, a := range atts {
+			envs = append(envs, a.Raw)
+			provenance = provenance || attestation.IsProvenance(a.PredicateType)
+		}
+		if provenance {
+			return envs
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Chains attached no provenance to %s within 5m (%d attestations)", ref, len(atts))
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// chainsKey returns the public key Chains signs with.
+func chainsKey(ctx context.Context, t *testing.T) crypto.PublicKey {
+	t.Helper()
+	var data []byte
+	if *keyFile != "" {
+		var err error
+		if data, err = os.ReadFile(*keyFile); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		out, err := kubectl(ctx, nil, "get", "secret", "signing-secrets", "-n", "tekton-chains", "-o", `jsonpath={.data.cosign\.pub}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err = base64.StdEncoding.DecodeString(string(out)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pub, err := signing.ParsePublicKey(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+func getJSON(ctx context.Context, t *testing.T, u string, v any) {
+	t.Helper()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", u, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}